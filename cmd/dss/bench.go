@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/dss"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/metrics"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/miekg/dns"
+	"github.com/spf13/cobra"
+)
+
+// benchFakeDomains is the number of domains benchmarked with --fakeNetwork
+// when no --domains are given.
+const benchFakeDomains = 100
+
+func init() {
+	cmd.AddCommand(cmdBench)
+
+	cmdBench.Flags().StringVar(&benchDomains, "domains", "", "A file of domains to scan, one per line (required unless --fakeNetwork is set)")
+	cmdBench.Flags().DurationVar(&benchDuration, "duration", time.Minute, "How long to keep scanning for")
+	cmdBench.Flags().BoolVar(&benchFakeNetwork, "fakeNetwork", false, "Answer every DNS query from a generated zone and skip every check that needs internet access, so nothing leaves the process")
+	cmdBench.Flags().Float64Var(&benchRate, "rate", 0, "The number of scans started per second (0 starts them as fast as --concurrent allows)")
+}
+
+var (
+	benchDomains     string
+	benchDuration    time.Duration
+	benchFakeNetwork bool
+	benchRate        float64
+)
+
+type (
+	// benchReport is the outcome of a benchmark.
+	benchReport struct {
+		Duration       string                  `json:"duration" yaml:"duration"`
+		Scans          int                     `json:"scans" yaml:"scans"`
+		Errors         int                     `json:"errors" yaml:"errors"`
+		ScansPerSecond float64                 `json:"scansPerSecond" yaml:"scansPerSecond"`
+		DNSQueries     uint64                  `json:"dnsQueries" yaml:"dnsQueries"`
+		Latency        map[string]benchLatency `json:"latency" yaml:"latency"`
+		CacheHitRates  map[string]float64      `json:"cacheHitRates" yaml:"cacheHitRates"`
+	}
+
+	// benchLatency holds the percentiles of an operation's durations.
+	benchLatency struct {
+		Count int    `json:"count" yaml:"count"`
+		P50   string `json:"p50" yaml:"p50"`
+		P95   string `json:"p95" yaml:"p95"`
+		P99   string `json:"p99" yaml:"p99"`
+	}
+
+	// benchRecorder collects the durations of a benchmark's operations. It's
+	// safe for concurrent use.
+	benchRecorder struct {
+		mutex     sync.Mutex
+		durations map[string][]time.Duration
+		errors    int
+		scans     int
+
+		// seen holds the results whose lookups were recorded, as cached
+		// results are returned as is, with the timings of their original scan
+		seen map[*scanner.Result]struct{}
+	}
+)
+
+var cmdBench = &cobra.Command{
+	Use:     "bench [flags]",
+	Example: "  dss bench --domains fixtures.txt --rate 50 --duration 60s\n  dss bench --fakeNetwork --duration 10s --format json",
+	Short:   "Measure the throughput of the scan pipeline.",
+	Long:    "Scan and advise on the domains listed in --domains over and over for --duration, starting up to --rate scans per second, then report the percentiles of each lookup's and check's duration, the scans per second, the DNS queries sent and the hit rate of each cache.\nEvery global flag (such as --timeout, --concurrent and --cacheTTL) applies as it does to dss scan, so configuration changes can be measured before they're deployed.\nWith --fakeNetwork, DNS queries are answered from a generated zone and the checks that need internet access are skipped, for benchmarking in CI without touching real infrastructure.\nThe report is printed as tables, unless --format is set.",
+	Args:    cobra.NoArgs,
+	Run: func(command *cobra.Command, args []string) {
+		if benchDuration <= 0 {
+			log.Fatal().Msg("--duration must be positive.")
+		}
+
+		if benchRate < 0 {
+			log.Fatal().Msg("--rate can't be negative.")
+		}
+
+		domains, err := loadBenchDomains(benchDomains, benchFakeNetwork)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid --domains value.")
+		}
+
+		opts := scannerOptions()
+
+		var advisorOpts []advisor.Option
+
+		if benchFakeNetwork {
+			zone, err := dss.NewZoneResolver(fakeZone(domains))
+			if err != nil {
+				log.Fatal().Err(err).Msg("An unexpected error occurred.")
+			}
+
+			opts = append(opts, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver {
+				return zone
+			}))
+			advisorOpts = append(advisorOpts, advisor.WithHostResolver(zone), advisor.WithOffline(true))
+		}
+
+		// queries are counted after any other middleware, so every query sent to the resolver is counted
+		registry := metrics.New()
+		opts = append(opts, scanner.WithResolverMiddleware(registry.Resolver))
+
+		sc, err := scanner.New(log, timeout, opts...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("An unexpected error occurred.")
+		}
+		defer sc.Close()
+
+		domainAdvisor := newAdvisor(append(advisorOpts, advisor.WithProbeReuse(true))...)
+		defer domainAdvisor.Close()
+
+		log.Info().Msg(fmt.Sprintf("Benchmarking %d domains for %s.", len(domains), benchDuration))
+
+		report := runBenchmark(sc, domainAdvisor, domains, benchRate, benchDuration, int(max(concurrent, 1)))
+		report.DNSQueries = registry.DNSQueries()
+
+		if !command.Flags().Changed("format") || strings.EqualFold(format, "table") {
+			fmt.Print(report.Table())
+			return
+		}
+
+		printToConsole(report)
+	},
+}
+
+// loadBenchDomains returns the valid domains of the file, one per line, or
+// generated domains if the file isn't given with --fakeNetwork. Blank lines
+// and lines starting with # are skipped.
+func loadBenchDomains(path string, fakeNetwork bool) ([]string, error) {
+	if path == "" {
+		if !fakeNetwork {
+			return nil, errors.New("a file of domains is required unless --fakeNetwork is set")
+		}
+
+		domains := make([]string, benchFakeDomains)
+		for index := range domains {
+			domains[index] = fmt.Sprintf("domain%d.example.com", index)
+		}
+
+		return domains, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+
+	lineScanner := bufio.NewScanner(file)
+	for lineScanner.Scan() {
+		if line := strings.TrimSpace(lineScanner.Text()); !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+
+	if err = lineScanner.Err(); err != nil {
+		return nil, err
+	}
+
+	domains := validDomains(lines...)
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("%s has no valid domains", path)
+	}
+
+	return domains, nil
+}
+
+// fakeZone returns a zone file giving each domain a nameserver, a mail server
+// with an address, and SPF and DMARC records, so every lookup and check has a
+// record to evaluate.
+func fakeZone(domains []string) string {
+	var builder strings.Builder
+
+	for _, domain := range domains {
+		domain = dns.Fqdn(strings.ToLower(domain))
+
+		fmt.Fprintf(&builder, "%s 300 IN NS ns1.%s\n", domain, domain)
+		fmt.Fprintf(&builder, "%s 300 IN A 192.0.2.1\n", domain)
+		fmt.Fprintf(&builder, "%s 300 IN MX 10 mx1.%s\n", domain, domain)
+		fmt.Fprintf(&builder, "%s 300 IN TXT \"v=spf1 mx -all\"\n", domain)
+		fmt.Fprintf(&builder, "_dmarc.%s 300 IN TXT \"v=DMARC1; p=reject; rua=mailto:dmarc@%s\"\n", domain, strings.TrimSuffix(domain, "."))
+		fmt.Fprintf(&builder, "ns1.%s 300 IN A 192.0.2.53\n", domain)
+		fmt.Fprintf(&builder, "mx1.%s 300 IN A 192.0.2.25\n", domain)
+	}
+
+	return builder.String()
+}
+
+// runBenchmark scans and advises on the domains in turn, over and over, with
+// the given number of workers, until the duration has passed. Up to rate
+// scans are started each second, or as many as the workers can take if it's
+// 0. Scans in progress once the duration has passed are still recorded.
+func runBenchmark(sc *scanner.Scanner, domainAdvisor *advisor.Advisor, domains []string, rate float64, duration time.Duration, workers int) *benchReport {
+	recorder := &benchRecorder{durations: make(map[string][]time.Duration), seen: make(map[*scanner.Result]struct{})}
+	jobs := make(chan string)
+
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for domain := range jobs {
+				recorder.scan(sc, domainAdvisor, domain)
+			}
+		}()
+	}
+
+	start := time.Now()
+	deadline := time.NewTimer(duration)
+	defer deadline.Stop()
+
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+dispatch:
+	for index := 0; ; index++ {
+		if tick != nil {
+			select {
+			case <-deadline.C:
+				break dispatch
+			case <-tick:
+			}
+		}
+
+		select {
+		case <-deadline.C:
+			break dispatch
+		case jobs <- domains[index%len(domains)]:
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return recorder.report(time.Since(start), cacheHitRates(sc, domainAdvisor))
+}
+
+// cacheHitRates returns the hit rate of the scanner's cache of results, and
+// of each of the advisor's cache namespaces that was used, rounded to three
+// decimal places.
+func cacheHitRates(sc *scanner.Scanner, domainAdvisor *advisor.Advisor) map[string]float64 {
+	hitRates := map[string]float64{"results": math.Round(sc.CacheStats().HitRate()*1000) / 1000}
+
+	for namespace, stats := range domainAdvisor.CacheStats() {
+		if stats.Hits+stats.Misses > 0 {
+			hitRates[namespace] = math.Round(stats.HitRate()*1000) / 1000
+		}
+	}
+
+	return hitRates
+}
+
+// scan scans and advises on the domain, recording the duration of the whole
+// scan, and of each of its lookups and checks.
+func (r *benchRecorder) scan(sc *scanner.Scanner, domainAdvisor *advisor.Advisor, domain string) {
+	start := time.Now()
+
+	results, err := sc.Scan(domain)
+	if err != nil || len(results) != 1 {
+		r.mutex.Lock()
+		r.scans++
+		r.errors++
+		r.mutex.Unlock()
+
+		return
+	}
+
+	result := results[0]
+
+	var advice *advisor.Advice
+	if result.Error != scanner.ErrInvalidDomain {
+		advice = model.Advise(context.Background(), domainAdvisor, result, false)
+	}
+
+	elapsed := time.Since(start)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.scans++
+	r.durations["scan"] = append(r.durations["scan"], elapsed)
+
+	if result.Error != "" || (advice != nil && len(advice.Errors) > 0) {
+		r.errors++
+	}
+
+	if _, ok := r.seen[result]; !ok {
+		r.seen[result] = struct{}{}
+		r.record(result.Timings)
+	}
+
+	if advice != nil {
+		r.record(advice.Timings)
+	}
+}
+
+// record adds each of the timings (as formatted in scanner.Result.Timings)
+// to the durations. The mutex must be held.
+func (r *benchRecorder) record(timings map[string]string) {
+	for name, value := range timings {
+		if duration, err := time.ParseDuration(value); err == nil {
+			r.durations[name] = append(r.durations[name], duration)
+		}
+	}
+}
+
+// report returns the benchmark's report after the elapsed time, with the
+// given cache hit rates, by cache.
+func (r *benchRecorder) report(elapsed time.Duration, hitRates map[string]float64) *benchReport {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	report := &benchReport{
+		Duration:       elapsed.Round(time.Millisecond).String(),
+		Scans:          r.scans,
+		Errors:         r.errors,
+		ScansPerSecond: math.Round(float64(r.scans)/elapsed.Seconds()*100) / 100,
+		Latency:        make(map[string]benchLatency, len(r.durations)),
+		CacheHitRates:  hitRates,
+	}
+
+	for name, durations := range r.durations {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+		report.Latency[name] = benchLatency{
+			Count: len(durations),
+			P50:   percentile(durations, 0.5).String(),
+			P95:   percentile(durations, 0.95).String(),
+			P99:   percentile(durations, 0.99).String(),
+		}
+	}
+
+	return report
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, fraction float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(fraction*float64(len(sorted)))) - 1
+
+	return sorted[max(rank, 0)].Round(time.Microsecond)
+}
+
+// Table returns the report formatted as tables, with the latencies sorted by
+// name after the whole scan's.
+func (r *benchReport) Table() string {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(writer, "Duration\t%s\n", r.Duration)
+	fmt.Fprintf(writer, "Scans\t%d\n", r.Scans)
+	fmt.Fprintf(writer, "With errors\t%d\n", r.Errors)
+	fmt.Fprintf(writer, "Scans per second\t%.2f\n", r.ScansPerSecond)
+	fmt.Fprintf(writer, "DNS queries\t%d\n", r.DNSQueries)
+
+	names := make([]string, 0, len(r.Latency))
+	for name := range r.Latency {
+		if name != "scan" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	if _, ok := r.Latency["scan"]; ok {
+		names = append([]string{"scan"}, names...)
+	}
+
+	fmt.Fprintf(writer, "\nOperation\tCount\tp50\tp95\tp99\n")
+	for _, name := range names {
+		latency := r.Latency[name]
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%s\n", name, latency.Count, latency.P50, latency.P95, latency.P99)
+	}
+
+	namespaces := make([]string, 0, len(r.CacheHitRates))
+	for namespace := range r.CacheHitRates {
+		namespaces = append(namespaces, namespace)
+	}
+
+	sort.Strings(namespaces)
+
+	fmt.Fprintf(writer, "\nCache\tHit rate\n")
+	for _, namespace := range namespaces {
+		fmt.Fprintf(writer, "%s\t%.1f%%\n", namespace, r.CacheHitRates[namespace]*100)
+	}
+
+	_ = writer.Flush()
+
+	return buffer.String()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/dss"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/metrics"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	durations := make([]time.Duration, 100)
+	for index := range durations {
+		durations[index] = time.Duration(index+1) * time.Millisecond
+	}
+
+	require.Equal(t, 50*time.Millisecond, percentile(durations, 0.5))
+	require.Equal(t, 95*time.Millisecond, percentile(durations, 0.95))
+	require.Equal(t, 99*time.Millisecond, percentile(durations, 0.99))
+	require.Equal(t, time.Millisecond, percentile(durations[:1], 0.99))
+	require.Zero(t, percentile(nil, 0.5))
+}
+
+func TestLoadBenchDomains(t *testing.T) {
+	domains, err := loadBenchDomains("", true)
+	require.NoError(t, err)
+	require.Len(t, domains, benchFakeDomains)
+
+	_, err = loadBenchDomains("", false)
+	require.Error(t, err)
+}
+
+func TestRunBenchmark_FakeNetwork(t *testing.T) {
+	domains := []string{"example.com", "example.net"}
+
+	zone, err := dss.NewZoneResolver(fakeZone(domains))
+	require.NoError(t, err)
+
+	registry := metrics.New()
+
+	sc, err := scanner.New(log, time.Second,
+		scanner.WithCacheDuration(time.Minute),
+		scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver { return zone }),
+		scanner.WithResolverMiddleware(registry.Resolver),
+	)
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	domainAdvisor := advisor.NewAdvisor(time.Second, time.Minute, false, advisor.WithHostResolver(zone), advisor.WithOffline(true))
+	t.Cleanup(domainAdvisor.Close)
+
+	report := runBenchmark(sc, domainAdvisor, domains, 0, 200*time.Millisecond, 2)
+
+	require.Greater(t, report.Scans, len(domains))
+	require.Zero(t, report.Errors)
+	require.Positive(t, registry.DNSQueries())
+
+	// each domain is only looked up once, as every other scan is answered from the cache
+	require.Equal(t, len(domains), report.Latency["dmarc_lookup"].Count)
+	require.Equal(t, report.Scans, report.Latency["dmarc_check"].Count)
+	require.Equal(t, report.Scans, report.Latency["scan"].Count)
+	require.Greater(t, report.CacheHitRates["results"], 0.5)
+
+	table := report.Table()
+	require.Contains(t, table, "dmarc_lookup")
+	require.Contains(t, table, "results")
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"unicode"
 
 	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"gopkg.in/yaml.v3"
 )
 
@@ -14,8 +18,40 @@ func init() {
 	cmdConfig.AddCommand(cmdConfigGet)
 	cmdConfig.AddCommand(cmdConfigSet)
 	cmdConfig.AddCommand(cmdConfigShow)
+	cmdConfig.AddCommand(cmdConfigValidate)
 }
 
+const (
+	// envPrefix is prepended to each flag's environment variable name.
+	envPrefix = "DSS_"
+
+	// envFileSuffix marks an environment variable whose value is the path to a
+	// file containing a secret, such as a mounted Kubernetes secret.
+	envFileSuffix = "_FILE"
+
+	// redacted replaces the value of secret flags when printing the configuration.
+	redacted = "[redacted]"
+)
+
+var (
+	// envAliases lists additional environment variables accepted for a flag.
+	envAliases = map[string][]string{
+		"cache": {"DSS_CACHE_LIFETIME"},
+	}
+
+	// secretFlags are never printed, and may be read from a file via their
+	// environment variable's _FILE suffix.
+	secretFlags = map[string]struct{}{
+		"inboundPass":  {},
+		"inboundUser":  {},
+		"outboundPass": {},
+		"outboundUser": {},
+
+		// webhook URLs often embed a token
+		"scheduleWebhook": {},
+	}
+)
+
 var (
 	cmdConfig = &cobra.Command{
 		Use:   "config",
@@ -58,6 +94,17 @@ var (
 		},
 	}
 
+	cmdConfigValidate = &cobra.Command{
+		Use:     "validate",
+		Short:   "Validate the config file and print the effective configuration",
+		Long:    "Validate the config file and print the effective configuration.\nValues are taken from flags first, then environment variables, then the config file, and finally the defaults.",
+		Example: "  dss config validate --config dss.yaml",
+		Args:    cobra.ExactArgs(0),
+		Run: func(command *cobra.Command, args []string) {
+			printToConsole(effectiveConfig(cmd))
+		},
+	}
+
 	cmdConfigShow = &cobra.Command{
 		Use:     "show",
 		Short:   "Print full config",
@@ -122,3 +169,206 @@ func (c *Config) Save() error {
 
 	return os.WriteFile(c.path, configData, os.ModePerm)
 }
+
+// applyConfig fills every flag of the given command that wasn't explicitly set
+// on the command line, first from its environment variable and then from the
+// config file's values. Config file keys must match a flag of some command
+// within root, otherwise an error is returned.
+func applyConfig(root, command *cobra.Command, fileValues map[string]string, lookupEnv func(string) (string, bool)) error {
+	knownFlags := make(map[string]struct{})
+	collectFlags(root, knownFlags)
+
+	for key := range fileValues {
+		if _, ok := knownFlags[key]; !ok {
+			return fmt.Errorf("unknown config key: %s", key)
+		}
+	}
+
+	var err error
+
+	command.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || flag.Name == "config" || flag.Name == "help" {
+			return
+		}
+
+		value, source, ok, envErr := envValue(flag.Name, lookupEnv)
+		if envErr != nil {
+			err = envErr
+			return
+		}
+
+		if !ok {
+			value, ok = fileValues[flag.Name]
+			source = "config key " + flag.Name
+		}
+
+		if !ok {
+			return
+		}
+
+		// lists are comma separated, and commonly written with a space after each comma
+		if _, isSlice := flag.Value.(pflag.SliceValue); isSlice {
+			items := strings.Split(value, ",")
+			for index := range items {
+				items[index] = strings.TrimSpace(items[index])
+			}
+
+			value = strings.Join(items, ",")
+		}
+
+		if setErr := command.Flags().Set(flag.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %w", source, setErr)
+		}
+	})
+
+	return err
+}
+
+// collectFlags adds the names of every flag within the command tree to flags.
+func collectFlags(command *cobra.Command, flags map[string]struct{}) {
+	for _, flagSet := range []*pflag.FlagSet{command.PersistentFlags(), command.Flags()} {
+		flagSet.VisitAll(func(flag *pflag.Flag) {
+			flags[flag.Name] = struct{}{}
+		})
+	}
+
+	for _, child := range command.Commands() {
+		collectFlags(child, flags)
+	}
+}
+
+// configFilePath returns the config file to load, and whether it must exist.
+// An explicit path (via --config) must exist, while the default path
+// ($XDG_CONFIG_HOME/dss/config.yaml) is optional.
+func configFilePath(explicitPath string) (string, bool) {
+	if explicitPath != "" {
+		return explicitPath, true
+	}
+
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		var err error
+		if configDir, err = os.UserConfigDir(); err != nil {
+			return "", false
+		}
+	}
+
+	return filepath.Join(configDir, "dss", "config.yaml"), false
+}
+
+// effectiveConfig returns the value of every flag available to the command,
+// with secrets redacted.
+func effectiveConfig(command *cobra.Command) map[string]string {
+	values := make(map[string]string)
+
+	command.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "help" {
+			return
+		}
+
+		values[flag.Name] = flagString(flag)
+		if _, secret := secretFlags[flag.Name]; secret && values[flag.Name] != "" {
+			values[flag.Name] = redacted
+		}
+	})
+
+	return values
+}
+
+// envValue looks up the environment variables for a flag. Secret flags may
+// instead name a file containing their value via the _FILE suffix, but setting
+// both is an error.
+func envValue(flagName string, lookupEnv func(string) (string, bool)) (value, source string, ok bool, err error) {
+	for _, name := range append([]string{envName(flagName)}, envAliases[flagName]...) {
+		if value, ok = lookupEnv(name); ok {
+			source = "environment variable " + name
+			break
+		}
+	}
+
+	if _, secret := secretFlags[flagName]; !secret {
+		return value, source, ok, nil
+	}
+
+	fileName := envName(flagName) + envFileSuffix
+
+	path, fileOk := lookupEnv(fileName)
+	if !fileOk {
+		return value, source, ok, nil
+	}
+
+	if ok {
+		return "", "", false, fmt.Errorf("only one of %s and %s may be set", envName(flagName), fileName)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false, fmt.Errorf("unable to read %s: %w", fileName, err)
+	}
+
+	// secret files commonly end with a newline, which is never part of the secret
+	return strings.TrimRight(string(data), "\r\n"), "environment variable " + fileName, true, nil
+}
+
+// envName returns the environment variable for a flag, such as DSS_CHECK_TLS
+// for checkTLS.
+func envName(flagName string) string {
+	var builder strings.Builder
+	builder.WriteString(envPrefix)
+
+	for index, char := range flagName {
+		if index > 0 && unicode.IsUpper(char) {
+			previous := rune(flagName[index-1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) {
+				builder.WriteRune('_')
+			}
+		}
+
+		builder.WriteRune(unicode.ToUpper(char))
+	}
+
+	return builder.String()
+}
+
+// flagString returns a flag's value in the same format it's accepted in.
+func flagString(flag *pflag.Flag) string {
+	if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+		return strings.Join(sliceValue.GetSlice(), ",")
+	}
+
+	return flag.Value.String()
+}
+
+// loadConfigFile reads a YAML config file whose keys mirror the flag names.
+// Lists are converted to comma-separated values, matching the flags.
+func loadConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err = yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+
+	for key, value := range raw {
+		switch typed := value.(type) {
+		case []any:
+			items := make([]string, 0, len(typed))
+			for _, item := range typed {
+				items = append(items, cast.ToString(item))
+			}
+
+			values[key] = strings.Join(items, ",")
+		case map[string]any:
+			return nil, fmt.Errorf("config key %s must be a value or list, not a map", key)
+		default:
+			values[key] = cast.ToString(typed)
+		}
+	}
+
+	return values, nil
+}
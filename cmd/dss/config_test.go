@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCommand(t *testing.T) (*cobra.Command, *cobra.Command, *time.Duration, *[]string) {
+	t.Helper()
+
+	var (
+		timeout     time.Duration
+		nameservers []string
+		concurrent  uint16
+	)
+
+	root := &cobra.Command{Use: "dss"}
+	root.PersistentFlags().DurationVar(&timeout, "timeout", 15*time.Second, "")
+	root.PersistentFlags().StringSliceVar(&nameservers, "nameservers", nil, "")
+
+	child := &cobra.Command{Use: "scan", Run: func(*cobra.Command, []string) {}}
+	child.Flags().Uint16Var(&concurrent, "concurrent", 1, "")
+	root.AddCommand(child)
+
+	// merge the persistent flags into the child's flag set, as cobra does on execution
+	require.NoError(t, child.ParseFlags(nil))
+
+	return root, child, &timeout, &nameservers
+}
+
+func TestApplyConfig(t *testing.T) {
+	fileValues := map[string]string{"timeout": "5s", "nameservers": "1.1.1.1,8.8.8.8"}
+
+	tests := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		file        map[string]string
+		timeout     time.Duration
+		nameservers []string
+	}{
+		{name: "Defaults", timeout: 15 * time.Second},
+		{name: "File", file: fileValues, timeout: 5 * time.Second, nameservers: []string{"1.1.1.1", "8.8.8.8"}},
+		{name: "EnvOverFile", env: map[string]string{"DSS_TIMEOUT": "10s"}, file: fileValues, timeout: 10 * time.Second, nameservers: []string{"1.1.1.1", "8.8.8.8"}},
+		{name: "FlagOverEnv", args: []string{"--timeout", "20s"}, env: map[string]string{"DSS_TIMEOUT": "10s"}, file: fileValues, timeout: 20 * time.Second, nameservers: []string{"1.1.1.1", "8.8.8.8"}},
+		{name: "FlagOverFile", args: []string{"--nameservers", "9.9.9.9"}, file: fileValues, timeout: 5 * time.Second, nameservers: []string{"9.9.9.9"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, child, timeout, nameservers := newTestCommand(t)
+			require.NoError(t, child.ParseFlags(test.args))
+
+			lookupEnv := func(key string) (string, bool) {
+				value, ok := test.env[key]
+				return value, ok
+			}
+
+			require.NoError(t, applyConfig(root, child, test.file, lookupEnv))
+			require.Equal(t, test.timeout, *timeout)
+			require.Equal(t, test.nameservers, *nameservers)
+		})
+	}
+
+	t.Run("UnknownKey", func(t *testing.T) {
+		root, child, _, _ := newTestCommand(t)
+		require.EqualError(t, applyConfig(root, child, map[string]string{"timout": "5s"}, os.LookupEnv), "unknown config key: timout")
+	})
+
+	t.Run("OtherCommandKey", func(t *testing.T) {
+		// keys belonging to another subcommand are valid, but don't apply here
+		root, _, timeout, _ := newTestCommand(t)
+		require.NoError(t, applyConfig(root, root, map[string]string{"concurrent": "4"}, os.LookupEnv))
+		require.Equal(t, 15*time.Second, *timeout)
+	})
+
+	t.Run("InvalidValue", func(t *testing.T) {
+		root, child, _, _ := newTestCommand(t)
+		lookupEnv := func(string) (string, bool) { return "soon", true }
+		require.ErrorContains(t, applyConfig(root, child, nil, lookupEnv), "invalid value for environment variable DSS_")
+	})
+}
+
+func TestEnvName(t *testing.T) {
+	require.Equal(t, "DSS_CHECK_TLS", envName("checkTLS"))
+	require.Equal(t, "DSS_DNS_BUFFER", envName("dnsBuffer"))
+	require.Equal(t, "DSS_TIMEOUT", envName("timeout"))
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("timeout: 5s\nconcurrent: 4\nnameservers:\n  - 1.1.1.1\n  - 8.8.8.8\n"), 0o600))
+
+	values, err := loadConfigFile(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"timeout": "5s", "concurrent": "4", "nameservers": "1.1.1.1,8.8.8.8"}, values)
+
+	require.NoError(t, os.WriteFile(path, []byte("scan:\n  timeout: 5s\n"), 0o600))
+
+	_, err = loadConfigFile(path)
+	require.ErrorContains(t, err, "must be a value or list")
+}
+
+func TestEnvValue(t *testing.T) {
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secretPath, []byte("hunter2\n"), 0o600))
+
+	tests := []struct {
+		name   string
+		flag   string
+		env    map[string]string
+		value  string
+		source string
+		ok     bool
+		err    string
+	}{
+		{name: "Unset", flag: "timeout"},
+		{name: "Plain", flag: "timeout", env: map[string]string{"DSS_TIMEOUT": "5s"}, value: "5s", source: "environment variable DSS_TIMEOUT", ok: true},
+		{name: "Alias", flag: "cache", env: map[string]string{"DSS_CACHE_LIFETIME": "1m"}, value: "1m", source: "environment variable DSS_CACHE_LIFETIME", ok: true},
+		{name: "NameOverAlias", flag: "cache", env: map[string]string{"DSS_CACHE": "2m", "DSS_CACHE_LIFETIME": "1m"}, value: "2m", source: "environment variable DSS_CACHE", ok: true},
+		{name: "SecretFile", flag: "inboundPass", env: map[string]string{"DSS_INBOUND_PASS_FILE": secretPath}, value: "hunter2", source: "environment variable DSS_INBOUND_PASS_FILE", ok: true},
+		{name: "FileIgnoredForNonSecrets", flag: "timeout", env: map[string]string{"DSS_TIMEOUT_FILE": secretPath}},
+		{name: "SecretAndFile", flag: "inboundPass", env: map[string]string{"DSS_INBOUND_PASS": "a", "DSS_INBOUND_PASS_FILE": secretPath}, err: "only one of DSS_INBOUND_PASS and DSS_INBOUND_PASS_FILE may be set"},
+		{name: "MissingFile", flag: "outboundPass", env: map[string]string{"DSS_OUTBOUND_PASS_FILE": secretPath + ".missing"}, err: "unable to read DSS_OUTBOUND_PASS_FILE"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, source, ok, err := envValue(test.flag, func(key string) (string, bool) {
+				value, ok := test.env[key]
+				return value, ok
+			})
+
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.value, value)
+			require.Equal(t, test.source, source)
+			require.Equal(t, test.ok, ok)
+		})
+	}
+}
+
+func TestApplyConfig_EnvLists(t *testing.T) {
+	lookupEnv := func(key string) (string, bool) {
+		if key == "DSS_NAMESERVERS" {
+			return "1.1.1.1, 8.8.8.8", true
+		}
+
+		return "", false
+	}
+
+	t.Run("Env", func(t *testing.T) {
+		root, child, _, nameservers := newTestCommand(t)
+		require.NoError(t, applyConfig(root, child, nil, lookupEnv))
+		require.Equal(t, []string{"1.1.1.1", "8.8.8.8"}, *nameservers)
+	})
+
+	t.Run("FlagOverEnv", func(t *testing.T) {
+		root, child, _, nameservers := newTestCommand(t)
+		require.NoError(t, child.ParseFlags([]string{"--nameservers", "9.9.9.9"}))
+		require.NoError(t, applyConfig(root, child, nil, lookupEnv))
+		require.Equal(t, []string{"9.9.9.9"}, *nameservers)
+	})
+}
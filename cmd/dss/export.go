@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/checkpoint"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/export"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/goccy/go-json"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.AddCommand(cmdExport)
+}
+
+var cmdExport = &cobra.Command{
+	Use:     "export [flags] <checkpoint>",
+	Example: "  dss export state.ndjson > results.ndjson\n  dss export state.ndjson --format csv --outputFile results",
+	Short:   "Export the results recorded by a checkpoint.",
+	Long:    "Export the latest result of each domain recorded by a bulk scan's --checkpoint, as NDJSON, or as CSV with --format csv.\nResults are read and written one at a time, so checkpoints of any size can be exported.\nThe results are printed to STDOUT, unless --outputFile is set.",
+	Args:    cobra.ExactArgs(1),
+	Run: func(command *cobra.Command, args []string) {
+		exportFormat := export.FormatNDJSON
+		if format == "csv" {
+			exportFormat = export.FormatCSV
+		}
+
+		output := io.Writer(os.Stdout)
+		filename := outputFile + "." + exportFormat
+
+		if outputFile != "" {
+			file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to open output file")
+			}
+			defer file.Close()
+
+			output = file
+		}
+
+		exported, err := exportCheckpoint(args[0], output, exportFormat)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to export results.")
+		}
+
+		if outputFile != "" {
+			log.Info().Msgf("Exported %d results to %s", exported, filename)
+		}
+	},
+}
+
+// exportCheckpoint writes the latest result of each domain in the checkpoint
+// at path to the output, in the format, returning how many were written.
+func exportCheckpoint(path string, output io.Writer, format string) (int, error) {
+	writer, err := export.NewWriter(output, format, export.WithHeader(model.CSVHeader()))
+	if err != nil {
+		return 0, err
+	}
+
+	exported := 0
+
+	err = checkpoint.Read(path, func(entry checkpoint.Entry) error {
+		// NDJSON is written as it was recorded, while CSV rows need the result's fields
+		var result any = entry.Result
+
+		if format == export.FormatCSV {
+			var scan model.ScanResult
+			if err := json.Unmarshal(entry.Result, &scan); err != nil {
+				return fmt.Errorf("failed to parse the result of %s: %w", entry.Domain, err)
+			}
+
+			if scan.ScanResult == nil {
+				return fmt.Errorf("the result of %s has no scan result to export as CSV, as it may have been recorded with --fields", entry.Domain)
+			}
+
+			result = &scan
+		}
+
+		if err := writer.Write(result); err != nil {
+			return err
+		}
+
+		exported++
+
+		return nil
+	})
+	if err != nil {
+		_ = writer.Close()
+		return exported, err
+	}
+
+	return exported, writer.Close()
+}
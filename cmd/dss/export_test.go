@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/export"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.ndjson")
+
+	// example.com failed, then was rescanned
+	data := `{"domain":"example.com","failed":true,"result":{"domain":"example.com","scanResult":{"domain":"example.com","error":"timeout"}}}
+{"domain":"example.org","result":{"domain":"example.org","scanResult":{"domain":"example.org","spf":"v=spf1 -all"},"advice":{"spf":["SPF seems to be setup correctly! No further action needed."]}}}
+{"domain":"example.com","result":{"domain":"example.com","scanResult":{"domain":"example.com","dmarc":"v=DMARC1; p=reject"}}}
+`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	t.Run("NDJSON", func(t *testing.T) {
+		var output bytes.Buffer
+
+		exported, err := exportCheckpoint(path, &output, export.FormatNDJSON)
+		require.NoError(t, err)
+		require.Equal(t, 2, exported)
+
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		require.Len(t, lines, 2)
+		require.Contains(t, lines[0], `"domain":"example.org"`)
+		require.Contains(t, lines[1], `"dmarc":"v=DMARC1; p=reject"`)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var output bytes.Buffer
+
+		exported, err := exportCheckpoint(path, &output, export.FormatCSV)
+		require.NoError(t, err)
+		require.Equal(t, 2, exported)
+
+		rows, err := csv.NewReader(&output).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 3)
+		require.Equal(t, model.CSVHeader(), rows[0])
+		require.Equal(t, []string{"example.org", "v=spf1 -all", "SPF: SPF seems to be setup correctly! No further action needed.; "}, []string{rows[1][0], rows[1][5], rows[1][7]})
+		require.Equal(t, []string{"example.com", "v=DMARC1; p=reject", ""}, []string{rows[2][0], rows[2][3], rows[2][6]})
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.ndjson")
+		require.NoError(t, os.WriteFile(path, []byte(`{"domain":"example.com","result":{"spf":"v=spf1 -all"}}`+"\n"), 0o644))
+
+		_, err := exportCheckpoint(path, &bytes.Buffer{}, export.FormatCSV)
+		require.ErrorContains(t, err, "may have been recorded with --fields")
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/generate"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.AddCommand(cmdGenerate)
+
+	cmdGenerate.Flags().StringVar(&generateOptions.DMARCPolicy, "dmarcPolicy", "none", "DMARC policy stage to publish (none, quarantine or reject)")
+	cmdGenerate.Flags().StringVar(&generateOptions.MTASTSMode, "mtaStsMode", "testing", "MTA-STS policy mode (testing or enforce)")
+	cmdGenerate.Flags().StringVar(&generateProvider, "provider", "zonefile", "Output format ("+strings.Join(generate.Providers(), ", ")+")")
+	cmdGenerate.Flags().StringVar(&generateOptions.ReportMailbox, "reportMailbox", "", "Mailbox to receive DMARC and TLS reports (defaults to dmarc@<domain>)")
+}
+
+var (
+	generateOptions  generate.Options
+	generateProvider string
+)
+
+var cmdGenerate = &cobra.Command{
+	Use:     "generate [flags] <domain>",
+	Example: "  dss generate globalcyberalliance.org\n  dss generate --provider terraform-route53 --dmarcPolicy quarantine --reportMailbox dmarc@example.com example.com",
+	Short:   "Generate the DNS records to publish for a domain.",
+	Long:    "Scan a domain, then generate ready-to-apply DMARC, SPF, MTA-STS and TLS-RPT records in the chosen format.\nDKIM keys are never generated, as only your mail provider can issue them, so a commented out placeholder is included instead.",
+	Args:    cobra.ExactArgs(1),
+	Run: func(command *cobra.Command, args []string) {
+		if !slices.Contains(generate.Providers(), generateProvider) {
+			log.Fatal().Msg("Unsupported provider, it must be one of: " + strings.Join(generate.Providers(), ", "))
+		}
+
+		if err := scanner.ValidateDomain(args[0]); err != nil {
+			log.Fatal().Err(err).Msg("Invalid domain.")
+		}
+
+		opts := scannerOptions()
+
+		auditLog, auditScannerOpts, _ := openAuditLog()
+		if auditLog != nil {
+			defer auditLog.Close()
+		}
+
+		sc, err := scanner.New(log, timeout, append(opts, auditScannerOpts...)...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("An unexpected error occurred.")
+		}
+		defer sc.Close()
+
+		results, err := sc.Scan(args[0])
+		if err != nil {
+			log.Fatal().Err(err).Msg("An unexpected error occurred.")
+		}
+
+		if results[0].Error != "" {
+			log.Fatal().Str("domain", results[0].Domain).Msg(results[0].Error)
+		}
+
+		records, err := generate.Generate(results[0], generateOptions)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to generate records.")
+		}
+
+		if err = generate.Render(os.Stdout, generateProvider, records); err != nil {
+			log.Fatal().Err(err).Msg("Unable to render records.")
+		}
+	},
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+const (
+	// explorerListWidth is the width of the explorer's left pane, which lists the checks.
+	explorerListWidth = 18
+
+	// explorerHelp is the explorer's header, listing its keybindings.
+	explorerHelp = "↑/↓ select  PgUp/PgDn scroll  r re-run  c copy record  q quit"
+)
+
+const (
+	explorerPass explorerStatus = iota
+	explorerWarn
+	explorerFail
+)
+
+const (
+	explorerNone explorerAction = iota
+	explorerQuit
+	explorerRerun
+)
+
+type (
+	// explorerStatus is the outcome of a check in the explorer, from the most
+	// severe of its findings.
+	explorerStatus int
+
+	// explorerAction is what the explorer's loop must do after a keypress.
+	explorerAction int
+
+	// explorerCheck is a check listed in the explorer, with the record it
+	// checked.
+	explorerCheck struct {
+		name     string
+		status   explorerStatus
+		record   string
+		parsed   []string
+		findings []advisor.Finding
+	}
+
+	// explorer is the view model of dss scan --interactive, which lists a
+	// domain's checks in its left pane, and shows the selected check's
+	// findings, raw record and parsed fields in its right pane. It's driven by
+	// handleKey and drawn with render, so the terminal only has to pass it
+	// keys and print its lines.
+	explorer struct {
+		domain   string
+		checks   []explorerCheck
+		selected int
+		scroll   int
+		message  string
+
+		// rerun scans the domain again, without any cached results.
+		rerun func(domain string) (*scanner.Result, *advisor.Advice, error)
+
+		// copier copies the text to the clipboard.
+		copier func(text string) error
+	}
+)
+
+// newExplorer returns an explorer of the domain's scan result and advice.
+func newExplorer(result *scanner.Result, advice *advisor.Advice, rerun func(string) (*scanner.Result, *advisor.Advice, error), copier func(string) error) *explorer {
+	return &explorer{domain: result.Domain, checks: explorerChecks(result, advice), rerun: rerun, copier: copier}
+}
+
+// explorerChecks returns the checks of the scan result with advice, in the
+// order of the advice's findings.
+func explorerChecks(result *scanner.Result, advice *advisor.Advice) []explorerCheck {
+	if advice == nil {
+		return nil
+	}
+
+	var checks []explorerCheck
+	indexes := make(map[string]int)
+
+	parsed := model.ParseRecords(result)
+	if parsed == nil {
+		parsed = &model.ParsedRecords{}
+	}
+
+	for _, finding := range advice.Findings() {
+		index, ok := indexes[finding.Check]
+		if !ok {
+			index = len(checks)
+			indexes[finding.Check] = index
+
+			record, fields := checkRecord(result, parsed, finding.Check)
+			checks = append(checks, explorerCheck{name: finding.Check, record: record, parsed: fields})
+		}
+
+		check := &checks[index]
+		check.findings = append(check.findings, finding)
+
+		switch {
+		case finding.Severity >= advisor.SeverityHigh:
+			check.status = explorerFail
+		case finding.Severity >= advisor.SeverityLow && check.status < explorerWarn:
+			check.status = explorerWarn
+		}
+	}
+
+	return checks
+}
+
+// checkRecord returns the raw record the check advised on, and its parsed
+// fields, if it has any.
+func checkRecord(result *scanner.Result, parsed *model.ParsedRecords, check string) (string, []string) {
+	switch check {
+	case "arc":
+		return result.ARC, nil
+	case "bimi":
+		return result.BIMI, sortedTags(parsed.BIMI)
+	case "dkim":
+		if len(result.DKIMKeys) > 1 {
+			records := make([]string, 0, len(result.DKIMKeys))
+			for _, key := range result.DKIMKeys {
+				records = append(records, key.Record)
+			}
+
+			return strings.Join(records, "\n"), sortedTags(parsed.DKIM)
+		}
+
+		return result.DKIM, sortedTags(parsed.DKIM)
+	case "dmarc":
+		return result.DMARC, sortedTags(parsed.DMARC)
+	case "mtasts":
+		return strings.Join(result.MTASTS, "\n"), nil
+	case "mx":
+		return strings.Join(result.MX, "\n"), nil
+	case "spf":
+		return result.SPF, parsed.SPF
+	case "txt":
+		return strings.Join(result.TXT, "\n"), nil
+	}
+
+	return "", nil
+}
+
+// sortedTags returns the tags as name=value pairs, sorted by name.
+func sortedTags(tags map[string]string) []string {
+	fields := make([]string, 0, len(tags))
+	for name, value := range tags {
+		fields = append(fields, name+"="+value)
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
+
+// handleKey applies a keypress, as read from a terminal in raw mode, and
+// returns what the explorer's loop must do next.
+func (e *explorer) handleKey(key string) explorerAction {
+	e.message = ""
+
+	switch key {
+	case "q", "\x03", "\x1b":
+		return explorerQuit
+	case "k", "\x1b[A", "\x1bOA":
+		e.selectCheck(e.selected - 1)
+	case "j", "\x1b[B", "\x1bOB":
+		e.selectCheck(e.selected + 1)
+	case " ", "\x1b[6~":
+		e.scroll += 10
+	case "b", "\x1b[5~":
+		e.scroll = max(e.scroll-10, 0)
+	case "r":
+		if len(e.checks) == 0 {
+			return explorerNone
+		}
+
+		e.message = "Re-running the " + e.checks[e.selected].name + " check..."
+
+		return explorerRerun
+	case "c":
+		e.copyRecord()
+	}
+
+	return explorerNone
+}
+
+// selectCheck selects the check at the index, if there is one.
+func (e *explorer) selectCheck(index int) {
+	if index < 0 || index >= len(e.checks) {
+		return
+	}
+
+	e.selected, e.scroll = index, 0
+}
+
+// copyRecord copies the selected check's raw record to the clipboard.
+func (e *explorer) copyRecord() {
+	if len(e.checks) == 0 {
+		return
+	}
+
+	check := e.checks[e.selected]
+	if check.record == "" {
+		e.message = "The " + check.name + " check has no record to copy."
+		return
+	}
+
+	if err := e.copier(check.record); err != nil {
+		e.message = "The record couldn't be copied: " + err.Error()
+		return
+	}
+
+	e.message = "Copied the " + check.name + " record to the clipboard."
+}
+
+// rerunSelected scans the domain again, replacing the selected check with its
+// new outcome. The other checks keep their previous outcome, so they can be
+// compared with it.
+func (e *explorer) rerunSelected() {
+	if len(e.checks) == 0 {
+		return
+	}
+
+	name := e.checks[e.selected].name
+	start := time.Now()
+
+	result, advice, err := e.rerun(e.domain)
+	if err != nil {
+		e.message = "The " + name + " check couldn't be re-run: " + err.Error()
+		return
+	}
+
+	// a check without advice any more has nothing left to report
+	rerun := explorerCheck{name: name}
+	for _, check := range explorerChecks(result, advice) {
+		if check.name == name {
+			rerun = check
+			break
+		}
+	}
+
+	e.checks[e.selected], e.scroll = rerun, 0
+	e.message = fmt.Sprintf("Re-ran the %s check in %s.", name, time.Since(start).Round(time.Millisecond))
+}
+
+// render returns the explorer's lines for a terminal of the given size: the
+// header, the panes, and the status line.
+func (e *explorer) render(width, height int) []string {
+	width, height = max(width, explorerListWidth+20), max(height, 4)
+	detailWidth := width - explorerListWidth - 3
+
+	lines := []string{truncate("dss: "+e.domain+"  "+explorerHelp, width)}
+
+	details := e.details(detailWidth)
+	e.scroll = min(e.scroll, max(len(details)-(height-2), 0))
+	details = details[e.scroll:]
+
+	for row := 0; row < height-2; row++ {
+		entry := strings.Repeat(" ", explorerListWidth)
+		if row < len(e.checks) {
+			entry = pad(" "+statusIcon(e.checks[row].status)+" "+e.checks[row].name, explorerListWidth)
+			if row == e.selected {
+				entry = "\x1b[7m" + entry + "\x1b[0m"
+			}
+		}
+
+		var detail string
+		if row < len(details) {
+			detail = details[row]
+		}
+
+		lines = append(lines, entry+" │ "+detail)
+	}
+
+	return append(lines, truncate(e.message, width))
+}
+
+// details returns the selected check's lines for the right pane, wrapped to
+// the width.
+func (e *explorer) details(width int) []string {
+	if len(e.checks) == 0 {
+		return []string{"There's no advice for this domain."}
+	}
+
+	check := e.checks[e.selected]
+	lines := []string{strings.ToUpper(check.name)}
+
+	lines = append(lines, "", "Findings")
+	if len(check.findings) == 0 {
+		lines = append(lines, "  None.")
+	}
+
+	for _, finding := range check.findings {
+		lines = append(lines, wrap("["+finding.Severity.String()+"] "+finding.Message, width, "  ")...)
+
+		if finding.Remediation != "" {
+			lines = append(lines, wrap("Fix: "+finding.Remediation, width, "    ")...)
+		}
+
+		if finding.Reference != "" {
+			lines = append(lines, wrap("See: "+finding.Reference, width, "    ")...)
+		}
+	}
+
+	if check.record != "" {
+		lines = append(lines, "", "Record")
+		for _, record := range strings.Split(check.record, "\n") {
+			lines = append(lines, wrap(record, width, "  ")...)
+		}
+	}
+
+	if len(check.parsed) > 0 {
+		lines = append(lines, "", "Parsed")
+		for _, field := range check.parsed {
+			lines = append(lines, wrap(field, width, "  ")...)
+		}
+	}
+
+	return lines
+}
+
+// statusIcon returns the icon of a check's status.
+func statusIcon(status explorerStatus) string {
+	switch status {
+	case explorerFail:
+		return "✘"
+	case explorerWarn:
+		return "!"
+	default:
+		return "✔"
+	}
+}
+
+// wrap splits the text into lines of at most width characters, each
+// indented by the indent, breaking at spaces where it can.
+func wrap(text string, width int, indent string) []string {
+	width = max(width-len(indent), 10)
+
+	var lines []string
+	line := []rune(text)
+
+	for len(line) > width {
+		index := width
+		for i := width; i > width/2; i-- {
+			if line[i] == ' ' {
+				index = i
+				break
+			}
+		}
+
+		lines = append(lines, indent+string(line[:index]))
+		line = []rune(strings.TrimLeft(string(line[index:]), " "))
+	}
+
+	return append(lines, indent+string(line))
+}
+
+// truncate cuts the text to at most width characters.
+func truncate(text string, width int) string {
+	if runes := []rune(text); len(runes) > width {
+		return string(runes[:width])
+	}
+
+	return text
+}
+
+// pad truncates or pads the text with spaces to exactly width characters.
+func pad(text string, width int) string {
+	text = truncate(text, width)
+	return text + strings.Repeat(" ", width-len([]rune(text)))
+}
+
+// exploreDomain scans the domain and explores its result in the terminal,
+// falling back to printing it if the terminal can't be put into raw mode.
+// The result is always advised, as the explorer lists its checks' findings.
+func exploreDomain(sc *scanner.Scanner, domainAdvisor *advisor.Advisor, domain string) {
+	scan := func(domain string) (*scanner.Result, *advisor.Advice, error) {
+		results, err := sc.Scan(domain)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return results[0], model.Advise(context.Background(), domainAdvisor, results[0], assumeParked), nil
+	}
+
+	result, advice, err := scan(domain)
+	if err != nil {
+		log.Fatal().Err(err).Msg("An unexpected error occurred.")
+	}
+
+	// re-runs look the domain up afresh, rather than from the caches
+	rerun := func(domain string) (*scanner.Result, *advisor.Advice, error) {
+		sc.InvalidateDomain(domain)
+		domainAdvisor.InvalidateDomain(domain)
+
+		return scan(domain)
+	}
+
+	if err = runExplorer(newExplorer(result, advice, rerun, terminalClipboard(os.Stdout)), os.Stdin, os.Stdout); err != nil {
+		log.Warn().Err(err).Msg("The terminal couldn't be used interactively, so the result is printed instead.")
+		printResult(result, domainAdvisor)
+	}
+}
+
+// runExplorer runs the explorer in the terminal until it's quit, drawing it
+// on the alternate screen, so the terminal's contents are restored after.
+func runExplorer(e *explorer, in, out *os.File) error {
+	restore, err := makeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	writer := bufio.NewWriter(out)
+
+	// switch to the alternate screen and hide the cursor, restoring both on the way out
+	_, _ = writer.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		_, _ = writer.WriteString("\x1b[?25h\x1b[?1049l")
+		_ = writer.Flush()
+	}()
+
+	keys := make(chan string)
+	go readKeys(in, keys)
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+
+	for {
+		drawExplorer(writer, e, out)
+
+		select {
+		case <-resized:
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+
+			switch e.handleKey(key) {
+			case explorerQuit:
+				return nil
+			case explorerRerun:
+				drawExplorer(writer, e, out)
+				e.rerunSelected()
+			}
+		}
+	}
+}
+
+// readKeys sends each keypress read from the terminal to the channel, closing
+// it once the terminal can't be read from any more. An escape sequence (such
+// as an arrow key's) is read as a single keypress.
+func readKeys(in io.Reader, keys chan<- string) {
+	defer close(keys)
+
+	buffer := make([]byte, 32)
+
+	for {
+		n, err := in.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		keys <- string(buffer[:n])
+	}
+}
+
+// drawExplorer draws the explorer over the whole terminal.
+func drawExplorer(writer *bufio.Writer, e *explorer, out *os.File) {
+	width, height, err := terminalSize(out)
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	_, _ = writer.WriteString("\x1b[H")
+
+	for index, line := range e.render(width, height) {
+		if index > 0 {
+			_, _ = writer.WriteString("\r\n")
+		}
+
+		_, _ = writer.WriteString(line + "\x1b[K")
+	}
+
+	_, _ = writer.WriteString("\x1b[J")
+	_ = writer.Flush()
+}
+
+// terminalClipboard returns a function that copies text to the clipboard of
+// the terminal writing to out, with the OSC 52 escape sequence, which works
+// over SSH. Terminals that don't support it ignore it.
+func terminalClipboard(out io.Writer) func(string) error {
+	return func(text string) error {
+		_, err := fmt.Fprintf(out, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+		return err
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplorer(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false)
+	defer domainAdvisor.Close()
+
+	result := &scanner.Result{Domain: "example.com", DMARC: "v=DMARC1; p=none; rua=mailto:dmarc@example.com", SPF: "v=spf1 include:_spf.example.net -all"}
+	advice := &advisor.Advice{
+		DMARC: domainAdvisor.CheckDMARC(result.DMARC),
+		SPF:   domainAdvisor.CheckSPF(result.SPF),
+		BIMI:  domainAdvisor.CheckBIMI(""),
+		DKIM:  domainAdvisor.CheckDKIM(""),
+	}
+
+	var copied []string
+	var reruns int
+
+	rerun := func(domain string) (*scanner.Result, *advisor.Advice, error) {
+		reruns++
+		if domain != "example.com" {
+			return nil, nil, errors.New("unexpected domain")
+		}
+
+		// the DMARC record has since been fixed, and the SPF record broken
+		fixed := *result
+		fixed.DMARC, fixed.SPF = "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", "v=spf1 +all"
+
+		return &fixed, &advisor.Advice{DMARC: domainAdvisor.CheckDMARC(fixed.DMARC), SPF: domainAdvisor.CheckSPF(fixed.SPF)}, nil
+	}
+
+	e := newExplorer(result, advice, rerun, func(text string) error {
+		copied = append(copied, text)
+		return nil
+	})
+
+	t.Run("Checks", func(t *testing.T) {
+		var names []string
+		for _, check := range e.checks {
+			names = append(names, check.name)
+		}
+
+		require.Equal(t, []string{"bimi", "dkim", "dmarc", "spf"}, names)
+		require.Equal(t, explorerWarn, e.checks[1].status)
+		require.Equal(t, explorerWarn, e.checks[2].status)
+		require.Equal(t, explorerPass, e.checks[3].status)
+		require.Equal(t, result.DMARC, e.checks[2].record)
+		require.Equal(t, []string{"p=none", "rua=mailto:dmarc@example.com", "v=DMARC1"}, e.checks[2].parsed)
+		require.Equal(t, []string{"include:_spf.example.net", "-all"}, e.checks[3].parsed)
+	})
+
+	t.Run("Navigation", func(t *testing.T) {
+		require.Equal(t, explorerNone, e.handleKey("\x1b[A"))
+		require.Equal(t, 0, e.selected, "the selection mustn't move past the first check")
+
+		for range 5 {
+			e.handleKey("j")
+		}
+		require.Equal(t, 3, e.selected, "the selection mustn't move past the last check")
+
+		e.handleKey("\x1b[6~")
+		require.Equal(t, 10, e.scroll)
+
+		// selecting another check scrolls back to the top of its details
+		e.handleKey("k")
+		require.Equal(t, 2, e.selected)
+		require.Zero(t, e.scroll)
+
+		require.Equal(t, explorerQuit, e.handleKey("q"))
+	})
+
+	t.Run("Render", func(t *testing.T) {
+		lines := e.render(100, 30)
+		require.Len(t, lines, 30)
+		require.True(t, strings.HasPrefix(lines[0], "dss: example.com"))
+		require.Contains(t, lines[3], "\x1b[7m ! dmarc")
+		require.Contains(t, lines[4], " ✔ spf")
+
+		screen := strings.Join(lines, "\n")
+		require.Contains(t, screen, "[medium] You are currently at the lowest level")
+		require.Contains(t, screen, "  v=DMARC1; p=none; rua=mailto:dmarc@example.com")
+		require.Contains(t, screen, "  rua=mailto:dmarc@example.com")
+
+		for _, line := range lines {
+			require.LessOrEqual(t, len([]rune(strings.NewReplacer("\x1b[7m", "", "\x1b[0m", "").Replace(line))), 100, line)
+		}
+
+		// the scroll is clamped to the details that would scroll off the screen
+		e.scroll = 1000
+		e.render(100, 30)
+		require.Zero(t, e.scroll)
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		e.handleKey("c")
+		require.Equal(t, []string{result.DMARC}, copied)
+		require.Equal(t, "Copied the dmarc record to the clipboard.", e.message)
+
+		// BIMI has no record to copy
+		e.selected = 0
+		e.handleKey("c")
+		require.Len(t, copied, 1)
+		require.Equal(t, "The bimi check has no record to copy.", e.message)
+	})
+
+	t.Run("Rerun", func(t *testing.T) {
+		e.selected = 2
+		require.Equal(t, explorerRerun, e.handleKey("r"))
+		require.Equal(t, "Re-running the dmarc check...", e.message)
+
+		e.rerunSelected()
+		require.Equal(t, 1, reruns)
+		require.True(t, strings.HasPrefix(e.message, "Re-ran the dmarc check in "), e.message)
+		require.Equal(t, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", e.checks[2].record)
+		require.Equal(t, domainAdvisor.CheckDMARC(e.checks[2].record)[0], e.checks[2].findings[0].Message)
+
+		// only the selected check is replaced
+		require.Equal(t, result.SPF, e.checks[3].record)
+		require.Equal(t, explorerPass, e.checks[3].status)
+
+		// a check without advice any more is kept, without findings
+		e.selected = 0
+		e.rerunSelected()
+		require.Equal(t, explorerCheck{name: "bimi"}, e.checks[0])
+	})
+}
+
+func TestTerminalClipboard(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, terminalClipboard(&out)("v=spf1 -all"))
+	require.Equal(t, "\x1b]52;c;"+base64.StdEncoding.EncodeToString([]byte("v=spf1 -all"))+"\a", out.String())
+}
+
+func TestWrap(t *testing.T) {
+	require.Equal(t, []string{"  the quick", "  brown fox"}, wrap("the quick brown fox", 13, "  "))
+	require.Equal(t, []string{"  " + strings.Repeat("a", 18), "  aa"}, wrap(strings.Repeat("a", 20), 20, "  "))
+	require.Equal(t, []string{"  short"}, wrap("short", 20, "  "))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/goccy/go-json"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.AddCommand(cmdLint)
+
+	cmdLint.Flags().StringVar(&lintRecords.BIMI, "bimi", "", "BIMI record to validate")
+	cmdLint.Flags().StringVar(&lintRecords.DKIM, "dkim", "", "DKIM record to validate")
+	cmdLint.Flags().StringVar(&lintRecords.DMARC, "dmarc", "", "DMARC record to validate")
+	cmdLint.Flags().StringSliceVar(&lintRecords.MX, "mx", nil, "Mail server hostnames to validate")
+	cmdLint.Flags().StringVar(&lintRecords.SPF, "spf", "", "SPF record to validate")
+}
+
+var lintRecords model.LintRequest
+
+var cmdLint = &cobra.Command{
+	Use:     "lint [flags] <STDIN>",
+	Example: "  dss lint --dmarc 'v=DMARC1; p=reject; rua=mailto:dmarc@example.com' --spf 'v=spf1 -all'\n  echo '{\"spf\":\"v=spf1 -all\",\"mx\":[\"mx1.example.com\"]}' | dss lint",
+	Short:   "Validate records before publishing them.",
+	Long:    "Validate DNS records before publishing them, without performing any DNS lookups or network probes.\nIf no records are provided as flags, a JSON object (as accepted by the /api/v1/validate endpoint) is read from STDIN.",
+	Args:    cobra.NoArgs,
+	Run: func(command *cobra.Command, args []string) {
+		if lintRecords.Empty() {
+			if err := json.NewDecoder(os.Stdin).Decode(&lintRecords); err != nil {
+				log.Fatal().Err(err).Msg("Unable to read records from STDIN.")
+			}
+		}
+
+		if lintRecords.Empty() {
+			log.Fatal().Msg("At least one record must be provided.")
+		}
+
+		// no TLS checks or caching are needed, as nothing is probed
+		recordAdvisor := advisor.NewAdvisor(timeout, 0, false)
+		defer recordAdvisor.Close()
+
+		printToConsole(model.LintResponse{Advice: recordAdvisor.Lint(lintRecords.BIMI, lintRecords.DKIM, lintRecords.DMARC, lintRecords.MX, lintRecords.SPF)})
+	},
+}
@@ -5,12 +5,16 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"runtime"
 	"strings"
 	"time"
 
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/audit"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
 	"github.com/goccy/go-json"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cast"
@@ -26,8 +30,10 @@ var (
 		Use:     "dss",
 		Short:   "Scan a domain's DNS records.",
 		Long:    "Scan a domain's DNS records.\nhttps://github.com/GlobalCyberAlliance/domain-security-scanner/v3",
-		Version: "3.0.14",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		Version: model.Version,
+		PersistentPreRun: func(command *cobra.Command, args []string) {
+			configErr := loadConfig(command)
+
 			var logWriter io.Writer
 
 			if prettyLog {
@@ -42,6 +48,10 @@ var (
 				log = zerolog.New(logWriter).With().Timestamp().Logger().Level(zerolog.InfoLevel)
 			}
 
+			if configErr != nil {
+				log.Fatal().Err(configErr).Msg("unable to load configuration")
+			}
+
 			configDir, err := os.UserHomeDir()
 			if err != nil {
 				log.Fatal().Err(err).Msg("unable to retrieve user's home directory")
@@ -56,7 +66,7 @@ var (
 				nameservers = cfg.Nameservers
 			}
 
-			if cmd.Flags().Changed("outputFile") {
+			if command.Flags().Changed("outputFile") {
 				if outputFile == "" {
 					outputFile = cast.ToString(time.Now().Unix())
 				}
@@ -64,42 +74,276 @@ var (
 		},
 	}
 
-	cfg                                          *Config
-	log                                          zerolog.Logger
-	writeToFileCounter                           int
-	dnsProtocol, format, outputFile              string
-	dkimSelector, nameservers                    []string
-	advise, debug, checkTLS, prettyLog, zoneFile bool
-	dnsBuffer                                    uint16
-	cache, timeout                               time.Duration
-	concurrent                                   uint16
+	cfg                                                    *Config
+	configFile                                             string
+	log                                                    zerolog.Logger
+	writeToFileCounter                                     int
+	auditFile, dnsProtocol, format, outputFile             string
+	ctLogURL, httpsProxy, noProxy, port25Reference, proxy  string
+	rdapBootstrapURL, sourceIP                             string
+	adviceCatalogFile, consumerDomainsFile, providersFile  string
+	auditMaxSize                                           int64
+	blocklistSample, dkimRotationMonths, smtpConnections   int
+	httpAttempts, httpBreakerFailures, rdapExpiryDays      int
+	lookalikeLimit, zoneInFlight                           int
+	zoneQPS                                                float64
+	answerSizeLimit, spfFanoutLimit, txtRecordLimit        int
+	blocklists, dkimSelector, nameservers, resolve         []string
+	cacheTTL, disableChecks, selectors, sendingSubdomains  []string
+	subdomainChecks                                        []string
+	advise, debug, checkTLS, detailed, prettyLog, zoneFile bool
+	certificateTransparency, checkBlocklists, rdap         bool
+	authoritative, checkSubdomains, offline, strictASCII   bool
+	securityTxt, subdomainAdvice                           bool
+	checkLookalikes, checkMTASTS, checkSPFIncludes         bool
+	dnsBuffer                                              uint16
+	cache, smtpInterval, timeBudget, timeout               time.Duration
+	concurrent                                             uint16
 )
 
 func main() {
+	cmd.PersistentFlags().StringVar(&adviceCatalogFile, "adviceCatalogFile", "", "Extend the advice catalog with the severity rules in this YAML file, matched before the built-in rules")
 	cmd.PersistentFlags().BoolVarP(&advise, "advise", "a", false, "Provide suggestions for incorrect/missing mail security features")
+	cmd.PersistentFlags().IntVar(&answerSizeLimit, "answerSizeLimit", scanner.DefaultAnswerSizeLimit, "The maximum bytes of records each lookup may be answered with, beyond which its records are too large to evaluate")
+	cmd.PersistentFlags().StringVar(&auditFile, "auditFile", "", "Record every DNS query and network probe to the specified NDJSON file")
+	cmd.PersistentFlags().Int64Var(&auditMaxSize, "auditMaxSize", 100, "Rotate the audit file once it exceeds this size, in megabytes (0 disables rotation)")
+	cmd.PersistentFlags().BoolVar(&authoritative, "authoritative", false, "Also query domains' authoritative nameservers for their TXT, MX, DMARC and DKIM records, noting any that differ from the recursive resolver's")
+	cmd.PersistentFlags().StringSliceVar(&blocklists, "blocklists", scanner.DefaultBlocklists, "The DNSBL zones checked by --checkBlocklists")
+	cmd.PersistentFlags().IntVar(&blocklistSample, "blocklistSample", scanner.DefaultBlocklistSample, "The maximum number of each domain's SPF authorized and MX host addresses checked by --checkBlocklists")
 	cmd.PersistentFlags().DurationVar(&cache, "cache", 3*time.Minute, "Specify how long to cache results for")
+	cmd.PersistentFlags().StringSliceVar(&cacheTTL, "cacheTTL", nil, "Cache an advisor namespace (host_tls, mail_tls, mail_certificates, mail_domains, certificates, registrations or security_contacts) for its own lifetime, in `namespace=duration` format, overriding its default; may be specified multiple times")
+	cmd.PersistentFlags().BoolVar(&certificateTransparency, "certificateTransparency", false, "Check certificate transparency logs for unexpected certificates issued for domains")
+	cmd.PersistentFlags().StringVar(&configFile, "config", "", "Load flag values from a YAML config file (defaults to $XDG_CONFIG_HOME/dss/config.yaml)")
+	cmd.PersistentFlags().BoolVar(&checkBlocklists, "checkBlocklists", false, "Check a sample of domains' SPF authorized and MX host addresses against DNSBLs")
+	cmd.PersistentFlags().BoolVar(&checkLookalikes, "checkLookalikes", false, "Check whether lookalikes of domains (such as typos and homographs) resolve and are set up for mail, as an informational finding")
+	cmd.PersistentFlags().BoolVar(&checkMTASTS, "checkMTASTS", false, "Check domains' MTA-STS policies against their mail servers, with a verdict for each under mode: enforce")
+	cmd.PersistentFlags().BoolVar(&checkSPFIncludes, "checkSPFIncludes", false, "Resolve the includes of domains' SPF records, reporting ip4 and ip6 mechanisms (and includes) that they make redundant")
+	cmd.PersistentFlags().BoolVar(&checkSubdomains, "checkSubdomains", false, "Check common sending subdomains of domains for their own SPF, DKIM and DMARC records")
 	cmd.PersistentFlags().BoolVar(&checkTLS, "checkTLS", false, "Check the TLS connectivity and cert validity of domains")
+	cmd.PersistentFlags().StringVar(&consumerDomainsFile, "consumerDomainsFile", "", "Treat the domains listed in this file, one per line, as consumer mailbox domains, along with the built-in ones")
 	cmd.PersistentFlags().Uint16VarP(&concurrent, "concurrent", "c", uint16(runtime.NumCPU()), "The number of domains to scan concurrently")
+	cmd.PersistentFlags().StringVar(&ctLogURL, "ctLogURL", advisor.DefaultCTLogURL, "The crt.sh compatible certificate transparency log search to query")
 	cmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "Print debug logs")
+	cmd.PersistentFlags().BoolVar(&detailed, "detailed", false, "Include per-host advice lines instead of summaries, along with timings, parsed records and findings")
+	cmd.PersistentFlags().StringSliceVar(&disableChecks, "disableChecks", nil, "Skip these checks of the advice (bimi, dkim, dmarc, domain, mx, spf, or a registered extension check)")
+	cmd.PersistentFlags().IntVar(&dkimRotationMonths, "dkimRotationMonths", 12, "Suggest rotating DKIM keys whose selector dates them older than this many months (0 disables)")
 	cmd.PersistentFlags().StringSliceVar(&dkimSelector, "dkimSelector", []string{}, "Specify a DKIM selector")
-	cmd.PersistentFlags().Uint16Var(&dnsBuffer, "dnsBuffer", 4096, "Specify the allocated buffer for DNS responses")
+	cmd.PersistentFlags().Uint16Var(&dnsBuffer, "dnsBuffer", scanner.DefaultDNSBuffer, "Specify the EDNS0 buffer size for UDP DNS responses, larger responses are retried over TCP")
 	cmd.PersistentFlags().StringVar(&dnsProtocol, "dnsProtocol", "udp", "Protocol to use for DNS queries (udp, tcp, tcp-tls)")
-	cmd.PersistentFlags().StringVarP(&format, "format", "f", "yaml", "Format to print results in (yaml, json)")
+	cmd.PersistentFlags().StringVarP(&format, "format", "f", "yaml", "Format to print results in (yaml, json, jsonp, json-canonical, csv)")
 	cmd.PersistentFlags().StringSliceVarP(&nameservers, "nameservers", "n", nil, "Use specific nameservers, in `host[:port]` format; may be specified multiple times")
+	cmd.PersistentFlags().StringVar(&noProxy, "noProxy", "", "Comma-separated hosts, domains, IPs and CIDR ranges that bypass the proxy (overrides NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&offline, "offline", false, "Skip every check that needs internet access (TLS probes, BIMI downloads, security.txt fetches, certificate transparency and RDAP lookups), for air-gapped networks")
+	cmd.PersistentFlags().StringVar(&outputEncryption, "outputEncryption", "", "Encrypt the objects written to S3 by --output and --scheduleOutput server-side (AES256 or aws:kms)")
 	cmd.PersistentFlags().StringVarP(&outputFile, "outputFile", "o", "", "Output the results to a specified file (creates a file with the current unix timestamp if no file is specified)")
+	cmd.PersistentFlags().StringVar(&outputKMSKey, "outputKMSKey", "", "Encrypt the objects written by --output and --scheduleOutput with this KMS key (an AWS key ID or ARN, or a Cloud KMS key's resource name)")
+	cmd.PersistentFlags().StringVar(&port25Reference, "port25Reference", advisor.DefaultPort25Reference, "The mail server --checkTLS connects to once, to detect whether outbound port 25 is blocked and skip the SMTP TLS checks if so (empty disables)")
 	cmd.PersistentFlags().BoolVar(&prettyLog, "prettyLog", true, "Pretty print logs to console")
+	cmd.PersistentFlags().StringVar(&providersFile, "providersFile", "", "Extend the mail provider fingerprints with those in this YAML file, in the format of the built-in providers.yaml")
+	cmd.PersistentFlags().StringVar(&proxy, "proxy", "", "SOCKS5 proxy for TLS, SMTP and HTTP probes, e.g. socks5://proxy:1080 (overrides ALL_PROXY)")
+	cmd.PersistentFlags().IntVar(&httpAttempts, "httpAttempts", advisor.DefaultHTTPAttempts, "The number of attempts of BIMI asset fetches that time out or get a 5xx response")
+	cmd.PersistentFlags().IntVar(&httpBreakerFailures, "httpBreakerFailures", advisor.DefaultBreakerFailures, "Skip BIMI asset hosts for a while after this many failed fetches in a row (0 disables)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "httpsProxy", "", "Proxy for HTTP(S) fetches, such as BIMI assets (overrides HTTPS_PROXY)")
+	cmd.PersistentFlags().BoolVar(&rdap, "rdap", false, "Look up domains' registrations over RDAP, warning of registrations that expire soon or aren't locked against transfers")
+	cmd.PersistentFlags().StringVar(&rdapBootstrapURL, "rdapBootstrapURL", advisor.DefaultRDAPBootstrapURL, "The RDAP bootstrap registry used by --rdap to find each TLD's RDAP service")
+	cmd.PersistentFlags().IntVar(&rdapExpiryDays, "rdapExpiryDays", 60, "Warn of registrations that expire within this many days with --rdap")
+	cmd.PersistentFlags().StringSliceVar(&resolve, "resolve", nil, "Force --checkTLS connections to a host and port to an address, in `host:port:address` format (like curl's --resolve), still using the host for SNI; may be specified multiple times")
+	cmd.PersistentFlags().BoolVar(&securityTxt, "securityTxt", false, "Fetch domains' security.txt files, warning of domains without a reachable contact for reporting security issues")
+	cmd.PersistentFlags().StringSliceVar(&selectors, "selector", nil, "Only look up DKIM keys at this selector, skipping the common selectors; may be specified multiple times, or empty to skip DKIM")
+	cmd.PersistentFlags().StringSliceVar(&sendingSubdomains, "sendingSubdomains", scanner.DefaultSendingSubdomains, "The sending subdomains checked by --checkSubdomains")
+	cmd.PersistentFlags().IntVar(&smtpConnections, "smtpConnections", 0, "The maximum number of SMTP connections open at once for --checkTLS (0 is unlimited)")
+	cmd.PersistentFlags().DurationVar(&smtpInterval, "smtpInterval", time.Second, "The minimum interval between SMTP connections to the same mail server for --checkTLS")
+	cmd.PersistentFlags().StringVar(&sourceIP, "sourceIP", "", "Send DNS queries and TLS, SMTP and HTTP probes from this local address, which must be assigned to the host")
+	cmd.PersistentFlags().IntVar(&spfFanoutLimit, "spfFanoutLimit", scanner.DefaultSPFFanoutLimit, "The maximum DNS lookup terms (include, a, mx, ptr, exists and redirect) an SPF record may have, beyond which it's too large to evaluate")
+	cmd.PersistentFlags().BoolVar(&strictASCII, "strictASCII", false, "Flag DMARC report destinations that aren't ASCII addresses, for receivers without internationalized email (EAI) support")
+	cmd.PersistentFlags().BoolVar(&subdomainAdvice, "subdomainAdvice", true, "Tailor the advice of subdomains to them, reporting the DMARC policy they inherit and skipping the BIMI and domain checks (false advises them as organizational domains)")
+	cmd.PersistentFlags().StringSliceVar(&subdomainChecks, "subdomainChecks", nil, "Run these checks skipped by --subdomainAdvice for subdomains anyway (bimi, domain)")
+	cmd.PersistentFlags().DurationVar(&timeBudget, "timeBudget", advisor.DefaultTimeBudget, "The maximum duration of each domain's advice checks, divided across them with the mail servers' TLS probes getting the largest share (0 disables)")
 	cmd.PersistentFlags().DurationVarP(&timeout, "timeout", "t", 15*time.Second, "Timeout duration for queries")
+	cmd.PersistentFlags().IntVar(&txtRecordLimit, "txtRecordLimit", scanner.DefaultTXTRecordLimit, "The maximum TXT records a single DNS answer may have, beyond which its records are too large to evaluate")
 	cmd.PersistentFlags().BoolVarP(&zoneFile, "zoneFile", "z", false, "Input file/pipe containing an RFC 1035 zone file")
+	cmd.PersistentFlags().IntVar(&zoneInFlight, "zoneInFlight", 0, "The maximum number of DNS queries in flight at once for the names under each organizational domain (0 is unbounded)")
+	cmd.PersistentFlags().Float64Var(&zoneQPS, "zoneQPS", 0, "The maximum number of DNS queries started each second for the names under each organizational domain, pacing the rest (0 is unbounded)")
 
 	_ = cmd.Execute()
 }
 
+// loadConfig fills any flags that weren't set on the command line from the
+// environment and the config file, in that order.
+func loadConfig(command *cobra.Command) error {
+	path, required := configFilePath(configFile)
+
+	fileValues, err := loadConfigFile(path)
+	if err != nil {
+		if required || !os.IsNotExist(err) {
+			return err
+		}
+
+		fileValues = nil
+	}
+
+	return applyConfig(command.Root(), command, fileValues, os.LookupEnv)
+}
+
+// newAdvisor returns an advisor configured by the global flags, with proxies
+// read from the environment unless overridden by flags.
+func newAdvisor(opts ...advisor.Option) *advisor.Advisor {
+	proxyConfig := advisor.ProxyConfigFromEnvironment()
+
+	if proxy != "" {
+		proxyConfig.AllProxy = proxy
+	}
+
+	if httpsProxy != "" {
+		proxyConfig.HTTPProxy = httpsProxy
+		proxyConfig.HTTPSProxy = httpsProxy
+	}
+
+	if noProxy != "" {
+		proxyConfig.NoProxy = noProxy
+	}
+
+	if err := proxyConfig.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid proxy configuration")
+	}
+
+	overrides, err := advisor.ParseResolveOverrides(resolve)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid resolve override")
+	}
+
+	cacheTTLs, err := advisor.ParseCacheTTLs(cacheTTL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid cache TTL")
+	}
+
+	for _, name := range disableChecks {
+		if err = advisor.ValidateCheckName(name); err != nil {
+			log.Fatal().Err(err).Msg("invalid check to disable")
+		}
+	}
+
+	for _, name := range subdomainChecks {
+		if err = advisor.ValidateSubdomainCheck(name); err != nil {
+			log.Fatal().Err(err).Msg("invalid subdomain check")
+		}
+	}
+
+	var sourceAddress net.IP
+	if sourceIP != "" {
+		if sourceAddress, err = scanner.ParseSourceAddress(sourceIP); err != nil {
+			log.Fatal().Err(err).Msg("invalid source address")
+		}
+	}
+
+	defaults := []advisor.Option{advisor.WithDisabledChecks(disableChecks...), advisor.WithDetailed(detailed), advisor.WithDKIMRotationAge(dkimRotationMonths), advisor.WithHTTPRetry(httpAttempts, advisor.DefaultHTTPBackoff), advisor.WithCircuitBreaker(httpBreakerFailures, advisor.DefaultBreakerCooldown), advisor.WithOffline(offline), advisor.WithPort25SelfTest(port25Reference), advisor.WithProxy(proxyConfig), advisor.WithResolveOverrides(overrides...), advisor.WithSecurityTxt(securityTxt), advisor.WithSMTPPoliteness(smtpInterval, smtpConnections), advisor.WithSourceAddress(sourceAddress), advisor.WithStrictASCII(strictASCII), advisor.WithSubdomainAdvice(subdomainAdvice), advisor.WithSubdomainChecks(subdomainChecks...), advisor.WithTimeBudget(timeBudget)}
+	if certificateTransparency {
+		defaults = append(defaults, advisor.WithCertificateTransparency(ctLogURL))
+	}
+
+	if rdap {
+		defaults = append(defaults, advisor.WithRDAP(rdapBootstrapURL, time.Duration(rdapExpiryDays)*24*time.Hour))
+	}
+
+	defaults = append(defaults, cacheTTLs...)
+
+	if files := dataFiles(); files != (advisor.DataFiles{}) {
+		if _, err = advisor.LoadData(files); err != nil {
+			log.Fatal().Err(err).Msg("unable to load data files")
+		}
+	}
+
+	return advisor.NewAdvisor(timeout, cache, checkTLS, append(defaults, opts...)...)
+}
+
+// scannerOptions returns the scanner options configured by the global flags.
+func scannerOptions() []scanner.Option {
+	opts := []scanner.Option{
+		scanner.WithAnswerLimits(txtRecordLimit, answerSizeLimit, spfFanoutLimit),
+		scanner.WithZonePacing(zoneQPS, zoneInFlight),
+		scanner.WithCacheDuration(cache),
+		scanner.WithConcurrentScans(concurrent),
+		scanner.WithDNSBuffer(dnsBuffer),
+		scanner.WithDNSProtocol(dnsProtocol),
+		scanner.WithNameservers(nameservers),
+		scanner.WithSourceAddress(sourceIP),
+	}
+
+	if len(dkimSelector) > 0 {
+		opts = append(opts, scanner.WithDKIMSelectors(dkimSelector...))
+	}
+
+	if len(selectors) > 0 {
+		opts = append(opts, scanner.WithOnlyDKIMSelectors(selectors...))
+	} else if selectors != nil {
+		// --selector "" looks up no DKIM keys at all
+		opts = append(opts, scanner.WithoutDKIMDiscovery())
+	}
+
+	if checkSubdomains {
+		opts = append(opts, scanner.WithSendingSubdomains(sendingSubdomains...))
+	}
+
+	if checkBlocklists {
+		opts = append(opts, scanner.WithBlocklists(blocklistSample, blocklists...))
+	}
+
+	if checkLookalikes {
+		opts = append(opts, scanner.WithLookalikes(lookalikeLimit))
+	}
+
+	if checkMTASTS {
+		opts = append(opts, scanner.WithMTASTS())
+	}
+
+	if checkSPFIncludes {
+		opts = append(opts, scanner.WithSPFIncludes())
+	}
+
+	if authoritative {
+		opts = append(opts, scanner.WithAuthoritative())
+	}
+
+	return opts
+}
+
+// dataFiles returns the data files extending the advisor's built-in data.
+func dataFiles() advisor.DataFiles {
+	return advisor.DataFiles{ConsumerDomains: consumerDomainsFile, Providers: providersFile, AdviceCatalog: adviceCatalogFile}
+}
+
+// openAuditLog opens the audit file (if --auditFile is set), returning the
+// scanner and advisor options that record to it. The log is nil if auditing
+// is disabled.
+func openAuditLog() (*audit.Log, []scanner.Option, []advisor.Option) {
+	if auditFile == "" {
+		return nil, nil, nil
+	}
+
+	auditLog, err := audit.New(auditFile, auditMaxSize*1024*1024)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to open audit file")
+	}
+
+	auditLog.SetSourceAddress(sourceIP)
+
+	scannerOpts := []scanner.Option{scanner.WithResolverMiddleware(auditLog.Resolver)}
+	advisorOpts := []advisor.Option{advisor.WithDialerMiddleware(auditLog.Dialer)}
+
+	return auditLog, scannerOpts, advisorOpts
+}
+
 func marshal(data interface{}) (output []byte) {
 	switch strings.ToLower(format) {
 	case "csv":
-		// convert data to model.ScanResultWithAdvice
-		scan, ok := data.(model.ScanResultWithAdvice)
-		if !ok {
+		var record []string
+
+		switch scan := data.(type) {
+		case model.ScanResult:
+			record = scan.CSV()
+		case *model.FieldSelection:
+			record = scan.CSV()
+		default:
 			log.Error().Msg("invalid data type")
 			return nil
 		}
@@ -107,13 +351,17 @@ func marshal(data interface{}) (output []byte) {
 		// write to csv in buffer
 		var buffer bytes.Buffer
 		writer := csv.NewWriter(&buffer)
-		_ = writer.Write(scan.CSV())
+		_ = writer.Write(record)
 		writer.Flush()
 		output = buffer.Bytes()
 	case "json":
 		output, _ = json.Marshal(data)
 	case "jsonp":
 		output, _ = json.MarshalIndent(data, "", "\t")
+	case "json-canonical":
+		// map keys are always sorted, and the result is canonicalized by resultOutput
+		output, _ = json.MarshalIndent(data, "", "\t")
+		output = append(output, '\n')
 	default:
 		output, _ = yaml.Marshal(data)
 	}
@@ -124,7 +372,7 @@ func marshal(data interface{}) (output []byte) {
 func printToConsole(data interface{}) {
 	if outputFile != "" {
 		extension := format
-		if extension == "jsonp" {
+		if extension == "jsonp" || extension == "json-canonical" {
 			extension = "json"
 		}
 
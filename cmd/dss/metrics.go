@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/metrics"
+)
+
+// scanMetrics records the metrics of a bulk scan when --metricsListen,
+// --summary or --summaryFile is set.
+var scanMetrics *metrics.Registry
+
+// serveMetrics serves the scan metrics at /metrics on the given address,
+// returning a function that shuts the listener down once the scan completes.
+func serveMetrics(address string) func() {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to listen for metrics")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", scanMetrics)
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("metrics listener failed")
+		}
+	}()
+
+	log.Info().Msg("Serving metrics on " + listener.Addr().String() + "/metrics")
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			log.Warn().Err(err).Msg("metrics listener did not shut down cleanly")
+		}
+	}
+}
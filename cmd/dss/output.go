@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/objectstore"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/goccy/go-json"
+)
+
+var outputEncryption, outputKMSKey string
+
+// scheduleExporter exports each scheduled run's results to object storage,
+// under <tenant>/<schedule ID>/<completion time>/ of its prefix.
+type scheduleExporter struct {
+	bucket objectstore.Bucket
+	prefix string
+}
+
+// openBucket opens the bucket of an object storage URL, with the server-side
+// encryption set by --outputEncryption and --outputKMSKey.
+func openBucket(ctx context.Context, rawURL string) (objectstore.Bucket, string, error) {
+	return objectstore.Open(ctx, rawURL, objectstore.Encryption{Mode: outputEncryption, KMSKey: outputKMSKey})
+}
+
+// Export writes the run's results, and falls back to a local file named by
+// the schedule's ID and the run's completion time if the upload fails.
+func (e *scheduleExporter) Export(ctx context.Context, scheduled schedule.Schedule, completedAt time.Time, results []*model.ScanResult) error {
+	prefix := e.prefix + scheduled.Tenant + "/" + scheduled.ID + "/" + completedAt.UTC().Format(time.RFC3339) + "/"
+	writer := objectstore.NewWriter(e.bucket, prefix, objectstore.WithFallback(fmt.Sprintf("%s-%d.ndjson", scheduled.ID, completedAt.Unix())))
+
+	for _, result := range results {
+		line, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		if err = writer.Write(ctx, line, result.ScanResult != nil && result.ScanResult.Error != ""); err != nil {
+			return err
+		}
+	}
+
+	if _, err := writer.Close(ctx); err != nil {
+		return err
+	}
+
+	if path := writer.Fallback(); path != "" {
+		return fmt.Errorf("the upload failed, so the results were written to %s instead", path)
+	}
+
+	return nil
+}
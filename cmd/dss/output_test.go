@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/objectstore"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleExporter(t *testing.T) {
+	bucket := objectstore.NewMemory()
+	exporter := &scheduleExporter{bucket: bucket, prefix: "scheduled/"}
+
+	completedAt := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+	results := []*model.ScanResult{
+		{Domain: "a.example", ScanResult: &scanner.Result{Domain: "a.example", SPF: "v=spf1 -all"}},
+		{Domain: "b.example", ScanResult: &scanner.Result{Domain: "b.example", Error: "SERVFAIL"}},
+	}
+
+	require.NoError(t, exporter.Export(context.Background(), schedule.Schedule{ID: "5f2b6c2d9a1e4f07", Tenant: "default"}, completedAt, results))
+
+	prefix := "scheduled/default/5f2b6c2d9a1e4f07/2026-10-14T06:00:00Z/"
+	require.Equal(t, []string{prefix + "manifest.json", prefix + "part-00001.ndjson"}, bucket.Keys())
+
+	part, _ := bucket.Get(prefix + "part-00001.ndjson")
+	lines := strings.Split(strings.TrimSuffix(string(part), "\n"), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"domain":"a.example"`)
+	require.Contains(t, lines[1], `"domain":"b.example"`)
+
+	manifest, _ := bucket.Get(prefix + "manifest.json")
+	require.Contains(t, string(manifest), `"records": 2`)
+	require.Contains(t, string(manifest), `"failed": 1`)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.AddCommand(cmdPlan)
+
+	cmdPlan.Flags().StringSliceVar(&planReports, "report", nil, "A DMARC aggregate report (XML, optionally gzipped) for the domain, so the policy is only enforced once the reports show its mail passes; may be specified multiple times")
+	cmdPlan.Flags().StringVar(&planReportMailbox, "reportMailbox", "", "Mailbox to receive DMARC aggregate reports, if the domain doesn't request them yet (defaults to dmarc@<domain>)")
+}
+
+var (
+	planReportMailbox string
+	planReports       []string
+)
+
+var cmdPlan = &cobra.Command{
+	Use:     "plan [flags] <domain>",
+	Example: "  dss plan globalcyberalliance.org\n  dss plan --report google.com!example.com!1704067200!1704153599.xml.gz example.com",
+	Short:   "Plan the rollout of DMARC enforcement for a domain.",
+	Long:    "Scan a domain, then output the ordered steps to take it from its current DMARC policy to p=reject, with the exact record to publish at each.\nSteps that are already done are left out, and blockers (such as missing DKIM keys, or reports showing mail that fails DMARC) come first.",
+	Args:    cobra.ExactArgs(1),
+	Run: func(command *cobra.Command, args []string) {
+		if err := scanner.ValidateDomain(args[0]); err != nil {
+			log.Fatal().Err(err).Msg("Invalid domain.")
+		}
+
+		var reports *model.ReportSummary
+
+		for _, path := range planReports {
+			file, err := os.Open(path)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Unable to open report.")
+			}
+
+			summary, err := model.ParseAggregateReport(file)
+			_ = file.Close()
+
+			if err != nil {
+				log.Fatal().Err(err).Str("report", path).Msg("Unable to read report.")
+			}
+
+			if reports == nil {
+				reports = &model.ReportSummary{Domain: summary.Domain}
+			}
+
+			reports.Add(summary)
+		}
+
+		opts := scannerOptions()
+
+		auditLog, auditScannerOpts, _ := openAuditLog()
+		if auditLog != nil {
+			defer auditLog.Close()
+		}
+
+		sc, err := scanner.New(log, timeout, append(opts, auditScannerOpts...)...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("An unexpected error occurred.")
+		}
+		defer sc.Close()
+
+		results, err := sc.Scan(args[0])
+		if err != nil {
+			log.Fatal().Err(err).Msg("An unexpected error occurred.")
+		}
+
+		if results[0].Error != "" {
+			log.Fatal().Str("domain", results[0].Domain).Msg(results[0].Error)
+		}
+
+		if reports != nil && reports.Domain != "" && reports.Domain != results[0].Domain {
+			log.Fatal().Str("domain", results[0].Domain).Str("reports", reports.Domain).Msg("The reports are for another domain.")
+		}
+
+		printToConsole(model.NewPlan(model.PlanInput{
+			Domain:        results[0].Domain,
+			Records:       model.ParseRecords(results[0]),
+			MX:            len(results[0].MX) > 0,
+			ReportMailbox: planReportMailbox,
+			Reports:       reports,
+		}))
+	},
+}
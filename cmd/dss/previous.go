@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/goccy/go-json"
+)
+
+// loadPreviousResults reads the results of a previous scan, as printed by dss
+// scan in a JSON format (including NDJSON), or as recorded by --checkpoint.
+// When a domain appears more than once, its last result is kept.
+func loadPreviousResults(path string) (map[string]*model.ScanResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open previous results: %w", err)
+	}
+	defer file.Close()
+
+	results := make(map[string]*model.ScanResult)
+	decoder := json.NewDecoder(file)
+
+	for {
+		// checkpoint entries hold the result under result
+		var entry struct {
+			model.ScanResult
+			Result json.RawMessage `json:"result"`
+		}
+
+		if err = decoder.Decode(&entry); errors.Is(err, io.EOF) {
+			return results, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse previous results %s: %w", path, err)
+		}
+
+		result := entry.ScanResult
+		if len(entry.Result) > 0 {
+			result = model.ScanResult{}
+			if err = json.Unmarshal(entry.Result, &result); err != nil {
+				return nil, fmt.Errorf("failed to parse previous results %s: %w", path, err)
+			}
+		}
+
+		domain := result.Domain
+		if domain == "" && result.ScanResult != nil {
+			// results reshaped to schema version 1 only have the scanner's domain
+			domain = result.ScanResult.Domain
+		}
+
+		if domain != "" {
+			results[domain] = &result
+		}
+	}
+}
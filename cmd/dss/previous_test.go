@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPreviousResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "previous.json")
+
+	// an indented result, an NDJSON result, a checkpoint entry, and a result
+	// reshaped to an early schema version, which replaces the first
+	data := `{
+	"domain": "example.com",
+	"scanResult": {"domain": "example.com"},
+	"advice": {"spf": ["You do not have SPF setup!"]}
+}
+{"domain":"example.org","scanResult":{"domain":"example.org"},"advice":{"dmarc":["You do not have DMARC setup!"]}}
+{"domain":"example.net","result":{"domain":"example.net","scanResult":{"domain":"example.net"},"advice":{"bimi":["Your BIMI record looks good! No further action needed."]}}}
+{"scanResult":{"domain":"example.com"},"advice":{"spf":["SPF seems to be setup correctly! No further action needed."]}}
+`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	results, err := loadPreviousResults(path)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, []string{"SPF seems to be setup correctly! No further action needed."}, results["example.com"].Advice.SPF)
+	require.Equal(t, []string{"You do not have DMARC setup!"}, results["example.org"].Advice.DMARC)
+	require.Equal(t, []string{"Your BIMI record looks good! No further action needed."}, results["example.net"].Advice.BIMI)
+
+	t.Run("Invalid", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(`{"domain": "example.com"} not json`), 0o644))
+
+		_, err := loadPreviousResults(path)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/metrics"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+)
+
+// runSlowest is the number of slowest domains listed in a run's summary.
+const runSlowest = 10
+
+type (
+	// runSummary is the outcome of a scan run, printed once it completes with
+	// --summary or --summaryFile.
+	runSummary struct {
+		Duration      string             `json:"duration" yaml:"duration"`
+		Domains       int                `json:"domains" yaml:"domains"`
+		Errors        int                `json:"errors" yaml:"errors"`
+		DNSQueries    uint64             `json:"dnsQueries" yaml:"dnsQueries"`
+		SMTPProbes    uint64             `json:"smtpProbes" yaml:"smtpProbes"`
+		CacheHitRates map[string]float64 `json:"cacheHitRates" yaml:"cacheHitRates"`
+		Findings      map[string]int     `json:"findings,omitempty" yaml:"findings,omitempty"`
+		Slowest       []runDomain        `json:"slowest" yaml:"slowest"`
+	}
+
+	// runDomain is a domain and the duration of its scan.
+	runDomain struct {
+		Domain   string `json:"domain" yaml:"domain"`
+		Duration string `json:"duration" yaml:"duration"`
+
+		duration time.Duration
+	}
+
+	// runRecorder counts the domains of a scan run, and their findings. It
+	// only retains the slowest domains, so its memory use stays flat however
+	// many domains are scanned. It isn't safe for concurrent use.
+	runRecorder struct {
+		start    time.Time
+		domains  int
+		errors   int
+		findings map[advisor.Severity]int
+		slowest  []runDomain
+	}
+)
+
+var (
+	summaryFormat string
+	summaryFile   string
+
+	// runStats records the run for its summary when --summary or --summaryFile is set.
+	runStats *runRecorder
+)
+
+func newRunRecorder() *runRecorder {
+	return &runRecorder{start: time.Now(), findings: make(map[advisor.Severity]int)}
+}
+
+// observe records a domain's result, along with its advice (which is nil if
+// the domain wasn't advised on). A result is counted as an error if its scan
+// or any of its checks failed on the scanner's side.
+func (r *runRecorder) observe(result *scanner.Result, advice *advisor.Advice) {
+	r.domains++
+
+	if result.Error != "" || (advice != nil && len(advice.Errors) > 0) {
+		r.errors++
+	}
+
+	if advice != nil {
+		for _, finding := range advice.Findings() {
+			r.findings[finding.Severity]++
+		}
+	}
+
+	index := sort.Search(len(r.slowest), func(i int) bool { return r.slowest[i].duration < result.Duration })
+	if index == runSlowest {
+		return
+	}
+
+	domain := runDomain{Domain: result.Domain, Duration: result.Duration.Round(time.Millisecond).String(), duration: result.Duration}
+	r.slowest = append(r.slowest[:index], append([]runDomain{domain}, r.slowest[index:]...)...)
+
+	if len(r.slowest) > runSlowest {
+		r.slowest = r.slowest[:runSlowest]
+	}
+}
+
+// summary returns the run's summary so far, with the DNS queries and SMTP
+// probes counted by the registry, and the given cache hit rates, by cache.
+// The findings are only summarized if the results were advised on.
+func (r *runRecorder) summary(registry *metrics.Registry, hitRates map[string]float64, advised bool) *runSummary {
+	summary := &runSummary{
+		Duration:      time.Since(r.start).Round(time.Millisecond).String(),
+		Domains:       r.domains,
+		Errors:        r.errors,
+		DNSQueries:    registry.DNSQueries(),
+		SMTPProbes:    registry.SMTPProbes(),
+		CacheHitRates: hitRates,
+		Slowest:       append([]runDomain{}, r.slowest...),
+	}
+
+	if advised {
+		summary.Findings = make(map[string]int)
+
+		for severity := advisor.SeverityCritical; severity >= advisor.SeverityInfo; severity-- {
+			summary.Findings[severity.String()] = r.findings[severity]
+		}
+	}
+
+	return summary
+}
+
+// Table returns the summary formatted as tables, with the findings from the
+// most severe.
+func (s *runSummary) Table() string {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(writer, "Duration\t%s\n", s.Duration)
+	fmt.Fprintf(writer, "Domains\t%d\n", s.Domains)
+	fmt.Fprintf(writer, "With errors\t%d\n", s.Errors)
+	fmt.Fprintf(writer, "DNS queries\t%d\n", s.DNSQueries)
+	fmt.Fprintf(writer, "SMTP probes\t%d\n", s.SMTPProbes)
+
+	if s.Findings != nil {
+		fmt.Fprintf(writer, "\nSeverity\tFindings\n")
+		for severity := advisor.SeverityCritical; severity >= advisor.SeverityInfo; severity-- {
+			fmt.Fprintf(writer, "%s\t%d\n", severity, s.Findings[severity.String()])
+		}
+	}
+
+	namespaces := make([]string, 0, len(s.CacheHitRates))
+	for namespace := range s.CacheHitRates {
+		namespaces = append(namespaces, namespace)
+	}
+
+	sort.Strings(namespaces)
+
+	fmt.Fprintf(writer, "\nCache\tHit rate\n")
+	for _, namespace := range namespaces {
+		fmt.Fprintf(writer, "%s\t%.1f%%\n", namespace, s.CacheHitRates[namespace]*100)
+	}
+
+	if len(s.Slowest) > 0 {
+		fmt.Fprintf(writer, "\nSlowest domain\tDuration\n")
+		for _, domain := range s.Slowest {
+			fmt.Fprintf(writer, "%s\t%s\n", domain.Domain, domain.Duration)
+		}
+	}
+
+	_ = writer.Flush()
+
+	return buffer.String()
+}
+
+// validateSummaryFormat returns an error if the --summary format isn't
+// supported.
+func validateSummaryFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "", "json", "table":
+		return nil
+	}
+
+	return fmt.Errorf("unknown summary format %q, expected json or table", format)
+}
+
+// writeRunSummary writes the run's summary to --summaryFile, or to stderr,
+// formatted as --summary (JSON by default for a file, and tables otherwise).
+func writeRunSummary(registry *metrics.Registry, sc *scanner.Scanner, domainAdvisor *advisor.Advisor) {
+	if runStats == nil {
+		return
+	}
+
+	summary := runStats.summary(registry, cacheHitRates(sc, domainAdvisor), advise)
+
+	var output []byte
+
+	if strings.EqualFold(summaryFormat, "table") || (summaryFormat == "" && summaryFile == "") {
+		output = []byte(summary.Table())
+	} else {
+		output, _ = json.MarshalIndent(summary, "", "\t")
+		output = append(output, '\n')
+	}
+
+	if summaryFile == "" {
+		_, _ = os.Stderr.Write(output)
+		return
+	}
+
+	if err := os.WriteFile(summaryFile, output, 0o644); err != nil {
+		log.Fatal().Err(err).Msg("failed to write the summary")
+	}
+
+	log.Info().Msg("Summary written to " + summaryFile)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/dss"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/metrics"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// fixtureResolver answers from a zone, failing the queries for the names
+	// in failing, and counts the queries it answers.
+	fixtureResolver struct {
+		zone    *dss.ZoneResolver
+		failing string
+
+		mutex   sync.Mutex
+		queries int
+	}
+
+	// fixtureDialer refuses every connection, counting those to port 25.
+	fixtureDialer struct {
+		mutex sync.Mutex
+		smtp  int
+	}
+)
+
+func (r *fixtureResolver) Exchange(msg *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	r.mutex.Lock()
+	r.queries++
+	r.mutex.Unlock()
+
+	if msg.Question[0].Name == r.failing {
+		reply := new(dns.Msg).SetReply(msg)
+		reply.Rcode = dns.RcodeServerFailure
+
+		return reply, 0, nil
+	}
+
+	return r.zone.Exchange(msg, address)
+}
+
+func (d *fixtureDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	if _, port, _ := net.SplitHostPort(address); port == "25" {
+		d.mutex.Lock()
+		d.smtp++
+		d.mutex.Unlock()
+	}
+
+	return nil, errors.New("connection refused")
+}
+
+func TestRunRecorder(t *testing.T) {
+	domains := []string{"example.com", "example.net", "failing.example.org"}
+
+	zone, err := dss.NewZoneResolver(fakeZone(domains))
+	require.NoError(t, err)
+
+	resolver := &fixtureResolver{zone: zone, failing: "failing.example.org."}
+	dialer := &fixtureDialer{}
+	registry := metrics.New()
+
+	sc, err := scanner.New(log, time.Second,
+		scanner.WithCacheDuration(time.Minute),
+		scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver { return resolver }),
+		scanner.WithResolverMiddleware(registry.Resolver),
+	)
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	// the mail servers are probed over SMTP, through a dialer that refuses every connection
+	domainAdvisor := advisor.NewAdvisor(time.Second, time.Minute, true,
+		advisor.WithHostResolver(zone),
+		advisor.WithDialer(dialer),
+		advisor.WithDialerMiddleware(registry.Dialer),
+		advisor.WithProbeReuse(true),
+	)
+	t.Cleanup(domainAdvisor.Close)
+
+	recorder := newRunRecorder()
+	findings := make(map[advisor.Severity]int)
+	errored := 0
+
+	// example.com is scanned twice, so its second result is answered from the cache
+	for _, domain := range append(domains, "example.com") {
+		results, err := sc.Scan(domain)
+		require.NoError(t, err)
+
+		advice := model.Advise(context.Background(), domainAdvisor, results[0], false)
+		recorder.observe(results[0], advice)
+
+		if results[0].Error != "" || len(advice.Errors) > 0 {
+			errored++
+		}
+
+		for _, finding := range advice.Findings() {
+			findings[finding.Severity]++
+		}
+	}
+
+	summary := recorder.summary(registry, cacheHitRates(sc, domainAdvisor), true)
+
+	require.Equal(t, 4, summary.Domains)
+	require.Equal(t, errored, summary.Errors)
+	require.Positive(t, summary.Errors)
+	require.Equal(t, uint64(resolver.queries), summary.DNSQueries)
+	require.Equal(t, uint64(dialer.smtp), summary.SMTPProbes)
+	require.Positive(t, summary.SMTPProbes)
+	require.Equal(t, 0.25, summary.CacheHitRates["results"])
+	require.Len(t, summary.Slowest, 4)
+
+	for severity := advisor.SeverityCritical; severity >= advisor.SeverityInfo; severity-- {
+		require.Equal(t, findings[severity], summary.Findings[severity.String()], severity.String())
+	}
+
+	for index := 1; index < len(summary.Slowest); index++ {
+		require.GreaterOrEqual(t, summary.Slowest[index-1].duration, summary.Slowest[index].duration)
+	}
+
+	output, err := json.Marshal(summary)
+	require.NoError(t, err)
+	require.Contains(t, string(output), `"domains":4`)
+
+	table := summary.Table()
+	require.Contains(t, table, "SMTP probes")
+	require.Contains(t, table, "failing.example.org")
+
+	t.Run("NotAdvised", func(t *testing.T) {
+		require.Nil(t, newRunRecorder().summary(registry, nil, false).Findings)
+	})
+
+	t.Run("Slowest", func(t *testing.T) {
+		recorder := newRunRecorder()
+
+		for index := range 2 * runSlowest {
+			recorder.observe(&scanner.Result{Domain: "example.com", Duration: time.Duration(index) * time.Millisecond}, nil)
+		}
+
+		summary := recorder.summary(registry, nil, false)
+		require.Len(t, summary.Slowest, runSlowest)
+		require.Equal(t, "19ms", summary.Slowest[0].Duration)
+		require.Equal(t, "10ms", summary.Slowest[runSlowest-1].Duration)
+	})
+}
+
+func TestValidateSummaryFormat(t *testing.T) {
+	for _, format := range []string{"", "json", "Table"} {
+		require.NoError(t, validateSummaryFormat(format))
+	}
+
+	require.Error(t, validateSummaryFormat("csv"))
+}
@@ -2,50 +2,210 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"fmt"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/metrics"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/objectstore"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	cmd.AddCommand(cmdScan)
+
+	cmdScan.Flags().BoolVar(&assumeParked, "assumeParked", false, "Treat every domain as parked, and only check for the records that lock it down")
+	cmdScan.Flags().StringVar(&checkpointFile, "checkpoint", "", "When streaming from STDIN with -, record results to this file and skip domains it already holds")
+	cmdScan.Flags().BoolVar(&explain, "explain", false, "Explain each line of advice with the evidence behind it: the rule that classified it, the record fragments and DNS answers it's about, and the limits compared against")
+	cmdScan.Flags().StringVar(&failOn, "failOn", "", "Exit with code 2 if any finding meets this severity (critical, high, medium, low)")
+	cmdScan.Flags().BoolVar(&interactive, "interactive", false, "Explore a single domain's result in a terminal UI, falling back to the usual output if STDOUT isn't a terminal")
+	cmdScan.Flags().StringSliceVar(&fields, "fields", nil, "Only output the specified fields, as dot-separated paths (e.g. scanResult.dmarc,advice.dmarc)")
+	cmdScan.Flags().StringVar(&metricsListen, "metricsListen", "", "Serve Prometheus metrics at /metrics on this address (e.g. :9090) until the scan completes")
+	cmdScan.Flags().StringVar(&minSeverity, "minSeverity", "", "Hide advice below this severity (critical, high, medium, low, info)")
+	cmdScan.Flags().BoolVar(&ordered, "ordered", false, "When streaming from STDIN with -, print results in input order rather than as they complete")
+	cmdScan.Flags().StringVar(&outputURL, "output", "", "When streaming from STDIN with -, upload results as NDJSON parts to an s3://bucket/prefix/ or gs://bucket/prefix/ URL, falling back to --outputFile if the uploads fail")
+	cmdScan.Flags().StringVar(&previousFile, "previous", "", "Compare findings with a previous scan's JSON output (or --checkpoint file), marking each as new, persisting or resolved")
+	cmdScan.Flags().BoolVar(&rescanErrors, "rescanErrors", false, "Rescan domains that failed in a previous run, rather than skipping them (requires --checkpoint)")
+	cmdScan.Flags().IntVar(&schemaVersion, "schemaVersion", model.SchemaVersion, "Reshape results to an earlier schema version, for consumers that haven't been updated")
+	cmdScan.Flags().BoolVar(&showAll, "showAll", false, "Show advice below --minSeverity, dimmed when printed to a terminal")
+	cmdScan.Flags().StringVar(&summaryFormat, "summary", "", "Print a summary of the run (domains, errors, DNS queries, SMTP probes, cache hit rates, findings and the slowest domains) to STDERR once it completes, as a table or json")
+	cmdScan.Flags().StringVar(&summaryFile, "summaryFile", "", "Write the summary of the run to this file rather than STDERR, as JSON unless --summary is table")
+	cmdScan.Flags().BoolVar(&showTimings, "timings", false, "Include the duration of each lookup and check in the output")
+}
+
+type operationTiming struct {
+	domain    string
+	operation string
+	duration  time.Duration
 }
 
+var (
+	assumeParked   bool
+	checkpointFile string
+	explain        bool
+	fields         []string
+	interactive    bool
+	metricsListen  string
+	ordered        bool
+	outputURL      string
+	previousFile   string
+	rescanErrors   bool
+	schemaVersion  int
+	showTimings    bool
+
+	// scanTimings collects every operation's timing when --timings is set, so the slowest can be reported after a
+	// bulk run.
+	scanTimings []operationTiming
+
+	// previousResults holds the result of each domain in --previous, which
+	// its new result's findings are compared with.
+	previousResults map[string]*model.ScanResult
+
+	// provenance identifies the scanner and configuration that produced the run's results.
+	provenance *model.Provenance
+
+	// explainThresholds are the limits cited by --explain, as configured for the run.
+	explainThresholds map[string]map[string]string
+)
+
 var cmdScan = &cobra.Command{
 	Use:     "scan [flags] <STDIN>",
-	Example: "  dss scan <STDIN>\n  dss scan globalcyberalliance.org gcaaide.org google.com\n  dss scan -z < zonefile",
+	Example: "  dss scan <STDIN>\n  dss scan globalcyberalliance.org gcaaide.org google.com\n  dss scan -z < zonefile\n  cat domains.txt | dss scan -",
 	Short:   "Scan DNS records for one or multiple domains.",
-	Long:    "Scan DNS records for one or multiple domains.\nBy default, the command will listen on STDIN, allowing you to type or pipe multiple domains.",
+	Long:    "Scan DNS records for one or multiple domains.\nBy default, the command will listen on STDIN, allowing you to type or pipe multiple domains.\nWith -, domains are read from STDIN and scanned concurrently, streaming the results as NDJSON.",
 	Run: func(command *cobra.Command, args []string) {
-		opts := []scanner.Option{
-			scanner.WithCacheDuration(cache),
-			scanner.WithConcurrentScans(concurrent),
-			scanner.WithDNSBuffer(dnsBuffer),
-			scanner.WithDNSProtocol(dnsProtocol),
-			scanner.WithNameservers(nameservers),
+		if err := model.ValidateFields(reflect.TypeOf(model.ScanResult{}), fields); err != nil {
+			log.Fatal().Err(err).Msg("Invalid --fields value.")
+		}
+
+		if _, err := model.Schema(schemaVersion); err != nil {
+			log.Fatal().Err(err).Msg("Invalid --schemaVersion value.")
+		}
+
+		var err error
+
+		thresholds, err = newFindingThresholds(failOn, minSeverity, showAll)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid severity threshold.")
+		}
+
+		if (failOn != "" || minSeverity != "") && !advise {
+			log.Fatal().Msg("--failOn and --minSeverity require --advise.")
+		}
+
+		if explain && !advise {
+			log.Fatal().Msg("--explain requires --advise.")
+		}
+
+		if err = validateSummaryFormat(summaryFormat); err != nil {
+			log.Fatal().Err(err).Msg("Invalid --summary value.")
+		}
+
+		if interactive && (len(args) != 1 || args[0] == "-" || zoneFile) {
+			log.Fatal().Msg("--interactive requires a single domain.")
+		}
+
+		if rescanErrors && checkpointFile == "" {
+			log.Fatal().Msg("--rescanErrors requires --checkpoint.")
+		}
+
+		if outputURL != "" {
+			if len(args) != 1 || args[0] != "-" || zoneFile {
+				log.Fatal().Msg("--output requires reading from STDIN with -.")
+			}
+
+			if format == "csv" {
+				log.Fatal().Msg("--output only writes NDJSON, so it can't be used with --format csv.")
+			}
+
+			if _, _, _, err = objectstore.ParseURL(outputURL); err != nil {
+				log.Fatal().Err(err).Msg("Invalid --output value.")
+			}
+		}
+
+		if previousFile != "" {
+			if !advise {
+				log.Fatal().Msg("--previous requires --advise.")
+			}
+
+			if previousResults, err = loadPreviousResults(previousFile); err != nil {
+				log.Fatal().Err(err).Msg("Invalid --previous value.")
+			}
+		}
+
+		opts := scannerOptions()
+
+		auditLog, auditScannerOpts, auditAdvisorOpts := openAuditLog()
+		if auditLog != nil {
+			defer auditLog.Close()
+		}
+
+		// every probe's result is kept for the run, so mail servers shared by many domains are only probed once
+		advisorOpts := append(auditAdvisorOpts, advisor.WithProbeReuse(true))
+
+		if metricsListen != "" || summaryFormat != "" || summaryFile != "" {
+			scanMetrics = metrics.New()
+
+			// the DNS queries and SMTP probes are counted for the metrics and the summary
+			opts = append(opts, scanner.WithResolverMiddleware(scanMetrics.Resolver))
+			advisorOpts = append(advisorOpts, advisor.WithDialerMiddleware(scanMetrics.Dialer))
 		}
 
-		if len(dkimSelector) > 0 {
-			opts = append(opts, scanner.WithDKIMSelectors(dkimSelector...))
+		if summaryFormat != "" || summaryFile != "" {
+			runStats = newRunRecorder()
 		}
 
-		sc, err := scanner.New(log, timeout, opts...)
+		sc, err := scanner.New(log, timeout, append(opts, auditScannerOpts...)...)
 		if err != nil {
 			log.Fatal().Err(err).Msg("An unexpected error occurred.")
 		}
 
-		domainAdvisor := advisor.NewAdvisor(timeout, cache, checkTLS)
+		domainAdvisor := newAdvisor(advisorOpts...)
+
+		// the advisor's configuration only affects the results if they're advised
+		if advise {
+			provenance = model.NewProvenance(sc, domainAdvisor)
+			explainThresholds = model.ExplainThresholds(sc, domainAdvisor)
+		} else {
+			provenance = model.NewProvenance(sc, nil)
+		}
+
+		stopMetrics := func() {}
+		if metricsListen != "" {
+			stopMetrics = serveMetrics(metricsListen)
+		}
 
 		if format == "csv" && outputFile == "" {
-			log.Info().Msg("CSV header: domain,BIMI,DKIM,DMARC,MX,SPF,TXT,error,advice")
+			if len(fields) > 0 {
+				log.Info().Msg("CSV header: " + strings.Join(fields, ","))
+			} else {
+				log.Info().Msg("CSV header: " + strings.Join(model.CSVHeader(), ","))
+			}
 		}
 
 		var results []*scanner.Result
 
-		if len(args) == 0 && zoneFile {
+		if interactive && (!isTerminal(os.Stdin) || !isTerminal(os.Stdout)) {
+			log.Info().Msg("STDIN or STDOUT isn't a terminal, so the result is printed instead of explored.")
+			interactive = false
+		}
+
+		if interactive {
+			if domains := validDomains(args...); len(domains) > 0 {
+				exploreDomain(sc, domainAdvisor, domains[0])
+			}
+		} else if len(args) == 1 && args[0] == "-" && !zoneFile {
+			streamFromStdin(sc, domainAdvisor)
+		} else if ordered || checkpointFile != "" {
+			log.Fatal().Msg("--ordered and --checkpoint require reading from STDIN with -.")
+		} else if len(args) == 0 && zoneFile {
 			results, err = sc.ScanZone(os.Stdin)
 			if err != nil {
 				log.Fatal().Err(err).Msg("An unexpected error occurred.")
@@ -58,8 +218,12 @@ var cmdScan = &cobra.Command{
 			scanner := bufio.NewScanner(os.Stdin)
 
 			for scanner.Scan() {
-				domain := scanner.Text()
-				results, err = sc.Scan(domain)
+				domains := validDomains(scanner.Text())
+				if len(domains) == 0 {
+					continue
+				}
+
+				results, err = sc.Scan(domains...)
 				if err != nil {
 					log.Fatal().Err(err).Msg("An unexpected error occurred.")
 				}
@@ -72,8 +236,8 @@ var cmdScan = &cobra.Command{
 			if err = scanner.Err(); err != nil {
 				log.Fatal().Err(err).Msg("An error occurred while reading from stdin.")
 			}
-		} else {
-			results, err = sc.Scan(args...)
+		} else if domains := validDomains(args...); len(domains) > 0 {
+			results, err = sc.Scan(domains...)
 			if err != nil {
 				log.Fatal().Err(err).Msg("An unexpected error occurred.")
 			}
@@ -86,21 +250,149 @@ var cmdScan = &cobra.Command{
 		for _, result := range results {
 			printResult(result, domainAdvisor)
 		}
+
+		printSlowestOperations(3)
+		stopMetrics()
+		writeRunSummary(scanMetrics, sc, domainAdvisor)
+
+		if failOn != "" || minSeverity != "" {
+			thresholds.logSummary()
+		}
+
+		if thresholds.failed() {
+			os.Exit(exitFindings)
+		}
 	},
 }
 
+// validDomains returns the domains that pass validation, printing the reason
+// for each rejected domain to stderr. Blank lines are skipped silently.
+func validDomains(domains ...string) []string {
+	valid := make([]string, 0, len(domains))
+
+	for _, domain := range domains {
+		if strings.TrimSpace(domain) == "" {
+			continue
+		}
+
+		if err := scanner.ValidateDomain(domain); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			continue
+		}
+
+		valid = append(valid, domain)
+	}
+
+	return valid
+}
+
 func printResult(result *scanner.Result, domainAdvisor *advisor.Advisor) {
+	printOutput(resultOutput(result, adviseResult(result, domainAdvisor)))
+}
+
+// adviseResult returns the advice for a scan result, or nil if --advise isn't
+// set (or the domain is invalid).
+func adviseResult(result *scanner.Result, domainAdvisor *advisor.Advisor) *advisor.Advice {
+	if result == nil || !advise || result.Error == scanner.ErrInvalidDomain {
+		return nil
+	}
+
+	return model.Advise(context.Background(), domainAdvisor, result, assumeParked)
+}
+
+// resultOutput returns the data to print for a scan result and its advice,
+// along with the advice lines to dim. It isn't safe to call concurrently, as
+// it records the findings and timings of each result.
+func resultOutput(result *scanner.Result, advice *advisor.Advice) (interface{}, []string) {
 	if result == nil {
 		log.Fatal().Msg("An unexpected error occurred.")
 	}
 
-	resultWithAdvice := model.ScanResultWithAdvice{
-		ScanResult: result,
+	if scanMetrics != nil {
+		scanMetrics.Observe(result, advice)
+	}
+
+	if runStats != nil {
+		runStats.observe(result, advice)
+	}
+
+	var dimmed []string
+
+	if advice != nil {
+		advice, dimmed = thresholds.apply(advice)
+	}
+
+	resultWithAdvice := model.NewScanResult(result, advice, detailed)
+	resultWithAdvice.Scanner = provenance
+	resultWithAdvice.Annotate(previousResults[resultWithAdvice.Domain])
+
+	if explain {
+		resultWithAdvice.Explain(explainThresholds)
+	}
+
+	if showTimings {
+		if !detailed {
+			resultWithAdvice.AttachTimings()
+		}
+
+		for operation, duration := range resultWithAdvice.Timings {
+			parsedDuration, err := time.ParseDuration(duration)
+			if err != nil {
+				continue
+			}
+
+			scanTimings = append(scanTimings, operationTiming{domain: result.Domain, operation: operation, duration: parsedDuration})
+		}
+	}
+
+	// canonical output is diffed between scans, so it mustn't change unless the result does
+	if strings.EqualFold(format, "json-canonical") {
+		resultWithAdvice = resultWithAdvice.Canonical()
+	}
+
+	resultWithAdvice, err := resultWithAdvice.Versioned(schemaVersion)
+	if err != nil {
+		log.Fatal().Err(err).Msg("An unexpected error occurred.")
+	}
+
+	if len(fields) > 0 {
+		selection, err := model.SelectFields(resultWithAdvice, fields)
+		if err != nil {
+			log.Fatal().Err(err).Msg("An unexpected error occurred.")
+		}
+
+		return selection, dimmed
+	}
+
+	return resultWithAdvice, dimmed
+}
+
+// printOutput prints the data, dimming the given advice lines if the output
+// supports it.
+func printOutput(data interface{}, dimmed []string) {
+	if len(dimmed) > 0 && dimOutput() {
+		fmt.Print(string(dimLines(marshal(data), dimmed)))
+		return
 	}
 
-	if advise && result.Error != scanner.ErrInvalidDomain {
-		resultWithAdvice.Advice = domainAdvisor.CheckAll(result.Domain, result.BIMI, result.DKIM, result.DMARC, result.MX, result.SPF)
+	printToConsole(data)
+}
+
+// printSlowestOperations logs the n slowest operations recorded during a bulk run.
+func printSlowestOperations(n int) {
+	if !showTimings || len(scanTimings) == 0 {
+		return
 	}
 
-	printToConsole(resultWithAdvice)
+	sort.Slice(scanTimings, func(i, j int) bool {
+		return scanTimings[i].duration > scanTimings[j].duration
+	})
+
+	if len(scanTimings) < n {
+		n = len(scanTimings)
+	}
+
+	for _, timing := range scanTimings[:n] {
+		log.Info().Str("domain", timing.domain).Str("operation", timing.operation).Str("duration", timing.duration.String()).Msg("slow operation")
+	}
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// shuffledResolver answers from a fixture zone, shuffling the order of every
+// answer, and fails the queries of the names in failing.
+type shuffledResolver struct {
+	records map[string][]dns.RR
+	failing map[string]struct{}
+}
+
+func (r *shuffledResolver) Exchange(msg *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	question := msg.Question[0]
+
+	reply := new(dns.Msg)
+	reply.SetReply(msg)
+
+	if _, ok := r.failing[question.Name]; ok {
+		reply.Rcode = dns.RcodeServerFailure
+		return reply, 0, nil
+	}
+
+	for _, record := range r.records[question.Name] {
+		if record.Header().Rrtype == question.Qtype {
+			reply.Answer = append(reply.Answer, dns.Copy(record))
+		}
+	}
+
+	rand.Shuffle(len(reply.Answer), func(i, j int) {
+		reply.Answer[i], reply.Answer[j] = reply.Answer[j], reply.Answer[i]
+	})
+
+	return reply, 0, nil
+}
+
+func TestCanonicalOutput(t *testing.T) {
+	previousFormat, previousDetailed, previousThresholds := format, detailed, thresholds
+	t.Cleanup(func() { format, detailed, thresholds = previousFormat, previousDetailed, previousThresholds })
+
+	var err error
+	format, detailed = "json-canonical", true
+	thresholds, err = newFindingThresholds("", "", false)
+	require.NoError(t, err)
+
+	zone := `
+example.com. 300 IN NS ns2.example.com.
+example.com. 300 IN NS ns1.example.com.
+example.com. 300 IN NS ns3.example.com.
+example.com. 300 IN A 192.0.2.10
+example.com. 300 IN A 192.0.2.9
+example.com. 300 IN A 192.0.2.1
+example.com. 300 IN AAAA 2001:db8::2
+example.com. 300 IN AAAA 2001:db8::1
+example.com. 300 IN MX 20 b.mx.example.com.
+example.com. 300 IN MX 10 mx2.example.com.
+example.com. 300 IN MX 20 a.mx.example.com.
+example.com. 300 IN MX 10 mx1.example.com.
+example.com. 300 IN CAA 0 issue "pki.goog"
+example.com. 300 IN CAA 0 issue "letsencrypt.org"
+example.com. 300 IN TXT "v=spf1 include:_spf.google.com ~all"
+example.com. 300 IN TXT "google-site-verification=abc123"
+example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024061501 7200 3600 1209600 300
+_dmarc.example.com. 300 IN TXT "v=DMARC1; p=quarantine; rua=mailto:dmarc@example.com"
+`
+
+	resolver := &shuffledResolver{
+		records: make(map[string][]dns.RR),
+		// the lookups fail concurrently, in any order
+		failing: map[string]struct{}{"default._bimi.example.com.": {}, "arc._domainkey.example.com.": {}},
+	}
+
+	parser := dns.NewZoneParser(strings.NewReader(zone), "", "")
+	for record, ok := parser.Next(); ok; record, ok = parser.Next() {
+		resolver.records[record.Header().Name] = append(resolver.records[record.Header().Name], record)
+	}
+	require.NoError(t, parser.Err())
+
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+	t.Cleanup(domainAdvisor.Close)
+
+	scan := func() string {
+		// a new scanner each time, so nothing is cached
+		sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver {
+			return resolver
+		}))
+		require.NoError(t, err)
+		defer sc.Close()
+
+		results, err := sc.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+
+		data, _ := resultOutput(results[0], model.Advise(context.Background(), domainAdvisor, results[0], false))
+
+		return string(marshal(data))
+	}
+
+	first := scan()
+
+	for range 10 {
+		require.Equal(t, first, scan())
+	}
+
+	require.NotContains(t, first, "scannedAt")
+	require.NotContains(t, first, "timings")
+	require.Contains(t, first, `"mx": [
+			"mx1.example.com.",
+			"mx2.example.com.",
+			"a.mx.example.com.",
+			"b.mx.example.com."
+		]`)
+	require.True(t, strings.HasSuffix(first, "}\n"))
+}
@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/http"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/mail"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/metrics"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 func init() {
@@ -15,7 +26,18 @@ func init() {
 	cmdServe.AddCommand(cmdServeAPI)
 	cmdServe.AddCommand(cmdServeMail)
 
+	cmdServeAPI.Flags().StringVar(&apiKeyFile, "apiKeyFile", "", "Require an API key, read from this YAML file of keys and their tenants")
+	cmdServeAPI.Flags().DurationVar(&drainTimeout, "drainTimeout", 30*time.Second, "How long to allow in-flight requests to complete when shutting down")
+	cmdServeAPI.Flags().Int64Var(&maxBodySize, "maxBodySize", http.DefaultMaxBodySize, "Reject request bodies larger than this many bytes with a 413 (0 is unlimited)")
+	cmdServeAPI.Flags().IntVar(&maxDomains, "maxDomains", http.DefaultMaxDomains, "Limit the number of domains a single bulk scan request may contain (0 is unlimited)")
+	cmdServeAPI.Flags().IntVar(&maxScheduledScans, "maxScheduledScans", 2, "Limit the number of domains scanned at once by scheduled scans")
 	cmdServeAPI.Flags().IntVarP(&port, "port", "p", 8080, "Specify the port for the API to listen on")
+	cmdServeAPI.Flags().StringVar(&scheduleFile, "scheduleFile", "", "Enable scheduled scans, persisting the schedules and their latest results to this file")
+	cmdServeAPI.Flags().StringVar(&scheduleOutput, "scheduleOutput", "", "Upload the results of each scheduled run as NDJSON parts to an s3://bucket/prefix/ or gs://bucket/prefix/ URL, under <tenant>/<schedule ID>/<completion time>/")
+	cmdServeAPI.Flags().StringSliceVar(&scheduleWebhooks, "scheduleWebhook", nil, "POST each change found by a scheduled scan to these URLs, as JSON")
+	cmdServeAPI.Flags().BoolVar(&tamperAlerts, "tamperAlerts", false, "POST a critical alert to --scheduleWebhook URLs as soon as a scheduled scan finds weakened DMARC, SPF or DKIM records, separately from the change")
+	cmdServeAPI.Flags().StringVar(&webhookSecretFile, "webhookSecretFile", "", "Sign each tenant's --scheduleWebhook deliveries with its secret, read from this YAML file of tenants and their secrets")
+	cmdServeAPI.Flags().BoolVar(&ui, "ui", false, "Serve a web page at / for scanning a domain and viewing its advice")
 
 	cmdServeMail.Flags().StringVar(&mailConfig.Inbound.Host, "inboundHost", "", "Incoming mail host and port")
 	cmdServeMail.Flags().StringVar(&mailConfig.Inbound.Pass, "inboundPass", "", "Incoming mail password")
@@ -31,9 +53,20 @@ func init() {
 }
 
 var (
-	interval   time.Duration
-	port       int
-	mailConfig mail.Config
+	apiKeyFile        string
+	drainTimeout      time.Duration
+	interval          time.Duration
+	maxBodySize       int64
+	maxDomains        int
+	maxScheduledScans int
+	port              int
+	scheduleFile      string
+	scheduleOutput    string
+	scheduleWebhooks  []string
+	tamperAlerts      bool
+	ui                bool
+	webhookSecretFile string
+	mailConfig        mail.Config
 
 	cmdServe = &cobra.Command{
 		Use:   "serve",
@@ -47,31 +80,71 @@ var (
 		Use:   "api",
 		Short: "Serve DNS security queries via a dedicated API",
 		Run: func(command *cobra.Command, args []string) {
-			opts := []scanner.Option{
-				scanner.WithCacheDuration(cache),
-				scanner.WithConcurrentScans(concurrent),
-				scanner.WithDNSBuffer(dnsBuffer),
-				scanner.WithDNSProtocol(dnsProtocol),
-				scanner.WithNameservers(nameservers),
-			}
+			logEffectiveConfig(command)
+
+			opts := scannerOptions()
 
-			if len(dkimSelector) > 0 {
-				opts = append(opts, scanner.WithDKIMSelectors(dkimSelector...))
+			auditLog, auditScannerOpts, auditAdvisorOpts := openAuditLog()
+			if auditLog != nil {
+				defer auditLog.Close()
 			}
 
-			sc, err := scanner.New(log, timeout, opts...)
+			// the DNS queries and SMTP probes are counted for /metrics
+			registry := metrics.New()
+			opts = append(opts, scanner.WithResolverMiddleware(registry.Resolver))
+
+			sc, err := scanner.New(log, timeout, append(opts, auditScannerOpts...)...)
 			if err != nil {
 				log.Fatal().Err(err).Msg("could not create domain scanner")
 			}
 
 			server := http.NewServer(log, timeout, cmd.Version)
+			server.Metrics = registry
 			if advise {
-				server.Advisor = advisor.NewAdvisor(timeout, cache, checkTLS)
+				// bound each check so a single hung probe can't hold up the whole response
+				server.Advisor = newAdvisor(append(auditAdvisorOpts, advisor.WithCheckTimeout(3*timeout), advisor.WithDialerMiddleware(registry.Dialer))...)
 			}
 			server.CheckTLS = checkTLS
+			server.DataFiles = dataFiles()
+			server.DrainTimeout = drainTimeout
+			server.MaxBodySize = maxBodySize
+			server.MaxDomains = maxDomains
 			server.Scanner = sc
+			server.UI = ui
+
+			if apiKeyFile != "" {
+				if server.APIKeys, err = loadAPIKeys(apiKeyFile); err != nil {
+					log.Fatal().Err(err).Msg("could not load API keys")
+				}
+			}
 
-			server.Serve(port)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			go reloadOnHangup(ctx)
+
+			var scheduled sync.WaitGroup
+			if scheduleFile != "" {
+				if len(scheduleWebhooks) > 0 {
+					server.Deliveries = schedule.NewDeliveryLog(schedule.DefaultDeliveryLimit)
+				}
+
+				server.Scheduler = newScheduler(sc, server.Advisor, server.Deliveries)
+
+				scheduled.Add(1)
+				go func() {
+					defer scheduled.Done()
+					server.Scheduler.Run(ctx)
+				}()
+			}
+
+			if err = server.Serve(ctx, port); err != nil {
+				log.Fatal().Err(err).Msg("an error occurred while hosting the api server")
+			}
+
+			scheduled.Wait()
+			sc.Close()
+			log.Info().Msg("api server stopped")
 		},
 	}
 
@@ -79,31 +152,200 @@ var (
 		Use:   "mail",
 		Short: "Serve DNS security queries via a dedicated email account",
 		Run: func(command *cobra.Command, args []string) {
-			opts := []scanner.Option{
-				scanner.WithCacheDuration(cache),
-				scanner.WithConcurrentScans(concurrent),
-				scanner.WithDNSBuffer(dnsBuffer),
-				scanner.WithDNSProtocol(dnsProtocol),
-				scanner.WithNameservers(nameservers),
-			}
+			logEffectiveConfig(command)
+
+			opts := scannerOptions()
 
-			if len(dkimSelector) > 0 {
-				opts = append(opts, scanner.WithDKIMSelectors(dkimSelector...))
+			auditLog, auditScannerOpts, auditAdvisorOpts := openAuditLog()
+			if auditLog != nil {
+				defer auditLog.Close()
 			}
 
-			sc, err := scanner.New(log, timeout, opts...)
+			sc, err := scanner.New(log, timeout, append(opts, auditScannerOpts...)...)
 			if err != nil {
 				log.Fatal().Err(err).Msg("could not create domain scanner")
 			}
 
-			mailServer, err := mail.NewMailServer(mailConfig, log, sc, advisor.NewAdvisor(timeout, cache, checkTLS))
+			mailServer, err := mail.NewMailServer(mailConfig, log, sc, newAdvisor(auditAdvisorOpts...))
 			if err != nil {
 				log.Fatal().Err(err).Msg("could not open mail server connection")
 			}
 
 			mailServer.CheckTLS = checkTLS
 
+			go reloadOnHangup(context.Background())
+
 			mailServer.Serve(interval)
 		},
 	}
 )
+
+// reloadOnHangup reloads the data files whenever the process receives SIGHUP,
+// until ctx is done. A file that fails to be read leaves the data in use in
+// place.
+func reloadOnHangup(ctx context.Context) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			summary, err := advisor.LoadData(dataFiles())
+			if err != nil {
+				log.Error().Err(err).Msg("failed to reload the data files, keeping the data in use")
+				continue
+			}
+
+			log.Info().Int("consumerDomains", summary.ConsumerDomains).Int("providers", summary.Providers).Int("catalogEntries", summary.CatalogEntries).Str("adviceCatalog", summary.CatalogVersion).Msg("reloaded the data files")
+		}
+	}
+}
+
+// loadAPIKeys reads a YAML list of API keys, each with the tenant it belongs
+// to (and optionally whether it's an admin key).
+func loadAPIKeys(path string) ([]http.APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key file: %w", err)
+	}
+
+	var keys []http.APIKey
+	if err = yaml.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API key file %s: %w", path, err)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("API key file %s has no keys", path)
+	}
+
+	seen := make(map[string]struct{}, len(keys))
+
+	for index, key := range keys {
+		if key.Key == "" || key.Tenant == "" {
+			return nil, fmt.Errorf("API key %d in %s must have both a key and a tenant", index+1, path)
+		}
+
+		if _, ok := seen[key.Key]; ok {
+			return nil, fmt.Errorf("API key %d in %s is a duplicate", index+1, path)
+		}
+
+		seen[key.Key] = struct{}{}
+	}
+
+	return keys, nil
+}
+
+// loadWebhookSecrets reads a YAML map of tenants to the secret their webhook
+// deliveries are signed with.
+func loadWebhookSecrets(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook secret file: %w", err)
+	}
+
+	var secrets map[string]string
+	if err = yaml.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook secret file %s: %w", path, err)
+	}
+
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("webhook secret file %s has no secrets", path)
+	}
+
+	for tenant, secret := range secrets {
+		if secret == "" {
+			return nil, fmt.Errorf("tenant %s in %s has an empty webhook secret", tenant, path)
+		}
+	}
+
+	return secrets, nil
+}
+
+// newScheduler opens the schedule store, and returns a scheduler that scans
+// each domain with the scanner (advising on the result if domainAdvisor isn't
+// nil), logging its webhooks' deliveries in deliveries (if it isn't nil), and
+// uploading each run's results to --scheduleOutput (if it's set).
+func newScheduler(sc *scanner.Scanner, domainAdvisor *advisor.Advisor, deliveries *schedule.DeliveryLog) *schedule.Scheduler {
+	store, err := schedule.OpenStore(scheduleFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not open schedule store")
+	}
+
+	scan := func(ctx context.Context, domain string) (*model.ScanResult, error) {
+		results, err := sc.Scan(domain)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(results) != 1 {
+			return nil, fmt.Errorf("expected 1 result, got %d", len(results))
+		}
+
+		var advice *advisor.Advice
+		if domainAdvisor != nil {
+			advice = model.Advise(ctx, domainAdvisor, results[0], false)
+		}
+
+		result := model.NewScanResult(results[0], advice, false)
+		result.Scanner = model.NewProvenance(sc, domainAdvisor)
+
+		return &result, nil
+	}
+
+	var webhookOpts []schedule.WebhookOption
+	if deliveries != nil {
+		webhookOpts = append(webhookOpts, schedule.WithDeliveryLog(deliveries))
+	}
+
+	if webhookSecretFile != "" {
+		secrets, err := loadWebhookSecrets(webhookSecretFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load webhook secrets")
+		}
+
+		webhookOpts = append(webhookOpts, schedule.WithSigningSecrets(secrets))
+	}
+
+	opts := []schedule.Option{schedule.WithMaxConcurrentScans(maxScheduledScans)}
+	for _, url := range scheduleWebhooks {
+		opts = append(opts, schedule.WithNotifiers(schedule.NewWebhook(url, timeout, webhookOpts...)))
+	}
+
+	if tamperAlerts {
+		opts = append(opts, schedule.WithTamperAlerts())
+	}
+
+	if scheduleOutput != "" {
+		bucket, prefix, err := openBucket(context.Background(), scheduleOutput)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not open schedule output bucket")
+		}
+
+		opts = append(opts, schedule.WithResultExporter(&scheduleExporter{bucket: bucket, prefix: prefix}))
+	}
+
+	return schedule.New(log, store, scan, opts...)
+}
+
+// logEffectiveConfig logs the command's configuration, excluding secrets, so
+// deployments can confirm which values took effect.
+func logEffectiveConfig(command *cobra.Command) {
+	values := effectiveConfig(command)
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	event := log.Info()
+	for _, name := range names {
+		event = event.Str(name, values[name])
+	}
+
+	event.Msg("effective configuration")
+}
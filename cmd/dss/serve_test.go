@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/http"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAPIKeys(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "keys.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		return path
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		keys, err := loadAPIKeys(write(t, "- key: acme-key\n  tenant: acme\n- key: ops-key\n  tenant: ops\n  admin: true\n"))
+		require.NoError(t, err)
+		require.Equal(t, []http.APIKey{
+			{Key: "acme-key", Tenant: "acme"},
+			{Key: "ops-key", Tenant: "ops", Admin: true},
+		}, keys)
+	})
+
+	t.Run("MissingTenant", func(t *testing.T) {
+		_, err := loadAPIKeys(write(t, "- key: acme-key\n"))
+		require.ErrorContains(t, err, "must have both a key and a tenant")
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		_, err := loadAPIKeys(write(t, "- key: acme-key\n  tenant: acme\n- key: acme-key\n  tenant: globex\n"))
+		require.ErrorContains(t, err, "is a duplicate")
+	})
+}
+
+func TestLoadWebhookSecrets(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "secrets.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		return path
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		secrets, err := loadWebhookSecrets(write(t, "acme: acme-secret\nglobex: globex-secret\n"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"acme": "acme-secret", "globex": "globex-secret"}, secrets)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		_, err := loadWebhookSecrets(write(t, ""))
+		require.ErrorContains(t, err, "has no secrets")
+	})
+
+	t.Run("EmptySecret", func(t *testing.T) {
+		_, err := loadWebhookSecrets(write(t, "acme: \"\"\n"))
+		require.ErrorContains(t, err, "empty webhook secret")
+	})
+}
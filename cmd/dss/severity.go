@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"gopkg.in/yaml.v3"
+)
+
+// exitFindings is the exit code used when a finding meets the --failOn
+// threshold, distinguishing it from other errors.
+const exitFindings = 2
+
+// findingThresholds holds the parsed --failOn and --minSeverity flags, along
+// with the findings seen across every scanned domain.
+type findingThresholds struct {
+	failOn      advisor.Severity
+	failEnabled bool
+	minimum     advisor.Severity
+	showAll     bool
+
+	counts map[advisor.Severity]int
+	worst  advisor.Severity
+}
+
+var (
+	failOn, minSeverity string
+	showAll             bool
+
+	thresholds *findingThresholds
+)
+
+// newFindingThresholds parses the severity flags.
+func newFindingThresholds(failOn, minSeverity string, showAll bool) (*findingThresholds, error) {
+	result := &findingThresholds{counts: make(map[advisor.Severity]int), showAll: showAll}
+
+	if failOn != "" {
+		severity, err := advisor.ParseSeverity(failOn)
+		if err != nil {
+			return nil, err
+		}
+
+		result.failOn = severity
+		result.failEnabled = true
+	}
+
+	if minSeverity != "" {
+		severity, err := advisor.ParseSeverity(minSeverity)
+		if err != nil {
+			return nil, err
+		}
+
+		result.minimum = severity
+	}
+
+	return result, nil
+}
+
+// apply records the advice's findings, then returns the advice to output and
+// the lines that should be dimmed. Findings below the minimum severity are
+// removed, unless every finding should be shown.
+func (f *findingThresholds) apply(advice *advisor.Advice) (*advisor.Advice, []string) {
+	var dimmed []string
+
+	for _, finding := range advice.Findings() {
+		f.counts[finding.Severity]++
+
+		if finding.Severity > f.worst {
+			f.worst = finding.Severity
+		}
+
+		if finding.Severity < f.minimum {
+			dimmed = append(dimmed, finding.Message)
+		}
+	}
+
+	if !f.showAll {
+		return advice.Filter(f.minimum), nil
+	}
+
+	return advice, dimmed
+}
+
+// failed reports whether any finding met the --failOn threshold.
+func (f *findingThresholds) failed() bool {
+	return f.failEnabled && f.total() > 0 && f.worst >= f.failOn
+}
+
+// logSummary logs the number of findings of each severity.
+func (f *findingThresholds) logSummary() {
+	event := log.Info()
+
+	for severity := advisor.SeverityCritical; severity >= advisor.SeverityInfo; severity-- {
+		event = event.Int(severity.String(), f.counts[severity])
+	}
+
+	event.Msg("findings summary")
+}
+
+func (f *findingThresholds) total() (total int) {
+	for _, count := range f.counts {
+		total += count
+	}
+
+	return total
+}
+
+// dimLines wraps each line of YAML output holding one of the given messages
+// in the terminal's faint style.
+func dimLines(output []byte, messages []string) []byte {
+	if len(messages) == 0 {
+		return output
+	}
+
+	// match lines by their YAML encoding, as long messages may be quoted
+	encoded := make(map[string]struct{}, len(messages))
+	for _, message := range messages {
+		if line, err := yaml.Marshal([]string{message}); err == nil {
+			encoded[strings.TrimSuffix(string(line), "\n")] = struct{}{}
+		}
+	}
+
+	lines := bytes.Split(output, []byte("\n"))
+	for index, line := range lines {
+		if _, ok := encoded[strings.TrimSpace(string(line))]; ok {
+			lines[index] = []byte("\x1b[2m" + string(line) + "\x1b[0m")
+		}
+	}
+
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// dimOutput reports whether output should be dimmed, which only applies to
+// YAML printed directly to a terminal.
+func dimOutput() bool {
+	if format != "yaml" || outputFile != "" {
+		return false
+	}
+
+	return isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether the file is a terminal, rather than a pipe or a
+// regular file.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
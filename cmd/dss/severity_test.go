@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func testAdvice() *advisor.Advice {
+	return advisor.NewAdvisor(time.Second, 0, false).Lint("", "", "v=DMARC1; p=none; rua=mailto:dmarc@example.com;", []string{"mx.example.com."}, "v=spf1 -all")
+}
+
+func TestFindingThresholds(t *testing.T) {
+	lowAdvice := "Consider specifying a 'ruf' tag for forensic reporting."
+
+	t.Run("Formats", func(t *testing.T) {
+		previousFormat := format
+		t.Cleanup(func() { format = previousFormat })
+
+		for _, outputFormat := range []string{"csv", "json", "jsonp", "yaml"} {
+			t.Run(outputFormat, func(t *testing.T) {
+				format = outputFormat
+
+				// hidden findings are removed from every format
+				filtering, err := newFindingThresholds("", "medium", false)
+				require.NoError(t, err)
+
+				advice, dimmed := filtering.apply(testAdvice())
+				require.Empty(t, dimmed)
+
+				output := string(marshal(model.ScanResult{ScanResult: &scanner.Result{Domain: "example.com"}, Advice: advice}))
+				require.NotContains(t, output, "forensic reporting")
+				require.Contains(t, output, "lowest level")
+
+				// --showAll keeps everything, without any terminal styling
+				showing, err := newFindingThresholds("", "medium", true)
+				require.NoError(t, err)
+
+				advice, dimmed = showing.apply(testAdvice())
+				require.Contains(t, dimmed, lowAdvice)
+
+				output = string(marshal(model.ScanResult{ScanResult: &scanner.Result{Domain: "example.com"}, Advice: advice}))
+				require.Contains(t, output, "forensic reporting")
+				require.NotContains(t, output, "\x1b[")
+			})
+		}
+	})
+
+	t.Run("DimLines", func(t *testing.T) {
+		previousFormat := format
+		t.Cleanup(func() { format = previousFormat })
+		format = "yaml"
+
+		showing, err := newFindingThresholds("", "medium", true)
+		require.NoError(t, err)
+
+		advice, dimmed := showing.apply(testAdvice())
+		output := string(dimLines(marshal(model.ScanResult{ScanResult: &scanner.Result{Domain: "example.com"}, Advice: advice}), dimmed))
+
+		for _, line := range strings.Split(output, "\n") {
+			switch {
+			case strings.Contains(line, "forensic reporting"), strings.Contains(line, "SPF seems to be setup correctly"):
+				require.True(t, strings.HasPrefix(line, "\x1b[2m"), line)
+			case strings.Contains(line, "lowest level"):
+				require.NotContains(t, line, "\x1b[")
+			}
+		}
+	})
+
+	t.Run("FailOn", func(t *testing.T) {
+		tests := map[string]bool{"critical": false, "high": false, "medium": true, "low": true}
+
+		for failOn, failed := range tests {
+			bulk, err := newFindingThresholds(failOn, "", false)
+			require.NoError(t, err)
+
+			// the worst finding across every domain counts
+			bulk.apply(&advisor.Advice{SPF: []string{"SPF seems to be setup correctly! No further action needed."}})
+			bulk.apply(testAdvice())
+
+			require.Equal(t, failed, bulk.failed(), failOn)
+			require.Equal(t, 1, bulk.counts[advisor.SeverityMedium])
+		}
+
+		noThreshold, err := newFindingThresholds("", "", false)
+		require.NoError(t, err)
+
+		noThreshold.apply(&advisor.Advice{DMARC: []string{"You do not have DMARC setup!"}})
+		require.False(t, noThreshold.failed())
+	})
+
+	t.Run("InvalidSeverity", func(t *testing.T) {
+		_, err := newFindingThresholds("severe", "", false)
+		require.Error(t, err)
+	})
+}
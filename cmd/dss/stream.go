@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/checkpoint"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/objectstore"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+)
+
+type (
+	// streamScanner scans newline-delimited domains as they're read, using a
+	// fixed number of workers. At most twice as many domains as there are
+	// workers are in flight (or waiting to be emitted) at once, so memory use
+	// stays flat regardless of the size of the input.
+	streamScanner[T any] struct {
+		// workers is the number of domains scanned concurrently.
+		workers int
+
+		// ordered emits results in input order, rather than completion order.
+		ordered bool
+
+		// countRemaining reads the rest of the input once interrupted, so the
+		// number of domains left unscanned can be reported. It must be false
+		// for interactive input, which would block.
+		countRemaining bool
+
+		// filter returns the domains to scan from a line of input.
+		filter func(line string) []string
+
+		// scan scans a single domain, and must be safe to call concurrently.
+		scan func(domain string) T
+
+		// emit receives each result, one at a time.
+		emit func(result T)
+	}
+
+	// streamJob is a domain to scan, numbered by its position in the input.
+	streamJob struct {
+		index  int
+		domain string
+	}
+
+	// streamResult is the result of a streamJob.
+	streamResult[T any] struct {
+		index int
+		value T
+	}
+
+	// streamedScan is a scan result and its advice, computed by a worker.
+	streamedScan struct {
+		result *scanner.Result
+		advice *advisor.Advice
+	}
+
+	// streamSummary counts the domains scanned by a streamScanner.
+	streamSummary struct {
+		scanned     int
+		remaining   int
+		interrupted bool
+	}
+)
+
+// run scans every domain read from the input until it's exhausted or the
+// context is cancelled. Once cancelled, no more domains are started, but those
+// already being scanned are completed and emitted.
+func (s *streamScanner[T]) run(ctx context.Context, input io.Reader) (streamSummary, error) {
+	var (
+		summary streamSummary
+		readErr error
+	)
+
+	workers := s.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	domains := make(chan string)
+	jobs := make(chan streamJob, 2*workers)
+	results := make(chan streamResult[T], 2*workers)
+	tokens := make(chan struct{}, 2*workers)
+	readDone := make(chan struct{})
+
+	// the reader may block on interactive input indefinitely, so it's never waited on unless the input is counted
+	go func() {
+		defer close(readDone)
+		defer close(domains)
+
+		lines := bufio.NewScanner(input)
+		for lines.Scan() {
+			for _, domain := range s.filter(lines.Text()) {
+				domains <- domain
+			}
+		}
+
+		readErr = lines.Err()
+	}()
+
+	go func() {
+		defer close(jobs)
+
+		for index := 0; ; index++ {
+			select {
+			case <-ctx.Done():
+				summary.interrupted = true
+				return
+			case domain, ok := <-domains:
+				if !ok {
+					return
+				}
+
+				select {
+				case tokens <- struct{}{}:
+					jobs <- streamJob{index: index, domain: domain}
+				case <-ctx.Done():
+					summary.interrupted = true
+					summary.remaining++
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				results <- streamResult[T]{index: job.index, value: s.scan(job.domain)}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// results completed out of order wait here until every earlier result has been emitted
+	pending := make(map[int]T, 2*workers)
+	next := 0
+
+	for result := range results {
+		if !s.ordered {
+			s.emit(result.value)
+			summary.scanned++
+			<-tokens
+
+			continue
+		}
+
+		pending[result.index] = result.value
+
+		for value, ok := pending[next]; ok; value, ok = pending[next] {
+			s.emit(value)
+			delete(pending, next)
+			summary.scanned++
+			next++
+			<-tokens
+		}
+	}
+
+	if summary.interrupted {
+		if !s.countRemaining {
+			return summary, nil
+		}
+
+		for range domains {
+			summary.remaining++
+		}
+	}
+
+	<-readDone
+
+	return summary, readErr
+}
+
+// streamFromStdin scans the domains piped to STDIN as they arrive, printing
+// each result as a line of NDJSON (or CSV, with --format csv). Interrupting
+// the scan prints the results already completed, and a summary of how many
+// domains were left. With --checkpoint, each result is also recorded to the
+// checkpoint, and domains it already holds are skipped.
+func streamFromStdin(sc *scanner.Scanner, domainAdvisor *advisor.Advisor) {
+	var (
+		state   *checkpoint.Checkpoint
+		skipped atomic.Int64
+		err     error
+	)
+
+	if checkpointFile != "" {
+		if state, err = checkpoint.Open(checkpointFile); err != nil {
+			log.Fatal().Err(err).Msg("unable to open checkpoint")
+		}
+		defer state.Close()
+
+		if state.Recovered() > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "Discarded an incomplete entry (%d bytes) from the end of the checkpoint.\n", state.Recovered())
+		}
+	}
+
+	if format != "csv" {
+		format = "json"
+	}
+
+	output := io.Writer(os.Stdout)
+	filename := outputFile + ".ndjson"
+
+	if format == "csv" {
+		filename = outputFile + ".csv"
+	}
+
+	// results uploaded to object storage fall back to the output file, which isn't written otherwise
+	var objects *objectstore.Writer
+
+	if outputURL != "" {
+		bucket, prefix, err := openBucket(context.Background(), outputURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open output bucket")
+		}
+
+		var fallback string
+		if outputFile != "" {
+			fallback = filename
+		}
+
+		objects = objectstore.NewWriter(bucket, prefix, objectstore.WithFallback(fallback))
+	} else if outputFile != "" {
+		file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open output file")
+		}
+		defer file.Close()
+
+		output = file
+	}
+
+	writer := bufio.NewWriter(output)
+	defer writer.Flush()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// restore the default behaviour once interrupted, so a second Ctrl-C exits immediately
+	context.AfterFunc(ctx, stop)
+
+	stream := &streamScanner[streamedScan]{
+		workers:        int(concurrent),
+		ordered:        ordered,
+		countRemaining: !isTerminal(os.Stdin),
+		filter: func(line string) []string {
+			domains := validDomains(line)
+			if state == nil {
+				return domains
+			}
+
+			remaining := domains[:0]
+
+			for _, domain := range domains {
+				if completed, failed := state.Completed(domain); completed && !(failed && rescanErrors) {
+					skipped.Add(1)
+					continue
+				}
+
+				remaining = append(remaining, domain)
+			}
+
+			return remaining
+		},
+		scan: func(domain string) streamedScan {
+			results, err := sc.Scan(domain)
+			if err != nil {
+				log.Fatal().Err(err).Msg("An unexpected error occurred.")
+			}
+
+			return streamedScan{result: results[0], advice: adviseResult(results[0], domainAdvisor)}
+		},
+		emit: func(scan streamedScan) {
+			data, _ := resultOutput(scan.result, scan.advice)
+
+			line := marshal(data)
+			if format == "json" {
+				line = append(line, '\n')
+			}
+
+			if objects != nil {
+				// uploads aren't cancelled by an interrupt, so the completed results still reach the bucket
+				if err := objects.Write(context.Background(), line, scan.result.Error != ""); err != nil {
+					log.Fatal().Err(err).Msg("failed to write output")
+				}
+			} else {
+				if _, err := writer.Write(line); err != nil {
+					log.Fatal().Err(err).Msg("failed to write output")
+				}
+
+				// flush each result, so they're streamed as they complete
+				if err := writer.Flush(); err != nil {
+					log.Fatal().Err(err).Msg("failed to write output")
+				}
+			}
+
+			if state != nil {
+				result, err := json.Marshal(data)
+				if err != nil {
+					log.Fatal().Err(err).Msg("failed to marshal checkpoint entry")
+				}
+
+				if err = state.Record(scan.result.Domain, scan.result.Error != "", result); err != nil {
+					log.Fatal().Err(err).Msg("failed to write checkpoint")
+				}
+			}
+		},
+	}
+
+	summary, err := stream.run(ctx, os.Stdin)
+	if err != nil {
+		log.Fatal().Err(err).Msg("An error occurred while reading from stdin.")
+	}
+
+	switch {
+	case objects != nil:
+		if _, err = objects.Close(context.Background()); err != nil {
+			log.Fatal().Err(err).Msg("failed to write output")
+		}
+
+		if fallback := objects.Fallback(); fallback != "" {
+			log.Warn().Msg("Uploading the output failed, so it was written to " + fallback + " instead")
+		} else {
+			log.Info().Msg("Output uploaded to " + outputURL)
+		}
+	case outputFile != "":
+		log.Info().Msg("Output written to " + filename)
+	}
+
+	if count := skipped.Load(); count > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Skipped %d domains already in the checkpoint.\n", count)
+	}
+
+	if summary.interrupted {
+		if stream.countRemaining {
+			_, _ = fmt.Fprintf(os.Stderr, "Interrupted after scanning %d domains, with %d remaining.\n", summary.scanned, summary.remaining)
+		} else {
+			_, _ = fmt.Fprintf(os.Stderr, "Interrupted after scanning %d domains.\n", summary.scanned)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lineReader generates n lines of input on demand, so large inputs don't have
+// to be held in memory.
+type lineReader struct {
+	n, line int
+	pending []byte
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if r.line >= r.n {
+			return 0, io.EOF
+		}
+
+		r.pending = []byte("domain" + strconv.Itoa(r.line) + ".example.com\n")
+		r.line++
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	return n, nil
+}
+
+func splitLine(line string) []string {
+	if line = strings.TrimSpace(line); line == "" {
+		return nil
+	}
+
+	return []string{line}
+}
+
+func TestStreamScanner(t *testing.T) {
+	input := "a.example.com\n\nb.example.com\nc.example.com\nd.example.com\ne.example.com\n"
+
+	// earlier domains take longer to scan, so they complete in reverse order
+	delays := map[string]time.Duration{"a.example.com": 40 * time.Millisecond, "b.example.com": 30 * time.Millisecond, "c.example.com": 20 * time.Millisecond, "d.example.com": 10 * time.Millisecond}
+
+	newStream := func(ordered bool, emitted *[]string) *streamScanner[string] {
+		return &streamScanner[string]{
+			workers: 5,
+			ordered: ordered,
+			filter:  splitLine,
+			scan: func(domain string) string {
+				time.Sleep(delays[domain])
+				return domain
+			},
+			emit: func(domain string) {
+				*emitted = append(*emitted, domain)
+			},
+		}
+	}
+
+	t.Run("CompletionOrder", func(t *testing.T) {
+		var emitted []string
+
+		summary, err := newStream(false, &emitted).run(context.Background(), strings.NewReader(input))
+		require.NoError(t, err)
+		require.Equal(t, streamSummary{scanned: 5}, summary)
+		require.Equal(t, "e.example.com", emitted[0])
+		require.ElementsMatch(t, []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com", "e.example.com"}, emitted)
+	})
+
+	t.Run("InputOrder", func(t *testing.T) {
+		var emitted []string
+
+		summary, err := newStream(true, &emitted).run(context.Background(), strings.NewReader(input))
+		require.NoError(t, err)
+		require.Equal(t, streamSummary{scanned: 5}, summary)
+		require.Equal(t, []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com", "e.example.com"}, emitted)
+	})
+
+	t.Run("Interrupted", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var emitted int
+
+		stream := &streamScanner[string]{
+			workers:        2,
+			countRemaining: true,
+			filter:         splitLine,
+			scan: func(domain string) string {
+				return domain
+			},
+			emit: func(string) {
+				if emitted++; emitted == 10 {
+					cancel()
+				}
+			},
+		}
+
+		summary, err := stream.run(ctx, &lineReader{n: 1000})
+		require.NoError(t, err)
+		require.True(t, summary.interrupted)
+		require.Equal(t, emitted, summary.scanned)
+		require.GreaterOrEqual(t, summary.scanned, 10)
+		require.Equal(t, 1000, summary.scanned+summary.remaining)
+	})
+
+	t.Run("BoundedInFlight", func(t *testing.T) {
+		var inFlight, peak atomic.Int32
+
+		stream := &streamScanner[string]{
+			workers: 4,
+			ordered: true,
+			filter:  splitLine,
+			scan: func(domain string) string {
+				current := inFlight.Add(1)
+				for {
+					if previous := peak.Load(); current <= previous || peak.CompareAndSwap(previous, current) {
+						break
+					}
+				}
+
+				// the first domain is slow, so every later result has to wait for it
+				if domain == "domain0.example.com" {
+					time.Sleep(50 * time.Millisecond)
+				}
+
+				return domain
+			},
+			emit: func(string) {
+				inFlight.Add(-1)
+			},
+		}
+
+		summary, err := stream.run(context.Background(), &lineReader{n: 200})
+		require.NoError(t, err)
+		require.Equal(t, 200, summary.scanned)
+		require.LessOrEqual(t, peak.Load(), int32(8))
+	})
+}
+
+func BenchmarkStreamScanner(b *testing.B) {
+	for _, ordered := range []bool{false, true} {
+		b.Run("Ordered="+strconv.FormatBool(ordered), func(b *testing.B) {
+			stream := &streamScanner[string]{
+				workers: 8,
+				ordered: ordered,
+				filter:  splitLine,
+				scan: func(domain string) string {
+					return domain
+				},
+				emit: func(string) {},
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			// allocations per domain stay constant as b.N grows, as the input is never buffered
+			if _, err := stream.run(context.Background(), &lineReader{n: b.N}); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.AddCommand(cmdSummarize)
+
+	cmdSummarize.Flags().IntVar(&summaryOffenders, "offenders", model.DefaultSummaryOffenders, "The number of worst offenders to rank by score")
+}
+
+var summaryOffenders int
+
+var cmdSummarize = &cobra.Command{
+	Use:     "summarize [flags] <file>",
+	Example: "  dss summarize results.ndjson\n  cat domains.txt | dss scan - --advise --checkTLS | dss summarize --format json",
+	Short:   "Summarize the results of a bulk scan.",
+	Long:    "Roll up the results of a bulk scan, as printed by dss scan in a JSON format (including NDJSON), into the number of domains at each DMARC policy level, without SPF, and at each lowest TLS version, along with the worst offenders by score.\nResults are read from the file, or from STDIN if it's - or omitted, one at a time, so files of any size can be summarized.\nThe summary is printed as tables, unless --format is set.",
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(command *cobra.Command, args []string) {
+		var input io.Reader = os.Stdin
+
+		if len(args) > 0 && args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				log.Fatal().Err(err).Msg("Unable to open results.")
+			}
+			defer file.Close()
+
+			input = file
+		}
+
+		summary, err := model.Summarize(input, summaryOffenders)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to summarize results.")
+		}
+
+		if !command.Flags().Changed("format") || strings.EqualFold(format, "table") {
+			fmt.Print(summary.Table())
+			return
+		}
+
+		printToConsole(summary)
+	},
+}
@@ -0,0 +1,26 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// errTerminalUnsupported is returned on platforms whose terminals can't be
+// put into raw mode, so the interactive mode falls back to plain output.
+var errTerminalUnsupported = errors.New("interactive mode isn't supported on this platform")
+
+// makeRaw isn't supported on this platform.
+func makeRaw(*os.File) (func(), error) {
+	return nil, errTerminalUnsupported
+}
+
+// terminalSize isn't supported on this platform.
+func terminalSize(*os.File) (int, int, error) {
+	return 0, 0, errTerminalUnsupported
+}
+
+// notifyResize does nothing, as there's no resize signal on this platform, so
+// the explorer is only redrawn at its new size on the next keypress.
+func notifyResize(chan<- os.Signal) {}
@@ -0,0 +1,201 @@
+package testnet
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type (
+	// CA is a certificate authority issuing certificates for tests. A root CA
+	// is trusted by the network's clients (see CA.Pool), and an
+	// intermediate CA's certificates are issued with its chain.
+	CA struct {
+		t           testing.TB
+		certificate *x509.Certificate
+		key         crypto.Signer
+		chain       [][]byte
+		pool        *x509.CertPool
+	}
+
+	// CertificateOptions describe a certificate to issue. The zero value is a
+	// certificate with a P-256 ECDSA key and a SHA-256 signature, valid from an
+	// hour ago for a day.
+	CertificateOptions struct {
+		// Name is the certificate's common name, and its first DNS name.
+		Name string
+
+		// Names are the certificate's other DNS names.
+		Names []string
+
+		// RSABits generates an RSA key of the given size, instead of an ECDSA
+		// key.
+		RSABits int
+
+		// SignatureAlgorithm is the algorithm the certificate is signed with,
+		// defaulting to the strongest for the issuer's key.
+		SignatureAlgorithm x509.SignatureAlgorithm
+
+		// NotAfter is when the certificate expires, defaulting to a day from
+		// now.
+		NotAfter time.Time
+	}
+)
+
+// serial numbers the certificates issued by every CA, so they're unique.
+var serial atomic.Int64
+
+// NewCA returns a self-signed root CA, whose certificate is described by the
+// options.
+func NewCA(t testing.TB, options CertificateOptions) *CA {
+	t.Helper()
+
+	if options.Name == "" {
+		options.Name = "Test Root CA"
+	}
+
+	ca := &CA{t: t}
+	ca.certificate, ca.key = issue(t, options, nil, true)
+	ca.pool = x509.NewCertPool()
+	ca.pool.AddCert(ca.certificate)
+
+	return ca
+}
+
+// Intermediate returns an intermediate CA, whose certificate is described by
+// the options and issued by the CA. Its certificates are served with it.
+func (ca *CA) Intermediate(options CertificateOptions) *CA {
+	ca.t.Helper()
+
+	if options.Name == "" {
+		options.Name = "Test Intermediate CA"
+	}
+
+	intermediate := &CA{t: ca.t, pool: ca.pool}
+	intermediate.certificate, intermediate.key = issue(ca.t, options, ca, true)
+	intermediate.chain = append([][]byte{intermediate.certificate.Raw}, ca.chain...)
+
+	return intermediate
+}
+
+// Certificate returns the CA's own certificate.
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.certificate
+}
+
+// Pool returns a pool holding the CA's root, for clients to trust.
+func (ca *CA) Pool() *x509.CertPool {
+	return ca.pool
+}
+
+// Issue returns a certificate described by the options, issued by the CA,
+// along with the chain of intermediates up to (but not including) the root.
+func (ca *CA) Issue(options CertificateOptions) tls.Certificate {
+	ca.t.Helper()
+
+	certificate, key := issue(ca.t, options, ca, false)
+
+	return tls.Certificate{
+		Certificate: append([][]byte{certificate.Raw}, ca.chain...),
+		PrivateKey:  key,
+		Leaf:        certificate,
+	}
+}
+
+// SelfSigned returns a self-signed certificate described by the options, which
+// no client trusts.
+func SelfSigned(t testing.TB, options CertificateOptions) tls.Certificate {
+	t.Helper()
+
+	certificate, key := issue(t, options, nil, false)
+
+	return tls.Certificate{Certificate: [][]byte{certificate.Raw}, PrivateKey: key, Leaf: certificate}
+}
+
+// Chain returns the parsed certificates of a certificate's chain, leaf first,
+// as a client receives them.
+func Chain(t testing.TB, certificate tls.Certificate) []*x509.Certificate {
+	t.Helper()
+
+	chain := make([]*x509.Certificate, 0, len(certificate.Certificate))
+
+	for _, raw := range certificate.Certificate {
+		parsed, err := x509.ParseCertificate(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chain = append(chain, parsed)
+	}
+
+	return chain
+}
+
+// issue creates a certificate described by the options, signed by the issuer,
+// or self-signed if the issuer is nil.
+func issue(t testing.TB, options CertificateOptions, issuer *CA, isCA bool) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+
+	var (
+		key crypto.Signer
+		err error
+	)
+
+	if options.RSABits > 0 {
+		key, err = rsa.GenerateKey(rand.Reader, options.RSABits)
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if options.NotAfter.IsZero() {
+		options.NotAfter = time.Now().Add(24 * time.Hour)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial.Add(1)),
+		Subject:               pkix.Name{CommonName: options.Name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              options.NotAfter,
+		SignatureAlgorithm:    options.SignatureAlgorithm,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		template.DNSNames = append([]string{options.Name}, options.Names...)
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.certificate, issuer.key
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate, key
+}
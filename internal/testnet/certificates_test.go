@@ -0,0 +1,61 @@
+package testnet
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCA_Issue(t *testing.T) {
+	root := NewCA(t, CertificateOptions{RSABits: 2048})
+	intermediate := root.Intermediate(CertificateOptions{RSABits: 2048, SignatureAlgorithm: x509.SHA1WithRSA})
+
+	t.Run("Chain", func(t *testing.T) {
+		certificate := intermediate.Issue(CertificateOptions{Name: "mx.example.com", Names: []string{"mail.example.com"}})
+
+		chain := Chain(t, certificate)
+		require.Len(t, chain, 2)
+		require.Equal(t, []string{"mx.example.com", "mail.example.com"}, chain[0].DNSNames)
+		require.Equal(t, "Test Intermediate CA", chain[1].Subject.CommonName)
+		require.Equal(t, x509.SHA1WithRSA, chain[1].SignatureAlgorithm)
+		require.Equal(t, chain[0], certificate.Leaf)
+
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(chain[1])
+
+		// SHA-1 signatures aren't trusted, so the chain only verifies up to the intermediate
+		_, err := chain[0].Verify(x509.VerifyOptions{DNSName: "mail.example.com", Roots: intermediates})
+		require.NoError(t, err)
+
+		_, err = chain[0].Verify(x509.VerifyOptions{DNSName: "mail.example.com", Roots: root.Pool(), Intermediates: intermediates})
+		require.Error(t, err)
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		expiry := time.Now().Add(-time.Minute).Truncate(time.Second)
+		certificate := root.Issue(CertificateOptions{Name: "www.example.com", RSABits: 1024, NotAfter: expiry})
+
+		require.Len(t, certificate.Certificate, 1)
+		require.Equal(t, 1024, certificate.Leaf.PublicKey.(*rsa.PublicKey).N.BitLen())
+		require.Equal(t, expiry.UTC(), certificate.Leaf.NotAfter)
+
+		_, err := certificate.Leaf.Verify(x509.VerifyOptions{DNSName: "www.example.com", Roots: root.Pool()})
+
+		var invalid x509.CertificateInvalidError
+		require.ErrorAs(t, err, &invalid)
+		require.Equal(t, x509.Expired, invalid.Reason)
+	})
+
+	t.Run("SelfSigned", func(t *testing.T) {
+		certificate := SelfSigned(t, CertificateOptions{Name: "www.example.com"})
+		require.Equal(t, certificate.Leaf.RawSubject, certificate.Leaf.RawIssuer)
+
+		_, err := certificate.Leaf.Verify(x509.VerifyOptions{DNSName: "www.example.com", Roots: root.Pool()})
+
+		var unknown x509.UnknownAuthorityError
+		require.ErrorAs(t, err, &unknown)
+	})
+}
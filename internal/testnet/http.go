@@ -0,0 +1,53 @@
+package testnet
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+)
+
+// HTTPSServer is a web server for a single hostname, such as one hosting BIMI
+// assets or an MTA-STS policy, started with Network.HTTPS.
+type HTTPSServer struct {
+	// Handler answers the server's requests, with a 404 by default.
+	Handler http.Handler
+
+	// Certificate is presented to clients, a certificate for the hostname
+	// from the network's CA by default.
+	Certificate *tls.Certificate
+
+	// MaxVersion caps the TLS version negotiated, such as tls.VersionTLS12.
+	MaxVersion uint16
+
+	hostname string
+	server   *httptest.Server
+	requests atomic.Int32
+}
+
+// Hang is a handler that never responds, until the client gives up, as an
+// overloaded server does.
+var Hang = http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+	<-r.Context().Done()
+})
+
+// URL returns the URL of the path on the server, by its hostname.
+func (s *HTTPSServer) URL(path string) string {
+	return "https://" + s.hostname + path
+}
+
+// Requests returns the number of requests the server received.
+func (s *HTTPSServer) Requests() int {
+	return int(s.requests.Load())
+}
+
+func (s *HTTPSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+
+	if s.Handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.Handler.ServeHTTP(w, r)
+}
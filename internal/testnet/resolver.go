@@ -0,0 +1,346 @@
+package testnet
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type (
+	// Resolver answers DNS queries from scripted answers, keyed by name and
+	// type, as a recursive resolver would. It satisfies scanner.Resolver, and
+	// advisor.HostResolver. A question without an answer is answered with
+	// NXDOMAIN if its name has no records at all, and with an empty answer
+	// otherwise.
+	Resolver struct {
+		t testing.TB
+
+		mutex     sync.Mutex
+		answers   map[question]Answer
+		names     map[string]struct{}
+		exchanges map[question]int
+	}
+
+	// Answer is the scripted answer to a question.
+	Answer struct {
+		// Records are the answer's records, in zone file format with fully
+		// qualified names.
+		Records []string
+
+		// Rcode is the answer's response code, NOERROR by default.
+		Rcode int
+
+		// Delay is how long the answer takes, so it's reported as the
+		// exchange's round trip time.
+		Delay time.Duration
+
+		// Truncated answers the question without its records, with the TC
+		// bit set, as if they didn't fit a UDP response. Every other exchange
+		// of the question (the retry over TCP) is answered in full.
+		Truncated bool
+
+		// Err fails the exchange, as if the resolver couldn't be reached.
+		Err error
+	}
+
+	// question is a DNS question's lowercase, fully qualified name and type.
+	question struct {
+		name       string
+		recordType uint16
+	}
+)
+
+// NewResolver returns a resolver without any answers.
+func NewResolver(t testing.TB) *Resolver {
+	return &Resolver{
+		t:         t,
+		answers:   make(map[question]Answer),
+		names:     make(map[string]struct{}),
+		exchanges: make(map[question]int),
+	}
+}
+
+// Records adds the records, in zone file format with fully qualified names,
+// to the answers of their names and types.
+func (r *Resolver) Records(records ...string) *Resolver {
+	r.t.Helper()
+
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			r.t.Fatalf("invalid record %q: %v", record, err)
+		}
+
+		key := newQuestion(rr.Header().Name, rr.Header().Rrtype)
+
+		r.mutex.Lock()
+		answer := r.answers[key]
+		answer.Records = append(answer.Records, record)
+		r.answers[key] = answer
+		r.names[key.name] = struct{}{}
+		r.mutex.Unlock()
+	}
+
+	return r
+}
+
+// TXT adds the TXT records for the name, one for each value.
+func (r *Resolver) TXT(name string, values ...string) *Resolver {
+	r.t.Helper()
+
+	for _, value := range values {
+		// long values are split into strings of at most 255 bytes, as they're published
+		var strs []string
+		for len(value) > 255 {
+			strs, value = append(strs, value[:255]), value[255:]
+		}
+
+		quoted := make([]string, 0, len(strs)+1)
+		for _, str := range append(strs, value) {
+			quoted = append(quoted, `"`+strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(str)+`"`)
+		}
+
+		r.Records(dns.Fqdn(name) + " 300 IN TXT " + strings.Join(quoted, " "))
+	}
+
+	return r
+}
+
+// Host adds the A or AAAA record for each address of the host.
+func (r *Resolver) Host(name string, addresses ...string) *Resolver {
+	r.t.Helper()
+
+	for _, address := range addresses {
+		recordType := "A"
+		if strings.Contains(address, ":") {
+			recordType = "AAAA"
+		}
+
+		r.Records(dns.Fqdn(name) + " 300 IN " + recordType + " " + address)
+	}
+
+	return r
+}
+
+// MX adds the name's MX records, for the hosts in order of preference.
+func (r *Resolver) MX(name string, hosts ...string) *Resolver {
+	r.t.Helper()
+
+	for index, host := range hosts {
+		r.Records(dns.Fqdn(name) + " 300 IN MX " + strconv.Itoa((index+1)*10) + " " + dns.Fqdn(host))
+	}
+
+	return r
+}
+
+// Answer scripts the answer to the question of the name and type, replacing
+// any records added for it.
+func (r *Resolver) Answer(name string, recordType uint16, answer Answer) *Resolver {
+	r.t.Helper()
+
+	for _, record := range answer.Records {
+		if _, err := dns.NewRR(record); err != nil {
+			r.t.Fatalf("invalid record %q: %v", record, err)
+		}
+	}
+
+	key := newQuestion(name, recordType)
+
+	r.mutex.Lock()
+	r.answers[key] = answer
+	r.names[key.name] = struct{}{}
+	r.mutex.Unlock()
+
+	return r
+}
+
+// Exchanges returns the number of times the question of the name and type
+// was asked.
+func (r *Resolver) Exchanges(name string, recordType uint16) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.exchanges[newQuestion(name, recordType)]
+}
+
+// ExchangesWhere returns the number of questions asked whose name and type
+// match, such as every question of a type, or those under a zone. Names are
+// lowercase and fully qualified.
+func (r *Resolver) ExchangesWhere(match func(name string, recordType uint16) bool) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var exchanges int
+
+	for key, count := range r.exchanges {
+		if match(key.name, key.recordType) {
+			exchanges += count
+		}
+	}
+
+	return exchanges
+}
+
+// Exchange answers the message's question.
+func (r *Resolver) Exchange(msg *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	reply := new(dns.Msg)
+	reply.SetReply(msg)
+
+	if len(msg.Question) == 0 {
+		reply.Rcode = dns.RcodeFormatError
+		return reply, 0, nil
+	}
+
+	key := newQuestion(msg.Question[0].Name, msg.Question[0].Qtype)
+
+	r.mutex.Lock()
+	answer, scripted := r.answers[key]
+	_, named := r.names[key.name]
+	exchange := r.exchanges[key]
+	r.exchanges[key]++
+	r.mutex.Unlock()
+
+	time.Sleep(answer.Delay)
+
+	switch {
+	case answer.Err != nil:
+		return nil, answer.Delay, answer.Err
+	case !scripted && !named:
+		reply.Rcode = dns.RcodeNameError
+		return reply, answer.Delay, nil
+	case answer.Truncated && exchange%2 == 0:
+		reply.Truncated = true
+		return reply, answer.Delay, nil
+	}
+
+	reply.Rcode = answer.Rcode
+	reply.Answer = parseRecords(answer.Records)
+
+	return reply, answer.Delay, nil
+}
+
+// LookupHost returns the addresses of the host's A and AAAA records.
+func (r *Resolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	var addresses []string
+
+	for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		records, err := r.lookup(host, recordType)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			switch record := record.(type) {
+			case *dns.A:
+				addresses = append(addresses, record.A.String())
+			case *dns.AAAA:
+				addresses = append(addresses, record.AAAA.String())
+			}
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addresses, nil
+}
+
+// LookupMX returns the name's MX records.
+func (r *Resolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	records, err := r.lookup(name, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+
+	var mx []*net.MX
+
+	for _, record := range records {
+		if record, ok := record.(*dns.MX); ok {
+			mx = append(mx, &net.MX{Host: record.Mx, Pref: record.Preference})
+		}
+	}
+
+	if len(mx) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	return mx, nil
+}
+
+// hosts returns the names whose A or AAAA records hold the address.
+func (r *Resolver) hosts(address string) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var names []string
+
+	for key, answer := range r.answers {
+		for _, record := range parseRecords(answer.Records) {
+			var ip net.IP
+
+			switch record := record.(type) {
+			case *dns.A:
+				ip = record.A
+			case *dns.AAAA:
+				ip = record.AAAA
+			}
+
+			if ip != nil && ip.String() == address {
+				names = append(names, strings.TrimSuffix(key.name, "."))
+			}
+		}
+	}
+
+	return names
+}
+
+// lookup answers the question of the name and type as Exchange does, returning
+// an error for an answer that failed or wasn't NOERROR.
+func (r *Resolver) lookup(name string, recordType uint16) ([]dns.RR, error) {
+	msg := new(dns.Msg).SetQuestion(dns.Fqdn(name), recordType)
+
+	reply, _, err := r.Exchange(msg, "")
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name, IsTemporary: true}
+	}
+
+	// a truncated answer is retried, as the stub resolver would over TCP
+	if reply.Truncated {
+		if reply, _, err = r.Exchange(msg, ""); err != nil {
+			return nil, &net.DNSError{Err: err.Error(), Name: name, IsTemporary: true}
+		}
+	}
+
+	switch reply.Rcode {
+	case dns.RcodeSuccess:
+		return reply.Answer, nil
+	case dns.RcodeNameError:
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+}
+
+func newQuestion(name string, recordType uint16) question {
+	return question{name: strings.ToLower(dns.Fqdn(name)), recordType: recordType}
+}
+
+// parseRecords parses records already validated when they were scripted.
+func parseRecords(records []string) []dns.RR {
+	parsed := make([]dns.RR, 0, len(records))
+
+	for _, record := range records {
+		if rr, err := dns.NewRR(record); err == nil {
+			parsed = append(parsed, rr)
+		}
+	}
+
+	return parsed
+}
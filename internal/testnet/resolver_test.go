@@ -0,0 +1,119 @@
+package testnet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func exchange(t *testing.T, resolver *Resolver, name string, recordType uint16) (*dns.Msg, time.Duration, error) {
+	t.Helper()
+	return resolver.Exchange(new(dns.Msg).SetQuestion(dns.Fqdn(name), recordType), "127.0.0.1:53")
+}
+
+func TestResolver_Exchange(t *testing.T) {
+	failure := errors.New("network unreachable")
+
+	resolver := NewResolver(t).
+		TXT("example.com", "v=spf1 -all", strings.Repeat("a", 300)).
+		MX("example.com", "mx1.example.com", "mx2.example.com").
+		Host("mx1.example.com", "192.0.2.1", "2001:db8::1").
+		Answer("_dmarc.example.com", dns.TypeTXT, Answer{Rcode: dns.RcodeServerFailure}).
+		Answer("slow.example.com", dns.TypeTXT, Answer{Records: []string{`slow.example.com. 300 IN TXT "slow"`}, Delay: 20 * time.Millisecond}).
+		Answer("large.example.com", dns.TypeTXT, Answer{Records: []string{`large.example.com. 300 IN TXT "large"`}, Truncated: true}).
+		Answer("unreachable.example.com", dns.TypeTXT, Answer{Err: failure}).
+		Answer("broken.example.com", dns.TypeMX, Answer{Rcode: dns.RcodeServerFailure})
+
+	t.Run("Records", func(t *testing.T) {
+		reply, _, err := exchange(t, resolver, "Example.com", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Equal(t, dns.RcodeSuccess, reply.Rcode)
+		require.Len(t, reply.Answer, 2)
+		require.Equal(t, []string{"v=spf1 -all"}, reply.Answer[0].(*dns.TXT).Txt)
+		require.Equal(t, strings.Repeat("a", 300), strings.Join(reply.Answer[1].(*dns.TXT).Txt, ""))
+
+		reply, _, err = exchange(t, resolver, "example.com", dns.TypeMX)
+		require.NoError(t, err)
+		require.Equal(t, "mx1.example.com.", reply.Answer[0].(*dns.MX).Mx)
+		require.Equal(t, uint16(10), reply.Answer[0].(*dns.MX).Preference)
+	})
+
+	t.Run("NoRecords", func(t *testing.T) {
+		reply, _, err := exchange(t, resolver, "example.com", dns.TypeCAA)
+		require.NoError(t, err)
+		require.Equal(t, dns.RcodeSuccess, reply.Rcode)
+		require.Empty(t, reply.Answer)
+
+		reply, _, err = exchange(t, resolver, "missing.example.com", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Equal(t, dns.RcodeNameError, reply.Rcode)
+	})
+
+	t.Run("Rcode", func(t *testing.T) {
+		reply, _, err := exchange(t, resolver, "_dmarc.example.com", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Equal(t, dns.RcodeServerFailure, reply.Rcode)
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		start := time.Now()
+		_, rtt, err := exchange(t, resolver, "slow.example.com", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Equal(t, 20*time.Millisecond, rtt)
+		require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		// each truncated answer is followed by the full answer to the retry
+		for range 2 {
+			reply, _, err := exchange(t, resolver, "large.example.com", dns.TypeTXT)
+			require.NoError(t, err)
+			require.True(t, reply.Truncated)
+			require.Empty(t, reply.Answer)
+
+			reply, _, err = exchange(t, resolver, "large.example.com", dns.TypeTXT)
+			require.NoError(t, err)
+			require.False(t, reply.Truncated)
+			require.Len(t, reply.Answer, 1)
+		}
+
+		require.Equal(t, 4, resolver.Exchanges("large.example.com.", dns.TypeTXT))
+		require.Equal(t, 4, resolver.ExchangesWhere(func(name string, _ uint16) bool { return strings.HasPrefix(name, "large.") }))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		_, _, err := exchange(t, resolver, "unreachable.example.com", dns.TypeTXT)
+		require.ErrorIs(t, err, failure)
+	})
+
+	t.Run("LookupHost", func(t *testing.T) {
+		addresses, err := resolver.LookupHost(context.Background(), "mx1.example.com")
+		require.NoError(t, err)
+		require.Equal(t, []string{"192.0.2.1", "2001:db8::1"}, addresses)
+		require.Equal(t, []string{"mx1.example.com"}, resolver.hosts("192.0.2.1"))
+
+		var dnsErr *net.DNSError
+
+		_, err = resolver.LookupHost(context.Background(), "mx2.example.com")
+		require.ErrorAs(t, err, &dnsErr)
+		require.True(t, dnsErr.IsNotFound)
+	})
+
+	t.Run("LookupMX", func(t *testing.T) {
+		mx, err := resolver.LookupMX(context.Background(), "example.com")
+		require.NoError(t, err)
+		require.Equal(t, []*net.MX{{Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com.", Pref: 20}}, mx)
+
+		var dnsErr *net.DNSError
+
+		_, err = resolver.LookupMX(context.Background(), "broken.example.com")
+		require.ErrorAs(t, err, &dnsErr)
+		require.True(t, dnsErr.IsTemporary)
+	})
+}
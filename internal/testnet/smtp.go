@@ -0,0 +1,156 @@
+package testnet
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// StartTLS is how an SMTP server answers the STARTTLS command.
+type StartTLS int
+
+const (
+	// StartTLSOffered offers STARTTLS, and completes the TLS handshake.
+	StartTLSOffered StartTLS = iota
+
+	// StartTLSNotOffered doesn't offer STARTTLS, and rejects the command as
+	// not implemented.
+	StartTLSNotOffered
+
+	// StartTLSRefused offers STARTTLS, but refuses the command with a
+	// temporary failure.
+	StartTLSRefused
+
+	// StartTLSBroken accepts the command, then closes the connection instead
+	// of completing the handshake.
+	StartTLSBroken
+)
+
+// SMTPServer is a scripted mail server, started with Network.SMTP. Every
+// command other than EHLO, HELO, STARTTLS and QUIT is accepted.
+type SMTPServer struct {
+	// Hostname is the name the server introduces itself with in its greeting
+	// and EHLO reply, the hostname it was started with by default.
+	Hostname string
+
+	// Banner is the greeting sent to each connection, "220 <Hostname> ESMTP"
+	// by default. A greeting that isn't a 220 reply closes the connection, as
+	// a server turning the client away does.
+	Banner string
+
+	// Banners returns the greeting for each connection by its index from 0,
+	// overriding Banner.
+	Banners func(index int) string
+
+	// Delay holds back the greeting, as a slow server does. A delay longer
+	// than the client's timeout never greets it.
+	Delay time.Duration
+
+	// StartTLS is how the server answers the STARTTLS command.
+	StartTLS StartTLS
+
+	// Certificate is presented after STARTTLS, a certificate for the
+	// hostname from the network's CA by default.
+	Certificate *tls.Certificate
+
+	// MaxVersion caps the TLS version negotiated, such as tls.VersionTLS12.
+	MaxVersion uint16
+
+	hostname    string
+	listener    net.Listener
+	connections atomic.Int32
+	done        chan struct{}
+}
+
+// Connections returns the number of connections the server accepted.
+func (s *SMTPServer) Connections() int {
+	return int(s.connections.Load())
+}
+
+func (s *SMTPServer) serve(conn net.Conn, index int) {
+	defer conn.Close()
+
+	banner := s.Banner
+	if s.Banners != nil {
+		banner = s.Banners(index)
+	}
+
+	name := s.Hostname
+	if name == "" {
+		name = s.hostname
+	}
+
+	if banner == "" {
+		banner = "220 " + name + " ESMTP"
+	}
+
+	select {
+	case <-time.After(s.Delay):
+	case <-s.done:
+		return
+	}
+
+	if _, err := conn.Write([]byte(banner + "\r\n")); err != nil || !strings.HasPrefix(banner, "220") {
+		return
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{*s.Certificate}, MaxVersion: s.MaxVersion}
+	encrypted := false
+	reader := bufio.NewReader(conn)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		verb, _, _ := strings.Cut(strings.ToUpper(strings.TrimSpace(line)), " ")
+
+		var reply string
+
+		switch verb {
+		case "EHLO":
+			reply = "250-" + name + "\r\n250 8BITMIME"
+			if !encrypted && s.StartTLS != StartTLSNotOffered {
+				reply = "250-" + name + "\r\n250-8BITMIME\r\n250 STARTTLS"
+			}
+		case "HELO":
+			reply = "250 " + name
+		case "STARTTLS":
+			switch {
+			case encrypted || s.StartTLS == StartTLSNotOffered:
+				reply = "502 5.5.1 Command not implemented"
+			case s.StartTLS == StartTLSRefused:
+				reply = "454 4.7.0 TLS not available due to temporary reason"
+			case s.StartTLS == StartTLSBroken:
+				_, _ = conn.Write([]byte("220 2.0.0 Ready to start TLS\r\n"))
+				return
+			default:
+				if _, err = conn.Write([]byte("220 2.0.0 Ready to start TLS\r\n")); err != nil {
+					return
+				}
+
+				tlsConn := tls.Server(conn, config)
+				if err = tlsConn.Handshake(); err != nil {
+					return
+				}
+
+				conn, reader, encrypted = tlsConn, bufio.NewReader(tlsConn), true
+
+				continue
+			}
+		case "QUIT":
+			_, _ = conn.Write([]byte("221 2.0.0 Bye\r\n"))
+			return
+		default:
+			reply = "250 2.0.0 OK"
+		}
+
+		if _, err = conn.Write([]byte(reply + "\r\n")); err != nil {
+			return
+		}
+	}
+}
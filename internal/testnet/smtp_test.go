@@ -0,0 +1,124 @@
+package testnet
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// dialSMTP connects an SMTP client to the mail server of the hostname.
+func dialSMTP(t *testing.T, network *Network, hostname string) (*smtp.Client, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, err := network.DialContext(ctx, "tcp", hostname+":25")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	require.NoError(t, conn.SetDeadline(time.Now().Add(time.Second)))
+
+	return smtp.NewClient(conn, hostname)
+}
+
+func TestSMTPServer(t *testing.T) {
+	network := New(t)
+
+	t.Run("StartTLS", func(t *testing.T) {
+		server := network.SMTP("mx1.example.com", &SMTPServer{MaxVersion: tls.VersionTLS12})
+
+		client, err := dialSMTP(t, network, "mx1.example.com")
+		require.NoError(t, err)
+
+		ok, _ := client.Extension("STARTTLS")
+		require.True(t, ok)
+		require.NoError(t, client.StartTLS(&tls.Config{RootCAs: network.CA.Pool(), ServerName: "mx1.example.com"}))
+
+		state, _ := client.TLSConnectionState()
+		require.Equal(t, uint16(tls.VersionTLS12), state.Version)
+		require.NoError(t, client.Quit())
+		require.Equal(t, 1, server.Connections())
+	})
+
+	t.Run("Certificate", func(t *testing.T) {
+		certificate := SelfSigned(t, CertificateOptions{Name: "mx2.example.com"})
+		network.SMTP("mx2.example.com", &SMTPServer{Certificate: &certificate})
+
+		client, err := dialSMTP(t, network, "mx2.example.com")
+		require.NoError(t, err)
+
+		var unknown x509.UnknownAuthorityError
+		require.ErrorAs(t, client.StartTLS(&tls.Config{RootCAs: network.CA.Pool(), ServerName: "mx2.example.com"}), &unknown)
+	})
+
+	t.Run("Banner", func(t *testing.T) {
+		server := network.SMTP("mx3.example.com", &SMTPServer{Banners: func(index int) string {
+			if index == 0 {
+				return "421 4.7.0 Too many connections"
+			}
+
+			return "554 5.7.1 Service unavailable"
+		}})
+
+		for _, code := range []int{421, 554} {
+			_, err := dialSMTP(t, network, "mx3.example.com")
+
+			var reply *textproto.Error
+			require.ErrorAs(t, err, &reply)
+			require.Equal(t, code, reply.Code)
+		}
+
+		require.Equal(t, 2, server.Connections())
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		network.SMTP("mx4.example.com", &SMTPServer{Delay: time.Hour})
+
+		_, err := dialSMTP(t, network, "mx4.example.com")
+		require.ErrorContains(t, err, "i/o timeout")
+	})
+
+	tests := []struct {
+		name     string
+		startTLS StartTLS
+		offered  bool
+		code     int
+	}{
+		{name: "NotOffered", startTLS: StartTLSNotOffered, code: 502},
+		{name: "Refused", startTLS: StartTLSRefused, offered: true, code: 454},
+		{name: "Broken", startTLS: StartTLSBroken, offered: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostname := test.name + ".example.com"
+			network.SMTP(hostname, &SMTPServer{StartTLS: test.startTLS})
+
+			client, err := dialSMTP(t, network, hostname)
+			require.NoError(t, err)
+
+			require.NoError(t, client.Hello("client.example.com"))
+			ok, _ := client.Extension("STARTTLS")
+			require.Equal(t, test.offered, ok)
+
+			err = client.StartTLS(&tls.Config{RootCAs: network.CA.Pool(), ServerName: hostname})
+			require.Error(t, err)
+
+			var reply *textproto.Error
+			if test.code != 0 {
+				require.ErrorAs(t, err, &reply)
+				require.Equal(t, test.code, reply.Code)
+			} else {
+				require.False(t, errors.As(err, &reply), "found %v, want a TLS failure", err)
+			}
+		})
+	}
+}
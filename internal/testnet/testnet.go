@@ -0,0 +1,230 @@
+// Package testnet is a deterministic fake network for tests, so the scanner
+// and advisor can be run against broken domains without any real ones. A
+// Network holds a scripted DNS resolver, scripted SMTP servers and HTTPS
+// servers, and a CA issuing their certificates. It's wired in through the
+// scanner's and advisor's injectable interfaces:
+//
+//	network := testnet.New(t)
+//
+//	sc, err := scanner.New(logger, time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver {
+//		return network.Resolver
+//	}))
+//
+//	domainAdvisor := advisor.NewAdvisor(time.Second, time.Minute, true,
+//		advisor.WithDialer(network),
+//		advisor.WithHostResolver(network.Resolver),
+//		advisor.WithHTTPClient(network.HTTPClient()),
+//		advisor.WithProxy(advisor.ProxyConfig{}),
+//		advisor.WithRootCAs(network.CA.Pool()),
+//	)
+//
+// A scenario is scripted by adding the domain's records to the resolver, and
+// starting its servers, each broken in the way the test needs:
+//
+//	network.Resolver.
+//		MX("example.com", "mx1.example.com", "mx2.example.com").
+//		TXT("example.com", "v=spf1 mx -all").
+//		Answer("_dmarc.example.com", dns.TypeTXT, testnet.Answer{Rcode: dns.RcodeServerFailure})
+//
+//	network.SMTP("mx1.example.com", &testnet.SMTPServer{MaxVersion: tls.VersionTLS12})
+//	network.SMTP("mx2.example.com", &testnet.SMTPServer{Banner: "554 5.7.1 Service unavailable"})
+//	network.HTTPS("bimi.example.com", &testnet.HTTPSServer{Handler: testnet.Hang})
+//
+// Connections to a host and port without a server are refused, and those to
+// a host dropped with Network.Drop time out. Everything is served on the
+// loopback interface, and stopped when the test completes.
+package testnet
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// Network routes connections to the servers started on it by hostname and
+// port, or by the addresses its resolver resolves their hostnames to. It
+// satisfies advisor.Dialer.
+type Network struct {
+	// Resolver answers the network's DNS queries, and resolves its hosts.
+	Resolver *Resolver
+
+	// CA issues the certificates of the network's servers, unless they're
+	// given their own, and is trusted by its HTTP client.
+	CA *CA
+
+	// OnDial, if set, is called with the address of every connection dialed
+	// before it's routed, such as to record the dials, or to advance a test's
+	// clock as a slow server would.
+	OnDial func(address string)
+
+	t    testing.TB
+	done chan struct{}
+
+	mutex sync.Mutex
+
+	// routes maps each host and port to the address of its server, or to an
+	// empty address if connections to it time out.
+	routes map[string]string
+}
+
+// New returns a network without any records or servers, which is stopped
+// when the test completes.
+func New(t testing.TB) *Network {
+	t.Helper()
+
+	network := &Network{
+		Resolver: NewResolver(t),
+		CA:       NewCA(t, CertificateOptions{}),
+		t:        t,
+		done:     make(chan struct{}),
+		routes:   make(map[string]string),
+	}
+
+	t.Cleanup(func() { close(network.done) })
+
+	return network
+}
+
+// SMTP starts the mail server on port 25 of the hostname, returning it.
+func (n *Network) SMTP(hostname string, server *SMTPServer) *SMTPServer {
+	n.t.Helper()
+
+	server.hostname, server.done = normalize(hostname), n.done
+	if server.Certificate == nil {
+		certificate := n.CA.Issue(CertificateOptions{Name: server.hostname})
+		server.Certificate = &certificate
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		n.t.Fatal(err)
+	}
+
+	n.t.Cleanup(func() { listener.Close() })
+	server.listener = listener
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(conn, int(server.connections.Add(1))-1)
+		}
+	}()
+
+	n.route(server.hostname, 25, listener.Addr().String())
+
+	return server
+}
+
+// HTTPS starts the web server on port 443 of the hostname, returning it.
+func (n *Network) HTTPS(hostname string, server *HTTPSServer) *HTTPSServer {
+	n.t.Helper()
+
+	server.hostname = normalize(hostname)
+	if server.Certificate == nil {
+		certificate := n.CA.Issue(CertificateOptions{Name: server.hostname})
+		server.Certificate = &certificate
+	}
+
+	server.server = httptest.NewUnstartedServer(server)
+	server.server.TLS = &tls.Config{Certificates: []tls.Certificate{*server.Certificate}, MaxVersion: server.MaxVersion}
+	server.server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.server.StartTLS()
+	n.t.Cleanup(server.server.Close)
+
+	n.route(server.hostname, 443, server.server.Listener.Addr().String())
+
+	return server
+}
+
+// Drop makes connections to the port of the hostname time out, as a firewall
+// dropping them does.
+func (n *Network) Drop(hostname string, port int) {
+	n.route(normalize(hostname), port, "")
+}
+
+// HTTPClient returns a client connecting through the network, and trusting
+// its CA.
+func (n *Network) HTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:       n.DialContext,
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{RootCAs: n.CA.Pool()},
+		},
+	}
+}
+
+// DialContext connects to the server at the address, which is a hostname or
+// an address it resolves to, and a port.
+func (n *Network) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if n.OnDial != nil {
+		n.OnDial(address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	target, ok := n.lookup(host, port)
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	}
+
+	if target == "" {
+		select {
+		case <-ctx.Done():
+			return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+		case <-n.done:
+			return nil, &net.OpError{Op: "dial", Net: network, Err: os.ErrDeadlineExceeded}
+		}
+	}
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", target)
+}
+
+func (n *Network) route(hostname string, port int, address string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.routes[net.JoinHostPort(hostname, strconv.Itoa(port))] = address
+}
+
+// lookup returns the address of the server at the host and port, looking the
+// host up by the addresses resolved for each hostname if it's an address.
+func (n *Network) lookup(host, port string) (string, bool) {
+	hosts := []string{normalize(host)}
+	if net.ParseIP(host) != nil {
+		hosts = append(hosts, n.Resolver.hosts(host)...)
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for _, candidate := range hosts {
+		if address, ok := n.routes[net.JoinHostPort(candidate, port)]; ok {
+			return address, true
+		}
+	}
+
+	return "", false
+}
+
+func normalize(hostname string) string {
+	return strings.ToLower(strings.TrimSuffix(hostname, "."))
+}
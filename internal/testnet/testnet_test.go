@@ -0,0 +1,92 @@
+package testnet
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetwork_DialContext(t *testing.T) {
+	network := New(t)
+	network.Resolver.Host("mx.example.com", "192.0.2.1")
+	network.SMTP("MX.example.com.", &SMTPServer{})
+	network.Drop("dropped.example.com", 25)
+
+	var dialed []string
+	network.OnDial = func(address string) { dialed = append(dialed, address) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the server is reached by its hostname, and by the addresses it resolves to
+	for _, address := range []string{"mx.example.com:25", "192.0.2.1:25"} {
+		conn, err := network.DialContext(ctx, "tcp", address)
+		require.NoError(t, err, address)
+		require.NoError(t, conn.Close())
+	}
+
+	for _, address := range []string{"mx.example.com:587", "192.0.2.2:25", "other.example.com:25"} {
+		_, err := network.DialContext(ctx, "tcp", address)
+		require.ErrorIs(t, err, syscall.ECONNREFUSED, address)
+	}
+
+	dropCtx, dropCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer dropCancel()
+
+	_, err := network.DialContext(dropCtx, "tcp", "dropped.example.com:25")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// every dial is seen by the hook, whether or not it connected
+	require.Equal(t, []string{"mx.example.com:25", "192.0.2.1:25", "mx.example.com:587", "192.0.2.2:25", "other.example.com:25", "dropped.example.com:25"}, dialed)
+}
+
+func TestNetwork_HTTPS(t *testing.T) {
+	network := New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/mta-sts.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("version: STSv1\nmode: enforce\nmx: *.example.com\nmax_age: 86400\n"))
+	})
+
+	server := network.HTTPS("mta-sts.example.com", &HTTPSServer{Handler: mux, MaxVersion: tls.VersionTLS12})
+	network.HTTPS("hanging.example.com", &HTTPSServer{Handler: Hang})
+	network.HTTPS("empty.example.com", &HTTPSServer{})
+
+	client := network.HTTPClient()
+
+	response, err := client.Get(server.URL("/.well-known/mta-sts.txt"))
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(response.Body)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Contains(t, string(body), "mode: enforce")
+	require.Equal(t, uint16(tls.VersionTLS12), response.TLS.Version)
+	require.Equal(t, 1, server.Requests())
+
+	response, err = client.Get("https://empty.example.com/")
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	// clients outside the network don't trust its CA
+	client.Transport.(*http.Transport).TLSClientConfig.RootCAs = nil
+	_, err = client.Get(server.URL("/"))
+	require.Error(t, err)
+
+	client = network.HTTPClient()
+	client.Timeout = 50 * time.Millisecond
+
+	_, err = client.Get("https://hanging.example.com/")
+
+	var timeout interface{ Timeout() bool }
+	require.True(t, errors.As(err, &timeout) && timeout.Timeout(), "found %v, want a timeout", err)
+}
@@ -1,39 +1,136 @@
 package advisor
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
-	"net/smtp"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
-	"github.com/spf13/cast"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
 )
 
-var emailRegex = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-
 type (
 	Advisor struct {
-		consumerDomains      map[string]struct{}
-		consumerDomainsMutex *sync.Mutex
-		dialer               *net.Dialer
-		tlsCacheHost         *cache.Cache[[]string]
-		tlsCacheMail         *cache.Cache[[]string]
-		checkTLS             bool
-	}
+		caches             map[string]namespaceCache
+		cacheTTLs          map[string]time.Duration
+		ctLog              *ctLog
+		ctURL              string
+		data               *data
+		dialer             Dialer
+		dialerMiddleware   []func(next Dialer) Dialer
+		resolveOverrides   []ResolveOverride
+		httpClient         *http.Client
+		httpAttempts       int
+		httpBackoff        time.Duration
+		breaker            *circuitBreaker
+		lookupHost         func(ctx context.Context, host string) ([]string, error)
+		lookupMX           func(ctx context.Context, name string) ([]*net.MX, error)
+		mailDomainCache    *cache.Cache[string]
+		probeDialer        Dialer
+		port25             *port25SelfTest
+		probes             *probeScheduler
+		proxy              ProxyConfig
+		proxyAddresses     map[string]struct{}
+		rdap               *rdapClient
+		rdapURL            string
+		rdapWindow         time.Duration
+		rootCAs            *x509.CertPool
+		securityTxt        *securityTxtCache
+		securityTxtEnabled bool
+		smtp               *smtpPoliteness
+		tlsCacheHost       *cache.Cache[[]string]
+		tlsCacheMail       *cache.Cache[[]string]
+		tlsCacheMailCerts  *cache.Cache[mailCertificate]
+		checkTimeout       time.Duration
+		timeBudget         time.Duration
+		timeout            time.Duration
+		disabledChecks     []string
+		dkimRotationMonths int
+		checkTLS           bool
+		detailed           bool
+		offline            bool
+		strictASCII        bool
+		subdomainAdvice    bool
+		subdomainChecks    []string
+	}
+
+	// Option defines a functional configuration type for an *Advisor.
+	Option func(*Advisor)
 
 	Advice struct {
 		Domain []string `json:"domain,omitempty" yaml:"domain,omitempty" doc:"Domain advice." example:"Your domain looks good! No further action needed."`
+		ARC    []string `json:"arc,omitempty" yaml:"arc,omitempty" doc:"ARC advice." example:"Your domain publishes an ARC sealing key at selector \"arc\", so mail it forwards can still be trusted by receivers that validate its seal. No further action needed."`
 		BIMI   []string `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"BIMI advice." example:"Your BIMI record looks good! No further action needed."`
-		DKIM   []string `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"DKIM advice." example:"DKIM is setup for this email server. However, if you have other 3rd party systems, please send a test email to confirm DKIM is setup properly."`
-		DMARC  []string `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"DMARC advice." example:"You are currently at the lowest level and receiving reports, which is a great starting point. Please make sure to review the reports, make the appropriate adjustments, and move to either quarantine or reject soon."`
-		MX     []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"MX advice." example:"You have a multiple mail servers setup! No further action needed."`
-		SPF    []string `json:"spf,omitempty" yaml:"spf,omitempty" doc:"SPF advice." example:"SPF seems to be setup correctly! No further action needed."`
+
+		// Blocklists is only set if blocklists are checked.
+		Blocklists []string `json:"blocklists,omitempty" yaml:"blocklists,omitempty" doc:"Blocklist advice, for the sampled SPF authorized and MX host addresses. It's informational, as shared provider ranges are often listed." example:"None of the SPF authorized or MX host addresses checked are listed by the blocklists. No further action needed."`
+
+		// Certificates is only set if the certificate transparency check is enabled.
+		Certificates []string `json:"certificates,omitempty" yaml:"certificates,omitempty" doc:"Certificate advice, from the certificate transparency logs." example:"No unexpected certificates were found in the certificate transparency logs for your domain. No further action needed."`
+
+		DKIM  []string `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"DKIM advice." example:"DKIM is setup for this email server. However, if you have other 3rd party systems, please send a test email to confirm DKIM is setup properly."`
+		DMARC []string `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"DMARC advice." example:"You are currently at the lowest level and receiving reports, which is a great starting point. Please make sure to review the reports, make the appropriate adjustments, and move to either quarantine or reject soon."`
+
+		// Lookalikes is only set if lookalikes are checked.
+		Lookalikes []string `json:"lookalikes,omitempty" yaml:"lookalikes,omitempty" doc:"Lookalike domain advice, for the lookalikes of the domain that resolve. It's informational, as lookalikes are often registered legitimately or defensively." example:"None of the lookalikes of your domain that were checked resolve. No further action needed."`
+
+		// MTASTS is only set if MTA-STS records are looked up.
+		MTASTS []string `json:"mtaSts,omitempty" yaml:"mtaSts,omitempty" doc:"MTA-STS advice, with a verdict for each mail server on whether it matches the policy's mx patterns and presents a valid certificate, so mail to it is delivered with the policy enforced." example:"mx1.example.com matches mx: *.example.com in your MTA-STS policy, and presents a valid certificate for it, so it passes the policy."`
+
+		MX []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"MX advice." example:"You have a multiple mail servers setup! No further action needed."`
+
+		// SOA is only set if the domain is the apex of a zone.
+		SOA []string `json:"soa,omitempty" yaml:"soa,omitempty" doc:"SOA advice, on the zone's serial number, timers and contact." example:"Your SOA record's serial number, timers and contact look reasonable. No further action needed."`
+
+		SPF []string `json:"spf,omitempty" yaml:"spf,omitempty" doc:"SPF advice." example:"SPF seems to be setup correctly! No further action needed."`
+
+		// Subdomains is only set if sending subdomains are checked.
+		Subdomains []string `json:"subdomains,omitempty" yaml:"subdomains,omitempty" doc:"Sending subdomain advice, grouped by subdomain." example:"em.example.com publishes SPF and DKIM records, and is covered by the DMARC record of example.com at p=reject. No further action needed."`
+
+		// TXT is only set if the domain publishes TXT records.
+		TXT []string `json:"txt,omitempty" yaml:"txt,omitempty" doc:"TXT record advice, on the domain's own TXT records as a whole." example:"Your domain publishes 4 TXT records, totalling 312 bytes in a DNS answer of 418 bytes. No further action needed."`
+
+		// Extensions holds the advice of the checks registered with Register,
+		// keyed by check name. Checks without advice aren't listed.
+		Extensions map[string][]string `json:"extensions,omitempty" yaml:"extensions,omitempty" doc:"The advice of the extension checks registered by a library embedding the scanner, keyed by check name." example:"{\"dane\":[\"Your mail servers publish TLSA records. No further action needed.\"]}"`
+
+		// Providers lists the known mail providers detected from the MX and SPF
+		// records, and the managed services hosting the DMARC or SPF record.
+		Providers []string `json:"providers,omitempty" yaml:"providers,omitempty" doc:"Mail providers detected from the MX and SPF records, and managed email authentication services detected from the CNAME the DMARC or SPF record is looked up through." example:"Microsoft 365"`
+
+		// CertificateReport holds the certificates behind the certificate advice.
+		CertificateReport *CertificateReport `json:"-" yaml:"-"`
+
+		// Registration holds the domain's registration behind its registration advice.
+		Registration *Registration `json:"-" yaml:"-"`
+
+		// SecurityContacts holds the domain's security contacts behind its security contact advice.
+		SecurityContacts *SecurityContacts `json:"-" yaml:"-"`
+
+		// Timings holds the wall-clock duration of each check, keyed by check name.
+		Timings map[string]string `json:"-" yaml:"-"`
+
+		// Errors holds the failure on the scanner's side (such as a proxy that
+		// couldn't be reached, or the check timing out) that kept each check
+		// from completing, keyed by check name. The check's advice is missing or
+		// partial, as the failure says nothing about the domain.
+		Errors map[string]error `json:"-" yaml:"-"`
+	}
+
+	// checkResult holds the outcome of a single check run by CheckAllInput.
+	checkResult struct {
+		name     string
+		advice   []string
+		err      error
+		duration time.Duration
 	}
 
 	// dmarc represents the structure of a DMARC record.
@@ -52,139 +149,348 @@ type (
 	}
 )
 
-func NewAdvisor(timeout time.Duration, cacheLifetime time.Duration, checkTLS bool) *Advisor {
+func NewAdvisor(timeout time.Duration, cacheLifetime time.Duration, checkTLS bool, opts ...Option) *Advisor {
 	advisor := Advisor{
-		checkTLS:             checkTLS,
-		consumerDomains:      make(map[string]struct{}),
-		consumerDomainsMutex: &sync.Mutex{},
-		dialer:               &net.Dialer{Timeout: timeout},
-		tlsCacheHost:         cache.New[[]string](cacheLifetime),
-		tlsCacheMail:         cache.New[[]string](cacheLifetime),
+		breaker:            newCircuitBreaker(DefaultBreakerFailures, DefaultBreakerCooldown),
+		caches:             make(map[string]namespaceCache),
+		cacheTTLs:          make(map[string]time.Duration),
+		checkTLS:           checkTLS,
+		dialer:             &net.Dialer{Timeout: timeout},
+		dkimRotationMonths: 12,
+		httpAttempts:       DefaultHTTPAttempts,
+		httpBackoff:        DefaultHTTPBackoff,
+		lookupHost:         net.DefaultResolver.LookupHost,
+		lookupMX:           net.DefaultResolver.LookupMX,
+		probes:             newProbeScheduler(),
+		proxy:              ProxyConfigFromEnvironment(),
+		smtp:               newSMTPPoliteness(0, 0),
+		subdomainAdvice:    true,
+		timeBudget:         DefaultTimeBudget,
+		timeout:            timeout,
+	}
+
+	for _, opt := range opts {
+		opt(&advisor)
+	}
+
+	// built once the options are applied, as their lifetimes may be overridden
+	advisor.mailDomainCache = newNamespaceCache[string](&advisor, CacheMailDomains, cacheLifetime)
+	advisor.tlsCacheHost = newNamespaceCache[[]string](&advisor, CacheHostTLS, cacheLifetime)
+	advisor.tlsCacheMail = newNamespaceCache[[]string](&advisor, CacheMailTLS, cacheLifetime)
+	advisor.tlsCacheMailCerts = newNamespaceCache[mailCertificate](&advisor, CacheMailCertificates, cacheLifetime)
+
+	// wrapped once the options are applied, so the middleware wraps whichever dialer was set
+	for _, wrap := range advisor.dialerMiddleware {
+		if dialer := wrap(advisor.dialer); dialer != nil {
+			advisor.dialer = dialer
+		}
+	}
+
+	// built once the options are applied, as they depend on the dialer and proxy
+	advisor.probeDialer = advisor.newProbeDialer()
+	if advisor.httpClient == nil {
+		advisor.httpClient = newHTTPClient(advisor.dialContext, advisor.httpProxy(), advisor.tlsConfig(""), timeout)
 	}
 
-	for _, domain := range consumerDomainList {
-		advisor.consumerDomains[domain] = struct{}{}
+	if advisor.ctURL != "" {
+		advisor.ctLog = newCTLog(advisor.ctURL, advisor.cacheTTL(CacheCertificates, ctCacheLifetime))
+		advisor.caches[CacheCertificates] = advisor.ctLog.cache
+	}
+
+	if advisor.rdapURL != "" {
+		advisor.rdap = newRDAPClient(advisor.rdapURL, advisor.rdapWindow, advisor.cacheTTL(CacheRegistrations, rdapCacheLifetime))
+		advisor.caches[CacheRegistrations] = advisor.rdap.cache
+	}
+
+	if advisor.securityTxtEnabled {
+		advisor.securityTxt = &securityTxtCache{cache: newNamespaceCache[securityTxt](&advisor, CacheSecurityContacts, securityTxtCacheLifetime)}
 	}
 
 	return &advisor
 }
 
+// Close stops the advisor's cache cleanup and closes any idle connections.
+func (a *Advisor) Close() {
+	for _, c := range a.caches {
+		c.Close()
+	}
+
+	a.httpClient.CloseIdleConnections()
+}
+
+// CheckAll runs every check without a deadline of its own.
+//
+// Deprecated: use CheckAllInput, whose named fields can't be swapped.
 func (a *Advisor) CheckAll(domain, bimi, dkim, dmarc string, mx []string, spf string) *Advice {
-	advice := &Advice{}
-	var wg sync.WaitGroup
-
-	wg.Add(6)
-	go func() {
-		advice.Domain = a.CheckDomain(domain)
-		wg.Done()
-	}()
-
-	go func() {
-		advice.BIMI = a.CheckBIMI(bimi)
-		wg.Done()
-	}()
-
-	go func() {
-		advice.DKIM = a.CheckDKIM(dkim)
-		wg.Done()
-	}()
-
-	go func() {
-		advice.DMARC = a.CheckDMARC(dmarc)
-		wg.Done()
-	}()
-
-	go func() {
-		advice.MX = a.CheckMX(mx)
-		wg.Done()
-	}()
-
-	go func() {
-		advice.SPF = a.CheckSPF(spf)
-		wg.Done()
-	}()
-
-	wg.Wait()
+	return a.CheckAllInput(context.Background(), ScanInput{Domain: domain, BIMI: bimi, DKIM: dkim, DMARC: dmarc, MX: mx, SPF: spf})
+}
 
-	return advice
+// CheckAllContext runs every check until the context is done.
+//
+// Deprecated: use CheckAllInput, whose named fields can't be swapped.
+func (a *Advisor) CheckAllContext(ctx context.Context, domain, bimi, dkim, dmarc string, mx []string, spf string) *Advice {
+	return a.CheckAllInput(ctx, ScanInput{Domain: domain, BIMI: bimi, DKIM: dkim, DMARC: dmarc, MX: mx, SPF: spf})
 }
 
-func (a *Advisor) CheckBIMI(bimi string) (advice []string) {
-	if len(bimi) == 0 {
-		return []string{"We couldn't detect any active BIMI record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}
+// CheckAllInput runs every check concurrently, including those registered
+// with Register, except those disabled with WithDisabledChecks, within the
+// domain's time budget (see WithTimeBudget). Any check that hasn't finished
+// once the context is done (or the advisor's check timeout elapses, or the
+// budget is spent) is abandoned, and has no advice. The checks that failed on
+// the scanner's side, including those abandoned, have their error set in the
+// advice's Errors. The advice is then tidied (see tidy), so repeated findings
+// are only reported once.
+//
+// An input that fails validation (see ScanInput.Validate) isn't checked at
+// all: the advice only has the error, under the misused record's check.
+func (a *Advisor) CheckAllInput(ctx context.Context, input ScanInput) *Advice {
+	if field, err := input.validate(); err != nil {
+		return &Advice{Errors: map[string]error{field: err}}
+	}
+
+	if a.checkTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.checkTimeout)
+		defer cancel()
+	}
+
+	// the entries cached by the checks are tagged with the domain, so they can be invalidated together
+	ctx = contextWithCacheTag(ctx, input.Domain)
+
+	providers := detectProviders(a.loadData().providers, input.MX, input.SPF)
+	input.Providers = providerNames(providers)
+
+	// the DMARC record is parsed once, as the SPF advice is tailored to its policy
+	dmarcRecord := parseDMARC(input.DMARC)
+
+	// a subdomain's advice is tailored to it, unless it's advised as an organizational domain
+	subdomain := a.SubdomainAdvice(input.Domain)
+
+	checks := a.checks(
+		bimiCheck{advisor: a, dmarc: dmarcRecord},
+		checkFunc{"dkim", func(ctx context.Context) ([]string, error) { return a.checkDKIM(input.DKIM, providers), nil }},
+		checkFunc{"dmarc", func(ctx context.Context) ([]string, error) {
+			if subdomain && input.DMARC == "" && input.OrganizationalDMARC != "" {
+				return a.CheckInheritedDMARC(input.Domain, OrganizationalDomain(input.Domain), input.OrganizationalDMARC), nil
+			}
+
+			return a.checkDMARC(input.DMARC, dmarcRecord), nil
+		}},
+		checkFunc{"domain", func(ctx context.Context) ([]string, error) { return a.checkDomain(ctx, input.Domain) }},
+		mxCheck{a},
+		checkFunc{"spf", func(ctx context.Context) ([]string, error) {
+			if subdomain && input.SPF == "" && !subdomainSendsMail(&input) {
+				return []string{subdomainSPFAdvice(&input)}, nil
+			}
+
+			return a.checkSPF(input.SPF, providers, dmarcRecord), nil
+		}},
+	)
+
+	if subdomain {
+		checks = slices.DeleteFunc(checks, func(check Check) bool { return a.skipsForSubdomain(check.Name(), &input) })
 	}
 
-	if strings.Contains(bimi, ";") {
-		bimiResult := strings.Split(bimi, ";")
-		var svgFound, vmcFound bool
+	// the checks share the domain's time budget, which bounds them all
+	var budget *timeBudget
+	if a.timeBudget > 0 {
+		names := make([]string, 0, len(checks))
+		for _, check := range checks {
+			names = append(names, check.Name())
+		}
 
-		for index, tag := range bimiResult {
-			tag = strings.TrimSpace(tag)
+		budget = newTimeBudget(a.timeBudget, names, time.Now)
 
-			if index == 0 && !strings.Contains(tag, "v=BIMI1") {
-				advice = append(advice, "The beginning of your BIMI record should be v=BIMI1 with specific capitalization.")
-			}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, a.timeBudget, ErrTimeBudgetExceeded)
+		defer cancel()
+	}
 
-			if strings.Contains(tag, "l=") {
-				svgFound = true
-				tagValue := strings.TrimPrefix(tag, "l=")
+	// each check reports back over the buffered channel, so the goroutines never write to the shared advice and
+	// abandoned checks can still exit
+	results := make(chan checkResult, len(checks))
+	start := time.Now()
 
-				// download SVG logo
-				response, err := http.Head(tagValue)
-				if err != nil || response == nil {
-					advice = append(advice, "Your SVG logo could not be downloaded.")
-					continue
-				}
-				defer response.Body.Close()
+	for _, check := range checks {
+		go func(check Check, input *ScanInput) {
+			checkCtx := ctx
+			if budget != nil {
+				checkCtx = contextWithBudget(ctx, budget, check.Name())
+			}
 
-				if response.StatusCode != http.StatusOK {
-					advice = append(advice, "Your SVG logo could not be downloaded.")
-					continue
-				}
+			checkStart := time.Now()
+			checkAdvice, err := check.Run(checkCtx, input)
 
-				if response.ContentLength > int64(32*1024) {
-					advice = append(advice, "Your SVG logo exceeds the maximum of 32KB.")
-				}
+			if budget != nil {
+				budget.finish(check.Name())
 			}
 
-			if strings.Contains(tag, "a=") {
-				vmcFound = true
-				tagValue := strings.TrimPrefix(tag, "a=")
+			results <- checkResult{name: check.Name(), advice: checkAdvice, err: err, duration: time.Since(checkStart)}
+		}(check, input.clone())
+	}
+
+	advice := &Advice{Providers: input.Providers, Timings: make(map[string]string, len(checks)), Errors: make(map[string]error)}
+	completed := make(map[string]struct{}, len(checks))
 
-				// download VMC cert
-				response, err := http.Head(tagValue)
-				if err != nil || response == nil {
-					advice = append(advice, "Your VMC certificate could not be downloaded.")
-					continue
-				}
-				defer response.Body.Close()
+collect:
+	for len(completed) < len(checks) {
+		select {
+		case result := <-results:
+			completed[result.name] = struct{}{}
+			advice.set(result.name, result.advice)
+			advice.Timings[result.name+"_check"] = result.duration.Round(time.Microsecond).String()
 
-				if response.StatusCode != http.StatusOK {
-					advice = append(advice, "Your VMC certificate could not be downloaded.")
+			if result.err != nil {
+				advice.Errors[result.name] = result.err
+			}
+		case <-ctx.Done():
+			elapsed := time.Since(start).Round(time.Millisecond)
+
+			for _, check := range checks {
+				if _, ok := completed[check.Name()]; ok {
 					continue
 				}
+
+				advice.Errors[check.Name()] = abandonedError(ctx, elapsed.String())
+				advice.Timings[check.Name()+"_check"] = elapsed.String()
 			}
+
+			break collect
 		}
+	}
+
+	// mail that can't align would fail DMARC under any policy, which is worth knowing before the policy is raised
+	if !slices.Contains(a.disabledChecks, "dmarc") {
+		advice.DMARC = append(a.checkAlignment(input.Domain, input.DKIM, dmarcRecord, input.SPF, nil), advice.DMARC...)
+	}
+
+	a.tidy(advice, input.MX)
+
+	return advice
+}
 
-		if !svgFound {
-			advice = append(advice, "Your BIMI record is missing the SVG logo URL.")
+// set assigns the advice for the named check to the matching field, or to
+// the extensions for a registered check.
+func (a *Advice) set(name string, advice []string) {
+	switch name {
+	case "bimi":
+		a.BIMI = advice
+	case "dkim":
+		a.DKIM = advice
+	case "dmarc":
+		a.DMARC = advice
+	case "domain":
+		a.Domain = advice
+	case "mx":
+		a.MX = advice
+	case "spf":
+		a.SPF = advice
+	default:
+		if len(advice) == 0 {
+			return
 		}
 
-		if !vmcFound {
-			advice = append(advice, "Your BIMI record is missing the VMC cert URL.")
+		if a.Extensions == nil {
+			a.Extensions = make(map[string][]string)
 		}
-	} else {
-		advice = append(advice, "Your BIMI record appears to be malformed as no semicolons seem to be present.")
+
+		a.Extensions[name] = advice
 	}
+}
 
-	if len(advice) == 0 {
-		return []string{"Your BIMI record looks good! No further action needed."}
+// CheckBIMI returns the advice for the BIMI record on its own, without the
+// error of any asset download that failed on the scanner's side.
+func (a *Advisor) CheckBIMI(bimi string) []string {
+	advice, _ := a.checkBIMI(context.Background(), bimi)
+	return advice
+}
+
+func (a *Advisor) checkBIMI(ctx context.Context, bimi string) ([]string, error) {
+	if len(bimi) == 0 {
+		return []string{"We couldn't detect any active BIMI record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}, nil
 	}
 
-	// prepend a message detailing that the BIMI record has some issues
-	advice = append([]string{"Your BIMI record has some issues:"}, advice...)
+	record := parseBIMI(bimi)
+	advice := record.Advice
 
-	return advice
+	if a.isOffline(ctx) {
+		var skipped []string
+
+		if record.Logo != "" {
+			skipped = append(skipped, skippedOffline("The download of your SVG logo"))
+		}
+
+		if record.Certificate != "" {
+			skipped = append(skipped, skippedOffline("The download of your VMC certificate"))
+		}
+
+		return append(summarizeBIMI(advice), skipped...), nil
+	}
+
+	// assets whose hosts are unavailable are reported after the summary, as they may still be fine
+	var (
+		unavailable []string
+		errs        []error
+	)
+
+	// the assets are downloaded in turn, until the check's slice of the time budget runs out
+	type download struct {
+		response *http.Response
+		err      error
+	}
+
+	var assets []string
+
+	for _, asset := range []string{record.Logo, record.Certificate} {
+		if asset != "" {
+			assets = append(assets, asset)
+		}
+	}
+
+	downloads, skipped := probeWithin(ctx, assets, func(ctx context.Context, asset string) download {
+		response, err := a.headURL(ctx, asset)
+		return download{response, err}
+	})
+
+	if logo, ok := downloads[record.Logo]; ok && record.Logo != "" {
+		// download SVG logo
+		response, err := logo.response, logo.err
+		if err != nil {
+			if unavailableAdvice, ok := unavailableAdvice("Your SVG logo", err); ok {
+				unavailable = append(unavailable, unavailableAdvice)
+			} else if isInfrastructureError(ctx, err) {
+				errs = append(errs, fmt.Errorf("SVG logo: %w", err))
+			} else {
+				advice = append(advice, "Your SVG logo could not be downloaded.")
+			}
+		} else if response.StatusCode != http.StatusOK {
+			advice = append(advice, "Your SVG logo could not be downloaded.")
+		} else if response.ContentLength > int64(32*1024) {
+			advice = append(advice, "Your SVG logo exceeds the maximum of 32KB.")
+		}
+	}
+
+	if certificate, ok := downloads[record.Certificate]; ok && record.Certificate != "" {
+		// download VMC cert
+		response, err := certificate.response, certificate.err
+		if err != nil {
+			if unavailableAdvice, ok := unavailableAdvice("Your VMC certificate", err); ok {
+				unavailable = append(unavailable, unavailableAdvice)
+			} else if isInfrastructureError(ctx, err) {
+				errs = append(errs, fmt.Errorf("VMC certificate: %w", err))
+			} else {
+				advice = append(advice, "Your VMC certificate could not be downloaded.")
+			}
+		} else if response.StatusCode != http.StatusOK {
+			advice = append(advice, "Your VMC certificate could not be downloaded.")
+		}
+	}
+
+	if len(skipped) > 0 {
+		errs = append(errs, budgetError(skipped, len(assets), "BIMI asset"))
+	}
+
+	return append(summarizeBIMI(advice), unavailable...), errors.Join(errs...)
 }
 
 func (a *Advisor) CheckDKIM(dkim string) (advice []string) {
@@ -192,6 +498,10 @@ func (a *Advisor) CheckDKIM(dkim string) (advice []string) {
 		return []string{"We couldn't detect any active DKIM record for your domain. Due to how DKIM works, we only lookup common/known DKIM selectors (such as x, selector1, google). Visit https://dmarcguide.globalcyberalliance.org for more info on how to configure DKIM for your domain."}
 	}
 
+	if advice := typoAdvice(lookalike.DKIM, dkim); advice != nil {
+		return advice
+	}
+
 	if strings.Contains(dkim, ";") {
 		dkimResult := strings.Split(dkim, ";")
 
@@ -204,8 +514,8 @@ func (a *Advisor) CheckDKIM(dkim string) (advice []string) {
 					advice = append(advice, "The beginning of your DKIM record should be v=DKIM1 with specific capitalization.")
 				}
 			case 1:
-				if !strings.Contains(tag, "k=rsa") && !strings.Contains(tag, "a=rsa-sha256") {
-					advice = append(advice, "The second tag in your DKIM record must be k=rsa or a=rsa=sha256.")
+				if !strings.Contains(tag, "k=rsa") && !strings.Contains(tag, "k=ed25519") && !strings.Contains(tag, "a=rsa-sha256") {
+					advice = append(advice, "The second tag in your DKIM record must be k=rsa, k=ed25519 or a=rsa=sha256.")
 				}
 			case 2:
 				if !strings.Contains(tag, "p=") {
@@ -224,16 +534,44 @@ func (a *Advisor) CheckDKIM(dkim string) (advice []string) {
 	return advice
 }
 
-func (a *Advisor) CheckDMARC(record string) (advice []string) {
+func (a *Advisor) CheckDMARC(record string) []string {
+	return a.checkDMARC(record, parseDMARC(record))
+}
+
+// checkDMARC returns the advice for the DMARC record, given its parsed form
+// (as returned by parseDMARC).
+func (a *Advisor) checkDMARC(record string, dmarcRecord *dmarc) []string {
 	if record == "" {
 		return []string{"You do not have DMARC setup!"}
 	}
 
-	if !strings.Contains(record, ";") {
+	if advice := typoAdvice(lookalike.DMARC, record); advice != nil {
+		return advice
+	}
+
+	if dmarcRecord == nil {
 		return []string{"Your DMARC record appears to be malformed as no semicolons seem to be present."}
 	}
 
-	dmarcRecord := dmarc{}
+	if addressAdvice := a.checkReportAddresses(dmarcRecord); len(addressAdvice) > 0 {
+		// the parsed record may be shared with other checks, so its advice is copied rather than appended to
+		return append(append([]string{}, dmarcRecord.Advice...), addressAdvice...)
+	}
+
+	return dmarcRecord.Advice
+}
+
+// parseDMARC parses a DMARC record's tags, along with the advice on each of
+// them. It returns nil if there's no usable record, such as if it's missing,
+// contains a typo or is malformed.
+func parseDMARC(record string) *dmarc {
+	if record == "" || typoAdvice(lookalike.DMARC, record) != nil || !strings.Contains(record, ";") {
+		return nil
+	}
+
+	// pct defaults to 100 when it isn't specified
+	dmarcRecord := &dmarc{Percentage: 100}
+	validPercentage := true
 	parts := strings.Split(record, ";")
 	ruaExists := strings.Contains(record, "rua=")
 
@@ -292,29 +630,33 @@ func (a *Advisor) CheckDMARC(record string) (advice []string) {
 			pct, err := strconv.Atoi(value)
 			if err != nil || pct < 0 || pct > 100 {
 				dmarcRecord.Advice = append(dmarcRecord.Advice, "Invalid report percentage specified, it must be between 0 and 100.")
+				validPercentage = false
 			}
 
 			dmarcRecord.Percentage = pct
 		case "rua":
 			dmarcRecord.AggregateReportDestination = strings.Split(value, ",")
 			for _, destination := range dmarcRecord.AggregateReportDestination {
-				if !strings.HasPrefix(destination, "mailto:") {
+				mailbox, ok := reportMailbox(destination)
+				if !ok {
 					dmarcRecord.Advice = append(dmarcRecord.Advice, "Invalid aggregate report destination specified, it should begin with mailto:.")
+					mailbox = strings.TrimSpace(destination)
 				}
 
-				if !validateEmail(strings.TrimPrefix(destination, "mailto:")) {
+				if !validateEmail(mailbox) {
 					dmarcRecord.Advice = append(dmarcRecord.Advice, "Invalid aggregate report destination specified, it should be a valid email address.")
 				}
 			}
 		case "ruf":
 			dmarcRecord.ForensicReportDestination = strings.Split(value, ",")
 			for _, destination := range dmarcRecord.ForensicReportDestination {
-				if !strings.HasPrefix(destination, "mailto:") {
+				mailbox, ok := reportMailbox(destination)
+				if !ok {
 					dmarcRecord.Advice = append(dmarcRecord.Advice, "Invalid forensic report destination specified, it should begin with mailto:.")
 					continue
 				}
 
-				if !validateEmail(strings.TrimPrefix(destination, "mailto:")) {
+				if !validateEmail(mailbox) {
 					dmarcRecord.Advice = append(dmarcRecord.Advice, "Invalid forensic report destination specified, it should be a valid email address.")
 				}
 			}
@@ -357,241 +699,253 @@ func (a *Advisor) CheckDMARC(record string) (advice []string) {
 		dmarcRecord.Advice = append(dmarcRecord.Advice, "Subdomain policy isn't specified, they'll default to the main policy instead.")
 	}
 
-	return dmarcRecord.Advice
-}
-
-func (a *Advisor) CheckDomain(domain string) (advice []string) {
-	a.consumerDomainsMutex.Lock()
-	if _, ok := a.consumerDomains[domain]; ok {
-		a.consumerDomainsMutex.Unlock()
-		return []string{"Consumer based accounts (i.e gmail.com, yahoo.com, etc) are controlled by the vendor. They are responsible for setting DKIM, SPF and DMARC capabilities on their domains."}
-	}
-	a.consumerDomainsMutex.Unlock()
-
-	if a.checkTLS {
-		advice = append(advice, a.checkHostTLS(domain, 443)...)
+	if validPercentage {
+		dmarcRecord.Advice = append(dmarcRecord.Advice, partialPolicyAdvice(dmarcRecord)...)
 	}
 
-	if len(advice) == 0 {
-		return []string{"Your domain looks good! No further action needed."}
-	}
+	return dmarcRecord
+}
 
+// CheckDomain returns the advice for the domain on its own, without the
+// error of a TLS check that failed on the scanner's side.
+func (a *Advisor) CheckDomain(domain string) []string {
+	advice, _ := a.checkDomain(context.Background(), domain)
 	return advice
 }
 
-func (a *Advisor) CheckMX(mx []string) (advice []string) {
-	switch len(mx) {
-	case 0:
-		return []string{"You do not have any mail servers setup, so you cannot receive email at this domain."}
-	case 1:
-		advice = []string{"You have a single mail server setup, but it's recommended that you have at least two setup in case the first one fails."}
-	default:
-		advice = []string{"You have multiple mail servers setup, which is recommended."}
+func (a *Advisor) checkDomain(ctx context.Context, domain string) ([]string, error) {
+	if _, ok := a.loadData().consumerDomains[normalizeDomain(domain)]; ok {
+		return []string{"Consumer based accounts (i.e gmail.com, yahoo.com, etc) are controlled by the vendor. They are responsible for setting DKIM, SPF and DMARC capabilities on their domains."}, nil
 	}
 
-	if a.checkTLS {
-		for _, serverAddress := range mx {
-			// prepend the hostname to the advice line
-			mxAdvice := a.checkMailTls(serverAddress)
-			for _, serverAdvice := range mxAdvice {
-				// strip the trailing dot from DNS records
-				advice = append(advice, serverAddress[:len(serverAddress)-1]+": "+serverAdvice)
-			}
+	var advice []string
+
+	if a.tlsEnabled(ctx) {
+		hostname, ok := normalizeHostname(domain)
+		if !ok {
+			return []string{"Your domain name appears to be malformed."}, nil
 		}
 
-		counter := 0
-		for index, adviceItem := range advice {
-			if len(mx) == 1 && index == 0 {
-				continue
-			}
+		if a.isOffline(ctx) {
+			return []string{skippedOffline("The TLS check of your domain")}, nil
+		}
 
-			if strings.Contains(adviceItem, "no further action needed") {
-				counter++
-			}
+		type hostTLS struct {
+			advice []string
+			err    error
+		}
+
+		probed, skipped := probeWithin(ctx, []string{hostname}, func(ctx context.Context, hostname string) hostTLS {
+			hostAdvice, err := a.checkHostTLS(ctx, hostname, 443)
+			return hostTLS{hostAdvice, err}
+		})
+
+		// the domain's TLS is unknown, so it can't be said to look good
+		if len(skipped) > 0 {
+			return nil, budgetError(skipped, 1, "web host")
 		}
 
-		if counter == len(advice) {
-			return []string{"All of your domains are using TLS 1.3, no further action needed!"}
+		if err := probed[hostname].err; err != nil {
+			return nil, err
 		}
+
+		advice = append(advice, probed[hostname].advice...)
 	}
 
 	if len(advice) == 0 {
-		return []string{"You have a multiple mail servers setup! No further action needed."}
+		return []string{"Your domain looks good! No further action needed."}, nil
 	}
 
+	return advice, nil
+}
+
+// CheckMX returns the advice for the MX records on its own, without the
+// errors of any TLS checks that failed on the scanner's side.
+func (a *Advisor) CheckMX(mx []string) []string {
+	advice, _ := a.checkMX(context.Background(), mx)
 	return advice
 }
 
-func (a *Advisor) CheckSPF(spf string) []string {
-	if spf == "" {
-		return []string{"We couldn't detect any active SPF record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}
+func (a *Advisor) checkMX(ctx context.Context, mx []string) ([]string, error) {
+	advice := lintMX(mx)
+	if len(mx) == 0 || !a.tlsEnabled(ctx) {
+		return advice, nil
 	}
 
-	if strings.Contains(spf, "all") {
-		if strings.Contains(spf, "+all") {
-			return []string{"Your SPF record contains the +all tag. It is strongly recommended that this be changed to either -all or ~all. The +all tag allows for any system regardless of SPF to send mail on the organization’s behalf."}
-		}
-	} else {
-		return []string{"Your SPF record is missing the all tag. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}
+	if a.isOffline(ctx) {
+		return append(advice, skippedOffline("The TLS check of your mail servers")), nil
 	}
 
-	return []string{"SPF seems to be setup correctly! No further action needed."}
-}
+	// every probe would fail if the scanning host can't reach port 25, which says nothing about the mail servers
+	if a.port25Blocked(ctx) {
+		return append(advice, port25BlockedAdvice()), nil
+	}
 
-func (a *Advisor) checkHostTLS(hostname string, port int) (advice []string) {
-	// strip the trailing dot from DNS records
-	if string(hostname[len(hostname)-1]) == "." {
-		hostname = hostname[:len(hostname)-1]
+	var (
+		hostnames  []string
+		hostAdvice []string
+		errs       []error
+	)
+
+	for _, serverAddress := range mx {
+		if hostname, ok := normalizeHostname(serverAddress); ok {
+			hostnames = append(hostnames, hostname)
+		}
 	}
 
-	// check if the advice is already in the cache
-	tlsAdvice := a.tlsCacheHost.Get(hostname)
-	if tlsAdvice != nil {
-		return *tlsAdvice
+	// the hosts are probed in turn, until the check's slice of the time budget runs out
+	type mailTLS struct {
+		advice []string
+		err    error
 	}
 
-	// set the advice in the cache after the function returns
-	defer func() {
-		a.tlsCacheHost.Set(hostname, &advice)
-	}()
+	probed, skipped := probeWithin(ctx, hostnames, func(ctx context.Context, hostname string) mailTLS {
+		mxAdvice, err := a.checkMailTls(ctx, hostname)
+		return mailTLS{mxAdvice, err}
+	})
 
-	if port == 0 {
-		port = 443
-	}
+	// the summary would vouch for the hosts that weren't probed
+	allTLS13 := len(skipped) == 0
 
-	conn, err := tls.DialWithDialer(a.dialer, "tcp", hostname+":"+cast.ToString(port), nil)
-	if err != nil {
-		if strings.Contains(err.Error(), "no such host") {
-			// fill variable to satisfy deferred cache fill
-			advice = []string{hostname + " could not be reached"}
-			return advice
+	for _, hostname := range hostnames {
+		result, ok := probed[hostname]
+		if !ok {
+			continue
 		}
 
-		if strings.Contains(err.Error(), "certificate is not trusted") || strings.Contains(err.Error(), "failed to verify certificate") {
-			advice = append(advice, "No valid certificate could be found.")
+		mxAdvice, err := result.advice, result.err
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", hostname, err))
+		}
 
-			conn, err = tls.DialWithDialer(a.dialer, "tcp", hostname+":"+cast.ToString(port), &tls.Config{InsecureSkipVerify: true})
-			if err != nil {
-				return advice
+		if len(mxAdvice) == 0 {
+			allTLS13 = false
+		}
+
+		// prepend the hostname to the advice line
+		for _, serverAdvice := range mxAdvice {
+			if serverAdvice != checkTLSVersion(tls.VersionTLS13) {
+				allTLS13 = false
 			}
-		} else {
-			return []string{"Failed to reach domain: " + err.Error()}
+
+			hostAdvice = append(hostAdvice, hostname+": "+serverAdvice)
 		}
 	}
-	defer conn.Close()
 
-	advice = append(advice, checkTLSVersion(conn.ConnectionState().Version))
+	if len(skipped) > 0 {
+		errs = append(errs, budgetError(skipped, len(hostnames), "MX host"))
+	}
 
-	return advice
+	// only collapse the per-host lines if every probed host reported TLS 1.3
+	if allTLS13 && len(hostAdvice) > 0 && !a.detailed {
+		return append(advice, "All of your mail servers are using TLS 1.3, no further action needed!"), errors.Join(errs...)
+	}
+
+	return append(advice, hostAdvice...), errors.Join(errs...)
+}
+
+// CheckSPF returns the advice for the SPF record on its own. CheckAll also
+// tailors the advice on the record's all qualifier to the domain's DMARC
+// policy.
+func (a *Advisor) CheckSPF(spf string) []string {
+	return a.checkSPFRecord(spf, nil, false)
 }
 
-func (a *Advisor) checkMailTls(hostname string) (advice []string) {
-	// strip the trailing dot from DNS records
-	if string(hostname[len(hostname)-1]) == "." {
-		hostname = hostname[:len(hostname)-1]
+// checkSPFRecord returns the advice for the SPF record. If dmarcKnown, the
+// advice on its all qualifier depends on the domain's DMARC record (nil if it
+// has no usable record): -all is only safe once DMARC is enforced, as some
+// receivers reject mail failing SPF before evaluating DMARC, which loses
+// legitimate forwarded mail.
+func (a *Advisor) checkSPFRecord(spf string, dmarcRecord *dmarc, dmarcKnown bool) []string {
+	if spf == "" {
+		return []string{"We couldn't detect any active SPF record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}
 	}
 
-	// check if the advice is already in the cache
-	tlsAdvice := a.tlsCacheMail.Get(hostname)
-	if tlsAdvice != nil {
-		return *tlsAdvice
+	if advice := typoAdvice(lookalike.SPF, spf); advice != nil {
+		return advice
 	}
 
-	// set the advice in the cache after the function returns
-	defer func() {
-		a.tlsCacheMail.Set(hostname, &advice)
-	}()
+	// a redirect only applies to a record without an all mechanism, so it doesn't need one
+	if redirect := spfRedirect(spf); redirect != "" {
+		if spfAllQualifier(spf) == "" {
+			return []string{fmt.Sprintf("Your SPF record hands its policy over to %s with its redirect= modifier, so the SPF record of %s applies to your mail, and yours doesn't need an all tag. No further action needed.", redirect, redirect)}
+		}
 
-	conn, err := a.dialer.Dial("tcp", hostname+":25")
-	if err != nil {
-		// fill variable to satisfy deferred cache fill
-		if strings.Contains(err.Error(), "i/o timeout") {
-			advice = []string{"Failed to reach domain before timeout"}
-		} else {
-			advice = []string{"Failed to reach domain"}
+		advice := []string{fmt.Sprintf("Your SPF record has both an all tag and a redirect= modifier, so its redirect to %s is never used, as receivers only follow a redirect if no other mechanism matches (RFC 7208, section 6.1). Remove the redirect= modifier, or the all tag if the SPF record of %s should apply.", redirect, redirect)}
+		if allAdvice := a.checkSPFAll(spf, dmarcRecord, dmarcKnown); allAdvice[0] != spfLooksGood {
+			advice = append(advice, allAdvice...)
 		}
 
 		return advice
 	}
-	defer conn.Close()
 
-	client, err := smtp.NewClient(conn, hostname)
-	if err != nil {
-		// fill variable to satisfy deferred cache fill
-		advice = []string{"Failed to reach domain"}
-		return advice
-	}
+	return a.checkSPFAll(spf, dmarcRecord, dmarcKnown)
+}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: false,
-		ServerName:         hostname,
+// checkSPFAll returns the advice for the all qualifier of the SPF record, as
+// described by checkSPFRecord.
+func (a *Advisor) checkSPFAll(spf string, dmarcRecord *dmarc, dmarcKnown bool) []string {
+	if strings.Contains(spf, "all") {
+		if strings.Contains(spf, "+all") {
+			return []string{"Your SPF record contains the +all tag. It is strongly recommended that this be changed to either -all or ~all. The +all tag allows for any system regardless of SPF to send mail on the organization’s behalf."}
+		}
+	} else {
+		return []string{"Your SPF record is missing the all tag. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}
 	}
 
-	if err = client.StartTLS(tlsConfig); err != nil {
-		if strings.Contains(err.Error(), "certificate is not trusted") || strings.Contains(err.Error(), "failed to verify certificate") {
-			advice = append(advice, "No valid certificate could be found.")
-
-			// close the existing connection and create a new one as we can't reuse it in the same way as the checkHostTLS function
-			if err = conn.Close(); err != nil {
-				// fill variable to satisfy deferred cache fill
-				advice = append(advice, "Failed to re-attempt connection without certificate verification")
-				return advice
-			}
+	if dmarcKnown {
+		// reports are needed to confirm that legitimate mail (including forwarded mail) still passes DMARC
+		enforced := dmarcRecord != nil && EffectiveDMARCPolicy(dmarcRecord.Policy, dmarcRecord.Percentage).Reject == 100 && len(dmarcRecord.AggregateReportDestination) > 0
 
-			conn, err = a.dialer.Dial("tcp", hostname+"25")
-			if err != nil {
-				// fill variable to satisfy deferred cache fill
-				advice = []string{"Failed to reach domain"}
-				return advice
-			}
-			defer conn.Close()
-
-			client, err = smtp.NewClient(conn, hostname)
-			if err != nil {
-				// fill variable to satisfy deferred cache fill
-				advice = []string{"Failed to reach domain"}
-				return advice
-			}
-
-			// retry with InsecureSkipVerify
-			tlsConfig.InsecureSkipVerify = true
-			if err = client.StartTLS(tlsConfig); err != nil {
-				// fill variable to satisfy deferred cache fill
-				advice = append(advice, "Failed to start TLS connection")
-				return advice
-			}
-		} else {
-			// fill variable to satisfy deferred cache fill
-			advice = []string{"Failed to start TLS connection: " + err.Error()}
-			return advice
+		switch qualifier := spfAllQualifier(spf); {
+		case qualifier == "-" && enforced:
+			return []string{"Your SPF record ends in -all, which is safe as your DMARC policy is p=reject and you receive aggregate reports to catch any legitimate mail that fails. No further action needed."}
+		case qualifier == "-":
+			return []string{"Your SPF record ends in -all, but your DMARC policy isn't enforced at p=reject with aggregate reports. Some receivers reject mail that fails SPF before evaluating DMARC, so legitimate mail sent via forwarders (such as mailing lists) may be lost. Consider ~all until your DMARC policy is p=reject and its reports confirm your legitimate mail passes."}
+		case qualifier == "~" && enforced:
+			return []string{"Your SPF record ends in ~all. As your DMARC policy is p=reject and you receive aggregate reports, you can move to -all once the reports confirm all of your legitimate mail passes SPF."}
+		case qualifier == "~":
+			return []string{"Your SPF record ends in ~all, which is the safer choice while your DMARC policy isn't enforced at p=reject, as -all risks losing forwarded mail. No further action needed."}
 		}
 	}
 
-	if state, ok := client.TLSConnectionState(); ok {
-		advice = append(advice, checkTLSVersion(state.Version))
+	return []string{spfLooksGood}
+}
+
+// spfAllQualifier returns the qualifier of the SPF record's all mechanism
+// (such as "-" or "~"), or "" if it has none.
+func spfAllQualifier(spf string) string {
+	for _, term := range strings.Fields(strings.ToLower(spf)) {
+		switch term {
+		case "all", "+all":
+			return "+"
+		case "-all", "~all", "?all":
+			return term[:1]
+		}
 	}
 
-	return advice
+	return ""
 }
 
-func checkTLSVersion(tlsVersion uint16) string {
-	switch tlsVersion {
-	case tls.VersionTLS10:
-		return "Your domain is using TLS version 1.0 which is outdated, and should be upgraded to TLS 1.3."
-	case tls.VersionTLS11:
-		return "Your domain is using TLS version 1.1 which is outdated, and should be upgraded to TLS 1.3."
-	case tls.VersionTLS12:
-		return "Your domain is using TLS version 1.2, and should be upgraded to TLS 1.3."
-	case tls.VersionTLS13:
-		return "Your domain is using TLS 1.3, no further action needed!"
+// normalizeHostname trims surrounding whitespace and at most one trailing dot
+// from a hostname (as returned in DNS records). It returns false if nothing
+// usable remains.
+func normalizeHostname(hostname string) (string, bool) {
+	hostname = strings.TrimSpace(hostname)
+	hostname = strings.TrimSuffix(hostname, ".")
+	hostname = strings.TrimSpace(hostname)
+
+	if hostname == "" || strings.HasSuffix(hostname, ".") {
+		return "", false
 	}
 
-	return "Your domain is using an unrecognized version of TLS, you should verify that it's using TLS 1.3 or above."
+	return hostname, true
 }
 
-func validateEmail(email string) bool {
-	if len(email) < 3 || len(email) > 254 {
-		return false
-	}
-	return emailRegex.MatchString(email)
+// normalizeDomain normalizes a domain as normalizeHostname does, and
+// lowercases it, for comparing domains. It returns an empty string if nothing
+// usable remains.
+func normalizeDomain(domain string) string {
+	hostname, _ := normalizeHostname(domain)
+	return strings.ToLower(hostname)
 }
@@ -1,11 +1,292 @@
 package advisor
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
 )
 
+func TestAdvisor_CheckAll(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	advice := advisor.CheckAll("example.com", "", "", "v=DMARC1; p=none;", []string{"mx.example.com."}, "v=spf1 -all")
+
+	if !reflect.DeepEqual(advice.DMARC, advisor.CheckDMARC("v=DMARC1; p=none;")) {
+		t.Errorf("found %v, want %v", advice.DMARC, advisor.CheckDMARC("v=DMARC1; p=none;"))
+	}
+
+	for _, name := range []string{"bimi_check", "dkim_check", "dmarc_check", "domain_check", "mx_check", "spf_check"} {
+		if _, ok := advice.Timings[name]; !ok {
+			t.Errorf("missing timing for %s in %v", name, advice.Timings)
+		}
+	}
+}
+
+func TestAdvisor_CheckAllInput(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("Valid", func(t *testing.T) {
+		input := ScanInput{Domain: "example.com", DMARC: "v=DMARC1; p=none;", MX: []string{"aspmx.l.google.com."}, SPF: "v=spf1 -all", Providers: []string{"Stale"}}
+		advice := advisor.CheckAllInput(context.Background(), input)
+
+		// the shim passes the same records positionally
+		if expected := advisor.CheckAll("example.com", "", "", "v=DMARC1; p=none;", []string{"aspmx.l.google.com."}, "v=spf1 -all"); !reflect.DeepEqual(advice.DMARC, expected.DMARC) || !reflect.DeepEqual(advice.MX, expected.MX) {
+			t.Errorf("found %v and %v, want %v and %v", advice.DMARC, advice.MX, expected.DMARC, expected.MX)
+		}
+
+		if !reflect.DeepEqual(advice.Providers, []string{"Google Workspace"}) {
+			t.Errorf("found %v, want the detected providers", advice.Providers)
+		}
+	})
+
+	t.Run("Swapped", func(t *testing.T) {
+		advice := advisor.CheckAllInput(context.Background(), ScanInput{Domain: "example.com", DKIM: "v=DMARC1; p=none;", DMARC: "v=DKIM1; k=rsa; p=KEY"})
+
+		if err := advice.Errors["dkim"]; !errors.Is(err, ErrSwappedInput) || !strings.Contains(err.Error(), "the DKIM record is a DMARC record") {
+			t.Errorf("found %v, want the swapped records' error", err)
+		}
+
+		if advice.DKIM != nil || advice.DMARC != nil || len(advice.Errors) != 1 {
+			t.Errorf("found %v, %v and %v, want only the error", advice.DKIM, advice.DMARC, advice.Errors)
+		}
+	})
+}
+
+func TestAdvisor_CheckAllInputBIMIEnforcement(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false, WithDialer(panickingDialer{}), WithHTTPClient(&http.Client{Transport: panickingTransport{}}))
+	ctx := ContextWithChecks(context.Background(), CheckOffline)
+
+	const (
+		record    = "v=BIMI1; l=https://bimi.example.com/logo.svg; a=https://bimi.example.com/cert.pem"
+		honored   = "Receivers only display BIMI logos for domains with a DMARC policy of p=quarantine or p=reject at pct=100."
+		skipped   = "The download of your SVG logo"
+		unhonored = "Your BIMI record will not be honored because "
+	)
+
+	tests := []struct {
+		name         string
+		dmarc        string
+		organization string
+		reason       string
+	}{
+		{name: "None", dmarc: "v=DMARC1; p=none", reason: "your DMARC policy is p=none"},
+		{name: "Quarantine", dmarc: "v=DMARC1; p=quarantine; pct=100"},
+		{name: "Reject", dmarc: "v=DMARC1; p=reject"},
+		{name: "PartialReject", dmarc: "v=DMARC1; p=reject; pct=50", reason: "your DMARC policy only applies to 50% of your mail (pct=50)"},
+		{name: "NoQuarantine", dmarc: "v=DMARC1; p=quarantine; pct=0", reason: "your DMARC policy only applies to 0% of your mail (pct=0)"},
+		{name: "InvalidPolicy", dmarc: "v=DMARC1; p=block", reason: "your DMARC record has no valid policy"},
+		{name: "NoRecord", reason: "your domain has no valid DMARC record"},
+		{name: "OrganizationalNone", organization: "v=DMARC1; p=reject; sp=none", reason: "your DMARC policy is sp=none"},
+		{name: "OrganizationalReject", organization: "v=DMARC1; p=none; sp=reject"},
+		{name: "OrganizationalPolicy", organization: "v=DMARC1; p=reject"},
+		{name: "OwnRecord", dmarc: "v=DMARC1; p=reject", organization: "v=DMARC1; p=none"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckAllInput(ctx, ScanInput{Domain: "mail.example.com", BIMI: record, DMARC: test.dmarc, OrganizationalDMARC: test.organization})
+
+			if test.reason == "" {
+				if advice.BIMI[0] != bimiLooksGood {
+					t.Errorf("found %v, want the record to look good", advice.BIMI)
+				}
+
+				return
+			}
+
+			if expected := unhonored + test.reason + ". " + honored; advice.BIMI[0] != expected {
+				t.Errorf("found %q, want %q", advice.BIMI[0], expected)
+			}
+
+			if len(advice.BIMI) != 3 || !strings.HasPrefix(advice.BIMI[1], skipped) {
+				t.Errorf("found %v, want the finding to replace the record looking good", advice.BIMI)
+			}
+
+			if severity := Classify(advice.BIMI[0]); severity != SeverityLow {
+				t.Errorf("found %v, want %v", severity, SeverityLow)
+			}
+		})
+	}
+
+	t.Run("Issues", func(t *testing.T) {
+		advice := advisor.CheckAllInput(ctx, ScanInput{Domain: "example.com", BIMI: "v=BIMI1; l=http://bimi.example.com/logo.svg", DMARC: "v=DMARC1; p=none"})
+
+		if len(advice.BIMI) < 2 || !strings.HasPrefix(advice.BIMI[0], unhonored) || advice.BIMI[1] != "Your BIMI record has some issues:" {
+			t.Errorf("found %v, want the finding before the record's issues", advice.BIMI)
+		}
+	})
+
+	t.Run("NoBIMI", func(t *testing.T) {
+		advice := advisor.CheckAllInput(ctx, ScanInput{Domain: "example.com", DMARC: "v=DMARC1; p=none"})
+
+		if !reflect.DeepEqual(advice.BIMI, advisor.CheckBIMI("")) {
+			t.Errorf("found %v, want %v", advice.BIMI, advisor.CheckBIMI(""))
+		}
+	})
+}
+
+// wrappedDialer is a dialer wrapped by a middleware, named by the order it was wrapped in.
+type wrappedDialer struct {
+	Dialer
+	name string
+}
+
+func TestWithDialerMiddleware(t *testing.T) {
+	inner := &blockingDialer{}
+
+	var wrapped []Dialer
+
+	wrap := func(name string) func(next Dialer) Dialer {
+		return func(next Dialer) Dialer {
+			wrapped = append(wrapped, next)
+			return &wrappedDialer{Dialer: next, name: name}
+		}
+	}
+
+	// the middleware wraps the dialer set with WithDialer, even if it's given first
+	advisor := NewAdvisor(time.Second, time.Second, false, WithDialerMiddleware(wrap("first")), WithDialer(inner), WithDialerMiddleware(wrap("second")), WithDialerMiddleware(nil))
+	t.Cleanup(advisor.Close)
+
+	if len(wrapped) != 2 || wrapped[0] != inner || wrapped[1].(*wrappedDialer).name != "first" {
+		t.Fatalf("found %v, want the dialer wrapped by each middleware in turn", wrapped)
+	}
+
+	if outer, ok := advisor.dialer.(*wrappedDialer); !ok || outer.name != "second" {
+		t.Errorf("found %v, want the last middleware's dialer", advisor.dialer)
+	}
+}
+
+// blockingDialer never connects, nor does it honor the context, to simulate a probe that hangs indefinitely.
+type blockingDialer struct {
+	release chan struct{}
+}
+
+func (d *blockingDialer) DialContext(_ context.Context, _, _ string) (net.Conn, error) {
+	<-d.release
+	return nil, errors.New("connection released")
+}
+
+func TestAdvisor_CheckAllContextTimeout(t *testing.T) {
+	dialer := &blockingDialer{release: make(chan struct{})}
+	defer close(dialer.release)
+
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithCheckTimeout(200*time.Millisecond), WithDialer(dialer))
+
+	start := time.Now()
+	advice := advisor.CheckAllContext(context.Background(), "example.com", "", "", "v=DMARC1; p=none;", []string{"mx.example.com."}, "v=spf1 -all")
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v, expected the hung checks to be abandoned", elapsed)
+	}
+
+	// the timeout is the scanner's, so it's reported as the checks' errors rather than as advice
+	for name, section := range map[string][]string{"domain": advice.Domain, "mx": advice.MX} {
+		if len(section) != 0 {
+			t.Errorf("found %v for %s, want no advice", section, name)
+		}
+
+		if err := advice.Errors[name]; ErrorKind(err) != ErrorKindTimeout || !strings.HasPrefix(err.Error(), "check abandoned after ") {
+			t.Errorf("found %v for %s, want a timeout error", err, name)
+		}
+	}
+
+	if len(advice.Errors) != 2 {
+		t.Errorf("found %v, want only the abandoned checks' errors", advice.Errors)
+	}
+
+	if expected := advisor.checkSPFRecord("v=spf1 -all", parseDMARC("v=DMARC1; p=none;"), true); !reflect.DeepEqual(advice.SPF, expected) {
+		t.Errorf("found %v, want %v", advice.SPF, expected)
+	}
+
+	// abandoned checks must not populate the cache
+	if advisor.tlsCacheMail.Get("mx.example.com") != nil {
+		t.Error("abandoned mail TLS check was cached")
+	}
+}
+
+func TestAdvisor_CheckBIMI(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logo.svg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/svg+xml")
+	})
+	mux.HandleFunc("/large.svg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(64*1024))
+	})
+	mux.HandleFunc("/cert.pem", func(w http.ResponseWriter, r *http.Request) {})
+
+	network := testnet.New(t)
+	server := network.HTTPS("bimi.example.com", &testnet.HTTPSServer{Handler: mux})
+	hangingServer := network.HTTPS("hanging.example.com", &testnet.HTTPSServer{Handler: testnet.Hang})
+
+	client := network.HTTPClient()
+	client.Timeout = 100 * time.Millisecond
+
+	advisor := NewAdvisor(time.Second, time.Second, false, WithHTTPClient(client))
+
+	t.Run("Valid", func(t *testing.T) {
+		expectedAdvice := []string{"Your BIMI record looks good! No further action needed."}
+		advice := advisor.CheckBIMI("v=BIMI1; l=" + server.URL("/logo.svg") + "; a=" + server.URL("/cert.pem"))
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+
+	t.Run("MissingAssets", func(t *testing.T) {
+		expectedAdvice := []string{
+			"Your BIMI record has some issues:",
+			"Your SVG logo could not be downloaded.",
+			"Your VMC certificate could not be downloaded.",
+		}
+		advice := advisor.CheckBIMI("v=BIMI1; l=" + server.URL("/missing.svg") + "; a=" + server.URL("/missing.pem"))
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+
+	t.Run("OversizedLogo", func(t *testing.T) {
+		expectedAdvice := []string{
+			"Your BIMI record has some issues:",
+			"Your SVG logo exceeds the maximum of 32KB.",
+		}
+		advice := advisor.CheckBIMI("v=BIMI1; l=" + server.URL("/large.svg") + "; a=" + server.URL("/cert.pem"))
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		// the assets may still be fine, so they're unverified rather than failed
+		expectedAdvice := []string{
+			"Your BIMI record looks good! No further action needed.",
+			"Your SVG logo could not be verified (endpoint unavailable), as hanging.example.com timed out. This is usually temporary, so it's checked again on the next scan.",
+			"Your VMC certificate could not be verified (endpoint unavailable), as hanging.example.com timed out. This is usually temporary, so it's checked again on the next scan.",
+		}
+
+		start := time.Now()
+		advice := advisor.CheckBIMI("v=BIMI1; l=" + hangingServer.URL("/logo.svg") + "; a=" + hangingServer.URL("/cert.pem"))
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("took %v, expected the client timeout to apply", elapsed)
+		}
+	})
+}
+
 func TestAdvisor_CheckDMARC(t *testing.T) {
 	advisor := NewAdvisor(time.Second, time.Second, false)
 
@@ -26,7 +307,7 @@ func TestAdvisor_CheckDMARC(t *testing.T) {
 			"Your DMARC record appears to be malformed as no semicolons seem to be present.",
 		}
 
-		advice := advisor.CheckDMARC("v=DMARC1 fo=1")
+		advice := advisor.CheckDMARC("DMARC1 fo=1")
 
 		if !reflect.DeepEqual(advice, expectedAdvice) {
 			t.Errorf("found %v, want %v", advice, expectedAdvice)
@@ -35,13 +316,31 @@ func TestAdvisor_CheckDMARC(t *testing.T) {
 
 	t.Run("FirstTag", func(t *testing.T) {
 		expectedAdvice := "The beginning of your DMARC record should be v=DMARC1 with specific capitalization."
-		advice := advisor.CheckDMARC("v=dmarc1;")
+		advice := advisor.CheckDMARC("v=DMARC2;")
 
 		if advice[0] != expectedAdvice {
 			t.Errorf("found %v, want %v", advice[0], expectedAdvice)
 		}
 	})
 
+	t.Run("Typo", func(t *testing.T) {
+		expectedAdvice := []string{
+			`Your DMARC record contains a typo: "v=dmarc1 p=none" should be "v=DMARC1; p=none".`,
+			`Your DMARC record contains a typo: "rua = mailto:dmarc@example.com" should be "rua=mailto:dmarc@example.com".`,
+			"Receivers will likely ignore your DMARC record until it's corrected to: v=DMARC1; p=none; rua=mailto:dmarc@example.com",
+		}
+
+		advice := advisor.CheckDMARC("v=dmarc1 p=none; rua = mailto:dmarc@example.com")
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+
+		if severity := Classify(advice[0]); severity != SeverityHigh {
+			t.Errorf("found %v, want %v", severity, SeverityHigh)
+		}
+	})
+
 	t.Run("SecondTag", func(t *testing.T) {
 		expectedAdvice := "The second tag in your DMARC record must be p=none/p=quarantine/p=reject."
 		advice := advisor.CheckDMARC("v=DMARC1; fo=1; p=reject;")
@@ -227,3 +526,251 @@ func TestAdvisor_CheckDMARC(t *testing.T) {
 		}
 	})
 }
+
+func TestAdvisor_CheckMX(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("MalformedRecord", func(t *testing.T) {
+		expectedAdvice := "Your domain has a malformed MX record, as it doesn't contain a hostname."
+
+		for _, mx := range [][]string{{""}, {" "}, {"."}, {"mx1.example.com.", " . "}} {
+			advice := advisor.CheckMX(mx)
+			found := false
+
+			for _, a := range advice {
+				if a == expectedAdvice {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Errorf("found %v, want %v", advice, expectedAdvice)
+			}
+		}
+	})
+}
+
+func TestAdvisor_CheckMXTLSSummary(t *testing.T) {
+	const (
+		single   = "You have a single mail server setup, but it's recommended that you have at least two setup in case the first one fails."
+		multiple = "You have multiple mail servers setup, which is recommended."
+		summary  = "All of your mail servers are using TLS 1.3, no further action needed!"
+		refused  = "Failed to reach domain, as it refused the connection to port 25, so nothing is accepting mail on the server."
+		detail   = "Your certificate has a 256-bit ECDSA key (P-256), and is signed with ECDSA-SHA256."
+		helo     = "Your mail server introduces itself as "
+	)
+
+	tls12 := checkTLSVersion(tls.VersionTLS12)
+	tls13 := checkTLSVersion(tls.VersionTLS13)
+
+	untrusted := testnet.SelfSigned(t, testnet.CertificateOptions{Name: "mx3.example.com"})
+
+	// a host without a server refuses its connections
+	tests := []struct {
+		name     string
+		hosts    map[string]*testnet.SMTPServer
+		mx       []string
+		detailed bool
+		expected []string
+	}{
+		{
+			name:     "OneHostTLS13",
+			hosts:    map[string]*testnet.SMTPServer{"mx1.example.com": {}},
+			mx:       []string{"mx1.example.com."},
+			expected: []string{single, summary},
+		},
+		{
+			name:     "OneHostTLS12",
+			hosts:    map[string]*testnet.SMTPServer{"mx1.example.com": {MaxVersion: tls.VersionTLS12}},
+			mx:       []string{"mx1.example.com."},
+			expected: []string{single, "mx1.example.com: " + tls12},
+		},
+		{
+			name:     "TwoHostsTLS13",
+			hosts:    map[string]*testnet.SMTPServer{"mx1.example.com": {}, "mx2.example.com": {}},
+			mx:       []string{"mx1.example.com.", "mx2.example.com."},
+			expected: []string{multiple, summary},
+		},
+		{
+			name:     "TwoHostsMixed",
+			hosts:    map[string]*testnet.SMTPServer{"mx1.example.com": {}},
+			mx:       []string{"mx1.example.com.", "mx2.example.com."},
+			expected: []string{multiple, "mx1.example.com: " + tls13, "mx2.example.com: " + refused},
+		},
+		{
+			name: "FiveHostsTLS13",
+			hosts: map[string]*testnet.SMTPServer{
+				"mx1.example.com": {}, "mx2.example.com": {}, "mx3.example.com": {}, "mx4.example.com": {}, "mx5.example.com": {},
+			},
+			mx:       []string{"mx1.example.com.", "mx2.example.com.", "mx3.example.com.", "mx4.example.com.", "mx5.example.com."},
+			expected: []string{multiple, summary},
+		},
+		{
+			name: "FiveHostsMixed",
+			hosts: map[string]*testnet.SMTPServer{
+				"mx1.example.com": {}, "mx2.example.com": {MaxVersion: tls.VersionTLS12}, "mx3.example.com": {Certificate: &untrusted},
+				"mx4.example.com": {},
+			},
+			mx: []string{"mx1.example.com.", "mx2.example.com.", "mx3.example.com.", "mx4.example.com.", "mx5.example.com."},
+			expected: []string{
+				multiple,
+				"mx1.example.com: " + tls13,
+				"mx2.example.com: " + tls12,
+				"mx3.example.com: No valid certificate could be found.",
+				"mx3.example.com: " + tls13,
+				"mx4.example.com: " + tls13,
+				"mx5.example.com: " + refused,
+			},
+		},
+		{
+			name:     "TwoHostsTLS13Detailed",
+			hosts:    map[string]*testnet.SMTPServer{"mx1.example.com": {}, "mx2.example.com": {}},
+			mx:       []string{"mx1.example.com.", "mx2.example.com."},
+			detailed: true,
+			expected: []string{
+				multiple,
+				"mx1.example.com: " + tls13,
+				"mx1.example.com: " + detail,
+				"mx1.example.com: " + helo + "mx1.example.com.",
+				"mx2.example.com: " + tls13,
+				"mx2.example.com: " + detail,
+				"mx2.example.com: " + helo + "mx2.example.com.",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network := testnet.New(t)
+			for host, server := range test.hosts {
+				network.SMTP(host, server)
+				network.Resolver.Host(host, "127.0.0.1")
+			}
+
+			advisor := NewAdvisor(time.Second, time.Minute, true, WithDetailed(test.detailed), WithDialer(network), WithHostResolver(network.Resolver), WithRootCAs(network.CA.Pool()))
+			t.Cleanup(advisor.Close)
+
+			advice := advisor.CheckMX(test.mx)
+
+			if !reflect.DeepEqual(advice, test.expected) {
+				t.Errorf("found %v, want %v", advice, test.expected)
+			}
+		})
+	}
+}
+
+func TestAdvisor_CheckSPFWithDMARC(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	tests := []struct {
+		name     string
+		spf      string
+		dmarc    string
+		prefix   string
+		severity Severity
+	}{
+		{"HardFailEnforced", "v=spf1 include:_spf.google.com -all", "v=DMARC1; p=reject; rua=mailto:reports@example.com", "Your SPF record ends in -all, which is safe", SeverityInfo},
+		{"HardFailUnenforced", "v=spf1 include:_spf.google.com -all", "", "Your SPF record ends in -all, but", SeverityLow},
+		{"SoftFailEnforced", "v=spf1 include:_spf.google.com ~all", "v=DMARC1; p=reject; rua=mailto:reports@example.com", "Your SPF record ends in ~all. As your DMARC policy is p=reject", SeverityLow},
+		{"SoftFailUnenforced", "v=spf1 include:_spf.google.com ~all", "", "Your SPF record ends in ~all, which is the safer choice", SeverityInfo},
+
+		// reject isn't fully enforced without reports to catch legitimate mail that fails, or while it's only applied to some mail
+		{"HardFailWithoutReports", "v=spf1 -all", "v=DMARC1; p=reject;", "Your SPF record ends in -all, but", SeverityLow},
+		{"HardFailPartialPercentage", "v=spf1 -all", "v=DMARC1; p=reject; pct=50; rua=mailto:reports@example.com", "Your SPF record ends in -all, but", SeverityLow},
+		{"HardFailMonitoring", "v=spf1 -all", "v=DMARC1; p=none; rua=mailto:reports@example.com", "Your SPF record ends in -all, but", SeverityLow},
+		{"Neutral", "v=spf1 ?all", "v=DMARC1; p=reject; rua=mailto:reports@example.com", "SPF seems to be setup correctly!", SeverityInfo},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.checkSPF(test.spf, nil, parseDMARC(test.dmarc))
+
+			if len(advice) != 1 || !strings.HasPrefix(advice[0], test.prefix) {
+				t.Fatalf("found %v, want advice starting with %q", advice, test.prefix)
+			}
+
+			if severity := Classify(advice[0]); severity != test.severity {
+				t.Errorf("found %v, want %v", severity, test.severity)
+			}
+		})
+	}
+
+	t.Run("Standalone", func(t *testing.T) {
+		// without the DMARC record, the advice doesn't assume anything about it
+		expected := []string{"SPF seems to be setup correctly! No further action needed."}
+
+		for _, spf := range []string{"v=spf1 -all", "v=spf1 ~all"} {
+			if advice := advisor.CheckSPF(spf); !reflect.DeepEqual(advice, expected) {
+				t.Errorf("found %v for %q, want %v", advice, spf, expected)
+			}
+		}
+	})
+}
+
+func TestNormalizeHostname(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"mx.example.com.", "mx.example.com", true},
+		{"mx.example.com", "mx.example.com", true},
+		{"  mx.example.com. ", "mx.example.com", true},
+		{"mx.example.com..", "", false},
+		{".", "", false},
+		{"", "", false},
+		{" \t", "", false},
+	}
+
+	for _, test := range tests {
+		hostname, ok := normalizeHostname(test.input)
+		if hostname != test.expected || ok != test.ok {
+			t.Errorf("normalizeHostname(%q) = %q, %v, want %q, %v", test.input, hostname, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestAdvisor_CheckDomainNormalized(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	// consumer domains are matched however the domain is written
+	for _, domain := range []string{"gmail.com", "GMail.com.", " gmail.com "} {
+		if advice := advisor.CheckDomain(domain); len(advice) != 1 || !strings.HasPrefix(advice[0], "Consumer based accounts") {
+			t.Errorf("found %v for %q, want the consumer domain advice", advice, domain)
+		}
+	}
+}
+
+func FuzzNormalizeHostname(f *testing.F) {
+	for _, seed := range []string{"", ".", "..", " ", "mx.example.com.", " mx.example.com "} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		hostname, ok := normalizeHostname(input)
+		if ok && (hostname == "" || hostname[len(hostname)-1] == '.') {
+			t.Errorf("normalizeHostname(%q) returned invalid hostname %q", input, hostname)
+		}
+	})
+}
+
+func FuzzAdvisor(f *testing.F) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	for _, seed := range []string{"", ";", "=", "v=DMARC1; p=none; rua=mailto:a@b.c", "v=spf1 -all", "v=DKIM1; k=rsa; p=", "v=BIMI1;", "pct=;ri=;", "."} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		advisor.CheckDMARC(input)
+		advisor.CheckDKIM(input)
+		advisor.CheckDomain(input)
+		advisor.CheckMX([]string{input})
+		advisor.CheckSPF(input)
+
+		// avoid issuing arbitrary HTTP requests with fuzzed URLs
+		if !strings.Contains(input, "l=") && !strings.Contains(input, "a=") {
+			advisor.CheckBIMI(input)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unalignedPhrase marks the advice of a domain whose mail can't pass DMARC,
+// as neither SPF nor DKIM can align with it.
+const unalignedPhrase = "so none of your mail can pass DMARC"
+
+// CheckAlignment returns a warning if the domain's mail can't pass DMARC,
+// however its SPF and DKIM checks go, as neither can align with the domain:
+// the senders its SPF record authorizes are all bulk mail providers sending
+// with their own envelope domains, and no DKIM key is published for it (or,
+// under relaxed alignment, for any of its sending subdomains). It returns
+// nothing if it can't tell, such as if the SPF record authorizes any sender
+// the domain could send as itself, or the domain has no DMARC record.
+func (a *Advisor) CheckAlignment(domain, dkim, dmarc, spf string, subdomains []SendingSubdomain) []string {
+	return a.checkAlignment(domain, dkim, parseDMARC(dmarc), spf, subdomains)
+}
+
+func (a *Advisor) checkAlignment(domain, dkim string, dmarcRecord *dmarc, spf string, subdomains []SendingSubdomain) []string {
+	if dmarcRecord == nil {
+		return nil
+	}
+
+	envelopes, ok := a.providerEnvelopes(spf)
+	if !ok || dkim != "" {
+		return nil
+	}
+
+	// a sending subdomain's SPF record (for a custom return path) or DKIM key aligns with the domain, unless alignment is strict
+	for _, subdomain := range subdomains {
+		if senders, _ := spfSenders(subdomain.SPF); len(senders) > 0 && evaluateIdentifier(domain, subdomain.Name, "pass", dmarcRecord, "aspf").Aligned {
+			return nil
+		}
+
+		if subdomain.DKIM != "" && evaluateIdentifier(domain, subdomain.Name, "pass", dmarcRecord, "adkim").Aligned {
+			return nil
+		}
+	}
+
+	names := make([]string, 0, len(envelopes))
+	for _, envelope := range envelopes {
+		names = append(names, envelope.Name+" ("+envelope.Envelope+")")
+	}
+
+	sends := "which send with their own envelope domains"
+	if len(names) == 1 {
+		sends = "which sends with its own envelope domain"
+	}
+
+	advice := fmt.Sprintf("Your SPF record only authorizes %s, %s unless you set up a custom return path, and no DKIM key was found for %s at the selectors checked, %s, however it's authenticated.", joinNames(names), sends, domain, unalignedPhrase)
+
+	if dmarcRecord.Policy == "quarantine" || dmarcRecord.Policy == "reject" {
+		return []string{advice + fmt.Sprintf(" Receivers %s it under your DMARC policy at p=%s, so publish the DKIM keys your senders provide for your domain (or set up a custom return path with them), or scan with --dkimSelector if they sign with a key at another selector.", dmarcRecord.Policy, dmarcRecord.Policy)}
+	}
+
+	return []string{advice + " Publish the DKIM keys your senders provide for your domain (or set up a custom return path with them) before raising your DMARC policy to quarantine or reject, which would otherwise have receivers quarantine or reject all of it."}
+}
+
+// providerEnvelopes returns the providers sending with their own envelope
+// domains that the SPF record authorizes, if they're the only senders it
+// authorizes. A record authorizing any other sender (such as an address, the
+// domain's MX hosts, or another include) authorizes mail sent with the domain
+// as its envelope, which aligns with it.
+func (a *Advisor) providerEnvelopes(spf string) ([]provider, bool) {
+	senders, ok := spfSenders(spf)
+	if !ok || len(senders) == 0 {
+		return nil, false
+	}
+
+	var envelopes []provider
+
+	for _, sender := range senders {
+		include, isInclude := strings.CutPrefix(sender, "include:")
+		if !isInclude {
+			return nil, false
+		}
+
+		envelope := envelopeProvider(a.loadData().providers, include)
+		if envelope == nil {
+			return nil, false
+		}
+
+		if !hasProvider(envelopes, envelope.Name) {
+			envelopes = append(envelopes, *envelope)
+		}
+	}
+
+	return envelopes, true
+}
+
+// spfSenders returns the mechanisms of the SPF record that pass senders (such
+// as ip4:192.0.2.0/24 or include:_spf.example.com), lowercased and without
+// their qualifier, and its redirect modifier. It's false if the record isn't
+// an SPF record, or passes every sender (with +all).
+func spfSenders(spf string) ([]string, bool) {
+	terms := strings.Fields(strings.ToLower(spf))
+	if len(terms) == 0 || terms[0] != "v=spf1" {
+		return nil, false
+	}
+
+	var senders []string
+
+	for _, term := range terms[1:] {
+		if strings.HasPrefix(term, "redirect=") {
+			senders = append(senders, term)
+			continue
+		}
+
+		// failing, softfailing and neutral mechanisms don't authorize anyone, and the other modifiers don't either
+		if strings.ContainsAny(term[:1], "-~?") || strings.Contains(term, "=") {
+			continue
+		}
+
+		term = strings.TrimPrefix(term, "+")
+		if term == "all" {
+			return nil, false
+		}
+
+		senders = append(senders, term)
+	}
+
+	return senders, true
+}
+
+// envelopeProvider returns the provider sending with its own envelope domain
+// that the SPF include belongs to, or nil if none do.
+func envelopeProvider(providers []provider, include string) *provider {
+	for index := range providers {
+		if providers[index].Envelope != "" && matchesSuffix([]string{include}, providers[index].SPF) {
+			return &providers[index]
+		}
+	}
+
+	return nil
+}
+
+// hasProvider reports whether any of the providers has the name.
+func hasProvider(providers []provider, name string) bool {
+	for _, provider := range providers {
+		if provider.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// joinNames joins names into a list, such as "A, B and C".
+func joinNames(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
@@ -0,0 +1,146 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CheckAlignment(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	tests := []struct {
+		name       string
+		dkim       string
+		dmarc      string
+		spf        string
+		subdomains []SendingSubdomain
+		prefix     string
+	}{
+		{
+			name:   "Monitoring",
+			dmarc:  "v=DMARC1; p=none",
+			spf:    "v=spf1 include:sendgrid.net -all",
+			prefix: "Your SPF record only authorizes SendGrid (sendgrid.net), which sends with its own envelope domain",
+		},
+		{
+			name:   "Enforced",
+			dmarc:  "v=DMARC1; p=reject",
+			spf:    "v=spf1 include:sendgrid.net include:amazonses.com ~all",
+			prefix: "Your SPF record only authorizes SendGrid (sendgrid.net) and Amazon SES (amazonses.com), which send with their own envelope domains",
+		},
+		{
+			name:   "NoDMARC",
+			spf:    "v=spf1 include:sendgrid.net -all",
+			prefix: "",
+		},
+		{
+			name:   "DKIM",
+			dkim:   "v=DKIM1; p=KEY",
+			dmarc:  "v=DMARC1; p=reject",
+			spf:    "v=spf1 include:sendgrid.net -all",
+			prefix: "",
+		},
+		{
+			name:   "OwnSenders",
+			dmarc:  "v=DMARC1; p=reject",
+			spf:    "v=spf1 ip4:192.0.2.0/24 include:sendgrid.net -all",
+			prefix: "",
+		},
+		{
+			name:   "MX",
+			dmarc:  "v=DMARC1; p=reject",
+			spf:    "v=spf1 mx include:sendgrid.net -all",
+			prefix: "",
+		},
+		{
+			name:   "PassAll",
+			dmarc:  "v=DMARC1; p=none",
+			spf:    "v=spf1 include:sendgrid.net +all",
+			prefix: "",
+		},
+		{
+			name:   "NoSenders",
+			dmarc:  "v=DMARC1; p=reject",
+			spf:    "v=spf1 -all",
+			prefix: "",
+		},
+		{
+			// Google Workspace sends with the domain as its envelope, which aligns
+			name:   "OtherInclude",
+			dmarc:  "v=DMARC1; p=reject",
+			spf:    "v=spf1 include:_spf.google.com include:sendgrid.net -all",
+			prefix: "",
+		},
+		{
+			name:   "Redirect",
+			dmarc:  "v=DMARC1; p=reject",
+			spf:    "v=spf1 include:sendgrid.net redirect=_spf.example.com",
+			prefix: "",
+		},
+		{
+			name:       "SubdomainReturnPath",
+			dmarc:      "v=DMARC1; p=reject",
+			spf:        "v=spf1 include:sendgrid.net -all",
+			subdomains: []SendingSubdomain{{Name: "em.example.com", SPF: "v=spf1 include:sendgrid.net -all"}},
+			prefix:     "",
+		},
+		{
+			name:       "SubdomainDKIM",
+			dmarc:      "v=DMARC1; p=reject",
+			spf:        "v=spf1 include:mcsv.net -all",
+			subdomains: []SendingSubdomain{{Name: "news.example.com", DKIM: "v=DKIM1; p=KEY"}},
+			prefix:     "",
+		},
+		{
+			// strict alignment requires the domain itself, so a subdomain's records don't help
+			name:       "StrictSubdomain",
+			dmarc:      "v=DMARC1; p=reject; aspf=s; adkim=s",
+			spf:        "v=spf1 include:servers.mcsv.net -all",
+			subdomains: []SendingSubdomain{{Name: "news.example.com", SPF: "v=spf1 include:servers.mcsv.net -all", DKIM: "v=DKIM1; p=KEY"}},
+			prefix:     "Your SPF record only authorizes Mailchimp (mcsv.net)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckAlignment("example.com", test.dkim, test.dmarc, test.spf, test.subdomains)
+
+			if test.prefix == "" {
+				if len(advice) != 0 {
+					t.Errorf("found %v, want no advice", advice)
+				}
+
+				return
+			}
+
+			if len(advice) != 1 || !strings.HasPrefix(advice[0], test.prefix) {
+				t.Fatalf("found %v, want advice starting with %q", advice, test.prefix)
+			}
+
+			if severity := Classify(advice[0]); severity != SeverityHigh {
+				t.Errorf("found %v, want %v", severity, SeverityHigh)
+			}
+		})
+	}
+
+	t.Run("Policy", func(t *testing.T) {
+		spf := "v=spf1 include:sendgrid.net -all"
+
+		if advice := advisor.CheckAlignment("example.com", "", "v=DMARC1; p=quarantine", spf, nil); !strings.Contains(advice[0], "Receivers quarantine it under your DMARC policy at p=quarantine") {
+			t.Errorf("found %q, want the enforced policy's consequences", advice[0])
+		}
+
+		if advice := advisor.CheckAlignment("example.com", "", "v=DMARC1; p=none", spf, nil); !strings.Contains(advice[0], "before raising your DMARC policy") {
+			t.Errorf("found %q, want a warning before the policy is raised", advice[0])
+		}
+	})
+
+	t.Run("CheckAll", func(t *testing.T) {
+		advice := advisor.CheckAll("example.com", "", "", "v=DMARC1; p=reject", nil, "v=spf1 include:sendgrid.net -all")
+
+		if len(advice.DMARC) == 0 || !strings.Contains(advice.DMARC[0], unalignedPhrase) {
+			t.Errorf("found %v, want the alignment warning first", advice.DMARC)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package advisor
+
+import (
+	"strings"
+)
+
+// CheckARC returns advice on the domain's ARC (Authenticated Received Chain)
+// sealing, which lets receivers trust the original SPF and DKIM results of
+// mail the domain forwards (such as through mailing lists or helpdesk
+// forwarding) that would otherwise fail DMARC. Sealing is only relevant to
+// domains that receive mail, so no advice is given without any MX records.
+func (a *Advisor) CheckARC(arc, selector string, mx []string, spf string) []string {
+	if len(mx) == 0 || (len(mx) == 1 && strings.TrimSpace(mx[0]) == ".") {
+		return nil
+	}
+
+	if arc != "" {
+		if !hasPublicKey(arc) {
+			return []string{"Your ARC sealing key at selector \"" + selector + "\" has been revoked (its p= tag is empty), so mail your domain seals will fail ARC validation. Publish a new key, or stop sealing with this selector."}
+		}
+
+		return []string{"Your domain publishes an ARC sealing key at selector \"" + selector + "\", so mail it forwards can still be trusted by receivers that validate its seal. No further action needed."}
+	}
+
+	var advice []string
+
+	for _, detected := range detectProviders(a.loadData().providers, mx, spf) {
+		if detected.Advice.ARC != "" {
+			advice = append(advice, "As you use "+detected.Name+": "+detected.Advice.ARC)
+		}
+	}
+
+	if len(advice) > 0 {
+		return advice
+	}
+
+	return []string{"We couldn't detect an ARC sealing key for your domain. If it forwards mail (such as through mailing lists or helpdesk forwarding), consider sealing the mail it forwards with ARC, as forwarding breaks SPF (and often DKIM), causing receivers to reject it under your senders' DMARC policies."}
+}
+
+// hasPublicKey reports whether a DKIM key record has a non-empty p= tag.
+func hasPublicKey(record string) bool {
+	publicKey, _ := dkimTag(record, "p")
+	return publicKey != ""
+}
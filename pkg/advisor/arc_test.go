@@ -0,0 +1,63 @@
+package advisor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CheckARC(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false, WithDialer(panickingDialer{}))
+
+	t.Run("NoMail", func(t *testing.T) {
+		if advice := advisor.CheckARC("", "", nil, ""); advice != nil {
+			t.Errorf("found %v, want no advice for a domain without MX records", advice)
+		}
+
+		if advice := advisor.CheckARC("", "", []string{"."}, ""); advice != nil {
+			t.Errorf("found %v, want no advice for a domain with a null MX record", advice)
+		}
+	})
+
+	t.Run("Sealed", func(t *testing.T) {
+		advice := advisor.CheckARC("v=DKIM1; k=rsa; p=KEY", "arc", []string{"mx.example.com."}, "")
+		expected := []string{`Your domain publishes an ARC sealing key at selector "arc", so mail it forwards can still be trusted by receivers that validate its seal. No further action needed.`}
+
+		if !reflect.DeepEqual(advice, expected) {
+			t.Errorf("found %v, want %v", advice, expected)
+		}
+	})
+
+	t.Run("Revoked", func(t *testing.T) {
+		advice := advisor.CheckARC("v=DKIM1; k=rsa; p=", "arc", []string{"mx.example.com."}, "")
+
+		if len(advice) != 1 || !strings.Contains(advice[0], "has been revoked") {
+			t.Fatalf("found %v, want the revoked key advice", advice)
+		}
+
+		if severity := Classify(advice[0]); severity != SeverityLow {
+			t.Errorf("found %v, want %v", severity, SeverityLow)
+		}
+	})
+
+	t.Run("Provider", func(t *testing.T) {
+		advice := advisor.CheckARC("", "", []string{"example-com.mail.protection.outlook.com."}, "")
+
+		if len(advice) != 1 || !strings.HasPrefix(advice[0], "As you use Microsoft 365: Exchange Online ARC seals") {
+			t.Errorf("found %v, want the Microsoft 365 ARC advice", advice)
+		}
+	})
+
+	t.Run("Unsealed", func(t *testing.T) {
+		advice := advisor.CheckARC("", "", []string{"mx.example.com."}, "v=spf1 mx -all")
+
+		if len(advice) != 1 || !strings.HasPrefix(advice[0], "We couldn't detect an ARC sealing key for your domain.") {
+			t.Fatalf("found %v, want the ARC suggestion", advice)
+		}
+
+		if severity := Classify(advice[0]); severity != SeverityInfo {
+			t.Errorf("found %v, want %v as ARC is only relevant to forwarding domains", severity, SeverityInfo)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package advisor
+
+import (
+	"fmt"
+)
+
+// propagationPhrase marks the advice on an answer that differs from the
+// authoritative one, which usually resolves itself once caches expire.
+const propagationPhrase = "Propagation in progress or cache mismatch"
+
+// AuthoritativeAnswer is the answer to one of the domain's lookups from one of
+// its zone's authoritative nameservers (Server), and whether the recursive
+// resolver's answer differed from it.
+type AuthoritativeAnswer struct {
+	Name     string
+	Type     string
+	Server   string
+	TTL      uint32
+	Mismatch bool
+}
+
+// CheckAuthoritativeAnswer returns advice on an authoritative answer that
+// differs from the recursive resolver's, which is either a change that
+// hasn't reached the resolver's cache yet, or nameservers that don't agree
+// (such as split-horizon DNS, or a secondary that's stopped transferring the
+// zone). It returns nil if the answers match.
+func (a *Advisor) CheckAuthoritativeAnswer(answer AuthoritativeAnswer) []string {
+	if !answer.Mismatch {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%s: the recursive resolver's answer for %s %s differs from that of its authoritative nameserver %s, so the results above may not be what receivers see. Cached copies expire within %d seconds (the authoritative answer's TTL), so scan again after that; if they still differ, check for split-horizon DNS, or a secondary nameserver serving a stale copy of the zone.", propagationPhrase, answer.Name, answer.Type, answer.Server, answer.TTL)}
+}
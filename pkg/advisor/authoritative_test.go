@@ -0,0 +1,27 @@
+package advisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CheckAuthoritativeAnswer(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	if advice := advisor.CheckAuthoritativeAnswer(AuthoritativeAnswer{Name: "example.com", Type: "MX", Server: "ns1.example.com", TTL: 3600}); advice != nil {
+		t.Errorf("found %v, want no advice for matching answers", advice)
+	}
+
+	advice := advisor.CheckAuthoritativeAnswer(AuthoritativeAnswer{Name: "_dmarc.example.com", Type: "TXT", Server: "ns1.example.com", TTL: 300, Mismatch: true})
+
+	expected := "Propagation in progress or cache mismatch: the recursive resolver's answer for _dmarc.example.com TXT differs from that of its authoritative nameserver ns1.example.com, so the results above may not be what receivers see. Cached copies expire within 300 seconds (the authoritative answer's TTL), so scan again after that; if they still differ, check for split-horizon DNS, or a secondary nameserver serving a stale copy of the zone."
+
+	if len(advice) != 1 || advice[0] != expected {
+		t.Fatalf("found %v, want %v", advice, []string{expected})
+	}
+
+	// the note must not be mistaken for the DMARC or TXT findings it mentions
+	if severity := Classify(advice[0]); severity != SeverityLow {
+		t.Errorf("found %v, want %v", severity, SeverityLow)
+	}
+}
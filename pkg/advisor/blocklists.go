@@ -0,0 +1,41 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sharedRangesPhrase marks blocklist advice, which is informational as the
+// ranges of shared mail providers are often listed.
+const sharedRangesPhrase = "Shared provider ranges are often listed"
+
+// Blocklisting is an address authorized to send the domain's mail (by its SPF
+// record, if Source is "spf") or one of its MX hosts (named by Source) that's
+// listed by a DNSBL zone, with the zone's return codes.
+type Blocklisting struct {
+	Address string
+	Source  string
+	Zone    string
+	Codes   []string
+}
+
+// CheckBlocklists returns advice on the domain's sampled addresses that are
+// listed by a DNSBL, naming the zone that listed each of them.
+func (a *Advisor) CheckBlocklists(listings []Blocklisting) []string {
+	if len(listings) == 0 {
+		return []string{"None of the SPF authorized or MX host addresses checked are listed by the blocklists. No further action needed."}
+	}
+
+	advice := make([]string, 0, len(listings))
+
+	for _, listing := range listings {
+		source := "authorized by your SPF record"
+		if listing.Source != "spf" {
+			source = "MX host " + strings.TrimSuffix(listing.Source, ".")
+		}
+
+		advice = append(advice, fmt.Sprintf("%s (%s) is listed by %s (%s). %s, so this is informational, but if the address is yours alone, check the blocklist's lookup page for why it's listed and how to request its removal.", listing.Address, source, listing.Zone, strings.Join(listing.Codes, ", "), sharedRangesPhrase))
+	}
+
+	return advice
+}
@@ -0,0 +1,43 @@
+package advisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CheckBlocklists(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("None", func(t *testing.T) {
+		advice := advisor.CheckBlocklists(nil)
+
+		if len(advice) != 1 || Classify(advice[0]) != SeverityInfo {
+			t.Errorf("found %v, want the no listings advice", advice)
+		}
+	})
+
+	advice := advisor.CheckBlocklists([]Blocklisting{
+		{Address: "192.0.2.1", Source: "spf", Zone: "zen.spamhaus.org", Codes: []string{"127.0.0.2", "127.0.0.10"}},
+		{Address: "198.51.100.25", Source: "mx.example.com.", Zone: "dnsbl.sorbs.net", Codes: []string{"127.0.0.6"}},
+	})
+
+	expected := []string{
+		"192.0.2.1 (authorized by your SPF record) is listed by zen.spamhaus.org (127.0.0.2, 127.0.0.10). Shared provider ranges are often listed, so this is informational, but if the address is yours alone, check the blocklist's lookup page for why it's listed and how to request its removal.",
+		"198.51.100.25 (MX host mx.example.com) is listed by dnsbl.sorbs.net (127.0.0.6). Shared provider ranges are often listed, so this is informational, but if the address is yours alone, check the blocklist's lookup page for why it's listed and how to request its removal.",
+	}
+
+	if len(advice) != len(expected) {
+		t.Fatalf("found %v, want %v", advice, expected)
+	}
+
+	for i := range expected {
+		if advice[i] != expected[i] {
+			t.Errorf("found %q, want %q", advice[i], expected[i])
+		}
+
+		// listings are informational, however many there are
+		if severity := Classify(advice[i]); severity != SeverityInfo {
+			t.Errorf("found %v, want %v", severity, SeverityInfo)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package advisor
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// unavailablePhrase marks the advice of remote assets that couldn't be
+	// fetched as their host was unavailable, which says nothing about the
+	// assets themselves.
+	unavailablePhrase = "could not be verified (endpoint unavailable)"
+
+	// DefaultHTTPAttempts and DefaultHTTPBackoff are how many times a fetch
+	// that times out (or gets a 5xx response) is attempted, and how long to
+	// wait before the first retry, doubling before each one after it.
+	DefaultHTTPAttempts = 2
+	DefaultHTTPBackoff  = 500 * time.Millisecond
+
+	// DefaultBreakerFailures and DefaultBreakerCooldown are how many fetches
+	// from a host in a row must fail before it's skipped, and for how long.
+	DefaultBreakerFailures = 3
+	DefaultBreakerCooldown = 5 * time.Minute
+)
+
+type (
+	// unavailableError is returned by fetches from a host that timed out or
+	// returned a server error on every attempt, or that's skipped by the
+	// circuit breaker.
+	unavailableError struct {
+		host   string
+		reason string
+	}
+
+	// circuitBreaker tracks the hosts of remote assets whose fetches keep
+	// failing, so bulk scans skip them for a cooldown rather than waiting on
+	// every one of their timeouts. Once the cooldown ends, fetches from the
+	// host resume, and a single failure skips it again.
+	circuitBreaker struct {
+		hosts    map[string]*breakerHost
+		mutex    sync.Mutex
+		now      func() time.Time
+		failures int
+		cooldown time.Duration
+	}
+
+	// breakerHost holds the bookkeeping of a single host.
+	breakerHost struct {
+		// failures is the number of fetches in a row that failed.
+		failures int
+
+		// openUntil is when the host's cooldown ends, if it's been skipped.
+		openUntil time.Time
+	}
+)
+
+func (e *unavailableError) Error() string {
+	return e.host + " " + e.reason
+}
+
+func newCircuitBreaker(failures int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		hosts:    make(map[string]*breakerHost),
+		now:      time.Now,
+		failures: failures,
+		cooldown: cooldown,
+	}
+}
+
+// WithHTTPRetry sets how many times a remote asset fetch (such as of a BIMI
+// logo) that times out or gets a 5xx response is attempted, waiting the
+// backoff before the first retry and doubling it before each one after. The
+// default is 2 attempts with a backoff of 500ms. Fetches that get a 4xx
+// response are never retried.
+func WithHTTPRetry(attempts int, backoff time.Duration) Option {
+	return func(a *Advisor) {
+		a.httpAttempts = max(attempts, 1)
+		a.httpBackoff = backoff
+	}
+}
+
+// WithCircuitBreaker skips the fetches of remote assets from a host for the
+// cooldown once the given number of fetches from it in a row have failed (0
+// disables it), reporting the assets as unverified rather than as failed. The
+// default is 3 failures and a cooldown of 5 minutes.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(a *Advisor) {
+		a.breaker = newCircuitBreaker(failures, cooldown)
+	}
+}
+
+// allow reports whether fetches from the host may be attempted, as it isn't
+// being skipped.
+func (b *circuitBreaker) allow(host string) bool {
+	if b.failures <= 0 {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state, ok := b.hosts[host]
+	return !ok || !state.openUntil.After(b.now())
+}
+
+// failure records a failed fetch from the host, skipping it for the cooldown
+// once enough have failed in a row (or straight away, if its last cooldown
+// has just ended).
+func (b *circuitBreaker) failure(host string) {
+	if b.failures <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state, ok := b.hosts[host]
+	if !ok {
+		state = &breakerHost{}
+		b.hosts[host] = state
+	}
+
+	state.failures++
+
+	if state.failures >= b.failures || !state.openUntil.IsZero() {
+		state.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// success records a successful fetch from the host, resetting its failures.
+func (b *circuitBreaker) success(host string) {
+	if b.failures <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.hosts, host)
+}
+
+// doWithRetry sends the request with the advisor's HTTP client, retrying it
+// if it times out or gets a 5xx response, unless its host is skipped by the
+// circuit breaker. If every attempt fails that way (or the host is skipped),
+// an *unavailableError is returned.
+func (a *Advisor) doWithRetry(req *http.Request) (*http.Response, error) {
+	// hosts are tracked with their port, as different ports may be different servers
+	host := req.URL.Host
+
+	if !a.breaker.allow(host) {
+		return nil, &unavailableError{host: host, reason: "failed repeatedly, so it's being skipped for now"}
+	}
+
+	backoff := a.httpBackoff
+
+	for attempt := 1; ; attempt++ {
+		response, err := a.httpClient.Do(req)
+
+		var reason string
+
+		switch {
+		case err != nil && req.Context().Err() != nil:
+			// the scan was cancelled, which says nothing about the host
+			return nil, err
+		case err != nil && !isTimeout(err):
+			return nil, err
+		case err != nil:
+			reason = "timed out"
+		case response.StatusCode >= http.StatusInternalServerError:
+			reason = "returned " + response.Status
+			_ = response.Body.Close()
+		default:
+			a.breaker.success(host)
+			return response, nil
+		}
+
+		if attempt >= a.httpAttempts {
+			a.breaker.failure(host)
+			return nil, &unavailableError{host: host, reason: reason}
+		}
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+
+		backoff *= 2
+	}
+}
+
+// unavailableAdvice returns the advice for a remote asset (such as "Your SVG
+// logo") that couldn't be fetched as its host was unavailable, if it was.
+func unavailableAdvice(asset string, err error) (string, bool) {
+	var unavailableErr *unavailableError
+	if !errors.As(err, &unavailableErr) {
+		return "", false
+	}
+
+	return asset + " " + unavailablePhrase + ", as " + unavailableErr.Error() + ". This is usually temporary, so it's checked again on the next scan.", true
+}
+
+// isTimeout reports whether the error is a timeout, such as of the HTTP
+// client or of a dial.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,215 @@
+package advisor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_HTTPRetry(t *testing.T) {
+	var requests atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flaky.svg", func(w http.ResponseWriter, r *http.Request) {
+		// only the first attempt fails
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	mux.HandleFunc("/down.svg", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/missing.svg", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	certServer := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer certServer.Close()
+
+	check := func(t *testing.T, path string) []string {
+		t.Helper()
+
+		advisor := NewAdvisor(time.Second, time.Second, false, WithHTTPRetry(2, time.Millisecond))
+		defer advisor.Close()
+
+		requests.Store(0)
+
+		return advisor.CheckBIMI("v=BIMI1; l=" + server.URL + path + "; a=" + certServer.URL + "/cert.pem")
+	}
+
+	t.Run("Flaky", func(t *testing.T) {
+		advice := check(t, "/flaky.svg")
+		if len(advice) != 1 || advice[0] != "Your BIMI record looks good! No further action needed." {
+			t.Errorf("found %v, want the retry to succeed", advice)
+		}
+
+		if found := requests.Load(); found != 2 {
+			t.Errorf("found %d requests, want 2", found)
+		}
+	})
+
+	t.Run("ServerError", func(t *testing.T) {
+		advice := check(t, "/down.svg")
+		if len(advice) != 2 || !strings.Contains(advice[1], "returned 502 Bad Gateway") || Classify(advice[1]) != SeverityInfo {
+			t.Errorf("found %v, want the logo to be unverified", advice)
+		}
+
+		if found := requests.Load(); found != 2 {
+			t.Errorf("found %d requests, want 2", found)
+		}
+	})
+
+	t.Run("ClientError", func(t *testing.T) {
+		// 4xx responses are never retried, as they aren't temporary
+		advice := check(t, "/missing.svg")
+		if len(advice) != 2 || advice[1] != "Your SVG logo could not be downloaded." || Classify(advice[1]) != SeverityLow {
+			t.Errorf("found %v, want the logo to fail", advice)
+		}
+
+		if found := requests.Load(); found != 1 {
+			t.Errorf("found %d requests, want 1", found)
+		}
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.failure("logo.example.com")
+	if !breaker.allow("logo.example.com") {
+		t.Error("host was skipped after a single failure")
+	}
+
+	breaker.failure("logo.example.com")
+	if breaker.allow("logo.example.com") {
+		t.Error("host wasn't skipped after repeated failures")
+	}
+
+	if !breaker.allow("other.example.com") {
+		t.Error("other host was skipped")
+	}
+
+	// once the cooldown ends, a single failure skips the host again
+	now = now.Add(time.Minute)
+	if !breaker.allow("logo.example.com") {
+		t.Error("host was skipped after the cooldown")
+	}
+
+	breaker.failure("logo.example.com")
+	if breaker.allow("logo.example.com") {
+		t.Error("host wasn't skipped after failing once its cooldown ended")
+	}
+
+	// a success resets the host
+	now = now.Add(time.Minute)
+	breaker.success("logo.example.com")
+	breaker.failure("logo.example.com")
+	if !breaker.allow("logo.example.com") {
+		t.Error("host was skipped after a single failure following a success")
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		breaker := newCircuitBreaker(0, time.Minute)
+		for range 10 {
+			breaker.failure("logo.example.com")
+		}
+
+		if !breaker.allow("logo.example.com") {
+			t.Error("host was skipped with the breaker disabled")
+		}
+	})
+}
+
+func TestCircuitBreaker_Concurrent(t *testing.T) {
+	breaker := newCircuitBreaker(5, time.Minute)
+
+	var wg sync.WaitGroup
+
+	for i := range 100 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// only half the hosts ever fail
+			host := "ok.example.com"
+			if i%2 == 0 {
+				host = "down.example.com"
+			}
+
+			breaker.allow(host)
+
+			if host == "ok.example.com" {
+				breaker.success(host)
+			} else {
+				breaker.failure(host)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if breaker.allow("down.example.com") {
+		t.Error("failing host wasn't skipped")
+	}
+
+	if !breaker.allow("ok.example.com") {
+		t.Error("healthy host was skipped")
+	}
+}
+
+func TestAdvisor_CircuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	certServer := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer certServer.Close()
+
+	record := "v=BIMI1; l=" + server.URL + "/logo.svg; a=" + certServer.URL + "/cert.pem"
+
+	advisor := NewAdvisor(time.Second, time.Second, false, WithHTTPRetry(1, 0), WithCircuitBreaker(3, time.Minute))
+	defer advisor.Close()
+
+	// concurrent scans of domains sharing a logo host
+	var wg sync.WaitGroup
+
+	for range 20 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			advisor.CheckBIMI(record)
+		}()
+	}
+
+	wg.Wait()
+
+	// once enough have failed, the host is skipped without any requests
+	requests.Store(0)
+
+	advice := advisor.CheckBIMI(record)
+	if len(advice) != 2 || !strings.Contains(advice[1], "failed repeatedly, so it's being skipped for now") || Classify(advice[1]) != SeverityInfo {
+		t.Errorf("found %v, want the host to be skipped", advice)
+	}
+
+	if found := requests.Load(); found != 0 {
+		t.Errorf("found %d requests, want the host to be skipped", found)
+	}
+}
@@ -0,0 +1,201 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeBudget is how long the checks of a domain run by CheckAllInput
+// may take in total, by default.
+const DefaultTimeBudget = 30 * time.Second
+
+// ErrTimeBudgetExceeded is the error of a check that ran out of its slice of
+// the domain's time budget (see WithTimeBudget) before it probed every host,
+// which it lists. The check's advice only covers the hosts it probed.
+var ErrTimeBudgetExceeded = errors.New("partial: time budget exceeded")
+
+// budgetWeights are the shares of the time budget of the checks that probe
+// hosts, relative to the other checks' share of 1. The mail servers' TLS
+// checks get the largest, as they probe each MX host in turn.
+var budgetWeights = map[string]int{"bimi": 2, "domain": 2, "mx": 6}
+
+type (
+	// timeBudget divides a domain's time budget across its checks, in
+	// proportion to their weights. The time a finished check didn't use of
+	// its slice is donated to the checks still running, in proportion to
+	// theirs, so a slow check gets the time the fast ones didn't need.
+	timeBudget struct {
+		mutex sync.Mutex
+		now   func() time.Time
+		start time.Time
+
+		// total is the time shared by the checks, and weight the sum of
+		// their weights.
+		total  time.Duration
+		weight int
+
+		// running are the weights of the checks that haven't finished, which
+		// share the donated time, summed in runningWeight.
+		running       map[string]int
+		runningWeight int
+		donated       time.Duration
+	}
+
+	// budgetKey is the context key of a check's slice of the time budget.
+	budgetKey struct{}
+
+	// budgetSlice is a check's slice of the time budget.
+	budgetSlice struct {
+		budget *timeBudget
+		name   string
+	}
+)
+
+// WithTimeBudget sets how long the checks of a domain run by CheckAllInput
+// may take in total. It's divided across the checks that run, with those
+// that probe hosts getting larger shares, and any time a check doesn't use
+// is donated to those still running. A check that runs out of its slice
+// stops probing hosts, and has an error wrapping ErrTimeBudgetExceeded
+// listing those it didn't probe. Checks still running once the budget is
+// spent are abandoned. The default is DefaultTimeBudget, and 0 disables the
+// budget.
+func WithTimeBudget(budget time.Duration) Option {
+	return func(a *Advisor) {
+		if budget >= 0 {
+			a.timeBudget = budget
+		}
+	}
+}
+
+// newTimeBudget returns the budget of the named checks, starting now. A
+// tenth of it is held back from the checks' slices, so a check that runs
+// out of its slice can still report back before the budget is spent.
+func newTimeBudget(total time.Duration, names []string, now func() time.Time) *timeBudget {
+	budget := &timeBudget{
+		now:     now,
+		start:   now(),
+		total:   total - total/10,
+		running: make(map[string]int, len(names)),
+	}
+
+	for _, name := range names {
+		weight := budgetWeights[name]
+		if weight == 0 {
+			weight = 1
+		}
+
+		budget.running[name] = weight
+		budget.weight += weight
+	}
+
+	budget.runningWeight = budget.weight
+
+	return budget
+}
+
+// slice returns how long the named check may run for in total: its share of
+// the budget, and its share of the time donated by the finished checks. It's
+// 0 for a check that has finished, or isn't part of the budget.
+func (b *timeBudget) slice(name string) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.sliceLocked(name)
+}
+
+func (b *timeBudget) sliceLocked(name string) time.Duration {
+	weight, ok := b.running[name]
+	if !ok {
+		return 0
+	}
+
+	return time.Duration(int64(b.total)*int64(weight)/int64(b.weight) + int64(b.donated)*int64(weight)/int64(b.runningWeight))
+}
+
+// remaining returns how much of the named check's slice is left.
+func (b *timeBudget) remaining(name string) time.Duration {
+	return b.slice(name) - b.now().Sub(b.start)
+}
+
+// finish marks the named check as finished, donating what it didn't use of
+// its slice to the checks still running.
+func (b *timeBudget) finish(name string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	weight, ok := b.running[name]
+	if !ok {
+		return
+	}
+
+	// the check's share of the donated time goes back to the others, along with what it didn't use of its own
+	unused := max(b.sliceLocked(name)-b.now().Sub(b.start), 0)
+	b.donated -= time.Duration(int64(b.donated) * int64(weight) / int64(b.runningWeight))
+	b.donated += unused
+
+	delete(b.running, name)
+	b.runningWeight -= weight
+}
+
+// contextWithBudget returns a copy of the context that carries the named
+// check's slice of the budget, which probeWithin bounds its probes by.
+func contextWithBudget(ctx context.Context, budget *timeBudget, name string) context.Context {
+	return context.WithValue(ctx, budgetKey{}, budgetSlice{budget: budget, name: name})
+}
+
+// probeWithin probes each item in turn, with what's left of the check's
+// slice of the time budget as the deadline of each probe, returning the
+// result of each item probed. Once the slice runs out, the remaining items
+// aren't probed, and are returned in skipped along with any item whose probe
+// was cut short by the slice's deadline. Without a budget in the context,
+// every item is probed.
+func probeWithin[T any](ctx context.Context, items []string, probe func(ctx context.Context, item string) T) (results map[string]T, skipped []string) {
+	results = make(map[string]T, len(items))
+	slice, ok := ctx.Value(budgetKey{}).(budgetSlice)
+
+	for index, item := range items {
+		if !ok {
+			results[item] = probe(ctx, item)
+			continue
+		}
+
+		remaining := slice.budget.remaining(slice.name)
+		if remaining <= 0 {
+			return results, append(skipped, items[index:]...)
+		}
+
+		probeCtx, cancel := context.WithTimeoutCause(ctx, remaining, ErrTimeBudgetExceeded)
+		result := probe(probeCtx, item)
+		cutShort := probeCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		if cutShort {
+			skipped = append(skipped, item)
+			continue
+		}
+
+		results[item] = result
+	}
+
+	return results, skipped
+}
+
+// budgetError returns the error of a check whose slice of the time budget
+// ran out before it probed the skipped items, of the total number it had,
+// which are counted with the singular noun.
+func budgetError(skipped []string, total int, noun string) error {
+	if total != 1 {
+		noun += "s"
+	}
+
+	verb := "weren't"
+	if len(skipped) == 1 {
+		verb = "wasn't"
+	}
+
+	return fmt.Errorf("%w, so %d of %d %s %s probed (%s)", ErrTimeBudgetExceeded, len(skipped), total, noun, verb, strings.Join(skipped, ", "))
+}
@@ -0,0 +1,216 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+)
+
+// budgetClock is a clock that only moves when advanced, such as by a fake
+// probe taking its time.
+type budgetClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func newBudgetClock() *budgetClock {
+	return &budgetClock{now: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *budgetClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *budgetClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestTimeBudget(t *testing.T) {
+	clock := newBudgetClock()
+
+	// a tenth is held back, so the checks share 90s in proportion to their weights (6, 2 and 1)
+	budget := newTimeBudget(100*time.Second, []string{"mx", "domain", "spf"}, clock.Now)
+
+	for name, want := range map[string]time.Duration{"mx": 60 * time.Second, "domain": 20 * time.Second, "spf": 10 * time.Second} {
+		if found := budget.slice(name); found != want {
+			t.Errorf("%s: found %v, want %v", name, found, want)
+		}
+	}
+
+	// the 6s spf didn't use is shared by mx and domain, in proportion to their weights
+	clock.Advance(4 * time.Second)
+	budget.finish("spf")
+
+	if found, want := budget.slice("mx"), 64500*time.Millisecond; found != want {
+		t.Errorf("found %v, want %v", found, want)
+	}
+
+	if found, want := budget.slice("domain"), 21500*time.Millisecond; found != want {
+		t.Errorf("found %v, want %v", found, want)
+	}
+
+	if found := budget.slice("spf"); found != 0 {
+		t.Errorf("found %v for a finished check, want 0", found)
+	}
+
+	// once domain finishes, mx gets everything the others didn't use
+	clock.Advance(6 * time.Second)
+	budget.finish("domain")
+
+	if found, want := budget.slice("mx"), 76*time.Second; found != want {
+		t.Errorf("found %v, want %v", found, want)
+	}
+
+	if found, want := budget.remaining("mx"), 66*time.Second; found != want {
+		t.Errorf("found %v, want %v", found, want)
+	}
+
+	// a check that ran past its slice has nothing to donate
+	clock.Advance(80 * time.Second)
+	budget.finish("mx")
+
+	if budget.donated != 0 {
+		t.Errorf("found %v donated, want 0", budget.donated)
+	}
+}
+
+func TestProbeWithin(t *testing.T) {
+	hosts := []string{"mx1.example.com", "mx2.example.com", "mx3.example.com", "mx4.example.com", "mx5.example.com"}
+
+	t.Run("Exceeded", func(t *testing.T) {
+		clock := newBudgetClock()
+		budget := newTimeBudget(100*time.Second, []string{"mx", "domain", "spf"}, clock.Now)
+		ctx := contextWithBudget(context.Background(), budget, "mx")
+
+		// each probe takes 25s of the 60s slice, so the fourth would start after it ran out
+		results, skipped := probeWithin(ctx, hosts, func(ctx context.Context, host string) string {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Errorf("%s: found no deadline, want the slice's", host)
+			}
+
+			clock.Advance(25 * time.Second)
+			return host + " probed"
+		})
+
+		if len(results) != 3 || results["mx3.example.com"] != "mx3.example.com probed" {
+			t.Errorf("found %v, want the first 3 hosts probed", results)
+		}
+
+		if want := hosts[3:]; !slices.Equal(skipped, want) {
+			t.Errorf("found %v, want %v", skipped, want)
+		}
+	})
+
+	t.Run("Donated", func(t *testing.T) {
+		clock := newBudgetClock()
+		budget := newTimeBudget(100*time.Second, []string{"mx", "domain", "spf"}, clock.Now)
+		ctx := contextWithBudget(context.Background(), budget, "mx")
+
+		// the others finish at once, leaving mx the whole 90s
+		budget.finish("domain")
+		budget.finish("spf")
+
+		results, skipped := probeWithin(ctx, hosts, func(ctx context.Context, host string) string {
+			clock.Advance(25 * time.Second)
+			return host
+		})
+
+		if len(results) != 4 || !slices.Equal(skipped, hosts[4:]) {
+			t.Errorf("found %v probed and %v skipped, want the first 4 hosts probed", results, skipped)
+		}
+	})
+
+	t.Run("CutShort", func(t *testing.T) {
+		clock := newBudgetClock()
+		budget := newTimeBudget(100*time.Second, []string{"mx"}, clock.Now)
+		ctx := contextWithBudget(context.Background(), budget, "mx")
+
+		// the first probe hangs until the slice's last millisecond runs out
+		clock.Advance(90*time.Second - time.Millisecond)
+
+		results, skipped := probeWithin(ctx, hosts[:2], func(ctx context.Context, host string) string {
+			<-ctx.Done()
+
+			if cause := context.Cause(ctx); !errors.Is(cause, ErrTimeBudgetExceeded) {
+				t.Errorf("found %v, want %v", cause, ErrTimeBudgetExceeded)
+			}
+
+			clock.Advance(time.Millisecond)
+			return host
+		})
+
+		if len(results) != 0 || !slices.Equal(skipped, hosts[:2]) {
+			t.Errorf("found %v probed and %v skipped, want both hosts skipped", results, skipped)
+		}
+	})
+
+	t.Run("Unbounded", func(t *testing.T) {
+		results, skipped := probeWithin(context.Background(), hosts, func(ctx context.Context, host string) string {
+			if _, ok := ctx.Deadline(); ok {
+				t.Errorf("%s: found a deadline, want none without a budget", host)
+			}
+
+			return host
+		})
+
+		if len(results) != len(hosts) || len(skipped) != 0 {
+			t.Errorf("found %v probed and %v skipped, want every host probed", results, skipped)
+		}
+	})
+}
+
+func TestAdvisor_CheckMXBudget(t *testing.T) {
+	clock := newBudgetClock()
+
+	// every mail server takes 25s to turn the probe away
+	var dialed []string
+	network := testnet.New(t)
+	network.OnDial = func(address string) {
+		dialed = append(dialed, address)
+		clock.Advance(25 * time.Second)
+	}
+
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(network), WithHostResolver(network.Resolver), WithProxy(ProxyConfig{}))
+	defer advisor.Close()
+
+	budget := newTimeBudget(100*time.Second, []string{"mx", "domain", "spf"}, clock.Now)
+	ctx := contextWithBudget(context.Background(), budget, "mx")
+
+	advice, err := advisor.checkMX(ctx, []string{"mx1.example.com.", "mx2.example.com.", "mx3.example.com.", "mx4.example.com.", "mx5.example.com."})
+
+	want := "partial: time budget exceeded, so 2 of 5 MX hosts weren't probed (mx4.example.com, mx5.example.com)"
+	if !errors.Is(err, ErrTimeBudgetExceeded) || err.Error() != want {
+		t.Errorf("found %v, want %q", err, want)
+	}
+
+	if kind := ErrorKind(err); kind != ErrorKindTimeout {
+		t.Errorf("found %v, want %v", kind, ErrorKindTimeout)
+	}
+
+	if len(dialed) != 3 {
+		t.Errorf("found %v dialed, want the first 3 hosts", dialed)
+	}
+
+	// the probed hosts still have their advice, and the rest have none
+	for _, line := range advice {
+		if strings.HasPrefix(line, "mx4.example.com:") || strings.HasPrefix(line, "mx5.example.com:") {
+			t.Errorf("found %q, want no advice for the hosts that weren't probed", line)
+		}
+	}
+
+	if !slices.ContainsFunc(advice, func(line string) bool { return strings.HasPrefix(line, "mx3.example.com:") }) {
+		t.Errorf("found %v, want advice for mx3.example.com", advice)
+	}
+}
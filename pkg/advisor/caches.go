@@ -0,0 +1,248 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
+)
+
+const (
+	// CacheHostTLS is the cache namespace of the domains' web server TLS advice.
+	CacheHostTLS = "host_tls"
+
+	// CacheMailTLS is the cache namespace of the mail servers' STARTTLS advice.
+	CacheMailTLS = "mail_tls"
+
+	// CacheMailCertificates is the cache namespace of whether the mail
+	// servers' STARTTLS certificates are valid for their hostnames, only used
+	// by the MTA-STS check.
+	CacheMailCertificates = "mail_certificates"
+
+	// CacheMailDomains is the cache namespace of whether the domains of
+	// DMARC report destinations can receive mail.
+	CacheMailDomains = "mail_domains"
+
+	// CacheCertificates is the cache namespace of the domains' certificates
+	// found in the certificate transparency logs, only used if the check is
+	// enabled (see WithCertificateTransparency).
+	CacheCertificates = "certificates"
+
+	// CacheRegistrations is the cache namespace of the domains' registrations
+	// looked up over RDAP, only used if the check is enabled (see WithRDAP).
+	CacheRegistrations = "registrations"
+
+	// CacheSecurityContacts is the cache namespace of the domains'
+	// security.txt files, only used if the check is enabled (see
+	// WithSecurityTxt).
+	CacheSecurityContacts = "security_contacts"
+)
+
+// DefaultCacheTTLs are the lifetimes of the cache namespaces that don't
+// follow the advisor's cache lifetime by default. A server's TLS posture
+// rarely changes between scans, a domain's registration even less so, and
+// the certificate transparency log aggregators ask to be used sparingly.
+var DefaultCacheTTLs = map[string]time.Duration{
+	CacheCertificates:     ctCacheLifetime,
+	CacheHostTLS:          6 * time.Hour,
+	CacheMailCertificates: 6 * time.Hour,
+	CacheMailTLS:          6 * time.Hour,
+	CacheRegistrations:    rdapCacheLifetime,
+	CacheSecurityContacts: securityTxtCacheLifetime,
+}
+
+// ErrUnknownCacheNamespace is returned when flushing a cache namespace the
+// advisor doesn't have.
+var ErrUnknownCacheNamespace = errors.New("unknown cache namespace")
+
+type (
+	// namespaceCache is a cache of the advisor's registry, of any value type.
+	namespaceCache interface {
+		Close()
+		Flush()
+		Invalidate(tag string) int
+		Stats() cache.Stats
+	}
+
+	// cacheTagKey is the context key of the domain whose checks are running,
+	// which the entries they cache are tagged with (see InvalidateDomain).
+	cacheTagKey struct{}
+)
+
+// WithCacheTTL sets how long the entries of a cache namespace (CacheHostTLS,
+// CacheMailTLS, CacheMailCertificates, CacheMailDomains, CacheCertificates,
+// CacheRegistrations or CacheSecurityContacts) are cached for, overriding
+// DefaultCacheTTLs and the advisor's cache lifetime. A TTL of 0 or less disables caching for the namespace. Unknown
+// namespaces are ignored (see ParseCacheTTLs to validate them).
+func WithCacheTTL(namespace string, ttl time.Duration) Option {
+	return func(a *Advisor) {
+		a.cacheTTLs[namespace] = ttl
+	}
+}
+
+// ParseCacheTTL parses a cache namespace's TTL formatted as namespace=duration,
+// such as "mail_tls=6h".
+func ParseCacheTTL(value string) (string, time.Duration, error) {
+	namespace, duration, ok := strings.Cut(strings.TrimSpace(value), "=")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid cache TTL %q, it must be formatted as namespace=duration", value)
+	}
+
+	if !isCacheNamespace(namespace) {
+		return "", 0, fmt.Errorf("invalid cache TTL %q: %w %q", value, ErrUnknownCacheNamespace, namespace)
+	}
+
+	ttl, err := time.ParseDuration(duration)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid cache TTL %q, its duration must be formatted as in 30m or 6h", value)
+	}
+
+	return namespace, ttl, nil
+}
+
+// ParseCacheTTLs parses each TTL with ParseCacheTTL, returning an option
+// setting each of them, along with every error joined.
+func ParseCacheTTLs(values []string) ([]Option, error) {
+	var (
+		opts []Option
+		errs []error
+	)
+
+	for _, value := range values {
+		namespace, ttl, err := ParseCacheTTL(value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		opts = append(opts, WithCacheTTL(namespace, ttl))
+	}
+
+	return opts, errors.Join(errs...)
+}
+
+// CacheNamespaces returns the advisor's cache namespaces, sorted.
+func (a *Advisor) CacheNamespaces() []string {
+	namespaces := make([]string, 0, len(a.caches))
+	for namespace := range a.caches {
+		namespaces = append(namespaces, namespace)
+	}
+
+	sort.Strings(namespaces)
+
+	return namespaces
+}
+
+// CacheStats returns the hits and misses of each of the advisor's cache
+// namespaces, by namespace.
+func (a *Advisor) CacheStats() map[string]cache.Stats {
+	stats := make(map[string]cache.Stats, len(a.caches))
+	for namespace, c := range a.caches {
+		stats[namespace] = c.Stats()
+	}
+
+	return stats
+}
+
+// FlushCache removes every entry of the cache namespace, so the next scans
+// check afresh, such as once a server's certificate has been replaced. It
+// returns an error wrapping ErrUnknownCacheNamespace if the advisor has no
+// such namespace.
+func (a *Advisor) FlushCache(namespace string) error {
+	c, ok := a.caches[namespace]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCacheNamespace, namespace)
+	}
+
+	c.Flush()
+
+	return nil
+}
+
+// InvalidateDomain removes the cache entries related to the domain or host
+// from every namespace, returning how many were removed from each namespace
+// that had any. Entries are tagged with the hosts they're keyed by, and with
+// the domain whose checks cached them, so invalidating a domain also removes
+// the advice for its web and mail servers, and for its report destinations'
+// domains. A shared mail server's advice is removed for every domain using
+// it, as it's only cached once.
+func (a *Advisor) InvalidateDomain(domain string) map[string]int {
+	removed := make(map[string]int)
+
+	hostname, ok := normalizeHostname(domain)
+	if !ok {
+		return removed
+	}
+
+	for namespace, c := range a.caches {
+		if count := c.Invalidate(strings.ToLower(hostname)); count > 0 {
+			removed[namespace] = count
+		}
+	}
+
+	return removed
+}
+
+// cacheTags returns the tags of the entries cached by checks of the names:
+// the names themselves (lowercased), and the domain whose checks are
+// running, if any.
+func cacheTags(ctx context.Context, names ...string) []string {
+	tags := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		tags = append(tags, strings.ToLower(name))
+	}
+
+	if domain, ok := ctx.Value(cacheTagKey{}).(string); ok {
+		tags = append(tags, domain)
+	}
+
+	return tags
+}
+
+// contextWithCacheTag returns a copy of the context whose checks tag the
+// entries they cache with the domain.
+func contextWithCacheTag(ctx context.Context, domain string) context.Context {
+	hostname, ok := normalizeHostname(domain)
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, cacheTagKey{}, strings.ToLower(hostname))
+}
+
+// cacheTTL returns the lifetime of the cache namespace: the one it was given
+// with WithCacheTTL, its default, or else the fallback.
+func (a *Advisor) cacheTTL(namespace string, fallback time.Duration) time.Duration {
+	if ttl, ok := a.cacheTTLs[namespace]; ok {
+		return ttl
+	}
+
+	if ttl, ok := DefaultCacheTTLs[namespace]; ok {
+		return ttl
+	}
+
+	return fallback
+}
+
+// isCacheNamespace returns whether the namespace is one of the advisor's.
+func isCacheNamespace(namespace string) bool {
+	switch namespace {
+	case CacheHostTLS, CacheMailTLS, CacheMailCertificates, CacheMailDomains, CacheCertificates, CacheRegistrations, CacheSecurityContacts:
+		return true
+	}
+
+	return false
+}
+
+// newNamespaceCache returns a new cache for the namespace, with its lifetime,
+// registered with the advisor so it can be flushed and closed.
+func newNamespaceCache[T any](a *Advisor, namespace string, fallback time.Duration) *cache.Cache[T] {
+	c := cache.New[T](a.cacheTTL(namespace, fallback))
+	a.caches[namespace] = c
+
+	return c
+}
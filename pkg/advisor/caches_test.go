@@ -0,0 +1,131 @@
+package advisor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CacheTTLs(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Minute, false, WithCacheTTL(CacheMailTLS, time.Hour), WithCacheTTL("unknown", time.Hour))
+	t.Cleanup(advisor.Close)
+
+	for namespace, want := range map[string]time.Duration{
+		CacheHostTLS:     DefaultCacheTTLs[CacheHostTLS],
+		CacheMailTLS:     time.Hour,
+		CacheMailDomains: time.Minute,
+	} {
+		if ttl := advisor.cacheTTL(namespace, time.Minute); ttl != want {
+			t.Errorf("found %v for %s, want %v", ttl, namespace, want)
+		}
+	}
+
+	// the certificates are only cached if the check is enabled
+	if expected := []string{CacheHostTLS, CacheMailCertificates, CacheMailDomains, CacheMailTLS}; !reflect.DeepEqual(advisor.CacheNamespaces(), expected) {
+		t.Errorf("found %v, want %v", advisor.CacheNamespaces(), expected)
+	}
+
+	advice := []string{"cached"}
+	advisor.tlsCacheHost.Set("example.com", &advice)
+	advisor.tlsCacheMail.Set("mx.example.com", &advice)
+
+	if err := advisor.FlushCache(CacheMailTLS); err != nil {
+		t.Fatalf("found %v, want the namespace to be flushed", err)
+	}
+
+	if advisor.tlsCacheMail.Get("mx.example.com") != nil {
+		t.Error("found the flushed mail TLS advice still cached")
+	}
+
+	if advisor.tlsCacheHost.Get("example.com") == nil {
+		t.Error("found the host TLS advice flushed along with the mail TLS advice")
+	}
+
+	if err := advisor.FlushCache(CacheCertificates); !errors.Is(err, ErrUnknownCacheNamespace) {
+		t.Errorf("found %v, want %v", err, ErrUnknownCacheNamespace)
+	}
+}
+
+func TestAdvisor_CacheStats(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Minute, false)
+	t.Cleanup(advisor.Close)
+
+	advice := []string{"cached"}
+	advisor.tlsCacheHost.Set("example.com", &advice)
+
+	advisor.tlsCacheHost.Get("example.com")
+	advisor.tlsCacheHost.Get("example.com")
+	advisor.tlsCacheHost.Get("example.net")
+
+	stats := advisor.CacheStats()
+
+	if found := stats[CacheHostTLS]; found.Hits != 2 || found.Misses != 1 {
+		t.Errorf("found %+v, want 2 hits and 1 miss", found)
+	}
+
+	if rate := stats[CacheHostTLS].HitRate(); rate < 0.66 || rate > 0.67 {
+		t.Errorf("found %v, want a hit rate of 2/3", rate)
+	}
+
+	if found := stats[CacheMailTLS]; found.Hits+found.Misses != 0 || found.HitRate() != 0 {
+		t.Errorf("found %+v, want the unused namespace to have no lookups", found)
+	}
+}
+
+func TestParseCacheTTLs(t *testing.T) {
+	opts, err := ParseCacheTTLs([]string{"mail_tls=30m", " host_tls=0s "})
+	if err != nil {
+		t.Fatalf("found %v, want the TTLs to be parsed", err)
+	}
+
+	advisor := NewAdvisor(time.Second, time.Minute, false, opts...)
+	t.Cleanup(advisor.Close)
+
+	if expected := map[string]time.Duration{CacheMailTLS: 30 * time.Minute, CacheHostTLS: 0}; !reflect.DeepEqual(advisor.cacheTTLs, expected) {
+		t.Errorf("found %v, want %v", advisor.cacheTTLs, expected)
+	}
+
+	for _, value := range []string{"mail_tls", "results=1h", "mail_tls=6 hours"} {
+		if _, err = ParseCacheTTLs([]string{value}); err == nil {
+			t.Errorf("found no error for %q, want it to be invalid", value)
+		}
+	}
+}
+
+func TestAdvisor_InvalidateDomain(t *testing.T) {
+	dialer := &countingDialer{dials: make(map[string]int), release: make(chan struct{})}
+	close(dialer.release)
+
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(dialer), WithPort25SelfTest(""))
+	t.Cleanup(advisor.Close)
+
+	// both domains share the mail server, which is only probed once while cached
+	scan := func() {
+		advisor.CheckAll("example.com", "", "", "", []string{"mx.example.net"}, "")
+		advisor.CheckAll("example.org", "", "", "", []string{"mx.example.net"}, "")
+	}
+
+	scan()
+	scan()
+
+	if expected := map[string]int{"example.com:443": 1, "example.org:443": 1, "mx.example.net:25": 1}; !reflect.DeepEqual(dialer.dials, expected) {
+		t.Fatalf("found %v, want %v", dialer.dials, expected)
+	}
+
+	if removed := advisor.InvalidateDomain("Example.COM."); !reflect.DeepEqual(removed, map[string]int{CacheHostTLS: 1, CacheMailTLS: 1}) {
+		t.Errorf("found %v removed, want the domain's web and mail server advice", removed)
+	}
+
+	// the domain's servers are probed afresh, while the other domain's web server advice is still cached
+	scan()
+
+	if expected := map[string]int{"example.com:443": 2, "example.org:443": 1, "mx.example.net:25": 2}; !reflect.DeepEqual(dialer.dials, expected) {
+		t.Errorf("found %v, want %v", dialer.dials, expected)
+	}
+
+	// the mail server can be invalidated by its own name too
+	if removed := advisor.InvalidateDomain("mx.example.net"); !reflect.DeepEqual(removed, map[string]int{CacheMailTLS: 1}) {
+		t.Errorf("found %v removed, want the mail server's advice", removed)
+	}
+}
@@ -0,0 +1,498 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
+	"github.com/goccy/go-json"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultCTLogURL is the certificate transparency log aggregator queried by
+	// default, crt.sh's JSON API.
+	DefaultCTLogURL = "https://crt.sh/"
+
+	// ctCacheLifetime is how long a domain's certificates are cached by
+	// default (see CacheCertificates), regardless of the advisor's cache
+	// lifetime, as the aggregators are slow and ask to be used sparingly.
+	ctCacheLifetime = 12 * time.Hour
+
+	// ctRequestInterval spaces out requests to the aggregator.
+	ctRequestInterval = 2 * time.Second
+
+	// ctMaxResponseSize bounds the response read for a single domain.
+	ctMaxResponseSize = 32 << 20
+
+	// ctRecentWindow is how recently a certificate must have been issued to be
+	// reported as unpermitted, or as covering a new name.
+	ctRecentWindow = 30 * 24 * time.Hour
+
+	// ctExpiryWindow is how soon the apex or www's latest certificate must
+	// expire to be reported.
+	ctExpiryWindow = 14 * 24 * time.Hour
+
+	// ctMaxFindings is the number of certificates reported per finding, with
+	// any more summarized.
+	ctMaxFindings = 5
+)
+
+type (
+	// Certificate is a certificate found in the certificate transparency logs.
+	Certificate struct {
+		ID        int64     `json:"id" yaml:"id" doc:"The certificate's ID at the log aggregator." example:"12345678901"`
+		Issuer    string    `json:"issuer" yaml:"issuer" doc:"The certificate's issuer." example:"C=US, O=Let's Encrypt, CN=R3"`
+		Names     []string  `json:"names" yaml:"names" doc:"The names the certificate covers." example:"www.example.com"`
+		NotBefore time.Time `json:"notBefore" yaml:"notBefore" doc:"When the certificate's validity begins."`
+		NotAfter  time.Time `json:"notAfter" yaml:"notAfter" doc:"When the certificate expires."`
+	}
+
+	// CertificateReport holds the certificates behind the certificate advice,
+	// only included in detailed output.
+	CertificateReport struct {
+		Total       int           `json:"total" yaml:"total" doc:"The number of unexpired certificates found for the domain." example:"4"`
+		Unpermitted []Certificate `json:"unpermitted,omitempty" yaml:"unpermitted,omitempty" doc:"Recently issued certificates from a CA that the domain's CAA records don't permit."`
+		NewNames    []Certificate `json:"newNames,omitempty" yaml:"newNames,omitempty" doc:"Recently issued certificates for subdomains that had no earlier certificate."`
+		Expiring    []Certificate `json:"expiring,omitempty" yaml:"expiring,omitempty" doc:"The latest certificate of the apex or www, if it expires soon (or recently expired)."`
+	}
+
+	// ctLog looks up a domain's certificates at a crt.sh compatible log
+	// aggregator. Lookups are cached, shared between concurrent callers and
+	// spaced out, so bulk scans don't overwhelm the third-party service.
+	ctLog struct {
+		cache    *cache.Cache[[]Certificate]
+		group    singleflight.Group
+		interval time.Duration
+		now      func() time.Time
+		url      string
+
+		// mutex guards next, the earliest time the next request may be sent.
+		mutex sync.Mutex
+		next  time.Time
+	}
+
+	// ctEntry is a single certificate in crt.sh's JSON output.
+	ctEntry struct {
+		ID         int64  `json:"id"`
+		IssuerName string `json:"issuer_name"`
+		NameValue  string `json:"name_value"`
+		NotBefore  string `json:"not_before"`
+		NotAfter   string `json:"not_after"`
+	}
+)
+
+// caaIdentifiers maps the organization of each well-known CA (as it appears in
+// its certificates' issuer names) to the domains it recognizes in CAA
+// records. Certificates from CAs that aren't listed are never reported as
+// unpermitted, as their CAA domains can't be known.
+var caaIdentifiers = map[string][]string{
+	"Amazon":                {"amazon.com", "amazontrust.com", "awstrust.com", "amazonaws.com"},
+	"Buypass":               {"buypass.com", "buypass.no"},
+	"DigiCert":              {"digicert.com", "thawte.com", "geotrust.com", "rapidssl.com", "symantec.com"},
+	"Entrust":               {"entrust.net", "affirmtrust.com"},
+	"GlobalSign":            {"globalsign.com"},
+	"GoDaddy":               {"godaddy.com", "starfieldtech.com"},
+	"Google Trust Services": {"pki.goog", "google.com"},
+	"Let's Encrypt":         {"letsencrypt.org"},
+	"Microsoft":             {"microsoft.com"},
+	"Sectigo":               {"sectigo.com", "comodoca.com", "comodo.com", "usertrust.com", "trust-provider.com"},
+	"Starfield":             {"starfieldtech.com", "godaddy.com"},
+	"ZeroSSL":               {"sectigo.com", "zerossl.com"},
+}
+
+// WithCertificateTransparency enables the certificate check, which looks up
+// the certificates issued for each domain at a crt.sh compatible certificate
+// transparency log aggregator (DefaultCTLogURL if url is empty). It's
+// disabled by default, as it sends every scanned domain to a third party.
+func WithCertificateTransparency(url string) Option {
+	return func(a *Advisor) {
+		if url == "" {
+			url = DefaultCTLogURL
+		}
+
+		a.ctURL = url
+	}
+}
+
+func newCTLog(url string, ttl time.Duration) *ctLog {
+	return &ctLog{
+		cache:    cache.New[[]Certificate](ttl),
+		interval: ctRequestInterval,
+		now:      time.Now,
+		url:      url,
+	}
+}
+
+// CheckCertificates returns advice on the certificates issued for the domain,
+// as found in the certificate transparency logs, along with the certificates
+// behind it. caa is the domain's CAA records, as returned by the scanner.
+// Both are nil if the check isn't enabled.
+func (a *Advisor) CheckCertificates(ctx context.Context, domain string, caa []string) ([]string, *CertificateReport) {
+	if a.ctLog == nil {
+		return nil, nil
+	}
+
+	if a.isOffline(ctx) {
+		return []string{skippedOffline("The certificate transparency check")}, nil
+	}
+
+	if a.checkTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.checkTimeout)
+		defer cancel()
+	}
+
+	domain = normalizeDomain(domain)
+
+	certificates, err := a.ctLog.lookup(ctx, a.httpClient, domain)
+	if err != nil {
+		return []string{"We couldn't look up your domain's certificates in the certificate transparency logs, so they weren't checked."}, nil
+	}
+
+	report, expiringNames := analyzeCertificates(domain, caa, certificates, a.ctLog.now())
+
+	var advice []string
+
+	for index, certificate := range report.Unpermitted {
+		if index == ctMaxFindings {
+			advice = append(advice, fmt.Sprintf("%d more recently issued certificates are from a CA your CAA records don't permit.", len(report.Unpermitted)-ctMaxFindings))
+			break
+		}
+
+		advice = append(advice, fmt.Sprintf("A certificate for %s was issued on %s by %s, which your CAA records don't permit. If you didn't request it, revoke it and investigate how it was issued.", certificate.Names[0], certificate.NotBefore.Format(time.DateOnly), issuerOrganization(certificate.Issuer)))
+	}
+
+	for index, certificate := range report.NewNames {
+		if index == ctMaxFindings {
+			advice = append(advice, fmt.Sprintf("%d more certificates were recently issued for subdomains that had no earlier certificate.", len(report.NewNames)-ctMaxFindings))
+			break
+		}
+
+		advice = append(advice, fmt.Sprintf("A certificate was issued on %s for %s, which had no earlier certificate. Check that it was expected, as certificates for unfamiliar subdomains can be a sign of a subdomain takeover or an unsanctioned service.", certificate.NotBefore.Format(time.DateOnly), strings.Join(certificate.Names, ", ")))
+	}
+
+	for index, certificate := range report.Expiring {
+		if certificate.NotAfter.Before(a.ctLog.now()) {
+			advice = append(advice, fmt.Sprintf("The latest certificate for %s expired on %s, and no renewal has been logged. Renew it, or stop serving HTTPS for it.", expiringNames[index], certificate.NotAfter.Format(time.DateOnly)))
+		} else {
+			advice = append(advice, fmt.Sprintf("The latest certificate for %s expires on %s, and no renewal has been logged yet. Renew it soon to avoid an outage.", expiringNames[index], certificate.NotAfter.Format(time.DateOnly)))
+		}
+	}
+
+	if len(advice) == 0 {
+		advice = append(advice, "No unexpected certificates were found in the certificate transparency logs for your domain. No further action needed.")
+	}
+
+	return advice, report
+}
+
+// analyzeCertificates finds the certificates worth reporting, as of now, along
+// with the name (the apex or www) each expiring certificate was reported for.
+func analyzeCertificates(domain string, caa []string, certificates []Certificate, now time.Time) (*CertificateReport, []string) {
+	report := &CertificateReport{}
+	recent := now.Add(-ctRecentWindow)
+	issue, issueWild := permittedIssuers(caa)
+
+	// the first time each name had a certificate, and whether the domain has any history before the recent window
+	firstSeen := make(map[string]time.Time)
+	established := false
+
+	for _, certificate := range certificates {
+		if certificate.NotAfter.After(now) {
+			report.Total++
+		}
+
+		if certificate.NotBefore.Before(recent) {
+			established = true
+		}
+
+		for _, name := range certificate.Names {
+			if seen, ok := firstSeen[name]; !ok || certificate.NotBefore.Before(seen) {
+				firstSeen[name] = certificate.NotBefore
+			}
+		}
+	}
+
+	latest := make(map[string]Certificate)
+
+	for _, certificate := range certificates {
+		if certificate.NotBefore.After(recent) {
+			permitted := issue
+			if issueWild != nil && hasWildcardName(certificate.Names) {
+				permitted = issueWild
+			}
+
+			if permitted != nil && !issuerPermitted(certificate.Issuer, permitted) {
+				report.Unpermitted = append(report.Unpermitted, certificate)
+			}
+
+			// a newly registered domain's names are all new, so they're only reported once it has some history
+			if established && coversNewName(domain, certificate.Names, firstSeen, recent) {
+				report.NewNames = append(report.NewNames, certificate)
+			}
+		}
+
+		for _, name := range []string{domain, "www." + domain} {
+			if covers(certificate.Names, name) && certificate.NotAfter.After(latest[name].NotAfter) {
+				latest[name] = certificate
+			}
+		}
+	}
+
+	var expiringNames []string
+
+	for _, name := range []string{domain, "www." + domain} {
+		certificate, ok := latest[name]
+		if ok && certificate.NotAfter.Before(now.Add(ctExpiryWindow)) && certificate.NotAfter.After(recent) {
+			report.Expiring = append(report.Expiring, certificate)
+			expiringNames = append(expiringNames, name)
+		}
+	}
+
+	return report, expiringNames
+}
+
+// permittedIssuers returns the CA domains permitted by the CAA records' issue
+// and issuewild properties. Either is nil if there are no records with that
+// property (and so no restriction), and empty if issuance is forbidden.
+func permittedIssuers(caa []string) (issue, issueWild map[string]struct{}) {
+	for _, record := range caa {
+		fields := strings.SplitN(record, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		value, _, _ := strings.Cut(strings.Trim(fields[2], `"`), ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		var permitted *map[string]struct{}
+
+		switch strings.ToLower(fields[1]) {
+		case "issue":
+			permitted = &issue
+		case "issuewild":
+			permitted = &issueWild
+		default:
+			continue
+		}
+
+		if *permitted == nil {
+			*permitted = make(map[string]struct{})
+		}
+
+		if value != "" {
+			(*permitted)[value] = struct{}{}
+		}
+	}
+
+	return issue, issueWild
+}
+
+// issuerPermitted reports whether a certificate's issuer is permitted. Issuers
+// whose CAA domains aren't known are always permitted.
+func issuerPermitted(issuer string, permitted map[string]struct{}) bool {
+	organization := issuerOrganization(issuer)
+
+	for name, identifiers := range caaIdentifiers {
+		if !strings.Contains(organization, name) {
+			continue
+		}
+
+		for _, identifier := range identifiers {
+			if _, ok := permitted[identifier]; ok {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// issuerOrganization returns the O= attribute of an issuer's distinguished
+// name, or the whole name if it has none.
+func issuerOrganization(issuer string) string {
+	for _, attribute := range strings.Split(issuer, ",") {
+		if name, value, ok := strings.Cut(strings.TrimSpace(attribute), "="); ok && name == "O" {
+			return strings.Trim(value, `"`)
+		}
+	}
+
+	return issuer
+}
+
+func hasWildcardName(names []string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, "*.") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// coversNewName reports whether any of a certificate's subdomain names (other
+// than www) were first seen after the given time.
+func coversNewName(domain string, names []string, firstSeen map[string]time.Time, after time.Time) bool {
+	for _, name := range names {
+		if name == domain || name == "www."+domain || !strings.HasSuffix(name, "."+domain) {
+			continue
+		}
+
+		if firstSeen[name].After(after) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// covers reports whether the names include the given name, directly or via a
+// wildcard.
+func covers(names []string, name string) bool {
+	_, parent, _ := strings.Cut(name, ".")
+
+	for _, candidate := range names {
+		if candidate == name || candidate == "*."+parent {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookup returns every certificate logged for the domain and its subdomains.
+func (l *ctLog) lookup(ctx context.Context, client *http.Client, domain string) ([]Certificate, error) {
+	if certificates := l.cache.Get(domain); certificates != nil {
+		return *certificates, nil
+	}
+
+	result, err, _ := l.group.Do(domain, func() (any, error) {
+		if err := l.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		certificates, err := l.fetch(ctx, client, domain)
+		if err != nil {
+			return nil, err
+		}
+
+		l.cache.SetTagged(domain, &certificates, domain)
+
+		return certificates, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]Certificate), nil
+}
+
+// wait blocks until the next request may be sent, reserving its slot.
+func (l *ctLog) wait(ctx context.Context) error {
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (l *ctLog) fetch(ctx context.Context, client *http.Client, domain string) ([]Certificate, error) {
+	requestURL, err := url.Parse(l.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CT log URL: %w", err)
+	}
+
+	// crt.sh doesn't match the apex with %., but its certificates almost always cover www too
+	requestURL.RawQuery = url.Values{"q": {"%." + domain}, "output": {"json"}, "deduplicate": {"Y"}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CT log responded with status %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, ctMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ctEntry
+	if err = json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse CT log response: %w", err)
+	}
+
+	certificates := make([]Certificate, 0, len(entries))
+
+	for _, entry := range entries {
+		notBefore, err := time.Parse("2006-01-02T15:04:05", entry.NotBefore)
+		if err != nil {
+			continue
+		}
+
+		notAfter, err := time.Parse("2006-01-02T15:04:05", entry.NotAfter)
+		if err != nil {
+			continue
+		}
+
+		names := make(map[string]struct{})
+		for _, name := range strings.Split(entry.NameValue, "\n") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				names[name] = struct{}{}
+			}
+		}
+
+		certificate := Certificate{ID: entry.ID, Issuer: entry.IssuerName, NotBefore: notBefore, NotAfter: notAfter}
+		for name := range names {
+			certificate.Names = append(certificate.Names, name)
+		}
+
+		sort.Strings(certificate.Names)
+		certificates = append(certificates, certificate)
+	}
+
+	// oldest first, so findings are reported in the order they were issued
+	sort.SliceStable(certificates, func(i, j int) bool {
+		return certificates[i].NotBefore.Before(certificates[j].NotBefore)
+	})
+
+	return certificates, nil
+}
@@ -0,0 +1,167 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeCertificates(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	days := func(offset int) time.Time {
+		return now.AddDate(0, 0, offset)
+	}
+
+	letsEncrypt := "C=US, O=Let's Encrypt, CN=R3"
+	sectigo := "C=GB, O=Sectigo Limited, CN=Sectigo RSA Domain Validation Secure Server CA"
+
+	certificates := []Certificate{
+		{ID: 1, Issuer: letsEncrypt, Names: []string{"example.com", "www.example.com"}, NotBefore: days(-200), NotAfter: days(-110)},
+		{ID: 2, Issuer: letsEncrypt, Names: []string{"mail.example.com"}, NotBefore: days(-120), NotAfter: days(-30)},
+		{ID: 3, Issuer: letsEncrypt, Names: []string{"example.com", "www.example.com"}, NotBefore: days(-80), NotAfter: days(10)},
+		{ID: 4, Issuer: sectigo, Names: []string{"mail.example.com"}, NotBefore: days(-5), NotAfter: days(360)},
+		{ID: 5, Issuer: letsEncrypt, Names: []string{"staging.example.com"}, NotBefore: days(-2), NotAfter: days(88)},
+	}
+
+	t.Run("Findings", func(t *testing.T) {
+		report, expiringNames := analyzeCertificates("example.com", []string{`0 issue "letsencrypt.org"`}, certificates, now)
+
+		if report.Total != 3 {
+			t.Errorf("found %d unexpired certificates, want 3", report.Total)
+		}
+
+		if len(report.Unpermitted) != 1 || report.Unpermitted[0].ID != 4 {
+			t.Errorf("found %v, want the Sectigo certificate to be unpermitted", report.Unpermitted)
+		}
+
+		if len(report.NewNames) != 1 || report.NewNames[0].ID != 5 {
+			t.Errorf("found %v, want the staging certificate to cover a new name", report.NewNames)
+		}
+
+		if len(report.Expiring) != 2 || report.Expiring[0].ID != 3 || expiringNames[0] != "example.com" || expiringNames[1] != "www.example.com" {
+			t.Errorf("found %v for %v, want the apex and www certificate to be expiring", report.Expiring, expiringNames)
+		}
+	})
+
+	t.Run("NoCAA", func(t *testing.T) {
+		report, _ := analyzeCertificates("example.com", nil, certificates, now)
+
+		if len(report.Unpermitted) != 0 {
+			t.Errorf("found %v, want no unpermitted certificates without CAA records", report.Unpermitted)
+		}
+	})
+
+	t.Run("IssueWild", func(t *testing.T) {
+		wildcard := []Certificate{{ID: 6, Issuer: letsEncrypt, Names: []string{"*.example.com"}, NotBefore: days(-1), NotAfter: days(89)}}
+		caa := []string{`0 issue "letsencrypt.org"`, `0 issuewild ";"`}
+
+		report, _ := analyzeCertificates("example.com", caa, wildcard, now)
+
+		if len(report.Unpermitted) != 1 {
+			t.Errorf("found %v, want the wildcard certificate to be unpermitted", report.Unpermitted)
+		}
+	})
+
+	t.Run("NewDomain", func(t *testing.T) {
+		report, _ := analyzeCertificates("example.com", nil, certificates[4:], now)
+
+		if len(report.NewNames) != 0 {
+			t.Errorf("found %v, want no new names for a domain without any history", report.NewNames)
+		}
+	})
+
+	t.Run("Renewed", func(t *testing.T) {
+		renewed := append(certificates, Certificate{ID: 7, Issuer: letsEncrypt, Names: []string{"*.example.com", "example.com"}, NotBefore: days(-1), NotAfter: days(89)})
+
+		report, _ := analyzeCertificates("example.com", nil, renewed, now)
+
+		if len(report.Expiring) != 0 {
+			t.Errorf("found %v, want no expiring certificates once they've been renewed", report.Expiring)
+		}
+	})
+}
+
+func TestAdvisor_CheckCertificates(t *testing.T) {
+	now := time.Now().UTC()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		switch r.URL.Query().Get("q") {
+		case "%.example.com":
+			_, _ = fmt.Fprintf(w, `[{"id":1,"issuer_name":"C=US, O=Let's Encrypt, CN=R3","name_value":"example.com\nwww.example.com","not_before":%q,"not_after":%q},`+
+				`{"id":2,"issuer_name":"C=GB, O=Sectigo Limited, CN=Sectigo RSA","name_value":"shop.example.com","not_before":%q,"not_after":%q}]`,
+				now.AddDate(0, -3, 0).Format("2006-01-02T15:04:05"), now.AddDate(0, 0, 60).Format("2006-01-02T15:04:05"),
+				now.AddDate(0, 0, -3).Format("2006-01-02T15:04:05"), now.AddDate(0, 0, 87).Format("2006-01-02T15:04:05"))
+		case "%.example.org":
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Disabled", func(t *testing.T) {
+		advice, report := NewAdvisor(time.Second, time.Second, false).CheckCertificates(context.Background(), "example.com", nil)
+
+		if advice != nil || report != nil {
+			t.Errorf("found %v and %v, want nothing when the check isn't enabled", advice, report)
+		}
+	})
+
+	advisor := NewAdvisor(time.Second, time.Second, false, WithCertificateTransparency(server.URL))
+	defer advisor.Close()
+	advisor.ctLog.interval = 0
+
+	t.Run("Unpermitted", func(t *testing.T) {
+		advice, report := advisor.CheckCertificates(context.Background(), "example.com", []string{`0 issue "letsencrypt.org"`})
+
+		if len(advice) != 2 || !strings.Contains(advice[0], "shop.example.com") || !strings.Contains(advice[0], "by Sectigo Limited, which your CAA records don't permit") {
+			t.Fatalf("found %v, want the unpermitted certificate advice", advice)
+		}
+
+		if severity := Classify(advice[0]); severity != SeverityHigh {
+			t.Errorf("found %v, want %v", severity, SeverityHigh)
+		}
+
+		if report == nil || report.Total != 2 {
+			t.Errorf("found %v, want a report of both certificates", report)
+		}
+
+		// the Sectigo certificate is also the first for shop.example.com
+		if severity := Classify(advice[1]); severity != SeverityMedium {
+			t.Errorf("found %v, want %v for %q", severity, SeverityMedium, advice[1])
+		}
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		before := requests.Load()
+		advisor.CheckCertificates(context.Background(), "EXAMPLE.com.", nil)
+
+		if requests.Load() != before {
+			t.Errorf("found %d requests, want the lookup to be cached", requests.Load()-before)
+		}
+	})
+
+	t.Run("Clean", func(t *testing.T) {
+		advice, _ := advisor.CheckCertificates(context.Background(), "example.org", nil)
+
+		if len(advice) != 1 || Classify(advice[0]) != SeverityInfo {
+			t.Errorf("found %v, want the no unexpected certificates advice", advice)
+		}
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		advice, report := advisor.CheckCertificates(context.Background(), "example.net", nil)
+
+		if len(advice) != 1 || !strings.Contains(advice[0], "couldn't look up") || report != nil {
+			t.Errorf("found %v and %v, want the failed lookup advice", advice, report)
+		}
+	})
+}
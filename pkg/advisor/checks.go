@@ -0,0 +1,66 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+const (
+	// CheckTLS runs the TLS checks of the domain's web and mail servers, as
+	// if the advisor was created with checkTLS (see ContextWithChecks).
+	CheckTLS = "tls"
+
+	// CheckOffline skips every check that needs internet access, as
+	// WithOffline does (see ContextWithChecks). It takes precedence over
+	// CheckTLS.
+	CheckOffline = "offline"
+)
+
+// Checks are the optional checks accepted by ContextWithChecks.
+var Checks = []string{CheckOffline, CheckTLS}
+
+// checksKey is the context key of the optional checks of a single request.
+type checksKey struct{}
+
+// ContextWithChecks returns a copy of the context whose checks also run the
+// given optional checks (CheckTLS or CheckOffline), such as to probe the TLS
+// of one domain of a bulk request, or to keep another offline. They're added
+// to the advisor's own configuration, rather than replacing it, so the TLS
+// checks of an advisor created with checkTLS can only be skipped with
+// CheckOffline. Unknown checks are ignored (see ValidateCheck).
+func ContextWithChecks(ctx context.Context, checks ...string) context.Context {
+	if len(checks) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, checksKey{}, checks)
+}
+
+// ValidateCheck returns an error if the check isn't one of Checks.
+func ValidateCheck(check string) error {
+	if !slices.Contains(Checks, check) {
+		return fmt.Errorf("unknown check %q, expected one of %v", check, Checks)
+	}
+
+	return nil
+}
+
+// tlsEnabled reports whether the TLS checks run, as the advisor was created
+// with checkTLS, or the context enables them.
+func (a *Advisor) tlsEnabled(ctx context.Context) bool {
+	return a.checkTLS || contextHasCheck(ctx, CheckTLS)
+}
+
+// isOffline reports whether the checks that need internet access are
+// skipped, as the advisor is offline, or the context keeps them offline.
+func (a *Advisor) isOffline(ctx context.Context) bool {
+	return a.offline || contextHasCheck(ctx, CheckOffline)
+}
+
+// contextHasCheck reports whether the context enables the optional check
+// (see ContextWithChecks).
+func contextHasCheck(ctx context.Context, check string) bool {
+	checks, _ := ctx.Value(checksKey{}).([]string)
+	return slices.Contains(checks, check)
+}
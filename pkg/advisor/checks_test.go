@@ -0,0 +1,51 @@
+package advisor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestContextWithChecks(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+	t.Cleanup(advisor.Close)
+
+	ctx := context.Background()
+
+	if advisor.tlsEnabled(ctx) || advisor.isOffline(ctx) {
+		t.Fatal("found the optional checks enabled without a context enabling them")
+	}
+
+	if !advisor.tlsEnabled(ContextWithChecks(ctx, CheckTLS)) {
+		t.Error("found the TLS checks disabled, want them enabled by the context")
+	}
+
+	// offline takes precedence, so the TLS check of the mail servers is skipped rather than run
+	offline := ContextWithChecks(ctx, CheckTLS, CheckOffline)
+
+	advice, err := advisor.checkMX(offline, []string{"mx1.example.com.", "mx2.example.com."})
+	if err != nil {
+		t.Fatalf("found %v, want no error", err)
+	}
+
+	if expected := []string{"You have multiple mail servers setup, which is recommended.", skippedOffline("The TLS check of your mail servers")}; !reflect.DeepEqual(advice, expected) {
+		t.Errorf("found %v, want %v", advice, expected)
+	}
+
+	if ContextWithChecks(ctx) != ctx {
+		t.Error("found a new context for no checks, want the same context")
+	}
+}
+
+func TestValidateCheck(t *testing.T) {
+	for _, check := range Checks {
+		if err := ValidateCheck(check); err != nil {
+			t.Errorf("found %v for %q, want no error", err, check)
+		}
+	}
+
+	if err := ValidateCheck("dmarc"); err == nil {
+		t.Error("found no error for an unknown check")
+	}
+}
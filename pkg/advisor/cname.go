@@ -0,0 +1,20 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckApexCNAME returns advice on a CNAME record at the domain, given the
+// chain of targets it resolves through. A CNAME can't coexist with any other
+// record (RFC 1034, section 3.6.2), so one at the apex of a zone, which must
+// have SOA and NS records, breaks the zone: resolvers may answer with the
+// CNAME's target's records, or with nothing at all. CNAMEs below the apex are
+// allowed, so only organizational domains are advised.
+func (a *Advisor) CheckApexCNAME(domain string, chain []string) []string {
+	if len(chain) == 0 || OrganizationalDomain(domain) != normalizeDomain(domain) {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("Your domain has a CNAME record at its apex (%s), which violates DNS rules, as a CNAME can't coexist with the SOA, NS, MX and TXT records the apex needs. Resolvers may answer with the records of %s instead of your own, or with nothing at all, so your SPF and DMARC lookups may return empty and mail authentication may fail intermittently. Replace the CNAME with A and AAAA records, or use your DNS provider's CNAME flattening (often called ALIAS or ANAME) instead.", strings.Join(append([]string{normalizeDomain(domain)}, chain...), " -> "), chain[len(chain)-1])}
+}
@@ -0,0 +1,44 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckApexCNAME(t *testing.T) {
+	advisor := NewAdvisor(time.Second, 0, false)
+
+	tests := []struct {
+		name     string
+		domain   string
+		chain    []string
+		expected string
+	}{
+		{"NoCNAME", "example.com", nil, ""},
+		{"Apex", "example.com", []string{"example.herokudns.com"}, "(example.com -> example.herokudns.com)"},
+		{"Chain", "Example.co.uk.", []string{"www.example.net", "edge.cdn.example"}, "(example.co.uk -> www.example.net -> edge.cdn.example), which violates DNS rules"},
+		{"Subdomain", "www.example.com", []string{"example.herokudns.com"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckApexCNAME(test.domain, test.chain)
+			if test.expected == "" {
+				if advice != nil {
+					t.Errorf("found %v, want no advice", advice)
+				}
+
+				return
+			}
+
+			if len(advice) != 1 || !strings.Contains(advice[0], test.expected) {
+				t.Fatalf("found %v, want it to contain %q", advice, test.expected)
+			}
+
+			if severity := Classify(advice[0]); severity != SeverityHigh {
+				t.Errorf("found %v, want %v", severity, SeverityHigh)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package advisor
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// Config is the advisor's effective configuration, as far as it affects the
+// advice it gives: the checks it runs, and what they're bounded by. Settings
+// that only affect how the checks connect or how fast they run (such as the
+// proxy, the cache lifetimes or the SMTP politeness) are left out. It's
+// normalized, so advisors configured equivalently have equal configs.
+type Config struct {
+	Timeout                 time.Duration `json:"timeout"`
+	CheckTimeout            time.Duration `json:"checkTimeout,omitempty"`
+	TimeBudget              time.Duration `json:"timeBudget,omitempty"`
+	CheckTLS                bool          `json:"checkTLS,omitempty"`
+	DisabledChecks          []string      `json:"disabledChecks,omitempty"`
+	Extensions              []string      `json:"extensions,omitempty"`
+	CertificateTransparency string        `json:"certificateTransparency,omitempty"`
+	RDAP                    string        `json:"rdap,omitempty"`
+	RDAPExpiryWindow        time.Duration `json:"rdapExpiryWindow,omitempty"`
+	SecurityTxt             bool          `json:"securityTxt,omitempty"`
+	Port25Reference         string        `json:"port25Reference,omitempty"`
+	ResolveOverrides        []string      `json:"resolveOverrides,omitempty"`
+	DKIMRotationMonths      int           `json:"dkimRotationMonths"`
+	Detailed                bool          `json:"detailed,omitempty"`
+	Offline                 bool          `json:"offline,omitempty"`
+	StrictASCII             bool          `json:"strictASCII,omitempty"`
+	SubdomainAdvice         bool          `json:"subdomainAdvice"`
+	SubdomainChecks         []string      `json:"subdomainChecks,omitempty"`
+}
+
+// Config returns the advisor's effective configuration.
+func (a *Advisor) Config() Config {
+	config := Config{
+		Timeout:            a.timeout,
+		CheckTimeout:       a.checkTimeout,
+		TimeBudget:         a.timeBudget,
+		CheckTLS:           a.checkTLS,
+		DKIMRotationMonths: a.dkimRotationMonths,
+		Detailed:           a.detailed,
+		Offline:            a.offline,
+		SecurityTxt:        a.securityTxt != nil,
+		StrictASCII:        a.strictASCII,
+		SubdomainAdvice:    a.subdomainAdvice,
+	}
+
+	for _, check := range a.checks() {
+		if !slices.Contains(config.Extensions, check.Name()) {
+			config.Extensions = append(config.Extensions, check.Name())
+		}
+	}
+
+	for _, name := range a.disabledChecks {
+		if !slices.Contains(config.DisabledChecks, name) {
+			config.DisabledChecks = append(config.DisabledChecks, name)
+		}
+	}
+
+	// the checks run for subdomains only matter if their advice is tailored
+	if a.subdomainAdvice {
+		for _, name := range a.subdomainChecks {
+			if !slices.Contains(config.SubdomainChecks, name) {
+				config.SubdomainChecks = append(config.SubdomainChecks, name)
+			}
+		}
+	}
+
+	sort.Strings(config.Extensions)
+	sort.Strings(config.DisabledChecks)
+	sort.Strings(config.SubdomainChecks)
+
+	if a.ctLog != nil {
+		config.CertificateTransparency = a.ctURL
+	}
+
+	if a.rdap != nil {
+		config.RDAP, config.RDAPExpiryWindow = a.rdapURL, a.rdapWindow
+	}
+
+	// the connections the self test and overrides affect are only made by the TLS checks
+	if a.checkTLS {
+		if a.port25 != nil {
+			config.Port25Reference = a.port25.status.Reference
+		}
+
+		for _, override := range a.resolveOverrides {
+			config.ResolveOverrides = append(config.ResolveOverrides, override.String())
+		}
+
+		sort.Strings(config.ResolveOverrides)
+	}
+
+	return config
+}
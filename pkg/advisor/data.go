@@ -0,0 +1,259 @@
+package advisor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// DataFiles are the paths of the data files extending the advisor's
+	// built-in data, which is shared by every advisor. An empty path leaves
+	// that data built-in.
+	DataFiles struct {
+		// ConsumerDomains lists more consumer mailbox domains (such as
+		// gmail.com), one per line, ignoring blank lines and # comments.
+		ConsumerDomains string
+
+		// Providers lists more mail providers and managed services, in the
+		// format of providers.yaml. A provider named as a built-in one replaces
+		// it.
+		Providers string
+
+		// AdviceCatalog lists more severity rules, each with a phrase, severity,
+		// reference and remediation, under catalog. They're matched before the
+		// built-in rules, and a rule with a built-in rule's phrase replaces it.
+		AdviceCatalog string
+	}
+
+	// DataSummary describes the data the advisor is using.
+	DataSummary struct {
+		ConsumerDomains int
+		Providers       int
+		CatalogEntries  int
+		CatalogVersion  string
+	}
+
+	// data is a snapshot of the advisor's data, which is never modified once
+	// built, so it's replaced as a whole when reloaded.
+	data struct {
+		consumerDomains map[string]struct{}
+		providers       []provider
+		catalog         []severityRule
+		catalogVersion  string
+	}
+)
+
+// currentData is the data new scans use, replaced by LoadData.
+var currentData atomic.Pointer[data]
+
+func init() {
+	currentData.Store(newData(nil, nil, nil))
+}
+
+// LoadData reads the data files, replacing the data new scans use once every
+// file has been read. Scans already running keep the data they started with.
+// If any file fails to be read, the data in use is left in place.
+func LoadData(files DataFiles) (DataSummary, error) {
+	consumerDomains, err := readDataFile(files.ConsumerDomains, parseConsumerDomains)
+	if err != nil {
+		return DataSummary{}, fmt.Errorf("failed to load the consumer domains: %w", err)
+	}
+
+	providers, err := readDataFile(files.Providers, parseProviders)
+	if err != nil {
+		return DataSummary{}, fmt.Errorf("failed to load the providers: %w", err)
+	}
+
+	catalog, err := readDataFile(files.AdviceCatalog, parseCatalog)
+	if err != nil {
+		return DataSummary{}, fmt.Errorf("failed to load the advice catalog: %w", err)
+	}
+
+	loaded := newData(consumerDomains, providers, catalog)
+	currentData.Store(loaded)
+
+	return loaded.summary(), nil
+}
+
+// CurrentData describes the data new scans use.
+func CurrentData() DataSummary {
+	return currentData.Load().summary()
+}
+
+// Pinned returns a copy of the advisor that keeps using the data in use now,
+// even if it's reloaded, so the checks of a single scan are consistent.
+func (a *Advisor) Pinned() *Advisor {
+	pinned := *a
+	pinned.data = a.loadData()
+
+	return &pinned
+}
+
+// loadData returns the data the advisor's checks use.
+func (a *Advisor) loadData() *data {
+	if a.data != nil {
+		return a.data
+	}
+
+	return currentData.Load()
+}
+
+// newData builds a snapshot of the built-in data, extended by the given
+// entries.
+func newData(consumerDomains []string, providers []provider, catalog []severityRule) *data {
+	snapshot := &data{consumerDomains: make(map[string]struct{}, len(consumerDomainList)+len(consumerDomains))}
+
+	for _, list := range [][]string{consumerDomainList, consumerDomains} {
+		for _, domain := range list {
+			snapshot.consumerDomains[domain] = struct{}{}
+		}
+	}
+
+	snapshot.providers = append(snapshot.providers, knownProviders...)
+
+	for _, extra := range providers {
+		replaced := false
+
+		for index := range snapshot.providers {
+			if strings.EqualFold(snapshot.providers[index].Name, extra.Name) {
+				snapshot.providers[index], replaced = extra, true
+			}
+		}
+
+		if !replaced {
+			snapshot.providers = append(snapshot.providers, extra)
+		}
+	}
+
+	// the extra rules come first, as the first rule matching a line of advice applies
+	snapshot.catalog = append(snapshot.catalog, catalog...)
+
+	for _, rule := range severityRules {
+		if !hasPhrase(catalog, rule.phrase) {
+			snapshot.catalog = append(snapshot.catalog, rule)
+		}
+	}
+
+	hash := sha256.New()
+	for _, rule := range snapshot.catalog {
+		_, _ = fmt.Fprintf(hash, "%q %d %q %q\n", rule.phrase, rule.severity, rule.reference, rule.remediation)
+	}
+
+	snapshot.catalogVersion = hex.EncodeToString(hash.Sum(nil))[:12]
+
+	return snapshot
+}
+
+func (d *data) summary() DataSummary {
+	return DataSummary{ConsumerDomains: len(d.consumerDomains), Providers: len(d.providers), CatalogEntries: len(d.catalog), CatalogVersion: d.catalogVersion}
+}
+
+// hasPhrase reports whether any of the rules has the phrase.
+func hasPhrase(rules []severityRule, phrase string) bool {
+	for _, rule := range rules {
+		if rule.phrase == phrase {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readDataFile parses the data file at path, returning nothing if the path is
+// empty.
+func readDataFile[T any](path string, parse func(data []byte) ([]T, error)) ([]T, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parse(contents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return entries, nil
+}
+
+func parseConsumerDomains(contents []byte) ([]string, error) {
+	var domains []string
+
+	lines := bufio.NewScanner(bytes.NewReader(contents))
+	for number := 1; lines.Scan(); number++ {
+		line, _, _ := strings.Cut(lines.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		domain := strings.ToLower(strings.TrimSuffix(line, "."))
+		if strings.ContainsAny(domain, " \t") || !strings.Contains(domain, ".") {
+			return nil, fmt.Errorf("line %d: %q isn't a domain", number, line)
+		}
+
+		domains = append(domains, domain)
+	}
+
+	return domains, lines.Err()
+}
+
+func parseProviders(contents []byte) ([]provider, error) {
+	var table struct {
+		Providers []provider `yaml:"providers"`
+	}
+
+	if err := yaml.Unmarshal(contents, &table); err != nil {
+		return nil, err
+	}
+
+	for index, entry := range table.Providers {
+		if entry.Name == "" || len(entry.MX)+len(entry.SPF)+len(entry.CNAME) == 0 {
+			return nil, fmt.Errorf("provider %d needs a name and at least one fingerprint (mx, spf or cname)", index+1)
+		}
+	}
+
+	return table.Providers, nil
+}
+
+func parseCatalog(contents []byte) ([]severityRule, error) {
+	var table struct {
+		Catalog []struct {
+			Phrase      string `yaml:"phrase"`
+			Severity    string `yaml:"severity"`
+			Reference   string `yaml:"reference"`
+			Remediation string `yaml:"remediation"`
+		} `yaml:"catalog"`
+	}
+
+	if err := yaml.Unmarshal(contents, &table); err != nil {
+		return nil, err
+	}
+
+	rules := make([]severityRule, 0, len(table.Catalog))
+
+	for index, entry := range table.Catalog {
+		if entry.Phrase == "" {
+			return nil, fmt.Errorf("entry %d has no phrase", index+1)
+		}
+
+		severity, err := ParseSeverity(entry.Severity)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", index+1, err)
+		}
+
+		rules = append(rules, severityRule{phrase: entry.Phrase, severity: severity, reference: entry.Reference, remediation: entry.Remediation})
+	}
+
+	return rules, nil
+}
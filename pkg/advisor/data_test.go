@@ -0,0 +1,214 @@
+package advisor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const consumerPhrase = "Consumer based accounts"
+
+// writeDataFile writes a data file into the test's temporary directory.
+func writeDataFile(t *testing.T, name, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// restoreData puts the built-in data back once the test is done, as the data
+// is shared by every advisor.
+func restoreData(t *testing.T) {
+	t.Cleanup(func() {
+		if _, err := LoadData(DataFiles{}); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestLoadData(t *testing.T) {
+	restoreData(t)
+
+	builtIn := CurrentData()
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	files := DataFiles{
+		ConsumerDomains: writeDataFile(t, "consumer.txt", "# regional mailbox providers\nMail.Example.\n\nwebmail.example.net # added in 2026\n"),
+		Providers:       writeDataFile(t, "providers.yaml", "providers:\n  - name: Example Mail\n    mx: [mx.examplemail.net]\n    advice:\n      dkim: Enable DKIM in the Example Mail console.\n  - name: proofpoint\n    mx: [pphosted.com]\n"),
+		AdviceCatalog:   writeDataFile(t, "catalog.yaml", "catalog:\n  - phrase: Enable DKIM in the Example Mail console\n    severity: high\n    reference: https://examplemail.net/dkim\n    remediation: Enable DKIM in the Example Mail console.\n  - phrase: You do not have DMARC setup!\n    severity: low\n"),
+	}
+
+	summary, err := LoadData(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the built-in Proofpoint is replaced rather than listed twice
+	if summary.ConsumerDomains != builtIn.ConsumerDomains+2 || summary.Providers != builtIn.Providers+1 || summary.CatalogEntries != builtIn.CatalogEntries+1 {
+		t.Errorf("found %+v, want 2 more consumer domains, 1 more provider and 1 more catalog entry than %+v", summary, builtIn)
+	}
+
+	if summary.CatalogVersion == builtIn.CatalogVersion || CatalogVersion() != summary.CatalogVersion {
+		t.Errorf("found catalog version %s, want it to change from %s", CatalogVersion(), builtIn.CatalogVersion)
+	}
+
+	for _, domain := range []string{"mail.example", "webmail.example.net", "gmail.com"} {
+		if advice := advisor.CheckDomain(domain); len(advice) != 1 || !strings.HasPrefix(advice[0], consumerPhrase) {
+			t.Errorf("found %v for %s, want the consumer domain advice", advice, domain)
+		}
+	}
+
+	advice := advisor.CheckAll("example.com", "", "", "", []string{"mx.examplemail.net."}, "")
+	if len(advice.Providers) != 1 || advice.Providers[0] != "Example Mail" {
+		t.Errorf("found %v, want [Example Mail]", advice.Providers)
+	}
+
+	if len(advice.DKIM) != 1 || Classify(advice.DKIM[0]) != SeverityHigh {
+		t.Errorf("found %v, want the provider's DKIM advice at the catalog's severity", advice.DKIM)
+	}
+
+	if severity := Classify("You do not have DMARC setup!"); severity != SeverityLow {
+		t.Errorf("found %v, want the built-in rule replaced by the file's", severity)
+	}
+
+	findings := (&Advice{DKIM: advice.DKIM}).Findings()
+	if len(findings) != 1 || findings[0].Reference != "https://examplemail.net/dkim" {
+		t.Errorf("found %+v, want the file's reference", findings)
+	}
+
+	// a scan that's already running keeps the data it started with
+	pinned := advisor.Pinned()
+	if _, err = LoadData(DataFiles{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if advice := pinned.CheckDomain("mail.example"); !strings.HasPrefix(advice[0], consumerPhrase) {
+		t.Errorf("found %v, want the pinned data's consumer domain advice", advice)
+	}
+
+	if advice := advisor.CheckDomain("mail.example"); strings.HasPrefix(advice[0], consumerPhrase) {
+		t.Errorf("found %v, want the reloaded data without the consumer domain", advice)
+	}
+
+	// reloading without the files goes back to the built-in data
+	if summary := CurrentData(); summary != builtIn {
+		t.Errorf("found %+v, want %+v", summary, builtIn)
+	}
+}
+
+func TestLoadData_Invalid(t *testing.T) {
+	restoreData(t)
+
+	valid := DataFiles{ConsumerDomains: writeDataFile(t, "consumer.txt", "mail.example\n")}
+
+	loaded, err := LoadData(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		files    DataFiles
+		expected string
+	}{
+		{"MissingFile", DataFiles{Providers: filepath.Join(t.TempDir(), "missing.yaml")}, "failed to load the providers"},
+		{"ConsumerDomain", DataFiles{ConsumerDomains: writeDataFile(t, "consumer.txt", "webmail.example.net\nnot a domain\n")}, `line 2: "not a domain" isn't a domain`},
+		{"ProviderYAML", DataFiles{Providers: writeDataFile(t, "providers.yaml", "providers: [")}, "failed to load the providers"},
+		{"ProviderFingerprint", DataFiles{Providers: writeDataFile(t, "providers.yaml", "providers:\n  - name: Example Mail\n")}, "provider 1 needs a name and at least one fingerprint"},
+
+		// the valid files aren't loaded alongside an invalid one either
+		{"Partial", DataFiles{ConsumerDomains: writeDataFile(t, "consumer.txt", "webmail.example.net\n"), AdviceCatalog: writeDataFile(t, "catalog.yaml", "catalog: {")}, "failed to load the advice catalog"},
+		{"CatalogSeverity", DataFiles{AdviceCatalog: writeDataFile(t, "catalog.yaml", "catalog:\n  - phrase: Example\n    severity: urgent\n")}, `entry 1: invalid severity "urgent"`},
+		{"CatalogPhrase", DataFiles{AdviceCatalog: writeDataFile(t, "catalog.yaml", "catalog:\n  - severity: high\n")}, "entry 1 has no phrase"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := LoadData(test.files); err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("found %v, want an error containing %q", err, test.expected)
+			}
+
+			if current := CurrentData(); current != loaded {
+				t.Errorf("found %+v, want the data in use kept as %+v", current, loaded)
+			}
+		})
+	}
+}
+
+func TestLoadData_Concurrent(t *testing.T) {
+	restoreData(t)
+
+	// the domain is a consumer domain and the MX host a provider's in one data set, and neither in the other
+	withExample := DataFiles{
+		ConsumerDomains: writeDataFile(t, "consumer.txt", "mail.example\n"),
+		Providers:       writeDataFile(t, "providers.yaml", "providers:\n  - name: Example Mail\n    mx: [mx.examplemail.net]\n"),
+		AdviceCatalog:   writeDataFile(t, "catalog.yaml", "catalog:\n  - phrase: Example Mail\n    severity: high\n"),
+	}
+
+	advisor := NewAdvisor(time.Second, time.Second, false, WithDialer(panickingDialer{}), WithOffline(true))
+
+	var (
+		scans  sync.WaitGroup
+		errors = make(chan error, 8)
+	)
+
+	for range 8 {
+		scans.Add(1)
+		go func() {
+			defer scans.Done()
+
+			for range 50 {
+				// every check of a scan sees the same data, whichever was in use when it started
+				pinned := advisor.Pinned()
+				consumer := strings.HasPrefix(pinned.CheckDomain("mail.example")[0], consumerPhrase)
+				advice := pinned.CheckAll("example.com", "", "", "", []string{"mx.examplemail.net."}, "")
+
+				if provider := len(advice.Providers) == 1; provider != consumer {
+					errors <- fmt.Errorf("found consumer domain %t and providers %v in the same scan", consumer, advice.Providers)
+					return
+				}
+
+				_ = Classify("As you use Example Mail: publish a DKIM key.")
+				_ = CatalogVersion()
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		scans.Wait()
+		close(finished)
+	}()
+
+	// the data is reloaded, alternating between the data sets, until every scan is done
+	for index := 0; ; index++ {
+		select {
+		case <-finished:
+			close(errors)
+
+			for err := range errors {
+				t.Error(err)
+			}
+
+			return
+		default:
+		}
+
+		files := withExample
+		if index%2 == 1 {
+			files = DataFiles{}
+		}
+
+		if _, err := LoadData(files); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package advisor
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+const (
+	// ed25519KeySize is the size of an Ed25519 public key, in bytes (RFC 8463).
+	ed25519KeySize = 32
+
+	// maxTXTStringLength is the most characters a single string of a TXT
+	// record can hold (RFC 1035), so longer records are split across several.
+	maxTXTStringLength = 255
+
+	// dkimSkippedPhrase marks the DKIM advice of a domain whose keys weren't
+	// looked up, so it isn't mistaken for the domain having none.
+	dkimSkippedPhrase = "Your DKIM keys weren't checked"
+
+	// dkimFailedPhrase marks the DKIM advice of a domain whose keys couldn't
+	// be looked up.
+	dkimFailedPhrase = "Your DKIM keys couldn't be checked"
+)
+
+// DKIMKey is a DKIM key record published at a selector.
+type DKIMKey struct {
+	Selector string
+	Record   string
+
+	// Segments is the length of each string the record was split across, if
+	// it was split.
+	Segments []int
+}
+
+// DKIMSelectorCheck is whether a DKIM key was found at a selector that was
+// explicitly supplied.
+type DKIMSelectorCheck struct {
+	Selector string
+	Found    bool
+}
+
+// CheckDKIMSelectors returns advice on each of the selectors that were
+// explicitly supplied for the domain, since unlike the known selectors, a
+// supplied selector without a DKIM key means the domain's mail can't be
+// verified.
+func (a *Advisor) CheckDKIMSelectors(domain string, checks []DKIMSelectorCheck) []string {
+	var advice []string
+
+	for _, check := range checks {
+		name := check.Selector + "._domainkey." + domain
+
+		if check.Found {
+			advice = append(advice, fmt.Sprintf("The selector %s publishes a DKIM key at %s.", check.Selector, name))
+			continue
+		}
+
+		advice = append(advice, fmt.Sprintf("The selector %s has no TXT record at %s, so receivers can't verify mail signed with it. Check the selector is spelled the way your mail provider gives it, and publish its DKIM key there.", check.Selector, name))
+	}
+
+	return advice
+}
+
+// CheckDKIMSkipped returns the advice for a domain whose DKIM keys weren't
+// looked up, as selector discovery was disabled, replacing CheckDKIM's, as
+// whether the domain publishes any is unknown rather than that it doesn't.
+func (a *Advisor) CheckDKIMSkipped(domain string) []string {
+	return []string{dkimSkippedPhrase + ", as no selectors were looked up under _domainkey." + domain + ", so whether your domain publishes any is unknown. Scan with the selectors your sending services sign with to check them."}
+}
+
+// CheckDKIMLookupFailed returns the advice for a domain whose DKIM lookup
+// failed with err before a key was found, replacing CheckDKIM's. A lookup
+// answered with a failure rcode (such as SERVFAIL) is explained by it, as
+// CheckMissingRecord does, while any other failure (such as the resolver
+// timing out) is quoted, as it's unknown whether the domain publishes keys.
+func (a *Advisor) CheckDKIMLookupFailed(domain, rcode string, err error) []string {
+	switch rcode {
+	case "", "NOERROR", "NXDOMAIN":
+	default:
+		return a.CheckMissingRecord(lookalike.DKIM, domain, rcode, nil)
+	}
+
+	reason := "an unknown error"
+	if err != nil {
+		reason = err.Error()
+	}
+
+	return []string{fmt.Sprintf("%s, as looking up the selectors under _domainkey.%s failed (%s), so whether your domain publishes any is unknown. Scan again once the lookups succeed.", dkimFailedPhrase, domain, reason)}
+}
+
+// CheckDKIMKeys returns advice on the algorithms of the domain's DKIM keys:
+// whether it publishes both an RSA and an Ed25519 key (as RFC 8463 suggests,
+// since not every receiver supports Ed25519), and whether each Ed25519 key is
+// valid. Revoked keys (with an empty p= tag) are ignored.
+func (a *Advisor) CheckDKIMKeys(keys []DKIMKey) []string {
+	var advice, rsaSelectors, ed25519Selectors []string
+
+	for _, key := range keys {
+		// typos are already reported by CheckDKIM
+		publicKey, _ := dkimTag(key.Record, "p")
+		if publicKey == "" || typoAdvice(lookalike.DKIM, key.Record) != nil {
+			continue
+		}
+
+		algorithm, _ := dkimTag(key.Record, "k")
+
+		switch strings.ToLower(algorithm) {
+		case "", "rsa":
+			if !validRSAKey(publicKey) {
+				advice = append(advice, truncatedRSAKeyAdvice(key))
+				continue
+			}
+
+			rsaSelectors = append(rsaSelectors, key.Selector)
+		case "ed25519":
+			if !validEd25519Key(publicKey) {
+				advice = append(advice, invalidEd25519KeyAdvice(key.Selector))
+				continue
+			}
+
+			ed25519Selectors = append(ed25519Selectors, key.Selector)
+		}
+	}
+
+	switch {
+	case len(rsaSelectors) > 0 && len(ed25519Selectors) > 0:
+		advice = append(advice, fmt.Sprintf("Your domain publishes both an RSA DKIM key%s and an Ed25519 DKIM key%s, so receivers can verify your mail with either algorithm. No further action needed.", atSelectors(rsaSelectors...), atSelectors(ed25519Selectors...)))
+	case len(rsaSelectors) > 0:
+		advice = append(advice, "Your DKIM keys are all RSA keys. If your mail provider supports it, you could also sign with an Ed25519 key (RFC 8463) at another selector, which is smaller and faster to verify, while keeping the RSA key for receivers that don't support Ed25519 yet.")
+	case len(ed25519Selectors) > 0:
+		advice = append(advice, fmt.Sprintf("Your domain only publishes an Ed25519 DKIM key%s, which many receivers can't verify yet. Also sign your mail with an RSA key at another selector.", atSelectors(ed25519Selectors...)))
+	}
+
+	return advice
+}
+
+// lintDKIMKey returns advice if the DKIM key record is an Ed25519 key that
+// isn't valid, for linting records without the domain's other keys.
+func lintDKIMKey(record string) []string {
+	algorithm, _ := dkimTag(record, "k")
+	publicKey, _ := dkimTag(record, "p")
+
+	if !strings.EqualFold(algorithm, "ed25519") || publicKey == "" || validEd25519Key(publicKey) {
+		return nil
+	}
+
+	return []string{invalidEd25519KeyAdvice("")}
+}
+
+// invalidEd25519KeyAdvice returns the advice for an Ed25519 key at the
+// selector that doesn't decode to a public key.
+func invalidEd25519KeyAdvice(selector string) string {
+	return fmt.Sprintf("Your Ed25519 DKIM key%s is invalid, as its p= tag doesn't decode to a %d byte public key. Receivers can't verify mail signed with it, so republish the key.", atSelectors(selector), ed25519KeySize)
+}
+
+// truncatedRSAKeyAdvice returns the advice for an RSA key that doesn't decode
+// to a public key, which is usually as it was cut short when it was published,
+// explaining how long keys are split across strings.
+func truncatedRSAKeyAdvice(key DKIMKey) string {
+	var split string
+
+	switch {
+	case len(key.Segments) > 1:
+		lengths := make([]string, 0, len(key.Segments))
+		for _, length := range key.Segments {
+			lengths = append(lengths, strconv.Itoa(length))
+		}
+
+		split = fmt.Sprintf(" Its record is split across %d strings (of %s characters), so one of them may have been cut short or dropped.", len(key.Segments), strings.Join(lengths[:len(lengths)-1], ", ")+" and "+lengths[len(lengths)-1])
+	case len(key.Record) == maxTXTStringLength:
+		split = fmt.Sprintf(" Its record is a single string of %d characters, the most a string can hold, so it was likely cut off there.", maxTXTStringLength)
+	}
+
+	return fmt.Sprintf("Your RSA DKIM key%s appears to be truncated, as its p= tag doesn't decode to a complete public key.%s Keys of 2048 bits or more don't fit in a single TXT string of %d characters, so they must be published as several quoted strings in the same TXT record (such as \"v=DKIM1; k=rsa; p=MIIBIjANBg...\" \"...IDAQAB\"), which receivers join back together. Some DNS providers' interfaces cut long values off instead, so republish the full key from your mail provider, split into strings.", atSelectors(key.Selector), split, maxTXTStringLength)
+}
+
+// dkimTag returns the value of the named tag of a DKIM key record, and whether
+// the record has it.
+func dkimTag(record, name string) (string, bool) {
+	for _, tag := range strings.Split(record, ";") {
+		if tagName, value, ok := strings.Cut(strings.TrimSpace(tag), "="); ok && strings.TrimSpace(tagName) == name {
+			return strings.TrimSpace(value), true
+		}
+	}
+
+	return "", false
+}
+
+// validEd25519Key reports whether the base64 encoded public key (which may
+// contain whitespace) decodes to an Ed25519 public key.
+func validEd25519Key(publicKey string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(publicKey), ""))
+	return err == nil && len(decoded) == ed25519KeySize
+}
+
+// validRSAKey reports whether the base64 encoded public key (which may contain
+// whitespace, and may be unpadded) decodes to an RSA public key, either as a
+// SubjectPublicKeyInfo (as RFC 6376 specifies) or as a bare RSAPublicKey.
+func validRSAKey(publicKey string) bool {
+	publicKey = strings.Join(strings.Fields(publicKey), "")
+
+	decoded, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		if decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(publicKey, "=")); err != nil {
+			return false
+		}
+	}
+
+	if _, err = x509.ParsePKIXPublicKey(decoded); err == nil {
+		return true
+	}
+
+	_, err = x509.ParsePKCS1PublicKey(decoded)
+	return err == nil
+}
+
+// atSelectors describes where the keys of the selectors were found, such as
+// ` at selector "s1"`. Keys without a known selector aren't described.
+func atSelectors(selectors ...string) string {
+	var quoted []string
+
+	for _, selector := range selectors {
+		if selector != "" {
+			quoted = append(quoted, fmt.Sprintf("%q", selector))
+		}
+	}
+
+	switch len(quoted) {
+	case 0:
+		return ""
+	case 1:
+		return " at selector " + quoted[0]
+	}
+
+	return " at selectors " + strings.Join(quoted, ", ")
+}
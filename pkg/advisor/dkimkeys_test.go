@@ -0,0 +1,196 @@
+package advisor
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+const (
+	// ed25519Key is the example Ed25519 key from RFC 8463.
+	ed25519Key = "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+
+	// truncatedEd25519Key is missing the last bytes of its public key.
+	truncatedEd25519Key = "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMl"
+
+	// rsaKey is a 1024-bit RSA key, which fits in a single TXT string.
+	rsaKey = "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCzejkyqnWy4Jtzcn6SxXneBkusukmC2aPOW5UbpPRZjQzno1q0DD4EZVoI/opEouvTP2UenRG2Q20lWy2GR9m0RgdXZnYsg8Ih9PWyfEPvB15gxibcD0Tae8QSe1NB0OqAPQ6J03ofXlRgcvJIZM6Wxtj3n9Vv52Xev29HwsNzfQIDAQAB"
+
+	// rsa2048Key is a 2048-bit RSA key, which must be split across strings.
+	rsa2048Key = "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAz2dZ4OLRfoR87JxshejJjKqhwAoTaDmcFZ1XtSGV172aB/MAYy0SaR7l8GKW0sVs56g7LrPTV645a7bYcjDjtmMFRZEo3zRPSXoP8SYhviE8oU2H6cDPXBmSrrfwQZsTZOTG9DG+LccZCe/6eY4d/M9NOFxWjkfozGoE4ukT67r2OhWIo3e8bPCOLUnEPWtznpdxAPCTsKB+lgQptrOLTFjMDuB8WxFPZb+qPgVd86tLBD1L7VTFcQ8RxzFt5zR/Tcb2C3OfOXisoNt2GXVF0wcpjoc8sCOoEOvVLmtMKlGJNQ/wioy6j1qHsoAl1Yts0kCq3yPRRPlw9ndJ8Td/yQIDAQAB"
+)
+
+func TestAdvisor_CheckDKIMKeys(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	tests := []struct {
+		name       string
+		keys       []DKIMKey
+		prefixes   []string
+		severities []Severity
+	}{
+		{
+			name:       "DualAlgorithm",
+			keys:       []DKIMKey{{Selector: "rsa", Record: rsaKey}, {Selector: "ed", Record: ed25519Key}},
+			prefixes:   []string{`Your domain publishes both an RSA DKIM key at selector "rsa" and an Ed25519 DKIM key at selector "ed"`},
+			severities: []Severity{SeverityInfo},
+		},
+		{
+			name:       "RSAOnly",
+			keys:       []DKIMKey{{Selector: "s1", Record: rsaKey}, {Selector: "s2", Record: rsa2048Key, Segments: []int{255, len(rsa2048Key) - 255}}},
+			prefixes:   []string{"Your DKIM keys are all RSA keys."},
+			severities: []Severity{SeverityInfo},
+		},
+		{
+			name:       "Ed25519Only",
+			keys:       []DKIMKey{{Selector: "ed", Record: ed25519Key}},
+			prefixes:   []string{`Your domain only publishes an Ed25519 DKIM key at selector "ed"`},
+			severities: []Severity{SeverityLow},
+		},
+		{
+			name:       "TruncatedEd25519",
+			keys:       []DKIMKey{{Selector: "rsa", Record: rsaKey}, {Selector: "ed", Record: truncatedEd25519Key}},
+			prefixes:   []string{`Your Ed25519 DKIM key at selector "ed" is invalid`, "Your DKIM keys are all RSA keys."},
+			severities: []Severity{SeverityHigh, SeverityInfo},
+		},
+		{
+			// cut off at the end of its first string
+			name:       "TruncatedRSA",
+			keys:       []DKIMKey{{Selector: "s1", Record: rsa2048Key[:255]}, {Selector: "ed", Record: ed25519Key}},
+			prefixes:   []string{`Your RSA DKIM key at selector "s1" appears to be truncated`, `Your domain only publishes an Ed25519 DKIM key at selector "ed"`},
+			severities: []Severity{SeverityHigh, SeverityLow},
+		},
+		{
+			name:       "NotBase64RSA",
+			keys:       []DKIMKey{{Selector: "s1", Record: "v=DKIM1; k=rsa; p=not a key!"}},
+			prefixes:   []string{`Your RSA DKIM key at selector "s1" appears to be truncated`},
+			severities: []Severity{SeverityHigh},
+		},
+		{
+			name:       "NotBase64",
+			keys:       []DKIMKey{{Selector: "ed", Record: "v=DKIM1; k=ed25519; p=not a key!"}},
+			prefixes:   []string{`Your Ed25519 DKIM key at selector "ed" is invalid`},
+			severities: []Severity{SeverityHigh},
+		},
+		{
+			name: "Revoked",
+			keys: []DKIMKey{{Selector: "ed", Record: "v=DKIM1; k=ed25519; p="}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckDKIMKeys(test.keys)
+
+			if len(advice) != len(test.prefixes) {
+				t.Fatalf("found %v, want %d lines of advice", advice, len(test.prefixes))
+			}
+
+			for index, line := range advice {
+				if !strings.HasPrefix(line, test.prefixes[index]) {
+					t.Errorf("found %q, want advice starting with %q", line, test.prefixes[index])
+				}
+
+				if severity := Classify(line); severity != test.severities[index] {
+					t.Errorf("found %v for %q, want %v", severity, line, test.severities[index])
+				}
+			}
+		})
+	}
+}
+
+func TestTruncatedRSAKeyAdvice(t *testing.T) {
+	// a string of the key was dropped, which decodes, but not to a key
+	split := truncatedRSAKeyAdvice(DKIMKey{Selector: "s1", Record: rsa2048Key[:255] + rsa2048Key[len(rsa2048Key)-40:], Segments: []int{255, 40}})
+	if expected := "Its record is split across 2 strings (of 255 and 40 characters), so one of them may have been cut short or dropped."; !strings.Contains(split, expected) {
+		t.Errorf("found %q, want it to contain %q", split, expected)
+	}
+
+	single := truncatedRSAKeyAdvice(DKIMKey{Selector: "s1", Record: rsa2048Key[:255]})
+	if expected := "Its record is a single string of 255 characters, the most a string can hold, so it was likely cut off there."; !strings.Contains(single, expected) {
+		t.Errorf("found %q, want it to contain %q", single, expected)
+	}
+
+	if advice := truncatedRSAKeyAdvice(DKIMKey{Selector: "s1", Record: "v=DKIM1; p=KEY"}); strings.Contains(advice, "Its record is") {
+		t.Errorf("found %q, want no detail on how the record is split", advice)
+	}
+}
+
+func TestValidRSAKey(t *testing.T) {
+	key, _ := dkimTag(rsa2048Key, "p")
+
+	tests := []struct {
+		name      string
+		publicKey string
+		valid     bool
+	}{
+		{name: "Split", publicKey: key, valid: true},
+		{name: "Whitespace", publicKey: key[:100] + " \t" + key[100:], valid: true},
+		{name: "Truncated", publicKey: key[:len(key)-8], valid: false},
+		{name: "NotBase64", publicKey: "KEY", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := validRSAKey(test.publicKey); valid != test.valid {
+				t.Errorf("found %v, want %v", valid, test.valid)
+			}
+		})
+	}
+
+	if short, _ := dkimTag(rsaKey, "p"); !validRSAKey(short) {
+		t.Error("found a 1024-bit key in a single string invalid, want it valid")
+	}
+}
+
+func TestAdvisor_LintEd25519(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	if advice := advisor.Lint("", ed25519Key, "", nil, "").DKIM; len(advice) != 1 || Classify(advice[0]) != SeverityInfo {
+		t.Errorf("found %v, want the Ed25519 key to be accepted", advice)
+	}
+
+	if advice := advisor.Lint("", truncatedEd25519Key, "", nil, "").DKIM; len(advice) != 2 || !strings.HasPrefix(advice[1], "Your Ed25519 DKIM key is invalid") {
+		t.Errorf("found %v, want the truncated key to be invalid", advice)
+	}
+}
+
+func TestAdvisor_CheckDKIMSelectors(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	advice := advisor.CheckDKIMSelectors("example.com", []DKIMSelectorCheck{{Selector: "ed", Found: true}, {Selector: "mail2023", Found: false}})
+	if len(advice) != 2 {
+		t.Fatalf("found %v, want advice for each selector", advice)
+	}
+
+	if expected := "The selector ed publishes a DKIM key at ed._domainkey.example.com."; advice[0] != expected || Classify(advice[0]) != SeverityInfo {
+		t.Errorf("found %q, want %q", advice[0], expected)
+	}
+
+	if expected := "The selector mail2023 has no TXT record at mail2023._domainkey.example.com"; !strings.HasPrefix(advice[1], expected) || Classify(advice[1]) != SeverityMedium {
+		t.Errorf("found %q, want %q", advice[1], expected)
+	}
+}
+
+func TestAdvisor_CheckDKIMDiscovery(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	advice := advisor.CheckDKIMSkipped("example.com")
+	if expected := "Your DKIM keys weren't checked, as no selectors were looked up under _domainkey.example.com"; len(advice) != 1 || !strings.HasPrefix(advice[0], expected) || Classify(advice[0]) != SeverityInfo {
+		t.Errorf("found %v, want %q", advice, expected)
+	}
+
+	advice = advisor.CheckDKIMLookupFailed("example.com", "", errors.New("read udp 127.0.0.1:53: i/o timeout"))
+	if expected := "Your DKIM keys couldn't be checked, as looking up the selectors under _domainkey.example.com failed (read udp 127.0.0.1:53: i/o timeout)"; len(advice) != 1 || !strings.HasPrefix(advice[0], expected) || Classify(advice[0]) != SeverityLow {
+		t.Errorf("found %v, want %q", advice, expected)
+	}
+
+	// a failure rcode is explained as it is for any other missing record
+	if advice, expected := advisor.CheckDKIMLookupFailed("example.com", "SERVFAIL", errors.New("DNS query failed with rcode 2")), advisor.CheckMissingRecord(lookalike.DKIM, "example.com", "SERVFAIL", nil); !reflect.DeepEqual(advice, expected) {
+		t.Errorf("found %v, want %v", advice, expected)
+	}
+}
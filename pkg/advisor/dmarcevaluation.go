@@ -0,0 +1,219 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// DMARCPass, DMARCFail and DMARCNone are the results of evaluating a
+	// message against a DMARC policy. None means no DMARC policy applies.
+	DMARCPass = "pass"
+	DMARCFail = "fail"
+	DMARCNone = "none"
+
+	// AlignmentRelaxed and AlignmentStrict are the identifier alignment modes
+	// of the aspf and adkim tags (RFC 7489, section 3.1).
+	AlignmentRelaxed = "relaxed"
+	AlignmentStrict  = "strict"
+)
+
+type (
+	// DMARCMessage is what a receiver knows of a message when it evaluates
+	// DMARC: the domain of its From header, and the results of authenticating
+	// it with SPF and DKIM.
+	DMARCMessage struct {
+		// FromDomain is the domain of the message's RFC5322.From header, whose
+		// policy applies.
+		FromDomain string
+
+		// EnvelopeFrom is the domain SPF authenticated, which is the domain of
+		// the RFC5321.MailFrom (or, if that's empty, of the HELO).
+		EnvelopeFrom string
+
+		// SPFResult is the result of the SPF check (such as pass or softfail).
+		SPFResult string
+
+		// DKIMDomain is the d= domain of the message's DKIM signature.
+		DKIMDomain string
+
+		// DKIMResult is the result of verifying the signature (such as pass or
+		// fail).
+		DKIMResult string
+	}
+
+	// DMARCIdentifier is whether an authenticated identifier (the SPF or DKIM
+	// domain) passed, and whether it aligns with the From domain.
+	DMARCIdentifier struct {
+		Domain  string
+		Result  string
+		Mode    string
+		Aligned bool
+	}
+
+	// DMARCEvaluation is the outcome of evaluating a message against the From
+	// domain's DMARC policy.
+	DMARCEvaluation struct {
+		// Result is DMARCPass if either identifier passed and aligns,
+		// DMARCFail if neither did, or DMARCNone if no policy applies (such as
+		// if the record is missing or invalid).
+		Result string
+
+		SPF  DMARCIdentifier
+		DKIM DMARCIdentifier
+
+		// PolicyTag is the tag of the policy that applies, p or sp (for a
+		// subdomain covered by its organizational domain's record).
+		PolicyTag string
+
+		// Policy is the policy that applies, none, quarantine or reject.
+		Policy string
+
+		// Disposition is how receivers treat the message. Passing messages are
+		// always delivered, while failing ones get the policy's disposition.
+		Disposition DMARCDisposition
+	}
+)
+
+// OrganizationalDomain returns the organizational domain of a domain, the
+// registered domain below its public suffix (so mail.example.co.uk's is
+// example.co.uk), using the public suffix list. A domain that is itself a
+// public suffix is its own organizational domain.
+func OrganizationalDomain(domain string) string {
+	domain = normalizeDomain(domain)
+
+	organizational, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+
+	return organizational
+}
+
+// EvaluateDMARC evaluates a message against a DMARC record, as RFC 7489
+// describes, where policyDomain is the domain the record was published for:
+// either the message's From domain, or (if it doesn't have a record of its
+// own) its organizational domain, in which case the record's sp tag applies.
+// An empty record means there's no policy.
+//
+// The SPF and DKIM identifiers only align if they passed, and are compared
+// with the From domain exactly in strict mode, or by their organizational
+// domains in relaxed mode (the default). The message passes if either of them
+// aligns.
+func EvaluateDMARC(record, policyDomain string, message DMARCMessage) DMARCEvaluation {
+	dmarcRecord := parseDMARC(record)
+
+	evaluation := DMARCEvaluation{
+		Result:      DMARCNone,
+		SPF:         evaluateIdentifier(message.FromDomain, message.EnvelopeFrom, message.SPFResult, dmarcRecord, "aspf"),
+		DKIM:        evaluateIdentifier(message.FromDomain, message.DKIMDomain, message.DKIMResult, dmarcRecord, "adkim"),
+		Disposition: DMARCDisposition{Deliver: 100},
+	}
+
+	if dmarcRecord == nil {
+		return evaluation
+	}
+
+	evaluation.PolicyTag, evaluation.Policy = "p", strings.ToLower(dmarcRecord.Policy)
+	if normalizeDomain(policyDomain) != normalizeDomain(message.FromDomain) && dmarcRecord.SubdomainPolicy != "" {
+		evaluation.PolicyTag, evaluation.Policy = "sp", strings.ToLower(dmarcRecord.SubdomainPolicy)
+	}
+
+	switch evaluation.Policy {
+	case "none", "quarantine", "reject":
+	default:
+		// an invalid policy is treated as none if reports are requested, and
+		// otherwise means DMARC isn't applied at all (RFC 7489, section 6.6.3)
+		if len(dmarcRecord.AggregateReportDestination) == 0 {
+			evaluation.PolicyTag, evaluation.Policy = "", ""
+			return evaluation
+		}
+
+		evaluation.Policy = "none"
+	}
+
+	if evaluation.SPF.Aligned || evaluation.DKIM.Aligned {
+		evaluation.Result = DMARCPass
+		return evaluation
+	}
+
+	evaluation.Result = DMARCFail
+	evaluation.Disposition = EffectiveDMARCPolicy(evaluation.Policy, dmarcRecord.Percentage)
+
+	return evaluation
+}
+
+// String explains the evaluation, such as why a message failed DMARC and what
+// receivers do with it.
+func (e DMARCEvaluation) String() string {
+	switch e.Result {
+	case DMARCPass:
+		var aligned []string
+		for _, identifier := range []struct {
+			name string
+			DMARCIdentifier
+		}{{"SPF", e.SPF}, {"DKIM", e.DKIM}} {
+			if identifier.Aligned {
+				aligned = append(aligned, fmt.Sprintf("%s passed for %s, which aligns with the From domain (%s)", identifier.name, identifier.Domain, identifier.Mode))
+			}
+		}
+
+		return "The message passes DMARC, as " + strings.Join(aligned, ", and ") + ", so receivers deliver it as normal."
+	case DMARCFail:
+		return fmt.Sprintf("The message fails DMARC, as %s, and %s. Under %s=%s, receivers %s.", e.SPF.failure("SPF"), e.DKIM.failure("DKIM"), e.PolicyTag, e.Policy, e.Disposition)
+	}
+
+	return "No DMARC policy applies to the From domain, so receivers deliver the message as normal (subject to their own filtering)."
+}
+
+// failure describes why the identifier didn't align, such as "SPF passed for
+// mailer.example.net, which doesn't align with the From domain (relaxed)".
+func (i DMARCIdentifier) failure(name string) string {
+	switch {
+	case i.Domain == "":
+		return "there's no " + name + " domain"
+	case !strings.EqualFold(i.Result, "pass"):
+		result := i.Result
+		if result == "" {
+			result = "none"
+		}
+
+		return fmt.Sprintf("%s returned %s for %s", name, strings.ToLower(result), i.Domain)
+	}
+
+	return fmt.Sprintf("%s passed for %s, which doesn't align with the From domain (%s)", name, i.Domain, i.Mode)
+}
+
+// evaluateIdentifier returns whether the authenticated domain passed and
+// aligns with the From domain, under the mode of the record's alignment tag
+// (aspf or adkim).
+func evaluateIdentifier(fromDomain, domain, result string, record *dmarc, tag string) DMARCIdentifier {
+	identifier := DMARCIdentifier{Domain: normalizeDomain(domain), Result: strings.ToLower(result), Mode: AlignmentRelaxed}
+
+	if record != nil {
+		mode := record.ASPF
+		if tag == "adkim" {
+			mode = record.ADKIM
+		}
+
+		if strings.EqualFold(mode, "s") {
+			identifier.Mode = AlignmentStrict
+		}
+	}
+
+	if identifier.Domain == "" || identifier.Result != "pass" {
+		return identifier
+	}
+
+	from := normalizeDomain(fromDomain)
+
+	if identifier.Mode == AlignmentStrict {
+		identifier.Aligned = identifier.Domain == from
+	} else {
+		identifier.Aligned = OrganizationalDomain(identifier.Domain) == OrganizationalDomain(from)
+	}
+
+	return identifier
+}
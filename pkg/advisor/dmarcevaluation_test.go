@@ -0,0 +1,291 @@
+package advisor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrganizationalDomain(t *testing.T) {
+	tests := []struct {
+		domain   string
+		expected string
+	}{
+		{"example.com", "example.com"},
+		{"mail.example.com", "example.com"},
+		{"a.b.example.com.", "example.com"},
+		{"MAIL.Example.COM", "example.com"},
+		{"news.example.co.uk", "example.co.uk"},
+		{"example.co.uk", "example.co.uk"},
+		{"co.uk", "co.uk"},
+		{"bounce.example.test", "example.test"},
+		{"localhost", "localhost"},
+	}
+
+	for _, test := range tests {
+		if found := OrganizationalDomain(test.domain); found != test.expected {
+			t.Errorf("found %q for %q, want %q", found, test.domain, test.expected)
+		}
+	}
+}
+
+func TestEvaluateDMARC(t *testing.T) {
+	const reject = "v=DMARC1; p=reject; rua=mailto:dmarc@example.com"
+
+	pass := func(envelopeFrom, dkimDomain string) DMARCMessage {
+		return DMARCMessage{FromDomain: "example.com", EnvelopeFrom: envelopeFrom, SPFResult: "pass", DKIMDomain: dkimDomain, DKIMResult: "pass"}
+	}
+
+	tests := []struct {
+		name         string
+		record       string
+		policyDomain string
+		message      DMARCMessage
+		result       string
+		spfAligned   bool
+		dkimAligned  bool
+		policyTag    string
+		policy       string
+		disposition  DMARCDisposition
+	}{
+		{
+			name:    "BothAligned",
+			record:  reject,
+			message: pass("example.com", "example.com"),
+			result:  DMARCPass, spfAligned: true, dkimAligned: true,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:    "OnlySPFAligned",
+			record:  reject,
+			message: pass("example.com", "esp.example.net"),
+			result:  DMARCPass, spfAligned: true,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:    "OnlyDKIMAligned",
+			record:  reject,
+			message: pass("bounce.esp.example.net", "example.com"),
+			result:  DMARCPass, dkimAligned: true,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:      "NeitherAligned",
+			record:    reject,
+			message:   pass("bounce.esp.example.net", "esp.example.net"),
+			result:    DMARCFail,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Reject: 100},
+		},
+		{
+			name:    "RelaxedSubdomain",
+			record:  reject,
+			message: pass("bounce.example.com", "mail.example.com"),
+			result:  DMARCPass, spfAligned: true, dkimAligned: true,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:    "RelaxedCaseAndTrailingDot",
+			record:  reject,
+			message: pass("Bounce.EXAMPLE.com.", "MAIL.example.com."),
+			result:  DMARCPass, spfAligned: true, dkimAligned: true,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:    "StrictSPF",
+			record:  "v=DMARC1; p=reject; aspf=s",
+			message: pass("bounce.example.com", "mail.example.com"),
+			result:  DMARCPass, dkimAligned: true,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:    "StrictDKIM",
+			record:  "v=DMARC1; p=reject; adkim=s",
+			message: pass("bounce.example.com", "mail.example.com"),
+			result:  DMARCPass, spfAligned: true,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:      "StrictBoth",
+			record:    "v=DMARC1; p=quarantine; aspf=s; adkim=s",
+			message:   pass("bounce.example.com", "mail.example.com"),
+			result:    DMARCFail,
+			policyTag: "p", policy: "quarantine", disposition: DMARCDisposition{Quarantine: 100},
+		},
+		{
+			name:    "StrictExactMatch",
+			record:  "v=DMARC1; p=reject; aspf=s; adkim=s",
+			message: pass("example.com", "example.com"),
+			result:  DMARCPass, spfAligned: true, dkimAligned: true,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:      "PublicSuffixBoundary",
+			record:    reject,
+			message:   DMARCMessage{FromDomain: "example.co.uk", EnvelopeFrom: "other.co.uk", SPFResult: "pass", DKIMDomain: "co.uk", DKIMResult: "pass"},
+			result:    DMARCFail,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Reject: 100},
+		},
+		{
+			name:      "SPFSoftfail",
+			record:    reject,
+			message:   DMARCMessage{FromDomain: "example.com", EnvelopeFrom: "example.com", SPFResult: "softfail", DKIMDomain: "example.com", DKIMResult: "fail"},
+			result:    DMARCFail,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Reject: 100},
+		},
+		{
+			name:    "ResultCase",
+			record:  reject,
+			message: DMARCMessage{FromDomain: "example.com", EnvelopeFrom: "example.com", SPFResult: "PASS"},
+			result:  DMARCPass, spfAligned: true,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:      "NoIdentifiers",
+			record:    reject,
+			message:   DMARCMessage{FromDomain: "example.com"},
+			result:    DMARCFail,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Reject: 100},
+		},
+		{
+			name:      "Percentage",
+			record:    "v=DMARC1; p=reject; pct=25",
+			message:   pass("esp.example.net", ""),
+			result:    DMARCFail,
+			policyTag: "p", policy: "reject", disposition: DMARCDisposition{Reject: 25, Quarantine: 75},
+		},
+		{
+			name:      "PolicyNone",
+			record:    "v=DMARC1; p=none",
+			message:   pass("esp.example.net", ""),
+			result:    DMARCFail,
+			policyTag: "p", policy: "none", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:         "SubdomainPolicy",
+			record:       "v=DMARC1; p=reject; sp=quarantine",
+			policyDomain: "example.com",
+			message:      DMARCMessage{FromDomain: "news.example.com", EnvelopeFrom: "esp.example.net", SPFResult: "pass"},
+			result:       DMARCFail,
+			policyTag:    "sp", policy: "quarantine", disposition: DMARCDisposition{Quarantine: 100},
+		},
+		{
+			name:         "SubdomainWithoutSP",
+			record:       reject,
+			policyDomain: "example.com",
+			message:      DMARCMessage{FromDomain: "news.example.com", EnvelopeFrom: "esp.example.net", SPFResult: "pass"},
+			result:       DMARCFail,
+			policyTag:    "p", policy: "reject", disposition: DMARCDisposition{Reject: 100},
+		},
+		{
+			name:         "SubdomainAligned",
+			record:       "v=DMARC1; p=reject; sp=reject",
+			policyDomain: "example.com",
+			message:      DMARCMessage{FromDomain: "news.example.com", DKIMDomain: "example.com", DKIMResult: "pass"},
+			result:       DMARCPass, dkimAligned: true,
+			policyTag: "sp", policy: "reject", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:         "OwnRecordIgnoresSP",
+			record:       "v=DMARC1; p=reject; sp=none",
+			policyDomain: "news.example.com",
+			message:      DMARCMessage{FromDomain: "news.example.com", EnvelopeFrom: "esp.example.net", SPFResult: "pass"},
+			result:       DMARCFail,
+			policyTag:    "p", policy: "reject", disposition: DMARCDisposition{Reject: 100},
+		},
+		{
+			name:      "InvalidPolicyWithReports",
+			record:    "v=DMARC1; p=block; rua=mailto:dmarc@example.com",
+			message:   pass("esp.example.net", ""),
+			result:    DMARCFail,
+			policyTag: "p", policy: "none", disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:        "InvalidPolicy",
+			record:      "v=DMARC1; p=block",
+			message:     pass("esp.example.net", ""),
+			result:      DMARCNone,
+			disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:        "NoRecord",
+			message:     pass("esp.example.net", ""),
+			result:      DMARCNone,
+			disposition: DMARCDisposition{Deliver: 100},
+		},
+		{
+			name:        "MalformedRecord",
+			record:      "v=DMARC1 p=reject",
+			message:     pass("esp.example.net", ""),
+			result:      DMARCNone,
+			disposition: DMARCDisposition{Deliver: 100},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policyDomain := test.policyDomain
+			if policyDomain == "" {
+				policyDomain = test.message.FromDomain
+			}
+
+			evaluation := EvaluateDMARC(test.record, policyDomain, test.message)
+
+			if evaluation.Result != test.result {
+				t.Errorf("found result %q, want %q", evaluation.Result, test.result)
+			}
+
+			if evaluation.SPF.Aligned != test.spfAligned || evaluation.DKIM.Aligned != test.dkimAligned {
+				t.Errorf("found SPF aligned %v and DKIM aligned %v, want %v and %v", evaluation.SPF.Aligned, evaluation.DKIM.Aligned, test.spfAligned, test.dkimAligned)
+			}
+
+			if evaluation.PolicyTag != test.policyTag || evaluation.Policy != test.policy {
+				t.Errorf("found %s=%s, want %s=%s", evaluation.PolicyTag, evaluation.Policy, test.policyTag, test.policy)
+			}
+
+			if !reflect.DeepEqual(evaluation.Disposition, test.disposition) {
+				t.Errorf("found %v, want %v", evaluation.Disposition, test.disposition)
+			}
+		})
+	}
+}
+
+func TestDMARCEvaluation_String(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  DMARCMessage
+		record   string
+		expected string
+	}{
+		{
+			name:     "Pass",
+			record:   "v=DMARC1; p=reject",
+			message:  DMARCMessage{FromDomain: "example.com", EnvelopeFrom: "bounce.example.com", SPFResult: "pass", DKIMDomain: "example.com", DKIMResult: "pass"},
+			expected: "The message passes DMARC, as SPF passed for bounce.example.com, which aligns with the From domain (relaxed), and DKIM passed for example.com, which aligns with the From domain (relaxed), so receivers deliver it as normal.",
+		},
+		{
+			name:     "Fail",
+			record:   "v=DMARC1; p=reject; pct=10; adkim=s",
+			message:  DMARCMessage{FromDomain: "example.com", EnvelopeFrom: "esp.example.net", SPFResult: "softfail", DKIMDomain: "mail.example.com", DKIMResult: "pass"},
+			expected: "The message fails DMARC, as SPF returned softfail for esp.example.net, and DKIM passed for mail.example.com, which doesn't align with the From domain (strict). Under p=reject, receivers reject 10% of mail failing DMARC, and quarantine the other 90%.",
+		},
+		{
+			name:     "NoIdentifiers",
+			record:   "v=DMARC1; p=quarantine",
+			message:  DMARCMessage{FromDomain: "example.com", EnvelopeFrom: "example.com"},
+			expected: "The message fails DMARC, as SPF returned none for example.com, and there's no DKIM domain. Under p=quarantine, receivers quarantine all mail failing DMARC.",
+		},
+		{
+			name:     "None",
+			message:  DMARCMessage{FromDomain: "example.com"},
+			expected: "No DMARC policy applies to the From domain",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if found := EvaluateDMARC(test.record, test.message.FromDomain, test.message).String(); !strings.HasPrefix(found, test.expected) {
+				t.Errorf("found %q, want %q", found, test.expected)
+			}
+		})
+	}
+}
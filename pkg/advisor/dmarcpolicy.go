@@ -0,0 +1,88 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DMARCDisposition is how receivers treat mail that fails DMARC under a
+// policy, as the percentage of that mail rejected, quarantined and delivered
+// as normal. The percentages add up to 100.
+type DMARCDisposition struct {
+	Reject     int
+	Quarantine int
+	Deliver    int
+}
+
+// EffectiveDMARCPolicy returns how receivers treat mail failing DMARC under
+// the given policy (p or sp) and percentage (pct). Mail outside the
+// percentage is treated with the next weaker policy (RFC 7489, section 6.6.4),
+// so at p=reject; pct=10 only 10% of it is rejected, and the other 90% is
+// quarantined. A percentage outside 0 to 100 is clamped, and an unknown policy
+// is treated as none.
+func EffectiveDMARCPolicy(policy string, percentage int) DMARCDisposition {
+	percentage = min(max(percentage, 0), 100)
+
+	switch strings.ToLower(policy) {
+	case "reject":
+		return DMARCDisposition{Reject: percentage, Quarantine: 100 - percentage}
+	case "quarantine":
+		return DMARCDisposition{Quarantine: percentage, Deliver: 100 - percentage}
+	}
+
+	return DMARCDisposition{Deliver: 100}
+}
+
+// String describes the disposition, such as "reject 10% of mail failing DMARC,
+// and quarantine the other 90%".
+func (d DMARCDisposition) String() string {
+	type share struct {
+		action     string
+		percentage int
+	}
+
+	var shares []share
+
+	for _, candidate := range []share{{"reject", d.Reject}, {"quarantine", d.Quarantine}, {"deliver", d.Deliver}} {
+		if candidate.percentage > 0 {
+			shares = append(shares, candidate)
+		}
+	}
+
+	switch len(shares) {
+	case 0:
+		return "deliver all mail failing DMARC"
+	case 1:
+		return shares[0].action + " all mail failing DMARC"
+	}
+
+	// a policy only ever splits mail between two dispositions
+	return fmt.Sprintf("%s %d%% of mail failing DMARC, and %s the other %d%%", shares[0].action, shares[0].percentage, shares[1].action, shares[1].percentage)
+}
+
+// partialPolicyAdvice returns advice on the effective disposition of a DMARC
+// record whose pct is below 100, for the domain and (if it has its own policy)
+// its subdomains, or nil if every failing message gets the published policy.
+func partialPolicyAdvice(record *dmarc) []string {
+	if record.Percentage >= 100 {
+		return nil
+	}
+
+	var advice []string
+
+	describe := func(tag, policy, scope string) {
+		if policy != "quarantine" && policy != "reject" {
+			return
+		}
+
+		advice = append(advice, fmt.Sprintf("As your DMARC record has %s=%s with pct=%d, receivers of mail from %s %s. Raise pct to 100 (or remove it) once your reports show your legitimate mail passes, to complete the rollout.", tag, policy, record.Percentage, scope, EffectiveDMARCPolicy(policy, record.Percentage)))
+	}
+
+	describe("p", record.Policy, "your domain")
+
+	if record.SubdomainPolicy != "" && record.SubdomainPolicy != record.Policy {
+		describe("sp", record.SubdomainPolicy, "its subdomains")
+	}
+
+	return advice
+}
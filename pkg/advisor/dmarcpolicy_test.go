@@ -0,0 +1,118 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEffectiveDMARCPolicy(t *testing.T) {
+	tests := []struct {
+		policy     string
+		percentage int
+		expected   DMARCDisposition
+	}{
+		{"reject", 100, DMARCDisposition{Reject: 100}},
+		{"reject", 50, DMARCDisposition{Reject: 50, Quarantine: 50}},
+		{"reject", 10, DMARCDisposition{Reject: 10, Quarantine: 90}},
+		{"reject", 0, DMARCDisposition{Quarantine: 100}},
+		{"quarantine", 100, DMARCDisposition{Quarantine: 100}},
+		{"quarantine", 50, DMARCDisposition{Quarantine: 50, Deliver: 50}},
+		{"quarantine", 10, DMARCDisposition{Quarantine: 10, Deliver: 90}},
+		{"quarantine", 0, DMARCDisposition{Deliver: 100}},
+		{"none", 100, DMARCDisposition{Deliver: 100}},
+		{"none", 50, DMARCDisposition{Deliver: 100}},
+		{"none", 0, DMARCDisposition{Deliver: 100}},
+
+		// policies are case-insensitive, and unknown ones are treated as none
+		{"Reject", 25, DMARCDisposition{Reject: 25, Quarantine: 75}},
+		{"", 100, DMARCDisposition{Deliver: 100}},
+		{"block", 100, DMARCDisposition{Deliver: 100}},
+
+		// out of range percentages are clamped
+		{"reject", 101, DMARCDisposition{Reject: 100}},
+		{"quarantine", -1, DMARCDisposition{Deliver: 100}},
+	}
+
+	for _, test := range tests {
+		if disposition := EffectiveDMARCPolicy(test.policy, test.percentage); disposition != test.expected {
+			t.Errorf("p=%s; pct=%d: found %+v, want %+v", test.policy, test.percentage, disposition, test.expected)
+		}
+	}
+}
+
+func TestDMARCDisposition_String(t *testing.T) {
+	tests := []struct {
+		disposition DMARCDisposition
+		expected    string
+	}{
+		{DMARCDisposition{Reject: 10, Quarantine: 90}, "reject 10% of mail failing DMARC, and quarantine the other 90%"},
+		{DMARCDisposition{Quarantine: 25, Deliver: 75}, "quarantine 25% of mail failing DMARC, and deliver the other 75%"},
+		{DMARCDisposition{Quarantine: 100}, "quarantine all mail failing DMARC"},
+		{DMARCDisposition{}, "deliver all mail failing DMARC"},
+	}
+
+	for _, test := range tests {
+		if description := test.disposition.String(); description != test.expected {
+			t.Errorf("found %q, want %q", description, test.expected)
+		}
+	}
+}
+
+func TestAdvisor_CheckDMARCPartialPolicy(t *testing.T) {
+	advisor := NewAdvisor(0, 0, false)
+	defer advisor.Close()
+
+	tests := []struct {
+		name     string
+		record   string
+		expected []string
+	}{
+		{
+			name:     "Reject",
+			record:   "v=DMARC1; p=reject; pct=10; rua=mailto:reports@example.com",
+			expected: []string{"As your DMARC record has p=reject with pct=10, receivers of mail from your domain reject 10% of mail failing DMARC, and quarantine the other 90%. Raise pct to 100 (or remove it) once your reports show your legitimate mail passes, to complete the rollout."},
+		},
+		{
+			name:     "QuarantineZero",
+			record:   "v=DMARC1; p=quarantine; pct=0; rua=mailto:reports@example.com",
+			expected: []string{"As your DMARC record has p=quarantine with pct=0, receivers of mail from your domain deliver all mail failing DMARC. Raise pct to 100 (or remove it) once your reports show your legitimate mail passes, to complete the rollout."},
+		},
+		{
+			name:   "SubdomainPolicy",
+			record: "v=DMARC1; p=reject; sp=quarantine; pct=40; rua=mailto:reports@example.com",
+			expected: []string{
+				"As your DMARC record has p=reject with pct=40, receivers of mail from your domain reject 40% of mail failing DMARC, and quarantine the other 60%. Raise pct to 100 (or remove it) once your reports show your legitimate mail passes, to complete the rollout.",
+				"As your DMARC record has sp=quarantine with pct=40, receivers of mail from its subdomains quarantine 40% of mail failing DMARC, and deliver the other 60%. Raise pct to 100 (or remove it) once your reports show your legitimate mail passes, to complete the rollout.",
+			},
+		},
+		{name: "FullPercentage", record: "v=DMARC1; p=reject; pct=100; rua=mailto:reports@example.com"},
+		{name: "Monitoring", record: "v=DMARC1; p=none; pct=10; rua=mailto:reports@example.com"},
+		{name: "InvalidPercentage", record: "v=DMARC1; p=reject; pct=ten; rua=mailto:reports@example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var found []string
+
+			for _, advice := range advisor.CheckDMARC(test.record) {
+				if strings.Contains(advice, "to complete the rollout") {
+					found = append(found, advice)
+				}
+			}
+
+			if len(found) != len(test.expected) {
+				t.Fatalf("found %v, want %v", found, test.expected)
+			}
+
+			for i, advice := range found {
+				if advice != test.expected[i] {
+					t.Errorf("found %q, want %q", advice, test.expected[i])
+				}
+
+				if severity := Classify(advice); severity != SeverityLow {
+					t.Errorf("found %v, want %v", severity, SeverityLow)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// emailDomainProfile converts the domain of an email address to its ASCII
+// (punycode) form, lowercasing it and rejecting labels that aren't valid
+// hostname labels or are too long for DNS.
+var emailDomainProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+// emailAddress is a parsed email address.
+type emailAddress struct {
+	// local is the local part, unquoted.
+	local string
+
+	// domain is the domain in its Unicode form, and asciiDomain in its ASCII form, both lowercased.
+	domain      string
+	asciiDomain string
+}
+
+// WithStrictASCII flags DMARC report destinations that aren't ASCII addresses,
+// for domains whose reports are sent by receivers without internationalized
+// email (EAI, RFC 6531) support. Internationalized addresses are accepted by
+// default.
+func WithStrictASCII(strict bool) Option {
+	return func(a *Advisor) {
+		a.strictASCII = strict
+	}
+}
+
+// parseEmail parses an email address (RFC 5322, with the internationalized
+// addresses of RFC 6532), such as ruá@bücher.de or "john doe"@example.com.
+// Display names, comments and domain literals aren't accepted, and the domain
+// must be a valid (possibly internationalized) hostname with at least two
+// labels.
+func parseEmail(address string) (*emailAddress, error) {
+	if len(address) < 3 || len(address) > 254 {
+		return nil, errors.New("length must be between 3 and 254")
+	}
+
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed.Name != "" || strings.ContainsAny(address, "<>") {
+		return nil, errors.New("must be a bare address, without a display name or comment")
+	}
+
+	index := strings.LastIndexByte(parsed.Address, '@')
+	local, domain := parsed.Address[:index], parsed.Address[index+1:]
+
+	if len(local) > 64 {
+		return nil, errors.New("local part can't exceed 64 bytes")
+	}
+
+	if strings.HasPrefix(domain, "[") {
+		return nil, errors.New("domain literals aren't accepted")
+	}
+
+	asciiDomain, err := emailDomainProfile.ToASCII(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(asciiDomain, ".") {
+		return nil, errors.New("domain must have at least two labels")
+	}
+
+	unicodeDomain, err := emailDomainProfile.ToUnicode(asciiDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	return &emailAddress{local: local, domain: unicodeDomain, asciiDomain: asciiDomain}, nil
+}
+
+// String returns the address with its domain normalized to lowercase, quoting
+// the local part if it needs to be.
+func (e *emailAddress) String() string {
+	local := e.local
+
+	// local parts that aren't a dot-atom (such as john doe) must be quoted
+	if _, err := mail.ParseAddress(local + "@example.com"); err != nil {
+		local = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(local) + `"`
+	}
+
+	return local + "@" + e.domain
+}
+
+// validateEmail reports whether the email address is valid.
+func validateEmail(email string) bool {
+	_, err := parseEmail(email)
+	return err == nil
+}
+
+// reportMailbox returns the email address of a DMARC report destination
+// (RFC 7489, section 6.2), which is a mailto URI with an optional size limit,
+// such as mailto:reports@example.com!10m, and whether the destination is a
+// mailto URI at all. The scheme is case-insensitive, and the address is
+// percent-decoded.
+func reportMailbox(destination string) (string, bool) {
+	destination = strings.TrimSpace(destination)
+
+	scheme, address, ok := strings.Cut(destination, ":")
+	if !ok || !strings.EqualFold(scheme, "mailto") {
+		return "", false
+	}
+
+	// the size limit is a number, with an optional unit
+	if index := strings.LastIndexByte(address, '!'); index >= 0 && validReportSize(address[index+1:]) {
+		address = address[:index]
+	}
+
+	if unescaped, err := url.PathUnescape(address); err == nil {
+		address = unescaped
+	}
+
+	return address, true
+}
+
+// validReportSize reports whether the size limit of a report destination
+// (such as 10m) is valid.
+func validReportSize(size string) bool {
+	size = strings.TrimRight(strings.ToLower(size), "kmgt")
+	if size == "" {
+		return false
+	}
+
+	for _, char := range size {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkReportAddresses returns advice on the DMARC record's report
+// destinations that aren't ASCII addresses, in strict ASCII mode.
+func (a *Advisor) checkReportAddresses(record *dmarc) []string {
+	if !a.strictASCII {
+		return nil
+	}
+
+	var advice []string
+
+	for _, address := range reportAddresses(record) {
+		if isASCII(address.local) && isASCII(address.domain) {
+			continue
+		}
+
+		if isASCII(address.local) {
+			advice = append(advice, fmt.Sprintf("Your DMARC report destination %s has an internationalized domain, which receivers without internationalized email (EAI) support can't send reports to. Use its ASCII form, %s@%s, instead.", address, address.local, address.asciiDomain))
+			continue
+		}
+
+		advice = append(advice, fmt.Sprintf("Your DMARC report destination %s isn't an ASCII address, which receivers without internationalized email (EAI) support can't send reports to. Use an ASCII address instead.", address))
+	}
+
+	return advice
+}
+
+// CheckReportDestinations returns advice on the domains of the DMARC record's
+// report destinations that can't receive mail, as they have no MX or address
+// records (or publish a null MX record). Domains whose lookups fail for any
+// other reason are given the benefit of the doubt.
+func (a *Advisor) CheckReportDestinations(ctx context.Context, dmarc string) []string {
+	record := parseDMARC(dmarc)
+	if record == nil {
+		return nil
+	}
+
+	addresses := reportAddresses(record)
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	if a.isOffline(ctx) {
+		return []string{skippedOffline("The check that your DMARC report destinations accept mail")}
+	}
+
+	var advice []string
+	checked := make(map[string]struct{})
+
+	for _, address := range addresses {
+		if _, ok := checked[address.asciiDomain]; ok {
+			continue
+		}
+		checked[address.asciiDomain] = struct{}{}
+
+		if reason := a.undeliverable(ctx, address.asciiDomain); reason != "" {
+			advice = append(advice, fmt.Sprintf("Your DMARC report destination %s can't receive reports, as %s %s. Use an address at a domain that accepts mail.", address, address.domain, reason))
+		}
+	}
+
+	return advice
+}
+
+// undeliverable returns why mail to the domain can't be delivered, or an empty
+// string if it can be (or that can't be determined).
+func (a *Advisor) undeliverable(ctx context.Context, domain string) string {
+	if cached := a.mailDomainCache.Get(domain); cached != nil {
+		a.mailDomainCache.Tag(domain, cacheTags(ctx)...)
+		return *cached
+	}
+
+	reason, ok := a.lookupUndeliverable(ctx, domain)
+	if ok {
+		a.mailDomainCache.SetTagged(domain, &reason, cacheTags(ctx, domain)...)
+	}
+
+	return reason
+}
+
+// lookupUndeliverable looks up why mail to the domain can't be delivered,
+// and whether the lookups were conclusive. A domain without MX records can
+// still receive mail at its address records (RFC 5321, section 5.1).
+func (a *Advisor) lookupUndeliverable(ctx context.Context, domain string) (string, bool) {
+	records, err := a.lookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return "", false
+	}
+
+	if len(records) > 0 {
+		for _, record := range records {
+			if _, ok := normalizeHostname(record.Host); ok {
+				return "", true
+			}
+		}
+
+		return "publishes a null MX record, so it doesn't accept mail", true
+	}
+
+	addresses, err := a.lookupHost(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return "", false
+	}
+
+	if len(addresses) > 0 {
+		return "", true
+	}
+
+	return "has no MX or address records", true
+}
+
+// reportAddresses returns the valid email addresses of the DMARC record's
+// aggregate and forensic report destinations.
+func reportAddresses(record *dmarc) []*emailAddress {
+	var addresses []*emailAddress
+
+	for _, destination := range append(append([]string{}, record.AggregateReportDestination...), record.ForensicReportDestination...) {
+		mailbox, ok := reportMailbox(destination)
+		if !ok {
+			continue
+		}
+
+		if address, err := parseEmail(mailbox); err == nil {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// isNotFound reports whether the lookup error means the name has no records.
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// isASCII reports whether the string only contains ASCII characters.
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,221 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEmail(t *testing.T) {
+	valid := []struct {
+		address    string
+		normalized string
+		ascii      string
+	}{
+		{"reports@example.com", "reports@example.com", "example.com"},
+		{"first.last+dmarc@mail.example.co.uk", "first.last+dmarc@mail.example.co.uk", "mail.example.co.uk"},
+		{"o'brien@example.com", "o'brien@example.com", "example.com"},
+		{"DMARC@EXAMPLE.COM", "DMARC@example.com", "example.com"},
+		{"ruá@example.com", "ruá@example.com", "example.com"},
+		{"dmarc@bücher.de", "dmarc@bücher.de", "xn--bcher-kva.de"},
+		{"dmarc@xn--bcher-kva.de", "dmarc@bücher.de", "xn--bcher-kva.de"},
+		{"dmarc@BÜCHER.de", "dmarc@bücher.de", "xn--bcher-kva.de"},
+		{"отчёты@пример.рф", "отчёты@пример.рф", "xn--e1afmkfd.xn--p1ai"},
+		{`"john doe"@example.com`, `"john doe"@example.com`, "example.com"},
+		{`"john\"doe"@example.com`, `"john\"doe"@example.com`, "example.com"},
+		{"a@b.co", "a@b.co", "b.co"},
+	}
+
+	for _, test := range valid {
+		address, err := parseEmail(test.address)
+		if err != nil {
+			t.Errorf("%s: found %v, want it to be valid", test.address, err)
+			continue
+		}
+
+		if address.String() != test.normalized || address.asciiDomain != test.ascii {
+			t.Errorf("%s: found %s at %s, want %s at %s", test.address, address, address.asciiDomain, test.normalized, test.ascii)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"reports",
+		"reports@",
+		"@example.com",
+		"a@@example.com",
+		".reports@example.com",
+		"reports.@example.com",
+		"re..ports@example.com",
+		"reports@example..com",
+		"reports@localhost",
+		"reports@-example.com",
+		"reports@example_dmarc.com",
+		"reports@[192.0.2.1]",
+		"reports@example.com.",
+		"Reports <reports@example.com>",
+		"<reports@example.com>",
+		"reports@example.com (comment)",
+		"two words@example.com",
+		strings.Repeat("a", 65) + "@example.com",
+		"reports@" + strings.Repeat("a", 64) + ".com",
+		"reports@" + strings.Repeat("a.", 124) + "com",
+	}
+
+	for _, address := range invalid {
+		if parsed, err := parseEmail(address); err == nil {
+			t.Errorf("%q: found %s, want it to be invalid", address, parsed)
+		}
+	}
+}
+
+func TestReportMailbox(t *testing.T) {
+	tests := []struct {
+		destination string
+		expected    string
+		ok          bool
+	}{
+		{"mailto:reports@example.com", "reports@example.com", true},
+		{" MAILTO:Reports@Example.com", "Reports@Example.com", true},
+		{"mailto:reports@example.com!10m", "reports@example.com", true},
+		{"mailto:reports@example.com!25", "reports@example.com", true},
+		{"mailto:r%C3%BAa@example.com", "rúa@example.com", true},
+		{"mailto:reports!dmarc@example.com", "reports!dmarc@example.com", true},
+		{"https://example.com/reports", "", false},
+		{"reports@example.com", "", false},
+	}
+
+	for _, test := range tests {
+		if mailbox, ok := reportMailbox(test.destination); mailbox != test.expected || ok != test.ok {
+			t.Errorf("%q: found %q and %v, want %q and %v", test.destination, mailbox, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestAdvisor_CheckDMARCReportAddresses(t *testing.T) {
+	record := "v=DMARC1; p=reject; rua=mailto:ruá@example.com,mailto:dmarc@bücher.de,mailto:reports@example.com!10m; ruf=mailto:FORENSIC@EXAMPLE.COM; fo=1"
+
+	t.Run("Default", func(t *testing.T) {
+		advisor := NewAdvisor(time.Second, time.Second, false)
+		defer advisor.Close()
+
+		// internationalized and uppercase addresses, and size limits, are valid
+		for _, advice := range advisor.CheckDMARC(record) {
+			if strings.Contains(advice, "report destination") {
+				t.Errorf("found %q, want no report destination advice", advice)
+			}
+		}
+	})
+
+	t.Run("StrictASCII", func(t *testing.T) {
+		advisor := NewAdvisor(time.Second, time.Second, false, WithStrictASCII(true))
+		defer advisor.Close()
+
+		var found []string
+		for _, advice := range advisor.CheckDMARC(record) {
+			if strings.Contains(advice, "report destination") {
+				found = append(found, advice)
+			}
+		}
+
+		expected := []string{
+			"Your DMARC report destination ruá@example.com isn't an ASCII address, which receivers without internationalized email (EAI) support can't send reports to. Use an ASCII address instead.",
+			"Your DMARC report destination dmarc@bücher.de has an internationalized domain, which receivers without internationalized email (EAI) support can't send reports to. Use its ASCII form, dmarc@xn--bcher-kva.de, instead.",
+		}
+
+		if !reflect.DeepEqual(found, expected) {
+			t.Fatalf("found %v, want %v", found, expected)
+		}
+
+		for _, advice := range found {
+			if severity := Classify(advice); severity != SeverityLow {
+				t.Errorf("found %v, want %v", severity, SeverityLow)
+			}
+		}
+	})
+}
+
+func TestAdvisor_CheckReportDestinations(t *testing.T) {
+	notFound := &net.DNSError{Err: "no such host", IsNotFound: true}
+
+	mx := map[string][]*net.MX{
+		"example.com":      {{Host: "mx.example.com.", Pref: 10}},
+		"null.example":     {{Host: ".", Pref: 0}},
+		"xn--bcher-kva.de": {{Host: "mx.xn--bcher-kva.de.", Pref: 10}},
+	}
+	hosts := map[string][]string{
+		"a-only.example": {"192.0.2.1"},
+	}
+
+	var lookups int
+
+	advisor := NewAdvisor(time.Second, time.Minute, false)
+	defer advisor.Close()
+
+	advisor.lookupMX = func(_ context.Context, name string) ([]*net.MX, error) {
+		lookups++
+
+		if name == "broken.example" {
+			return nil, errors.New("i/o timeout")
+		}
+
+		if records, ok := mx[name]; ok {
+			return records, nil
+		}
+
+		return nil, notFound
+	}
+	advisor.lookupHost = func(_ context.Context, host string) ([]string, error) {
+		if addresses, ok := hosts[host]; ok {
+			return addresses, nil
+		}
+
+		return nil, notFound
+	}
+
+	record := "v=DMARC1; p=reject; rua=mailto:reports@example.com,mailto:dmarc@bücher.de,mailto:reports@a-only.example,mailto:reports@null.example,mailto:reports@missing.example,mailto:reports@broken.example; ruf=mailto:forensic@missing.example"
+
+	expected := []string{
+		"Your DMARC report destination reports@null.example can't receive reports, as null.example publishes a null MX record, so it doesn't accept mail. Use an address at a domain that accepts mail.",
+		"Your DMARC report destination reports@missing.example can't receive reports, as missing.example has no MX or address records. Use an address at a domain that accepts mail.",
+	}
+
+	advice := advisor.CheckReportDestinations(context.Background(), record)
+	if !reflect.DeepEqual(advice, expected) {
+		t.Fatalf("found %v, want %v", advice, expected)
+	}
+
+	for _, line := range advice {
+		if severity := Classify(line); severity != SeverityMedium {
+			t.Errorf("found %v, want %v", severity, SeverityMedium)
+		}
+	}
+
+	// each domain is only looked up once, and conclusive lookups are cached
+	if lookups != 6 {
+		t.Errorf("found %d lookups, want 6", lookups)
+	}
+
+	advisor.CheckReportDestinations(context.Background(), record)
+	if lookups != 7 {
+		t.Errorf("found %d lookups, want only the failed lookup to be retried", lookups)
+	}
+
+	if advice := advisor.CheckReportDestinations(context.Background(), "v=DMARC1; p=none"); advice != nil {
+		t.Errorf("found %v, want no advice without report destinations", advice)
+	}
+
+	t.Run("Offline", func(t *testing.T) {
+		advisor := NewAdvisor(time.Second, time.Minute, false, WithOffline(true))
+		defer advisor.Close()
+
+		advice := advisor.CheckReportDestinations(context.Background(), record)
+		if len(advice) != 1 || Classify(advice[0]) != SeverityInfo {
+			t.Errorf("found %v, want the check to be skipped", advice)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// The kinds of failure on the scanner's side that keep a lookup or check from
+// completing (see ErrorKind).
+const (
+	// ErrorKindResolver is a resolver that failed to answer, or answered
+	// with an error.
+	ErrorKindResolver = "resolver"
+
+	// ErrorKindEgress is an outbound connection that the scanner's network
+	// blocked, or a proxy that couldn't be reached.
+	ErrorKindEgress = "egress"
+
+	// ErrorKindTimeout is a check that didn't finish before its timeout, or
+	// ran out of its slice of the time budget.
+	ErrorKindTimeout = "timeout"
+
+	// ErrorKindCanceled is a scan that was cancelled, such as by the client
+	// that requested it disconnecting.
+	ErrorKindCanceled = "canceled"
+
+	// ErrorKindUnknown is any other failure.
+	ErrorKindUnknown = "unknown"
+)
+
+// incompletePhrase marks the advice standing in for a check's error in
+// outputs from before errors were reported separately (see IncompleteAdvice).
+const incompletePhrase = "couldn't be completed on the scanner's side"
+
+// ErrorKind returns the kind of failure (one of the ErrorKind constants) of a
+// lookup's or check's error.
+func ErrorKind(err error) string {
+	var (
+		proxyErr *ProxyError
+		dnsErr   *net.DNSError
+	)
+
+	switch {
+	case errors.As(err, &proxyErr):
+		return ErrorKindEgress
+	case errors.As(err, &dnsErr):
+		return ErrorKindResolver
+	case errors.Is(err, context.Canceled):
+		return ErrorKindCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrTimeBudgetExceeded), isTimeout(err):
+		return ErrorKindTimeout
+	case errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+		return ErrorKindEgress
+	}
+
+	return ErrorKindUnknown
+}
+
+// IncompleteAdvice returns the advice line that stands in for a check's error
+// of the given kind, for outputs from before errors were reported separately.
+// It doesn't include the error's own text.
+func IncompleteAdvice(kind string) string {
+	reason := "it failed unexpectedly"
+
+	switch kind {
+	case ErrorKindResolver:
+		reason = "the scanner's resolver didn't answer"
+	case ErrorKindEgress:
+		reason = "the scanner's outbound connection was blocked"
+	case ErrorKindTimeout:
+		reason = "it timed out"
+	case ErrorKindCanceled:
+		reason = "the scan was cancelled"
+	}
+
+	return "The check " + incompletePhrase + ", as " + reason + ", so its advice is missing or partial."
+}
+
+// isInfrastructureError reports whether the error is a failure on the
+// scanner's side rather than of the host being checked: the check's context
+// being done, a proxy that couldn't be reached, a resolver that didn't answer
+// in time, or outbound connections being blocked locally. Checks return these
+// as their error rather than as advice, as they say nothing about the domain.
+func isInfrastructureError(ctx context.Context, err error) bool {
+	var (
+		proxyErr *ProxyError
+		dnsErr   *net.DNSError
+	)
+
+	switch {
+	case err == nil:
+		return false
+	case ctx.Err() != nil, errors.Is(err, context.Canceled):
+		return true
+	case errors.As(err, &proxyErr):
+		return true
+	case errors.As(err, &dnsErr):
+		// a name that doesn't resolve is the host's problem, while a resolver
+		// that doesn't answer is the scanner's
+		return dnsErr.IsTimeout
+	case errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+		return true
+	}
+
+	return false
+}
+
+// abandonedError is the error of a check that hadn't finished once the
+// context was done, wrapping the context's cause.
+func abandonedError(ctx context.Context, elapsed string) error {
+	return fmt.Errorf("check abandoned after %s: %w", elapsed, context.Cause(ctx))
+}
@@ -0,0 +1,105 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind string
+	}{
+		{"Proxy", &ProxyError{Proxy: "proxy.internal:1080", Err: &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}}, ErrorKindEgress},
+		{"Resolver", &net.DNSError{Err: "i/o timeout", Name: "mx.example.com", IsTimeout: true}, ErrorKindResolver},
+		{"Canceled", fmt.Errorf("check abandoned after 2s: %w", context.Canceled), ErrorKindCanceled},
+		{"Deadline", fmt.Errorf("check abandoned after 5s: %w", context.DeadlineExceeded), ErrorKindTimeout},
+		{"DialTimeout", &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, ErrorKindTimeout},
+		{"NetworkUnreachable", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}, ErrorKindEgress},
+		{"Blocked", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EPERM)}, ErrorKindEgress},
+		{"Unknown", errors.New("something else"), ErrorKindUnknown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if kind := ErrorKind(test.err); kind != test.kind {
+				t.Errorf("found %v, want %v", kind, test.kind)
+			}
+		})
+	}
+}
+
+func TestIsInfrastructureError(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		expected bool
+	}{
+		{"Nil", context.Background(), nil, false},
+		{"ContextDone", canceled, errors.New("use of closed network connection"), true},
+		{"Proxy", context.Background(), &ProxyError{Proxy: "proxy.internal:1080", Err: errors.New("connection refused")}, true},
+		{"ResolverTimeout", context.Background(), &net.DNSError{Err: "i/o timeout", Name: "mx.example.com", IsTimeout: true}, true},
+		{"NotFound", context.Background(), &net.DNSError{Err: "no such host", Name: "mx.example.com", IsNotFound: true}, false},
+		{"Blocked", context.Background(), &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EACCES)}, true},
+		{"Refused", context.Background(), &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, false},
+		{"DialTimeout", context.Background(), &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if found := isInfrastructureError(test.ctx, test.err); found != test.expected {
+				t.Errorf("found %v, want %v", found, test.expected)
+			}
+		})
+	}
+}
+
+func TestIncompleteAdvice(t *testing.T) {
+	for _, kind := range []string{ErrorKindResolver, ErrorKindEgress, ErrorKindTimeout, ErrorKindCanceled, ErrorKindUnknown} {
+		advice := IncompleteAdvice(kind)
+
+		if severity := Classify(advice); severity != SeverityLow {
+			t.Errorf("found %v for %q, want %v", severity, advice, SeverityLow)
+		}
+	}
+
+	want := "The check couldn't be completed on the scanner's side, as it timed out, so its advice is missing or partial."
+	if advice := IncompleteAdvice(ErrorKindTimeout); advice != want {
+		t.Errorf("found %q, want %q", advice, want)
+	}
+}
+
+func TestHostFailureAdvice(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, "Failed to reach domain on port 443, as it refused the connection."},
+		{"Timeout", &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, "Failed to reach domain on port 443, as it didn't connect or complete a TLS handshake before timeout."},
+		{"Handshake", errors.New("remote error: tls: handshake failure"), "Failed to reach domain on port 443, as the TLS handshake with it failed."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := hostFailureAdvice(test.err, 443)
+			if advice != test.expected {
+				t.Errorf("found %q, want %q", advice, test.expected)
+			}
+
+			if severity := Classify(advice); severity != SeverityMedium {
+				t.Errorf("found %v, want %v", severity, SeverityMedium)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package advisor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// heloPhrase is shared by the advice on the hostname a mail server
+	// introduces itself with, which is the name receivers see in its HELO/EHLO
+	// when it sends mail.
+	heloPhrase = "so receivers may distrust the mail it sends"
+
+	// maxTranscriptSize caps how much of an SMTP conversation is recorded,
+	// which is only read for the greeting and EHLO reply.
+	maxTranscriptSize = 4096
+)
+
+// localSuffixes are the suffixes of names that only mean something on the
+// server's own network.
+var localSuffixes = []string{".localhost", ".localdomain", ".local", ".internal", ".lan", ".home.arpa"}
+
+// transcriptConn records the first maxTranscriptSize bytes read from the
+// connection, so the server's greeting and EHLO reply can be read back after
+// the SMTP client is done with them.
+type transcriptConn struct {
+	net.Conn
+	peer       net.Addr
+	transcript []byte
+}
+
+func newTranscriptConn(conn net.Conn) *transcriptConn {
+	return &transcriptConn{Conn: conn, peer: conn.RemoteAddr()}
+}
+
+func (c *transcriptConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if remaining := maxTranscriptSize - len(c.transcript); remaining > 0 && n > 0 {
+		c.transcript = append(c.transcript, p[:min(n, remaining)]...)
+	}
+
+	return n, err
+}
+
+// presentedHostname returns the hostname the server introduced itself with,
+// preferring its EHLO (or HELO) reply over its greeting. It returns an empty
+// string if the server didn't greet the client.
+func presentedHostname(transcript []byte) string {
+	var greeting string
+
+	scanner := bufio.NewScanner(bytes.NewReader(transcript))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 4 {
+			continue
+		}
+
+		code, text := line[:3], line[4:]
+
+		switch {
+		case greeting == "" && code == "220":
+			if greeting = firstField(text); greeting == "" {
+				return ""
+			}
+		case greeting == "":
+			// the server turned the client away, rather than greeting it
+			return ""
+		case code == "250":
+			if name := firstField(text); name != "" {
+				return name
+			}
+
+			return greeting
+		}
+	}
+
+	return greeting
+}
+
+func firstField(text string) string {
+	if fields := strings.Fields(text); len(fields) > 0 {
+		return fields[0]
+	}
+
+	return ""
+}
+
+// checkPresentedHostname returns advice on the hostname the mail server
+// introduced itself with, as it presents the same name in the HELO/EHLO of
+// the mail it sends: a bare IP address or local name, a name that doesn't
+// resolve, or one that resolves elsewhere than the address the server was
+// reached at. The address isn't cross-checked for proxied or overridden
+// probes, as the server wasn't reached at its published address. If the
+// advisor is detailed, the name is described even if it's fine.
+func (a *Advisor) checkPresentedHostname(ctx context.Context, hostname string, conn *transcriptConn) []string {
+	presented := strings.ToLower(strings.TrimSuffix(presentedHostname(conn.transcript), "."))
+	if presented == "" {
+		return nil
+	}
+
+	var advice []string
+	if a.detailed {
+		advice = append(advice, fmt.Sprintf("Your mail server introduces itself as %s.", presented))
+	}
+
+	literal := strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(presented, "["), "]"), "ipv6:")
+	if net.ParseIP(literal) != nil {
+		return append(advice, fmt.Sprintf("Your mail server introduces itself as %s, a bare IP address rather than a hostname, %s.", presented, heloPhrase))
+	}
+
+	if isLocalHostname(presented) {
+		return append(advice, fmt.Sprintf("Your mail server introduces itself as %s, which isn't a public hostname, %s.", presented, heloPhrase))
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	addresses, err := a.probes.lookup(lookupCtx, presented, a.lookupHost)
+	if err != nil {
+		// only a name that doesn't exist is a finding, other failures may be the scanner's
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			advice = append(advice, fmt.Sprintf("Your mail server introduces itself as %s, which doesn't resolve, %s.", presented, heloPhrase))
+		}
+
+		return advice
+	}
+
+	peer, ok := conn.peer.(*net.TCPAddr)
+	if !ok || a.proxy.AllProxy != "" {
+		return advice
+	}
+
+	if _, overridden := a.resolveOverride(ctx, hostname, "25"); overridden {
+		return advice
+	}
+
+	for _, address := range addresses {
+		if peer.IP.Equal(net.ParseIP(address)) {
+			return advice
+		}
+	}
+
+	return append(advice, fmt.Sprintf("Your mail server introduces itself as %s, which resolves to %s rather than the address it was reached at (%s), %s.", presented, strings.Join(addresses, ", "), peer.IP, heloPhrase))
+}
+
+// isLocalHostname returns true if the name is localhost, a single label, or
+// under a suffix that's only meaningful on a private network.
+func isLocalHostname(name string) bool {
+	if name == "localhost" || !strings.Contains(name, ".") {
+		return true
+	}
+
+	for _, suffix := range localSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,123 @@
+package advisor
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+)
+
+func TestPresentedHostname(t *testing.T) {
+	tests := []struct {
+		name       string
+		transcript string
+		expected   string
+	}{
+		{"EHLO", "220 mx.example.com ESMTP\r\n250-relay.example.com\r\n250 STARTTLS\r\n", "relay.example.com"},
+		{"MultilineGreeting", "220-mx.example.com ESMTP\r\n220 Welcome\r\n250-relay.example.com Hello\r\n250 STARTTLS\r\n", "relay.example.com"},
+		{"HELO", "220 mx.example.com ESMTP\r\n502 5.5.1 Command not implemented\r\n250 relay.example.com\r\n", "relay.example.com"},
+		{"GreetingOnly", "220 mx.example.com ESMTP\r\n", "mx.example.com"},
+		{"TurnedAway", "554 5.7.1 No service\r\n", ""},
+		{"Empty", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if hostname := presentedHostname([]byte(test.transcript)); hostname != test.expected {
+				t.Errorf("found %v, want %v", hostname, test.expected)
+			}
+		})
+	}
+}
+
+func TestAdvisor_CheckPresentedHostname(t *testing.T) {
+	tls13 := checkTLSVersion(tls.VersionTLS13)
+
+	tests := []struct {
+		name     string
+		hostname string
+		hosts    map[string]string
+		expected []string
+	}{
+		{
+			name:     "Matching",
+			expected: []string{tls13},
+		},
+		{
+			name:     "BareIP",
+			hostname: "[192.0.2.25]",
+			expected: []string{tls13, "Your mail server introduces itself as [192.0.2.25], a bare IP address rather than a hostname, " + heloPhrase + "."},
+		},
+		{
+			name:     "Localhost",
+			hostname: "localhost.localdomain",
+			expected: []string{tls13, "Your mail server introduces itself as localhost.localdomain, which isn't a public hostname, " + heloPhrase + "."},
+		},
+		{
+			name:     "Unresolved",
+			hostname: "relay.example.net",
+			expected: []string{tls13, "Your mail server introduces itself as relay.example.net, which doesn't resolve, " + heloPhrase + "."},
+		},
+		{
+			name:     "Elsewhere",
+			hostname: "relay.example.net",
+			hosts:    map[string]string{"relay.example.net": "192.0.2.25"},
+			expected: []string{tls13, "Your mail server introduces itself as relay.example.net, which resolves to 192.0.2.25 rather than the address it was reached at (127.0.0.1), " + heloPhrase + "."},
+		},
+		{
+			name:     "Resolved",
+			hostname: "relay.example.net",
+			hosts:    map[string]string{"relay.example.net": "127.0.0.1"},
+			expected: []string{tls13},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network := testnet.New(t)
+			network.SMTP("mx.example.com", &testnet.SMTPServer{Hostname: test.hostname})
+			network.Resolver.Host("mx.example.com", "127.0.0.1")
+
+			for host, address := range test.hosts {
+				network.Resolver.Host(host, address)
+			}
+
+			advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(network), WithHostResolver(network.Resolver), WithRootCAs(network.CA.Pool()))
+			t.Cleanup(advisor.Close)
+
+			advice, err := advisor.checkMailTls(context.Background(), "mx.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(advice, test.expected) {
+				t.Errorf("found %v, want %v", advice, test.expected)
+			}
+
+			if len(advice) > 1 {
+				if severity := Classify(advice[1]); severity != SeverityLow {
+					t.Errorf("found %v, want %v", severity, SeverityLow)
+				}
+			}
+		})
+	}
+
+	t.Run("Overridden", func(t *testing.T) {
+		// the server wasn't reached at its published address, so the name isn't expected to resolve to it
+		resolver := testnet.NewResolver(t).Host("relay.example.net", "192.0.2.25")
+
+		advisor := NewAdvisor(time.Second, time.Minute, true, WithHostResolver(resolver), WithResolveOverrides(ResolveOverride{Host: "mx.example.com", Port: "25", Address: "127.0.0.1"}))
+		t.Cleanup(advisor.Close)
+
+		if advice := advisor.checkPresentedHostname(context.Background(), "mx.example.com", &transcriptConn{
+			peer:       &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 25},
+			transcript: []byte("220 mx.example.com ESMTP\r\n250-relay.example.net\r\n250 STARTTLS\r\n"),
+		}); advice != nil {
+			t.Errorf("found %v, want %v", advice, nil)
+		}
+	})
+}
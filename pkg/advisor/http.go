@@ -0,0 +1,65 @@
+package advisor
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxRedirects is the maximum number of redirects followed when fetching
+// remote assets (such as BIMI logos and VMC certificates).
+const maxRedirects = 5
+
+// newHTTPClient returns the default HTTP client used by the advisor for
+// fetching remote assets. It dials through the advisor's dialer, so
+// connections are subject to the same timeout as the TLS checks, and
+// validates servers with the same TLS configuration as them (see tlsConfig),
+// with the server name of each request's host.
+func newHTTPClient(dialContext func(ctx context.Context, network, address string) (net.Conn, error), proxy func(*http.Request) (*url.URL, error), tlsConfig *tls.Config, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+
+			return nil
+		},
+		Transport: &http.Transport{
+			DialContext:           dialContext,
+			ForceAttemptHTTP2:     true,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+			Proxy:                 proxy,
+			ResponseHeaderTimeout: timeout,
+			TLSClientConfig:       tlsConfig,
+			TLSHandshakeTimeout:   timeout,
+		},
+	}
+}
+
+// headURL issues a HEAD request against the given URL using the advisor's
+// HTTP client, with retries (see doWithRetry). The response body is closed
+// before returning, so only the status code and headers should be used by the
+// caller.
+func (a *Advisor) headURL(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := a.doWithRetry(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = response.Body.Close(); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,176 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+// bimiLooksGood is the advice for a BIMI record without any issues.
+const bimiLooksGood = "Your BIMI record looks good! No further action needed."
+
+// bimi represents the structure of a BIMI record.
+type bimi struct {
+	Logo        string
+	Certificate string
+	Advice      []string
+}
+
+// Lint runs only the offline syntax checks against the given records, without
+// any DNS lookups, TLS probes or remote asset fetches. It's intended for
+// validating records before they're published. Records that are empty are
+// skipped, so only the records being changed need to be provided.
+func (a *Advisor) Lint(bimi, dkim, dmarc string, mx []string, spf string) *Advice {
+	advice := &Advice{}
+
+	if bimi != "" {
+		advice.BIMI = lintBIMI(bimi)
+
+		// the DMARC record may not be given, if only the BIMI record is being changed
+		if dmarc != "" {
+			advice.BIMI = bimiEnforcement(advice.BIMI, parseDMARC(dmarc), false)
+		}
+	}
+
+	if dkim != "" {
+		advice.DKIM = append(a.CheckDKIM(dkim), lintDKIMKey(dkim)...)
+	}
+
+	if dmarc != "" {
+		advice.DMARC = a.CheckDMARC(dmarc)
+	}
+
+	if len(mx) > 0 {
+		advice.MX = lintMX(mx)
+	}
+
+	if spf != "" {
+		advice.SPF = a.CheckSPF(spf)
+	}
+
+	return advice
+}
+
+// lintBIMI checks the syntax of a BIMI record, without downloading its logo or
+// certificate.
+func lintBIMI(record string) []string {
+	if len(record) == 0 {
+		return []string{"We couldn't detect any active BIMI record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}
+	}
+
+	return summarizeBIMI(parseBIMI(record).Advice)
+}
+
+// lintMX checks the number of mail servers and that each has a hostname,
+// without probing them.
+func lintMX(mx []string) (advice []string) {
+	switch len(mx) {
+	case 0:
+		return []string{"You do not have any mail servers setup, so you cannot receive email at this domain."}
+	case 1:
+		advice = []string{"You have a single mail server setup, but it's recommended that you have at least two setup in case the first one fails."}
+	default:
+		advice = []string{"You have multiple mail servers setup, which is recommended."}
+	}
+
+	for _, serverAddress := range mx {
+		if _, ok := normalizeHostname(serverAddress); !ok {
+			advice = append(advice, "Your domain has a malformed MX record, as it doesn't contain a hostname.")
+		}
+	}
+
+	return advice
+}
+
+// parseBIMI extracts the logo and certificate URLs from a BIMI record, along
+// with any advice about its syntax. Only the first of each URL is used, and
+// empty URLs are reported as missing. A record with a typo isn't parsed any
+// further, so its URLs are left empty.
+func parseBIMI(record string) bimi {
+	bimiRecord := bimi{}
+
+	if advice := typoAdvice(lookalike.BIMI, record); advice != nil {
+		bimiRecord.Advice = advice
+		return bimiRecord
+	}
+
+	if !strings.Contains(record, ";") {
+		bimiRecord.Advice = append(bimiRecord.Advice, "Your BIMI record appears to be malformed as no semicolons seem to be present.")
+		return bimiRecord
+	}
+
+	for index, tag := range strings.Split(record, ";") {
+		tag = strings.TrimSpace(tag)
+
+		if index == 0 && !strings.Contains(tag, "v=BIMI1") {
+			bimiRecord.Advice = append(bimiRecord.Advice, "The beginning of your BIMI record should be v=BIMI1 with specific capitalization.")
+		}
+
+		if strings.Contains(tag, "l=") && bimiRecord.Logo == "" {
+			bimiRecord.Logo = strings.TrimPrefix(tag, "l=")
+		}
+
+		if strings.Contains(tag, "a=") && bimiRecord.Certificate == "" {
+			bimiRecord.Certificate = strings.TrimPrefix(tag, "a=")
+		}
+	}
+
+	if bimiRecord.Logo == "" {
+		bimiRecord.Advice = append(bimiRecord.Advice, "Your BIMI record is missing the SVG logo URL.")
+	}
+
+	if bimiRecord.Certificate == "" {
+		bimiRecord.Advice = append(bimiRecord.Advice, "Your BIMI record is missing the VMC cert URL.")
+	}
+
+	return bimiRecord
+}
+
+// bimiEnforcement returns the advice for a published BIMI record, with a
+// finding added if the DMARC record that applies to the domain doesn't enforce
+// its policy on all of its mail, as receivers only display BIMI logos for
+// domains at p=quarantine or p=reject with pct=100. The subdomain policy
+// applies if the record is a subdomain's organizational domain's. The finding
+// replaces the advice that the BIMI record looks good, as it then isn't.
+func bimiEnforcement(advice []string, dmarcRecord *dmarc, subdomain bool) []string {
+	var reason string
+
+	switch {
+	case dmarcRecord == nil:
+		reason = "your domain has no valid DMARC record"
+	default:
+		policy, tag := dmarcRecord.Policy, "p"
+		if subdomain && dmarcRecord.SubdomainPolicy != "" {
+			policy, tag = dmarcRecord.SubdomainPolicy, "sp"
+		}
+
+		switch {
+		case policy == "none":
+			reason = "your DMARC policy is " + tag + "=none"
+		case policy != "quarantine" && policy != "reject":
+			reason = "your DMARC record has no valid policy"
+		case dmarcRecord.Percentage < 100:
+			reason = fmt.Sprintf("your DMARC policy only applies to %d%% of your mail (pct=%d)", max(dmarcRecord.Percentage, 0), dmarcRecord.Percentage)
+		default:
+			return advice
+		}
+	}
+
+	if len(advice) > 0 && advice[0] == bimiLooksGood {
+		advice = advice[1:]
+	}
+
+	return append([]string{"Your BIMI record will not be honored because " + reason + ". Receivers only display BIMI logos for domains with a DMARC policy of p=quarantine or p=reject at pct=100."}, advice...)
+}
+
+// summarizeBIMI returns the final BIMI advice, prefixed with a message
+// detailing that the record has some issues (if there are any).
+func summarizeBIMI(advice []string) []string {
+	if len(advice) == 0 {
+		return []string{bimiLooksGood}
+	}
+
+	// prepend a message detailing that the BIMI record has some issues
+	return append([]string{"Your BIMI record has some issues:"}, advice...)
+}
@@ -0,0 +1,97 @@
+package advisor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type (
+	// panickingDialer fails the test by panicking on any connection attempt.
+	panickingDialer struct{}
+
+	// panickingTransport fails the test by panicking on any HTTP request.
+	panickingTransport struct{}
+)
+
+func (panickingDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	panic("unexpected connection to " + address)
+}
+
+func (panickingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	panic("unexpected request to " + req.URL.String())
+}
+
+func TestAdvisor_Lint(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, true, WithDialer(panickingDialer{}), WithHTTPClient(&http.Client{Transport: panickingTransport{}}))
+
+	t.Run("AllRecords", func(t *testing.T) {
+		advice := advisor.Lint("v=BIMI1; l=https://bimi.example.com/logo.svg; a=https://bimi.example.com/cert.pem", "v=DKIM1; k=rsa; p=KEY", "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", []string{"mx1.example.com.", "mx2.example.com."}, "v=spf1 -all")
+
+		expected := &Advice{
+			BIMI:  []string{"Your BIMI record looks good! No further action needed."},
+			DKIM:  advisor.CheckDKIM("v=DKIM1; k=rsa; p=KEY"),
+			DMARC: advisor.CheckDMARC("v=DMARC1; p=reject; rua=mailto:dmarc@example.com"),
+			MX:    []string{"You have multiple mail servers setup, which is recommended."},
+			SPF:   advisor.CheckSPF("v=spf1 -all"),
+		}
+
+		if !reflect.DeepEqual(advice, expected) {
+			t.Errorf("found %v, want %v", advice, expected)
+		}
+	})
+
+	t.Run("BIMIEnforcement", func(t *testing.T) {
+		const bimi = "v=BIMI1; l=https://bimi.example.com/logo.svg; a=https://bimi.example.com/cert.pem"
+
+		advice := advisor.Lint(bimi, "", "v=DMARC1; p=quarantine; pct=25", nil, "")
+		expected := []string{"Your BIMI record will not be honored because your DMARC policy only applies to 25% of your mail (pct=25). Receivers only display BIMI logos for domains with a DMARC policy of p=quarantine or p=reject at pct=100."}
+
+		if !reflect.DeepEqual(advice.BIMI, expected) {
+			t.Errorf("found %v, want %v", advice.BIMI, expected)
+		}
+
+		// without the DMARC record, the BIMI record is linted on its own
+		if advice := advisor.Lint(bimi, "", "", nil, ""); !reflect.DeepEqual(advice.BIMI, []string{bimiLooksGood}) {
+			t.Errorf("found %v, want %v", advice.BIMI, []string{bimiLooksGood})
+		}
+	})
+
+	t.Run("OmittedRecords", func(t *testing.T) {
+		advice := advisor.Lint("", "", "v=DMARC1; p=none;", nil, "")
+
+		if advice.BIMI != nil || advice.DKIM != nil || advice.MX != nil || advice.SPF != nil {
+			t.Errorf("found %v, want only DMARC advice", advice)
+		}
+
+		if !reflect.DeepEqual(advice.DMARC, advisor.CheckDMARC("v=DMARC1; p=none;")) {
+			t.Errorf("found %v, want %v", advice.DMARC, advisor.CheckDMARC("v=DMARC1; p=none;"))
+		}
+	})
+
+	t.Run("BIMISyntax", func(t *testing.T) {
+		tests := map[string][]string{
+			"BIMI1 l=https://bimi.example.com/logo.svg":        {"Your BIMI record has some issues:", "Your BIMI record appears to be malformed as no semicolons seem to be present."},
+			"v=BIMI2; l=; a=https://bimi.example.com/cert.pem": {"Your BIMI record has some issues:", "The beginning of your BIMI record should be v=BIMI1 with specific capitalization.", "Your BIMI record is missing the SVG logo URL."},
+			"v=BIMI1; l=https://bimi.example.com/logo.svg;":    {"Your BIMI record has some issues:", "Your BIMI record is missing the VMC cert URL."},
+			"“v=BIMI1; l=https://bimi.example.com/logo.svg”":   {"Your BIMI record has some issues:", `Your BIMI record contains a typo: "“" should be removed.`, `Your BIMI record contains a typo: "”" should be removed.`, "Receivers will likely ignore your BIMI record until it's corrected to: v=BIMI1; l=https://bimi.example.com/logo.svg"},
+		}
+
+		for record, expected := range tests {
+			if advice := advisor.Lint(record, "", "", nil, "").BIMI; !reflect.DeepEqual(advice, expected) {
+				t.Errorf("found %v for %q, want %v", advice, record, expected)
+			}
+		}
+	})
+
+	t.Run("MalformedMX", func(t *testing.T) {
+		expected := []string{"You have multiple mail servers setup, which is recommended.", "Your domain has a malformed MX record, as it doesn't contain a hostname."}
+
+		if advice := advisor.Lint("", "", "", []string{"mx.example.com.", "."}, "").MX; !reflect.DeepEqual(advice, expected) {
+			t.Errorf("found %v, want %v", advice, expected)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// legitimateLookalikesPhrase marks lookalike advice, which is informational
+// as lookalikes are often registered legitimately, or defensively by the
+// domain's owner.
+const legitimateLookalikesPhrase = "Lookalikes are often registered legitimately or defensively"
+
+// lookalikeTechniques describes how a lookalike generated by each technique
+// differs from the domain.
+var lookalikeTechniques = map[string]string{
+	"confusable":  "replaces characters of your domain with ones easily mistaken for them",
+	"homograph":   "replaces a letter of your domain with an identical looking Cyrillic one",
+	"hyphenation": "adds or removes a hyphen in your domain",
+	"swap":        "swaps two adjacent characters of your domain",
+}
+
+// Lookalike is a domain that resolves and is easily mistaken for the scanned
+// domain, with the records that show whether it's set up for mail. Unicode is
+// its displayed form, if it's an internationalized domain name.
+type Lookalike struct {
+	Name      string
+	Unicode   string
+	Technique string
+	MX        []string
+	SPF       string
+}
+
+// CheckLookalikes returns advice on the lookalikes of the domain that
+// resolve, noting whether each accepts mail (as it has MX records) and
+// whether its SPF record authorizes senders, or lets any server send as it.
+// A lookalike that's set up for mail is a potential phishing sender.
+func (a *Advisor) CheckLookalikes(lookalikes []Lookalike) []string {
+	if len(lookalikes) == 0 {
+		return []string{"None of the lookalikes of your domain that were checked resolve. No further action needed."}
+	}
+
+	advice := make([]string, 0, len(lookalikes))
+
+	for _, lookalike := range lookalikes {
+		name := lookalike.Name
+		if lookalike.Unicode != "" && lookalike.Unicode != lookalike.Name {
+			name += " (displayed as " + lookalike.Unicode + ")"
+		}
+
+		technique, ok := lookalikeTechniques[lookalike.Technique]
+		if !ok {
+			technique = "resembles your domain"
+		}
+
+		var setup []string
+
+		// a null MX record (RFC 7505) says the lookalike accepts no mail
+		if len(lookalike.MX) > 0 && !(len(lookalike.MX) == 1 && strings.TrimSpace(lookalike.MX[0]) == ".") {
+			setup = append(setup, "accepts mail")
+		}
+
+		switch qualifier := spfAllQualifier(lookalike.SPF); {
+		case lookalike.SPF == "":
+		case qualifier == "+" || qualifier == "?":
+			setup = append(setup, "has an SPF record that lets any server send as it")
+		case strings.TrimSpace(strings.TrimPrefix(strings.ToLower(lookalike.SPF), "v=spf1")) != qualifier+"all":
+			setup = append(setup, "has an SPF record that authorizes senders")
+		}
+
+		if len(setup) == 0 {
+			advice = append(advice, fmt.Sprintf("%s %s, and resolves, but isn't set up for mail. %s, so this is informational.", name, technique, legitimateLookalikesPhrase))
+			continue
+		}
+
+		advice = append(advice, fmt.Sprintf("%s %s, and %s, so it could be used to phish your recipients. %s, so this is informational, but if it isn't yours, check who registered it, and report it to its registrar if it's being abused.", name, technique, strings.Join(setup, " and "), legitimateLookalikesPhrase))
+	}
+
+	return advice
+}
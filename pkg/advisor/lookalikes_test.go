@@ -0,0 +1,46 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CheckLookalikes(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("None", func(t *testing.T) {
+		advice := advisor.CheckLookalikes(nil)
+
+		if len(advice) != 1 || !strings.Contains(advice[0], "No further action needed") || Classify(advice[0]) != SeverityInfo {
+			t.Errorf("found %v, want the no lookalikes advice", advice)
+		}
+	})
+
+	advice := advisor.CheckLookalikes([]Lookalike{
+		{Name: "examp1e.com", Technique: "confusable", MX: []string{"mx.examp1e.com."}, SPF: "v=spf1 +all"},
+		{Name: "xn--xample-2of.com", Unicode: "еxample.com", Technique: "homograph", SPF: "v=spf1 include:_spf.example.net ~all"},
+		{Name: "exmaple.com", Technique: "swap", MX: []string{"."}, SPF: "v=spf1 -all"},
+	})
+
+	expected := []string{
+		"examp1e.com replaces characters of your domain with ones easily mistaken for them, and accepts mail and has an SPF record that lets any server send as it, so it could be used to phish your recipients. Lookalikes are often registered legitimately or defensively, so this is informational, but if it isn't yours, check who registered it, and report it to its registrar if it's being abused.",
+		"xn--xample-2of.com (displayed as еxample.com) replaces a letter of your domain with an identical looking Cyrillic one, and has an SPF record that authorizes senders, so it could be used to phish your recipients. Lookalikes are often registered legitimately or defensively, so this is informational, but if it isn't yours, check who registered it, and report it to its registrar if it's being abused.",
+		"exmaple.com swaps two adjacent characters of your domain, and resolves, but isn't set up for mail. Lookalikes are often registered legitimately or defensively, so this is informational.",
+	}
+
+	if len(advice) != len(expected) {
+		t.Fatalf("found %v, want %v", advice, expected)
+	}
+
+	for i := range expected {
+		if advice[i] != expected[i] {
+			t.Errorf("found %q, want %q", advice[i], expected[i])
+		}
+
+		// lookalikes are informational, however they're set up
+		if severity := Classify(advice[i]); severity != SeverityInfo {
+			t.Errorf("found %v, want %v", severity, SeverityInfo)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package advisor
+
+import (
+	"fmt"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+// managedPhrase marks the advice noting that a record is hosted by a managed
+// email authentication service, which is informational.
+const managedPhrase = "a managed email authentication service, as"
+
+// CheckManagedRecord returns the advice for a DMARC or SPF record hosted by a
+// managed email authentication service, given the chain of targets the name
+// it's looked up at (_dmarc.<domain> for DMARC, or the domain itself for SPF)
+// is an alias of, and the record found at the end of it. The record itself is
+// checked as usual. It also returns the service's name, from the provider
+// fingerprint table, or "" (with no advice) if the chain doesn't lead to a
+// known service.
+func (a *Advisor) CheckManagedRecord(kind lookalike.Kind, domain string, chain []string, record string) ([]string, string) {
+	var name string
+
+	switch kind.Name {
+	case lookalike.DMARC.Name:
+		name = "_dmarc." + normalizeDomain(domain)
+	case lookalike.SPF.Name:
+		name = normalizeDomain(domain)
+	default:
+		return nil, ""
+	}
+
+	managed := managedProvider(a.loadData().providers, chain)
+	if managed == nil {
+		return nil, ""
+	}
+
+	target := chain[len(chain)-1]
+
+	if record == "" {
+		return []string{fmt.Sprintf("%s is an alias (CNAME) of %s at %s, a managed email authentication service, which doesn't publish your domain's %s record, so receivers find none. Make sure your domain is set up and active in %s, or replace the CNAME with your own %s record.", name, target, managed.Name, kind.Name, managed.Name, kind.Name)}, managed.Name
+	}
+
+	advice := fmt.Sprintf("Your %s record is hosted by %s, %s %s is an alias (CNAME) of %s, so the record published there is the one receivers use.", kind.Name, managed.Name, managedPhrase, name, target)
+	if managed.Advice.Managed != "" {
+		advice += " " + managed.Advice.Managed
+	}
+
+	return []string{advice}, managed.Name
+}
+
+// managedProvider returns the managed email authentication service any of the
+// chain's targets belong to, or nil if none do.
+func managedProvider(providers []provider, chain []string) *provider {
+	for index := range providers {
+		if matchesSuffix(chain, providers[index].CNAME) {
+			return &providers[index]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+func TestCheckManagedRecord(t *testing.T) {
+	advisor := NewAdvisor(time.Second, 0, false)
+
+	tests := []struct {
+		name     string
+		kind     lookalike.Kind
+		chain    []string
+		record   string
+		service  string
+		expected string
+		severity Severity
+	}{
+		{"NoCNAME", lookalike.DMARC, nil, "v=DMARC1; p=reject", "", "", SeverityInfo},
+		{"UnknownTarget", lookalike.DMARC, []string{"_dmarc.example.net"}, "v=DMARC1; p=reject", "", "", SeverityInfo},
+		{"EasyDMARC", lookalike.DMARC, []string{"example.com._d.easydmarc.pro"}, "v=DMARC1; p=reject", "EasyDMARC", "Your DMARC record is hosted by EasyDMARC, a managed email authentication service, as _dmarc.example.com is an alias (CNAME) of example.com._d.easydmarc.pro", SeverityInfo},
+		{"ValimailChain", lookalike.DMARC, []string{"_dmarc.example.net", "example.com.dmarc.valimail.com"}, "v=DMARC1; p=none", "Valimail", "is an alias (CNAME) of example.com.dmarc.valimail.com, so the record published there", SeverityInfo},
+		{"OnDMARCSPF", lookalike.SPF, []string{"example.com._spf.smart.ondmarc.com"}, "v=spf1 -all", "Red Sift OnDMARC", "Your SPF record is hosted by Red Sift OnDMARC, a managed email authentication service, as example.com is an alias (CNAME)", SeverityInfo},
+		{"Missing", lookalike.DMARC, []string{"example.com._d.powerdmarc.com"}, "", "PowerDMARC", "at PowerDMARC, a managed email authentication service, which doesn't publish your domain's DMARC record", SeverityHigh},
+		{"DKIM", lookalike.DKIM, []string{"example.com._d.easydmarc.pro"}, "v=DKIM1; p=KEY", "", "", SeverityInfo},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice, service := advisor.CheckManagedRecord(test.kind, "Example.com.", test.chain, test.record)
+			if service != test.service {
+				t.Errorf("found %q, want %q", service, test.service)
+			}
+
+			if test.expected == "" {
+				if advice != nil {
+					t.Errorf("found %v, want no advice", advice)
+				}
+
+				return
+			}
+
+			if len(advice) != 1 || !strings.Contains(advice[0], test.expected) {
+				t.Fatalf("found %v, want it to contain %q", advice, test.expected)
+			}
+
+			if severity := Classify(advice[0]); severity != test.severity {
+				t.Errorf("found %v, want %v", severity, test.severity)
+			}
+		})
+	}
+}
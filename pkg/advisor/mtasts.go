@@ -0,0 +1,520 @@
+package advisor
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// mtaSTSMaxPolicySize bounds the MTA-STS policy read, as senders are
+	// expected to limit it (RFC 8461, section 3.3).
+	mtaSTSMaxPolicySize = 64 * 1024
+
+	// mtaSTSMaxAge is the longest max_age an MTA-STS policy may have, of
+	// about a year (RFC 8461, section 3.2).
+	mtaSTSMaxAge = 31557600
+
+	// mtaSTSMinRecommendedAge is the shortest max_age we recommend for an
+	// MTA-STS policy, as until it's cached for a while, it only protects
+	// mail from senders that have recently fetched it.
+	mtaSTSMinRecommendedAge = 24 * 60 * 60
+)
+
+type (
+	// mtaSTSPolicy represents the structure of an MTA-STS policy.
+	mtaSTSPolicy struct {
+		Version string
+		Mode    string
+		MX      []string
+		MaxAge  int
+		Advice  []string
+	}
+
+	// mailCertificate is whether a mail server's STARTTLS certificate is
+	// valid for its hostname, as MTA-STS requires. If it wasn't checked (such
+	// as if the server couldn't be reached), reason says why, or err holds the
+	// failure on the scanner's side that kept it from being checked.
+	mailCertificate struct {
+		checked bool
+		problem string
+		reason  string
+		err     error
+	}
+
+	// mtaSTSPolicyError is a policy that was fetched, but that senders would
+	// reject as it wasn't served as RFC 8461 requires. It reads as the reason
+	// the policy couldn't be fetched, such as "it returned 404 Not Found".
+	mtaSTSPolicyError string
+)
+
+func (e mtaSTSPolicyError) Error() string {
+	return string(e)
+}
+
+// CheckMTASTS returns advice on the domain's MTA-STS records and policy:
+// whether each of its mail servers matches the policy's mx patterns and
+// presents a certificate valid for its hostname, and so whether mail to it
+// would be delivered with the policy enforced. Nothing is returned if the
+// records weren't looked up (see scanner.WithMTASTS), which records is nil
+// for.
+func (a *Advisor) CheckMTASTS(ctx context.Context, domain string, records, mx []string) ([]string, error) {
+	if records == nil {
+		return nil, nil
+	}
+
+	domain = normalizeDomain(domain)
+
+	if len(records) == 0 {
+		return []string{fmt.Sprintf("Your domain doesn't publish an MTA-STS record at _mta-sts.%s, so senders don't require TLS when delivering its mail, and it can be downgraded to plaintext in transit.", domain)}, nil
+	}
+
+	if len(records) > 1 {
+		return []string{fmt.Sprintf("Your domain publishes %d MTA-STS records at _mta-sts.%s, so senders ignore your MTA-STS policy. Merge them into a single record.", len(records), domain)}, nil
+	}
+
+	var advice []string
+	if !validMTASTSID(records[0]) {
+		advice = append(advice, "Your MTA-STS record has no valid id= tag (of up to 32 letters and digits), so senders can't tell when your policy changes. Add one, and change it whenever the policy does.")
+	}
+
+	if a.isOffline(ctx) {
+		return append(advice, skippedOffline("The MTA-STS policy check of your domain")), nil
+	}
+
+	if a.checkTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.checkTimeout)
+		defer cancel()
+	}
+
+	ctx = contextWithCacheTag(ctx, domain)
+
+	body, err := a.fetchMTASTSPolicy(ctx, domain)
+	if err != nil {
+		if unavailableAdvice, ok := unavailableAdvice("Your MTA-STS policy", err); ok {
+			return append(advice, unavailableAdvice), nil
+		}
+
+		if isInfrastructureError(ctx, err) {
+			return advice, err
+		}
+
+		return append(advice, fmt.Sprintf("Your MTA-STS policy couldn't be fetched from %s, as %s, so senders ignore your MTA-STS record.", mtaSTSPolicyURL(domain), mtaSTSFetchFailure(err))), nil
+	}
+
+	policy := parseMTASTSPolicy(body)
+	if len(policy.Advice) > 0 && policy.Mode == "" {
+		return append(advice, policy.Advice...), nil
+	}
+
+	advice = append(advice, policy.Advice...)
+
+	if policy.Mode == "none" {
+		return append(advice, "Your MTA-STS policy is in mode: none, so senders treat your domain as having no policy, and it wasn't checked against your mail servers."), nil
+	}
+
+	verdicts, err := a.evaluateMTASTS(ctx, policy, mx)
+
+	return append(advice, verdicts...), err
+}
+
+// evaluateMTASTS returns a verdict for each of the mail servers under the
+// policy: whether it matches one of the policy's mx patterns, and presents a
+// certificate valid for its hostname. Servers that don't match aren't probed,
+// as they fail the policy either way. Servers whose certificates couldn't be
+// checked on the scanner's side have their errors joined.
+func (a *Advisor) evaluateMTASTS(ctx context.Context, policy *mtaSTSPolicy, mx []string) ([]string, error) {
+	var (
+		advice  []string
+		errs    []error
+		passing int
+		total   int
+	)
+
+	blocked := a.port25Blocked(ctx)
+	if blocked {
+		advice = append(advice, port25BlockedAdvice())
+	}
+
+	for _, serverAddress := range mx {
+		hostname, ok := normalizeHostname(serverAddress)
+		if !ok {
+			continue
+		}
+
+		total++
+
+		pattern, ok := matchMTASTSPolicy(policy.MX, hostname)
+		if !ok {
+			patterns := "it has none"
+			if len(policy.MX) > 0 {
+				patterns = "mx: " + strings.Join(policy.MX, ", mx: ")
+			}
+
+			advice = append(advice, mtaSTSRejection(policy.Mode, hostname, fmt.Sprintf("it doesn't match any of the mx patterns in your MTA-STS policy (%s). Add mx: %s (or a wildcard covering it) to the policy", patterns, hostname)))
+			continue
+		}
+
+		if blocked {
+			advice = append(advice, fmt.Sprintf("%s matches mx: %s in your MTA-STS policy, but its certificate couldn't be checked.", hostname, pattern))
+			continue
+		}
+
+		certificate := a.checkMailCertificate(ctx, hostname)
+
+		switch {
+		case certificate.err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", hostname, certificate.err))
+			advice = append(advice, fmt.Sprintf("%s matches mx: %s in your MTA-STS policy, but its certificate couldn't be checked.", hostname, pattern))
+		case !certificate.checked:
+			advice = append(advice, fmt.Sprintf("%s matches mx: %s in your MTA-STS policy, but its certificate couldn't be checked: %s", hostname, pattern, certificate.reason))
+		case certificate.problem != "":
+			advice = append(advice, mtaSTSRejection(policy.Mode, hostname, certificate.problem))
+		default:
+			passing++
+			advice = append(advice, fmt.Sprintf("%s matches mx: %s in your MTA-STS policy, and presents a valid certificate for it, so it passes the policy.", hostname, pattern))
+		}
+	}
+
+	switch {
+	case total == 0:
+		advice = append(advice, "Your domain has no mail servers to check against your MTA-STS policy.")
+	case passing < total:
+	case policy.Mode == "enforce":
+		advice = append(advice, "Your MTA-STS policy is enforced, and every one of your mail servers passes it. No further action needed.")
+	default:
+		advice = append(advice, "Every one of your mail servers passes your MTA-STS policy, so you can move it from mode: testing to mode: enforce.")
+	}
+
+	return advice, errors.Join(errs...)
+}
+
+// mtaSTSRejection returns the verdict for a mail server that fails the
+// policy for the reason given: under mode: enforce, senders refuse to deliver
+// to it, and under mode: testing, they would once it's enforced.
+func mtaSTSRejection(mode, hostname, reason string) string {
+	if mode == "enforce" {
+		return fmt.Sprintf("%s is rejected by senders enforcing your MTA-STS policy, as %s.", hostname, reason)
+	}
+
+	return fmt.Sprintf("%s would be rejected under mode: enforce, as %s.", hostname, reason)
+}
+
+// matchMTASTSPolicy returns the first of the policy's mx patterns that the
+// hostname matches, if any.
+func matchMTASTSPolicy(patterns []string, hostname string) (string, bool) {
+	for _, pattern := range patterns {
+		if matchMTASTSPattern(pattern, hostname) {
+			return pattern, true
+		}
+	}
+
+	return "", false
+}
+
+// matchMTASTSPattern returns whether the hostname matches an MTA-STS policy's
+// mx pattern, case-insensitively. A pattern starting with "*." matches
+// exactly one label in its place, so *.example.com matches mx1.example.com,
+// but not example.com or a.mx1.example.com (RFC 8461, section 4.1).
+func matchMTASTSPattern(pattern, hostname string) bool {
+	pattern, hostname = normalizeDomain(pattern), normalizeDomain(hostname)
+
+	if pattern == "" || hostname == "" {
+		return false
+	}
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		label, rest, found := strings.Cut(hostname, ".")
+		return found && label != "" && rest == suffix
+	}
+
+	return pattern == hostname
+}
+
+// parseMTASTSPolicy parses an MTA-STS policy's fields, each of which is a
+// "key: value" line (RFC 8461, section 3.2). Unknown fields are ignored. If
+// the policy is invalid, so senders ignore it, its mode is left empty.
+func parseMTASTSPolicy(body string) *mtaSTSPolicy {
+	policy := &mtaSTSPolicy{}
+
+	var mode, maxAge string
+
+	for _, line := range strings.Split(body, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSuffix(line, "\r"), ":")
+		if !ok {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "version":
+			policy.Version = value
+		case "mode":
+			mode = value
+		case "max_age":
+			maxAge = value
+		case "mx":
+			policy.MX = append(policy.MX, strings.ToLower(value))
+		}
+	}
+
+	if policy.Version != "STSv1" {
+		policy.Advice = append(policy.Advice, "Your MTA-STS policy's version must be STSv1, so senders ignore your MTA-STS policy.")
+	}
+
+	if mode != "enforce" && mode != "testing" && mode != "none" {
+		policy.Advice = append(policy.Advice, "Your MTA-STS policy's mode must be enforce, testing or none, so senders ignore your MTA-STS policy.")
+	}
+
+	var err error
+	if policy.MaxAge, err = strconv.Atoi(maxAge); err != nil || policy.MaxAge < 0 || policy.MaxAge > mtaSTSMaxAge {
+		policy.Advice = append(policy.Advice, fmt.Sprintf("Your MTA-STS policy's max_age must be a number of seconds up to %d, so senders ignore your MTA-STS policy.", mtaSTSMaxAge))
+	}
+
+	if len(policy.Advice) > 0 {
+		return policy
+	}
+
+	policy.Mode = mode
+
+	if policy.MaxAge < mtaSTSMinRecommendedAge && mode != "none" {
+		policy.Advice = append(policy.Advice, fmt.Sprintf("Your MTA-STS policy's max_age of %d seconds is under a day, so senders soon forget it, and mail they send after it lapses can be downgraded. Raise it to at least a week (604800) once it's enforced.", policy.MaxAge))
+	}
+
+	return policy
+}
+
+// validMTASTSID returns whether an MTA-STS record has an id= tag of 1 to 32
+// letters and digits (RFC 8461, section 3.1).
+func validMTASTSID(record string) bool {
+	for _, tag := range strings.Split(record, ";") {
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok || strings.TrimSpace(name) != "id" {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) == 0 || len(value) > 32 {
+			return false
+		}
+
+		for _, char := range value {
+			if (char < 'a' || char > 'z') && (char < 'A' || char > 'Z') && (char < '0' || char > '9') {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// mtaSTSPolicyURL returns the URL senders fetch the domain's MTA-STS policy
+// from.
+func mtaSTSPolicyURL(domain string) string {
+	return "https://mta-sts." + domain + "/.well-known/mta-sts.txt"
+}
+
+// fetchMTASTSPolicy fetches the domain's MTA-STS policy as senders do: over
+// HTTPS, without following redirects, and only if it's served as text/plain
+// with a 200 status (RFC 8461, section 3.3).
+func (a *Advisor) fetchMTASTSPolicy(ctx context.Context, domain string) (string, error) {
+	policyURL := mtaSTSPolicyURL(domain)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, policyURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := a.doWithRetry(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.Request != nil && response.Request.URL.String() != policyURL {
+		return "", mtaSTSPolicyError(fmt.Sprintf("it redirects to %s, which senders don't follow", response.Request.URL))
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return "", mtaSTSPolicyError("it returned " + response.Status)
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type")); mediaType != "text/plain" {
+		return "", mtaSTSPolicyError(fmt.Sprintf("it's served as %q rather than text/plain", response.Header.Get("Content-Type")))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, mtaSTSMaxPolicySize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(body) > mtaSTSMaxPolicySize {
+		return "", mtaSTSPolicyError(fmt.Sprintf("it's larger than %dKB", mtaSTSMaxPolicySize/1024))
+	}
+
+	return string(body), nil
+}
+
+// mtaSTSFetchFailure explains why the policy couldn't be fetched, describing
+// certificate problems as senders would see them, without the error's own
+// text.
+func mtaSTSFetchFailure(err error) string {
+	if problem, ok := certificateProblem(err); ok {
+		return problem
+	}
+
+	var policyErr mtaSTSPolicyError
+	if errors.As(err, &policyErr) {
+		return string(policyErr)
+	}
+
+	category, _ := classifyMailFailure(err)
+
+	switch category {
+	case mailFailureRefused:
+		return "it refused the connection"
+	case mailFailureTimeout:
+		return "it didn't respond before timeout"
+	case mailFailureReset:
+		return "it closed the connection"
+	case mailFailureDNS:
+		return "its hostname couldn't be resolved to an address"
+	}
+
+	return "the connection to it failed"
+}
+
+// checkMailCertificate returns whether the mail server presents a STARTTLS
+// certificate valid for its hostname. The outcome is cached, unless the
+// server couldn't be checked.
+func (a *Advisor) checkMailCertificate(ctx context.Context, hostname string) (certificate mailCertificate) {
+	// an overridden connection's outcome is cached separately from the live host's
+	key := hostname
+	address, overridden := a.resolveOverride(ctx, hostname, "25")
+	if overridden {
+		key += "@" + address
+	}
+
+	if cached := a.tlsCacheMailCerts.Get(key); cached != nil {
+		a.tlsCacheMailCerts.Tag(key, cacheTags(ctx)...)
+		return *cached
+	}
+
+	defer func() {
+		if ctx.Err() == nil && certificate.checked {
+			a.tlsCacheMailCerts.SetTagged(key, &certificate, cacheTags(ctx, hostname)...)
+		}
+	}()
+
+	if remaining, ok := a.smtp.deferred(hostname); ok {
+		return mailCertificate{reason: deferredAdvice("", remaining)}
+	}
+
+	return a.probeMailCertificate(ctx, hostname)
+}
+
+// probeMailCertificate connects to the host's SMTP port and starts TLS,
+// verifying its certificate against its hostname.
+func (a *Advisor) probeMailCertificate(ctx context.Context, hostname string) mailCertificate {
+	release, err := a.smtp.acquire(ctx)
+	if err != nil {
+		return mailCertificate{err: err}
+	}
+	defer release()
+
+	conn, err := a.dialMail(ctx, hostname)
+	if err != nil {
+		if isInfrastructureError(ctx, err) {
+			return mailCertificate{err: err}
+		}
+
+		return mailCertificate{reason: mailFailureAdvice(err)}
+	}
+	defer conn.Close()
+
+	client, err := smtp.NewClient(conn, hostname)
+	if err != nil {
+		if reply, ok := parseDeferral(err); ok {
+			return mailCertificate{reason: deferredAdvice(reply, a.smtp.deferHost(hostname))}
+		}
+
+		if isInfrastructureError(ctx, err) {
+			return mailCertificate{err: err}
+		}
+
+		return mailCertificate{reason: mailFailureAdvice(err)}
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); !ok {
+		a.smtp.succeeded(hostname)
+		return mailCertificate{checked: true, problem: "it doesn't offer STARTTLS"}
+	}
+
+	if err = client.StartTLS(a.tlsConfig(hostname)); err != nil {
+		if problem, ok := certificateProblem(err); ok {
+			a.smtp.succeeded(hostname)
+			return mailCertificate{checked: true, problem: problem}
+		}
+
+		if reply, ok := parseDeferral(err); ok {
+			return mailCertificate{reason: deferredAdvice(reply, a.smtp.deferHost(hostname))}
+		}
+
+		if isInfrastructureError(ctx, err) {
+			return mailCertificate{err: err}
+		}
+
+		return mailCertificate{reason: startTLSFailureAdvice}
+	}
+
+	a.smtp.succeeded(hostname)
+
+	return mailCertificate{checked: true}
+}
+
+// certificateProblem describes why a certificate failed verification, if the
+// error is a verification failure.
+func certificateProblem(err error) (string, bool) {
+	var (
+		hostnameErr  x509.HostnameError
+		authorityErr x509.UnknownAuthorityError
+		invalidErr   x509.CertificateInvalidError
+	)
+
+	switch {
+	case errors.As(err, &hostnameErr):
+		names := hostnameErr.Certificate.DNSNames
+		if len(names) == 0 && hostnameErr.Certificate.Subject.CommonName != "" {
+			names = []string{hostnameErr.Certificate.Subject.CommonName}
+		}
+
+		if len(names) == 0 {
+			return fmt.Sprintf("its certificate isn't valid for %s", hostnameErr.Host), true
+		}
+
+		if len(names) > 3 {
+			names = append(names[:3:3], "others")
+		}
+
+		return fmt.Sprintf("its certificate isn't valid for %s (it's for %s)", hostnameErr.Host, strings.Join(names, ", ")), true
+	case errors.As(err, &authorityErr):
+		return "its certificate isn't issued by a trusted certificate authority", true
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		return "its certificate has expired (or isn't valid yet)", true
+	case errors.As(err, &invalidErr):
+		return "its certificate isn't valid (" + invalidErr.Error() + ")", true
+	}
+
+	return "", false
+}
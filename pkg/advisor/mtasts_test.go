@@ -0,0 +1,316 @@
+package advisor
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchMTASTSPattern(t *testing.T) {
+	tests := []struct {
+		pattern, hostname string
+		expected          bool
+	}{
+		{"mx1.example.com", "mx1.example.com", true},
+		{"MX1.Example.com", "mx1.example.COM.", true},
+		{"mx1.example.com", "mx2.example.com", false},
+		{"*.example.com", "mx1.example.com", true},
+		{"*.example.com", "MX2.EXAMPLE.COM.", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "a.mx1.example.com", false},
+		{"*.example.com", "mx1.example.net", false},
+		{"*.example.com", "mx1.badexample.com", false},
+		{"*.example.com", ".example.com", false},
+		{"mx*.example.com", "mx1.example.com", false},
+		{"", "mx1.example.com", false},
+		{"mx1.example.com", "", false},
+	}
+
+	for _, test := range tests {
+		if found := matchMTASTSPattern(test.pattern, test.hostname); found != test.expected {
+			t.Errorf("found %v for %q matching %q, want %v", found, test.hostname, test.pattern, test.expected)
+		}
+	}
+}
+
+func TestParseMTASTSPolicy(t *testing.T) {
+	policy := parseMTASTSPolicy("version: STSv1\r\nmode: enforce\r\nmx: mx1.example.com\r\nmx: *.Example.net\r\nmax_age: 604800\r\nunknown: ignored\r\n")
+	if policy.Mode != "enforce" || policy.MaxAge != 604800 || !reflect.DeepEqual(policy.MX, []string{"mx1.example.com", "*.example.net"}) || len(policy.Advice) != 0 {
+		t.Errorf("found %+v, want an enforced policy for mx1.example.com and *.example.net", policy)
+	}
+
+	// the fields can be separated by bare newlines too
+	if policy = parseMTASTSPolicy("version: STSv1\nmode: testing\nmx: *.example.com\nmax_age: 3600\n"); policy.Mode != "testing" || len(policy.Advice) != 1 || !strings.Contains(policy.Advice[0], "Your MTA-STS policy's max_age of 3600 seconds is under a day") {
+		t.Errorf("found %+v, want a testing policy with the short max_age advice", policy)
+	}
+
+	invalid := map[string]string{
+		"mode: enforce\nmx: *.example.com\nmax_age: 604800":                   "version must be STSv1",
+		"version: STSv1\nmode: enforcing\nmx: *.example.com\nmax_age: 604800": "mode must be enforce, testing or none",
+		"version: STSv1\nmode: enforce\nmx: *.example.com\nmax_age: forever":  "max_age must be a number of seconds",
+		"version: STSv1\nmode: enforce\nmx: *.example.com\nmax_age: 99999999": "max_age must be a number of seconds",
+	}
+
+	for body, expected := range invalid {
+		policy := parseMTASTSPolicy(body)
+		if policy.Mode != "" || len(policy.Advice) != 1 || !strings.Contains(policy.Advice[0], expected) {
+			t.Errorf("found %+v for %q, want an invalid policy whose %s", policy, body, expected)
+		}
+	}
+}
+
+func TestValidMTASTSID(t *testing.T) {
+	for record, expected := range map[string]bool{
+		"v=STSv1; id=2024-01-01":                 false,
+		"v=STSv1; id=20240101000000;":            true,
+		"v=STSv1;id=abc":                         true,
+		"v=STSv1; id=":                           false,
+		"v=STSv1":                                false,
+		"v=STSv1; id=" + strings.Repeat("a", 33): false,
+	} {
+		if found := validMTASTSID(record); found != expected {
+			t.Errorf("found %v for %q, want %v", found, record, expected)
+		}
+	}
+}
+
+func TestCertificateProblem(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{
+			err:      fmt.Errorf("tls: %w", x509.HostnameError{Certificate: &x509.Certificate{DNSNames: []string{"mail.other.net"}}, Host: "mx1.example.com"}),
+			expected: "its certificate isn't valid for mx1.example.com (it's for mail.other.net)",
+		},
+		{
+			err:      x509.HostnameError{Certificate: &x509.Certificate{Subject: pkix.Name{CommonName: "mail.other.net"}}, Host: "mx1.example.com"},
+			expected: "its certificate isn't valid for mx1.example.com (it's for mail.other.net)",
+		},
+		{
+			err:      x509.HostnameError{Certificate: &x509.Certificate{DNSNames: []string{"a.net", "b.net", "c.net", "d.net"}}, Host: "mx1.example.com"},
+			expected: "its certificate isn't valid for mx1.example.com (it's for a.net, b.net, c.net, others)",
+		},
+		{
+			err:      x509.UnknownAuthorityError{},
+			expected: "its certificate isn't issued by a trusted certificate authority",
+		},
+		{
+			err:      x509.CertificateInvalidError{Reason: x509.Expired},
+			expected: "its certificate has expired (or isn't valid yet)",
+		},
+	}
+
+	for _, test := range tests {
+		if problem, ok := certificateProblem(test.err); !ok || problem != test.expected {
+			t.Errorf("found %q, want %q", problem, test.expected)
+		}
+	}
+
+	if problem, ok := certificateProblem(fmt.Errorf("connection reset")); ok {
+		t.Errorf("found %q, want no certificate problem", problem)
+	}
+}
+
+func TestAdvisor_CheckMTASTS(t *testing.T) {
+	const (
+		testingPolicy = "version: STSv1\nmode: testing\nmx: *.example.com\nmax_age: 604800\n"
+		enforcePolicy = "version: STSv1\nmode: enforce\nmx: *.example.com\nmax_age: 604800\n"
+		record        = "v=STSv1; id=20240101"
+	)
+
+	policies := map[string]string{
+		"mta-sts.testing.example":  testingPolicy,
+		"mta-sts.enforce.example":  enforcePolicy,
+		"mta-sts.none.example":     "version: STSv1\nmode: none\nmax_age: 86400\n",
+		"mta-sts.invalid.example":  "version: STSv2\nmode: enforce\nmx: *.example.com\nmax_age: 604800\n",
+		"mta-sts.html.example":     enforcePolicy,
+		"mta-sts.redirect.example": enforcePolicy,
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/.well-known/mta-sts.txt":
+			http.NotFound(w, r)
+		case r.Host == "mta-sts.redirect.example" && r.URL.RawQuery != "":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(enforcePolicy))
+		case r.Host == "mta-sts.redirect.example":
+			http.Redirect(w, r, "/.well-known/mta-sts.txt?moved", http.StatusFound)
+		case policies[r.Host] == "":
+			http.NotFound(w, r)
+		case r.Host == "mta-sts.html.example":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(policies[r.Host]))
+		default:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(policies[r.Host]))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	// every policy host is served by the test server, whose certificate is for example.com
+	client := server.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.ServerName = "example.com"
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	advisor := NewAdvisor(time.Second, time.Minute, false, WithHTTPClient(client), WithHTTPRetry(1, 0))
+	t.Cleanup(advisor.Close)
+
+	// seed the cache so no connections are made to the mail servers
+	advisor.tlsCacheMailCerts.Set("mx1.example.com", &mailCertificate{checked: true})
+	advisor.tlsCacheMailCerts.Set("mx2.example.com", &mailCertificate{checked: true, problem: "its certificate isn't valid for mx2.example.com (it's for mail.other.net)"})
+	advisor.tlsCacheMailCerts.Set("mx3.example.com", &mailCertificate{reason: "Failed to reach domain before timeout."})
+
+	passes := "mx1.example.com matches mx: *.example.com in your MTA-STS policy, and presents a valid certificate for it, so it passes the policy."
+
+	tests := []struct {
+		name       string
+		domain     string
+		records    []string
+		mx         []string
+		expected   []string
+		severities []Severity
+	}{
+		{
+			name:    "NotLookedUp",
+			domain:  "testing.example",
+			records: nil,
+		},
+		{
+			name:       "NoRecord",
+			domain:     "testing.example",
+			records:    []string{},
+			expected:   []string{"Your domain doesn't publish an MTA-STS record at _mta-sts.testing.example, so senders don't require TLS when delivering its mail, and it can be downgraded to plaintext in transit."},
+			severities: []Severity{SeverityLow},
+		},
+		{
+			name:       "TwoRecords",
+			domain:     "testing.example",
+			records:    []string{record, "v=STSv1; id=2"},
+			expected:   []string{"Your domain publishes 2 MTA-STS records at _mta-sts.testing.example, so senders ignore your MTA-STS policy. Merge them into a single record."},
+			severities: []Severity{SeverityMedium},
+		},
+		{
+			name:    "TestingPasses",
+			domain:  "testing.example",
+			records: []string{record},
+			mx:      []string{"mx1.example.com."},
+			expected: []string{
+				passes,
+				"Every one of your mail servers passes your MTA-STS policy, so you can move it from mode: testing to mode: enforce.",
+			},
+			severities: []Severity{SeverityInfo, SeverityLow},
+		},
+		{
+			name:    "TestingFails",
+			domain:  "testing.example",
+			records: []string{"v=STSv1"},
+			mx:      []string{"mx1.example.com.", "mx2.example.com.", "mx.other.net.", "mx3.example.com."},
+			expected: []string{
+				"Your MTA-STS record has no valid id= tag (of up to 32 letters and digits), so senders can't tell when your policy changes. Add one, and change it whenever the policy does.",
+				passes,
+				"mx2.example.com would be rejected under mode: enforce, as its certificate isn't valid for mx2.example.com (it's for mail.other.net).",
+				"mx.other.net would be rejected under mode: enforce, as it doesn't match any of the mx patterns in your MTA-STS policy (mx: *.example.com). Add mx: mx.other.net (or a wildcard covering it) to the policy.",
+				"mx3.example.com matches mx: *.example.com in your MTA-STS policy, but its certificate couldn't be checked: Failed to reach domain before timeout.",
+			},
+			severities: []Severity{SeverityMedium, SeverityInfo, SeverityMedium, SeverityMedium, SeverityInfo},
+		},
+		{
+			name:       "EnforcePasses",
+			domain:     "enforce.example",
+			records:    []string{record},
+			mx:         []string{"mx1.example.com."},
+			expected:   []string{passes, "Your MTA-STS policy is enforced, and every one of your mail servers passes it. No further action needed."},
+			severities: []Severity{SeverityInfo, SeverityInfo},
+		},
+		{
+			name:    "EnforceFails",
+			domain:  "enforce.example",
+			records: []string{record},
+			mx:      []string{"mx2.example.com."},
+			expected: []string{
+				"mx2.example.com is rejected by senders enforcing your MTA-STS policy, as its certificate isn't valid for mx2.example.com (it's for mail.other.net).",
+			},
+			severities: []Severity{SeverityHigh},
+		},
+		{
+			name:       "None",
+			domain:     "none.example",
+			records:    []string{record},
+			mx:         []string{"mx.other.net."},
+			expected:   []string{"Your MTA-STS policy is in mode: none, so senders treat your domain as having no policy, and it wasn't checked against your mail servers."},
+			severities: []Severity{SeverityInfo},
+		},
+		{
+			name:       "Invalid",
+			domain:     "invalid.example",
+			records:    []string{record},
+			mx:         []string{"mx1.example.com."},
+			expected:   []string{"Your MTA-STS policy's version must be STSv1, so senders ignore your MTA-STS policy."},
+			severities: []Severity{SeverityMedium},
+		},
+		{
+			name:       "Missing",
+			domain:     "missing.example",
+			records:    []string{record},
+			mx:         []string{"mx1.example.com."},
+			expected:   []string{"Your MTA-STS policy couldn't be fetched from https://mta-sts.missing.example/.well-known/mta-sts.txt, as it returned 404 Not Found, so senders ignore your MTA-STS record."},
+			severities: []Severity{SeverityMedium},
+		},
+		{
+			name:       "ContentType",
+			domain:     "html.example",
+			records:    []string{record},
+			mx:         []string{"mx1.example.com."},
+			expected:   []string{"Your MTA-STS policy couldn't be fetched from https://mta-sts.html.example/.well-known/mta-sts.txt, as it's served as \"text/html\" rather than text/plain, so senders ignore your MTA-STS record."},
+			severities: []Severity{SeverityMedium},
+		},
+		{
+			name:       "Redirect",
+			domain:     "redirect.example",
+			records:    []string{record},
+			mx:         []string{"mx1.example.com."},
+			expected:   []string{"Your MTA-STS policy couldn't be fetched from https://mta-sts.redirect.example/.well-known/mta-sts.txt, as it redirects to https://mta-sts.redirect.example/.well-known/mta-sts.txt?moved, which senders don't follow, so senders ignore your MTA-STS record."},
+			severities: []Severity{SeverityMedium},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice, err := advisor.CheckMTASTS(context.Background(), test.domain, test.records, test.mx)
+			if err != nil {
+				t.Fatalf("found %v, want no error", err)
+			}
+
+			if !reflect.DeepEqual(advice, test.expected) {
+				t.Fatalf("found %v, want %v", advice, test.expected)
+			}
+
+			for index, line := range advice {
+				if severity := Classify(line); severity != test.severities[index] {
+					t.Errorf("found %v for %q, want %v", severity, line, test.severities[index])
+				}
+			}
+		})
+	}
+
+	t.Run("Offline", func(t *testing.T) {
+		advice, _ := NewAdvisor(time.Second, time.Minute, false, WithOffline(true)).CheckMTASTS(context.Background(), "testing.example", []string{record}, []string{"mx1.example.com."})
+		if len(advice) != 1 || !strings.Contains(advice[0], offlinePhrase) {
+			t.Errorf("found %v, want the offline advice", advice)
+		}
+	})
+}
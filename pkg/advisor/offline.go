@@ -0,0 +1,20 @@
+package advisor
+
+// offlinePhrase marks the advice of every check skipped in offline mode, so
+// it isn't mistaken for a failure.
+const offlinePhrase = "skipped: offline mode"
+
+// WithOffline skips every check that needs an outbound connection (the TLS
+// probes, BIMI asset downloads, MTA-STS policy checks, and certificate
+// transparency and RDAP lookups), for networks without internet access.
+// Skipped checks are reported as such, rather than as failed connections.
+func WithOffline(offline bool) Option {
+	return func(a *Advisor) {
+		a.offline = offline
+	}
+}
+
+// skippedOffline returns the advice for a check skipped in offline mode.
+func skippedOffline(check string) string {
+	return check + " was " + offlinePhrase + "."
+}
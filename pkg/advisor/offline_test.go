@@ -0,0 +1,45 @@
+package advisor
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_Offline(t *testing.T) {
+	// any connection attempt panics, failing the test
+	advisor := NewAdvisor(time.Second, time.Second, true, WithOffline(true), WithDialer(panickingDialer{}), WithHTTPClient(&http.Client{Transport: panickingTransport{}}), WithCertificateTransparency(""), WithRDAP("", 0))
+	defer advisor.Close()
+
+	bimi := "v=BIMI1; l=https://bimi.example.com/logo.svg; a=https://bimi.example.com/cert.pem"
+	advice := advisor.CheckAllContext(context.Background(), "example.com", bimi, "v=DKIM1; k=rsa; p=KEY", "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", []string{"mx1.example.com.", "mx2.example.com."}, "v=spf1 -all")
+	certificates, report := advisor.CheckCertificates(context.Background(), "example.com", nil)
+	registration, _ := advisor.CheckRegistration(context.Background(), "example.com")
+
+	for name, expected := range map[string][]string{
+		"bimi":         {"Your BIMI record looks good! No further action needed.", "The download of your SVG logo was skipped: offline mode.", "The download of your VMC certificate was skipped: offline mode."},
+		"certificates": {"The certificate transparency check was skipped: offline mode."},
+		"domain":       {"The TLS check of your domain was skipped: offline mode."},
+		"registration": {"The registration check of your domain was skipped: offline mode."},
+		"mx":           {"You have multiple mail servers setup, which is recommended.", "The TLS check of your mail servers was skipped: offline mode."},
+	} {
+		found := map[string][]string{"bimi": advice.BIMI, "certificates": certificates, "domain": advice.Domain, "mx": advice.MX, "registration": registration}[name]
+
+		if strings.Join(found, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("found %v for %s, want %v", found, name, expected)
+		}
+
+		// skipped checks haven't failed
+		for _, line := range found {
+			if severity := Classify(line); severity != SeverityInfo {
+				t.Errorf("found %v for %q, want %v", severity, line, SeverityInfo)
+			}
+		}
+	}
+
+	if report != nil {
+		t.Errorf("found %v, want no certificate report", report)
+	}
+}
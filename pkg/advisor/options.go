@@ -0,0 +1,113 @@
+package advisor
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HostResolver resolves the addresses and MX records of hosts for the
+// advisor's checks, such as whether a DMARC report destination accepts mail,
+// and which addresses a mail server is probed at. It's satisfied by
+// *net.Resolver.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// WithDetailed keeps per-host advice lines (such as the TLS version of each
+// mail server) rather than collapsing them into a single summary line.
+func WithDetailed(detailed bool) Option {
+	return func(a *Advisor) {
+		a.detailed = detailed
+	}
+}
+
+// WithDKIMRotationAge sets how many months old a DKIM key (as inferred from
+// the date in its selector) can be before rotating it is suggested. The
+// default is 12 months, and 0 disables the suggestion.
+func WithDKIMRotationAge(months int) Option {
+	return func(a *Advisor) {
+		a.dkimRotationMonths = months
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to fetch remote assets, such as
+// BIMI logos and VMC certificates.
+func WithHTTPClient(client *http.Client) Option {
+	return func(a *Advisor) {
+		if client != nil {
+			a.httpClient = client
+		}
+	}
+}
+
+// WithCheckTimeout sets the maximum duration of each check run by
+// CheckAllInput, after which the check is abandoned and reported as timed
+// out. A duration of 0 (the default) relies solely on the context's deadline.
+func WithCheckTimeout(timeout time.Duration) Option {
+	return func(a *Advisor) {
+		a.checkTimeout = timeout
+	}
+}
+
+// WithDialer sets the dialer used to open outbound connections for the TLS
+// checks and remote asset fetches.
+func WithDialer(dialer Dialer) Option {
+	return func(a *Advisor) {
+		if dialer != nil {
+			a.dialer = dialer
+		}
+	}
+}
+
+// WithDialerMiddleware wraps the dialer used for every outbound connection,
+// such as to record or instrument connections. It wraps the dialer set with
+// WithDialer regardless of option order, and multiple middlewares wrap it in
+// the order they're given.
+func WithDialerMiddleware(wrap func(next Dialer) Dialer) Option {
+	return func(a *Advisor) {
+		if wrap != nil {
+			a.dialerMiddleware = append(a.dialerMiddleware, wrap)
+		}
+	}
+}
+
+// WithHostResolver sets the resolver used to look up the addresses and MX
+// records of hosts, replacing net.DefaultResolver.
+func WithHostResolver(resolver HostResolver) Option {
+	return func(a *Advisor) {
+		if resolver != nil {
+			a.lookupHost, a.lookupMX = resolver.LookupHost, resolver.LookupMX
+		}
+	}
+}
+
+// WithRootCAs sets the certificate authorities trusted when probing the TLS
+// of web and mail servers, replacing the system's. The HTTP client's are set
+// on the client itself (see WithHTTPClient).
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(a *Advisor) {
+		a.rootCAs = pool
+	}
+}
+
+// WithProbeReuse keeps the result of every TLS probe (and each probed host's
+// resolved addresses) for the advisor's lifetime, rather than only for the
+// cache lifetime. This suits bulk scans, where the same mail servers are
+// shared by thousands of domains, but not long-running servers.
+func WithProbeReuse(reuse bool) Option {
+	return func(a *Advisor) {
+		a.probes.retain = reuse
+	}
+}
+
+// WithProxy routes the advisor's outbound connections through the given
+// proxies, replacing those read from the environment by default.
+func WithProxy(config ProxyConfig) Option {
+	return func(a *Advisor) {
+		a.proxy = config
+	}
+}
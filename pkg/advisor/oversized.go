@@ -0,0 +1,40 @@
+package advisor
+
+// oversizedPhrase marks the advice on a lookup whose answers exceeded the
+// scanner's limits, which replaces the lookup's advice as its records weren't
+// evaluated.
+const oversizedPhrase = "too large to evaluate"
+
+// oversizedRecords names the records of each lookup that can be too large to
+// evaluate. Any other lookup's are named after it.
+var oversizedRecords = map[string]string{
+	"addresses":     "A and AAAA records are",
+	"arc":           "ARC sealing key is",
+	"authoritative": "authoritative nameservers' answers are",
+	"bimi":          "BIMI record is",
+	"blocklists":    "SPF includes checked against the blocklists are",
+	"caa":           "CAA records are",
+	"cname":         "CNAME records are",
+	"dkim":          "DKIM key is",
+	"dmarc":         "DMARC record is",
+	"mx":            "MX records are",
+	"ns":            "NS records are",
+	"soa":           "SOA record is",
+	"spf":           "SPF record is",
+	"subdomains":    "sending subdomains' records are",
+	"txt":           "TXT records are",
+}
+
+// CheckOversized returns the advice for a lookup whose answers exceeded the
+// scanner's limits, given the limit that was exceeded, in place of the
+// lookup's own advice. Answers that large are either a misconfiguration, or
+// an attempt to exhaust whatever evaluates them, so receivers are likely to
+// fail on them too.
+func (a *Advisor) CheckOversized(lookup, reason string) []string {
+	records, ok := oversizedRecords[lookup]
+	if !ok {
+		records = lookup + " records are"
+	}
+
+	return []string{"Your " + records + " " + oversizedPhrase + ", as " + reason + ". Receivers are likely to give up on an answer this large too, so remove the records (or SPF mechanisms) you no longer need."}
+}
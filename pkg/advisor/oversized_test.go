@@ -0,0 +1,32 @@
+package advisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CheckOversized(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	tests := []struct {
+		lookup, reason string
+		expected       string
+	}{
+		{"spf", "the answer for example.com has more than 100 TXT records", "Your SPF record is too large to evaluate, as the answer for example.com has more than 100 TXT records. Receivers are likely to give up on an answer this large too, so remove the records (or SPF mechanisms) you no longer need."},
+		{"txt", "the answers for example.com exceed 32768 bytes", "Your TXT records are too large to evaluate, as the answers for example.com exceed 32768 bytes. Receivers are likely to give up on an answer this large too, so remove the records (or SPF mechanisms) you no longer need."},
+		{"subdomains", "the answers for em.example.com exceed 32768 bytes", "Your sending subdomains' records are too large to evaluate, as the answers for em.example.com exceed 32768 bytes. Receivers are likely to give up on an answer this large too, so remove the records (or SPF mechanisms) you no longer need."},
+	}
+
+	for _, test := range tests {
+		advice := advisor.CheckOversized(test.lookup, test.reason)
+		if len(advice) != 1 || advice[0] != test.expected {
+			t.Errorf("found %v, want %v", advice, []string{test.expected})
+			continue
+		}
+
+		// the records weren't evaluated, rather than found to be fine
+		if severity := Classify(advice[0]); severity != SeverityHigh {
+			t.Errorf("found %v, want %v", severity, SeverityHigh)
+		}
+	}
+}
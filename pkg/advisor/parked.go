@@ -0,0 +1,70 @@
+package advisor
+
+import (
+	"strings"
+)
+
+// CheckParked advises a parked domain (one that neither sends nor receives
+// mail), which only needs the records that stop it being used for spoofing: a
+// null MX record, an SPF record of v=spf1 -all, and a DMARC policy of reject.
+func (a *Advisor) CheckParked(dmarc string, mx []string, spf string) *Advice {
+	return &Advice{
+		Domain: []string{"Your domain appears to be parked, as it doesn't send or receive mail. Only the records that stop it being used for spoofing are checked."},
+		DMARC:  checkParkedDMARC(dmarc),
+		MX:     checkParkedMX(mx),
+		SPF:    checkParkedSPF(spf),
+	}
+}
+
+func checkParkedDMARC(record string) []string {
+	var policy, subdomainPolicy string
+
+	for _, part := range strings.Split(record, ";") {
+		keyValue := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+
+		switch keyValue[0] {
+		case "p":
+			policy = keyValue[1]
+		case "sp":
+			subdomainPolicy = keyValue[1]
+		}
+	}
+
+	switch {
+	case !strings.HasPrefix(record, "v=DMARC1"):
+		return []string{"Your domain doesn't send mail, so it should publish a DMARC record of v=DMARC1; p=reject; to have receivers reject any mail claiming to be from it."}
+	case policy != "reject":
+		return []string{"Your domain doesn't send mail, so your DMARC policy should be p=reject to have receivers reject any mail claiming to be from it."}
+	case subdomainPolicy != "" && subdomainPolicy != "reject":
+		return []string{"Your domain doesn't send mail, so your DMARC subdomain policy should be sp=reject (or removed, to inherit p=reject)."}
+	}
+
+	return []string{"Your DMARC policy rejects all mail claiming to be from your domain, no further action needed."}
+}
+
+func checkParkedMX(mx []string) []string {
+	if len(mx) == 1 && strings.TrimSpace(mx[0]) == "." {
+		return []string{"Your null MX record tells senders that your domain doesn't receive mail, no further action needed."}
+	}
+
+	if len(mx) > 1 {
+		for _, serverAddress := range mx {
+			if strings.TrimSpace(serverAddress) == "." {
+				return []string{"Your null MX record must be the only MX record for your domain, otherwise it's ignored."}
+			}
+		}
+	}
+
+	return []string{"Your domain doesn't receive mail, so it should publish a null MX record (0 .) to tell senders not to attempt delivery."}
+}
+
+func checkParkedSPF(spf string) []string {
+	if strings.Join(strings.Fields(spf), " ") == "v=spf1 -all" {
+		return []string{"Your SPF record doesn't authorize anyone to send mail for your domain, no further action needed."}
+	}
+
+	return []string{"Your domain doesn't send mail, so your SPF record should be exactly v=spf1 -all to stop anyone sending mail on its behalf."}
+}
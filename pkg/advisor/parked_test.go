@@ -0,0 +1,53 @@
+package advisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CheckParked(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, true, WithDialer(panickingDialer{}))
+
+	t.Run("LockedDown", func(t *testing.T) {
+		advice := advisor.CheckParked("v=DMARC1; p=reject;", []string{"."}, "v=spf1 -all")
+
+		for _, finding := range advice.Findings() {
+			if finding.Severity != SeverityInfo {
+				t.Errorf("found %v finding %q for %s, want only informational advice", finding.Severity, finding.Message, finding.Check)
+			}
+		}
+
+		if advice.BIMI != nil || advice.DKIM != nil {
+			t.Errorf("found %v, want no BIMI or DKIM advice for a parked domain", advice)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		advice := advisor.CheckParked("", nil, "")
+
+		expected := map[string]Severity{"dmarc": SeverityHigh, "mx": SeverityMedium, "spf": SeverityHigh}
+		for _, finding := range advice.Findings() {
+			if severity, ok := expected[finding.Check]; ok && finding.Severity != severity {
+				t.Errorf("found %v for %q, want %v", finding.Severity, finding.Message, severity)
+			}
+		}
+	})
+
+	t.Run("Weak", func(t *testing.T) {
+		tests := []struct {
+			advice   []string
+			expected string
+		}{
+			{checkParkedDMARC("v=DMARC1; p=none;"), "Your domain doesn't send mail, so your DMARC policy should be p=reject to have receivers reject any mail claiming to be from it."},
+			{checkParkedDMARC("v=DMARC1; p=reject; sp=none;"), "Your domain doesn't send mail, so your DMARC subdomain policy should be sp=reject (or removed, to inherit p=reject)."},
+			{checkParkedMX([]string{".", "mx.example.com."}), "Your null MX record must be the only MX record for your domain, otherwise it's ignored."},
+			{checkParkedSPF("v=spf1 ~all"), "Your domain doesn't send mail, so your SPF record should be exactly v=spf1 -all to stop anyone sending mail on its behalf."},
+		}
+
+		for _, test := range tests {
+			if len(test.advice) != 1 || test.advice[0] != test.expected {
+				t.Errorf("found %v, want %q", test.advice, test.expected)
+			}
+		}
+	})
+}
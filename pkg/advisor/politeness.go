@@ -0,0 +1,223 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// deferredPhrase marks the advice of mail servers that deferred a probe,
+	// which says nothing about the server's TLS.
+	deferredPhrase = "Temporarily deferred by server"
+
+	// minSMTPCooldown is how long a mail server that deferred a probe is
+	// skipped for, doubling each time it defers again up to maxSMTPCooldown.
+	minSMTPCooldown = 5 * time.Minute
+	maxSMTPCooldown = time.Hour
+)
+
+// deferralPhrases identify replies (other than 421) that refuse a connection
+// because of the number of connections, such as "554 Too many connections".
+var deferralPhrases = []string{"too many connections", "too many concurrent", "connection rate limit", "try again later"}
+
+type (
+	// smtpPoliteness paces the SMTP probes of a run, so bulk scans don't trip
+	// the connection limits of mail providers: it caps the number of
+	// concurrent connections, spaces out connections to the same host, and
+	// skips hosts that recently deferred a probe.
+	smtpPoliteness struct {
+		hosts    map[string]*smtpHost
+		mutex    sync.Mutex
+		now      func() time.Time
+		slots    chan struct{}
+		interval time.Duration
+	}
+
+	// smtpHost holds the bookkeeping of a single mail server.
+	smtpHost struct {
+		// next is the earliest time the next connection to the host may start.
+		next time.Time
+
+		// deferredUntil is when the host's cooldown ends, after it last
+		// deferred a probe, and cooldown is how long that cooldown was.
+		deferredUntil time.Time
+		cooldown      time.Duration
+	}
+)
+
+func newSMTPPoliteness(interval time.Duration, maxConnections int) *smtpPoliteness {
+	politeness := &smtpPoliteness{
+		hosts:    make(map[string]*smtpHost),
+		now:      time.Now,
+		interval: interval,
+	}
+
+	if maxConnections > 0 {
+		politeness.slots = make(chan struct{}, maxConnections)
+	}
+
+	return politeness
+}
+
+// WithSMTPPoliteness spaces out the SMTP probes of each mail server by at
+// least the given interval, and caps the number of SMTP connections open at
+// once across every server (0 leaves it uncapped). Neither is set by default.
+// Servers that defer a probe (such as with a 421 reply) are skipped for a
+// cooldown either way.
+func WithSMTPPoliteness(interval time.Duration, maxConnections int) Option {
+	return func(a *Advisor) {
+		a.smtp = newSMTPPoliteness(interval, maxConnections)
+	}
+}
+
+// acquire waits for one of the SMTP connection slots, returning a function
+// that releases it. It returns an error if the context is done first.
+func (p *smtpPoliteness) acquire(ctx context.Context) (func(), error) {
+	if p.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return func() { <-p.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// wait waits until a connection to the host may start, reserving the start
+// time so concurrent connections to it are spaced out in turn. It returns an
+// error if the context is done first.
+func (p *smtpPoliteness) wait(ctx context.Context, hostname string) error {
+	if p.interval <= 0 {
+		return nil
+	}
+
+	p.mutex.Lock()
+	host := p.host(hostname)
+
+	start := p.now()
+	if host.next.After(start) {
+		start = host.next
+	}
+
+	host.next = start.Add(p.interval)
+	delay := start.Sub(p.now())
+	p.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deferred returns how long remains of the host's cooldown, if it's in one.
+func (p *smtpPoliteness) deferred(hostname string) (time.Duration, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	host, ok := p.hosts[hostname]
+	if !ok {
+		return 0, false
+	}
+
+	remaining := host.deferredUntil.Sub(p.now())
+
+	return remaining, remaining > 0
+}
+
+// deferHost starts a cooldown for the host, twice as long as its previous one
+// (if it hasn't probed successfully since), and returns its duration.
+func (p *smtpPoliteness) deferHost(hostname string) time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	host := p.host(hostname)
+	host.cooldown = min(max(2*host.cooldown, minSMTPCooldown), maxSMTPCooldown)
+	host.deferredUntil = p.now().Add(host.cooldown)
+
+	return host.cooldown
+}
+
+// succeeded resets the host's cooldown, as it accepted a probe.
+func (p *smtpPoliteness) succeeded(hostname string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if host, ok := p.hosts[hostname]; ok {
+		host.cooldown = 0
+		host.deferredUntil = time.Time{}
+	}
+}
+
+// host returns the bookkeeping of the host, creating it if needed. The mutex
+// must be held.
+func (p *smtpPoliteness) host(hostname string) *smtpHost {
+	host, ok := p.hosts[hostname]
+	if !ok {
+		host = &smtpHost{}
+		p.hosts[hostname] = host
+	}
+
+	return host
+}
+
+// parseDeferral returns the reply of a mail server that deferred the
+// connection because of the number of connections (or their rate), such as
+// "421 4.7.0 Too many connections", and whether it did.
+func parseDeferral(err error) (string, bool) {
+	var reply *textproto.Error
+	if !errors.As(err, &reply) {
+		return "", false
+	}
+
+	formatted := formatReply(reply)
+
+	if reply.Code == 421 {
+		return formatted, true
+	}
+
+	if reply.Code >= 400 && reply.Code < 600 {
+		lowered := strings.ToLower(formatted)
+
+		for _, phrase := range deferralPhrases {
+			if strings.Contains(lowered, phrase) {
+				return formatted, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// deferredAdvice returns the advice for a mail server that deferred a probe
+// with the given reply (or earlier, if reply is empty), which won't be probed
+// again until its cooldown ends.
+func deferredAdvice(reply string, cooldown time.Duration) string {
+	cooldown = cooldown.Round(time.Second)
+
+	if reply == "" {
+		return fmt.Sprintf("%s, so its TLS wasn't checked. It won't be probed again for %s.", deferredPhrase, cooldown)
+	}
+
+	return fmt.Sprintf("%s (%s), so its TLS wasn't checked. It won't be probed again for %s.", deferredPhrase, reply, cooldown)
+}
+
+// isDeferred returns whether the advice is that of a deferred mail server.
+func isDeferred(advice []string) bool {
+	return len(advice) == 1 && strings.HasPrefix(advice[0], deferredPhrase)
+}
@@ -0,0 +1,262 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptedSMTPServer answers every connection with the reply its script
+// returns for the connection's index, then closes it, tracking how many
+// connections were open at once.
+type scriptedSMTPServer struct {
+	listener    net.Listener
+	script      func(index int) string
+	hold        time.Duration
+	connections atomic.Int32
+	open        atomic.Int32
+	maxOpen     atomic.Int32
+}
+
+func newScriptedSMTPServer(t *testing.T, hold time.Duration, script func(index int) string) *scriptedSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &scriptedSMTPServer{listener: listener, script: script, hold: hold}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(conn, int(server.connections.Add(1))-1)
+		}
+	}()
+
+	return server
+}
+
+func (s *scriptedSMTPServer) serve(conn net.Conn, index int) {
+	defer conn.Close()
+
+	open := s.open.Add(1)
+	defer s.open.Add(-1)
+
+	for {
+		current := s.maxOpen.Load()
+		if open <= current || s.maxOpen.CompareAndSwap(current, open) {
+			break
+		}
+	}
+
+	time.Sleep(s.hold)
+	_, _ = conn.Write([]byte(s.script(index) + "\r\n"))
+}
+
+// DialContext connects every address to the server.
+func (s *scriptedSMTPServer) DialContext(ctx context.Context, network, _ string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, s.listener.Addr().String())
+}
+
+func TestParseDeferral(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+		deferred bool
+	}{
+		{name: "421", err: &textproto.Error{Code: 421, Msg: "4.7.0 mx.example.com Service not available,\n closing transmission channel"}, expected: "421 4.7.0 mx.example.com Service not available, closing transmission channel", deferred: true},
+		{name: "TooManyConnections", err: &textproto.Error{Code: 554, Msg: "5.7.1 Too many connections from your IP"}, expected: "554 5.7.1 Too many connections from your IP", deferred: true},
+		{name: "TryAgainLater", err: &textproto.Error{Code: 451, Msg: "Temporary local problem - please try again later"}, expected: "451 Temporary local problem - please try again later", deferred: true},
+		{name: "Rejected", err: &textproto.Error{Code: 554, Msg: "5.7.1 Client host rejected"}},
+		{name: "Greeting", err: &textproto.Error{Code: 220, Msg: "too many connections are welcome here"}},
+		{name: "NotAReply", err: errors.New("421 too many connections")},
+		{name: "Wrapped", err: errors.Join(errors.New("greeting"), &textproto.Error{Code: 421, Msg: "busy"}), expected: "421 busy", deferred: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reply, deferred := parseDeferral(test.err)
+
+			if reply != test.expected || deferred != test.deferred {
+				t.Errorf("found %q and %v, want %q and %v", reply, deferred, test.expected, test.deferred)
+			}
+		})
+	}
+}
+
+func TestSMTPPoliteness_Cooldown(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	politeness := newSMTPPoliteness(0, 0)
+	politeness.now = func() time.Time { return now }
+
+	if _, ok := politeness.deferred("mx.example.com"); ok {
+		t.Error("found an unknown host deferred")
+	}
+
+	// each consecutive deferral doubles the cooldown, up to the maximum
+	for _, expected := range []time.Duration{5 * time.Minute, 10 * time.Minute, 20 * time.Minute, 40 * time.Minute, time.Hour, time.Hour} {
+		if cooldown := politeness.deferHost("mx.example.com"); cooldown != expected {
+			t.Errorf("found a cooldown of %v, want %v", cooldown, expected)
+		}
+	}
+
+	now = now.Add(59 * time.Minute)
+	if remaining, ok := politeness.deferred("mx.example.com"); !ok || remaining != time.Minute {
+		t.Errorf("found %v remaining (deferred: %v), want 1m0s", remaining, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := politeness.deferred("mx.example.com"); ok {
+		t.Error("found the host deferred after its cooldown ended")
+	}
+
+	// other hosts aren't affected
+	if _, ok := politeness.deferred("mx2.example.com"); ok {
+		t.Error("found another host deferred")
+	}
+
+	// a successful probe resets the backoff
+	politeness.deferHost("mx.example.com")
+	politeness.succeeded("mx.example.com")
+
+	if _, ok := politeness.deferred("mx.example.com"); ok {
+		t.Error("found the host deferred after a successful probe")
+	}
+
+	if cooldown := politeness.deferHost("mx.example.com"); cooldown != minSMTPCooldown {
+		t.Errorf("found a cooldown of %v, want %v", cooldown, minSMTPCooldown)
+	}
+}
+
+func TestSMTPPoliteness_Interval(t *testing.T) {
+	const interval = 30 * time.Millisecond
+
+	politeness := newSMTPPoliteness(interval, 0)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := politeness.wait(context.Background(), "mx.example.com"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// connections to other hosts aren't held up
+	if err := politeness.wait(context.Background(), "mx2.example.com"); err != nil || time.Since(start) >= interval {
+		t.Errorf("found %v after %v, want another host's connection to start immediately", err, time.Since(start))
+	}
+
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 2*interval {
+		t.Errorf("took %v, want three connections to the same host to be spaced %v apart", elapsed, interval)
+	}
+
+	// waiting is abandoned with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := politeness.wait(ctx, "mx.example.com"); !errors.Is(err, context.Canceled) {
+		t.Errorf("found %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestAdvisor_SMTPDeferral(t *testing.T) {
+	server := newScriptedSMTPServer(t, 0, func(index int) string {
+		return "421 4.7.0 Too many connections, try again later"
+	})
+
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(server), WithProxy(ProxyConfig{}))
+	defer advisor.Close()
+
+	mx := []string{"mx1.example.com."}
+
+	advice := advisor.CheckMX(mx)
+	expected := "mx1.example.com: Temporarily deferred by server (421 4.7.0 Too many connections, try again later), so its TLS wasn't checked. It won't be probed again for 5m0s."
+
+	if len(advice) != 2 || advice[1] != expected {
+		t.Fatalf("found %v, want %q", advice, expected)
+	}
+
+	if severity := Classify(advice[1]); severity != SeverityInfo {
+		t.Errorf("found %v, want %v", severity, SeverityInfo)
+	}
+
+	// the rest of the run skips the host, without caching the advice past its cooldown
+	advice = advisor.CheckMX(mx)
+	if len(advice) != 2 || !strings.HasPrefix(advice[1], "mx1.example.com: Temporarily deferred by server, so its TLS wasn't checked.") {
+		t.Errorf("found %v, want the host to be skipped", advice)
+	}
+
+	if connections := server.connections.Load(); connections != 1 {
+		t.Errorf("found %d connections, want 1", connections)
+	}
+
+	if cached := advisor.tlsCacheMail.Get("mx1.example.com"); cached != nil {
+		t.Errorf("found %v cached, want deferrals not to be cached", *cached)
+	}
+
+	// once the cooldown ends, the host is probed again
+	advisor.smtp.now = func() time.Time { return time.Now().Add(minSMTPCooldown) }
+	advisor.CheckMX(mx)
+
+	if connections := server.connections.Load(); connections != 2 {
+		t.Errorf("found %d connections, want the host to be probed again", connections)
+	}
+}
+
+func TestAdvisor_SMTPConnectionLimit(t *testing.T) {
+	const maxConnections = 2
+
+	server := newScriptedSMTPServer(t, 20*time.Millisecond, func(int) string {
+		return "554 5.3.2 Service currently unavailable"
+	})
+
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(server), WithProxy(ProxyConfig{}), WithSMTPPoliteness(0, maxConnections))
+	defer advisor.Close()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			_, _ = advisor.checkMailTls(context.Background(), "mx"+strconv.Itoa(i)+".example.com")
+		}()
+	}
+
+	wg.Wait()
+
+	if connections := server.connections.Load(); connections != 6 {
+		t.Errorf("found %d connections, want 6", connections)
+	}
+
+	if maxOpen := server.maxOpen.Load(); maxOpen > maxConnections {
+		t.Errorf("found %d connections open at once, want at most %d", maxOpen, maxConnections)
+	}
+}
@@ -0,0 +1,153 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultPort25Reference is the mail server the port 25 self-test connects
+	// to by default (see WithPort25SelfTest), as it reliably accepts
+	// connections from anywhere port 25 isn't blocked.
+	DefaultPort25Reference = "gmail-smtp-in.l.google.com"
+
+	// port25BlockedPhrase marks the MX advice given instead of the TLS checks of
+	// the mail servers when outbound port 25 is blocked, so it isn't mistaken
+	// for a problem with them.
+	port25BlockedPhrase = "Outbound port 25 appears blocked from the scanning host"
+)
+
+type (
+	// Port25Status is the outcome of the port 25 self-test.
+	Port25Status struct {
+		Reference string     `json:"reference" yaml:"reference" doc:"The mail server the self-test connects to." example:"gmail-smtp-in.l.google.com"`
+		Checked   bool       `json:"checked" yaml:"checked" doc:"Whether the self-test has run, which it does before the first SMTP TLS check."`
+		Blocked   bool       `json:"blocked" yaml:"blocked" doc:"Whether outbound port 25 appears blocked, in which case the SMTP TLS checks are skipped."`
+		CheckedAt *time.Time `json:"checkedAt,omitempty" yaml:"checkedAt,omitempty" doc:"When the self-test ran."`
+		Error     string     `json:"error,omitempty" yaml:"error,omitempty" doc:"Why the connection to the reference mail server failed, if it did." example:"dial tcp 192.0.2.1:25: i/o timeout"`
+	}
+
+	// port25SelfTest connects to a reference mail server the first time it's
+	// run, and holds on to the outcome from then on.
+	port25SelfTest struct {
+		mutex  sync.Mutex
+		status Port25Status
+	}
+)
+
+// WithPort25SelfTest connects to the given reference mail server (such as
+// DefaultPort25Reference) before the first SMTP TLS check, to detect whether
+// outbound port 25 is blocked from the scanning host, as it is on many cloud
+// providers. If the connection fails the way a blocked port does (timing out,
+// or being refused or unreachable), the SMTP TLS checks are skipped, and the
+// MX advice says so once, rather than reporting every mail server as
+// unreachable. The outcome is kept for the advisor's lifetime. It's disabled
+// by default, and an empty reference disables it.
+func WithPort25SelfTest(reference string) Option {
+	return func(a *Advisor) {
+		if reference == "" {
+			a.port25 = nil
+			return
+		}
+
+		a.port25 = &port25SelfTest{status: Port25Status{Reference: reference}}
+	}
+}
+
+// CheckPort25 runs the port 25 self-test, unless it already ran, returning
+// its outcome. It returns false if the self-test is disabled, or if the
+// advisor doesn't run the SMTP TLS checks it guards.
+func (a *Advisor) CheckPort25(ctx context.Context) (Port25Status, bool) {
+	if a.port25 == nil || !a.tlsEnabled(ctx) || a.isOffline(ctx) {
+		return Port25Status{}, false
+	}
+
+	return a.port25.run(ctx, a.timeout, a.dialProbe), true
+}
+
+// Port25 returns the outcome of the port 25 self-test without running it,
+// so its Checked field is false until the first SMTP TLS check. It returns
+// false if the self-test is disabled, as with CheckPort25.
+func (a *Advisor) Port25() (Port25Status, bool) {
+	if a.port25 == nil || !a.checkTLS || a.offline {
+		return Port25Status{}, false
+	}
+
+	a.port25.mutex.Lock()
+	defer a.port25.mutex.Unlock()
+
+	return a.port25.status, true
+}
+
+// port25Blocked returns whether the self-test found outbound port 25 blocked,
+// running it first if needed.
+func (a *Advisor) port25Blocked(ctx context.Context) bool {
+	status, ok := a.CheckPort25(ctx)
+	return ok && status.Blocked
+}
+
+// run connects to the reference mail server's SMTP port, unless the self-test
+// already ran. Concurrent callers wait for the first connection, which is
+// bounded by the timeout. If ctx is done before the connection completes, the
+// outcome says nothing about the port, so it isn't kept.
+func (t *port25SelfTest) run(ctx context.Context, timeout time.Duration, dial func(ctx context.Context, hostname, port string) (net.Conn, error)) Port25Status {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.status.Checked {
+		return t.status
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := dial(dialCtx, t.status.Reference, "25")
+	if err == nil {
+		conn.Close()
+	} else if ctx.Err() != nil {
+		return t.status
+	}
+
+	checkedAt := time.Now()
+	t.status.Checked, t.status.CheckedAt = true, &checkedAt
+
+	if err != nil {
+		t.status.Blocked, t.status.Error = isBlockedPort(err), err.Error()
+	}
+
+	return t.status
+}
+
+// isBlockedPort returns whether a connection failed the way it does when a
+// firewall blocks the port: by timing out (as dropped packets do), or by
+// being refused or unreachable. Failing to resolve the host, or to reach a
+// proxy, says nothing about the port.
+func isBlockedPort(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return false
+	}
+
+	var proxyErr *ProxyError
+	if errors.As(err, &proxyErr) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM)
+}
+
+// port25BlockedAdvice returns the MX advice given instead of the TLS checks of
+// the mail servers when outbound port 25 is blocked.
+func port25BlockedAdvice() string {
+	return port25BlockedPhrase + "; SMTP TLS checks skipped. This is common on cloud hosts, and says nothing about your mail servers, so run the scan from a host that can reach port 25 to check them."
+}
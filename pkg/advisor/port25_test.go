@@ -0,0 +1,135 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// port25Dialer fails every connection with err, recording the addresses it
+// was asked to dial.
+type port25Dialer struct {
+	err   error
+	dials []string
+	mutex sync.Mutex
+}
+
+func (d *port25Dialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	d.mutex.Lock()
+	d.dials = append(d.dials, address)
+	d.mutex.Unlock()
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	client, server := net.Pipe()
+	server.Close()
+
+	return client, nil
+}
+
+func TestCheckMX_Port25Blocked(t *testing.T) {
+	dialer := &port25Dialer{err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(dialer), WithProxy(ProxyConfig{}), WithPort25SelfTest("mx.reference.example"))
+
+	if status, ok := advisor.Port25(); !ok || status.Checked {
+		t.Fatalf("found %+v (%v), want an unchecked status", status, ok)
+	}
+
+	mx := []string{"mx1.example.com.", "mx2.example.com."}
+
+	// the self-test only runs once, and no mail server is probed after it fails
+	for range 2 {
+		advice := advisor.CheckMX(mx)
+		if len(advice) == 0 || advice[len(advice)-1] != port25BlockedAdvice() {
+			t.Fatalf("found %v, want it to end with %q", advice, port25BlockedAdvice())
+		}
+
+		if severity := Classify(advice[len(advice)-1]); severity != SeverityInfo {
+			t.Errorf("found %v, want %v", severity, SeverityInfo)
+		}
+	}
+
+	if len(dialer.dials) != 1 || dialer.dials[0] != "mx.reference.example:25" {
+		t.Errorf("found %v, want only the reference to be dialed", dialer.dials)
+	}
+
+	status, ok := advisor.Port25()
+	if !ok || !status.Checked || !status.Blocked || status.CheckedAt == nil || status.Error == "" {
+		t.Errorf("found %+v (%v), want a blocked status", status, ok)
+	}
+}
+
+func TestAdvisor_CheckPort25(t *testing.T) {
+	t.Run("Reachable", func(t *testing.T) {
+		advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(&port25Dialer{}), WithProxy(ProxyConfig{}), WithPort25SelfTest("mx.reference.example"))
+
+		status, ok := advisor.CheckPort25(context.Background())
+		if !ok || !status.Checked || status.Blocked || status.Error != "" {
+			t.Errorf("found %+v (%v), want a reachable status", status, ok)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		dialer := &port25Dialer{err: context.Canceled}
+		advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(dialer), WithProxy(ProxyConfig{}), WithPort25SelfTest("mx.reference.example"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// an abandoned self-test says nothing about the port, so it runs again next time
+		if status, _ := advisor.CheckPort25(ctx); status.Checked {
+			t.Errorf("found %+v, want an unchecked status", status)
+		}
+
+		advisor.CheckPort25(ctx)
+
+		if len(dialer.dials) != 2 {
+			t.Errorf("found %d dials, want 2", len(dialer.dials))
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		for name, advisor := range map[string]*Advisor{
+			"NoReference": NewAdvisor(time.Second, time.Minute, true, WithPort25SelfTest("")),
+			"NoTLSChecks": NewAdvisor(time.Second, time.Minute, false, WithPort25SelfTest("mx.reference.example")),
+			"Offline":     NewAdvisor(time.Second, time.Minute, true, WithOffline(true), WithPort25SelfTest("mx.reference.example")),
+		} {
+			if _, ok := advisor.CheckPort25(context.Background()); ok {
+				t.Errorf("%s: found an enabled self-test, want it disabled", name)
+			}
+		}
+	})
+}
+
+func TestIsBlockedPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Timeout", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+		{"DeadlineExceeded", context.DeadlineExceeded, true},
+		{"Refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{"NetworkUnreachable", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}, true},
+		{"HostUnreachable", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)}, true},
+		{"DNSTimeout", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "i/o timeout", Name: "mx.reference.example", IsTimeout: true}}, false},
+		{"NoSuchHost", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "mx.reference.example", IsNotFound: true}}, false},
+		{"Proxy", &ProxyError{Proxy: "proxy.internal:1080", Err: context.DeadlineExceeded}, false},
+		{"Other", errors.New("connection reset by peer"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if blocked := isBlockedPort(test.err); blocked != test.expected {
+				t.Errorf("found %v, want %v", blocked, test.expected)
+			}
+		})
+	}
+}
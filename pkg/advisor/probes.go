@@ -0,0 +1,154 @@
+package advisor
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+type (
+	// probeScheduler runs at most one probe per host at a time, sharing its
+	// result with every check waiting on the same host. When retaining, the
+	// results (and the host's resolved addresses) are kept for the advisor's
+	// lifetime, so each host is only probed once per run.
+	probeScheduler struct {
+		addresses map[string][]string
+		mutex     sync.Mutex
+		probes    map[string]*probe
+		retain    bool
+	}
+
+	// probe is a probe of a single host, which is done once its advice (or
+	// error) is set.
+	probe struct {
+		advice []string
+		err    error
+		done   chan struct{}
+
+		// abandoned is true if the probe's context was done before it
+		// finished, so its advice can't be shared.
+		abandoned bool
+	}
+)
+
+func newProbeScheduler() *probeScheduler {
+	return &probeScheduler{
+		addresses: make(map[string][]string),
+		probes:    make(map[string]*probe),
+	}
+}
+
+// do returns the advice of the probe with the given key, running fn if no such
+// probe is running (or has been retained). If the context is done while
+// waiting on another check's probe, the probe is abandoned and the context's
+// error returned. Probes that failed with an error aren't retained.
+func (s *probeScheduler) do(ctx context.Context, key string, fn func() ([]string, error)) ([]string, error) {
+	for {
+		s.mutex.Lock()
+
+		running, ok := s.probes[key]
+		if !ok {
+			running = &probe{done: make(chan struct{})}
+			s.probes[key] = running
+			s.mutex.Unlock()
+
+			running.advice, running.err = fn()
+			running.abandoned = ctx.Err() != nil
+
+			s.mutex.Lock()
+			// deferred probes aren't retained, so the host is probed again once its cooldown ends
+			if !s.retain || running.abandoned || running.err != nil || isDeferred(running.advice) {
+				delete(s.probes, key)
+			}
+			s.mutex.Unlock()
+
+			close(running.done)
+
+			return running.advice, running.err
+		}
+
+		s.mutex.Unlock()
+
+		select {
+		case <-running.done:
+			if !running.abandoned {
+				return running.advice, running.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// resolve returns the host's addresses, looking them up only once per run when
+// retaining. It returns nil if they can't be resolved, so the host is dialed
+// by name instead.
+func (s *probeScheduler) resolve(ctx context.Context, hostname string, lookup func(ctx context.Context, host string) ([]string, error)) []string {
+	if !s.retain {
+		return nil
+	}
+
+	addresses, _ := s.lookup(ctx, hostname, lookup)
+
+	return addresses
+}
+
+// lookup returns the host's addresses and any error looking them up. When
+// retaining, the addresses are shared with resolve, so a host that's already
+// been dialed isn't looked up again.
+func (s *probeScheduler) lookup(ctx context.Context, hostname string, lookup func(ctx context.Context, host string) ([]string, error)) ([]string, error) {
+	if !s.retain {
+		return lookup(ctx, hostname)
+	}
+
+	s.mutex.Lock()
+	addresses, ok := s.addresses[hostname]
+	s.mutex.Unlock()
+
+	if ok {
+		return addresses, nil
+	}
+
+	addresses, err := lookup(ctx, hostname)
+	if err != nil {
+		// failed lookups aren't retained, as they may be transient
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.addresses[hostname] = addresses
+	s.mutex.Unlock()
+
+	return addresses, nil
+}
+
+// dialProbe opens a connection to the given port of the host. If it's
+// overridden (see WithResolveOverrides), the override's address is dialed
+// instead. When the probes are retained and aren't proxied, the host's
+// resolved addresses are dialed in turn, so its DNS answers are reused by
+// every probe of the run.
+func (a *Advisor) dialProbe(ctx context.Context, hostname, port string) (net.Conn, error) {
+	if address, ok := a.resolveOverride(ctx, hostname, port); ok {
+		return a.probeDialer.DialContext(ctx, "tcp", net.JoinHostPort(address, port))
+	}
+
+	var addresses []string
+	if a.proxy.AllProxy == "" {
+		addresses = a.probes.resolve(ctx, hostname, a.lookupHost)
+	}
+
+	if len(addresses) == 0 {
+		return a.probeDialer.DialContext(ctx, "tcp", net.JoinHostPort(hostname, port))
+	}
+
+	var err error
+
+	for _, address := range addresses {
+		var conn net.Conn
+		if conn, err = a.probeDialer.DialContext(ctx, "tcp", net.JoinHostPort(address, port)); err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,170 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingDialer refuses every connection once released, counting the
+// addresses it was asked to dial.
+type countingDialer struct {
+	dials   map[string]int
+	mutex   sync.Mutex
+	release chan struct{}
+}
+
+func (d *countingDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	d.mutex.Lock()
+	d.dials[address]++
+	d.mutex.Unlock()
+
+	<-d.release
+
+	return nil, errors.New("connection refused")
+}
+
+func (d *countingDialer) total() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	total := 0
+	for _, count := range d.dials {
+		total += count
+	}
+
+	return total
+}
+
+func TestAdvisor_ProbeReuse(t *testing.T) {
+	const domains = 500
+
+	// both of Google's MX hosts, shared by every domain
+	mx := []string{"aspmx.l.google.com.", "alt1.aspmx.l.google.com."}
+
+	newAdvisor := func(reuse bool) (*Advisor, *countingDialer, *atomic.Int64) {
+		dialer := &countingDialer{dials: make(map[string]int), release: make(chan struct{})}
+		lookups := &atomic.Int64{}
+
+		// a mail TLS cache lifetime of 0 expires every result immediately, so only the scheduler can share them
+		advisor := NewAdvisor(time.Second, 0, true, WithCacheTTL(CacheMailTLS, 0), WithDialer(dialer), WithProbeReuse(reuse))
+		advisor.lookupHost = func(_ context.Context, host string) ([]string, error) {
+			lookups.Add(1)
+			return []string{"192.0.2." + strconv.Itoa(len(host))}, nil
+		}
+		t.Cleanup(advisor.Close)
+
+		return advisor, dialer, lookups
+	}
+
+	t.Run("Baseline", func(t *testing.T) {
+		advisor, dialer, lookups := newAdvisor(false)
+		close(dialer.release)
+
+		for i := 0; i < domains; i++ {
+			advisor.CheckMX(mx)
+		}
+
+		if total := dialer.total(); total != domains*len(mx) {
+			t.Errorf("found %d connections, want %d", total, domains*len(mx))
+		}
+
+		if lookups.Load() != 0 {
+			t.Errorf("found %d lookups, want the hosts to be dialed by name", lookups.Load())
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		advisor, dialer, _ := newAdvisor(false)
+
+		var wg sync.WaitGroup
+		results := make([][]string, domains)
+
+		for i := 0; i < domains; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+				results[i], _ = advisor.checkMailTls(context.Background(), "aspmx.l.google.com")
+			}(i)
+		}
+
+		// wait for the probe to start, then give every check time to join it
+		for dialer.total() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		close(dialer.release)
+		wg.Wait()
+
+		if total := dialer.total(); total != 1 {
+			t.Errorf("found %d connections, want the concurrent probes of the host to be shared", total)
+		}
+
+		for _, result := range results[1:] {
+			if !reflect.DeepEqual(result, results[0]) {
+				t.Fatalf("found %v, want every domain to share %v", result, results[0])
+			}
+		}
+	})
+
+	t.Run("Reuse", func(t *testing.T) {
+		advisor, dialer, lookups := newAdvisor(true)
+		close(dialer.release)
+
+		for i := 0; i < domains; i++ {
+			advisor.CheckMX(mx)
+		}
+
+		var addresses []string
+		for address := range dialer.dials {
+			addresses = append(addresses, address)
+		}
+
+		sort.Strings(addresses)
+
+		// each host is probed once per run, at its resolved address
+		if expected := []string{"192.0.2.18:25", "192.0.2.23:25"}; !reflect.DeepEqual(addresses, expected) {
+			t.Errorf("found %v, want %v", addresses, expected)
+		}
+
+		if total := dialer.total(); total != len(mx) {
+			t.Errorf("found %d connections, want %d", total, len(mx))
+		}
+
+		if lookups.Load() != int64(len(mx)) {
+			t.Errorf("found %d lookups, want %d", lookups.Load(), len(mx))
+		}
+	})
+
+	t.Run("Abandoned", func(t *testing.T) {
+		advisor, dialer, _ := newAdvisor(true)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		go func() {
+			for dialer.total() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			cancel()
+			close(dialer.release)
+		}()
+
+		_, _ = advisor.checkMailTls(ctx, "aspmx.l.google.com")
+
+		// the abandoned probe's advice isn't retained, so the host is probed again
+		_, _ = advisor.checkMailTls(context.Background(), "aspmx.l.google.com")
+
+		if total := dialer.total(); total != 2 {
+			t.Errorf("found %d connections, want 2", total)
+		}
+	})
+}
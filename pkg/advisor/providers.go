@@ -0,0 +1,173 @@
+package advisor
+
+import (
+	_ "embed"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed providers.yaml
+var providersYAML []byte
+
+// knownProviders is the provider fingerprint table, loaded from providers.yaml.
+var knownProviders = mustLoadProviders(providersYAML)
+
+type (
+	// provider is a known mail provider, or managed email authentication
+	// service, with advice specific to it.
+	provider struct {
+		Name  string   `yaml:"name"`
+		MX    []string `yaml:"mx"`
+		SPF   []string `yaml:"spf"`
+		CNAME []string `yaml:"cname"`
+
+		// Envelope is the provider's own envelope domain, which it sends with
+		// by default rather than the customer's.
+		Envelope string `yaml:"envelope"`
+
+		Advice struct {
+			ARC     string `yaml:"arc"`
+			DKIM    string `yaml:"dkim"`
+			SPF     string `yaml:"spf"`
+			Managed string `yaml:"managed"`
+		} `yaml:"advice"`
+	}
+
+	// detectedProvider is a provider matched by a domain's records.
+	detectedProvider struct {
+		*provider
+
+		// sending is true if the provider is included in the SPF record, and
+		// so is likely to send the domain's mail.
+		sending bool
+	}
+)
+
+func mustLoadProviders(data []byte) []provider {
+	var table struct {
+		Providers []provider `yaml:"providers"`
+	}
+
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		panic("invalid providers.yaml: " + err.Error())
+	}
+
+	return table.Providers
+}
+
+// checkDKIM returns the DKIM advice, using the detected providers' advice if
+// the domain doesn't have a DKIM record.
+func (a *Advisor) checkDKIM(dkim string, providers []detectedProvider) []string {
+	if dkim == "" {
+		if advice := providerDKIMAdvice(providers); len(advice) > 0 {
+			return advice
+		}
+	}
+
+	return a.CheckDKIM(dkim)
+}
+
+// checkSPF returns the SPF advice, tailored to the domain's DMARC record, using
+// the detected providers' advice if the domain doesn't have an SPF record.
+func (a *Advisor) checkSPF(spf string, providers []detectedProvider, dmarcRecord *dmarc) []string {
+	if spf == "" {
+		if advice := providerSPFAdvice(providers); len(advice) > 0 {
+			return advice
+		}
+	}
+
+	return a.checkSPFRecord(spf, dmarcRecord, true)
+}
+
+// detectProviders returns the providers matching the domain's MX hosts or SPF
+// includes, in table order.
+func detectProviders(providers []provider, mx []string, spf string) []detectedProvider {
+	var includes []string
+
+	for _, mechanism := range strings.Fields(spf) {
+		for _, prefix := range []string{"include:", "+include:", "~include:", "?include:", "redirect=", "a:", "mx:"} {
+			if strings.HasPrefix(mechanism, prefix) {
+				includes = append(includes, strings.TrimPrefix(mechanism, prefix))
+			}
+		}
+	}
+
+	var detected []detectedProvider
+
+	for index := range providers {
+		knownProvider := &providers[index]
+		sending := matchesSuffix(includes, knownProvider.SPF)
+
+		if sending || matchesSuffix(mx, knownProvider.MX) {
+			detected = append(detected, detectedProvider{provider: knownProvider, sending: sending})
+		}
+	}
+
+	return detected
+}
+
+// providerNames returns the names of the given providers.
+func providerNames(providers []detectedProvider) []string {
+	var names []string
+
+	for _, detected := range providers {
+		names = append(names, detected.Name)
+	}
+
+	return names
+}
+
+// providerDKIMAdvice returns the DKIM advice of the providers that send the
+// domain's mail, or of every detected provider if none appear to send it.
+func providerDKIMAdvice(providers []detectedProvider) []string {
+	var sending, all []string
+
+	for _, detected := range providers {
+		if detected.Advice.DKIM == "" {
+			continue
+		}
+
+		advice := "We couldn't detect any active DKIM record for your domain. As you use " + detected.Name + ": " + detected.Advice.DKIM
+
+		all = append(all, advice)
+		if detected.sending {
+			sending = append(sending, advice)
+		}
+	}
+
+	if len(sending) > 0 {
+		return sending
+	}
+
+	return all
+}
+
+// providerSPFAdvice returns the SPF advice of every detected provider.
+func providerSPFAdvice(providers []detectedProvider) []string {
+	var advice []string
+
+	for _, detected := range providers {
+		if detected.Advice.SPF != "" {
+			advice = append(advice, "We couldn't detect any active SPF record for your domain. As you use "+detected.Name+": "+detected.Advice.SPF)
+		}
+	}
+
+	return advice
+}
+
+// matchesSuffix reports whether any of the hosts is, or is a subdomain of, any
+// of the suffixes.
+func matchesSuffix(hosts, suffixes []string) bool {
+	for _, host := range hosts {
+		host = normalizeDomain(host)
+
+		for _, suffix := range suffixes {
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
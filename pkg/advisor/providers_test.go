@@ -0,0 +1,93 @@
+package advisor
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_Providers(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false, WithDialer(panickingDialer{}))
+
+	t.Run("Table", func(t *testing.T) {
+		if len(knownProviders) == 0 {
+			t.Fatal("found no providers in providers.yaml")
+		}
+
+		for _, knownProvider := range knownProviders {
+			if knownProvider.Name == "" || len(knownProvider.MX)+len(knownProvider.SPF)+len(knownProvider.CNAME) == 0 {
+				t.Errorf("found provider %+v, want a name and at least one fingerprint", knownProvider)
+			}
+		}
+	})
+
+	t.Run("Hybrid", func(t *testing.T) {
+		// Proofpoint filters inbound mail in front of Microsoft 365, which sends the domain's mail
+		advice := advisor.CheckAllContext(context.Background(), "example.com", "", "", "", []string{"mx0a-001.pphosted.com.", "mx0b-001.pphosted.com."}, "")
+
+		// with only the MX to go on, the gateway's advice is all that can be given
+		if !reflect.DeepEqual(advice.Providers, []string{"Proofpoint"}) {
+			t.Errorf("found %v, want [Proofpoint]", advice.Providers)
+		}
+
+		if len(advice.DKIM) != 1 || !strings.Contains(advice.DKIM[0], "As you use Proofpoint:") {
+			t.Errorf("found %v, want the Proofpoint DKIM advice", advice.DKIM)
+		}
+
+		advice = advisor.CheckAllContext(context.Background(), "example.com", "", "", "", []string{"mx0a-001.pphosted.com."}, "v=spf1 include:spf.protection.outlook.com -all")
+
+		if expected := []string{"Microsoft 365", "Proofpoint"}; !reflect.DeepEqual(advice.Providers, expected) {
+			t.Errorf("found %v, want %v", advice.Providers, expected)
+		}
+
+		if len(advice.DKIM) != 1 || !strings.Contains(advice.DKIM[0], "As you use Microsoft 365:") {
+			t.Errorf("found %v, want only the Microsoft 365 DKIM advice", advice.DKIM)
+		}
+
+		if severity := Classify(advice.DKIM[0]); severity != SeverityMedium {
+			t.Errorf("found %v, want the provider's DKIM advice to keep the %v severity", severity, SeverityMedium)
+		}
+	})
+
+	t.Run("BothSending", func(t *testing.T) {
+		providers := detectProviders(knownProviders, []string{"mx0a-001.pphosted.com."}, "v=spf1 include:spf.protection.outlook.com include:spf-a.pphosted.com -all")
+
+		if advice := providerDKIMAdvice(providers); len(advice) != 2 {
+			t.Errorf("found %v, want the DKIM advice of both providers", advice)
+		}
+	})
+
+	t.Run("MissingSPF", func(t *testing.T) {
+		advice := advisor.CheckAllContext(context.Background(), "example.com", "", "v=DKIM1; k=rsa; p=KEY", "", []string{"aspmx.l.google.com.", "alt1.aspmx.l.google.com."}, "")
+
+		if !reflect.DeepEqual(advice.Providers, []string{"Google Workspace"}) {
+			t.Errorf("found %v, want [Google Workspace]", advice.Providers)
+		}
+
+		if len(advice.SPF) != 1 || !strings.Contains(advice.SPF[0], "include:_spf.google.com") {
+			t.Errorf("found %v, want the Google Workspace SPF advice", advice.SPF)
+		}
+
+		if severity := Classify(advice.SPF[0]); severity != SeverityCritical {
+			t.Errorf("found %v, want the provider's SPF advice to keep the %v severity", severity, SeverityCritical)
+		}
+
+		if !reflect.DeepEqual(advice.DKIM, advisor.CheckDKIM("v=DKIM1; k=rsa; p=KEY")) {
+			t.Errorf("found %v, want the existing DKIM record to be checked as usual", advice.DKIM)
+		}
+	})
+
+	t.Run("NoMatch", func(t *testing.T) {
+		advice := advisor.CheckAllContext(context.Background(), "example.com", "", "", "", []string{"mail.notgoogle.com."}, "")
+
+		if advice.Providers != nil {
+			t.Errorf("found %v, want no providers", advice.Providers)
+		}
+
+		if !reflect.DeepEqual(advice.DKIM, advisor.CheckDKIM("")) || !reflect.DeepEqual(advice.SPF, advisor.CheckSPF("")) {
+			t.Errorf("found %v, want the generic advice", advice)
+		}
+	})
+}
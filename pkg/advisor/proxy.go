@@ -0,0 +1,233 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+type (
+	// ProxyConfig routes the advisor's outbound connections through a proxy.
+	ProxyConfig struct {
+		// HTTPProxy and HTTPSProxy are used to fetch remote assets (such as BIMI
+		// logos) over HTTP and HTTPS respectively. They accept http://,
+		// https:// and socks5:// URLs.
+		HTTPProxy  string
+		HTTPSProxy string
+
+		// AllProxy is a socks5:// URL used for the TLS and SMTP probes, and for
+		// remote asset fetches if no HTTP(S) proxy is set.
+		AllProxy string
+
+		// NoProxy is a comma-separated list of hosts, domains (such as
+		// .example.com), IP addresses and CIDR ranges that bypass the proxy.
+		NoProxy string
+	}
+
+	// ProxyError reports that a proxy couldn't be reached, as opposed to the
+	// destination it was asked to connect to.
+	ProxyError struct {
+		Proxy string
+		Err   error
+	}
+
+	// proxyDialer adapts a Dialer to the dialer interfaces used by
+	// golang.org/x/net/proxy.
+	proxyDialer struct {
+		dialContext func(ctx context.Context, network, address string) (net.Conn, error)
+	}
+
+	// failedDialer returns the same error for every connection, such as when
+	// the proxy is misconfigured.
+	failedDialer struct {
+		err error
+	}
+)
+
+// ProxyConfigFromEnvironment reads the proxy configuration from the
+// HTTP_PROXY, HTTPS_PROXY, ALL_PROXY and NO_PROXY environment variables (or
+// their lowercase versions).
+func ProxyConfigFromEnvironment() ProxyConfig {
+	return ProxyConfig{
+		HTTPProxy:  getEnvAny("HTTP_PROXY", "http_proxy"),
+		HTTPSProxy: getEnvAny("HTTPS_PROXY", "https_proxy"),
+		AllProxy:   getEnvAny("ALL_PROXY", "all_proxy"),
+		NoProxy:    getEnvAny("NO_PROXY", "no_proxy"),
+	}
+}
+
+// Validate checks that each proxy URL can be used.
+func (c ProxyConfig) Validate() error {
+	for name, value := range map[string]string{"HTTP": c.HTTPProxy, "HTTPS": c.HTTPSProxy} {
+		if value == "" {
+			continue
+		}
+
+		proxyURL, err := url.Parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s proxy: %w", name, err)
+		}
+
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("invalid %s proxy: unsupported scheme %q", name, proxyURL.Scheme)
+		}
+	}
+
+	if c.AllProxy != "" {
+		proxyURL, err := url.Parse(c.AllProxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %w", err)
+		}
+
+		if proxyURL.Scheme != "socks5" && proxyURL.Scheme != "socks5h" {
+			return fmt.Errorf("invalid proxy: TLS and SMTP probes require a socks5:// proxy, not %q", proxyURL.Scheme)
+		}
+	}
+
+	return nil
+}
+
+func (e *ProxyError) Error() string {
+	return "failed to reach proxy " + e.Proxy + ": " + e.Err.Error()
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+func (d proxyDialer) Dial(network, address string) (net.Conn, error) {
+	return d.dialContext(context.Background(), network, address)
+}
+
+func (d proxyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.dialContext(ctx, network, address)
+}
+
+func (d failedDialer) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, d.err
+}
+
+// dialContext dials through the advisor's configured dialer. Failures to
+// connect to one of the configured proxies are returned as a *ProxyError.
+func (a *Advisor) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := a.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		if _, ok := a.proxyAddresses[address]; ok {
+			return nil, &ProxyError{Proxy: address, Err: err}
+		}
+	}
+
+	return conn, err
+}
+
+// httpProxy returns the proxy to use for an HTTP request, if any.
+func (a *Advisor) httpProxy() func(req *http.Request) (*url.URL, error) {
+	config := &httpproxy.Config{
+		HTTPProxy:  a.proxy.HTTPProxy,
+		HTTPSProxy: a.proxy.HTTPSProxy,
+		NoProxy:    a.proxy.NoProxy,
+	}
+
+	if config.HTTPProxy == "" {
+		config.HTTPProxy = a.proxy.AllProxy
+	}
+
+	if config.HTTPSProxy == "" {
+		config.HTTPSProxy = a.proxy.AllProxy
+	}
+
+	proxyFunc := config.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+// newProbeDialer returns the dialer used for the TLS and SMTP probes, which
+// connects through the SOCKS5 proxy (if one is configured) unless the
+// destination matches the no-proxy rules.
+func (a *Advisor) newProbeDialer() Dialer {
+	a.proxyAddresses = make(map[string]struct{})
+
+	for _, value := range []string{a.proxy.HTTPProxy, a.proxy.HTTPSProxy, a.proxy.AllProxy} {
+		if proxyURL, err := url.Parse(value); err == nil && proxyURL.Host != "" {
+			a.proxyAddresses[proxyAddress(proxyURL)] = struct{}{}
+		}
+	}
+
+	if a.proxy.AllProxy == "" {
+		return proxyDialer{dialContext: a.dialContext}
+	}
+
+	if err := a.proxy.Validate(); err != nil {
+		return failedDialer{err: err}
+	}
+
+	proxyURL, _ := url.Parse(a.proxy.AllProxy)
+
+	socksDialer, err := proxy.FromURL(proxyURL, proxyDialer{dialContext: a.dialContext})
+	if err != nil {
+		return failedDialer{err: fmt.Errorf("invalid proxy: %w", err)}
+	}
+
+	direct := proxyDialer{dialContext: a.dialContext}
+	perHost := proxy.NewPerHost(socksDialer, direct)
+
+	for _, entry := range strings.Split(a.proxy.NoProxy, ",") {
+		entry = strings.TrimSpace(entry)
+
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return direct
+		case strings.Contains(entry, "/") || net.ParseIP(entry) != nil:
+			perHost.AddFromString(entry)
+		default:
+			// as with NO_PROXY for HTTP requests, a domain also matches its subdomains
+			entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+			perHost.AddHost(entry)
+			perHost.AddZone(entry)
+		}
+	}
+
+	return perHost
+}
+
+// proxyAddress returns the host:port of a proxy URL, using the scheme's
+// default port if none is specified.
+func proxyAddress(proxyURL *url.URL) string {
+	if proxyURL.Port() != "" {
+		return proxyURL.Host
+	}
+
+	port := "80"
+
+	switch proxyURL.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+func getEnvAny(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
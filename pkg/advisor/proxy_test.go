@@ -0,0 +1,165 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingDialer refuses every connection, recording the addresses it was
+// asked to dial.
+type recordingDialer struct {
+	addresses []string
+	mutex     sync.Mutex
+}
+
+func (d *recordingDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	d.mutex.Lock()
+	d.addresses = append(d.addresses, address)
+	d.mutex.Unlock()
+
+	return nil, errors.New("connection refused")
+}
+
+// closedAddress returns a local address that nothing is listening on.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	return address
+}
+
+// startSOCKS5Server accepts SOCKS5 connections without authentication, but
+// replies to every connect request with "host unreachable".
+func startSOCKS5Server(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				// greeting: version, number of methods, methods
+				greeting := make([]byte, 2)
+				if _, err := io.ReadFull(conn, greeting); err != nil {
+					return
+				}
+
+				if _, err := io.ReadFull(conn, make([]byte, greeting[1])); err != nil {
+					return
+				}
+
+				_, _ = conn.Write([]byte{5, 0})
+
+				// request: version, command, reserved, address type (domain), length
+				request := make([]byte, 5)
+				if _, err := io.ReadFull(conn, request); err != nil {
+					return
+				}
+
+				if _, err := io.ReadFull(conn, make([]byte, int(request[4])+2)); err != nil {
+					return
+				}
+
+				_, _ = conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestAdvisor_Proxy(t *testing.T) {
+	t.Run("UnreachableSOCKSProxy", func(t *testing.T) {
+		proxyAddr := closedAddress(t)
+		advisor := NewAdvisor(time.Second, time.Second, true, WithProxy(ProxyConfig{AllProxy: "socks5://" + proxyAddr}))
+
+		// the proxy failing says nothing about the hosts, so it's an error rather than advice
+		if advice, err := advisor.checkMailTls(context.Background(), "mx.example.com"); advice != nil || ErrorKind(err) != ErrorKindEgress {
+			t.Errorf("found %v and %v, want no advice and an egress error", advice, err)
+		}
+
+		if advice, err := advisor.checkHostTLS(context.Background(), "example.com", 443); advice != nil || ErrorKind(err) != ErrorKindEgress {
+			t.Errorf("found %v and %v, want no advice and an egress error", advice, err)
+		}
+
+		var proxyErr *ProxyError
+		if _, err := advisor.checkMailTls(context.Background(), "mx.example.com"); !errors.As(err, &proxyErr) || proxyErr.Proxy != proxyAddr {
+			t.Errorf("found %v, want the proxy's error", err)
+		}
+	})
+
+	t.Run("UnreachableHost", func(t *testing.T) {
+		advisor := NewAdvisor(time.Second, time.Second, true, WithProxy(ProxyConfig{AllProxy: "socks5://" + startSOCKS5Server(t)}))
+
+		if advice, err := advisor.checkMailTls(context.Background(), "mx.example.com"); !reflect.DeepEqual(advice, []string{"Failed to reach domain"}) || err != nil {
+			t.Errorf("found %v and %v, want the host unreachable advice", advice, err)
+		}
+	})
+
+	t.Run("NoProxy", func(t *testing.T) {
+		dialer := &recordingDialer{}
+		advisor := NewAdvisor(time.Second, time.Second, true, WithDialer(dialer), WithProxy(ProxyConfig{AllProxy: "socks5://proxy.internal:1080", NoProxy: ".example.org"}))
+
+		_, _ = advisor.checkMailTls(context.Background(), "mx.example.com")
+		_, _ = advisor.checkMailTls(context.Background(), "mx.example.org")
+
+		want := []string{"proxy.internal:1080", "mx.example.org:25"}
+		if !reflect.DeepEqual(dialer.addresses, want) {
+			t.Errorf("found %v, want %v", dialer.addresses, want)
+		}
+	})
+
+	t.Run("UnreachableHTTPProxy", func(t *testing.T) {
+		proxyAddr := closedAddress(t)
+		advisor := NewAdvisor(time.Second, time.Second, false, WithProxy(ProxyConfig{HTTPSProxy: "http://" + proxyAddr}))
+
+		advice, err := advisor.checkBIMI(context.Background(), "v=BIMI1; l=https://bimi.example.com/logo.svg; a=https://bimi.example.com/cert.pem;")
+		if ErrorKind(err) != ErrorKindEgress || !strings.HasPrefix(err.Error(), "SVG logo: ") {
+			t.Errorf("found %v, want the SVG logo's egress error", err)
+		}
+
+		if strings.Contains(strings.Join(advice, "\n"), proxyAddr) {
+			t.Errorf("found %v, want the proxy left out of the advice", advice)
+		}
+	})
+
+	t.Run("InvalidProxy", func(t *testing.T) {
+		config := ProxyConfig{AllProxy: "http://proxy.internal:3128"}
+		if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "require a socks5:// proxy") {
+			t.Errorf("found %v, want a socks5 scheme error", err)
+		}
+
+		advisor := NewAdvisor(time.Second, time.Second, true, WithProxy(config))
+		if advice, _ := advisor.checkMailTls(context.Background(), "mx.example.com"); !reflect.DeepEqual(advice, []string{"Failed to reach domain"}) {
+			t.Errorf("found %v, want the connection to fail", advice)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package advisor
+
+import (
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+// CheckMissingRecord returns the advice for a DMARC, DKIM or BIMI record that
+// wasn't found, tailored to the DNS response code of the name it was looked up
+// at (for DKIM, the selectors under _domainkey), given with the advice of the
+// check for the record:
+//   - NXDOMAIN, the name doesn't exist, so the record is published by
+//     creating it;
+//   - NOERROR, the name exists without the record, so it's added alongside
+//     whatever is already there (or at the target of its CNAME);
+//   - SERVFAIL, or any other failure, the name couldn't be resolved, so the
+//     record may well exist, but receivers can't find it either. This
+//     replaces the check's advice, as it isn't that there's no record.
+//
+// The check's advice is returned unchanged for any other response code.
+func (a *Advisor) CheckMissingRecord(kind lookalike.Kind, domain, rcode string, advice []string) []string {
+	var name, record string
+
+	switch kind.Name {
+	case lookalike.DMARC.Name:
+		name, record = "_dmarc."+domain, "a TXT record starting with v=DMARC1"
+	case lookalike.DKIM.Name:
+		name = "_domainkey." + domain
+	case lookalike.BIMI.Name:
+		name, record = "default._bimi."+domain, "a TXT record starting with v=BIMI1"
+	default:
+		return advice
+	}
+
+	switch rcode {
+	case "":
+		return advice
+	case "NXDOMAIN":
+		if kind.Name == lookalike.DKIM.Name {
+			return append(advice, "None of the selectors checked exist under "+name+" (NXDOMAIN), so none of your sending services' DKIM keys are published yet. Publish each at the selector its service signs with.")
+		}
+
+		return append(advice, name+" doesn't exist (NXDOMAIN), so publish your "+kind.Name+" record by creating the name, with "+record+".")
+	case "NOERROR":
+		if kind.Name == lookalike.DKIM.Name {
+			return append(advice, "A selector checked under "+name+" exists but has no DKIM key (NOERROR), which is usually a CNAME to a sending service that doesn't publish the key yet, or no longer does. Check the selector with your sending service.")
+		}
+
+		return append(advice, name+" exists but has no "+kind.Name+" record (NOERROR), so add "+record+" at it, alongside any records already there (or at its target, if it's a CNAME).")
+	case "SERVFAIL":
+		if kind.Name == lookalike.DKIM.Name {
+			name = "a selector under " + name
+		}
+
+		return []string{"Your DNS is failing validation, as the lookup of " + name + " returned SERVFAIL. This is most often a DNSSEC validation failure, such as expired signatures, or a DS record at the parent zone that doesn't match your keys. Receivers' resolvers fail the same way, so they can't find your " + kind.Name + " record either, whether or not it's published."}
+	}
+
+	if kind.Name == lookalike.DKIM.Name {
+		name = "a selector under " + name
+	}
+
+	return []string{"Your " + kind.Name + " record couldn't be checked, as the lookup of " + name + " failed with " + rcode + ". Make sure your nameservers answer queries for the name, then scan again."}
+}
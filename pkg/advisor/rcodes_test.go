@@ -0,0 +1,58 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+func TestCheckMissingRecord(t *testing.T) {
+	advisor := NewAdvisor(time.Second, 0, false)
+
+	dmarc := []string{"You do not have DMARC setup!"}
+	dkim := []string{"We couldn't detect any active DKIM record for your domain."}
+	bimi := []string{"We couldn't detect any active BIMI record for your domain."}
+
+	tests := []struct {
+		name     string
+		kind     lookalike.Kind
+		rcode    string
+		advice   []string
+		expected []string
+		severity Severity
+	}{
+		{"NoRcode", lookalike.DMARC, "", dmarc, dmarc, SeverityCritical},
+		{"DMARCNXDOMAIN", lookalike.DMARC, "NXDOMAIN", dmarc, append(dmarc, "_dmarc.example.com doesn't exist (NXDOMAIN), so publish your DMARC record by creating the name"), SeverityInfo},
+		{"DMARCNOERROR", lookalike.DMARC, "NOERROR", dmarc, append(dmarc, "_dmarc.example.com exists but has no DMARC record (NOERROR), so add a TXT record starting with v=DMARC1"), SeverityInfo},
+		{"DMARCSERVFAIL", lookalike.DMARC, "SERVFAIL", dmarc, []string{"Your DNS is failing validation, as the lookup of _dmarc.example.com returned SERVFAIL."}, SeverityHigh},
+		{"DKIMNXDOMAIN", lookalike.DKIM, "NXDOMAIN", dkim, append(dkim, "None of the selectors checked exist under _domainkey.example.com (NXDOMAIN)"), SeverityInfo},
+		{"DKIMNOERROR", lookalike.DKIM, "NOERROR", dkim, append(dkim, "A selector checked under _domainkey.example.com exists but has no DKIM key (NOERROR)"), SeverityInfo},
+		{"DKIMSERVFAIL", lookalike.DKIM, "SERVFAIL", dkim, []string{"the lookup of a selector under _domainkey.example.com returned SERVFAIL"}, SeverityHigh},
+		{"BIMINXDOMAIN", lookalike.BIMI, "NXDOMAIN", bimi, append(bimi, "default._bimi.example.com doesn't exist (NXDOMAIN), so publish your BIMI record"), SeverityInfo},
+		{"BIMINOERROR", lookalike.BIMI, "NOERROR", bimi, append(bimi, "default._bimi.example.com exists but has no BIMI record (NOERROR)"), SeverityInfo},
+		{"BIMISERVFAIL", lookalike.BIMI, "SERVFAIL", bimi, []string{"Your DNS is failing validation, as the lookup of default._bimi.example.com returned SERVFAIL."}, SeverityHigh},
+		{"REFUSED", lookalike.DMARC, "REFUSED", dmarc, []string{"Your DMARC record couldn't be checked, as the lookup of _dmarc.example.com failed with REFUSED."}, SeverityMedium},
+		{"OtherKind", lookalike.SPF, "NXDOMAIN", []string{"spf"}, []string{"spf"}, SeverityInfo},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckMissingRecord(test.kind, "example.com", test.rcode, append([]string(nil), test.advice...))
+			if len(advice) != len(test.expected) {
+				t.Fatalf("found %v, want %d lines", advice, len(test.expected))
+			}
+
+			for index, expected := range test.expected {
+				if !strings.Contains(advice[index], expected) {
+					t.Errorf("found %q, want it to contain %q", advice[index], expected)
+				}
+			}
+
+			if severity := Classify(advice[len(advice)-1]); severity != test.severity {
+				t.Errorf("found %v, want %v", severity, test.severity)
+			}
+		})
+	}
+}
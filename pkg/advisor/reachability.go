@@ -0,0 +1,121 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// mailFailure is the category of a failure to reach a mail server, either
+// while connecting to it or while reading its greeting.
+type mailFailure string
+
+const (
+	// mailFailureRefused is a connection refused by the host, as nothing
+	// listens on its SMTP port.
+	mailFailureRefused mailFailure = "refused"
+
+	// mailFailureTimeout is a connection or greeting that didn't complete
+	// before the timeout, such as one to a firewalled (blackholed) port.
+	mailFailureTimeout mailFailure = "timeout"
+
+	// mailFailureReset is a connection reset or closed by the server before
+	// it greeted.
+	mailFailureReset mailFailure = "reset"
+
+	// mailFailureDNS is a host whose name couldn't be resolved to an address.
+	mailFailureDNS mailFailure = "dns-error"
+
+	// mailFailureGreeting4xx is a server that greeted with a temporary
+	// failure, such as a greylisting server.
+	mailFailureGreeting4xx mailFailure = "smtp-4xx-greeting"
+
+	// mailFailureGreeting5xx is a server that greeted with a permanent
+	// failure, refusing any session.
+	mailFailureGreeting5xx mailFailure = "smtp-5xx-greeting"
+
+	// softGreetingPhrase marks the advice of mail servers that greeted with a
+	// temporary failure, which says nothing about the server's TLS.
+	softGreetingPhrase = "Temporarily turned away by server"
+)
+
+// classifyMailFailure returns the category of the error dialing a mail
+// server or reading its greeting, along with the server's greeting if it
+// turned the session away. Errors it doesn't recognize, such as those of a
+// check that was abandoned, return an empty category.
+func classifyMailFailure(err error) (mailFailure, string) {
+	var (
+		reply  *textproto.Error
+		dnsErr *net.DNSError
+		netErr net.Error
+	)
+
+	switch {
+	case err == nil:
+		return "", ""
+	case errors.As(err, &reply) && reply.Code >= 400 && reply.Code < 500:
+		return mailFailureGreeting4xx, formatReply(reply)
+	case errors.As(err, &reply) && reply.Code >= 500 && reply.Code < 600:
+		return mailFailureGreeting5xx, formatReply(reply)
+	case errors.As(err, &dnsErr):
+		return mailFailureDNS, ""
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return mailFailureRefused, ""
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return mailFailureReset, ""
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return mailFailureTimeout, ""
+	case strings.Contains(err.Error(), "i/o timeout"):
+		// dialers that don't wrap the underlying error, such as some proxies
+		return mailFailureTimeout, ""
+	}
+
+	return "", ""
+}
+
+// mailFailureAdvice returns the advice for a mail server that couldn't be
+// reached, distinguishing the hard failures, which receivers would run into
+// too, from the server turning the probe away for now.
+func mailFailureAdvice(err error) string {
+	category, greeting := classifyMailFailure(err)
+
+	switch category {
+	case mailFailureRefused:
+		return "Failed to reach domain, as it refused the connection to port 25, so nothing is accepting mail on the server."
+	case mailFailureTimeout:
+		return "Failed to reach domain before timeout, as the server didn't connect or greet in time. A firewall may be dropping connections to port 25, or the server may be down."
+	case mailFailureReset:
+		return "Failed to reach domain, as the server closed the connection before greeting. It may be overloaded, or dropping connections from unknown senders."
+	case mailFailureDNS:
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "Failed to reach domain, as its hostname doesn't resolve to an address, so receivers can't deliver to it either."
+		}
+
+		return "Failed to reach domain, as its hostname couldn't be resolved to an address."
+	case mailFailureGreeting4xx:
+		return fmt.Sprintf("%s (%s), so its TLS wasn't checked. Greylisting servers and those under maintenance greet this way, so it may accept mail when scanned again later.", softGreetingPhrase, greeting)
+	case mailFailureGreeting5xx:
+		return fmt.Sprintf("Failed to reach domain, as the server rejected the session in its greeting (%s), so it doesn't accept mail, unless it only rejects this scanner's address.", greeting)
+	}
+
+	return "Failed to reach domain"
+}
+
+// isSoftFailure returns whether the advice is that of a mail server that
+// greeted with a temporary failure.
+func isSoftFailure(advice []string) bool {
+	return len(advice) == 1 && strings.HasPrefix(advice[0], softGreetingPhrase)
+}
+
+// formatReply formats a mail server's reply on a single line, such as
+// "421 4.7.0 Try again later".
+func formatReply(reply *textproto.Error) string {
+	return fmt.Sprintf("%d %s", reply.Code, strings.Join(strings.Fields(reply.Msg), " "))
+}
@@ -0,0 +1,223 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+)
+
+// greet connects to the address and reads its greeting as the SMTP probes
+// do, returning the error if either failed.
+func greet(t *testing.T, address string) error {
+	t.Helper()
+
+	conn, err := net.DialTimeout("tcp", address, 200*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := smtp.NewClient(conn, "mx.example.com")
+	if err != nil {
+		return err
+	}
+
+	return client.Close()
+}
+
+// startListener starts a server handling each connection with the function.
+func startListener(t *testing.T, handle func(conn *net.TCPConn)) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go handle(conn.(*net.TCPConn))
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestClassifyMailFailure(t *testing.T) {
+	closedPort := func(t *testing.T) error {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		address := listener.Addr().String()
+		listener.Close()
+
+		return greet(t, address)
+	}
+
+	blackholedPort := func(t *testing.T) error {
+		// 100::/64 is a discard prefix, which is routed nowhere
+		err := greet(t, "[100::1]:25")
+		if errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.EADDRNOTAVAIL) {
+			t.Skipf("the network has no route to blackhole the connection: %v", err)
+		}
+
+		return err
+	}
+
+	silentServer := func(t *testing.T) error {
+		hold := make(chan struct{})
+		t.Cleanup(func() { close(hold) })
+
+		return greet(t, startListener(t, func(conn *net.TCPConn) {
+			defer conn.Close()
+			<-hold
+		}))
+	}
+
+	resettingServer := func(t *testing.T) error {
+		return greet(t, startListener(t, func(conn *net.TCPConn) {
+			_ = conn.SetLinger(0)
+			conn.Close()
+		}))
+	}
+
+	closingServer := func(t *testing.T) error {
+		return greet(t, startListener(t, func(conn *net.TCPConn) {
+			conn.Close()
+		}))
+	}
+
+	scriptedServer := func(greeting string) func(t *testing.T) error {
+		return func(t *testing.T) error {
+			server := newScriptedSMTPServer(t, 0, func(int) string { return greeting })
+			return greet(t, server.listener.Addr().String())
+		}
+	}
+
+	constructed := func(err error) func(t *testing.T) error {
+		return func(*testing.T) error { return err }
+	}
+
+	notFound := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "mx.example.invalid", IsNotFound: true}}
+
+	tests := []struct {
+		name     string
+		err      func(t *testing.T) error
+		expected mailFailure
+		greeting string
+	}{
+		{name: "ClosedPort", err: closedPort, expected: mailFailureRefused},
+		{name: "BlackholedPort", err: blackholedPort, expected: mailFailureTimeout},
+		{name: "SilentServer", err: silentServer, expected: mailFailureTimeout},
+		{name: "Reset", err: resettingServer, expected: mailFailureReset},
+		{name: "ClosedBeforeGreeting", err: closingServer, expected: mailFailureReset},
+		{name: "Greylisted", err: scriptedServer("450 4.7.1 Client host rejected: greylisted, try in 5 minutes"), expected: mailFailureGreeting4xx, greeting: "450 4.7.1 Client host rejected: greylisted, try in 5 minutes"},
+		{name: "Rejected", err: scriptedServer("554-mx.example.com\r\n554 5.7.1 No SMTP service here"), expected: mailFailureGreeting5xx, greeting: "554 mx.example.com 5.7.1 No SMTP service here"},
+		{name: "NotFound", err: constructed(notFound), expected: mailFailureDNS},
+		{name: "Wrapped", err: constructed(fmt.Errorf("probe: %w", notFound)), expected: mailFailureDNS},
+		{name: "UnwrappedTimeout", err: constructed(errors.New("proxy: dial tcp 192.0.2.1:25: i/o timeout")), expected: mailFailureTimeout},
+		{name: "Abandoned", err: constructed(context.Canceled)},
+		{name: "Unrecognized", err: constructed(errors.New("connection refused"))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.err(t)
+			if err == nil {
+				t.Fatal("found no error, want the connection to fail")
+			}
+
+			category, greeting := classifyMailFailure(err)
+			if category != test.expected || greeting != test.greeting {
+				t.Errorf("found %q, %q for %v, want %q, %q", category, greeting, err, test.expected, test.greeting)
+			}
+		})
+	}
+}
+
+func TestMailFailureAdvice(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+		severity Severity
+	}{
+		{name: "Refused", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, expected: "as it refused the connection to port 25", severity: SeverityMedium},
+		{name: "Timeout", err: &net.OpError{Op: "dial", Err: context.DeadlineExceeded}, expected: "Failed to reach domain before timeout, as", severity: SeverityMedium},
+		{name: "Reset", err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, expected: "closed the connection before greeting", severity: SeverityMedium},
+		{name: "NotFound", err: &net.DNSError{Err: "no such host", IsNotFound: true}, expected: "its hostname doesn't resolve to an address", severity: SeverityMedium},
+		{name: "Unresolved", err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}, expected: "its hostname couldn't be resolved", severity: SeverityMedium},
+		{name: "Unrecognized", err: errors.New("boom"), expected: "Failed to reach domain", severity: SeverityMedium},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := mailFailureAdvice(test.err)
+			if !strings.Contains(advice, test.expected) {
+				t.Errorf("found %q, want it to contain %q", advice, test.expected)
+			}
+
+			if severity := Classify(advice); severity != test.severity {
+				t.Errorf("found %v for %q, want %v", severity, advice, test.severity)
+			}
+		})
+	}
+}
+
+func TestAdvisor_MailGreetingFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		greeting    string
+		severity    Severity
+		connections int
+	}{
+		// a temporary failure isn't cached, as it may clear by the next scan
+		{name: "Temporary", greeting: "450 4.3.2 Service currently unavailable", severity: SeverityLow, connections: 2},
+		{name: "Permanent", greeting: "554 5.7.1 Service unavailable; client host blocked", severity: SeverityMedium, connections: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network := testnet.New(t)
+			server := network.SMTP("mx.example.com", &testnet.SMTPServer{Banner: test.greeting})
+
+			advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(network), WithProxy(ProxyConfig{}), WithSMTPPoliteness(0, 1))
+			t.Cleanup(advisor.Close)
+
+			advice, _ := advisor.checkMailTls(context.Background(), "mx.example.com")
+			if len(advice) != 1 || !strings.Contains(advice[0], "("+test.greeting+")") {
+				t.Fatalf("found %v, want the greeting to be quoted", advice)
+			}
+
+			if severity := Classify(advice[0]); severity != test.severity {
+				t.Errorf("found %v, want %v", severity, test.severity)
+			}
+
+			_, _ = advisor.checkMailTls(context.Background(), "mx.example.com")
+
+			if connections := server.Connections(); connections != test.connections {
+				t.Errorf("found %d connections, want %d", connections, test.connections)
+			}
+		})
+	}
+}
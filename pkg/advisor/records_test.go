@@ -0,0 +1,244 @@
+package advisor
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseTimeout bounds how long the checks of a single fuzzed record may take.
+// It's far beyond what any record needs, so only a parser that runs away with
+// a pathological record trips it.
+const parseTimeout = time.Second
+
+// addRecordSeeds seeds the fuzz target with the records of the kind from the
+// shared corpus in testdata/records.tsv, along with some records far larger
+// than any published one. As go test runs every seed once without -fuzz, the
+// corpus doubles as a regression test of each parser.
+func addRecordSeeds(f *testing.F, kind string) {
+	f.Helper()
+
+	file, err := os.Open("testdata/records.tsv")
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			f.Fatalf("malformed corpus record %q", line)
+		}
+
+		record, err := strconv.Unquote(fields[1])
+		if err != nil {
+			f.Fatalf("malformed corpus record %q: %v", line, err)
+		}
+
+		if fields[0] == kind {
+			f.Add(record)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		f.Fatal(err)
+	}
+
+	// a 10KB SPF record, and as many tags in the other records
+	f.Add("v=spf1" + strings.Repeat(" include:_spf.example.com", 400) + " -all")
+	f.Add("v=DMARC1; p=reject" + strings.Repeat("; rua=mailto:dmarc@example.com", 400))
+	f.Add("v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A", 300))
+	f.Add("v=BIMI1" + strings.Repeat("; l=https://example.com/logo.svg", 400))
+	f.Add(strings.Repeat(";", 10000))
+}
+
+// withinTimeout fails the test if the function panics, or doesn't return
+// within the parse timeout. It runs in its own goroutine, so its panic is
+// recovered and reported along with its stack.
+func withinTimeout(t *testing.T, name string, fn func()) {
+	t.Helper()
+
+	var (
+		done     = make(chan struct{})
+		panicked any
+		stack    []byte
+	)
+
+	go func() {
+		defer close(done)
+		defer func() {
+			if panicked = recover(); panicked != nil {
+				stack = debug.Stack()
+			}
+		}()
+
+		fn()
+	}()
+
+	select {
+	case <-done:
+		if panicked != nil {
+			t.Fatalf("%s panicked: %v\n%s", name, panicked, stack)
+		}
+	case <-time.After(parseTimeout):
+		t.Fatalf("%s didn't return within %v", name, parseTimeout)
+	}
+}
+
+// formatDMARC serializes the tags of the parsed DMARC record that the parser
+// recognizes, with the percentage and report interval always set, as they
+// have defaults. It ends in a semicolon, as records without one aren't parsed.
+func formatDMARC(record *dmarc) string {
+	var tags []string
+
+	add := func(name, value string) {
+		if value != "" {
+			tags = append(tags, name+"="+value)
+		}
+	}
+
+	add("v", record.Version)
+	add("p", record.Policy)
+	add("sp", record.SubdomainPolicy)
+	tags = append(tags, "pct="+strconv.Itoa(record.Percentage))
+
+	if record.AggregateReportDestination != nil {
+		tags = append(tags, "rua="+strings.Join(record.AggregateReportDestination, ","))
+	}
+
+	if record.ForensicReportDestination != nil {
+		tags = append(tags, "ruf="+strings.Join(record.ForensicReportDestination, ","))
+	}
+
+	add("fo", record.FailureOptions)
+	add("aspf", record.ASPF)
+	add("adkim", record.ADKIM)
+	tags = append(tags, "ri="+strconv.Itoa(record.ReportInterval))
+
+	return strings.Join(tags, "; ") + ";"
+}
+
+func FuzzParseDMARC(f *testing.F) {
+	// in strict ASCII mode, the report destinations are parsed too
+	advisor := NewAdvisor(time.Second, time.Second, false, WithOffline(true), WithStrictASCII(true))
+	defer advisor.Close()
+
+	addRecordSeeds(f, "DMARC")
+
+	f.Fuzz(func(t *testing.T, record string) {
+		var parsed *dmarc
+
+		withinTimeout(t, "parseDMARC", func() {
+			parsed = parseDMARC(record)
+			advisor.checkDMARC(record, parsed)
+
+			if parsed != nil {
+				advisor.checkReportAddresses(parsed)
+			}
+		})
+
+		if parsed == nil {
+			return
+		}
+
+		// the recognized tags survive being serialized and parsed again
+		formatted := formatDMARC(parsed)
+
+		reparsed := parseDMARC(formatted)
+		if reparsed == nil {
+			t.Fatalf("parseDMARC(%q) of %q returned nil", formatted, record)
+		}
+
+		parsed.Advice, reparsed.Advice = nil, nil
+		if !reflect.DeepEqual(parsed, reparsed) {
+			t.Errorf("parseDMARC(%q) of %q found %+v, want %+v", formatted, record, reparsed, parsed)
+		}
+	})
+}
+
+func FuzzCheckSPF(f *testing.F) {
+	advisor := NewAdvisor(time.Second, time.Second, false, WithOffline(true))
+	defer advisor.Close()
+
+	addRecordSeeds(f, "SPF")
+
+	f.Fuzz(func(t *testing.T, record string) {
+		withinTimeout(t, "checkSPFRecord", func() {
+			for _, dmarcRecord := range []*dmarc{nil, parseDMARC("v=DMARC1; p=reject; rua=mailto:dmarc@example.com")} {
+				if advice := advisor.checkSPFRecord(record, dmarcRecord, true); len(advice) == 0 {
+					t.Errorf("checkSPFRecord(%q) returned no advice", record)
+				}
+			}
+
+			advisor.CheckSPFRedirects("example.com", []SPFRedirect{{Domain: "example.com", Record: record}}, "")
+		})
+
+		// a redirect is taken from a single term of the record
+		if redirect := spfRedirect(record); strings.ContainsAny(redirect, " \t\n") {
+			t.Errorf("spfRedirect(%q) returned %q, want a single term", record, redirect)
+		}
+	})
+}
+
+func FuzzCheckDKIM(f *testing.F) {
+	advisor := NewAdvisor(time.Second, time.Second, false, WithOffline(true))
+	defer advisor.Close()
+
+	addRecordSeeds(f, "DKIM")
+
+	f.Fuzz(func(t *testing.T, record string) {
+		withinTimeout(t, "CheckDKIM", func() {
+			advisor.CheckDKIM(record)
+			advisor.CheckDKIMKeys([]DKIMKey{{Selector: "selector1", Record: record, Segments: []int{len(record)}}})
+			lintDKIMKey(record)
+		})
+
+		// a tag's value never spans tags
+		for _, name := range []string{"v", "k", "p"} {
+			if value, ok := dkimTag(record, name); strings.Contains(value, ";") || (!ok && value != "") {
+				t.Errorf("dkimTag(%q, %q) returned %q, %v", record, name, value, ok)
+			}
+		}
+	})
+}
+
+func FuzzParseBIMI(f *testing.F) {
+	advisor := NewAdvisor(time.Second, time.Second, false, WithOffline(true))
+	defer advisor.Close()
+
+	addRecordSeeds(f, "BIMI")
+
+	f.Fuzz(func(t *testing.T, record string) {
+		var parsed bimi
+
+		withinTimeout(t, "parseBIMI", func() {
+			parsed = parseBIMI(record)
+
+			// offline, the logo and certificate aren't fetched
+			_, _ = advisor.checkBIMI(context.Background(), record)
+		})
+
+		// the URLs are taken from within a single tag of the record
+		for _, url := range []string{parsed.Logo, parsed.Certificate} {
+			if strings.Contains(url, ";") || !strings.Contains(record, url) {
+				t.Errorf("parseBIMI(%q) returned the URL %q, want part of a single tag", record, url)
+			}
+		}
+
+		if (parsed.Logo == "" || parsed.Certificate == "") && len(parsed.Advice) == 0 {
+			t.Errorf("parseBIMI(%q) returned no advice for a missing URL", record)
+		}
+	})
+}
@@ -0,0 +1,412 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
+	"github.com/goccy/go-json"
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultRDAPBootstrapURL is IANA's RDAP bootstrap registry for domains
+	// (RFC 9224), which lists the RDAP service of each TLD that has one.
+	DefaultRDAPBootstrapURL = "https://data.iana.org/rdap/dns.json"
+
+	// DefaultRDAPExpiryWindow is how soon a domain's registration must expire
+	// to be reported.
+	DefaultRDAPExpiryWindow = 60 * 24 * time.Hour
+
+	// rdapCacheLifetime is how long a domain's registration is cached by
+	// default (see CacheRegistrations), as it rarely changes between scans.
+	rdapCacheLifetime = 24 * time.Hour
+
+	// rdapBootstrapLifetime is how long the bootstrap registry is used before
+	// it's fetched again. IANA updates it as TLDs launch their services.
+	rdapBootstrapLifetime = 24 * time.Hour
+
+	// rdapMaxResponseSize bounds the bootstrap registry and registration
+	// responses read.
+	rdapMaxResponseSize = 4 << 20
+
+	// transferLockStatus is the EPP status of a domain whose registrar won't
+	// let it be transferred away.
+	transferLockStatus = "clientTransferProhibited"
+)
+
+// errNoRDAPService is returned when the domain's TLD has no RDAP service in
+// the bootstrap registry.
+var errNoRDAPService = errors.New("no RDAP service for the TLD")
+
+type (
+	// Registration is a domain's registration, as published by its registry's
+	// RDAP service, only included in detailed output.
+	Registration struct {
+		Domain         string     `json:"domain" yaml:"domain" doc:"The registered domain that was looked up, which the scanned domain is part of." example:"example.com"`
+		Registrar      string     `json:"registrar,omitempty" yaml:"registrar,omitempty" doc:"The domain's registrar, if published." example:"Example Registrar, Inc."`
+		Expires        *time.Time `json:"expires,omitempty" yaml:"expires,omitempty" doc:"When the domain's registration expires, if published."`
+		Statuses       []string   `json:"statuses,omitempty" yaml:"statuses,omitempty" doc:"The domain's EPP statuses, such as its locks." example:"clientTransferProhibited"`
+		TransferLocked bool       `json:"transferLocked" yaml:"transferLocked" doc:"Whether the domain has the clientTransferProhibited lock, which stops it being transferred to another registrar." example:"true"`
+		Server         string     `json:"server" yaml:"server" doc:"The RDAP URL the registration was looked up at." example:"https://rdap.verisign.com/com/v1/domain/example.com"`
+	}
+
+	// rdapClient looks up domains' registrations at their registries' RDAP
+	// services, found through the bootstrap registry. Lookups are cached and
+	// shared between concurrent callers.
+	rdapClient struct {
+		bootstrapURL string
+		cache        *cache.Cache[Registration]
+		group        singleflight.Group
+		now          func() time.Time
+		window       time.Duration
+
+		// mutex guards services, the RDAP base URLs of each TLD, and when
+		// they were fetched.
+		mutex     sync.Mutex
+		services  map[string][]string
+		fetchedAt time.Time
+	}
+
+	// rdapBootstrap is the bootstrap registry's JSON, with each service as a
+	// list of TLDs and a list of their base URLs.
+	rdapBootstrap struct {
+		Services [][][]string `json:"services"`
+	}
+
+	// rdapDomain is the part of an RDAP domain response that's used.
+	rdapDomain struct {
+		Status   []string     `json:"status"`
+		Events   []rdapEvent  `json:"events"`
+		Entities []rdapEntity `json:"entities"`
+	}
+
+	rdapEvent struct {
+		Action string `json:"eventAction"`
+		Date   string `json:"eventDate"`
+	}
+
+	// rdapEntity is a contact of a domain, such as its registrar, whose name is
+	// in its jCard (RFC 7095).
+	rdapEntity struct {
+		Roles      []string          `json:"roles"`
+		VCardArray []json.RawMessage `json:"vcardArray"`
+	}
+)
+
+// WithRDAP enables the registration check, which looks up each domain's
+// registration at its registry's RDAP service, found through the bootstrap
+// registry at bootstrapURL (DefaultRDAPBootstrapURL if empty). It reports
+// registrations that expire within the window (DefaultRDAPExpiryWindow if 0
+// or less), and domains without a transfer lock. It's disabled by default,
+// as it sends every scanned domain to its registry.
+func WithRDAP(bootstrapURL string, window time.Duration) Option {
+	return func(a *Advisor) {
+		if bootstrapURL == "" {
+			bootstrapURL = DefaultRDAPBootstrapURL
+		}
+
+		if window <= 0 {
+			window = DefaultRDAPExpiryWindow
+		}
+
+		a.rdapURL, a.rdapWindow = bootstrapURL, window
+	}
+}
+
+func newRDAPClient(bootstrapURL string, window, ttl time.Duration) *rdapClient {
+	return &rdapClient{
+		bootstrapURL: bootstrapURL,
+		cache:        cache.New[Registration](ttl),
+		now:          time.Now,
+		window:       window,
+	}
+}
+
+// CheckRegistration returns advice on the domain's registration (that of the
+// registered domain it's part of), as published by its registry's RDAP
+// service, along with the registration. Both are nil if the check isn't
+// enabled.
+func (a *Advisor) CheckRegistration(ctx context.Context, domain string) ([]string, *Registration) {
+	if a.rdap == nil {
+		return nil, nil
+	}
+
+	if a.isOffline(ctx) {
+		return []string{skippedOffline("The registration check of your domain")}, nil
+	}
+
+	if a.checkTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.checkTimeout)
+		defer cancel()
+	}
+
+	domain = normalizeDomain(domain)
+
+	registered, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return []string{"Your domain isn't part of a registered domain, so its registration wasn't checked."}, nil
+	}
+
+	registration, err := a.rdap.lookup(ctx, a.httpClient, registered, cacheTags(ctx, registered, domain))
+	if errors.Is(err, errNoRDAPService) {
+		_, tld, _ := strings.Cut(registered, ".")
+		return []string{fmt.Sprintf("The registry of .%s doesn't offer RDAP, so your domain's expiry and transfer lock weren't checked.", tld)}, nil
+	} else if err != nil {
+		return []string{"We couldn't look up your domain's registration over RDAP, so its expiry and transfer lock weren't checked."}, nil
+	}
+
+	var advice []string
+
+	now := a.rdap.now()
+
+	switch {
+	case registration.Expires == nil:
+		advice = append(advice, "Your domain's registry doesn't publish its expiry date over RDAP, so it wasn't checked.")
+	case registration.Expires.Before(now):
+		advice = append(advice, fmt.Sprintf("Your domain's registration expired on %s. Renew it with %s straight away, as once it lapses its DNS, including its DMARC, SPF and MX records, stops resolving.", registration.Expires.Format(time.DateOnly), registrarOrDefault(registration.Registrar)))
+	case registration.Expires.Before(now.Add(a.rdap.window)):
+		days := int(math.Ceil(registration.Expires.Sub(now).Hours() / 24))
+		advice = append(advice, fmt.Sprintf("Your domain's registration expires on %s, in %d days. Renew it with %s (or enable auto-renewal), as once it lapses its DMARC protection lapses with it.", registration.Expires.Format(time.DateOnly), days, registrarOrDefault(registration.Registrar)))
+	}
+
+	if !registration.TransferLocked {
+		advice = append(advice, fmt.Sprintf("Your domain isn't locked against transfers (%s), so it could be moved to another registrar without your registrar stopping it. Ask %s to enable the transfer lock.", transferLockStatus, registrarOrDefault(registration.Registrar)))
+	}
+
+	if len(advice) == 0 {
+		advice = append(advice, fmt.Sprintf("Your domain's registration runs until %s, and it's locked against transfers. No further action needed.", registration.Expires.Format(time.DateOnly)))
+	}
+
+	return advice, registration
+}
+
+func registrarOrDefault(registrar string) string {
+	if registrar == "" {
+		return "your registrar"
+	}
+
+	return registrar
+}
+
+// lookup returns the registration of the registered domain, caching it with
+// the tags.
+func (c *rdapClient) lookup(ctx context.Context, client *http.Client, domain string, tags []string) (*Registration, error) {
+	if registration := c.cache.Get(domain); registration != nil {
+		return registration, nil
+	}
+
+	result, err, _ := c.group.Do(domain, func() (any, error) {
+		base, err := c.service(ctx, client, domain)
+		if err != nil {
+			return nil, err
+		}
+
+		registration, err := c.fetch(ctx, client, base, domain)
+		if err != nil {
+			return nil, err
+		}
+
+		c.cache.SetTagged(domain, registration, tags...)
+
+		return registration, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*Registration), nil
+}
+
+// service returns the RDAP base URL of the domain's TLD, fetching the
+// bootstrap registry if it hasn't been, or is out of date. A registry that
+// can't be fetched again is used until it can.
+func (c *rdapClient) service(ctx context.Context, client *http.Client, domain string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.services == nil || c.now().Sub(c.fetchedAt) > rdapBootstrapLifetime {
+		services, err := c.fetchBootstrap(ctx, client)
+		if err != nil && c.services == nil {
+			return "", err
+		}
+
+		if err == nil {
+			c.services, c.fetchedAt = services, c.now()
+		}
+	}
+
+	// the longest matching suffix wins (RFC 9224 section 4), though IANA only lists TLDs
+	labels := strings.Split(domain, ".")
+	for index := range labels {
+		if urls, ok := c.services[strings.Join(labels[index:], ".")]; ok {
+			return preferredURL(urls), nil
+		}
+	}
+
+	return "", errNoRDAPService
+}
+
+// preferredURL returns the first HTTPS base URL, or else the first.
+func preferredURL(urls []string) string {
+	for _, base := range urls {
+		if strings.HasPrefix(base, "https://") {
+			return base
+		}
+	}
+
+	return urls[0]
+}
+
+func (c *rdapClient) fetchBootstrap(ctx context.Context, client *http.Client) (map[string][]string, error) {
+	var bootstrap rdapBootstrap
+	if err := getRDAP(ctx, client, c.bootstrapURL, &bootstrap); err != nil {
+		return nil, fmt.Errorf("failed to fetch RDAP bootstrap registry: %w", err)
+	}
+
+	services := make(map[string][]string)
+
+	for _, service := range bootstrap.Services {
+		if len(service) != 2 || len(service[1]) == 0 {
+			continue
+		}
+
+		for _, tld := range service[0] {
+			services[strings.ToLower(tld)] = service[1]
+		}
+	}
+
+	return services, nil
+}
+
+func (c *rdapClient) fetch(ctx context.Context, client *http.Client, base, domain string) (*Registration, error) {
+	server, err := url.JoinPath(base, "domain", domain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RDAP service URL: %w", err)
+	}
+
+	var response rdapDomain
+	if err = getRDAP(ctx, client, server, &response); err != nil {
+		return nil, err
+	}
+
+	registration := &Registration{Domain: domain, Server: server}
+
+	for _, status := range response.Status {
+		status = eppStatus(status)
+		registration.Statuses = append(registration.Statuses, status)
+
+		if status == transferLockStatus {
+			registration.TransferLocked = true
+		}
+	}
+
+	sort.Strings(registration.Statuses)
+
+	for _, event := range response.Events {
+		if event.Action != "expiration" {
+			continue
+		}
+
+		if expires, err := time.Parse(time.RFC3339, event.Date); err == nil {
+			expires = expires.UTC()
+			registration.Expires = &expires
+		}
+	}
+
+	for _, entity := range response.Entities {
+		for _, role := range entity.Roles {
+			if role == "registrar" {
+				registration.Registrar = vcardName(entity.VCardArray)
+			}
+		}
+	}
+
+	return registration, nil
+}
+
+// getRDAP fetches the RDAP URL, decoding its JSON response into v.
+func getRDAP(ctx context.Context, client *http.Client, requestURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/rdap+json, application/json")
+
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("RDAP service responded with status %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, rdapMaxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse RDAP response: %w", err)
+	}
+
+	return nil
+}
+
+// eppStatus converts an RDAP status (such as "client transfer prohibited") to
+// its EPP name (such as "clientTransferProhibited"), as RFC 8056 maps them.
+// Statuses already in their EPP form are returned as they are.
+func eppStatus(status string) string {
+	words := strings.Fields(strings.ToLower(status))
+	if len(words) < 2 {
+		return strings.TrimSpace(status)
+	}
+
+	for index := 1; index < len(words); index++ {
+		words[index] = strings.ToUpper(words[index][:1]) + words[index][1:]
+	}
+
+	return strings.Join(words, "")
+}
+
+// vcardName returns the formatted name (fn) of a jCard, such as
+// ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example"]]].
+func vcardName(vcard []json.RawMessage) string {
+	if len(vcard) != 2 {
+		return ""
+	}
+
+	var properties [][]json.RawMessage
+	if err := json.Unmarshal(vcard[1], &properties); err != nil {
+		return ""
+	}
+
+	for _, property := range properties {
+		if len(property) != 4 {
+			continue
+		}
+
+		var name, value string
+		if json.Unmarshal(property[0], &name) != nil || name != "fn" || json.Unmarshal(property[3], &value) != nil {
+			continue
+		}
+
+		return strings.TrimSpace(value)
+	}
+
+	return ""
+}
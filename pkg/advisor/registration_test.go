@@ -0,0 +1,156 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEPPStatus(t *testing.T) {
+	tests := map[string]string{
+		"client transfer prohibited": "clientTransferProhibited",
+		"Server Delete Prohibited":   "serverDeleteProhibited",
+		"clientTransferProhibited":   "clientTransferProhibited",
+		"active":                     "active",
+		" ok ":                       "ok",
+	}
+
+	for status, expected := range tests {
+		if found := eppStatus(status); found != expected {
+			t.Errorf("found %q for %q, want %q", found, status, expected)
+		}
+	}
+}
+
+func TestAdvisor_CheckRegistration(t *testing.T) {
+	now := time.Now().UTC()
+
+	domain := func(expires time.Time, statuses ...string) string {
+		return fmt.Sprintf(`{"objectClassName":"domain","status":["%s"],"events":[{"eventAction":"registration","eventDate":"2001-01-01T00:00:00Z"},{"eventAction":"expiration","eventDate":%q}],`+
+			`"entities":[{"objectClassName":"entity","roles":["registrar"],"vcardArray":["vcard",[["version",{},"text","4.0"],["fn",{},"text","Example Registrar, Inc."]]]}]}`,
+			strings.Join(statuses, `","`), expires.Format(time.RFC3339))
+	}
+
+	var bootstrapRequests, domainRequests atomic.Int32
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns.json" {
+			bootstrapRequests.Add(1)
+			_, _ = fmt.Fprintf(w, `{"version":"1.0","services":[[["com","net"],["%[1]s/com/"]],[["org"],["%[1]s/org"]]]}`, server.URL)
+
+			return
+		}
+
+		domainRequests.Add(1)
+
+		switch r.URL.Path {
+		case "/com/domain/example.com":
+			_, _ = w.Write([]byte(domain(now.AddDate(0, 0, 30), "client transfer prohibited", "active")))
+		case "/com/domain/expired.com":
+			_, _ = w.Write([]byte(domain(now.AddDate(0, 0, -3), "active")))
+		case "/org/domain/example.org":
+			_, _ = w.Write([]byte(domain(now.AddDate(1, 0, 0), "clientTransferProhibited")))
+		case "/org/domain/undated.org":
+			_, _ = w.Write([]byte(`{"objectClassName":"domain","status":["client transfer prohibited"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Disabled", func(t *testing.T) {
+		advice, registration := NewAdvisor(time.Second, time.Second, false).CheckRegistration(context.Background(), "example.com")
+
+		if advice != nil || registration != nil {
+			t.Errorf("found %v and %v, want nothing when the check isn't enabled", advice, registration)
+		}
+	})
+
+	advisor := NewAdvisor(time.Second, time.Second, false, WithRDAP(server.URL+"/dns.json", 0))
+	defer advisor.Close()
+
+	t.Run("Expiring", func(t *testing.T) {
+		// the registered domain a subdomain is part of is looked up
+		advice, registration := advisor.CheckRegistration(context.Background(), "shop.example.com")
+
+		if len(advice) != 1 || !strings.Contains(advice[0], "expires on "+now.AddDate(0, 0, 30).Format(time.DateOnly)+", in 30 days") || !strings.Contains(advice[0], "Example Registrar, Inc.") {
+			t.Fatalf("found %v, want the expiry advice", advice)
+		}
+
+		if severity := Classify(advice[0]); severity != SeverityMedium {
+			t.Errorf("found %v, want %v", severity, SeverityMedium)
+		}
+
+		if registration == nil || registration.Domain != "example.com" || registration.Registrar != "Example Registrar, Inc." || !registration.TransferLocked || registration.Server != server.URL+"/com/domain/example.com" {
+			t.Errorf("found %+v, want the registration of example.com", registration)
+		}
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		before := domainRequests.Load()
+		advisor.CheckRegistration(context.Background(), "EXAMPLE.com.")
+
+		if domainRequests.Load() != before {
+			t.Errorf("found %d requests, want the lookup to be cached", domainRequests.Load()-before)
+		}
+	})
+
+	t.Run("ExpiredAndUnlocked", func(t *testing.T) {
+		advice, _ := advisor.CheckRegistration(context.Background(), "expired.com")
+
+		if len(advice) != 2 || Classify(advice[0]) != SeverityHigh || !strings.Contains(advice[1], "isn't locked against transfers") || Classify(advice[1]) != SeverityLow {
+			t.Errorf("found %v, want the expired and transfer lock advice", advice)
+		}
+	})
+
+	t.Run("Clean", func(t *testing.T) {
+		advice, registration := advisor.CheckRegistration(context.Background(), "example.org")
+
+		if len(advice) != 1 || Classify(advice[0]) != SeverityInfo || !strings.Contains(advice[0], "No further action needed") {
+			t.Errorf("found %v, want the registration to look good", advice)
+		}
+
+		if registration == nil || registration.Expires == nil || len(registration.Statuses) != 1 {
+			t.Errorf("found %+v, want its expiry and status", registration)
+		}
+	})
+
+	t.Run("Undated", func(t *testing.T) {
+		advice, _ := advisor.CheckRegistration(context.Background(), "undated.org")
+
+		if len(advice) != 1 || !strings.Contains(advice[0], "doesn't publish its expiry date") || Classify(advice[0]) != SeverityInfo {
+			t.Errorf("found %v, want the missing expiry to be noted", advice)
+		}
+	})
+
+	t.Run("NoService", func(t *testing.T) {
+		advice, registration := advisor.CheckRegistration(context.Background(), "example.de")
+
+		if len(advice) != 1 || advice[0] != "The registry of .de doesn't offer RDAP, so your domain's expiry and transfer lock weren't checked." || registration != nil {
+			t.Errorf("found %v and %v, want the missing RDAP service to be noted", advice, registration)
+		}
+
+		if severity := Classify(advice[0]); severity != SeverityInfo {
+			t.Errorf("found %v, want %v", severity, SeverityInfo)
+		}
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		advice, registration := advisor.CheckRegistration(context.Background(), "missing.com")
+
+		if len(advice) != 1 || !strings.Contains(advice[0], "couldn't look up") || registration != nil {
+			t.Errorf("found %v and %v, want the failed lookup advice", advice, registration)
+		}
+	})
+
+	// the bootstrap registry is only fetched again once it's out of date
+	if bootstrapRequests.Load() != 1 {
+		t.Errorf("found %d bootstrap requests, want 1", bootstrapRequests.Load())
+	}
+}
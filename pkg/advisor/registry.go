@@ -0,0 +1,258 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// Check is a check run by CheckAllInput alongside the built-in ones, such as a
+	// private check of a library embedding the advisor, registered with
+	// Register. It's run concurrently with the other checks, with the same
+	// timeout, and its advice is listed in the advice's Extensions under its
+	// name. Each check is given its own copy of the scan input, so it may
+	// modify it without affecting the others.
+	Check interface {
+		// Name is the name the check's advice, timing and error are keyed by,
+		// such as "dane". It must be unique.
+		Name() string
+
+		// Run returns the check's advice for the scanned domain. Its error is
+		// the failure on the scanner's side (such as a lookup that couldn't be
+		// made) that kept it from completing, which is listed in the advice's
+		// Errors rather than as advice, as it says nothing about the domain.
+		Run(ctx context.Context, input *ScanInput) ([]AdviceItem, error)
+	}
+
+	// ScanInput is the scanned domain's records, which CheckAllInput checks
+	// and gives to each check.
+	ScanInput struct {
+		Domain string
+		BIMI   string
+		DKIM   string
+		DMARC  string
+		MX     []string
+		SPF    string
+
+		// OrganizationalDMARC is the organizational domain's DMARC record, for
+		// a subdomain without a DMARC record of its own, whose subdomain
+		// policy then applies to it.
+		OrganizationalDMARC string
+
+		// OrganizationalSPF is the organizational domain's SPF record, for a
+		// subdomain without an SPF record of its own, which appears to send
+		// mail if the record names it (see WithSubdomainAdvice).
+		OrganizationalSPF string
+
+		// Providers are the names of the known mail providers detected from
+		// the MX and SPF records. They're set by CheckAllInput, replacing any
+		// given.
+		Providers []string
+	}
+
+	// AdviceItem is a single line of advice. Its severity is classified by the
+	// advice catalog like the built-in checks' (see Classify), so an
+	// extension's advice can be given severities, references and remediations
+	// with an advice catalog file (see DataFiles).
+	AdviceItem = string
+
+	// checkFunc adapts a function to a Check, for the built-in checks that
+	// depend on what CheckAllInput parses from the records once for all of them.
+	checkFunc struct {
+		name string
+		run  func(ctx context.Context) ([]AdviceItem, error)
+	}
+
+	// bimiCheck checks the BIMI record and the assets it links to, and that
+	// the domain's DMARC record (parsed once by CheckAllInput) lets receivers
+	// honor it.
+	bimiCheck struct {
+		advisor *Advisor
+		dmarc   *dmarc
+	}
+
+	// mxCheck checks the mail servers.
+	mxCheck struct {
+		advisor *Advisor
+	}
+)
+
+// ErrSwappedInput is the error of ScanInput.Validate for a record given as
+// another, such as a DMARC record as the DKIM record. It's a bug in the
+// caller, which the checks would otherwise report as problems with the domain.
+var ErrSwappedInput = errors.New("record given as another")
+
+// inputRecords are the record fields of ScanInput, keyed by the check of each,
+// with the version tag its records start with.
+var inputRecords = []struct {
+	check, name, article, version string
+	value                         func(input *ScanInput) string
+}{
+	{"bimi", "BIMI", "a", "v=bimi1", func(input *ScanInput) string { return input.BIMI }},
+	{"dkim", "DKIM", "a", "v=dkim1", func(input *ScanInput) string { return input.DKIM }},
+	{"dmarc", "DMARC", "a", "v=dmarc1", func(input *ScanInput) string { return input.DMARC }},
+	{"spf", "SPF", "an", "v=spf1", func(input *ScanInput) string { return input.SPF }},
+}
+
+// checkNamePattern is the format of a check's name, so it can be used as a
+// JSON field and in the `<name>_check` keys of timings and errors.
+var checkNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// registry holds the checks registered with Register, in registration order.
+var registry struct {
+	sync.RWMutex
+	checks []Check
+}
+
+// Register adds a check run by every advisor's CheckAllInput, typically from the
+// init function of the package defining it. It panics if the check's name
+// isn't lowercase letters and digits, or is already used by a built-in check,
+// a section of the advice, or another registered check, as that's a
+// programming error.
+func Register(check Check) {
+	name := check.Name()
+	if !checkNamePattern.MatchString(name) {
+		panic(fmt.Sprintf("advisor: invalid check name %q, it must be lowercase letters and digits", name))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if slices.ContainsFunc((&Advice{}).sections(), func(section adviceSection) bool { return section.name == name }) || slices.Contains(Checks, name) {
+		panic(fmt.Sprintf("advisor: check %q is built in", name))
+	}
+
+	for _, registered := range registry.checks {
+		if registered.Name() == name {
+			panic(fmt.Sprintf("advisor: check %q is already registered", name))
+		}
+	}
+
+	registry.checks = append(registry.checks, check)
+}
+
+// CheckNames returns the names of the checks run by CheckAllInput, built-in and
+// registered, sorted alphabetically, as accepted by WithDisabledChecks.
+func CheckNames() []string {
+	names := []string{"bimi", "dkim", "dmarc", "domain", "mx", "spf"}
+
+	registry.RLock()
+	for _, check := range registry.checks {
+		names = append(names, check.Name())
+	}
+	registry.RUnlock()
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ValidateCheckName returns an error if the name isn't one of CheckNames.
+func ValidateCheckName(name string) error {
+	if names := CheckNames(); !slices.Contains(names, name) {
+		return fmt.Errorf("unknown check %q, expected one of %v", name, names)
+	}
+
+	return nil
+}
+
+// WithDisabledChecks skips the named checks of CheckAllInput (see CheckNames),
+// which then have no advice or timing.
+func WithDisabledChecks(names ...string) Option {
+	return func(a *Advisor) {
+		a.disabledChecks = append(a.disabledChecks, names...)
+	}
+}
+
+// checks returns the checks run by CheckAllInput that aren't disabled, the
+// built-in ones first.
+func (a *Advisor) checks(builtin ...Check) []Check {
+	registry.RLock()
+	checks := append(builtin, registry.checks...)
+	registry.RUnlock()
+
+	return slices.DeleteFunc(checks, func(check Check) bool { return slices.Contains(a.disabledChecks, check.Name()) })
+}
+
+// Validate returns an error wrapping ErrSwappedInput if one of the records
+// starts with another record's version tag, as the inputs were then likely
+// swapped. Records without a known version tag are left to the checks.
+func (input ScanInput) Validate() error {
+	_, err := input.validate()
+	return err
+}
+
+// clone returns a copy of the input that shares none of its slices, for a
+// check that modifies its input while the others read theirs.
+func (input *ScanInput) clone() *ScanInput {
+	clone := *input
+	clone.MX = slices.Clone(input.MX)
+	clone.Providers = slices.Clone(input.Providers)
+
+	return &clone
+}
+
+// validate returns the check of the first record that starts with another
+// record's version tag, and its error.
+func (input *ScanInput) validate() (string, error) {
+	for _, field := range inputRecords {
+		value := field.value(input)
+		version := strings.ToLower(strings.TrimSpace(value))
+		if end := strings.IndexAny(version, "; \t"); end >= 0 {
+			version = version[:end]
+		}
+
+		for _, other := range inputRecords {
+			if other.version == version && other.check != field.check {
+				return field.check, fmt.Errorf("%w: the %s record is %s %s record (%q), so the inputs are likely swapped", ErrSwappedInput, field.name, other.article, other.name, value)
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func (c checkFunc) Name() string {
+	return c.name
+}
+
+func (c checkFunc) Run(ctx context.Context, _ *ScanInput) ([]AdviceItem, error) {
+	return c.run(ctx)
+}
+
+func (c bimiCheck) Name() string {
+	return "bimi"
+}
+
+func (c bimiCheck) Run(ctx context.Context, input *ScanInput) ([]AdviceItem, error) {
+	advice, err := c.advisor.checkBIMI(ctx, input.BIMI)
+	if input.BIMI == "" {
+		return advice, err
+	}
+
+	// a subdomain without a DMARC record of its own is covered by its organizational domain's subdomain policy
+	if input.DMARC == "" && input.OrganizationalDMARC != "" {
+		return bimiEnforcement(advice, parseDMARC(input.OrganizationalDMARC), true), err
+	}
+
+	return bimiEnforcement(advice, c.dmarc, false), err
+}
+
+func (c mxCheck) Name() string {
+	return "mx"
+}
+
+func (c mxCheck) Run(ctx context.Context, input *ScanInput) ([]AdviceItem, error) {
+	// a subdomain that doesn't receive mail doesn't need mail servers
+	if len(input.MX) == 0 && c.advisor.SubdomainAdvice(input.Domain) {
+		return []string{subdomainMXAdvice(input.Domain)}, nil
+	}
+
+	return c.advisor.checkMX(ctx, input.MX)
+}
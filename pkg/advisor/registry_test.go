@@ -0,0 +1,187 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCheck only advises on the domains ending in .registry.example, so the other tests are unaffected.
+type testCheck struct{}
+
+func (testCheck) Name() string {
+	return "registrytest"
+}
+
+func (testCheck) Run(_ context.Context, input *ScanInput) ([]AdviceItem, error) {
+	switch input.Domain {
+	case "advised.registry.example":
+		return []AdviceItem{"Your domain was checked by the test check. No further action needed.", "Your DNS is failing validation, according to the test check.", "Your domain was checked by the test check. No further action needed."}, nil
+	case "failing.registry.example":
+		return nil, errors.New("test check failed")
+	case "modifying.registry.example":
+		// the check's own copy of the input, which the other checks mustn't see modified
+		input.MX[0] = "mx.registry.example."
+		input.MX = append(input.MX, "mx2.registry.example.")
+		input.Providers[0] = "Test"
+	}
+
+	return nil, nil
+}
+
+func init() {
+	Register(testCheck{})
+}
+
+func TestRegister(t *testing.T) {
+	for _, name := range []string{"", "Upper", "dmarc", "txt", "tls", "registrytest"} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registered %q, want a panic", name)
+				}
+			}()
+
+			Register(namedCheck(name))
+		})
+	}
+
+	if names := CheckNames(); !slices.Contains(names, "registrytest") || !slices.Contains(names, "spf") {
+		t.Errorf("found %v, want the built-in and registered checks", names)
+	}
+
+	if err := ValidateCheckName("registrytest"); err != nil {
+		t.Errorf("found %v, want no error", err)
+	}
+
+	if err := ValidateCheckName("unknown"); err == nil {
+		t.Error("found no error for an unknown check")
+	}
+}
+
+func TestScanInput_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    ScanInput
+		expected string
+	}{
+		{"Valid", ScanInput{BIMI: "v=BIMI1; l=https://example.com/logo.svg", DKIM: "v=DKIM1; k=rsa; p=KEY", DMARC: "v=DMARC1; p=none", SPF: "v=spf1 -all"}, ""},
+		{"Empty", ScanInput{}, ""},
+		{"Invalid", ScanInput{DKIM: "k=rsa; p=KEY", DMARC: "v=DMARC2; p=none", SPF: "include:example.com"}, ""},
+		{"DMARCAsDKIM", ScanInput{DKIM: "v=DMARC1; p=none"}, `record given as another: the DKIM record is a DMARC record ("v=DMARC1; p=none"), so the inputs are likely swapped`},
+		{"DKIMAsDMARC", ScanInput{DMARC: " V=DKIM1;k=rsa"}, `record given as another: the DMARC record is a DKIM record (" V=DKIM1;k=rsa"), so the inputs are likely swapped`},
+		{"SPFAsBIMI", ScanInput{BIMI: "v=spf1 -all"}, `record given as another: the BIMI record is an SPF record ("v=spf1 -all"), so the inputs are likely swapped`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.input.Validate()
+
+			if test.expected == "" {
+				if err != nil {
+					t.Errorf("found %v, want no error", err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, ErrSwappedInput) || err.Error() != test.expected {
+				t.Errorf("found %v, want %v", err, test.expected)
+			}
+		})
+	}
+}
+
+func TestAdvisor_CheckAllRegistered(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("Advised", func(t *testing.T) {
+		advice := advisor.CheckAll("advised.registry.example", "", "", "", nil, "")
+
+		// the extension's advice is tidied like the built-in checks'
+		expected := []string{"Your DNS is failing validation, according to the test check.", "Your domain was checked by the test check. No further action needed."}
+		if !slices.Equal(advice.Extensions["registrytest"], expected) {
+			t.Errorf("found %v, want %v", advice.Extensions["registrytest"], expected)
+		}
+
+		if _, ok := advice.Timings["registrytest_check"]; !ok {
+			t.Errorf("missing timing for registrytest_check in %v", advice.Timings)
+		}
+
+		findings := advice.Findings()
+		if last := findings[len(findings)-1]; last.Check != "registrytest" || last.Message != expected[1] {
+			t.Errorf("found %+v, want the extension's findings last", last)
+		}
+
+		if sorted := advice.Sorted(); !slices.Equal(sorted.Extensions["registrytest"], []string{expected[0], expected[1]}) {
+			t.Errorf("found %v, want the extension's advice sorted", sorted.Extensions)
+		}
+
+		if filtered := advice.Filter(SeverityCritical); filtered.Extensions != nil {
+			t.Errorf("found %v, want no extensions at critical severity", filtered.Extensions)
+		}
+	})
+
+	t.Run("Failing", func(t *testing.T) {
+		advice := advisor.CheckAll("failing.registry.example", "", "", "", nil, "")
+
+		if err := advice.Errors["registrytest"]; err == nil || !strings.Contains(err.Error(), "test check failed") {
+			t.Errorf("found %v, want the check's error", err)
+		}
+
+		if advice.Extensions != nil {
+			t.Errorf("found %v, want no extensions", advice.Extensions)
+		}
+	})
+
+	t.Run("Modifying", func(t *testing.T) {
+		offline := NewAdvisor(time.Second, time.Second, false, WithOffline(true))
+		mx := []string{"aspmx.l.google.com."}
+		advice := offline.CheckAllInput(context.Background(), ScanInput{Domain: "modifying.registry.example", MX: mx, SPF: "v=spf1 include:_spf.google.com -all"})
+
+		if !slices.Equal(mx, []string{"aspmx.l.google.com."}) {
+			t.Errorf("found %v, want the caller's MX records unmodified", mx)
+		}
+
+		if !slices.Equal(advice.Providers, []string{"Google Workspace"}) {
+			t.Errorf("found %v, want the detected providers unmodified", advice.Providers)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		disabled := NewAdvisor(time.Second, time.Second, false, WithDisabledChecks("bimi", "registrytest"))
+		advice := disabled.CheckAll("advised.registry.example", "", "", "", nil, "")
+
+		if advice.BIMI != nil || advice.Extensions != nil {
+			t.Errorf("found %v and %v, want the disabled checks to have no advice", advice.BIMI, advice.Extensions)
+		}
+
+		for _, name := range []string{"bimi_check", "registrytest_check"} {
+			if _, ok := advice.Timings[name]; ok {
+				t.Errorf("found a timing for %s in %v, want none", name, advice.Timings)
+			}
+		}
+
+		if advice.DMARC == nil {
+			t.Error("found no DMARC advice, want the other checks to run")
+		}
+
+		if config := disabled.Config(); !slices.Equal(config.DisabledChecks, []string{"bimi", "registrytest"}) || config.Extensions != nil {
+			t.Errorf("found %v and %v, want the disabled checks in the config", config.DisabledChecks, config.Extensions)
+		}
+	})
+}
+
+// namedCheck is a check with the given name, which never advises.
+type namedCheck string
+
+func (c namedCheck) Name() string {
+	return string(c)
+}
+
+func (c namedCheck) Run(context.Context, *ScanInput) ([]AdviceItem, error) {
+	return nil, nil
+}
@@ -0,0 +1,135 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type (
+	// ResolveOverride forces the TLS checks' connections to a host's port to
+	// an address of the caller's choosing, as curl's --resolve does, such as
+	// to check a new mail or web server before the DNS records are cut over
+	// to it. The host is still used for SNI and to verify the certificate.
+	ResolveOverride struct {
+		Host    string
+		Port    string
+		Address string
+	}
+
+	// resolveOverridesKey is the context key of the overrides of a single
+	// request (see ContextWithResolveOverrides).
+	resolveOverridesKey struct{}
+)
+
+// ParseResolveOverride parses an override in curl's --resolve format, such
+// as "mail.example.com:25:203.0.113.10" (with IPv6 addresses optionally in
+// brackets, as in "www.example.com:443:[2001:db8::1]").
+func ParseResolveOverride(value string) (ResolveOverride, error) {
+	host, rest, ok := strings.Cut(strings.TrimSpace(value), ":")
+	port, address, ok2 := strings.Cut(rest, ":")
+	if !ok || !ok2 {
+		return ResolveOverride{}, fmt.Errorf("invalid override %q, it must be formatted as host:port:address", value)
+	}
+
+	hostname, ok := normalizeHostname(host)
+	if !ok {
+		return ResolveOverride{}, fmt.Errorf("invalid override %q, it must start with a hostname", value)
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return ResolveOverride{}, fmt.Errorf("invalid override %q, its port must be between 1 and 65535", value)
+	}
+
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	if net.ParseIP(address) == nil {
+		return ResolveOverride{}, fmt.Errorf("invalid override %q, its address must be an IP address", value)
+	}
+
+	return ResolveOverride{Host: hostname, Port: strconv.Itoa(number), Address: address}, nil
+}
+
+// ParseResolveOverrides parses each override with ParseResolveOverride,
+// returning every error joined.
+func ParseResolveOverrides(values []string) ([]ResolveOverride, error) {
+	var (
+		overrides []ResolveOverride
+		errs      []error
+	)
+
+	for _, value := range values {
+		override, err := ParseResolveOverride(value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	return overrides, errors.Join(errs...)
+}
+
+// String returns the override in curl's --resolve format.
+func (o ResolveOverride) String() string {
+	address := o.Address
+	if strings.Contains(address, ":") {
+		address = "[" + address + "]"
+	}
+
+	return o.Host + ":" + o.Port + ":" + address
+}
+
+// WithResolveOverrides forces the TLS checks' connections to the given hosts
+// and ports to the overrides' addresses, for every scan (see
+// ContextWithResolveOverrides to override them for a single request). The
+// advice for an overridden connection is labeled with its address, so it
+// isn't mistaken for that of the live DNS records.
+func WithResolveOverrides(overrides ...ResolveOverride) Option {
+	return func(a *Advisor) {
+		a.resolveOverrides = overrides
+	}
+}
+
+// ContextWithResolveOverrides returns a copy of the context that forces the
+// TLS checks' connections to the given hosts and ports to the overrides'
+// addresses, as WithResolveOverrides does, taking precedence over the
+// advisor's own overrides for the same host and port.
+func ContextWithResolveOverrides(ctx context.Context, overrides ...ResolveOverride) context.Context {
+	if len(overrides) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, resolveOverridesKey{}, overrides)
+}
+
+// resolveOverride returns the address the connections to the host's port are
+// forced to, if they're overridden by the context or the advisor.
+func (a *Advisor) resolveOverride(ctx context.Context, hostname, port string) (string, bool) {
+	overrides, _ := ctx.Value(resolveOverridesKey{}).([]ResolveOverride)
+
+	for _, overrides := range [][]ResolveOverride{overrides, a.resolveOverrides} {
+		for _, override := range overrides {
+			if override.Port == port && strings.EqualFold(override.Host, hostname) {
+				return override.Address, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// overriddenAdvice labels each line of advice with the address its
+// connection was forced to, so it isn't mistaken for a live result.
+func overriddenAdvice(advice []string, address string) []string {
+	labeled := make([]string, 0, len(advice))
+	for _, line := range advice {
+		labeled = append(labeled, line+" (checked at "+address+" by a resolve override, not at the address published in DNS)")
+	}
+
+	return labeled
+}
@@ -0,0 +1,139 @@
+package advisor
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseResolveOverride(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected ResolveOverride
+		err      string
+	}{
+		{"mail.example.com:25:203.0.113.10", ResolveOverride{Host: "mail.example.com", Port: "25", Address: "203.0.113.10"}, ""},
+		{" www.example.com.:0443:[2001:db8::1] ", ResolveOverride{Host: "www.example.com", Port: "443", Address: "2001:db8::1"}, ""},
+		{"www.example.com:443:2001:db8::1", ResolveOverride{Host: "www.example.com", Port: "443", Address: "2001:db8::1"}, ""},
+		{"www.example.com:443", ResolveOverride{}, "it must be formatted as host:port:address"},
+		{":443:203.0.113.10", ResolveOverride{}, "it must start with a hostname"},
+		{"www.example.com:https:203.0.113.10", ResolveOverride{}, "its port must be between 1 and 65535"},
+		{"www.example.com:443:new.example.net", ResolveOverride{}, "its address must be an IP address"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			override, err := ParseResolveOverride(test.value)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("found %v, want an error containing %q", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("found %v, want no error", err)
+			}
+
+			if override != test.expected {
+				t.Errorf("found %+v, want %+v", override, test.expected)
+			}
+		})
+	}
+
+	if _, err := ParseResolveOverrides([]string{"a.example.com:25:192.0.2.1", "bad", "worse"}); err == nil || strings.Count(err.Error(), "invalid override") != 2 {
+		t.Errorf("found %v, want both invalid overrides reported", err)
+	}
+}
+
+func TestCheckHostTLS_ResolveOverride(t *testing.T) {
+	var (
+		serverNames []string
+		mutex       sync.Mutex
+	)
+
+	// the new host, which DNS doesn't point at yet, on a random port
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		mutex.Lock()
+		serverNames = append(serverNames, hello.ServerName)
+		mutex.Unlock()
+
+		return nil, nil
+	}}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	address, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	portNumber, _ := strconv.Atoi(port)
+
+	// cutover.invalid doesn't resolve, so the check can only succeed through the override
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithResolveOverrides(ResolveOverride{Host: "cutover.invalid", Port: port, Address: address}))
+
+	advice, _ := advisor.checkHostTLS(context.Background(), "cutover.invalid", portNumber)
+	if len(advice) != 2 {
+		t.Fatalf("found %v, want 2 lines", advice)
+	}
+
+	// the test server's certificate isn't trusted, so it's connected to again without verification
+	for _, line := range advice {
+		if !strings.HasSuffix(line, "(checked at "+address+" by a resolve override, not at the address published in DNS)") {
+			t.Errorf("found %q, want it labeled with the override", line)
+		}
+	}
+
+	if !strings.HasPrefix(advice[0], "No valid certificate could be found.") || !strings.HasPrefix(advice[1], "Your domain is using TLS 1.3") {
+		t.Errorf("found %v, want the certificate and TLS version advice", advice)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(serverNames) != 2 || serverNames[0] != "cutover.invalid" || serverNames[1] != "cutover.invalid" {
+		t.Errorf("found %v, want SNI to name the host on every connection", serverNames)
+	}
+}
+
+func TestCheckMailTLS_ResolveOverride(t *testing.T) {
+	dialer := &port25Dialer{err: errors.New("connection refused")}
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(dialer), WithProxy(ProxyConfig{}))
+
+	ctx := ContextWithResolveOverrides(context.Background(), ResolveOverride{Host: "mx.example.com", Port: "25", Address: "2001:db8::25"})
+
+	advice, _ := advisor.checkMX(ctx, []string{"mx.example.com.", "backup.example.com."})
+
+	if len(dialer.dials) != 2 || dialer.dials[0] != "[2001:db8::25]:25" {
+		t.Fatalf("found %v, want the overridden host dialed at its override", dialer.dials)
+	}
+
+	// the live host's advice isn't labeled, and isn't collapsed with the overridden one's
+	expected := []string{
+		"mx.example.com: Failed to reach domain (checked at 2001:db8::25 by a resolve override, not at the address published in DNS)",
+		"backup.example.com: Failed to reach domain",
+	}
+
+	if len(advice) < 2 || advice[len(advice)-2] != expected[0] || advice[len(advice)-1] != expected[1] {
+		t.Errorf("found %v, want it to end with %v", advice, expected)
+	}
+
+	// the advisor's cache doesn't serve the overridden advice without the override
+	if live := advisor.CheckMX([]string{"mx.example.com."}); strings.Contains(strings.Join(live, " "), "resolve override") {
+		t.Errorf("found %v, want the live host's advice", live)
+	}
+}
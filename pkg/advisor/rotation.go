@@ -0,0 +1,128 @@
+package advisor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// selectorDigits matches each run of digits in a selector.
+	selectorDigits = regexp.MustCompile(`\d+`)
+
+	// selectorSeparatedDate matches a year and month (and optionally a day)
+	// separated by dashes, underscores or dots, such as "s2048-2023-08".
+	selectorSeparatedDate = regexp.MustCompile(`(?:^|\D)(20\d{2})[-_.](0[1-9]|1[0-2])(?:[-_.](0[1-9]|[12]\d|3[01]))?(?:\D|$)`)
+
+	// selectorMonthName matches a month's name (or abbreviation) directly
+	// followed by a year, such as "dec2023" or "march-2024".
+	selectorMonthName = regexp.MustCompile(`(?i)(?:^|[^a-z])(january|february|march|april|may|june|july|august|september|october|november|december|jan|feb|mar|apr|jun|jul|aug|sept|sep|oct|nov|dec)[-_.]?(20\d{2})(?:\D|$)`)
+
+	monthNames = map[string]time.Month{
+		"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+		"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+		"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+	}
+)
+
+// CheckDKIMRotation suggests rotating the DKIM key if the newest of the given
+// selectors embeds a date (such as "s2048-2023-08" or "20230601") older than
+// the advisor's rotation age. Selectors without a recognizable date are
+// ignored, as the age of their key can't be inferred.
+func (a *Advisor) CheckDKIMRotation(selectors ...string) []string {
+	return dkimRotationAdvice(selectors, time.Now(), a.dkimRotationMonths)
+}
+
+// dkimRotationAdvice returns the rotation advice for the newest dated
+// selector, relative to now.
+func dkimRotationAdvice(selectors []string, now time.Time, months int) []string {
+	if months <= 0 {
+		return nil
+	}
+
+	var (
+		newest   time.Time
+		selector string
+	)
+
+	for _, candidate := range selectors {
+		if date, ok := selectorDate(candidate, now); ok && date.After(newest) {
+			newest, selector = date, candidate
+		}
+	}
+
+	if selector == "" || !newest.AddDate(0, months, 0).Before(now) {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("Your DKIM selector %q suggests its key was created around %s, over %d months ago. Consider rotating your DKIM key by publishing a new selector, if it hasn't been rotated since.", selector, newest.Format("January 2006"), months)}
+}
+
+// selectorDate infers the date embedded in a selector's name. Only full dates
+// (to at least the month) are recognized, and dates before 2004 (when DKIM's
+// predecessor was published) or in the future are rejected, so key sizes
+// (such as "s2048") and counters (such as "s1") are never mistaken for a date.
+func selectorDate(selector string, now time.Time) (time.Time, bool) {
+	selector = strings.ToLower(selector)
+
+	if match := selectorSeparatedDate.FindStringSubmatch(selector); match != nil {
+		day := 1
+		if match[3] != "" {
+			day, _ = strconv.Atoi(match[3])
+		}
+
+		year, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+
+		if date, ok := validSelectorDate(year, time.Month(month), day, now); ok {
+			return date, true
+		}
+	}
+
+	if match := selectorMonthName.FindStringSubmatch(selector); match != nil {
+		year, _ := strconv.Atoi(match[2])
+
+		if date, ok := validSelectorDate(year, monthNames[match[1][:3]], 1, now); ok {
+			return date, true
+		}
+	}
+
+	for _, digits := range selectorDigits.FindAllString(selector, -1) {
+		var layout string
+
+		// compact dates may be followed by a time, as with Postmark's "20161025154705pm"
+		switch len(digits) {
+		case 6:
+			layout = "200601"
+		case 8, 12, 14:
+			layout, digits = "20060102", digits[:8]
+		default:
+			continue
+		}
+
+		date, err := time.Parse(layout, digits)
+		if err != nil {
+			continue
+		}
+
+		if date, ok := validSelectorDate(date.Year(), date.Month(), date.Day(), now); ok {
+			return date, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// validSelectorDate returns the date if it's a real date between 2004 and now.
+func validSelectorDate(year int, month time.Month, day int, now time.Time) (time.Time, bool) {
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	// time.Date normalizes out of range days (such as 31 February), which aren't real dates
+	if date.Day() != day || date.Month() != month || year < 2004 || date.After(now) {
+		return time.Time{}, false
+	}
+
+	return date, true
+}
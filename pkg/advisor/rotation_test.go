@@ -0,0 +1,110 @@
+package advisor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSelectorDate(t *testing.T) {
+	now := time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		selector string
+		expected string // as YYYY-MM-DD, or empty if no date should be inferred
+	}{
+		// dated selectors
+		{selector: "20230601", expected: "2023-06-01"},         // Google date-rotated
+		{selector: "s2048-2023-08", expected: "2023-08-01"},    // key size and year-month
+		{selector: "s1024-2013-05-20", expected: "2013-05-20"}, // key size and full date
+		{selector: "mimecast20190104", expected: "2019-01-04"}, // Mimecast
+		{selector: "20161025154705pm", expected: "2016-10-25"}, // Postmark
+		{selector: "pf2023_11", expected: "2023-11-01"},
+		{selector: "key.2022.02", expected: "2022-02-01"},
+		{selector: "dkim202104", expected: "2021-04-01"},
+		{selector: "202402120000", expected: "2024-02-12"},
+		{selector: "dec2023", expected: "2023-12-01"},
+		{selector: "March-2022", expected: "2022-03-01"},
+		{selector: "sel-sept2021", expected: "2021-09-01"},
+
+		// undated selectors
+		{selector: "s1"},
+		{selector: "s2"},
+		{selector: "k1"},
+		{selector: "selector1"},           // Microsoft
+		{selector: "google"},              // Google
+		{selector: "s2048"},               // Yahoo
+		{selector: "s1024"},               // Yahoo
+		{selector: "everlytickey1"},       // Everlytic
+		{selector: "hs1-20061504"},        // HubSpot, with an account number that isn't a date
+		{selector: "smartmail2023"},       // a month's name inside another word
+		{selector: "sendgrid2024"},        // a year alone
+		{selector: "2023"},                // a year alone
+		{selector: "s20230231"},           // no such day
+		{selector: "s20231301"},           // no such month
+		{selector: "19991231"},            // predates DKIM
+		{selector: "20250101"},            // in the future
+		{selector: "1686787200"},          // a Unix timestamp
+		{selector: "ug7nbtf4gccmlpwj322"}, // Amazon SES
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.selector, func(t *testing.T) {
+			date, ok := selectorDate(testCase.selector, now)
+
+			found := ""
+			if ok {
+				found = date.Format("2006-01-02")
+			}
+
+			if found != testCase.expected {
+				t.Errorf("found %q, want %q", found, testCase.expected)
+			}
+		})
+	}
+}
+
+func TestDKIMRotationAdvice(t *testing.T) {
+	now := time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Old", func(t *testing.T) {
+		advice := dkimRotationAdvice([]string{"s2048-2023-05"}, now, 12)
+		expected := []string{`Your DKIM selector "s2048-2023-05" suggests its key was created around May 2023, over 12 months ago. Consider rotating your DKIM key by publishing a new selector, if it hasn't been rotated since.`}
+
+		if !reflect.DeepEqual(advice, expected) {
+			t.Errorf("found %v, want %v", advice, expected)
+		}
+
+		if severity := Classify(advice[0]); severity != SeverityLow {
+			t.Errorf("found %v, want %v", severity, SeverityLow)
+		}
+	})
+
+	t.Run("Recent", func(t *testing.T) {
+		if advice := dkimRotationAdvice([]string{"s2048-2023-07"}, now, 12); advice != nil {
+			t.Errorf("found %v, want no advice", advice)
+		}
+	})
+
+	t.Run("Newest", func(t *testing.T) {
+		if advice := dkimRotationAdvice([]string{"20200101", "s1", "20240101"}, now, 12); advice != nil {
+			t.Errorf("found %v, want no advice as the newest key is recent", advice)
+		}
+	})
+
+	t.Run("Threshold", func(t *testing.T) {
+		if advice := dkimRotationAdvice([]string{"20240101"}, now, 3); len(advice) != 1 {
+			t.Errorf("found %v, want advice with a 3 month threshold", advice)
+		}
+
+		if advice := dkimRotationAdvice([]string{"20100101"}, now, 0); advice != nil {
+			t.Errorf("found %v, want no advice when disabled", advice)
+		}
+	})
+
+	t.Run("Undated", func(t *testing.T) {
+		if advice := dkimRotationAdvice([]string{"s1", "selector1", "google"}, now, 12); advice != nil {
+			t.Errorf("found %v, want no advice", advice)
+		}
+	})
+}
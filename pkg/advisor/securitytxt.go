@@ -0,0 +1,329 @@
+package advisor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// securityTxtCacheLifetime is how long a domain's security.txt file is
+	// cached by default (see CacheSecurityContacts), as it rarely changes
+	// between scans.
+	securityTxtCacheLifetime = 24 * time.Hour
+
+	// securityTxtMaxSize bounds the security.txt file read, which is only a
+	// handful of fields.
+	securityTxtMaxSize = 32 << 10
+
+	// securityTxtMaxValidity is how far ahead a security.txt file's Expires
+	// field should be, as RFC 9116 recommends less than a year.
+	securityTxtMaxValidity = 366 * 24 * time.Hour
+)
+
+type (
+	// SecurityContacts are the contacts a domain publishes for reporting
+	// security issues, from its security.txt file (RFC 9116), along with the
+	// SOA and DMARC report mailboxes that serve as fallbacks, only included in
+	// detailed output.
+	SecurityContacts struct {
+		SecurityTxt string     `json:"securityTxt,omitempty" yaml:"securityTxt,omitempty" doc:"The URL the domain's security.txt file was fetched from, after any redirects, if it publishes one." example:"https://www.example.com/.well-known/security.txt"`
+		Contacts    []string   `json:"contacts,omitempty" yaml:"contacts,omitempty" doc:"The Contact fields of the security.txt file, in order of preference." example:"mailto:security@example.com"`
+		Expires     *time.Time `json:"expires,omitempty" yaml:"expires,omitempty" doc:"When the security.txt file expires, if it has a valid Expires field."`
+		SOA         string     `json:"soa,omitempty" yaml:"soa,omitempty" doc:"The mailbox the zone's SOA RNAME stands for, if it's the apex of a zone." example:"hostmaster@example.com"`
+		DMARC       []string   `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The mailboxes the DMARC record's aggregate reports are sent to." example:"dmarc@example.com"`
+		Reachable   bool       `json:"reachable" yaml:"reachable" doc:"Whether the domain publishes any security contact that can be reached: a current security.txt file with a contact, or a fallback mailbox whose domain accepts mail." example:"true"`
+	}
+
+	// securityTxtCache caches the domains' security.txt files, sharing each
+	// fetch between concurrent callers.
+	securityTxtCache struct {
+		cache *cache.Cache[securityTxt]
+		group singleflight.Group
+	}
+
+	// securityTxt is a domain's security.txt file, as fetched, or why it
+	// couldn't be used.
+	securityTxt struct {
+		url      string
+		contacts []string
+		expires  *time.Time
+
+		// problem is why the file isn't published as RFC 9116 requires (such
+		// as it returning 404 Not Found), if it isn't.
+		problem string
+	}
+
+	// securityTxtError is why a security.txt file that was fetched can't be
+	// used.
+	securityTxtError string
+)
+
+func (e securityTxtError) Error() string {
+	return string(e)
+}
+
+// WithSecurityTxt enables the security contact check, which fetches each
+// domain's security.txt file (RFC 9116) from
+// https://<domain>/.well-known/security.txt, and reports whether the domain
+// publishes any reachable contact for security issues, falling back to its
+// SOA and DMARC report mailboxes. It's disabled by default, as it fetches a
+// file from every scanned domain's web server.
+func WithSecurityTxt(enabled bool) Option {
+	return func(a *Advisor) {
+		a.securityTxtEnabled = enabled
+	}
+}
+
+// CheckSecurityContacts returns advice on the domain's security contacts: its
+// security.txt file, and whether the mailboxes of its SOA RNAME and DMARC
+// record (if any) can stand in for one, along with the contacts found. Both
+// are nil if the check isn't enabled.
+func (a *Advisor) CheckSecurityContacts(ctx context.Context, domain, rname, dmarc string) ([]string, *SecurityContacts) {
+	if a.securityTxt == nil {
+		return nil, nil
+	}
+
+	if a.isOffline(ctx) {
+		return []string{skippedOffline("The security contact check of your domain")}, nil
+	}
+
+	if a.checkTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.checkTimeout)
+		defer cancel()
+	}
+
+	domain = normalizeDomain(domain)
+	contacts := &SecurityContacts{}
+
+	// the fallbacks are only reachable if their domains accept mail
+	var fallbacks []string
+
+	if mailbox, ok := rnameMailbox(rname); ok {
+		if address, err := parseEmail(mailbox); err == nil {
+			contacts.SOA = address.String()
+			if a.undeliverable(ctx, address.asciiDomain) == "" {
+				fallbacks = append(fallbacks, contacts.SOA)
+			}
+		}
+	}
+
+	if dmarc != "" {
+		for _, address := range reportAddresses(parseDMARC(dmarc)) {
+			if mailbox := address.String(); !containsFold(contacts.DMARC, mailbox) {
+				contacts.DMARC = append(contacts.DMARC, mailbox)
+				if a.undeliverable(ctx, address.asciiDomain) == "" && !containsFold(fallbacks, mailbox) {
+					fallbacks = append(fallbacks, mailbox)
+				}
+			}
+		}
+	}
+
+	securityTxtURL := "https://" + domain + "/.well-known/security.txt"
+
+	file, err := a.lookupSecurityTxt(ctx, domain, securityTxtURL)
+	if err != nil {
+		contacts.Reachable = len(fallbacks) > 0
+
+		var unavailable *unavailableError
+		if errors.As(err, &unavailable) || ctx.Err() != nil {
+			return []string{fmt.Sprintf("We couldn't fetch your security.txt file from %s, so your domain's security contacts weren't checked.", securityTxtURL)}, contacts
+		}
+
+		file = &securityTxt{problem: mtaSTSFetchFailure(err)}
+	}
+
+	if file.problem != "" {
+		contacts.Reachable = len(fallbacks) > 0
+
+		if len(fallbacks) > 0 {
+			return []string{fmt.Sprintf("Your domain doesn't publish a security.txt file at %s, as %s, so security issues can only be reported to %s, which may not reach the people who handle them. Publish a security.txt file with a Contact and an Expires field.", securityTxtURL, file.problem, joinNames(fallbacks))}, contacts
+		}
+
+		return []string{fmt.Sprintf("Your domain doesn't publish a security.txt file at %s, as %s, nor an SOA or DMARC report mailbox that accepts mail, so there's no reachable contact for reporting security issues with it. Publish a security.txt file with a Contact and an Expires field.", securityTxtURL, file.problem)}, contacts
+	}
+
+	contacts.SecurityTxt, contacts.Contacts, contacts.Expires = file.url, file.contacts, file.expires
+
+	var advice []string
+
+	now := time.Now()
+
+	if len(file.contacts) == 0 {
+		advice = append(advice, fmt.Sprintf("Your security.txt file at %s has no Contact field, which RFC 9116 requires, so it doesn't say where to report security issues. Add a Contact field with a mailto: or https: URI.", file.url))
+	}
+
+	switch {
+	case file.expires == nil:
+		advice = append(advice, fmt.Sprintf("Your security.txt file at %s has no valid Expires field, which RFC 9116 requires, so researchers can't tell whether its contacts are current. Add an Expires field with a date under a year away, such as %s.", file.url, now.AddDate(0, 6, 0).UTC().Format(time.RFC3339)))
+	case file.expires.Before(now):
+		advice = append(advice, fmt.Sprintf("Your security.txt file at %s expired on %s, so researchers treat its contacts as stale. Check its contacts are current, then move its Expires field forward.", file.url, file.expires.Format(time.DateOnly)))
+	case file.expires.After(now.Add(securityTxtMaxValidity)):
+		advice = append(advice, fmt.Sprintf("Your security.txt file at %s doesn't expire until %s, more than the year RFC 9116 recommends. Bring its Expires field forward, and review its contacts whenever you do.", file.url, file.expires.Format(time.DateOnly)))
+	}
+
+	// an expired file's contacts may no longer be read, so only the fallbacks are relied on
+	current := len(file.contacts) > 0 && file.expires != nil && !file.expires.Before(now)
+	contacts.Reachable = current || len(fallbacks) > 0
+
+	if len(advice) == 0 {
+		advice = append(advice, fmt.Sprintf("Your domain publishes a security.txt file at %s, valid until %s, with %s as its preferred contact. No further action needed.", file.url, file.expires.Format(time.DateOnly), file.contacts[0]))
+	}
+
+	return advice, contacts
+}
+
+// lookupSecurityTxt returns the domain's security.txt file, caching it with
+// the domain's tags. Only files that were fetched (or were missing) are
+// cached, rather than connections that failed.
+func (a *Advisor) lookupSecurityTxt(ctx context.Context, domain, securityTxtURL string) (*securityTxt, error) {
+	if file := a.securityTxt.cache.Get(domain); file != nil {
+		return file, nil
+	}
+
+	result, err, _ := a.securityTxt.group.Do(domain, func() (any, error) {
+		file, err := a.fetchSecurityTxt(ctx, securityTxtURL)
+
+		var fileErr securityTxtError
+		if errors.As(err, &fileErr) {
+			file, err = &securityTxt{problem: string(fileErr)}, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		a.securityTxt.cache.SetTagged(domain, file, cacheTags(ctx, domain)...)
+
+		return file, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*securityTxt), nil
+}
+
+// fetchSecurityTxt fetches and parses the security.txt file at the URL,
+// following redirects (such as to the www host) as long as they stay on
+// HTTPS. It's only used if it's served as text/plain with a 200 status (RFC
+// 9116, section 3), as many web servers answer any path with an HTML page.
+func (a *Advisor) fetchSecurityTxt(ctx context.Context, securityTxtURL string) (*securityTxt, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, securityTxtURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := a.doWithRetry(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	fetchedURL := securityTxtURL
+	if response.Request != nil {
+		fetchedURL = response.Request.URL.String()
+	}
+
+	if !strings.HasPrefix(fetchedURL, "https://") {
+		return nil, securityTxtError(fmt.Sprintf("it redirects to %s, which isn't served over HTTPS", fetchedURL))
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, securityTxtError("it returned " + response.Status)
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type")); mediaType != "text/plain" {
+		return nil, securityTxtError(fmt.Sprintf("it's served as %q rather than text/plain", response.Header.Get("Content-Type")))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, securityTxtMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > securityTxtMaxSize {
+		return nil, securityTxtError(fmt.Sprintf("it's larger than %dKB", securityTxtMaxSize/1024))
+	}
+
+	file := parseSecurityTxt(string(body))
+	file.url = fetchedURL
+
+	return file, nil
+}
+
+// parseSecurityTxt parses the Contact and Expires fields of a security.txt
+// file (RFC 9116, section 2.5), which may be signed with OpenPGP cleartext
+// signatures. Field names are case-insensitive, comments start with #, and an
+// Expires field that appears more than once is only taken the first time.
+func parseSecurityTxt(body string) *securityTxt {
+	file := &securityTxt{}
+	signed := false
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "-----BEGIN PGP SIGNED MESSAGE-----":
+			// the armor headers (such as Hash: SHA256) run until the first empty line
+			signed = true
+
+			for scanner.Scan() && strings.TrimSpace(scanner.Text()) != "" {
+			}
+
+			continue
+		case line == "-----BEGIN PGP SIGNATURE-----":
+			return file
+		case signed:
+			// dash-escaped lines (RFC 4880, section 7.1) start with "- "
+			line = strings.TrimPrefix(line, "- ")
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "contact":
+			if value != "" {
+				file.contacts = append(file.contacts, value)
+			}
+		case "expires":
+			if expires, err := time.Parse(time.RFC3339, value); err == nil && file.expires == nil {
+				expires = expires.UTC()
+				file.expires = &expires
+			}
+		}
+	}
+
+	return file
+}
+
+// containsFold reports whether the values contain the value, ignoring case.
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+
+	return false
+}
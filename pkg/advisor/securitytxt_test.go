@@ -0,0 +1,221 @@
+package advisor
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CheckSecurityContacts(t *testing.T) {
+	expires := time.Now().AddDate(0, 6, 0).UTC().Format(time.RFC3339)
+	valid := "# Our security policy\nContact: mailto:security@example.com\ncontact: https://example.com/security\nExpires: " + expires + "\n"
+
+	files := map[string]string{
+		"valid.example":             valid,
+		"www.redirect.example":      valid,
+		"html.example":              valid,
+		"expired.example":           "Contact: mailto:security@example.com\nExpires: 2020-01-01T00:00:00Z\n",
+		"distant.example":           "Contact: mailto:security@example.com\nExpires: " + time.Now().AddDate(3, 0, 0).UTC().Format(time.RFC3339) + "\n",
+		"incomplete.example":        "Policy: https://example.com/policy\nExpires: " + expires + "\n",
+		"signed.example":            "-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA256\n\n- Contact: mailto:security@example.com\nExpires: " + expires + "\n-----BEGIN PGP SIGNATURE-----\n\nContact: mailto:forged@example.com\n-----END PGP SIGNATURE-----\n",
+		"www.plainredirect.example": valid,
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/.well-known/security.txt":
+			http.NotFound(w, r)
+		case r.Host == "redirect.example":
+			http.Redirect(w, r, "https://www.redirect.example/.well-known/security.txt", http.StatusMovedPermanently)
+		case r.Host == "plainredirect.example":
+			http.Redirect(w, r, "http://www.plainredirect.example/.well-known/security.txt", http.StatusMovedPermanently)
+		case files[r.Host] == "":
+			http.NotFound(w, r)
+		case r.Host == "html.example":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(files[r.Host]))
+		default:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(files[r.Host]))
+		}
+	}))
+
+	// the redirect to HTTP is followed to the test server, which logs it as a failed handshake
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	// every host is served by the test server, whose certificate is for example.com
+	client := server.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.ServerName = "example.com"
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	advisor := NewAdvisor(time.Second, time.Minute, false, WithHTTPClient(client), WithHTTPRetry(1, 0), WithSecurityTxt(true))
+	t.Cleanup(advisor.Close)
+
+	// seed the cache so no lookups are made for the fallback mailboxes' domains
+	deliverable, undeliverable := "", "has no MX or address records"
+	advisor.mailDomainCache.Set("example.com", &deliverable)
+	advisor.mailDomainCache.Set("reports.example", &deliverable)
+	advisor.mailDomainCache.Set("nowhere.example", &undeliverable)
+
+	tests := []struct {
+		name      string
+		domain    string
+		rname     string
+		dmarc     string
+		prefix    string
+		severity  Severity
+		url       string
+		reachable bool
+	}{
+		{
+			name:      "Valid",
+			domain:    "valid.example",
+			prefix:    "Your domain publishes a security.txt file at https://valid.example/.well-known/security.txt, valid until",
+			severity:  SeverityInfo,
+			url:       "https://valid.example/.well-known/security.txt",
+			reachable: true,
+		},
+		{
+			name:      "RedirectToWWW",
+			domain:    "redirect.example",
+			prefix:    "Your domain publishes a security.txt file at https://www.redirect.example/.well-known/security.txt, valid until",
+			severity:  SeverityInfo,
+			url:       "https://www.redirect.example/.well-known/security.txt",
+			reachable: true,
+		},
+		{
+			name:     "RedirectToHTTP",
+			domain:   "plainredirect.example",
+			prefix:   "Your domain doesn't publish a security.txt file at https://plainredirect.example/.well-known/security.txt, as it redirects to http://www.plainredirect.example/.well-known/security.txt, which isn't served over HTTPS, nor an SOA",
+			severity: SeverityMedium,
+		},
+		{
+			name:      "Signed",
+			domain:    "signed.example",
+			prefix:    "Your domain publishes a security.txt file at https://signed.example/.well-known/security.txt",
+			severity:  SeverityInfo,
+			url:       "https://signed.example/.well-known/security.txt",
+			reachable: true,
+		},
+		{
+			name:     "Expired",
+			domain:   "expired.example",
+			prefix:   "Your security.txt file at https://expired.example/.well-known/security.txt expired on 2020-01-01",
+			severity: SeverityMedium,
+			url:      "https://expired.example/.well-known/security.txt",
+		},
+		{
+			name:      "ExpiredWithFallback",
+			domain:    "expired.example",
+			rname:     "hostmaster.example.com.",
+			prefix:    "Your security.txt file at https://expired.example/.well-known/security.txt expired on 2020-01-01",
+			severity:  SeverityMedium,
+			url:       "https://expired.example/.well-known/security.txt",
+			reachable: true,
+		},
+		{
+			name:      "Distant",
+			domain:    "distant.example",
+			prefix:    "Your security.txt file at https://distant.example/.well-known/security.txt doesn't expire until",
+			severity:  SeverityLow,
+			url:       "https://distant.example/.well-known/security.txt",
+			reachable: true,
+		},
+		{
+			name:     "Incomplete",
+			domain:   "incomplete.example",
+			prefix:   "Your security.txt file at https://incomplete.example/.well-known/security.txt has no Contact field",
+			severity: SeverityMedium,
+			url:      "https://incomplete.example/.well-known/security.txt",
+		},
+		{
+			name:     "HTML",
+			domain:   "html.example",
+			prefix:   "Your domain doesn't publish a security.txt file at https://html.example/.well-known/security.txt, as it's served as \"text/html\" rather than text/plain",
+			severity: SeverityMedium,
+		},
+		{
+			name:     "Missing",
+			domain:   "missing.example",
+			prefix:   "Your domain doesn't publish a security.txt file at https://missing.example/.well-known/security.txt, as it returned 404 Not Found, nor an SOA or DMARC report mailbox that accepts mail",
+			severity: SeverityMedium,
+		},
+		{
+			name:      "MissingWithFallbacks",
+			domain:    "missing.example",
+			rname:     "hostmaster.example.com.",
+			dmarc:     "v=DMARC1; p=reject; rua=mailto:dmarc@reports.example,mailto:dmarc@nowhere.example",
+			prefix:    "Your domain doesn't publish a security.txt file at https://missing.example/.well-known/security.txt, as it returned 404 Not Found, so security issues can only be reported to hostmaster@example.com and dmarc@reports.example,",
+			severity:  SeverityLow,
+			reachable: true,
+		},
+		{
+			name:     "MissingWithUndeliverableFallback",
+			domain:   "missing.example",
+			dmarc:    "v=DMARC1; p=reject; rua=mailto:dmarc@nowhere.example",
+			prefix:   "Your domain doesn't publish a security.txt file at https://missing.example/.well-known/security.txt, as it returned 404 Not Found, nor an SOA",
+			severity: SeverityMedium,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice, contacts := advisor.CheckSecurityContacts(context.Background(), test.domain, test.rname, test.dmarc)
+
+			if len(advice) != 1 || !strings.HasPrefix(advice[0], test.prefix) {
+				t.Fatalf("found %v, want advice starting with %q", advice, test.prefix)
+			}
+
+			if severity := Classify(advice[0]); severity != test.severity {
+				t.Errorf("found %v, want %v", severity, test.severity)
+			}
+
+			if contacts == nil || contacts.SecurityTxt != test.url || contacts.Reachable != test.reachable {
+				t.Errorf("found %+v, want the file at %q, reachable %v", contacts, test.url, test.reachable)
+			}
+		})
+	}
+
+	t.Run("Contacts", func(t *testing.T) {
+		_, contacts := advisor.CheckSecurityContacts(context.Background(), "signed.example", "hostmaster.example.com.", "v=DMARC1; p=none; rua=mailto:dmarc@reports.example")
+
+		// the contact outside the signed message isn't part of the file
+		if len(contacts.Contacts) != 1 || contacts.Contacts[0] != "mailto:security@example.com" || contacts.Expires == nil {
+			t.Errorf("found %v expiring %v, want the signed file's contact and expiry", contacts.Contacts, contacts.Expires)
+		}
+
+		if contacts.SOA != "hostmaster@example.com" || len(contacts.DMARC) != 1 || contacts.DMARC[0] != "dmarc@reports.example" {
+			t.Errorf("found %q and %v, want the fallback mailboxes", contacts.SOA, contacts.DMARC)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		disabled := NewAdvisor(time.Second, time.Minute, false)
+		t.Cleanup(disabled.Close)
+
+		if advice, contacts := disabled.CheckSecurityContacts(context.Background(), "valid.example", "", ""); advice != nil || contacts != nil {
+			t.Errorf("found %v and %v, want nothing", advice, contacts)
+		}
+	})
+
+	t.Run("Offline", func(t *testing.T) {
+		offline := NewAdvisor(time.Second, time.Minute, false, WithSecurityTxt(true), WithOffline(true))
+		t.Cleanup(offline.Close)
+
+		if advice, _ := offline.CheckSecurityContacts(context.Background(), "valid.example", "", ""); len(advice) != 1 || !strings.Contains(advice[0], offlinePhrase) {
+			t.Errorf("found %v, want the check skipped", advice)
+		}
+	})
+}
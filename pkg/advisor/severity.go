@@ -0,0 +1,397 @@
+package advisor
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Severity ranks how urgently a piece of advice should be acted on.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+type (
+	// Finding is a single line of advice with its severity, along with a
+	// reference explaining it and how to fix it, if it's in the catalog of
+	// severity rules.
+	Finding struct {
+		Check       string
+		Message     string
+		Severity    Severity
+		Reference   string
+		Remediation string
+
+		// Rule is the phrase of the catalog entry that matched the advice, if any.
+		Rule string
+	}
+
+	// adviceSection points to the advice of a single check.
+	adviceSection struct {
+		name   string
+		advice *[]string
+	}
+
+	// severityRule assigns a severity to any advice containing its phrase,
+	// along with a reference URL explaining the advice and a short
+	// remediation.
+	severityRule struct {
+		phrase      string
+		severity    Severity
+		reference   string
+		remediation string
+	}
+)
+
+var severityNames = map[Severity]string{
+	SeverityInfo:     "info",
+	SeverityLow:      "low",
+	SeverityMedium:   "medium",
+	SeverityHigh:     "high",
+	SeverityCritical: "critical",
+}
+
+// the references cited by the severity rules
+const (
+	dmarcGuide = "https://dmarcguide.globalcyberalliance.org"
+	readme     = "https://github.com/GlobalCyberAlliance/domain-security-scanner#"
+	rfc        = "https://www.rfc-editor.org/rfc/rfc"
+	bimiDraft  = "https://datatracker.ietf.org/doc/html/draft-brand-indicators-for-message-identification"
+)
+
+// severityRules are matched in order, so more specific phrases must come
+// before more general ones. Advice that matches no rule is informational. The
+// rules are the catalog of every finding the advisor reports: each cites a
+// reference explaining it (our docs, or the relevant RFC section), and how to
+// fix it.
+var severityRules = []severityRule{
+	// checks skipped in offline mode haven't failed, they just weren't run
+	{offlinePhrase, SeverityInfo, readme + "offline-mode", "Run the scan from a host with internet access to complete the skipped checks."},
+
+	// mail servers behind a blocked port 25 weren't checked, which says nothing about them
+	{port25BlockedPhrase, SeverityInfo, readme + "blocked-port-25", "Run the scan from a host that can connect to port 25 to check your mail servers' TLS."},
+
+	// deferred mail servers weren't checked, which says nothing about their TLS
+	{deferredPhrase, SeverityInfo, readme + "bulk-scan-domains", "Scan again once the cooldown has passed to check the mail server's TLS."},
+
+	// DKIM keys that weren't looked up say nothing about whether they're published
+	{dkimSkippedPhrase, SeverityInfo, readme + "dkim-discovery", "Scan with the selectors your sending services sign with, such as with --selector."},
+
+	// assets whose hosts were unavailable couldn't be checked, which says nothing about them
+	{unavailablePhrase, SeverityInfo, readme + "unavailable-asset-hosts", "Scan again later, once the asset's host is reachable."},
+
+	// shared provider ranges are often listed, so listings aren't necessarily the domain's fault
+	{sharedRangesPhrase, SeverityInfo, rfc + "5782", "Contact your provider about listed shared addresses, and request delisting for any addresses you control."},
+
+	// lookalikes are someone else's domains, which may well be legitimate
+	{legitimateLookalikesPhrase, SeverityInfo, readme + "lookalike-domains", "Check who registered lookalikes that are set up for mail, and consider registering the likeliest ones yourself."},
+
+	// mail servers that couldn't be probed say nothing about whether they'd pass an MTA-STS policy
+	{"but its certificate couldn't be checked", SeverityInfo, readme + "mta-sts-policies", "Scan again from a host that can reach the mail server on port 25 to verify its certificate."},
+	{"Your MTA-STS policy is in mode: none", SeverityInfo, rfc + "8461#section-5", "Publish the policy in mode: testing, then mode: enforce once your mail servers pass it."},
+
+	// a record hosted by a managed service is checked as usual, so being hosted there isn't a finding
+	{managedPhrase, SeverityInfo, readme + "managed-dmarc-and-spf-services", "Change the record in the managed service's dashboard rather than in your DNS."},
+
+	// why a record is missing only explains the check's advice, which carries its severity
+	{"(NXDOMAIN)", SeverityInfo, rfc + "2308#section-2.1", "Create the name by publishing the record at it."},
+	{"(NOERROR)", SeverityInfo, rfc + "2308#section-2.2", "Add the record at the name, or at the target of its CNAME."},
+
+	// a name that fails to resolve hides whatever is published at it
+	{"Your DNS is failing validation", SeverityHigh, rfc + "4035#section-5.5", "Fix the zone's DNSSEC signatures, or the DS record at its parent zone, so the name validates."},
+	{"couldn't be checked, as the lookup of", SeverityMedium, rfc + "1035#section-4.1.1", "Make sure your nameservers answer queries for the name, then scan again."},
+	{dkimFailedPhrase, SeverityLow, readme + "dkim-discovery", "Make sure your nameservers answer queries under _domainkey, and the scanner's resolver is reachable, then scan again."},
+
+	// missing or permissive records leave the domain open to spoofing
+	{"You do not have DMARC setup!", SeverityCritical, rfc + "7489#section-6.1", "Publish a DMARC record at _dmarc.<domain>, starting at p=none with a rua tag."},
+	{"There's no real DMARC record for your domain", SeverityCritical, rfc + "7489#section-6.1", "Publish a DMARC record at _dmarc.<domain> rather than relying on the wildcard TXT record."},
+	{"We couldn't detect any active SPF record", SeverityCritical, rfc + "7208#section-3", "Publish a TXT record starting with v=spf1 that lists your sending services and ends in ~all or -all."},
+	{"Your SPF record contains the +all tag", SeverityCritical, rfc + "7208#section-5.1", "Replace +all with ~all or -all."},
+
+	// records that are malformed (and so likely ignored by receivers)
+	{unalignedPhrase, SeverityHigh, readme + "dmarc-alignment", "Publish the DKIM keys your senders provide for your domain, or set up a custom return path with them, before raising the DMARC policy."},
+	{oversizedPhrase, SeverityHigh, readme + "answer-limits", "Remove the records you no longer need, so the answer fits within the limit."},
+	{"Your DMARC record appears to be malformed", SeverityHigh, rfc + "7489#section-6.4", "Rewrite the DMARC record as semicolon separated tags, starting with v=DMARC1; p=."},
+	{"The beginning of your DMARC record should be", SeverityHigh, rfc + "7489#section-6.4", "Start the DMARC record with v=DMARC1, capitalized exactly."},
+	{"The second tag in your DMARC record must be", SeverityHigh, rfc + "7489#section-6.4", "Make p= the second tag of the DMARC record."},
+	{"Invalid DMARC policy specified", SeverityHigh, rfc + "7489#section-6.3", "Set p= to none, quarantine or reject."},
+	{"Your SPF record is missing the all tag", SeverityHigh, rfc + "7208#section-5.1", "End the SPF record with ~all or -all."},
+	{"Your SPF redirects loop", SeverityHigh, rfc + "7208#section-6.1", "Point the last redirect= modifier at a record that ends in an all tag."},
+	{"which doesn't publish an SPF record, so receivers return a permerror", SeverityHigh, rfc + "7208#section-6.1", "Publish an SPF record at the redirect's target, or redirect to a domain that has one."},
+	{"exceed the 10 DNS lookups SPF allows", SeverityHigh, rfc + "7208#section-4.6.4", "Point your redirect= modifier directly at the record that ends in an all tag."},
+	{"SPF records, so receivers return a permerror", SeverityHigh, rfc + "7208#section-4.5", "Merge the SPF records into a single TXT record starting with v=spf1."},
+	{"contains an SPF record that doesn't start it, so receivers don't find it", SeverityHigh, rfc + "7208#section-3", "Publish the SPF record as its own TXT record starting with v=spf1."},
+	{"buffer resolvers commonly advertise, so it can only be resolved over TCP", SeverityHigh, rfc + "7766", "Remove unused TXT records until the answer fits a UDP response."},
+	{"Your DKIM record appears to be malformed", SeverityHigh, rfc + "6376#section-3.6.1", "Republish the DKIM key record exactly as your sending service provides it."},
+	{"as its p= tag doesn't decode to", SeverityHigh, rfc + "6376#section-3.6.1", "Republish the DKIM record with the complete base64 encoded public key in its p= tag."},
+	{"a managed email authentication service, which doesn't publish", SeverityHigh, readme + "managed-dmarc-and-spf-services", "Set up the domain in the managed service, or replace the CNAME with your own record."},
+	{"has a CNAME record at its apex", SeverityHigh, rfc + "1034#section-3.6.2", "Replace the apex CNAME with A and AAAA records, or your DNS provider's ALIAS or ANAME record."},
+	{"Your BIMI record contains a typo", SeverityLow, bimiDraft, "Fix the typo so the BIMI record starts with v=BIMI1;."},
+	{"record contains a typo", SeverityHigh, dmarcGuide, "Fix the typo in the record so receivers recognize it."},
+	{"TLS version 1.0", SeverityHigh, rfc + "8996", "Disable TLS 1.0 and 1.1 on the server, and enable TLS 1.3."},
+	{"TLS version 1.1", SeverityHigh, rfc + "8996", "Disable TLS 1.0 and 1.1 on the server, and enable TLS 1.3."},
+	{"No valid certificate could be found.", SeverityHigh, rfc + "6125#section-6", "Install a certificate from a trusted CA that covers the server's hostname."},
+	{"so it should publish a DMARC record", SeverityHigh, rfc + "7489#section-6.6.3", "Publish a DMARC record at p=reject for the domain, as it doesn't send mail."},
+	{"so your DMARC policy should be p=reject", SeverityHigh, rfc + "7489#section-6.3", "Set the DMARC policy to p=reject, as the domain doesn't send mail."},
+	{"so your SPF record should be exactly", SeverityHigh, rfc + "7208#section-5.1", "Replace the SPF record with v=spf1 -all, as the domain doesn't send mail."},
+	{"which your CAA records don't permit", SeverityHigh, rfc + "8659#section-4", "Revoke any certificate you didn't request, or add the CA to your CAA records if you use it."},
+	{"Your domain's registration expired on", SeverityHigh, rfc + "9083#section-4.5", "Renew the domain with its registrar straight away, and enable auto-renewal."},
+	{"more recently issued certificates are from a CA", SeverityHigh, rfc + "6962", "Confirm the certificates from the new CA were requested by you, and revoke any that weren't."},
+	{"is rejected by senders enforcing your MTA-STS policy", SeverityHigh, rfc + "8461#section-4", "Add the mail server to the policy's mx patterns and give it a certificate for its hostname from a trusted CA, or move the policy back to mode: testing until it passes."},
+
+	{"You are currently at the lowest level", SeverityMedium, rfc + "7489#section-6.3", "Review the aggregate reports, then move the DMARC policy to p=quarantine or p=reject."},
+	{"You are currently at the second level. However", SeverityMedium, rfc + "7489#section-7.2", "Add a rua tag to the DMARC record to receive aggregate reports."},
+	{"We couldn't detect any active DKIM record", SeverityMedium, rfc + "6376#section-3.6", "Enable DKIM signing with your sending services, and publish their DKIM keys."},
+	{"There's no real DKIM record for your domain", SeverityMedium, rfc + "6376#section-3.6.2.1", "Publish the DKIM key at its selector rather than relying on the wildcard TXT record."},
+	{"has no TXT record at", SeverityMedium, rfc + "6376#section-3.6.2.1", "Publish the DKIM key at the selector, or stop signing with it."},
+	{"The beginning of your DKIM record should be", SeverityMedium, rfc + "6376#section-3.6.1", "Start the DKIM record with v=DKIM1."},
+	{"The second tag in your DKIM record must be", SeverityMedium, rfc + "6376#section-3.6.1", "Make k= the second tag of the DKIM record."},
+	{"The third tag in your DKIM record must be", SeverityMedium, rfc + "6376#section-3.6.1", "Make p= the third tag of the DKIM record."},
+	{"Invalid", SeverityMedium, rfc + "7489#section-6.3", "Fix the tag's value so it's one the record allows."},
+	{"You do not have any mail servers setup", SeverityMedium, rfc + "7505", "Publish MX records for your mail servers, or a null MX record if the domain doesn't receive mail."},
+	{"Your domain has a malformed MX record", SeverityMedium, rfc + "5321#section-5.1", "Point each MX record at a hostname, rather than an address."},
+	{"Your domain name appears to be malformed", SeverityMedium, rfc + "1035#section-2.3.1", "Check the domain name is spelled correctly."},
+	{"as it refused the connection to port 25", SeverityMedium, rfc + "5321#section-5.1", "Start the SMTP service on the server and open port 25, or remove the server from your MX records."},
+	{"Failed to reach domain before timeout, as", SeverityMedium, rfc + "5321#section-5.1", "Allow inbound connections to port 25 through the server's firewall, and make sure the server is up."},
+	{"closed the connection before greeting", SeverityMedium, rfc + "5321#section-3.1", "Check the mail server's logs and connection limits, and that it accepts connections from unknown senders."},
+	{"its hostname doesn't resolve to an address", SeverityMedium, rfc + "5321#section-5.1", "Publish an A or AAAA record for the MX host, or point the MX record at a host that has one."},
+	{"its hostname couldn't be resolved", SeverityMedium, rfc + "5321#section-5.1", "Check the MX host's nameservers answer for it, then scan again."},
+	{"rejected the session in its greeting", SeverityMedium, rfc + "5321#section-3.1", "Make sure the server accepts SMTP sessions, or remove it from your MX records if it isn't meant to receive mail."},
+	{"Failed to reach domain", SeverityMedium, rfc + "5321#section-5.1", "Make sure the server accepts connections on its port from the internet."},
+	{"could not be reached", SeverityMedium, rfc + "5321#section-5.1", "Make sure the server accepts connections on its port from the internet."},
+	{"Failed to start TLS connection", SeverityMedium, rfc + "3207", "Enable STARTTLS on the mail server, with a certificate covering its hostname."},
+	{"bit RSA key, which is too weak", SeverityMedium, rfc + "9325", "Reissue the certificate with an RSA key of at least 2048 bits, or an ECDSA key."},
+	{"in your certificate chain expired on", SeverityMedium, rfc + "5280#section-6", "Replace the expired intermediate certificate with your CA's current one in the server's certificate chain."},
+	{"is signed with SHA-1", SeverityMedium, rfc + "9155", "Reissue the certificate with a SHA-256 signature."},
+	{"Failed to re-attempt connection", SeverityMedium, rfc + "3207", "Make sure the mail server accepts repeated connections, then scan again."},
+	{"so your DMARC subdomain policy should be", SeverityMedium, rfc + "7489#section-6.3", "Set the sp= tag to p=reject, as the subdomains don't send mail."},
+	{"can't receive reports, as", SeverityMedium, rfc + "7489#section-7.1", "Point the report destination at a mailbox that accepts mail."},
+	{"Your null MX record must be the only MX record", SeverityMedium, rfc + "7505#section-3", "Remove the other MX records, or the null MX record if the domain receives mail."},
+	{"so it should publish a null MX record", SeverityMedium, rfc + "7505#section-3", "Publish a null MX record (MX 0 .), as the domain doesn't receive mail."},
+	{"had no earlier certificate", SeverityMedium, rfc + "6962", "Confirm the certificates for the new name were requested by you."},
+	{"exists but doesn't publish an SPF record", SeverityMedium, rfc + "7208#section-3", "Publish an SPF record at the subdomain, or v=spf1 -all if it doesn't send mail."},
+	{"No DMARC policy applies to", SeverityMedium, rfc + "7489#section-6.6.3", "Publish a DMARC record at the subdomain's organizational domain, or at the subdomain itself."},
+	{"so mail spoofing it isn't blocked", SeverityMedium, rfc + "7489#section-6.3", "Raise the subdomain's DMARC policy to p=quarantine or p=reject."},
+	{"The latest certificate for", SeverityMedium, rfc + "6962", "Renew the certificate before it expires."},
+	{"so there's no reachable contact for reporting security issues", SeverityMedium, rfc + "9116#section-3", "Publish a security.txt file at https://<domain>/.well-known/security.txt with a Contact and an Expires field."},
+	{"has no Contact field, which RFC 9116 requires", SeverityMedium, rfc + "9116#section-2.5.3", "Add a Contact field with a mailto: or https: URI to the security.txt file."},
+	{"so researchers treat its contacts as stale", SeverityMedium, rfc + "9116#section-2.5.5", "Check the security.txt file's contacts are current, then move its Expires field forward."},
+	{"Your domain's registration expires on", SeverityMedium, rfc + "9083#section-4.5", "Renew the domain with its registrar, or enable auto-renewal, before it expires."},
+	{"is shorter than its refresh", SeverityMedium, rfc + "1912#section-2.2", "Set the SOA expire well above the refresh, such as 2 to 4 weeks."},
+	{"contains an SPF record that doesn't start it", SeverityMedium, rfc + "7208#section-3", "Remove the stray SPF record, or move it to its own TXT record if it's the policy you meant."},
+	{"verification token that doesn't start it", SeverityMedium, rfc + "1464", "Publish the verification token as its own TXT record."},
+	{"so it's truncated over UDP and has to be retried over TCP", SeverityMedium, "https://www.dnsflagday.net/2020/", "Remove unused TXT records until the answer fits in 1232 bytes."},
+	{spfUnreachablePhrase, SeverityMedium, rfc + "7208#section-4.6.2", "Remove the mechanism, or move it before the ones that already match its addresses."},
+	{"so its redirect to", SeverityMedium, rfc + "7208#section-6.1", "Remove the redirect= modifier, or the all tag if the redirect's target should apply."},
+	{"would be rejected under mode: enforce", SeverityMedium, rfc + "8461#section-4", "Add the mail server to the policy's mx patterns and give it a certificate for its hostname from a trusted CA, before moving the policy to mode: enforce."},
+	{"Your MTA-STS policy couldn't be fetched", SeverityMedium, rfc + "8461#section-3.3", "Serve the policy as text/plain at https://mta-sts.<domain>/.well-known/mta-sts.txt, with a valid certificate and without redirects."},
+	{"MTA-STS records at", SeverityMedium, rfc + "8461#section-3.1", "Merge the records into a single MTA-STS record."},
+	{"so senders ignore your MTA-STS policy", SeverityMedium, rfc + "8461#section-3.2", "Fix the policy so it has version: STSv1, a mode of enforce, testing or none, and a max_age in seconds."},
+	{"Your MTA-STS record has no valid id= tag", SeverityMedium, rfc + "8461#section-3.1", "Add an id= tag to the MTA-STS record, and change it whenever the policy does."},
+
+	{"You are currently at the second level and receiving reports", SeverityLow, rfc + "7489#section-6.3", "Review the aggregate reports, then move the DMARC policy to p=reject."},
+	{"However, we do recommend keeping reports enabled", SeverityLow, rfc + "7489#section-7.2", "Add a rua tag to the DMARC record to keep receiving aggregate reports."},
+	{"Consider specifying", SeverityLow, rfc + "7489#section-6.3", "Add the suggested tag to the DMARC record."},
+	{"Consider rotating your DKIM key", SeverityLow, dmarcGuide, "Publish a new DKIM key at a new selector, switch signing to it, then remove the old key."},
+	{"which many receivers can't verify yet", SeverityLow, rfc + "8463", "Sign with an RSA key alongside the Ed25519 key."},
+	{"doesn't publish a DKIM key at any of the selectors checked", SeverityLow, rfc + "6376#section-3.6.2.1", "Enable DKIM signing for the subdomain, and publish its key."},
+	{"Your SPF record ends in -all, but", SeverityLow, rfc + "7489#section-10.1", "Use ~all until your DMARC policy is p=reject with aggregate reports."},
+	{"you can move to -all once", SeverityLow, rfc + "7208#section-5.1", "Move to -all once the aggregate reports confirm your legitimate mail passes SPF."},
+	{"so security issues can only be reported to", SeverityLow, rfc + "9116#section-3", "Publish a security.txt file at https://<domain>/.well-known/security.txt with a Contact and an Expires field."},
+	{"has no valid Expires field, which RFC 9116 requires", SeverityLow, rfc + "9116#section-2.5.5", "Add an Expires field with a date under a year away to the security.txt file."},
+	{"more than the year RFC 9116 recommends", SeverityLow, rfc + "9116#section-2.5.5", "Bring the security.txt file's Expires field to under a year away."},
+	{"isn't locked against transfers", SeverityLow, rfc + "5731#section-2.3", "Ask your registrar to set the clientTransferProhibited lock on the domain."},
+	{spfCoveredPhrase, SeverityLow, rfc + "7208#section-5.6", "Remove the mechanism, as the others already authorize its addresses."},
+	{"only authorizes addresses your SPF record already lists", SeverityLow, rfc + "7208#section-4.6.4", "Remove the include, keeping the mechanisms that authorize its addresses."},
+	{"so it can be removed to save one of the 10 DNS lookups SPF allows", SeverityLow, rfc + "7208#section-4.6.4", "Remove the include, as its record is already evaluated."},
+	{"so the repeat can be removed to save one of the 10 DNS lookups SPF allows", SeverityLow, rfc + "7208#section-4.6.4", "Remove the repeated include."},
+	{"Your SPF record is redirected", SeverityLow, rfc + "7208#section-4.6.4", "Point your redirect= modifier directly at the record at the end of the chain."},
+	{"doesn't publish an MTA-STS record", SeverityLow, rfc + "8461#section-3", "Publish an MTA-STS record and policy, starting in mode: testing, then move to mode: enforce once your mail servers pass it."},
+	{"Your MTA-STS policy's max_age of", SeverityLow, rfc + "8461#section-3.2", "Raise max_age to at least a week (604800) once the policy is enforced."},
+	{"so you can move it from mode: testing to mode: enforce", SeverityLow, rfc + "8461#section-5", "Move the policy to mode: enforce, and change the id= tag of its MTA-STS record."},
+	{"approaching the 1232 byte buffer", SeverityLow, "https://www.dnsflagday.net/2020/", "Remove unused TXT records before adding more."},
+	{"to complete the rollout", SeverityLow, rfc + "7489#section-6.6.4", "Raise the DMARC pct tag to 100, or remove it."},
+	{"Subdomain policy isn't specified", SeverityLow, rfc + "7489#section-6.3", "Add an sp= tag if subdomains need a different policy."},
+	{"without internationalized email (EAI) support can't send reports to", SeverityLow, rfc + "6530", "Add an ASCII report destination alongside the internationalized one."},
+	{"You have a single mail server setup", SeverityLow, rfc + "5321#section-5.1", "Add a backup MX record."},
+	{heloPhrase, SeverityLow, readme + "mail-server-hostnames", "Configure the mail server to introduce itself with a public hostname whose A or AAAA record points at its address."},
+	{"Your SOA", SeverityLow, rfc + "1912#section-2.2", "Adjust the SOA record's field to the recommended range."},
+	{"negative caching TTL is", SeverityLow, rfc + "2308#section-5", "Lower the SOA minimum (the negative caching TTL) to an hour or less."},
+	{"TLS version 1.2", SeverityLow, rfc + "8446", "Enable TLS 1.3 on the server."},
+	{"an unrecognized version of TLS", SeverityLow, rfc + "8446", "Enable TLS 1.3 on the server."},
+	{propagationPhrase, SeverityLow, readme + "authoritative-answers", "Scan again once the authoritative answer's TTL has passed, and make sure every nameserver serves the same copy of the zone."},
+	{"Your BIMI record will not be honored", SeverityLow, bimiDraft, "Move your DMARC policy to p=quarantine or p=reject, without a pct tag below 100, so receivers display your logo."},
+	{"BIMI", SeverityLow, bimiDraft, "Fix the BIMI record or its assets as described."},
+	{"Your SVG logo", SeverityLow, bimiDraft, "Republish the logo as an SVG Tiny PS file."},
+	{"Your VMC certificate", SeverityLow, bimiDraft, "Renew or reissue the VMC so it's valid for the domain and logo."},
+	{"Your ARC sealing key at selector", SeverityLow, rfc + "8617#section-5.1.1", "Republish the ARC sealing key as your forwarding service provides it."},
+	{softGreetingPhrase, SeverityLow, rfc + "5321#section-3.1", "Scan again later, and check the server's greylisting or maintenance settings if it keeps turning the scanner away."},
+	{incompletePhrase, SeverityLow, readme + "check-errors", "Fix the scanner's resolver, proxy or network as the result's errors describe, or raise the timeout, then scan again."},
+}
+
+// ParseSeverity returns the severity with the given name (such as "high").
+func ParseSeverity(name string) (Severity, error) {
+	for severity, severityName := range severityNames {
+		if strings.EqualFold(name, severityName) {
+			return severity, nil
+		}
+	}
+
+	return SeverityInfo, fmt.Errorf("invalid severity %q, it must be one of: critical, high, medium, low, info", name)
+}
+
+// Classify returns the severity of a line of advice.
+func Classify(advice string) Severity {
+	if rule := matchRule(advice); rule != nil {
+		return rule.severity
+	}
+
+	return SeverityInfo
+}
+
+// CatalogVersion identifies the revision of the advice catalog: the severity,
+// reference and remediation of each phrase of advice, in the order they're
+// matched. It's a hash of the catalog, so it changes whenever an entry does,
+// and results can say which revision classified their findings.
+func CatalogVersion() string {
+	return currentData.Load().catalogVersion
+}
+
+// matchRule returns the first severity rule matching a line of advice, or nil
+// if none do.
+func matchRule(advice string) *severityRule {
+	// positive advice (such as "Your BIMI record looks good!") may contain a rule's phrase, so it's matched first
+	if strings.Contains(advice, "No further action needed") || strings.Contains(advice, "no further action needed") {
+		return nil
+	}
+
+	catalog := currentData.Load().catalog
+	for index := range catalog {
+		if strings.Contains(advice, catalog[index].phrase) {
+			return &catalog[index]
+		}
+	}
+
+	return nil
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// Findings returns every line of advice with its severity, reference and
+// remediation, in the same order as the advice's fields, followed by the
+// extensions' in the order of their names.
+func (a *Advice) Findings() []Finding {
+	var findings []Finding
+
+	add := func(check string, advice []string) {
+		for _, message := range advice {
+			finding := Finding{Check: check, Message: message, Severity: SeverityInfo}
+			if rule := matchRule(message); rule != nil {
+				finding.Severity, finding.Reference, finding.Remediation, finding.Rule = rule.severity, rule.reference, rule.remediation, rule.phrase
+			}
+
+			findings = append(findings, finding)
+		}
+	}
+
+	for _, section := range a.sections() {
+		add(section.name, *section.advice)
+	}
+
+	for _, name := range a.extensionNames() {
+		add(name, a.Extensions[name])
+	}
+
+	return findings
+}
+
+// Filter returns a copy of the advice, keeping only the lines that meet or
+// exceed the given severity.
+func (a *Advice) Filter(minimum Severity) *Advice {
+	filtered := &Advice{Providers: a.Providers, Timings: a.Timings, CertificateReport: a.CertificateReport, Registration: a.Registration}
+	sources := a.sections()
+
+	for index, section := range filtered.sections() {
+		for _, message := range *sources[index].advice {
+			if Classify(message) >= minimum {
+				*section.advice = append(*section.advice, message)
+			}
+		}
+	}
+
+	for _, name := range a.extensionNames() {
+		kept := slices.DeleteFunc(slices.Clone(a.Extensions[name]), func(message string) bool { return Classify(message) < minimum })
+		filtered.set(name, kept)
+	}
+
+	return filtered
+}
+
+// Sorted returns a copy of the advice with each check's advice, and the
+// providers, sorted alphabetically, so the same advice is always in the same
+// order. The timings are dropped, as they differ between identical checks.
+func (a *Advice) Sorted() *Advice {
+	sorted := &Advice{Providers: append([]string(nil), a.Providers...), CertificateReport: a.CertificateReport, Registration: a.Registration}
+	sources := a.sections()
+
+	for index, section := range sorted.sections() {
+		*section.advice = append([]string(nil), *sources[index].advice...)
+		sort.Strings(*section.advice)
+	}
+
+	for _, name := range a.extensionNames() {
+		extension := slices.Clone(a.Extensions[name])
+		sort.Strings(extension)
+		sorted.set(name, extension)
+	}
+
+	sort.Strings(sorted.Providers)
+
+	return sorted
+}
+
+// extensionNames returns the names of the extensions with advice, sorted
+// alphabetically.
+func (a *Advice) extensionNames() []string {
+	names := make([]string, 0, len(a.Extensions))
+	for name := range a.Extensions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// sections returns a pointer to each check's advice, in field order.
+func (a *Advice) sections() []adviceSection {
+	return []adviceSection{
+		{"domain", &a.Domain},
+		{"arc", &a.ARC},
+		{"bimi", &a.BIMI},
+		{"blocklists", &a.Blocklists},
+		{"certificates", &a.Certificates},
+		{"dkim", &a.DKIM},
+		{"dmarc", &a.DMARC},
+		{"lookalikes", &a.Lookalikes},
+		{"mtasts", &a.MTASTS},
+		{"mx", &a.MX},
+		{"soa", &a.SOA},
+		{"spf", &a.SPF},
+		{"subdomains", &a.Subdomains},
+		{"txt", &a.TXT},
+	}
+}
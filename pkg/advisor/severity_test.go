@@ -0,0 +1,133 @@
+package advisor
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	tests := map[string]Severity{
+		advisor.CheckDMARC("")[0]:                  SeverityCritical,
+		advisor.CheckSPF("v=spf1 +all")[0]:         SeverityCritical,
+		advisor.CheckSPF("v=spf1 include:x")[0]:    SeverityHigh,
+		advisor.CheckDMARC("v=DMARC1; p=none;")[0]: SeverityMedium,
+		advisor.CheckDKIM("")[0]:                   SeverityMedium,
+		advisor.CheckBIMI("")[0]:                   SeverityLow,
+		advisor.CheckSPF("v=spf1 -all")[0]:         SeverityInfo,
+		lintBIMI("v=BIMI1; l=https://bimi.example.com/logo.svg; a=https://bimi.example.com/cert.pem")[0]: SeverityInfo,
+		"mx.example.com: " + checkTLSVersion(0x0301):                                                     SeverityHigh,
+		"mx.example.com: " + checkTLSVersion(0x0303):                                                     SeverityLow,
+		"mx.example.com: " + checkTLSVersion(0x0304):                                                     SeverityInfo,
+	}
+
+	for advice, expected := range tests {
+		if severity := Classify(advice); severity != expected {
+			t.Errorf("found %v for %q, want %v", severity, advice, expected)
+		}
+	}
+}
+
+func TestSeverityRules_References(t *testing.T) {
+	seen := make(map[string]struct{}, len(severityRules))
+
+	for _, rule := range severityRules {
+		if _, ok := seen[rule.phrase]; ok {
+			t.Errorf("%q: found a repeated phrase, want each to have one rule", rule.phrase)
+		}
+		seen[rule.phrase] = struct{}{}
+
+		if rule.remediation == "" {
+			t.Errorf("%q: found an empty remediation", rule.phrase)
+		}
+
+		if reference, err := url.Parse(rule.reference); err != nil || reference.Scheme != "https" || reference.Host == "" {
+			t.Errorf("%q: found an invalid reference %q (%v)", rule.phrase, rule.reference, err)
+		}
+	}
+}
+
+func TestAdvice_Findings(t *testing.T) {
+	advice := &Advice{
+		DMARC: []string{"You do not have DMARC setup!"},
+		SPF:   []string{"SPF seems to be setup correctly! No further action needed."},
+	}
+
+	expected := []Finding{
+		{Check: "dmarc", Message: advice.DMARC[0], Severity: SeverityCritical, Reference: "https://www.rfc-editor.org/rfc/rfc7489#section-6.1", Remediation: "Publish a DMARC record at _dmarc.<domain>, starting at p=none with a rua tag.", Rule: "You do not have DMARC setup!"},
+		{Check: "spf", Message: advice.SPF[0], Severity: SeverityInfo},
+	}
+
+	if findings := advice.Findings(); !reflect.DeepEqual(findings, expected) {
+		t.Errorf("found %+v, want %+v", findings, expected)
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, name := range []string{"info", "low", "medium", "high", "critical"} {
+		severity, err := ParseSeverity(name)
+		if err != nil || severity.String() != name {
+			t.Errorf("found %v (%v), want %s", severity, err, name)
+		}
+	}
+
+	if _, err := ParseSeverity("severe"); err == nil {
+		t.Error("expected an error for an unknown severity")
+	}
+}
+
+func TestAdvice_Filter(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+	advice := advisor.Lint("", "", "v=DMARC1; p=none;", nil, "v=spf1 +all")
+
+	filtered := advice.Filter(SeverityMedium)
+
+	expected := []string{advice.DMARC[0]}
+	if !reflect.DeepEqual(filtered.DMARC, expected) {
+		t.Errorf("found %v, want %v", filtered.DMARC, expected)
+	}
+
+	if !reflect.DeepEqual(filtered.SPF, advice.SPF) {
+		t.Errorf("found %v, want %v", filtered.SPF, advice.SPF)
+	}
+
+	if len(advice.DMARC) == len(filtered.DMARC) {
+		t.Error("the original advice should not be modified")
+	}
+
+	findings := advice.Findings()
+	if len(findings) != len(advice.DMARC)+len(advice.SPF) || findings[0].Check != "dmarc" || findings[len(findings)-1].Severity != SeverityCritical {
+		t.Errorf("unexpected findings %v", findings)
+	}
+}
+
+func TestAdvice_Sorted(t *testing.T) {
+	advice := &Advice{
+		DMARC:     []string{"b", "a", "c"},
+		SPF:       []string{"only"},
+		Providers: []string{"Microsoft 365", "Google Workspace"},
+		Timings:   map[string]string{"dmarc_check": "1ms"},
+	}
+
+	sorted := advice.Sorted()
+
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(sorted.DMARC, expected) {
+		t.Errorf("found %v, want %v", sorted.DMARC, expected)
+	}
+
+	if expected := []string{"Google Workspace", "Microsoft 365"}; !reflect.DeepEqual(sorted.Providers, expected) {
+		t.Errorf("found %v, want %v", sorted.Providers, expected)
+	}
+
+	if sorted.DKIM != nil || sorted.Timings != nil {
+		t.Errorf("found %v and %v, want empty checks and timings to be nil", sorted.DKIM, sorted.Timings)
+	}
+
+	// the advice is copied, rather than sorted in place
+	if expected := []string{"b", "a", "c"}; !reflect.DeepEqual(advice.DMARC, expected) {
+		t.Errorf("found %v, want %v", advice.DMARC, expected)
+	}
+}
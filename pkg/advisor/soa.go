@@ -0,0 +1,167 @@
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// soaMinimumExpire is the shortest expire that gives a zone's secondary
+	// nameservers time to outlast an outage of its primary, and
+	// soaMaximumNegativeTTL the longest negative caching TTL that doesn't hold
+	// up new records (RFC 1912, section 2.2, and RFC 2308, section 5).
+	soaMinimumExpire      = 7 * 24 * 60 * 60
+	soaMaximumNegativeTTL = 24 * 60 * 60
+
+	// soaMinimumRefresh and soaMaximumRefresh bound the refresh recommended by
+	// RFC 1912, section 2.2.
+	soaMinimumRefresh = 20 * 60
+	soaMaximumRefresh = 12 * 60 * 60
+)
+
+// soaUnits are the units durations are written in, largest first.
+var soaUnits = []struct {
+	name    string
+	seconds uint32
+}{
+	{"week", 7 * 24 * 60 * 60},
+	{"day", 24 * 60 * 60},
+	{"hour", 60 * 60},
+	{"minute", 60},
+}
+
+// SOA is the SOA record of the zone the domain is the apex of, with its timers
+// in seconds.
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+	TTL     uint32
+}
+
+// CheckSOA returns advice on the domain's SOA record: its serial number
+// format, timers that secondary nameservers or resolvers can't work with, and
+// whether its RNAME (the zone's contact) is a mailbox that accepts mail.
+func (a *Advisor) CheckSOA(ctx context.Context, soa *SOA) []string {
+	if soa == nil {
+		return nil
+	}
+
+	advice := soaAdvice(soa, time.Now())
+
+	mailbox, ok := rnameMailbox(soa.RName)
+	address, err := parseEmail(mailbox)
+
+	switch {
+	case !ok || err != nil:
+		advice = append(advice, fmt.Sprintf("Your SOA RNAME %s isn't a valid mailbox, so the contact for your zone can't be reached. Set it to a monitored mailbox in its DNS form, such as hostmaster.example.com for hostmaster@example.com (with any dots before the @ escaped, as in first\\.last.example.com).", soa.RName))
+	case a.isOffline(ctx):
+		advice = append(advice, skippedOffline("The check that your SOA RNAME accepts mail"))
+	default:
+		if reason := a.undeliverable(ctx, address.asciiDomain); reason != "" {
+			advice = append(advice, fmt.Sprintf("Your SOA RNAME %s stands for %s, which can't receive mail, as %s %s. Set it to a monitored mailbox, so the contact for your zone can be reached.", soa.RName, address, address.domain, reason))
+		}
+	}
+
+	if len(advice) == 0 {
+		return []string{"Your SOA record's serial number, timers and contact look reasonable. No further action needed."}
+	}
+
+	return advice
+}
+
+// soaAdvice returns advice on the SOA record's serial number and timers,
+// relative to now.
+func soaAdvice(soa *SOA, now time.Time) []string {
+	var advice []string
+
+	// a date-based serial (YYYYMMDDnn, RFC 1912) or a Unix timestamp tracks when the zone changed
+	serial := strconv.FormatUint(uint64(soa.Serial), 10)
+	date, err := time.Parse("20060102", serial[:min(len(serial), 8)])
+
+	switch {
+	case len(serial) == 10 && err == nil && date.Year() >= 1990:
+		if date.After(now) {
+			advice = append(advice, fmt.Sprintf("Your SOA serial number %s is in the YYYYMMDDnn format, but is dated in the future (%s). It can't simply be lowered, as your secondary nameservers would stop picking up changes, so keep incrementing it until the date catches up.", serial, date.Format(time.DateOnly)))
+		}
+	case soa.Serial >= 946684800 && int64(soa.Serial) <= now.Unix():
+		// Unix timestamps from 2000 onwards, as used by many DNS providers
+	default:
+		advice = append(advice, fmt.Sprintf("Your SOA serial number %s isn't in the YYYYMMDDnn date format recommended by RFC 1912, which is fine if your DNS provider manages it, as many use a counter instead. No further action needed.", serial))
+	}
+
+	if soa.Expire < soa.Refresh {
+		advice = append(advice, fmt.Sprintf("Your SOA expire (%s) is shorter than its refresh (%s), so your secondary nameservers stop answering for your zone before they next check it for changes. Raise the expire to at least a week, well above the refresh.", formatSeconds(soa.Expire), formatSeconds(soa.Refresh)))
+	} else if soa.Expire < soaMinimumExpire {
+		advice = append(advice, fmt.Sprintf("Your SOA expire (%s) is under a week, so your secondary nameservers stop answering for your zone if your primary nameserver is unreachable for longer. RFC 1912 recommends two to four weeks.", formatSeconds(soa.Expire)))
+	}
+
+	if soa.Refresh < soaMinimumRefresh || soa.Refresh > soaMaximumRefresh {
+		advice = append(advice, fmt.Sprintf("Your SOA refresh (%s) is outside the 20 minutes to 12 hours recommended by RFC 1912, so your secondary nameservers check your zone for changes either more often than needed or too rarely to pick them up promptly.", formatSeconds(soa.Refresh)))
+	}
+
+	if soa.Retry >= soa.Refresh {
+		advice = append(advice, fmt.Sprintf("Your SOA retry (%s) isn't shorter than its refresh (%s), so your secondary nameservers wait longer to retry a failed check for changes than between successful ones. Lower the retry to a fraction of the refresh.", formatSeconds(soa.Retry), formatSeconds(soa.Refresh)))
+	}
+
+	// resolvers cache that a record doesn't exist for the lower of the minimum and the SOA's own TTL
+	if negativeTTL := min(soa.Minimum, soa.TTL); negativeTTL > soaMaximumNegativeTTL {
+		advice = append(advice, fmt.Sprintf("Your zone's negative caching TTL is %s, so resolvers that looked up a record before it existed keep answering that it doesn't for over a day. A DMARC, SPF or DKIM record you add or fix can take that long to reach receivers, so lower the SOA minimum (and TTL) to an hour or so.", formatSeconds(negativeTTL)))
+	}
+
+	return advice
+}
+
+// rnameMailbox returns the email address an SOA RNAME stands for, as the
+// first unescaped dot stands for the @ (RFC 1035, section 8), and whether
+// it has both a local part and a domain.
+func rnameMailbox(rname string) (string, bool) {
+	rname = strings.TrimSuffix(rname, ".")
+
+	var local strings.Builder
+
+	for i := 0; i < len(rname); i++ {
+		switch char := rname[i]; {
+		case char == '\\' && i+1 < len(rname):
+			i++
+			local.WriteByte(rname[i])
+		case char == '.':
+			if local.Len() == 0 || i+1 == len(rname) {
+				return "", false
+			}
+
+			return local.String() + "@" + rname[i+1:], true
+		default:
+			local.WriteByte(char)
+		}
+	}
+
+	return "", false
+}
+
+// formatSeconds writes a duration in the largest unit it's a whole number of,
+// such as 2 weeks or 90 minutes.
+func formatSeconds(seconds uint32) string {
+	plural := func(count uint32, unit string) string {
+		if count == 1 {
+			return "1 " + unit
+		}
+
+		return fmt.Sprintf("%d %ss", count, unit)
+	}
+
+	for _, unit := range soaUnits {
+		if seconds > 0 && seconds%unit.seconds == 0 {
+			return plural(seconds/unit.seconds, unit.name)
+		}
+	}
+
+	return plural(seconds, "second")
+}
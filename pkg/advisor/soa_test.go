@@ -0,0 +1,152 @@
+package advisor
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSOAAdvice(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	// a zone with the timers recommended by RFC 1912
+	healthy := SOA{MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 2024061501, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 3600, TTL: 3600}
+
+	tests := []struct {
+		name     string
+		modify   func(soa *SOA)
+		expected []string
+		severity Severity
+	}{
+		{"Healthy", func(*SOA) {}, nil, SeverityInfo},
+		{"DatedToday", func(soa *SOA) { soa.Serial = 2024061599 }, nil, SeverityInfo},
+		{"UnixTimestamp", func(soa *SOA) { soa.Serial = 1718409600 }, nil, SeverityInfo},
+		{"Counter", func(soa *SOA) { soa.Serial = 1 }, []string{"isn't in the YYYYMMDDnn date format"}, SeverityInfo},
+		{"FutureDate", func(soa *SOA) { soa.Serial = 2099010101 }, []string{"is dated in the future (2099-01-01)"}, SeverityLow},
+		{"ExpireBeforeRefresh", func(soa *SOA) { soa.Expire = 3600 }, []string{"Your SOA expire (1 hour) is shorter than its refresh (2 hours)"}, SeverityMedium},
+		{"ShortExpire", func(soa *SOA) { soa.Expire = 172800 }, []string{"Your SOA expire (2 days) is under a week"}, SeverityLow},
+		{"LongRefresh", func(soa *SOA) { soa.Refresh, soa.Expire = 86400, 2419200 }, []string{"Your SOA refresh (1 day) is outside"}, SeverityLow},
+		{"RetryAfterRefresh", func(soa *SOA) { soa.Retry = 7200 }, []string{"Your SOA retry (2 hours) isn't shorter than its refresh (2 hours)"}, SeverityLow},
+		{"LongNegativeTTL", func(soa *SOA) { soa.Minimum, soa.TTL = 172800, 172800 }, []string{"negative caching TTL is 2 days"}, SeverityLow},
+		{"NegativeTTLCappedByTTL", func(soa *SOA) { soa.Minimum = 172800 }, nil, SeverityInfo},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			soa := healthy
+			test.modify(&soa)
+
+			advice := soaAdvice(&soa, now)
+			if len(advice) != len(test.expected) {
+				t.Fatalf("found %v, want %d lines of advice", advice, len(test.expected))
+			}
+
+			for index, phrase := range test.expected {
+				if !strings.Contains(advice[index], phrase) {
+					t.Errorf("found %q, want it to contain %q", advice[index], phrase)
+				}
+
+				if severity := Classify(advice[index]); severity != test.severity {
+					t.Errorf("found %v, want %v", severity, test.severity)
+				}
+			}
+		})
+	}
+}
+
+func TestRNAMEMailbox(t *testing.T) {
+	tests := []struct {
+		rname    string
+		expected string
+		ok       bool
+	}{
+		{"hostmaster.example.com", "hostmaster@example.com", true},
+		{"hostmaster.example.com.", "hostmaster@example.com", true},
+		{`first\.last.example.com`, "first.last@example.com", true},
+		{"hostmaster", "", false},
+		{".example.com", "", false},
+		{"hostmaster.", "", false},
+	}
+
+	for _, test := range tests {
+		if mailbox, ok := rnameMailbox(test.rname); mailbox != test.expected || ok != test.ok {
+			t.Errorf("%q: found %q and %v, want %q and %v", test.rname, mailbox, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestFormatSeconds(t *testing.T) {
+	tests := map[uint32]string{
+		0:       "0 seconds",
+		1:       "1 second",
+		90:      "90 seconds",
+		5400:    "90 minutes",
+		3600:    "1 hour",
+		86400:   "1 day",
+		1209600: "2 weeks",
+	}
+
+	for seconds, expected := range tests {
+		if found := formatSeconds(seconds); found != expected {
+			t.Errorf("%d: found %q, want %q", seconds, found, expected)
+		}
+	}
+}
+
+func TestAdvisor_CheckSOA(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Minute, false)
+	defer advisor.Close()
+
+	advisor.lookupMX = func(_ context.Context, name string) ([]*net.MX, error) {
+		if name == "example.com" {
+			return []*net.MX{{Host: "mx.example.com.", Pref: 10}}, nil
+		}
+
+		return nil, &net.DNSError{Err: "no such host", IsNotFound: true}
+	}
+	advisor.lookupHost = func(context.Context, string) ([]string, error) {
+		return nil, &net.DNSError{Err: "no such host", IsNotFound: true}
+	}
+
+	soa := &SOA{MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 2024061501, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 3600, TTL: 3600}
+
+	if advice := advisor.CheckSOA(context.Background(), nil); advice != nil {
+		t.Errorf("found %v, want no advice without an SOA record", advice)
+	}
+
+	if advice := advisor.CheckSOA(context.Background(), soa); len(advice) != 1 || !strings.Contains(advice[0], "No further action needed") {
+		t.Errorf("found %v, want the SOA record to look reasonable", advice)
+	}
+
+	tests := map[string]string{
+		"hostmaster.missing.example": "Your SOA RNAME hostmaster.missing.example stands for hostmaster@missing.example, which can't receive mail, as missing.example has no MX or address records.",
+		"hostmaster":                 "Your SOA RNAME hostmaster isn't a valid mailbox",
+	}
+
+	for rname, expected := range tests {
+		soa := *soa
+		soa.RName = rname
+
+		advice := advisor.CheckSOA(context.Background(), &soa)
+		if len(advice) != 1 || !strings.HasPrefix(advice[0], expected) {
+			t.Errorf("%s: found %v, want %q", rname, advice, expected)
+			continue
+		}
+
+		if severity := Classify(advice[0]); severity != SeverityLow {
+			t.Errorf("%s: found %v, want %v", rname, severity, SeverityLow)
+		}
+	}
+
+	t.Run("Offline", func(t *testing.T) {
+		advisor := NewAdvisor(time.Second, time.Minute, false, WithOffline(true))
+		defer advisor.Close()
+
+		advice := advisor.CheckSOA(context.Background(), soa)
+		if len(advice) != 1 || Classify(advice[0]) != SeverityInfo {
+			t.Errorf("found %v, want the mailbox check to be skipped", advice)
+		}
+	})
+}
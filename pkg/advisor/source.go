@@ -0,0 +1,44 @@
+package advisor
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// sourceDialer dials every connection from a local address.
+type sourceDialer struct {
+	ip      net.IP
+	timeout time.Duration
+}
+
+// WithSourceAddress makes every connection (TLS and SMTP probes, HTTP
+// fetches, and the lookups of hosts' addresses and MX records) from the given
+// local address, which must be assigned to the host (see
+// scanner.ParseSourceAddress). It replaces the dialer and host resolver, so
+// it's overridden by WithDialer and WithHostResolver if they're given after
+// it, but not by WithDialerMiddleware, which wraps it.
+func WithSourceAddress(ip net.IP) Option {
+	return func(a *Advisor) {
+		if ip == nil {
+			return
+		}
+
+		dialer := sourceDialer{ip: ip, timeout: a.timeout}
+		resolver := &net.Resolver{PreferGo: true, Dial: dialer.DialContext}
+
+		a.dialer, a.lookupHost, a.lookupMX = dialer, resolver.LookupHost, resolver.LookupMX
+	}
+}
+
+func (d sourceDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var local net.Addr = &net.TCPAddr{IP: d.ip}
+	if strings.HasPrefix(network, "udp") {
+		local = &net.UDPAddr{IP: d.ip}
+	}
+
+	dialer := &net.Dialer{Timeout: d.timeout, LocalAddr: local}
+
+	return dialer.DialContext(ctx, network, address)
+}
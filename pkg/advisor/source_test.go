@@ -0,0 +1,56 @@
+package advisor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWithSourceAddress(t *testing.T) {
+	t.Run("Unset", func(t *testing.T) {
+		advisor := NewAdvisor(time.Second, time.Second, false, WithSourceAddress(nil))
+		t.Cleanup(advisor.Close)
+
+		if _, ok := advisor.dialer.(*net.Dialer); !ok {
+			t.Errorf("found %T, want the default dialer", advisor.dialer)
+		}
+	})
+
+	t.Run("Bound", func(t *testing.T) {
+		// only some hosts (such as Linux) route all of 127.0.0.0/8 to the loopback interface
+		source := net.ParseIP("127.0.0.2")
+		if conn, err := net.ListenPacket("udp", "127.0.0.2:0"); err != nil {
+			t.Skipf("can't bind to 127.0.0.2: %v", err)
+		} else {
+			_ = conn.Close()
+		}
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = listener.Close() })
+
+		remote := make(chan net.Addr, 1)
+		go func() {
+			if conn, err := listener.Accept(); err == nil {
+				remote <- conn.RemoteAddr()
+				_ = conn.Close()
+			}
+		}()
+
+		advisor := NewAdvisor(time.Second, time.Second, false, WithSourceAddress(source))
+		t.Cleanup(advisor.Close)
+
+		conn, err := advisor.dialer.DialContext(context.Background(), "tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+
+		if address := (<-remote).(*net.TCPAddr); !address.IP.Equal(source) {
+			t.Errorf("found %v, want a connection from %v", address.IP, source)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxSPFRedirectHops is the longest chain of redirect= modifiers that isn't
+	// advised against.
+	maxSPFRedirectHops = 2
+
+	// spfLooksGood is the SPF advice for a record without any problems.
+	spfLooksGood = "SPF seems to be setup correctly! No further action needed."
+)
+
+// SPFRedirect is a domain an SPF record's redirect= modifier led to, with its
+// own SPF record (empty if it has none), as returned by the scanner.
+type SPFRedirect struct {
+	Domain string
+	Record string
+}
+
+// CheckSPFRedirects returns advice on the chain of redirects the domain's SPF
+// record was followed through, in order, along with the advice for the record
+// at its end, which is the one that applies to the domain's mail (tailored to
+// its DMARC record as CheckAllInput does). Receivers return a permerror for a
+// chain that loops, or that leads to a domain without an SPF record, so SPF
+// fails for all of the domain's mail. A domain without redirects isn't advised.
+func (a *Advisor) CheckSPFRedirects(domain string, redirects []SPFRedirect, dmarc string) []string {
+	if len(redirects) == 0 {
+		return nil
+	}
+
+	chain := []string{normalizeDomain(domain)}
+	seen := map[string]struct{}{chain[0]: {}}
+
+	for _, redirect := range redirects {
+		target := normalizeDomain(redirect.Domain)
+		chain = append(chain, target)
+
+		if _, ok := seen[target]; ok {
+			return []string{fmt.Sprintf("Your SPF redirects loop (%s), so receivers return a permerror and SPF fails for all of your mail. Point the last redirect= modifier at a domain whose SPF record ends in an all tag.", strings.Join(chain, " -> "))}
+		}
+
+		seen[target] = struct{}{}
+	}
+
+	last := redirects[len(redirects)-1]
+	if last.Record == "" {
+		return []string{fmt.Sprintf("Your SPF record redirects to %s (%s), which doesn't publish an SPF record, so receivers return a permerror and SPF fails for all of your mail (RFC 7208, section 6.1). Publish an SPF record at %s, or point your redirect= modifier at a domain that has one.", last.Domain, strings.Join(chain, " -> "), last.Domain)}
+	}
+
+	if spfRedirect(last.Record) != "" && spfAllQualifier(last.Record) == "" {
+		// the scanner stops following redirects at the SPF lookup limit
+		return []string{fmt.Sprintf("Your SPF redirects (%s) exceed the 10 DNS lookups SPF allows, so receivers return a permerror and SPF fails for all of your mail. Point your redirect= modifier directly at the domain whose SPF record ends in an all tag.", strings.Join(chain, " -> "))}
+	}
+
+	var advice []string
+
+	if len(redirects) > maxSPFRedirectHops {
+		advice = append(advice, fmt.Sprintf("Your SPF record is redirected %d times (%s). Each redirect costs one of the 10 DNS lookups SPF allows, and is another record that can break, so consider pointing your redirect= modifier directly at %s.", len(redirects), strings.Join(chain, " -> "), last.Domain))
+	}
+
+	// the record at the end of the chain is the one receivers evaluate
+	for _, line := range a.checkSPFRecord(last.Record, parseDMARC(dmarc), true) {
+		advice = append(advice, last.Domain+": "+line)
+	}
+
+	return advice
+}
+
+// spfRedirect returns the domain of the SPF record's redirect= modifier, or ""
+// if it has none.
+func spfRedirect(spf string) string {
+	for _, term := range strings.Fields(spf) {
+		if name, value, ok := strings.Cut(term, "="); ok && strings.EqualFold(name, "redirect") {
+			return strings.TrimSuffix(value, ".")
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,90 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckSPFRecord_Redirect(t *testing.T) {
+	advisor := NewAdvisor(time.Second, 0, false)
+
+	tests := []struct {
+		name     string
+		spf      string
+		expected []string
+		severity Severity
+	}{
+		{"Redirect", "v=spf1 redirect=_spf.example.net", []string{"hands its policy over to _spf.example.net"}, SeverityInfo},
+		{"RedirectWithMechanisms", "v=spf1 ip4:192.0.2.1 Redirect=_spf.example.net.", []string{"hands its policy over to _spf.example.net"}, SeverityInfo},
+		{"IgnoredRedirect", "v=spf1 redirect=_spf.example.net ~all", []string{"so its redirect to _spf.example.net is never used"}, SeverityMedium},
+		{"IgnoredRedirectWithPlusAll", "v=spf1 +all redirect=_spf.example.net", []string{"so its redirect to _spf.example.net is never used", "contains the +all tag"}, SeverityCritical},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckSPF(test.spf)
+			if len(advice) != len(test.expected) {
+				t.Fatalf("found %v, want %d lines", advice, len(test.expected))
+			}
+
+			for index, expected := range test.expected {
+				if !strings.Contains(advice[index], expected) {
+					t.Errorf("found %q, want it to contain %q", advice[index], expected)
+				}
+			}
+
+			if severity := Classify(advice[len(advice)-1]); severity != test.severity {
+				t.Errorf("found %v, want %v", severity, test.severity)
+			}
+		})
+	}
+}
+
+func TestCheckSPFRedirects(t *testing.T) {
+	advisor := NewAdvisor(time.Second, 0, false)
+
+	effective := "v=spf1 ip4:192.0.2.0/24 ~all"
+
+	tests := []struct {
+		name      string
+		redirects []SPFRedirect
+		expected  []string
+		severity  Severity
+	}{
+		{"NoRedirects", nil, nil, SeverityInfo},
+		{"OneHop", []SPFRedirect{{"_spf.example.net", effective}}, []string{"_spf.example.net: Your SPF record ends in ~all"}, SeverityInfo},
+		{"ThreeHops", []SPFRedirect{
+			{"hop1.example.net", "v=spf1 redirect=hop2.example.net"},
+			{"hop2.example.net", "v=spf1 redirect=_spf.example.net"},
+			{"_spf.example.net", effective},
+		}, []string{"redirected 3 times (example.com -> hop1.example.net -> hop2.example.net -> _spf.example.net)", "_spf.example.net: Your SPF record ends in ~all"}, SeverityLow},
+		{"Loop", []SPFRedirect{
+			{"loop.example.net", "v=spf1 redirect=example.com"},
+			{"Example.com.", "v=spf1 redirect=loop.example.net"},
+		}, []string{"Your SPF redirects loop (example.com -> loop.example.net -> example.com)"}, SeverityHigh},
+		{"MissingTarget", []SPFRedirect{{"missing.example.net", ""}}, []string{"redirects to missing.example.net (example.com -> missing.example.net), which doesn't publish an SPF record"}, SeverityHigh},
+		{"TooLong", []SPFRedirect{{"hop1.example.net", "v=spf1 redirect=hop2.example.net"}}, []string{"exceed the 10 DNS lookups SPF allows"}, SeverityHigh},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckSPFRedirects("example.com", test.redirects, "v=DMARC1; p=none")
+			if len(advice) != len(test.expected) {
+				t.Fatalf("found %v, want %d lines", advice, len(test.expected))
+			}
+
+			for index, expected := range test.expected {
+				if !strings.Contains(advice[index], expected) {
+					t.Errorf("found %q, want it to contain %q", advice[index], expected)
+				}
+			}
+
+			if len(advice) > 0 {
+				if severity := Classify(advice[0]); severity != test.severity {
+					t.Errorf("found %v, want %v", severity, test.severity)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package advisor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/iprange"
+)
+
+const (
+	// spfCoveredPhrase marks the advice on an ip4 or ip6 mechanism whose
+	// addresses are all authorized by others in the same record.
+	spfCoveredPhrase = "so it can be removed to shorten your SPF record"
+
+	// spfUnreachablePhrase marks the advice on an ip4 or ip6 mechanism that's
+	// never reached, as the mechanisms before it match all of its addresses
+	// with a different result.
+	spfUnreachablePhrase = "and receivers use the first mechanism that matches"
+)
+
+type (
+	// SPFInclude is a domain an SPF record's include mechanisms led to
+	// (directly, or through another include), with its own SPF record (empty
+	// if it has none), as returned by the scanner.
+	SPFInclude struct {
+		Domain string
+		Record string
+	}
+
+	// spfNetwork is an ip4 or ip6 mechanism of an SPF record.
+	spfNetwork struct {
+		// term is the mechanism as it's written, without a + qualifier.
+		term string
+
+		// qualifier is the mechanism's qualifier: +, -, ~ or ?.
+		qualifier byte
+
+		addresses iprange.Range
+	}
+
+	// spfTerms are the terms of an SPF record that CheckSPFOverlaps compares,
+	// up to its all mechanism (as receivers never evaluate the terms after it).
+	spfTerms struct {
+		// networks are the record's ip4 and ip6 mechanisms, in order.
+		networks []spfNetwork
+
+		// includes are the domains of the record's include mechanisms that pass, in order.
+		includes []string
+
+		// unknown is true if the record has other mechanisms (such as a or mx),
+		// whose addresses aren't known, and negated is true if any of those
+		// don't pass (so they can stop the mechanisms after them from
+		// matching).
+		unknown, negated bool
+	}
+
+	// spfIncluded is what an include mechanism authorizes.
+	spfIncluded struct {
+		domain string
+
+		// networks are the networks that pass, from the included record and
+		// every record it includes in turn, and addresses is their union.
+		networks  []spfNetwork
+		addresses iprange.Set
+
+		// reached are the domains included by the include's record, in turn.
+		reached map[string]struct{}
+
+		// complete is true if networks are all the include authorizes, and
+		// ordered is true if nothing in its records fails before they're
+		// matched, so they pass whatever is included after them.
+		complete, ordered bool
+	}
+)
+
+// CheckSPFOverlaps returns an actionable removal for each ip4, ip6 or include
+// mechanism of the SPF record that could be removed without changing which
+// addresses it authorizes, comparing the addresses each authorizes, including
+// those of the records it includes (if they were resolved). A mechanism
+// whose addresses are all matched by those before it with a different result
+// never applies, which is reported as a contradiction instead. A mechanism is
+// never reported as redundant with one that's reported for removal itself, so
+// all of the removals can be made at once.
+func (a *Advisor) CheckSPFOverlaps(spf string, includes []SPFInclude) []string {
+	own := parseSPFTerms(spf)
+	if len(own.networks) == 0 && len(own.includes) < 2 {
+		return nil
+	}
+
+	records := make(map[string]string, len(includes))
+	for _, include := range includes {
+		records[normalizeDomain(include.Domain)] = include.Record
+	}
+
+	var advice []string
+
+	removed := make([]bool, len(own.networks))
+
+	// a network whose addresses are all matched by those before it is never reached
+	for index, network := range own.networks {
+		var (
+			covering    []spfNetwork
+			earlier     iprange.Set
+			contradicts bool
+		)
+
+		for otherIndex, other := range own.networks[:index] {
+			if removed[otherIndex] || !other.addresses.Overlaps(network.addresses) {
+				continue
+			}
+
+			covering = append(covering, other)
+			earlier.Add(other.addresses)
+			contradicts = contradicts || other.qualifier != network.qualifier
+		}
+
+		if !earlier.Covers(network.addresses) {
+			continue
+		}
+
+		removed[index] = true
+
+		if contradicts {
+			verb := "matches"
+			if len(covering) > 1 {
+				verb = "match"
+			}
+
+			advice = append(advice, fmt.Sprintf("%s never applies, as %s before it already %s all of its addresses, %s. Remove it, or move it first if its result should apply.", network.term, joinSPFTerms(covering), verb, spfUnreachablePhrase))
+		} else {
+			advice = append(advice, fmt.Sprintf("%s is already covered by %s, %s.", network.term, joinSPFTerms(covering), spfCoveredPhrase))
+		}
+	}
+
+	// the order of the other mechanisms matters if any of them can fail an address before a network passes it
+	if own.negated {
+		return advice
+	}
+
+	// a network that passes is redundant with the others that pass all of its addresses, wherever they are
+	for index, network := range own.networks {
+		if removed[index] || network.qualifier != '+' {
+			continue
+		}
+
+		if covering, ok := coveringSPFNetworks(network, own.networks, removed, index); ok {
+			removed[index] = true
+			advice = append(advice, fmt.Sprintf("%s is already covered by %s, %s.", network.term, joinSPFTerms(covering), spfCoveredPhrase))
+		}
+	}
+
+	included := make([]*spfIncluded, 0, len(own.includes))
+	for _, domain := range own.includes {
+		included = append(included, resolveSPFInclude(domain, records))
+	}
+
+	// an include that only authorizes addresses authorized elsewhere costs a DNS lookup for nothing
+	dropped := make([]bool, len(included))
+
+	// an address a network fails between two includes could otherwise pass through the one that's left
+	reordered := slices.ContainsFunc(own.networks, func(network spfNetwork) bool { return network.qualifier != '+' })
+
+	// the networks an include is dropped in favor of have to be kept
+	pinned := make([]bool, len(own.networks))
+
+	for index, include := range included {
+		if slices.ContainsFunc(included[:index], func(other *spfIncluded) bool { return other.domain == include.domain }) {
+			dropped[index] = true
+			advice = append(advice, fmt.Sprintf("include:%s is listed more than once, so the repeat can be removed to save one of the 10 DNS lookups SPF allows.", include.domain))
+		}
+
+		for otherIndex, other := range included {
+			if dropped[index] || otherIndex == index || dropped[otherIndex] || reordered || !other.ordered {
+				continue
+			}
+
+			if _, ok := other.reached[include.domain]; ok {
+				dropped[index] = true
+				advice = append(advice, fmt.Sprintf("include:%s is already included by include:%s, so it can be removed to save one of the 10 DNS lookups SPF allows.", include.domain, other.domain))
+			}
+		}
+
+		if dropped[index] || !include.complete || len(include.networks) == 0 {
+			continue
+		}
+
+		var (
+			kept     []int
+			direct   iprange.Set
+			negative bool
+		)
+
+		for networkIndex, network := range own.networks {
+			if removed[networkIndex] || !include.addresses.Overlaps(network.addresses) {
+				continue
+			}
+
+			if network.qualifier != '+' {
+				negative = true
+				break
+			}
+
+			kept = append(kept, networkIndex)
+			direct.Add(network.addresses)
+		}
+
+		if negative || !coversSet(&direct, &include.addresses) {
+			continue
+		}
+
+		// the networks the include duplicates are then the only ones authorizing its addresses, so they're kept
+		dropped[index] = true
+
+		var keptNetworks []spfNetwork
+		for _, networkIndex := range kept {
+			pinned[networkIndex] = true
+			keptNetworks = append(keptNetworks, own.networks[networkIndex])
+		}
+
+		advice = append(advice, fmt.Sprintf("include:%s only authorizes addresses your SPF record already lists (%s), so it can be removed to save one of the 10 DNS lookups SPF allows. Keep those mechanisms rather than the include, as they're then the only ones authorizing its addresses.", include.domain, joinSPFTerms(keptNetworks)))
+	}
+
+	// a network that passes is redundant with the includes that pass all of its addresses, unless they're removed
+	for index, network := range own.networks {
+		if removed[index] || pinned[index] || network.qualifier != '+' || overlapsNegated(network, own.networks, removed) {
+			continue
+		}
+
+		var (
+			addresses iprange.Set
+			through   []string
+		)
+
+		for includeIndex, include := range included {
+			if dropped[includeIndex] || !include.addresses.Overlaps(network.addresses) {
+				continue
+			}
+
+			var covering []spfNetwork
+			for _, other := range include.networks {
+				if other.addresses.Overlaps(network.addresses) {
+					covering = append(covering, other)
+					addresses.Add(other.addresses)
+				}
+			}
+
+			through = append(through, fmt.Sprintf("include:%s (through %s)", include.domain, joinSPFTerms(covering)))
+		}
+
+		if addresses.Covers(network.addresses) {
+			removed[index] = true
+			advice = append(advice, fmt.Sprintf("%s is already authorized by %s, %s, as long as the included records keep authorizing those addresses.", network.term, strings.Join(through, " and "), spfCoveredPhrase))
+		}
+	}
+
+	return advice
+}
+
+// parseSPFTerms returns the terms of the SPF record compared by
+// CheckSPFOverlaps. Invalid ip4 and ip6 mechanisms are left out, along with
+// mechanisms with macros, which depend on the message.
+func parseSPFTerms(record string) spfTerms {
+	var terms spfTerms
+
+	fields := strings.Fields(record)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "v=spf1") {
+		return terms
+	}
+
+	for _, term := range fields[1:] {
+		qualifier := byte('+')
+		if strings.ContainsRune("+-~?", rune(term[0])) {
+			qualifier, term = term[0], term[1:]
+		}
+
+		name, value, _ := strings.Cut(term, ":")
+		name = strings.ToLower(name)
+
+		switch {
+		case strings.Contains(name, "="):
+			// modifiers (such as exp= and redirect=) aren't mechanisms
+			continue
+		case name == "all":
+			return terms
+		case name == "ip4" || name == "ip6":
+			addresses, err := iprange.Parse(value)
+			if err != nil || addresses.From.Is4() != (name == "ip4") {
+				continue
+			}
+
+			display := term
+			if qualifier != '+' {
+				display = string(qualifier) + term
+			}
+
+			terms.networks = append(terms.networks, spfNetwork{term: display, qualifier: qualifier, addresses: addresses})
+		case name == "include" && qualifier == '+' && value != "" && !strings.ContainsRune(value, '%'):
+			terms.includes = append(terms.includes, normalizeDomain(value))
+		default:
+			terms.unknown = true
+			terms.negated = terms.negated || qualifier != '+'
+		}
+	}
+
+	return terms
+}
+
+// resolveSPFInclude returns what the include of the domain authorizes, given
+// the records of every domain included. Only the addresses it's sure to
+// authorize are counted: a network that passes isn't counted if a network
+// before it fails any of its addresses, and the includes of a record with
+// mechanisms that fail aren't followed.
+func resolveSPFInclude(domain string, records map[string]string) *spfIncluded {
+	included := &spfIncluded{domain: domain, reached: make(map[string]struct{}), complete: true, ordered: true}
+
+	var resolve func(domain string)
+	resolve = func(domain string) {
+		record, ok := records[domain]
+		if !ok || record == "" {
+			// the include wasn't resolved, or has no record (which is a permerror)
+			included.complete = false
+			return
+		}
+
+		var failing iprange.Set
+
+		terms := parseSPFTerms(record)
+		included.complete = included.complete && !terms.unknown
+
+		for _, network := range terms.networks {
+			if network.qualifier != '+' {
+				failing.Add(network.addresses)
+				continue
+			}
+
+			if failing.Overlaps(network.addresses) {
+				included.complete = false
+				continue
+			}
+
+			included.networks = append(included.networks, network)
+			included.addresses.Add(network.addresses)
+		}
+
+		if terms.negated || !failing.IsEmpty() {
+			// what fails before each include isn't known, so they aren't followed
+			included.complete = included.complete && len(terms.includes) == 0
+			included.ordered = false
+
+			return
+		}
+
+		for _, target := range terms.includes {
+			if _, ok := included.reached[target]; ok || target == included.domain {
+				continue
+			}
+
+			included.reached[target] = struct{}{}
+			resolve(target)
+		}
+	}
+
+	resolve(domain)
+
+	return included
+}
+
+// coveringSPFNetworks returns the other networks that pass any of the
+// network's addresses, if they pass all of them and none of the networks
+// overlapping it fail. The networks already removed are left out.
+func coveringSPFNetworks(network spfNetwork, networks []spfNetwork, removed []bool, index int) ([]spfNetwork, bool) {
+	var (
+		covering  []spfNetwork
+		addresses iprange.Set
+	)
+
+	for otherIndex, other := range networks {
+		if otherIndex == index || removed[otherIndex] || !other.addresses.Overlaps(network.addresses) {
+			continue
+		}
+
+		if other.qualifier != '+' {
+			return nil, false
+		}
+
+		covering = append(covering, other)
+		addresses.Add(other.addresses)
+	}
+
+	return covering, addresses.Covers(network.addresses)
+}
+
+// overlapsNegated reports whether any of the networks that aren't removed
+// fails (or doesn't pass) any of the network's addresses.
+func overlapsNegated(network spfNetwork, networks []spfNetwork, removed []bool) bool {
+	for index, other := range networks {
+		if !removed[index] && other.qualifier != '+' && other.addresses.Overlaps(network.addresses) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// coversSet reports whether every address of other is in the set.
+func coversSet(set, other *iprange.Set) bool {
+	for _, r := range other.Ranges() {
+		if !set.Covers(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// joinSPFTerms joins the mechanisms of the networks, such as "ip4:192.0.2.0/25
+// and ip4:192.0.2.128/25".
+func joinSPFTerms(networks []spfNetwork) string {
+	terms := make([]string, 0, len(networks))
+	for _, network := range networks {
+		terms = append(terms, network.term)
+	}
+
+	if len(terms) < 2 {
+		return strings.Join(terms, "")
+	}
+
+	return strings.Join(terms[:len(terms)-1], ", ") + " and " + terms[len(terms)-1]
+}
@@ -0,0 +1,128 @@
+package advisor
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCheckSPFOverlaps(t *testing.T) {
+	advisor := NewAdvisor(time.Second, 0, false)
+
+	provider := []SPFInclude{{Domain: "_spf.example.net", Record: "v=spf1 ip4:198.51.100.0/24 ip6:2001:db8::/32 ~all"}}
+
+	tests := []struct {
+		name     string
+		spf      string
+		includes []SPFInclude
+		expected []string
+	}{
+		{"NotSPF", "v=DMARC1; p=reject", nil, nil},
+		{"NoOverlap", "v=spf1 ip4:192.0.2.0/24 ip4:203.0.113.0/24 ip6:2001:db8::/32 -all", nil, nil},
+		{"AddressInNetwork", "v=spf1 ip4:203.0.113.0/24 ip4:203.0.113.5 -all", nil, []string{
+			"ip4:203.0.113.5 is already covered by ip4:203.0.113.0/24, so it can be removed to shorten your SPF record.",
+		}},
+		{"AddressBeforeNetwork", "v=spf1 +ip4:203.0.113.5 ip4:203.0.113.0/24 -all", nil, []string{
+			"ip4:203.0.113.5 is already covered by ip4:203.0.113.0/24, so it can be removed to shorten your SPF record.",
+		}},
+		{"Duplicate", "v=spf1 ip4:192.0.2.1 a ip4:192.0.2.1 -all", nil, []string{
+			"ip4:192.0.2.1 is already covered by ip4:192.0.2.1, so it can be removed to shorten your SPF record.",
+		}},
+		{"Union", "v=spf1 ip4:192.0.2.0/25 ip4:192.0.2.128/25 ip4:192.0.2.0/24 -all", nil, []string{
+			"ip4:192.0.2.0/24 is already covered by ip4:192.0.2.0/25 and ip4:192.0.2.128/25, so it can be removed to shorten your SPF record.",
+		}},
+		{"IPv6", "v=spf1 ip6:2001:db8:1::1 ip6:2001:db8::/32 ip4:0.0.0.0/1 ~all", nil, []string{
+			"ip6:2001:db8:1::1 is already covered by ip6:2001:db8::/32, so it can be removed to shorten your SPF record.",
+		}},
+		{"OtherFamily", "v=spf1 ip4:0.0.0.0/0 ip6:::ffff:192.0.2.1 ip6:2001:db8::1 -all", nil, nil},
+		{"Unreachable", "v=spf1 ip4:192.0.2.0/24 -ip4:192.0.2.7 -all", nil, []string{
+			"-ip4:192.0.2.7 never applies, as ip4:192.0.2.0/24 before it already matches all of its addresses, and receivers use the first mechanism that matches. Remove it, or move it first if its result should apply.",
+		}},
+		{"Excluded", "v=spf1 -ip4:192.0.2.7 ip4:192.0.2.0/24 ip4:192.0.2.7 -all", nil, []string{
+			"ip4:192.0.2.7 never applies, as -ip4:192.0.2.7 and ip4:192.0.2.0/24 before it already match all of its addresses, and receivers use the first mechanism that matches. Remove it, or move it first if its result should apply.",
+		}},
+		{"ExcludedBeforeNetwork", "v=spf1 -ip4:192.0.2.7 ip4:192.0.2.0/24 -all", nil, nil},
+		{"AfterAll", "v=spf1 ip4:192.0.2.0/24 -all ip4:192.0.2.7", nil, nil},
+		{"NegatedMechanism", "v=spf1 -a ip4:192.0.2.7 ip4:192.0.2.0/24 -all", nil, nil},
+		{"NegatedMechanismAfter", "v=spf1 -a ip4:192.0.2.0/24 ip4:192.0.2.7 -all", nil, []string{
+			"ip4:192.0.2.7 is already covered by ip4:192.0.2.0/24, so it can be removed to shorten your SPF record.",
+		}},
+		{"Invalid", "v=spf1 ip4:192.0.2.0/33 ip4:2001:db8::1 ip4:192.0.2.0/24 -all", nil, nil},
+		{"CoveredByInclude", "v=spf1 ip4:198.51.100.7 ip6:2001:db8::25 include:_spf.example.net -all", provider, []string{
+			"ip4:198.51.100.7 is already authorized by include:_spf.example.net (through ip4:198.51.100.0/24), so it can be removed to shorten your SPF record, as long as the included records keep authorizing those addresses.",
+			"ip6:2001:db8::25 is already authorized by include:_spf.example.net (through ip6:2001:db8::/32), so it can be removed to shorten your SPF record, as long as the included records keep authorizing those addresses.",
+		}},
+		{"CoveredByNestedInclude", "v=spf1 ip4:198.51.100.7 include:_outer.example.net -all", []SPFInclude{
+			{Domain: "_outer.example.net", Record: "v=spf1 include:_spf.example.net ~all"},
+			provider[0],
+		}, []string{
+			"ip4:198.51.100.7 is already authorized by include:_outer.example.net (through ip4:198.51.100.0/24), so it can be removed to shorten your SPF record, as long as the included records keep authorizing those addresses.",
+		}},
+		{"PartlyCoveredByInclude", "v=spf1 ip4:198.51.100.0/23 include:_spf.example.net -all", provider, nil},
+		{"UnresolvedInclude", "v=spf1 ip4:198.51.100.7 include:_spf.example.net -all", nil, nil},
+		{"ExcludedBeforeInclude", "v=spf1 -ip4:198.51.100.0/25 ip4:198.51.100.7 include:_spf.example.net -all", provider, []string{
+			"ip4:198.51.100.7 never applies, as -ip4:198.51.100.0/25 before it already matches all of its addresses, and receivers use the first mechanism that matches. Remove it, or move it first if its result should apply.",
+		}},
+		{"ExcludedInInclude", "v=spf1 ip4:198.51.100.7 include:_spf.example.net -all", []SPFInclude{
+			{Domain: "_spf.example.net", Record: "v=spf1 -ip4:198.51.100.7 ip4:198.51.100.0/24 -all"},
+		}, nil},
+		{"RedundantInclude", "v=spf1 ip4:198.51.100.0/24 ip6:2001:db8::/32 include:_spf.example.net -all", provider, []string{
+			"include:_spf.example.net only authorizes addresses your SPF record already lists (ip4:198.51.100.0/24 and ip6:2001:db8::/32), so it can be removed to save one of the 10 DNS lookups SPF allows. Keep those mechanisms rather than the include, as they're then the only ones authorizing its addresses.",
+		}},
+		{"IncludeAuthorizesMore", "v=spf1 ip4:198.51.100.0/24 include:_spf.example.net -all", []SPFInclude{
+			{Domain: "_spf.example.net", Record: "v=spf1 ip4:198.51.100.0/24 a:mail.example.net -all"},
+		}, []string{
+			"ip4:198.51.100.0/24 is already authorized by include:_spf.example.net (through ip4:198.51.100.0/24), so it can be removed to shorten your SPF record, as long as the included records keep authorizing those addresses.",
+		}},
+		{"IncludeWithoutRecord", "v=spf1 ip4:198.51.100.0/24 include:_spf.example.net -all", []SPFInclude{{Domain: "_spf.example.net"}}, nil},
+		{"RepeatedInclude", "v=spf1 include:_spf.example.net include:_spf.example.net. -all", provider, []string{
+			"include:_spf.example.net is listed more than once, so the repeat can be removed to save one of the 10 DNS lookups SPF allows.",
+		}},
+		{"NestedInclude", "v=spf1 include:_netblocks.example.net include:_spf.example.org -all", []SPFInclude{
+			{Domain: "_netblocks.example.net", Record: "v=spf1 ip4:192.0.2.0/24 ~all"},
+			{Domain: "_spf.example.org", Record: "v=spf1 include:_netblocks.example.net include:_other.example.org ~all"},
+			{Domain: "_other.example.org", Record: "v=spf1 ip4:203.0.113.0/24 ~all"},
+		}, []string{
+			"include:_netblocks.example.net is already included by include:_spf.example.org, so it can be removed to save one of the 10 DNS lookups SPF allows.",
+		}},
+		{"NestedIncludeAfterFailure", "v=spf1 include:_netblocks.example.net include:_spf.example.org -all", []SPFInclude{
+			{Domain: "_netblocks.example.net", Record: "v=spf1 ip4:192.0.2.0/24 ~all"},
+			{Domain: "_spf.example.org", Record: "v=spf1 -ip4:192.0.2.7 include:_netblocks.example.net ~all"},
+		}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckSPFOverlaps(test.spf, test.includes)
+			if !slices.Equal(advice, test.expected) {
+				t.Errorf("found %q, want %q", advice, test.expected)
+			}
+		})
+	}
+}
+
+func TestCheckSPFOverlaps_Severity(t *testing.T) {
+	advisor := NewAdvisor(time.Second, 0, false)
+
+	tests := []struct {
+		spf      string
+		includes []SPFInclude
+		severity Severity
+	}{
+		{"v=spf1 ip4:203.0.113.0/24 ip4:203.0.113.5 -all", nil, SeverityLow},
+		{"v=spf1 ip4:192.0.2.0/24 -ip4:192.0.2.7 -all", nil, SeverityMedium},
+		{"v=spf1 ip4:198.51.100.0/24 include:_spf.example.net -all", []SPFInclude{{Domain: "_spf.example.net", Record: "v=spf1 ip4:198.51.100.0/25 -all"}}, SeverityLow},
+		{"v=spf1 include:_spf.example.net include:_spf.example.net -all", nil, SeverityLow},
+	}
+
+	for _, test := range tests {
+		advice := advisor.CheckSPFOverlaps(test.spf, test.includes)
+		if len(advice) != 1 {
+			t.Fatalf("found %q, want a single line of advice", advice)
+		}
+
+		if severity := Classify(advice[0]); severity != test.severity {
+			t.Errorf("found %v for %q, want %v", severity, advice[0], test.severity)
+		}
+	}
+}
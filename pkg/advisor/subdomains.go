@@ -0,0 +1,106 @@
+package advisor
+
+import "fmt"
+
+// SendingSubdomain holds the mail authentication records a subdomain of the
+// domain publishes itself.
+type SendingSubdomain struct {
+	Name  string
+	SPF   string
+	DKIM  string
+	DMARC string
+}
+
+// CheckSendingSubdomains returns advice on the sending subdomains that exist
+// for the domain, grouped by subdomain: whether each publishes its own SPF and
+// DKIM records, and which DMARC policy applies to it. Subdomains without their
+// own DMARC record inherit the domain's (its sp tag if present, otherwise its
+// p tag).
+func (a *Advisor) CheckSendingSubdomains(domain, dmarc string, subdomains []SendingSubdomain) []string {
+	if len(subdomains) == 0 {
+		return []string{"None of the common sending subdomains checked exist. No further action needed."}
+	}
+
+	domainRecord := parseDMARC(dmarc)
+
+	var advice []string
+
+	for _, subdomain := range subdomains {
+		var subdomainAdvice []string
+
+		if subdomain.SPF == "" {
+			subdomainAdvice = append(subdomainAdvice, fmt.Sprintf("%s exists but doesn't publish an SPF record. If it sends mail, publish one listing its senders, otherwise publish v=spf1 -all so receivers reject mail claiming to be from it.", subdomain.Name))
+		}
+
+		if subdomain.DKIM == "" {
+			subdomainAdvice = append(subdomainAdvice, fmt.Sprintf("%s doesn't publish a DKIM key at any of the selectors checked. If it sends mail, make sure it's signed with DKIM.", subdomain.Name))
+		}
+
+		var policy, coveredBy string
+
+		if subdomain.DMARC != "" {
+			coveredBy = "its own DMARC record"
+
+			if record := parseDMARC(subdomain.DMARC); record != nil {
+				policy = record.Policy
+			}
+		} else if domainRecord != nil {
+			coveredBy = "the DMARC record of " + domain
+			policy = domainRecord.subdomainPolicy()
+		}
+
+		switch {
+		case coveredBy == "":
+			subdomainAdvice = append(subdomainAdvice, fmt.Sprintf("No DMARC policy applies to %s, as neither it nor %s publishes a DMARC record.", subdomain.Name, domain))
+		case policy == "quarantine" || policy == "reject":
+			if len(subdomainAdvice) == 0 {
+				subdomainAdvice = append(subdomainAdvice, fmt.Sprintf("%s publishes SPF and DKIM records, and is covered by %s at p=%s. No further action needed.", subdomain.Name, coveredBy, policy))
+			} else {
+				subdomainAdvice = append(subdomainAdvice, fmt.Sprintf("%s is covered by %s at p=%s.", subdomain.Name, coveredBy, policy))
+			}
+		case policy == "none":
+			subdomainAdvice = append(subdomainAdvice, fmt.Sprintf("%s is covered by %s at p=none, so mail spoofing it isn't blocked. Move it to quarantine or reject once its legitimate mail passes DMARC.", subdomain.Name, coveredBy))
+		default:
+			subdomainAdvice = append(subdomainAdvice, fmt.Sprintf("No DMARC policy applies to %s, as %s doesn't specify a valid policy.", subdomain.Name, coveredBy))
+		}
+
+		advice = append(advice, subdomainAdvice...)
+	}
+
+	return advice
+}
+
+// CheckInheritedDMARC returns the DMARC advice for a subdomain that doesn't
+// publish a DMARC record of its own, so is covered by the record of its
+// organizational domain instead (its sp tag if present, otherwise its p tag).
+func (a *Advisor) CheckInheritedDMARC(domain, organizational, record string) []string {
+	organizationalRecord := parseDMARC(record)
+	if organizationalRecord == nil {
+		return []string{fmt.Sprintf("No DMARC policy applies to %s, as it doesn't publish a DMARC record and the DMARC record of %s is invalid.", domain, organizational)}
+	}
+
+	tag, policy := "p", organizationalRecord.Policy
+	if organizationalRecord.SubdomainPolicy != "" {
+		tag, policy = "sp", organizationalRecord.SubdomainPolicy
+	}
+
+	switch policy {
+	case "quarantine", "reject":
+		return []string{fmt.Sprintf("%s doesn't publish a DMARC record of its own, and is covered by the DMARC record of %s at %s=%s. No further action needed.", domain, organizational, tag, policy)}
+	case "none":
+		return []string{fmt.Sprintf("%s doesn't publish a DMARC record of its own, and is covered by the DMARC record of %s at %s=none, so mail spoofing it isn't blocked. Set sp=quarantine or sp=reject on that record (or publish a record for the subdomain) once its legitimate mail passes DMARC.", domain, organizational, tag)}
+	default:
+		return []string{fmt.Sprintf("No DMARC policy applies to %s, as it doesn't publish a DMARC record and the DMARC record of %s doesn't specify a valid policy.", domain, organizational)}
+	}
+}
+
+// subdomainPolicy returns the policy the record applies to subdomains that
+// don't publish a record of their own: its sp tag if present, otherwise its p
+// tag.
+func (d *dmarc) subdomainPolicy() string {
+	if d.SubdomainPolicy != "" {
+		return d.SubdomainPolicy
+	}
+
+	return d.Policy
+}
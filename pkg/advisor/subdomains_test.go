@@ -0,0 +1,122 @@
+package advisor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_CheckSendingSubdomains(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("None", func(t *testing.T) {
+		advice := advisor.CheckSendingSubdomains("example.com", "", nil)
+
+		if len(advice) != 1 || Classify(advice[0]) != SeverityInfo {
+			t.Errorf("found %v, want the no subdomains advice", advice)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		dmarc      string
+		subdomain  SendingSubdomain
+		prefixes   []string
+		severities []Severity
+	}{
+		{
+			name:       "Authenticated",
+			dmarc:      "v=DMARC1; p=reject; sp=quarantine",
+			subdomain:  SendingSubdomain{Name: "em.example.com", SPF: "v=spf1 include:sendgrid.net -all", DKIM: "v=DKIM1; p=KEY"},
+			prefixes:   []string{"em.example.com publishes SPF and DKIM records, and is covered by the DMARC record of example.com at p=quarantine."},
+			severities: []Severity{SeverityInfo},
+		},
+		{
+			name:       "Unauthenticated",
+			dmarc:      "v=DMARC1; p=reject",
+			subdomain:  SendingSubdomain{Name: "news.example.com"},
+			prefixes:   []string{"news.example.com exists but doesn't publish an SPF record", "news.example.com doesn't publish a DKIM key", "news.example.com is covered by the DMARC record of example.com at p=reject."},
+			severities: []Severity{SeverityMedium, SeverityLow, SeverityInfo},
+		},
+		{
+			name:       "OwnMonitoringPolicy",
+			dmarc:      "v=DMARC1; p=reject",
+			subdomain:  SendingSubdomain{Name: "mg.example.com", SPF: "v=spf1 include:mailgun.org ~all", DKIM: "v=DKIM1; p=KEY", DMARC: "v=DMARC1; p=none"},
+			prefixes:   []string{"mg.example.com is covered by its own DMARC record at p=none"},
+			severities: []Severity{SeverityMedium},
+		},
+		{
+			name:       "NoDMARC",
+			subdomain:  SendingSubdomain{Name: "mail.example.com", SPF: "v=spf1 mx -all", DKIM: "v=DKIM1; p=KEY"},
+			prefixes:   []string{"No DMARC policy applies to mail.example.com, as neither it nor example.com publishes a DMARC record."},
+			severities: []Severity{SeverityMedium},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckSendingSubdomains("example.com", test.dmarc, []SendingSubdomain{test.subdomain})
+
+			if len(advice) != len(test.prefixes) {
+				t.Fatalf("found %v, want %d lines of advice", advice, len(test.prefixes))
+			}
+
+			for index, line := range advice {
+				if !strings.HasPrefix(line, test.prefixes[index]) {
+					t.Errorf("found %q, want advice starting with %q", line, test.prefixes[index])
+				}
+
+				if severity := Classify(line); severity != test.severities[index] {
+					t.Errorf("found %v for %q, want %v", severity, line, test.severities[index])
+				}
+			}
+		})
+	}
+
+	t.Run("Grouped", func(t *testing.T) {
+		subdomains := []SendingSubdomain{{Name: "em.example.com"}, {Name: "news.example.com"}}
+		advice := advisor.CheckSendingSubdomains("example.com", "v=DMARC1; p=reject", subdomains)
+
+		var names []string
+		for _, line := range advice {
+			name, _, _ := strings.Cut(line, " ")
+			names = append(names, name)
+		}
+
+		expected := []string{"em.example.com", "em.example.com", "em.example.com", "news.example.com", "news.example.com", "news.example.com"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("found %v, want the advice grouped by subdomain", names)
+		}
+	})
+}
+
+func TestAdvisor_CheckInheritedDMARC(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	tests := []struct {
+		name     string
+		record   string
+		prefix   string
+		severity Severity
+	}{
+		{"SubdomainPolicy", "v=DMARC1; p=none; sp=reject", "mail.example.com doesn't publish a DMARC record of its own, and is covered by the DMARC record of example.com at sp=reject.", SeverityInfo},
+		{"Policy", "v=DMARC1; p=quarantine", "mail.example.com doesn't publish a DMARC record of its own, and is covered by the DMARC record of example.com at p=quarantine.", SeverityInfo},
+		{"Monitoring", "v=DMARC1; p=reject; sp=none", "mail.example.com doesn't publish a DMARC record of its own, and is covered by the DMARC record of example.com at sp=none, so mail spoofing it isn't blocked.", SeverityMedium},
+		{"InvalidPolicy", "v=DMARC1; p=block", "No DMARC policy applies to mail.example.com", SeverityMedium},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckInheritedDMARC("mail.example.com", "example.com", test.record)
+
+			if len(advice) != 1 || !strings.HasPrefix(advice[0], test.prefix) {
+				t.Fatalf("found %v, want advice starting with %q", advice, test.prefix)
+			}
+
+			if severity := Classify(advice[0]); severity != test.severity {
+				t.Errorf("found %v for %q, want %v", severity, advice[0], test.severity)
+			}
+		})
+	}
+}
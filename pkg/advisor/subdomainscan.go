@@ -0,0 +1,120 @@
+package advisor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// subdomainSkippedChecks are the checks that are skipped for a scanned
+// subdomain (see WithSubdomainAdvice), as they're about the organization's
+// brand and website rather than a subdomain's mail: BIMI (unless the
+// subdomain publishes a BIMI record of its own) and the domain's web server.
+var subdomainSkippedChecks = []string{"bimi", "domain"}
+
+// WithSubdomainAdvice sets whether the advice of a scanned subdomain (a
+// domain below its organizational domain, see OrganizationalDomain) is
+// tailored to it, which it is by default. Its DMARC advice then reports the
+// policy it inherits from its organizational domain when it doesn't publish
+// a record of its own. A subdomain without MX records isn't told it can't
+// receive mail, and one without an SPF record is only warned if it appears
+// to send mail: it has MX records, or its organizational domain's SPF record
+// names it. The BIMI and domain checks are skipped (see WithSubdomainChecks).
+// Disabling it advises subdomains as if they were organizational domains.
+func WithSubdomainAdvice(enabled bool) Option {
+	return func(a *Advisor) {
+		a.subdomainAdvice = enabled
+	}
+}
+
+// WithSubdomainChecks runs the named checks (bimi or domain) for scanned
+// subdomains, which are otherwise skipped (see WithSubdomainAdvice). The
+// BIMI check always runs for a subdomain that publishes a BIMI record.
+func WithSubdomainChecks(names ...string) Option {
+	return func(a *Advisor) {
+		a.subdomainChecks = append(a.subdomainChecks, names...)
+	}
+}
+
+// ValidateSubdomainCheck returns an error if the check isn't one of those
+// skipped for subdomains, as accepted by WithSubdomainChecks.
+func ValidateSubdomainCheck(name string) error {
+	if !slices.Contains(subdomainSkippedChecks, name) {
+		return fmt.Errorf("unknown subdomain check %q, expected one of %v", name, subdomainSkippedChecks)
+	}
+
+	return nil
+}
+
+// SubdomainAdvice reports whether the advice of the domain is tailored to a
+// subdomain (see WithSubdomainAdvice), as it's below its organizational
+// domain.
+func (a *Advisor) SubdomainAdvice(domain string) bool {
+	return a.subdomainAdvice && OrganizationalDomain(domain) != normalizeDomain(domain)
+}
+
+// skipsForSubdomain reports whether the named check is skipped for the
+// scanned subdomain.
+func (a *Advisor) skipsForSubdomain(name string, input *ScanInput) bool {
+	switch {
+	case !slices.Contains(subdomainSkippedChecks, name), slices.Contains(a.subdomainChecks, name):
+		return false
+	case name == "bimi":
+		return input.BIMI == ""
+	}
+
+	return true
+}
+
+// subdomainMXAdvice returns the MX advice of a subdomain without MX records,
+// which is usual for a subdomain that doesn't receive mail.
+func subdomainMXAdvice(domain string) string {
+	return fmt.Sprintf("%s doesn't have any mail servers setup, so it cannot receive email, which is usual for a subdomain. No further action needed.", normalizeDomain(domain))
+}
+
+// subdomainSendsMail reports whether the subdomain appears to send mail: it
+// has MX records, or its organizational domain's SPF record names it (or a
+// name below it), such as with include:_spf.marketing.example.com or
+// a:marketing.example.com.
+func subdomainSendsMail(input *ScanInput) bool {
+	if len(input.MX) > 0 {
+		return true
+	}
+
+	fields := strings.Fields(input.OrganizationalSPF)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "v=spf1") {
+		return false
+	}
+
+	domain := normalizeDomain(input.Domain)
+
+	for _, term := range fields[1:] {
+		term = strings.TrimLeft(term, "+-~?")
+
+		_, target, found := strings.Cut(term, ":")
+		if !found {
+			_, target, _ = strings.Cut(term, "=")
+		}
+
+		target, _, _ = strings.Cut(target, "/")
+		if target = normalizeDomain(target); target == domain || strings.HasSuffix(target, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subdomainSPFAdvice returns the SPF advice of a subdomain without an SPF
+// record that doesn't appear to send mail, naming the organizational domain
+// whose SPF record doesn't name it, if it has one.
+func subdomainSPFAdvice(input *ScanInput) string {
+	domain := normalizeDomain(input.Domain)
+	reason := "as it has no MX records"
+
+	if input.OrganizationalSPF != "" {
+		reason += " and isn't named by the SPF record of " + OrganizationalDomain(domain)
+	}
+
+	return fmt.Sprintf("%s doesn't publish an SPF record, but doesn't appear to send mail, %s. No further action needed.", domain, reason)
+}
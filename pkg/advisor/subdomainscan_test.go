@@ -0,0 +1,114 @@
+package advisor
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAdvisor_SubdomainAdvice(t *testing.T) {
+	const (
+		missingMX  = "You do not have any mail servers setup, so you cannot receive email at this domain."
+		missingSPF = "We couldn't detect any active SPF record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."
+		goodDomain = "Your domain looks good! No further action needed."
+	)
+
+	testCases := []struct {
+		name  string
+		opts  []Option
+		input ScanInput
+
+		// a nil want means the check was skipped, other than wantDMARC,
+		// which is only compared if set
+		wantBIMI, wantDomain, wantDMARC, wantMX, wantSPF []string
+	}{
+		{
+			name:       "OrganizationalDomain",
+			input:      ScanInput{Domain: "example.com", OrganizationalDMARC: "v=DMARC1; p=reject", OrganizationalSPF: "v=spf1 mx -all"},
+			wantBIMI:   []string{"We couldn't detect any active BIMI record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."},
+			wantDomain: []string{goodDomain},
+			wantDMARC:  []string{"You do not have DMARC setup!"},
+			wantMX:     []string{missingMX},
+			wantSPF:    []string{missingSPF},
+		},
+		{
+			name: "SubdomainWithRecords",
+			input: ScanInput{
+				Domain: "marketing.example.com",
+				BIMI:   "v=BIMI1; l=https://marketing.example.com/logo.svg",
+				DMARC:  "v=DMARC1; p=reject",
+				MX:     []string{"mx1.example.com."},
+				SPF:    "v=spf1 ~all",
+			},
+			wantBIMI: []string{"Your BIMI record has some issues:", "Your BIMI record is missing the VMC cert URL.", "The download of your SVG logo was skipped: offline mode."},
+			wantMX:   []string{"You have a single mail server setup, but it's recommended that you have at least two setup in case the first one fails."},
+			wantSPF:  []string{"Your SPF record ends in ~all, which is the safer choice while your DMARC policy isn't enforced at p=reject, as -all risks losing forwarded mail. No further action needed."},
+		},
+		{
+			name:      "SubdomainNamedByOrganizationalSPF",
+			input:     ScanInput{Domain: "news.example.com", OrganizationalDMARC: "v=DMARC1; p=reject", OrganizationalSPF: "v=spf1 include:_spf.news.example.com -all"},
+			wantDMARC: []string{"news.example.com doesn't publish a DMARC record of its own, and is covered by the DMARC record of example.com at p=reject. No further action needed."},
+			wantMX:    []string{"news.example.com doesn't have any mail servers setup, so it cannot receive email, which is usual for a subdomain. No further action needed."},
+			wantSPF:   []string{missingSPF},
+		},
+		{
+			name:      "BareSubdomain",
+			input:     ScanInput{Domain: "www.example.com", OrganizationalDMARC: "v=DMARC1; p=reject", OrganizationalSPF: "v=spf1 mx -all"},
+			wantDMARC: []string{"www.example.com doesn't publish a DMARC record of its own, and is covered by the DMARC record of example.com at p=reject. No further action needed."},
+			wantMX:    []string{"www.example.com doesn't have any mail servers setup, so it cannot receive email, which is usual for a subdomain. No further action needed."},
+			wantSPF:   []string{"www.example.com doesn't publish an SPF record, but doesn't appear to send mail, as it has no MX records and isn't named by the SPF record of example.com. No further action needed."},
+		},
+		{
+			name:      "BareSubdomainWithoutOrganizationalSPF",
+			input:     ScanInput{Domain: "www.example.com"},
+			wantDMARC: []string{"You do not have DMARC setup!"},
+			wantMX:    []string{"www.example.com doesn't have any mail servers setup, so it cannot receive email, which is usual for a subdomain. No further action needed."},
+			wantSPF:   []string{"www.example.com doesn't publish an SPF record, but doesn't appear to send mail, as it has no MX records. No further action needed."},
+		},
+		{
+			name:       "SubdomainAdviceDisabled",
+			opts:       []Option{WithSubdomainAdvice(false)},
+			input:      ScanInput{Domain: "www.example.com", OrganizationalDMARC: "v=DMARC1; p=reject", OrganizationalSPF: "v=spf1 mx -all"},
+			wantBIMI:   []string{"We couldn't detect any active BIMI record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."},
+			wantDomain: []string{goodDomain},
+			wantDMARC:  []string{"You do not have DMARC setup!"},
+			wantMX:     []string{missingMX},
+			wantSPF:    []string{missingSPF},
+		},
+		{
+			name:       "SubdomainChecks",
+			opts:       []Option{WithSubdomainChecks("bimi", "domain")},
+			input:      ScanInput{Domain: "www.example.com", OrganizationalDMARC: "v=DMARC1; p=reject", OrganizationalSPF: "v=spf1 mx -all"},
+			wantBIMI:   []string{"We couldn't detect any active BIMI record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."},
+			wantDomain: []string{goodDomain},
+			wantDMARC:  []string{"www.example.com doesn't publish a DMARC record of its own, and is covered by the DMARC record of example.com at p=reject. No further action needed."},
+			wantMX:     []string{"www.example.com doesn't have any mail servers setup, so it cannot receive email, which is usual for a subdomain. No further action needed."},
+			wantSPF:    []string{"www.example.com doesn't publish an SPF record, but doesn't appear to send mail, as it has no MX records and isn't named by the SPF record of example.com. No further action needed."},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			advisor := NewAdvisor(time.Second, time.Minute, false, append([]Option{WithOffline(true)}, testCase.opts...)...)
+			defer advisor.Close()
+
+			advice := advisor.CheckAllInput(context.Background(), testCase.input)
+
+			for name, check := range map[string]struct{ found, want []string }{
+				"bimi":   {advice.BIMI, testCase.wantBIMI},
+				"domain": {advice.Domain, testCase.wantDomain},
+				"mx":     {advice.MX, testCase.wantMX},
+				"spf":    {advice.SPF, testCase.wantSPF},
+			} {
+				if !slices.Equal(check.found, check.want) {
+					t.Errorf("%s: found %q, want %q", name, check.found, check.want)
+				}
+			}
+
+			if testCase.wantDMARC != nil && !slices.Equal(advice.DMARC, testCase.wantDMARC) {
+				t.Errorf("dmarc: found %q, want %q", advice.DMARC, testCase.wantDMARC)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package advisor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tidy post-processes the advice of CheckAllInput, so one underlying problem
+// isn't reported more noisily than it warrants: repeated lines are removed from
+// each section, the MX advice shared by several hosts is collapsed into a
+// single line (unless the advisor is detailed), and each section is ordered by
+// severity, most severe first, keeping lines of the same severity in the order
+// their check reported them.
+func (a *Advisor) tidy(advice *Advice, mx []string) {
+	if !a.detailed {
+		advice.MX = collapseHostAdvice(advice.MX, mx)
+	}
+
+	for _, section := range advice.sections() {
+		*section.advice = sortBySeverity(dedupeAdvice(*section.advice))
+	}
+
+	for name, extension := range advice.Extensions {
+		advice.Extensions[name] = sortBySeverity(dedupeAdvice(extension))
+	}
+}
+
+// dedupeAdvice returns the advice without any repeated lines, keeping the
+// first of each.
+func dedupeAdvice(advice []string) []string {
+	if len(advice) < 2 {
+		return advice
+	}
+
+	seen := make(map[string]struct{}, len(advice))
+	deduped := make([]string, 0, len(advice))
+
+	for _, line := range advice {
+		if _, ok := seen[line]; ok {
+			continue
+		}
+
+		seen[line] = struct{}{}
+		deduped = append(deduped, line)
+	}
+
+	return deduped
+}
+
+// collapseHostAdvice collapses the per-host lines of the MX advice (those
+// prefixed with "<hostname>: ") that more than one host shares into a single
+// line, such as "3 of 5 MX hosts: Failed to reach domain", at the position of
+// the first of them. Lines only one host reported, and lines that aren't
+// prefixed with one of the MX hosts, are kept as they are.
+func collapseHostAdvice(advice []string, mx []string) []string {
+	hosts := make(map[string]struct{}, len(mx))
+	for _, serverAddress := range mx {
+		if hostname, ok := normalizeHostname(serverAddress); ok {
+			hosts[hostname] = struct{}{}
+		}
+	}
+
+	// the hosts reporting each message, which are only counted once each
+	reported := make(map[string]map[string]struct{})
+
+	for _, line := range advice {
+		if hostname, message, ok := hostAdvice(line, hosts); ok {
+			if reported[message] == nil {
+				reported[message] = make(map[string]struct{})
+			}
+
+			reported[message][hostname] = struct{}{}
+		}
+	}
+
+	collapsed := make([]string, 0, len(advice))
+	added := make(map[string]struct{})
+
+	for _, line := range advice {
+		_, message, ok := hostAdvice(line, hosts)
+		if !ok || len(reported[message]) < 2 {
+			collapsed = append(collapsed, line)
+			continue
+		}
+
+		if _, ok := added[message]; ok {
+			continue
+		}
+
+		added[message] = struct{}{}
+		collapsed = append(collapsed, fmt.Sprintf("%d of %d MX hosts: %s", len(reported[message]), len(hosts), message))
+	}
+
+	return collapsed
+}
+
+// hostAdvice splits a line of MX advice into the host it's about and its
+// message, if it's prefixed with one of the given hosts.
+func hostAdvice(line string, hosts map[string]struct{}) (string, string, bool) {
+	hostname, message, ok := strings.Cut(line, ": ")
+	if !ok {
+		return "", "", false
+	}
+
+	if _, ok = hosts[hostname]; !ok {
+		return "", "", false
+	}
+
+	return hostname, message, true
+}
+
+// sortBySeverity orders the advice by severity, most severe first, keeping
+// lines of the same severity in their original order.
+func sortBySeverity(advice []string) []string {
+	severities := make(map[string]Severity, len(advice))
+	for _, line := range advice {
+		severities[line] = Classify(line)
+	}
+
+	sort.SliceStable(advice, func(i, j int) bool {
+		return severities[advice[i]] > severities[advice[j]]
+	})
+
+	return advice
+}
@@ -0,0 +1,153 @@
+package advisor
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDedupeAdvice(t *testing.T) {
+	advice := []string{"Invalid report interval specified, it must be a positive integer.", "Consider specifying", "Invalid report interval specified, it must be a positive integer."}
+	expected := []string{"Invalid report interval specified, it must be a positive integer.", "Consider specifying"}
+
+	if found := dedupeAdvice(advice); !reflect.DeepEqual(found, expected) {
+		t.Errorf("found %v, want %v", found, expected)
+	}
+}
+
+func TestCollapseHostAdvice(t *testing.T) {
+	const multiple = "You have multiple mail servers setup, which is recommended."
+
+	tls12 := checkTLSVersion(tls.VersionTLS12)
+	tls13 := checkTLSVersion(tls.VersionTLS13)
+	mx := []string{"mx1.example.com.", "mx2.example.com.", "mx3.example.com.", "mx4.example.com.", "mx5.example.com."}
+
+	tests := []struct {
+		name     string
+		advice   []string
+		mx       []string
+		expected []string
+	}{
+		{
+			name: "SharedMessage",
+			advice: []string{
+				multiple,
+				"mx1.example.com: " + tls13,
+				"mx2.example.com: Failed to reach domain",
+				"mx3.example.com: Failed to reach domain",
+				"mx4.example.com: " + tls12,
+				"mx5.example.com: Failed to reach domain",
+			},
+			mx: mx,
+			expected: []string{
+				multiple,
+				"mx1.example.com: " + tls13,
+				"3 of 5 MX hosts: Failed to reach domain",
+				"mx4.example.com: " + tls12,
+			},
+		},
+		{
+			name: "SeveralSharedMessages",
+			advice: []string{
+				"mx1.example.com: No valid certificate could be found.",
+				"mx1.example.com: " + tls12,
+				"mx2.example.com: No valid certificate could be found.",
+				"mx2.example.com: " + tls12,
+				"mx3.example.com: " + tls13,
+			},
+			mx:       mx[:3],
+			expected: []string{"2 of 3 MX hosts: No valid certificate could be found.", "2 of 3 MX hosts: " + tls12, "mx3.example.com: " + tls13},
+		},
+		{
+			// similar messages are distinct findings
+			name:     "DistinctMessages",
+			advice:   []string{"mx1.example.com: Failed to reach domain", "mx2.example.com: Failed to reach domain before timeout"},
+			mx:       mx[:2],
+			expected: []string{"mx1.example.com: Failed to reach domain", "mx2.example.com: Failed to reach domain before timeout"},
+		},
+		{
+			// a host repeating a message is still only one host
+			name:     "RepeatedHost",
+			advice:   []string{"mx1.example.com: Failed to reach domain", "mx1.example.com: Failed to reach domain", "mx2.example.com: " + tls13},
+			mx:       mx[:2],
+			expected: []string{"mx1.example.com: Failed to reach domain", "mx1.example.com: Failed to reach domain", "mx2.example.com: " + tls13},
+		},
+		{
+			// lines that aren't prefixed with one of the MX hosts aren't per-host advice
+			name:     "NotMXHosts",
+			advice:   []string{"mx1.example.net: Failed to reach domain", "mx2.example.net: Failed to reach domain"},
+			mx:       mx[:2],
+			expected: []string{"mx1.example.net: Failed to reach domain", "mx2.example.net: Failed to reach domain"},
+		},
+		{
+			name:     "EveryHost",
+			advice:   []string{"mx1.example.com: Failed to reach domain", "mx2.example.com: Failed to reach domain"},
+			mx:       mx[:2],
+			expected: []string{"2 of 2 MX hosts: Failed to reach domain"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if found := collapseHostAdvice(test.advice, test.mx); !reflect.DeepEqual(found, test.expected) {
+				t.Errorf("found %v, want %v", found, test.expected)
+			}
+		})
+	}
+}
+
+func TestSortBySeverity(t *testing.T) {
+	advice := []string{
+		"DKIM is setup for this email server.",
+		"Consider rotating your DKIM key",
+		"Your DKIM record appears to be malformed",
+		"Consider specifying a subdomain policy",
+	}
+	expected := []string{
+		"Your DKIM record appears to be malformed",
+		"Consider rotating your DKIM key",
+		"Consider specifying a subdomain policy",
+		"DKIM is setup for this email server.",
+	}
+
+	if found := sortBySeverity(advice); !reflect.DeepEqual(found, expected) {
+		t.Errorf("found %v, want %v", found, expected)
+	}
+}
+
+func TestAdvisor_CheckAllTidy(t *testing.T) {
+	mx := []string{"mx1.example.com.", "mx2.example.com.", "mx3.example.com."}
+
+	for _, detailed := range []bool{false, true} {
+		advisor := NewAdvisor(time.Second, time.Minute, true, WithDetailed(detailed))
+
+		// seed the caches so no connections are made to the hosts
+		domainAdvice := []string{checkTLSVersion(tls.VersionTLS13)}
+		advisor.tlsCacheHost.Set("example.com", &domainAdvice)
+
+		for _, host := range []string{"mx1.example.com", "mx2.example.com", "mx3.example.com"} {
+			hostAdvice := []string{"Failed to reach domain"}
+			advisor.tlsCacheMail.Set(host, &hostAdvice)
+		}
+
+		advice := advisor.CheckAll("example.com", "", "", "v=DMARC1; p=none;", mx, "v=spf1 -all")
+
+		expected := []string{
+			"3 of 3 MX hosts: Failed to reach domain",
+			"You have multiple mail servers setup, which is recommended.",
+		}
+		if detailed {
+			expected = []string{
+				"mx1.example.com: Failed to reach domain",
+				"mx2.example.com: Failed to reach domain",
+				"mx3.example.com: Failed to reach domain",
+				"You have multiple mail servers setup, which is recommended.",
+			}
+		}
+
+		if !reflect.DeepEqual(advice.MX, expected) {
+			t.Errorf("found %v, want %v (detailed %v)", advice.MX, expected, detailed)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package advisor
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+const (
+	// startTLSFailureAdvice is the advice for a mail server whose STARTTLS
+	// handshake failed for a reason other than its certificate.
+	startTLSFailureAdvice = "Failed to start TLS connection, as the TLS handshake with the server failed."
+
+	// minimumRSAKeySize is the smallest RSA key accepted in a certificate
+	// chain, as strict receivers and browsers reject anything shorter.
+	minimumRSAKeySize = 2048
+
+	// minimumTLSVersion is the oldest TLS version negotiated by the TLS
+	// probes and the HTTP client, so every check validates servers alike.
+	minimumTLSVersion = tls.VersionTLS12
+)
+
+// Dialer opens outbound connections for the TLS checks. It's satisfied by
+// *net.Dialer, and allows callers to route or fake connections.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// checkHostTLS returns the advice on the host's TLS, or an error if the
+// scanner couldn't complete the check (see isInfrastructureError), which
+// isn't cached.
+func (a *Advisor) checkHostTLS(ctx context.Context, hostname string, port int) (advice []string, err error) {
+	hostname, ok := normalizeHostname(hostname)
+	if !ok {
+		return []string{"No hostname was provided to check."}, nil
+	}
+
+	if port == 0 {
+		port = 443
+	}
+
+	// an overridden connection's advice is cached separately from the live host's
+	key := hostname
+	address, overridden := a.resolveOverride(ctx, hostname, cast.ToString(port))
+	if overridden {
+		key += "@" + address
+	}
+
+	// check if the advice is already in the cache
+	tlsAdvice := a.tlsCacheHost.Get(key)
+	if tlsAdvice != nil {
+		a.tlsCacheHost.Tag(key, cacheTags(ctx)...)
+		return *tlsAdvice, nil
+	}
+
+	// set the advice in the cache after the function returns, unless the check was abandoned or failed
+	defer func() {
+		if ctx.Err() == nil && err == nil {
+			a.tlsCacheHost.SetTagged(key, &advice, cacheTags(ctx, hostname)...)
+		}
+	}()
+
+	return a.probes.do(ctx, "host:"+key, func() ([]string, error) {
+		advice, err := a.probeHostTLS(ctx, hostname, port)
+		if overridden && err == nil {
+			advice = overriddenAdvice(advice, address)
+		}
+
+		return advice, err
+	})
+}
+
+// probeHostTLS connects to the host's TLS port, returning advice on its TLS
+// version and certificate.
+func (a *Advisor) probeHostTLS(ctx context.Context, hostname string, port int) (advice []string, err error) {
+	conn, err := a.dialTLS(ctx, hostname, cast.ToString(port), a.tlsConfig(hostname))
+	if err != nil {
+		if isInfrastructureError(ctx, err) {
+			return nil, err
+		}
+
+		if strings.Contains(err.Error(), "no such host") {
+			return []string{hostname + " could not be reached"}, nil
+		}
+
+		if strings.Contains(err.Error(), "certificate is not trusted") || strings.Contains(err.Error(), "failed to verify certificate") {
+			advice = append(advice, "No valid certificate could be found.")
+
+			insecure := a.tlsConfig(hostname)
+			insecure.InsecureSkipVerify = true
+
+			conn, err = a.dialTLS(ctx, hostname, cast.ToString(port), insecure)
+			if err != nil {
+				if isInfrastructureError(ctx, err) {
+					return nil, err
+				}
+
+				return advice, nil
+			}
+		} else {
+			return []string{hostFailureAdvice(err, port)}, nil
+		}
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	advice = append(advice, checkTLSVersion(state.Version))
+	advice = append(advice, a.checkCertificateChain(state.PeerCertificates, time.Now())...)
+
+	return advice, nil
+}
+
+// hostFailureAdvice returns the advice for a host whose TLS port couldn't be
+// reached, or whose TLS handshake failed, without the error's own text.
+func hostFailureAdvice(err error, port int) string {
+	category, _ := classifyMailFailure(err)
+
+	switch category {
+	case mailFailureRefused:
+		return fmt.Sprintf("Failed to reach domain on port %d, as it refused the connection.", port)
+	case mailFailureTimeout:
+		return fmt.Sprintf("Failed to reach domain on port %d, as it didn't connect or complete a TLS handshake before timeout.", port)
+	case mailFailureReset:
+		return fmt.Sprintf("Failed to reach domain on port %d, as the server closed the connection during the TLS handshake.", port)
+	case mailFailureDNS:
+		return fmt.Sprintf("Failed to reach domain on port %d, as its hostname couldn't be resolved to an address.", port)
+	}
+
+	return fmt.Sprintf("Failed to reach domain on port %d, as the TLS handshake with it failed.", port)
+}
+
+// checkMailTls returns the advice on the mail server's STARTTLS, or an error
+// if the scanner couldn't complete the check (see isInfrastructureError),
+// which isn't cached.
+func (a *Advisor) checkMailTls(ctx context.Context, hostname string) (advice []string, err error) {
+	hostname, ok := normalizeHostname(hostname)
+	if !ok {
+		return []string{"No hostname was provided to check."}, nil
+	}
+
+	// an overridden connection's advice is cached separately from the live host's
+	key := hostname
+	address, overridden := a.resolveOverride(ctx, hostname, "25")
+	if overridden {
+		key += "@" + address
+	}
+
+	// check if the advice is already in the cache
+	tlsAdvice := a.tlsCacheMail.Get(key)
+	if tlsAdvice != nil {
+		a.tlsCacheMail.Tag(key, cacheTags(ctx)...)
+		return *tlsAdvice, nil
+	}
+
+	// skip hosts that recently deferred a probe, rather than adding to their connections
+	if remaining, ok := a.smtp.deferred(hostname); ok {
+		return []string{deferredAdvice("", remaining)}, nil
+	}
+
+	// set the advice in the cache after the function returns, unless the check was abandoned, failed, deferred or
+	// turned away for now
+	defer func() {
+		if ctx.Err() == nil && err == nil && !isDeferred(advice) && !isSoftFailure(advice) {
+			a.tlsCacheMail.SetTagged(key, &advice, cacheTags(ctx, hostname)...)
+		}
+	}()
+
+	return a.probes.do(ctx, "mail:"+key, func() ([]string, error) {
+		advice, err := a.probeMailTLS(ctx, hostname)
+		if overridden && err == nil {
+			advice = overriddenAdvice(advice, address)
+		}
+
+		return advice, err
+	})
+}
+
+// probeMailTLS connects to the host's SMTP port and starts TLS, returning
+// advice on its TLS version and certificate, and on the hostname it introduced
+// itself with. If the host defers the connection, it's skipped for a cooldown
+// instead.
+func (a *Advisor) probeMailTLS(ctx context.Context, hostname string) (advice []string, err error) {
+	// the hostname is checked once the connection's slot is released, as its lookups don't need one
+	var transcript *transcriptConn
+	defer func() {
+		if err == nil && transcript != nil && !isDeferred(advice) {
+			advice = append(advice, a.checkPresentedHostname(ctx, hostname, transcript)...)
+		}
+	}()
+
+	release, err := a.smtp.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// the host may have deferred another probe while this one waited for a connection
+	if remaining, ok := a.smtp.deferred(hostname); ok {
+		return []string{deferredAdvice("", remaining)}, nil
+	}
+
+	conn, err := a.dialMail(ctx, hostname)
+	if err != nil {
+		if isInfrastructureError(ctx, err) {
+			return nil, err
+		}
+
+		return []string{mailFailureAdvice(err)}, nil
+	}
+	defer conn.Close()
+
+	transcript = newTranscriptConn(conn)
+
+	client, err := smtp.NewClient(transcript, hostname)
+	if err != nil {
+		if reply, ok := parseDeferral(err); ok {
+			return []string{deferredAdvice(reply, a.smtp.deferHost(hostname))}, nil
+		}
+
+		if isInfrastructureError(ctx, err) {
+			return nil, err
+		}
+
+		return []string{mailFailureAdvice(err)}, nil
+	}
+
+	tlsConfig := a.tlsConfig(hostname)
+
+	if err = client.StartTLS(tlsConfig); err != nil {
+		if reply, ok := parseDeferral(err); ok {
+			return []string{deferredAdvice(reply, a.smtp.deferHost(hostname))}, nil
+		}
+
+		if isInfrastructureError(ctx, err) {
+			return nil, err
+		}
+
+		if strings.Contains(err.Error(), "certificate is not trusted") || strings.Contains(err.Error(), "failed to verify certificate") {
+			advice = append(advice, "No valid certificate could be found.")
+
+			// close the existing connection and create a new one as we can't reuse it in the same way as the checkHostTLS function
+			if err = conn.Close(); err != nil {
+				advice = append(advice, "Failed to re-attempt connection without certificate verification")
+				return advice, nil
+			}
+
+			conn, err = a.dialMail(ctx, hostname)
+			if err != nil {
+				if isInfrastructureError(ctx, err) {
+					return nil, err
+				}
+
+				return []string{mailFailureAdvice(err)}, nil
+			}
+			defer conn.Close()
+
+			client, err = smtp.NewClient(conn, hostname)
+			if err != nil {
+				if isInfrastructureError(ctx, err) {
+					return nil, err
+				}
+
+				return []string{mailFailureAdvice(err)}, nil
+			}
+
+			// retry with InsecureSkipVerify
+			tlsConfig.InsecureSkipVerify = true
+			if err = client.StartTLS(tlsConfig); err != nil {
+				if isInfrastructureError(ctx, err) {
+					return nil, err
+				}
+
+				advice = append(advice, "Failed to start TLS connection")
+				return advice, nil
+			}
+		} else {
+			return []string{startTLSFailureAdvice}, nil
+		}
+	}
+
+	if state, ok := client.TLSConnectionState(); ok {
+		advice = append(advice, checkTLSVersion(state.Version))
+		advice = append(advice, a.checkCertificateChain(state.PeerCertificates, time.Now())...)
+	}
+
+	a.smtp.succeeded(hostname)
+
+	return advice, nil
+}
+
+// dialMail opens a connection to the SMTP port of the given host. The
+// connection is bounded by the advisor's timeout, and is closed early if the
+// context is done, so a server that never sends its greeting can't stall the
+// check.
+func (a *Advisor) dialMail(ctx context.Context, hostname string) (net.Conn, error) {
+	// the wait for the host's next connection isn't bounded by the timeout
+	if err := a.smtp.wait(ctx, hostname); err != nil {
+		return nil, err
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	conn, err := a.dialProbe(dialCtx, hostname, "25")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.SetDeadline(time.Now().Add(a.timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+
+	return conn, nil
+}
+
+// tlsConfig returns the TLS configuration of a connection to the host,
+// verifying its certificate against the advisor's root CAs.
+func (a *Advisor) tlsConfig(serverName string) *tls.Config {
+	return &tls.Config{MinVersion: minimumTLSVersion, RootCAs: a.rootCAs, ServerName: serverName}
+}
+
+// dialTLS opens a TLS connection to the given port of the host, with the
+// handshake bounded by the advisor's timeout.
+func (a *Advisor) dialTLS(ctx context.Context, hostname, port string, config *tls.Config) (*tls.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	conn, err := a.dialProbe(ctx, hostname, port)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// checkCertificateChain returns the advice on the certificate chain a server
+// presented, leaf first: any certificate with an RSA key shorter than
+// minimumRSAKeySize or a SHA-1 signature, and any expired intermediate, as
+// strict receivers reject the chain even if the leaf itself is valid. A
+// self-signed root's signature isn't checked, as it's trusted by its key
+// rather than its signature. If the advisor is detailed, the leaf's key and
+// signature algorithm are described too.
+func (a *Advisor) checkCertificateChain(chain []*x509.Certificate, now time.Time) []string {
+	if len(chain) == 0 {
+		return nil
+	}
+
+	var advice []string
+
+	if a.detailed {
+		advice = append(advice, fmt.Sprintf("Your certificate has %s, and is signed with %s.", describePublicKey(chain[0]), chain[0].SignatureAlgorithm))
+	}
+
+	for index, certificate := range chain {
+		subject := "Your certificate"
+		if index > 0 {
+			subject = fmt.Sprintf("The intermediate certificate %q in your certificate chain", certificateName(certificate))
+		}
+
+		if key, ok := certificate.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < minimumRSAKeySize {
+			advice = append(advice, fmt.Sprintf("%s has a %d-bit RSA key, which is too weak, as strict receivers reject keys shorter than %d bits. Reissue it with a key of at least %d bits.", subject, key.N.BitLen(), minimumRSAKeySize, minimumRSAKeySize))
+		}
+
+		selfSigned := bytes.Equal(certificate.RawSubject, certificate.RawIssuer)
+
+		switch certificate.SignatureAlgorithm {
+		case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			if !selfSigned || index == 0 {
+				advice = append(advice, fmt.Sprintf("%s is signed with SHA-1 (%s), which receivers no longer trust. Reissue it with a SHA-256 signature.", subject, certificate.SignatureAlgorithm))
+			}
+		}
+
+		if index > 0 && !selfSigned && now.After(certificate.NotAfter) {
+			advice = append(advice, fmt.Sprintf("%s expired on %s, so strict receivers can't verify your certificate. Serve your CA's current intermediate certificate instead.", subject, certificate.NotAfter.Format(time.DateOnly)))
+		}
+	}
+
+	return advice
+}
+
+// describePublicKey describes the certificate's public key, such as "a
+// 2048-bit RSA key".
+func describePublicKey(certificate *x509.Certificate) string {
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("a %d-bit RSA key", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("a %d-bit ECDSA key (%s)", key.Curve.Params().BitSize, key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "an Ed25519 key"
+	}
+
+	return "a " + certificate.PublicKeyAlgorithm.String() + " key"
+}
+
+// certificateName returns the certificate's common name, or its whole subject
+// if it has none.
+func certificateName(certificate *x509.Certificate) string {
+	if certificate.Subject.CommonName != "" {
+		return certificate.Subject.CommonName
+	}
+
+	return certificate.Subject.String()
+}
+
+func checkTLSVersion(tlsVersion uint16) string {
+	switch tlsVersion {
+	case tls.VersionTLS10:
+		return "Your domain is using TLS version 1.0 which is outdated, and should be upgraded to TLS 1.3."
+	case tls.VersionTLS11:
+		return "Your domain is using TLS version 1.1 which is outdated, and should be upgraded to TLS 1.3."
+	case tls.VersionTLS12:
+		return "Your domain is using TLS version 1.2, and should be upgraded to TLS 1.3."
+	case tls.VersionTLS13:
+		return "Your domain is using TLS 1.3, no further action needed!"
+	}
+
+	return "Your domain is using an unrecognized version of TLS, you should verify that it's using TLS 1.3 or above."
+}
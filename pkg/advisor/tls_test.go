@@ -0,0 +1,172 @@
+package advisor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+)
+
+func TestAdvisor_CheckCertificateChain(t *testing.T) {
+	now := time.Now()
+
+	// the root's SHA-1 signature is never reported, as it's trusted by its key
+	root := testnet.NewCA(t, testnet.CertificateOptions{Name: "Root CA", RSABits: 2048, SignatureAlgorithm: x509.SHA1WithRSA})
+	intermediate := root.Intermediate(testnet.CertificateOptions{Name: "Intermediate CA", RSABits: 2048})
+	expiredIntermediate := root.Intermediate(testnet.CertificateOptions{Name: "Expired CA", RSABits: 2048, NotAfter: now.Add(-time.Minute)})
+	weakIntermediate := root.Intermediate(testnet.CertificateOptions{Name: "Weak CA", RSABits: 1024, SignatureAlgorithm: x509.SHA1WithRSA})
+
+	leaf := intermediate.Issue(testnet.CertificateOptions{Name: "mail.example.com"}).Leaf
+	weakLeaf := intermediate.Issue(testnet.CertificateOptions{Name: "mail.example.com", RSABits: 1024}).Leaf
+	sha1Leaf := intermediate.Issue(testnet.CertificateOptions{Name: "mail.example.com", SignatureAlgorithm: x509.SHA1WithRSA}).Leaf
+	selfSignedLeaf := testnet.SelfSigned(t, testnet.CertificateOptions{Name: "mail.example.com", RSABits: 1024, SignatureAlgorithm: x509.SHA1WithRSA}).Leaf
+
+	const (
+		weakLeafAdvice = "Your certificate has a 1024-bit RSA key, which is too weak, as strict receivers reject keys shorter than 2048 bits. Reissue it with a key of at least 2048 bits."
+		sha1LeafAdvice = "Your certificate is signed with SHA-1 (SHA1-RSA), which receivers no longer trust. Reissue it with a SHA-256 signature."
+	)
+
+	tests := []struct {
+		name     string
+		chain    []*x509.Certificate
+		expected []string
+	}{
+		{
+			name:  "Strong",
+			chain: []*x509.Certificate{leaf, intermediate.Certificate(), root.Certificate()},
+		},
+		{
+			name:     "WeakKey",
+			chain:    []*x509.Certificate{weakLeaf, intermediate.Certificate(), root.Certificate()},
+			expected: []string{weakLeafAdvice},
+		},
+		{
+			name:     "SHA1Signature",
+			chain:    []*x509.Certificate{sha1Leaf, intermediate.Certificate(), root.Certificate()},
+			expected: []string{sha1LeafAdvice},
+		},
+		{
+			name:     "ExpiredIntermediate",
+			chain:    []*x509.Certificate{leaf, expiredIntermediate.Certificate(), root.Certificate()},
+			expected: []string{`The intermediate certificate "Expired CA" in your certificate chain expired on ` + expiredIntermediate.Certificate().NotAfter.Format(time.DateOnly) + ", so strict receivers can't verify your certificate. Serve your CA's current intermediate certificate instead."},
+		},
+		{
+			name:  "WeakIntermediate",
+			chain: []*x509.Certificate{leaf, weakIntermediate.Certificate()},
+			expected: []string{
+				`The intermediate certificate "Weak CA" in your certificate chain has a 1024-bit RSA key, which is too weak, as strict receivers reject keys shorter than 2048 bits. Reissue it with a key of at least 2048 bits.`,
+				`The intermediate certificate "Weak CA" in your certificate chain is signed with SHA-1 (SHA1-RSA), which receivers no longer trust. Reissue it with a SHA-256 signature.`,
+			},
+		},
+		{
+			name:     "SelfSigned",
+			chain:    []*x509.Certificate{selfSignedLeaf},
+			expected: []string{weakLeafAdvice, sha1LeafAdvice},
+		},
+		{
+			name: "NoChain",
+		},
+	}
+
+	advisor := NewAdvisor(time.Second, time.Second, true)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.checkCertificateChain(test.chain, now)
+			if !reflect.DeepEqual(advice, test.expected) {
+				t.Errorf("found %v, want %v", advice, test.expected)
+			}
+
+			for _, line := range advice {
+				if severity := Classify(line); severity != SeverityMedium {
+					t.Errorf("found %v for %q, want %v", severity, line, SeverityMedium)
+				}
+			}
+		})
+	}
+
+	t.Run("Detailed", func(t *testing.T) {
+		advisor := NewAdvisor(time.Second, time.Second, true, WithDetailed(true))
+
+		expected := []string{"Your certificate has a 256-bit ECDSA key (P-256), and is signed with SHA256-RSA."}
+		if advice := advisor.checkCertificateChain([]*x509.Certificate{leaf}, now); !reflect.DeepEqual(advice, expected) {
+			t.Errorf("found %v, want %v", advice, expected)
+		}
+
+		expected = []string{"Your certificate has a 1024-bit RSA key, and is signed with SHA256-RSA.", weakLeafAdvice}
+		if advice := advisor.checkCertificateChain([]*x509.Certificate{weakLeaf}, now); !reflect.DeepEqual(advice, expected) {
+			t.Errorf("found %v, want %v", advice, expected)
+		}
+
+		if severity := Classify(expected[0]); severity != SeverityInfo {
+			t.Errorf("found %v, want %v", severity, SeverityInfo)
+		}
+	})
+}
+
+func TestAdvisor_TLSWeakCertificate(t *testing.T) {
+	// the self-signed certificate isn't trusted, so its chain is checked once the probe retries without verification
+	weak := testnet.SelfSigned(t, testnet.CertificateOptions{Name: "mail.example.com", RSABits: 1024})
+
+	network := testnet.New(t)
+	network.HTTPS("mail.example.com", &testnet.HTTPSServer{Certificate: &weak})
+	network.SMTP("mail.example.com", &testnet.SMTPServer{Certificate: &weak})
+	network.Resolver.Host("mail.example.com", "127.0.0.1")
+
+	expected := []string{
+		"No valid certificate could be found.",
+		"Your domain is using TLS 1.3, no further action needed!",
+		"Your certificate has a 1024-bit RSA key, which is too weak, as strict receivers reject keys shorter than 2048 bits. Reissue it with a key of at least 2048 bits.",
+	}
+
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(network), WithHostResolver(network.Resolver), WithRootCAs(network.CA.Pool()))
+	t.Cleanup(advisor.Close)
+
+	t.Run("Host", func(t *testing.T) {
+		advice, err := advisor.checkHostTLS(context.Background(), "mail.example.com", 443)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(advice, expected) {
+			t.Errorf("found %v, want %v", advice, expected)
+		}
+	})
+
+	t.Run("Mail", func(t *testing.T) {
+		advice, err := advisor.checkMailTls(context.Background(), "mail.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(advice, expected) {
+			t.Errorf("found %v, want %v", advice, expected)
+		}
+	})
+}
+
+func TestAdvisor_HTTPClientTLS(t *testing.T) {
+	network := testnet.New(t)
+	network.HTTPS("bimi.example.com", &testnet.HTTPSServer{Handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})})
+	network.HTTPS("legacy.example.com", &testnet.HTTPSServer{MaxVersion: tls.VersionTLS11})
+
+	// the HTTP client validates servers as the TLS probes do, trusting the same CAs
+	advisor := NewAdvisor(time.Second, time.Minute, true, WithDialer(network), WithProxy(ProxyConfig{}), WithRootCAs(network.CA.Pool()))
+	t.Cleanup(advisor.Close)
+
+	response, err := advisor.httpClient.Get("https://bimi.example.com/logo.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if _, err = advisor.httpClient.Get("https://legacy.example.com/logo.svg"); err == nil || !strings.Contains(err.Error(), "protocol version") {
+		t.Errorf("found %v, want the TLS 1.1 server refused", err)
+	}
+}
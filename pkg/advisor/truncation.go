@@ -0,0 +1,13 @@
+package advisor
+
+import (
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+// CheckTCPFallback returns a note for a record whose DNS answer was too large
+// for UDP, so was only found by retrying over TCP. It's informational, as most
+// resolvers retry over TCP, though some receivers' resolvers (or firewalls
+// blocking DNS over TCP) won't, and so won't find the record.
+func (a *Advisor) CheckTCPFallback(kind lookalike.Kind) []string {
+	return []string{"The DNS answer containing your " + kind.Name + " record is too large for UDP, so it can only be resolved over TCP. Some receivers' resolvers won't retry over TCP and may not find it, so consider shortening it, or removing unused TXT records published at the same name."}
+}
@@ -0,0 +1,138 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// txtFlagDayBuffer is the EDNS0 buffer size most resolvers advertise since
+	// DNS Flag Day 2020. Larger answers are truncated over UDP, and retried
+	// over TCP by the resolvers that can.
+	txtFlagDayBuffer = 1232
+
+	// txtMaxBuffer is the largest EDNS0 buffer size resolvers commonly
+	// advertise, so larger answers can only be resolved over TCP.
+	txtMaxBuffer = 4096
+)
+
+// verificationPrefixes are the prefixes of common providers' domain
+// verification records, which are published as TXT records at the apex
+// alongside the SPF record.
+var verificationPrefixes = []string{
+	"google-site-verification=",
+	"MS=",
+	"facebook-domain-verification=",
+	"apple-domain-verification=",
+	"atlassian-domain-verification=",
+	"adobe-idp-site-verification=",
+	"docusign=",
+	"globalsign-domain-verification=",
+	"stripe-verification=",
+	"zoom-domain-verification=",
+	"amazonses:",
+	"mailru-verification:",
+	"yandex-verification:",
+}
+
+// CheckTXT returns advice on the domain's own TXT records as a whole, given
+// with the size of the DNS answer containing them. SPF and most providers'
+// domain verification records share the apex, and records accumulate there,
+// so it's checked for:
+//   - more than one SPF record, which receivers reject (RFC 7208, section 4.5);
+//   - an SPF record or verification token embedded inside another record,
+//     usually from pasting into the wrong record, or from a DNS host that
+//     concatenates them, so neither is found;
+//   - an answer approaching or exceeding the buffer sizes resolvers advertise.
+//
+// A domain without TXT records isn't advised.
+func (a *Advisor) CheckTXT(records []string, size int) []string {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var (
+		advice []string
+		spf    int
+	)
+
+	for _, record := range records {
+		if strings.HasPrefix(strings.ToLower(record), "v=spf1") {
+			spf++
+		}
+	}
+
+	if spf > 1 {
+		advice = append(advice, fmt.Sprintf("Your domain publishes %d SPF records, so receivers return a permerror and SPF fails for all of your mail (RFC 7208, section 4.5). Merge them into a single record starting with v=spf1.", spf))
+	}
+
+	for _, record := range records {
+		if record == "" {
+			continue
+		}
+
+		if strings.Contains(strings.ToLower(record[1:]), "v=spf1") {
+			consequence := "so receivers don't find it, and SPF fails unless another record holds your policy"
+			if spf > 0 {
+				consequence = "which receivers ignore, so if it's the policy you meant to publish, it isn't the one that applies"
+			}
+
+			advice = append(advice, fmt.Sprintf("Your TXT record %s contains an SPF record that doesn't start it, %s. This usually comes from pasting into the wrong record, or from a DNS host concatenating records, so publish the SPF record as its own TXT record starting with v=spf1.", quoteTXT(record), consequence))
+		}
+
+		if prefix := embeddedVerification(record); prefix != "" {
+			advice = append(advice, fmt.Sprintf("Your TXT record %s contains a %s verification token that doesn't start it, so the provider won't find it and verification of your domain will fail. Publish the token as its own TXT record.", quoteTXT(record), strings.TrimRight(prefix, "=:")))
+		}
+	}
+
+	switch {
+	case size > txtMaxBuffer:
+		advice = append(advice, fmt.Sprintf("The DNS answer containing your TXT records is %d bytes, more than the %d byte buffer resolvers commonly advertise, so it can only be resolved over TCP, and receivers whose resolvers (or firewalls) don't allow DNS over TCP won't find your SPF record or verification tokens. Remove the TXT records you no longer use.", size, txtMaxBuffer))
+	case size > txtFlagDayBuffer:
+		advice = append(advice, fmt.Sprintf("The DNS answer containing your TXT records is %d bytes, more than the %d byte buffer most resolvers advertise, so it's truncated over UDP and has to be retried over TCP, which some receivers' resolvers won't do. Remove the TXT records you no longer use.", size, txtFlagDayBuffer))
+	case size > txtFlagDayBuffer*9/10:
+		advice = append(advice, fmt.Sprintf("The DNS answer containing your TXT records is %d bytes, approaching the %d byte buffer most resolvers advertise, beyond which it has to be retried over TCP. Remove the TXT records you no longer use before adding more.", size, txtFlagDayBuffer))
+	}
+
+	summary := fmt.Sprintf("Your domain publishes %d TXT records, totalling %d bytes in a DNS answer of %d bytes.", len(records), txtLength(records), size)
+	if len(records) == 1 {
+		summary = fmt.Sprintf("Your domain publishes 1 TXT record of %d bytes, in a DNS answer of %d bytes.", txtLength(records), size)
+	}
+
+	if len(advice) == 0 {
+		summary += " No further action needed."
+	}
+
+	return append([]string{summary}, advice...)
+}
+
+// embeddedVerification returns the prefix of the provider verification token
+// found inside the record after its start, or "" if there's none.
+func embeddedVerification(record string) string {
+	for _, prefix := range verificationPrefixes {
+		if strings.Contains(record[1:], prefix) {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+// txtLength returns the combined length of the records.
+func txtLength(records []string) int {
+	var length int
+	for _, record := range records {
+		length += len(record)
+	}
+
+	return length
+}
+
+// quoteTXT quotes a record for advice, shortening it if it's long.
+func quoteTXT(record string) string {
+	if len(record) > 60 {
+		record = record[:57] + "..."
+	}
+
+	return fmt.Sprintf("%q", record)
+}
@@ -0,0 +1,61 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTXT(t *testing.T) {
+	advisor := NewAdvisor(time.Second, 0, false)
+
+	verification := "google-site-verification=rXOxyZounnZasA8Z7oaD3c14JdjS9aKSWvsR1EbUSIQ"
+	spf := "v=spf1 include:_spf.google.com ~all"
+
+	tests := []struct {
+		name     string
+		records  []string
+		size     int
+		expected []string
+		severity Severity
+	}{
+		{"NoRecords", nil, 0, nil, SeverityInfo},
+		{"Clean", []string{verification, spf}, 180, []string{"publishes 2 TXT records, totalling 103 bytes in a DNS answer of 180 bytes. No further action needed."}, SeverityInfo},
+		{"OneRecord", []string{spf}, 90, []string{"publishes 1 TXT record of 35 bytes, in a DNS answer of 90 bytes. No further action needed."}, SeverityInfo},
+		{"MultipleSPF", []string{spf, "V=SPF1 include:mailgun.org ~all"}, 120, []string{"publishes 2 TXT records", "publishes 2 SPF records"}, SeverityHigh},
+		{"EmbeddedSPF", []string{verification + " " + spf}, 140, []string{"publishes 1 TXT record", "contains an SPF record that doesn't start it, so receivers don't find it"}, SeverityHigh},
+		{"EmbeddedSPFAlongsideSPF", []string{spf, "MS=ms12345678 v=spf1 include:mailgun.org ~all"}, 140, []string{"publishes 2 TXT records", "contains an SPF record that doesn't start it, which receivers ignore"}, SeverityMedium},
+		{"QuotedSPF", []string{`"` + spf + `"`}, 90, []string{"publishes 1 TXT record", "contains an SPF record that doesn't start it"}, SeverityHigh},
+		{"ConcatenatedSPF", []string{spf + "v=spf1 include:sendgrid.net ~all"}, 110, []string{"publishes 1 TXT record", "contains an SPF record that doesn't start it, which receivers ignore"}, SeverityMedium},
+		{"EmbeddedVerification", []string{spf + " " + verification}, 140, []string{"publishes 1 TXT record", "contains a google-site-verification verification token"}, SeverityMedium},
+		{"ConcatenatedVerification", []string{verification + "facebook-domain-verification=abcdefghijklmnopqrstuvwxyz0123"}, 140, []string{"publishes 1 TXT record", "contains a facebook-domain-verification verification token"}, SeverityMedium},
+		{"ApproachingBuffer", []string{spf}, 1200, []string{"publishes 1 TXT record", "approaching the 1232 byte buffer"}, SeverityLow},
+		{"Truncated", []string{spf}, 1500, []string{"publishes 1 TXT record", "is 1500 bytes, more than the 1232 byte buffer most resolvers advertise"}, SeverityMedium},
+		{"TCPOnly", []string{spf}, 5000, []string{"publishes 1 TXT record", "is 5000 bytes, more than the 4096 byte buffer"}, SeverityHigh},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckTXT(test.records, test.size)
+			if len(advice) != len(test.expected) {
+				t.Fatalf("found %v, want %d lines", advice, len(test.expected))
+			}
+
+			for index, expected := range test.expected {
+				if !strings.Contains(advice[index], expected) {
+					t.Errorf("found %q, want it to contain %q", advice[index], expected)
+				}
+			}
+
+			if len(advice) > 0 {
+				if severity := Classify(advice[0]); severity != SeverityInfo {
+					t.Errorf("found %v for the summary, want %v", severity, SeverityInfo)
+				}
+
+				if severity := Classify(advice[len(advice)-1]); severity != test.severity {
+					t.Errorf("found %v, want %v", severity, test.severity)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package advisor
+
+import (
+	"fmt"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+// typoAdvice returns advice quoting each typo in a record that looks like the
+// given kind, followed by the corrected record. It returns nil if the record
+// has no typos, so the usual checks can run.
+func typoAdvice(kind lookalike.Kind, record string) []string {
+	detected := lookalike.Detect(kind, record)
+	if detected == nil || len(detected.Fixes) == 0 {
+		return nil
+	}
+
+	var advice []string
+
+	for _, fix := range detected.Fixes {
+		if fix.Correction == "" {
+			advice = append(advice, fmt.Sprintf("Your %s record contains a typo: %q should be removed.", kind.Name, fix.Fragment))
+		} else {
+			advice = append(advice, fmt.Sprintf("Your %s record contains a typo: %q should be %q.", kind.Name, fix.Fragment, fix.Correction))
+		}
+	}
+
+	return append(advice, "Receivers will likely ignore your "+kind.Name+" record until it's corrected to: "+detected.Corrected)
+}
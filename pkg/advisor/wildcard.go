@@ -0,0 +1,20 @@
+package advisor
+
+import (
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+// CheckWildcard returns advice for a DMARC or DKIM lookup that was only
+// answered by a wildcard TXT record, which receivers are served in place of
+// the missing record. It replaces the advice of the check for that record, as
+// the wildcard's answer is no attempt at one (so isn't malformed).
+func (a *Advisor) CheckWildcard(kind lookalike.Kind, domain string) []string {
+	switch kind.Name {
+	case lookalike.DMARC.Name:
+		return []string{"There's no real DMARC record for your domain, as the answer for _dmarc." + domain + " comes from a wildcard TXT record. Publish a DMARC record at _dmarc." + domain + ", so receivers are no longer served the wildcard's answer instead."}
+	case lookalike.DKIM.Name:
+		return []string{"There's no real DKIM record for your domain, as the answers for its selectors under _domainkey." + domain + " come from a wildcard TXT record. Publish a DKIM record for each selector you sign with, so receivers are no longer served the wildcard's answer instead."}
+	}
+
+	return nil
+}
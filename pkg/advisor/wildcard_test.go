@@ -0,0 +1,40 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+)
+
+func TestAdvisor_CheckWildcard(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false, WithDialer(panickingDialer{}))
+	defer advisor.Close()
+
+	testCases := []struct {
+		kind     lookalike.Kind
+		name     string
+		severity Severity
+	}{
+		{kind: lookalike.DMARC, name: "_dmarc.example.com", severity: SeverityCritical},
+		{kind: lookalike.DKIM, name: "_domainkey.example.com", severity: SeverityMedium},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.kind.Name, func(t *testing.T) {
+			advice := advisor.CheckWildcard(testCase.kind, "example.com")
+			if len(advice) != 1 || !strings.Contains(advice[0], testCase.name) || !strings.Contains(advice[0], "wildcard TXT record") {
+				t.Fatalf("found %v, want advice about the wildcard at %s", advice, testCase.name)
+			}
+
+			if severity := Classify(advice[0]); severity != testCase.severity {
+				t.Errorf("found %v, want %v", severity, testCase.severity)
+			}
+		})
+	}
+
+	if advice := advisor.CheckWildcard(lookalike.SPF, "example.com"); advice != nil {
+		t.Errorf("found %v, want no advice for SPF", advice)
+	}
+}
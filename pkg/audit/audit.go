@@ -0,0 +1,155 @@
+// Package audit records every outbound DNS query and network probe issued
+// during a scan, so an assessment can prove exactly what was sent.
+package audit
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// maxBackups is the number of rotated audit files kept alongside the current one.
+const maxBackups = 5
+
+type (
+	// Log writes audit entries to a file as newline-delimited JSON, rotating it
+	// once it exceeds its maximum size. Rotated files are suffixed with .1
+	// (the most recent) through .5, with older files removed.
+	Log struct {
+		file    *os.File
+		maxSize int64
+		mutex   sync.Mutex
+		path    string
+		size    int64
+		source  string
+	}
+
+	// Entry is a single audited DNS query or network probe.
+	Entry struct {
+		Timestamp time.Time `json:"timestamp"`
+
+		// Kind is either "dns" for DNS queries, or "dial" for TCP/TLS probes.
+		Kind     string `json:"kind"`
+		Duration string `json:"duration"`
+		Error    string `json:"error,omitempty"`
+
+		// Source is the local address the query or probe was sent from. DNS
+		// queries only record it when a source address was configured (see
+		// SetSourceAddress), as the operating system otherwise picks it.
+		Source string `json:"source,omitempty"`
+
+		// DNS query fields
+		Name     string   `json:"name,omitempty"`
+		Type     string   `json:"type,omitempty"`
+		Resolver string   `json:"resolver,omitempty"`
+		Rcode    string   `json:"rcode,omitempty"`
+		Answers  []string `json:"answers,omitempty"`
+
+		// network probe fields
+		Network string `json:"network,omitempty"`
+		Address string `json:"address,omitempty"`
+	}
+)
+
+// New opens (or creates) the audit file at path, appending to any existing
+// entries. If maxSize is greater than 0, the file is rotated before a write
+// would take it past maxSize bytes.
+func New(path string, maxSize int64) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to stat audit file: %w", err)
+	}
+
+	return &Log{
+		file:    file,
+		maxSize: maxSize,
+		path:    path,
+		size:    info.Size(),
+	}, nil
+}
+
+// Close closes the audit file.
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.file.Close()
+}
+
+// SetSourceAddress records the local address DNS queries are sent from (such
+// as with scanner.WithSourceAddress) on every DNS entry. Probes record the
+// address they were actually sent from, so don't need it.
+func (l *Log) SetSourceAddress(address string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.source = address
+}
+
+func (l *Log) sourceAddress() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.source
+}
+
+// Record writes an entry to the audit file.
+func (l *Log) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	line = append(line, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err = l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	written, err := l.file.Write(line)
+	l.size += int64(written)
+
+	return err
+}
+
+// rotate shifts each backup up by one, moves the current file to .1, and
+// opens a new file in its place. The mutex must be held.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit file: %w", err)
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", l.path, maxBackups))
+
+	for index := maxBackups - 1; index > 0; index-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", l.path, index), fmt.Sprintf("%s.%d", l.path, index+1))
+	}
+
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate audit file: %w", err)
+	}
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	l.file = file
+	l.size = 0
+
+	return nil
+}
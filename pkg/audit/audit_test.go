@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDialer struct {
+	err error
+}
+
+func (d *fakeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	client, server := net.Pipe()
+	_ = server.Close()
+
+	return client, nil
+}
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var entries []Entry
+
+	lineScanner := bufio.NewScanner(file)
+	for lineScanner.Scan() {
+		var entry Entry
+		require.NoError(t, json.Unmarshal(lineScanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+
+	require.NoError(t, lineScanner.Err())
+
+	return entries
+}
+
+func TestLog_Resolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+
+	auditLog, err := New(path, 0)
+	require.NoError(t, err)
+
+	resolver := auditLog.Resolver(testnet.NewResolver(t).Answer("example.com", dns.TypeTXT, testnet.Answer{
+		Records: []string{`example.com. 300 IN TXT "v=spf1 -all"`, "example.com. 300 IN MX 10 mx1.example.com."},
+		Delay:   time.Millisecond,
+	}))
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeTXT)
+
+	response, _, err := resolver.Exchange(msg, "127.0.0.1:53")
+	require.NoError(t, err)
+	require.Len(t, response.Answer, 2)
+	require.NoError(t, auditLog.Close())
+
+	entries := readEntries(t, path)
+	require.Len(t, entries, 1)
+	require.Equal(t, "dns", entries[0].Kind)
+	require.Equal(t, "example.com.", entries[0].Name)
+	require.Equal(t, "TXT", entries[0].Type)
+	require.Equal(t, "127.0.0.1:53", entries[0].Resolver)
+	require.Equal(t, "NOERROR", entries[0].Rcode)
+	require.Equal(t, []string{`"v=spf1 -all"`, "10 mx1.example.com."}, entries[0].Answers)
+	require.False(t, entries[0].Timestamp.IsZero())
+	require.Empty(t, entries[0].Source)
+
+	t.Run("SourceAddress", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.ndjson")
+
+		auditLog, err := New(path, 0)
+		require.NoError(t, err)
+
+		auditLog.SetSourceAddress("192.0.2.10")
+
+		_, _, err = auditLog.Resolver(testnet.NewResolver(t)).Exchange(msg, "127.0.0.1:53")
+		require.NoError(t, err)
+		require.NoError(t, auditLog.Close())
+
+		entries := readEntries(t, path)
+		require.Len(t, entries, 1)
+		require.Equal(t, "192.0.2.10", entries[0].Source)
+	})
+}
+
+func TestLog_Dialer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+
+	auditLog, err := New(path, 0)
+	require.NoError(t, err)
+
+	conn, err := auditLog.Dialer(&fakeDialer{}).DialContext(context.Background(), "tcp", "mx1.example.com:25")
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	_, err = auditLog.Dialer(&fakeDialer{err: errors.New("connection refused")}).DialContext(context.Background(), "tcp", "mx2.example.com:25")
+	require.Error(t, err)
+	require.NoError(t, auditLog.Close())
+
+	entries := readEntries(t, path)
+	require.Len(t, entries, 2)
+	require.Equal(t, Entry{Timestamp: entries[0].Timestamp, Kind: "dial", Duration: entries[0].Duration, Network: "tcp", Address: "mx1.example.com:25"}, entries[0])
+	require.Equal(t, "mx2.example.com:25", entries[1].Address)
+	require.Equal(t, "connection refused", entries[1].Error)
+
+	t.Run("SourceAddress", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+
+		path := filepath.Join(t.TempDir(), "audit.ndjson")
+
+		auditLog, err := New(path, 0)
+		require.NoError(t, err)
+
+		// the address a probe was actually sent from is recorded
+		conn, err := auditLog.Dialer(&net.Dialer{}).DialContext(context.Background(), "tcp", listener.Addr().String())
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+		require.NoError(t, auditLog.Close())
+
+		entries := readEntries(t, path)
+		require.Len(t, entries, 1)
+		require.Equal(t, "127.0.0.1", entries[0].Source)
+	})
+}
+
+func TestLog_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+
+	entry := Entry{Kind: "dial", Network: "tcp", Address: "mx1.example.com:25"}
+	line, err := json.Marshal(entry)
+	require.NoError(t, err)
+
+	// fit two entries per file
+	auditLog, err := New(path, int64(2*(len(line)+1)))
+	require.NoError(t, err)
+
+	for i := 0; i < 2*(maxBackups+2); i++ {
+		require.NoError(t, auditLog.Record(entry))
+	}
+
+	require.NoError(t, auditLog.Close())
+
+	require.Len(t, readEntries(t, path), 2)
+	for index := 1; index <= maxBackups; index++ {
+		require.Len(t, readEntries(t, path+"."+strconv.Itoa(index)), 2)
+	}
+
+	_, err = os.Stat(path + "." + strconv.Itoa(maxBackups+1))
+	require.True(t, os.IsNotExist(err), "only the configured number of backups should be kept")
+
+	t.Run("Reopen", func(t *testing.T) {
+		// an existing file's size counts towards rotation
+		auditLog, err = New(path, int64(2*(len(line)+1)))
+		require.NoError(t, err)
+		require.NoError(t, auditLog.Record(entry))
+		require.NoError(t, auditLog.Close())
+
+		require.Len(t, readEntries(t, path), 1)
+	})
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/miekg/dns"
+)
+
+type (
+	resolver struct {
+		log  *Log
+		next scanner.Resolver
+	}
+
+	dialer struct {
+		log  *Log
+		next advisor.Dialer
+	}
+)
+
+// Resolver wraps a scanner's resolver, recording every query and its
+// response. It's intended for use with scanner.WithResolverMiddleware.
+func (l *Log) Resolver(next scanner.Resolver) scanner.Resolver {
+	return &resolver{log: l, next: next}
+}
+
+// Dialer wraps an advisor's dialer, recording every connection it makes (such
+// as TLS probes and BIMI asset fetches). It's intended for use with
+// advisor.WithDialerMiddleware.
+func (l *Log) Dialer(next advisor.Dialer) advisor.Dialer {
+	return &dialer{log: l, next: next}
+}
+
+func (r *resolver) Exchange(msg *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	startTime := time.Now()
+	response, rtt, err := r.next.Exchange(msg, address)
+
+	entry := Entry{
+		Timestamp: startTime.UTC(),
+		Kind:      "dns",
+		Duration:  time.Since(startTime).Round(time.Microsecond).String(),
+		Resolver:  address,
+		Source:    r.log.sourceAddress(),
+	}
+
+	if len(msg.Question) > 0 {
+		entry.Name = msg.Question[0].Name
+		entry.Type = dns.TypeToString[msg.Question[0].Qtype]
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if response != nil {
+		entry.Rcode = dns.RcodeToString[response.Rcode]
+
+		for _, answer := range response.Answer {
+			// the header (name, TTL, class and type) is already covered by the question
+			entry.Answers = append(entry.Answers, strings.TrimSpace(strings.TrimPrefix(answer.String(), answer.Header().String())))
+		}
+	}
+
+	// a failure to audit shouldn't fail the scan itself
+	_ = r.log.Record(entry)
+
+	return response, rtt, err
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	startTime := time.Now()
+	conn, err := d.next.DialContext(ctx, network, address)
+
+	entry := Entry{
+		Timestamp: startTime.UTC(),
+		Kind:      "dial",
+		Duration:  time.Since(startTime).Round(time.Microsecond).String(),
+		Network:   network,
+		Address:   address,
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if conn != nil {
+		switch local := conn.LocalAddr().(type) {
+		case *net.TCPAddr:
+			entry.Source = local.IP.String()
+		case *net.UDPAddr:
+			entry.Source = local.IP.String()
+		}
+	}
+
+	_ = d.log.Record(entry)
+
+	return conn, err
+}
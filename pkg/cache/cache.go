@@ -7,25 +7,41 @@ import (
 
 type (
 	Cache[T any] struct {
-		cache map[string]*cacheEntry[T]
-		mutex *sync.Mutex
-		ttl   time.Duration
+		cache     map[string]*cacheEntry[T]
+		closeOnce sync.Once
+		done      chan struct{}
+		hits      uint64
+		misses    uint64
+		mutex     *sync.Mutex
+		tags      map[string]map[string]struct{}
+		ttl       time.Duration
 	}
 
 	cacheEntry[T any] struct {
 		value     *T
+		tags      map[string]struct{}
 		timestamp time.Time
 	}
+
+	// Stats counts a cache's lookups (see Get) since it was created.
+	Stats struct {
+		Hits   uint64
+		Misses uint64
+	}
 )
 
 func New[T any](ttl time.Duration) *Cache[T] {
 	c := &Cache[T]{
 		cache: make(map[string]*cacheEntry[T]),
+		done:  make(chan struct{}),
 		mutex: &sync.Mutex{},
+		tags:  make(map[string]map[string]struct{}),
 		ttl:   ttl,
 	}
 
-	go c.cleanup()
+	if ttl > 0 {
+		go c.cleanup()
+	}
 
 	return c
 }
@@ -36,41 +52,168 @@ func (c *Cache[T]) Get(key string) *T {
 
 	if entry, ok := c.cache[key]; ok {
 		if time.Since(entry.timestamp) > c.ttl {
-			delete(c.cache, key)
+			c.remove(key)
+			c.misses++
 			return nil
 		}
+		c.hits++
 		return entry.value
 	}
 
+	c.misses++
+
 	return nil
 }
 
+// Close stops the cache's cleanup goroutine. The cache remains usable, but
+// expired entries are only removed when they're next accessed.
+func (c *Cache[T]) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// Delete removes the entry of the key, returning whether there was one.
+func (c *Cache[T]) Delete(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, ok := c.cache[key]
+	c.remove(key)
+
+	return ok
+}
+
 func (c *Cache[T]) Flush() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.cache = make(map[string]*cacheEntry[T])
+	c.tags = make(map[string]map[string]struct{})
+}
+
+// Invalidate removes every entry tagged with the tag (see SetTagged),
+// returning how many were removed.
+func (c *Cache[T]) Invalidate(tag string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// removing the entries empties the tag's index as it's ranged over
+	keys := c.tags[tag]
+	removed := len(keys)
+
+	for key := range keys {
+		c.remove(key)
+	}
+
+	return removed
+}
+
+// Stats returns the number of lookups that found the key's entry, and that
+// didn't (including those whose entry had expired).
+func (c *Cache[T]) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return Stats{Hits: c.hits, Misses: c.misses}
+}
+
+// HitRate returns the fraction of lookups that found the key's entry, or 0
+// if there weren't any.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
 }
 
 func (c *Cache[T]) Set(key string, value *T) {
+	c.SetTagged(key, value)
+}
+
+// SetTagged sets the key's value, replacing any previous entry along with
+// its tags, and tags it, so it's removed by invalidating any of its tags.
+func (c *Cache[T]) SetTagged(key string, value *T, tags ...string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	c.remove(key)
 	c.cache[key] = &cacheEntry[T]{
 		value:     value,
+		tags:      make(map[string]struct{}, len(tags)),
 		timestamp: time.Now(),
 	}
+
+	c.tag(key, tags)
+}
+
+// Tag adds tags to the key's entry, if it has one, such as when a value
+// cached for one domain is found to be shared by another.
+func (c *Cache[T]) Tag(key string, tags ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.tag(key, tags)
 }
 
 func (c *Cache[T]) cleanup() {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+
 	for {
-		time.Sleep(c.ttl)
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
 
 		c.mutex.Lock()
 		for key, entry := range c.cache {
 			if time.Since(entry.timestamp) > c.ttl {
-				delete(c.cache, key)
+				c.remove(key)
 			}
 		}
 		c.mutex.Unlock()
 	}
 }
+
+// remove deletes the key's entry, and its key from the index of each of its
+// tags. The mutex must be held.
+func (c *Cache[T]) remove(key string) {
+	entry, ok := c.cache[key]
+	if !ok {
+		return
+	}
+
+	for tag := range entry.tags {
+		delete(c.tags[tag], key)
+
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+
+	delete(c.cache, key)
+}
+
+// tag adds the tags to the key's entry and the index. The mutex must be held.
+func (c *Cache[T]) tag(key string, tags []string) {
+	entry, ok := c.cache[key]
+	if !ok {
+		return
+	}
+
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+
+		entry.tags[tag] = struct{}{}
+
+		if c.tags[tag] == nil {
+			c.tags[tag] = make(map[string]struct{})
+		}
+
+		c.tags[tag][key] = struct{}{}
+	}
+}
@@ -0,0 +1,232 @@
+// Package checkpoint records the results of a bulk scan as it progresses, so
+// an interrupted scan can be resumed without rescanning completed domains.
+package checkpoint
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+)
+
+type (
+	// Checkpoint is an append-only file of scan results, one JSON entry per
+	// line. The latest entry for each domain is indexed in memory, so
+	// completed domains can be skipped.
+	Checkpoint struct {
+		file      *os.File
+		completed map[string]bool
+		mutex     sync.Mutex
+		recovered int64
+	}
+
+	// Entry is the result of scanning a single domain.
+	Entry struct {
+		Domain string `json:"domain"`
+
+		// Failed is true if the scan returned an error, so the domain can be
+		// rescanned.
+		Failed bool            `json:"failed,omitempty"`
+		Result json.RawMessage `json:"result"`
+	}
+)
+
+// Open opens (or creates) the checkpoint at path, indexing any existing
+// entries. If the last entry is incomplete (such as when the previous scan was
+// killed mid-write), it's discarded so that new entries can be appended. Any
+// other invalid entry is reported as an error, rather than being overwritten.
+func Open(path string) (*Checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+
+	checkpoint := &Checkpoint{file: file, completed: make(map[string]bool)}
+
+	valid, err := checkpoint.load()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to stat checkpoint: %w", err)
+	}
+
+	if checkpoint.recovered = info.Size() - valid; checkpoint.recovered > 0 {
+		if err = file.Truncate(valid); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to discard incomplete checkpoint entry: %w", err)
+		}
+	}
+
+	if _, err = file.Seek(valid, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to seek checkpoint: %w", err)
+	}
+
+	return checkpoint, nil
+}
+
+// Close closes the checkpoint file.
+func (c *Checkpoint) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.file.Close()
+}
+
+// Completed reports whether the domain has been scanned, and if so, whether
+// its latest scan failed.
+func (c *Checkpoint) Completed(domain string) (completed, failed bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	failed, completed = c.completed[scanner.NormalizeDomain(domain)]
+
+	return completed, failed
+}
+
+// Len returns the number of domains in the checkpoint.
+func (c *Checkpoint) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.completed)
+}
+
+// Record appends the result of scanning a domain. Each entry is written with a
+// single write, so an interrupted write only ever leaves the last entry
+// incomplete.
+func (c *Checkpoint) Record(domain string, failed bool, result []byte) error {
+	line, err := json.Marshal(Entry{Domain: scanner.NormalizeDomain(domain), Failed: failed, Result: result})
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint entry: %w", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, err = c.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write checkpoint entry: %w", err)
+	}
+
+	c.completed[scanner.NormalizeDomain(domain)] = failed
+
+	return nil
+}
+
+// Recovered returns the number of bytes discarded from an incomplete last
+// entry when the checkpoint was opened.
+func (c *Checkpoint) Recovered() int64 {
+	return c.recovered
+}
+
+// Read calls fn with the latest entry of each domain in the checkpoint at
+// path, in the order they were recorded, without opening it for new entries.
+// Entries are read one at a time (as are the domains, to find each one's
+// latest entry, first), so checkpoints of any size can be read. An incomplete
+// last entry is skipped, and an error returned by fn stops the read.
+func Read(path string, fn func(entry Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	defer file.Close()
+
+	// the line of each domain's latest entry, as earlier ones were superseded by a rescan
+	latest := make(map[string]int)
+
+	line := 0
+	if err = entries(file, func(entry Entry, _ int) error {
+		line++
+		latest[entry.Domain] = line
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek checkpoint: %w", err)
+	}
+
+	line = 0
+
+	return entries(file, func(entry Entry, _ int) error {
+		line++
+
+		if latest[entry.Domain] != line {
+			return nil
+		}
+
+		return fn(entry)
+	})
+}
+
+// load indexes the existing entries, returning the offset just past the last
+// complete one.
+func (c *Checkpoint) load() (int64, error) {
+	var offset int64
+
+	if err := entries(c.file, func(entry Entry, size int) error {
+		c.completed[entry.Domain] = entry.Failed
+		offset += int64(size)
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return offset, nil
+}
+
+// entries calls fn with each complete entry read from the reader, along with
+// the number of bytes it took. Anything after the last newline is an entry
+// whose write was interrupted, so it's skipped.
+func entries(reader io.Reader, fn func(entry Entry, size int) error) error {
+	buffered := bufio.NewReader(reader)
+
+	var (
+		line    int
+		pending error
+	)
+
+	for {
+		data, err := buffered.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if pending != nil && len(data) > 0 {
+				return pending
+			}
+
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read checkpoint: %w", err)
+		}
+
+		// an invalid entry is only recoverable if it's the last one
+		if pending != nil {
+			return pending
+		}
+
+		line++
+
+		var entry Entry
+		if err = json.Unmarshal(bytes.TrimSpace(data), &entry); err != nil || entry.Domain == "" {
+			pending = fmt.Errorf("checkpoint is corrupt at line %d", line)
+			continue
+		}
+
+		if err = fn(entry, len(data)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.ndjson")
+
+	checkpoint, err := Open(path)
+	require.NoError(t, err)
+	require.Zero(t, checkpoint.Len())
+
+	require.NoError(t, checkpoint.Record("Example.COM.", false, []byte(`{"domain":"example.com"}`)))
+	require.NoError(t, checkpoint.Record("example.org", true, []byte(`{"domain":"example.org","error":"timeout"}`)))
+	require.NoError(t, checkpoint.Close())
+
+	t.Run("Resume", func(t *testing.T) {
+		checkpoint, err := Open(path)
+		require.NoError(t, err)
+		defer checkpoint.Close()
+
+		require.Equal(t, 2, checkpoint.Len())
+		require.Zero(t, checkpoint.Recovered())
+
+		completed, failed := checkpoint.Completed("example.com")
+		require.True(t, completed)
+		require.False(t, failed)
+
+		completed, failed = checkpoint.Completed("EXAMPLE.org")
+		require.True(t, completed)
+		require.True(t, failed)
+
+		completed, _ = checkpoint.Completed("example.net")
+		require.False(t, completed)
+	})
+
+	t.Run("LatestEntryWins", func(t *testing.T) {
+		checkpoint, err := Open(path)
+		require.NoError(t, err)
+
+		require.NoError(t, checkpoint.Record("example.org", false, []byte(`{"domain":"example.org"}`)))
+		require.NoError(t, checkpoint.Close())
+
+		checkpoint, err = Open(path)
+		require.NoError(t, err)
+		defer checkpoint.Close()
+
+		_, failed := checkpoint.Completed("example.org")
+		require.False(t, failed)
+	})
+}
+
+func TestCheckpoint_Recovery(t *testing.T) {
+	entries := `{"domain":"example.com","result":{"domain":"example.com"}}` + "\n" + `{"domain":"example.org","result":{"domain":"example.org"}}` + "\n"
+
+	tests := []struct {
+		name     string
+		contents string
+		partial  string
+		err      string
+	}{
+		{name: "Complete", contents: entries},
+		{name: "TruncatedEntry", contents: entries, partial: `{"domain":"example.net","res`},
+		{name: "TruncatedInsideResult", contents: entries, partial: `{"domain":"example.net","result":{"domain":"exa`},
+		{name: "InvalidLastEntry", contents: entries, partial: "{\"domain\":\n"},
+		{name: "CorruptEntry", contents: "not json\n" + entries, err: "checkpoint is corrupt at line 1"},
+		{name: "CorruptBeforeTruncated", contents: entries + "not json\n", partial: `{"domain"`, err: "checkpoint is corrupt at line 3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.ndjson")
+			require.NoError(t, os.WriteFile(path, []byte(test.contents+test.partial), 0o644))
+
+			checkpoint, err := Open(path)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+
+				// the checkpoint must be left untouched, so it can be inspected
+				contents, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.Equal(t, test.contents+test.partial, string(contents))
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, int64(len(test.partial)), checkpoint.Recovered())
+			require.Equal(t, 2, checkpoint.Len())
+
+			// entries written after recovery must follow the last complete entry
+			require.NoError(t, checkpoint.Record("example.net", false, []byte(`{"domain":"example.net"}`)))
+			require.NoError(t, checkpoint.Close())
+
+			contents, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, entries+`{"domain":"example.net","result":{"domain":"example.net"}}`+"\n", string(contents))
+		})
+	}
+}
+
+// TestCheckpoint_KilledMidWrite simulates a scan killed at every point while
+// writing an entry, checking that each can be resumed.
+func TestCheckpoint_KilledMidWrite(t *testing.T) {
+	entry := `{"domain":"example.org","failed":true,"result":{"domain":"example.org","error":"timeout"}}` + "\n"
+	first := `{"domain":"example.com","result":{"domain":"example.com"}}` + "\n"
+
+	for written := 0; written < len(entry); written++ {
+		path := filepath.Join(t.TempDir(), "state.ndjson")
+		require.NoError(t, os.WriteFile(path, []byte(first+entry[:written]), 0o644))
+
+		checkpoint, err := Open(path)
+		require.NoError(t, err, "killed after writing %d bytes", written)
+		require.Equal(t, int64(written), checkpoint.Recovered())
+
+		completed, _ := checkpoint.Completed("example.org")
+		require.False(t, completed, "killed after writing %d bytes", written)
+		require.NoError(t, checkpoint.Close())
+
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(string(contents), "\n"))
+	}
+}
+
+func TestRead(t *testing.T) {
+	// example.org was rescanned after failing, and the last entry was interrupted mid-write
+	entries := `{"domain":"example.com","result":{"domain":"example.com"}}` + "\n" +
+		`{"domain":"example.org","failed":true,"result":{"domain":"example.org","error":"timeout"}}` + "\n" +
+		`{"domain":"example.net","result":{"domain":"example.net"}}` + "\n" +
+		`{"domain":"example.org","result":{"domain":"example.org"}}` + "\n" +
+		`{"domain":"example.info","res`
+
+	path := filepath.Join(t.TempDir(), "state.ndjson")
+	require.NoError(t, os.WriteFile(path, []byte(entries), 0o644))
+
+	var read []Entry
+	require.NoError(t, Read(path, func(entry Entry) error {
+		read = append(read, entry)
+		return nil
+	}))
+
+	require.Len(t, read, 3)
+	require.Equal(t, "example.com", read[0].Domain)
+	require.Equal(t, "example.net", read[1].Domain)
+	require.Equal(t, "example.org", read[2].Domain)
+	require.False(t, read[2].Failed)
+	require.JSONEq(t, `{"domain":"example.org"}`, string(read[2].Result))
+
+	t.Run("Corrupt", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.ndjson")
+		require.NoError(t, os.WriteFile(path, []byte("not json\n"+`{"domain":"example.com","result":{}}`+"\n"), 0o644))
+
+		require.EqualError(t, Read(path, func(Entry) error { return nil }), "checkpoint is corrupt at line 1")
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		require.Error(t, Read(filepath.Join(t.TempDir(), "missing.ndjson"), func(Entry) error { return nil }))
+	})
+}
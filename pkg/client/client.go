@@ -0,0 +1,347 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultMaxRetries is the number of times a request is retried after being rate limited.
+	defaultMaxRetries = 3
+
+	// defaultRetryWait is used when a rate limited response doesn't specify a Retry-After header.
+	defaultRetryWait = 3 * time.Second
+)
+
+type (
+	// Client is a typed client for the Domain Security Scanner API.
+	Client struct {
+		apiKey     string
+		apiPath    string
+		baseURL    *url.URL
+		httpClient *http.Client
+		maxRetries int
+	}
+
+	// Option defines a functional configuration type for a *Client.
+	Option func(*Client) error
+
+	// ScanOptions configures a single domain scan.
+	ScanOptions struct {
+		// DKIMSelectors specifies custom DKIM selectors to check.
+		DKIMSelectors []string
+
+		// Selectors specifies the only DKIM selectors to check, skipping the
+		// common selectors, so the result reports whether a key was found at
+		// each of them.
+		Selectors []string
+
+		// Detailed requests detailed output, such as lookup and check timings.
+		Detailed bool
+
+		// Explain requests the evidence behind each line of advice.
+		Explain bool
+	}
+
+	// Error is returned when the API responds with a non-successful status code.
+	Error struct {
+		StatusCode int    `json:"status"`
+		Title      string `json:"title"`
+		Detail     string `json:"detail"`
+	}
+)
+
+// New returns a new client for the API hosted at baseURL (such as
+// http://localhost:8080).
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse base URL")
+	}
+
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL scheme: %s", parsedURL.Scheme)
+	}
+
+	client := &Client{
+		apiPath:    "/api/v1",
+		baseURL:    parsedURL,
+		httpClient: &http.Client{Timeout: 2 * time.Minute},
+		maxRetries: defaultMaxRetries,
+	}
+
+	for _, opt := range opts {
+		if err = opt(client); err != nil {
+			return nil, errors.Wrap(err, "apply option")
+		}
+	}
+
+	return client, nil
+}
+
+// WithAPIKey authenticates each request with the given API key, for servers
+// that require one.
+func WithAPIKey(key string) Option {
+	return func(c *Client) error {
+		if key == "" {
+			return errors.New("invalid API key")
+		}
+
+		c.apiKey = key
+
+		return nil
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to issue requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) error {
+		if httpClient == nil {
+			return errors.New("invalid HTTP client")
+		}
+
+		c.httpClient = httpClient
+
+		return nil
+	}
+}
+
+// WithMaxRetries sets how many times a rate limited request is retried.
+func WithMaxRetries(retries int) Option {
+	return func(c *Client) error {
+		if retries < 0 {
+			return fmt.Errorf("invalid max retries: %d", retries)
+		}
+
+		c.maxRetries = retries
+
+		return nil
+	}
+}
+
+// Scan scans a single domain.
+func (c *Client) Scan(ctx context.Context, domain string, opts *ScanOptions) (*model.ScanResult, error) {
+	query := url.Values{}
+	if opts != nil {
+		if len(opts.DKIMSelectors) > 0 {
+			query.Set("dkimSelectors", strings.Join(opts.DKIMSelectors, ","))
+		}
+
+		for _, selector := range opts.Selectors {
+			query.Add("selector", selector)
+		}
+
+		if opts.Detailed {
+			query.Set("detailed", "true")
+		}
+
+		if opts.Explain {
+			query.Set("explain", "true")
+		}
+	}
+
+	response, err := c.do(ctx, http.MethodGet, "/scan/"+url.PathEscape(domain), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var result model.ScanResult
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "decode scan result")
+	}
+
+	return &result, nil
+}
+
+// ScanBulk scans multiple domains in a single request.
+func (c *Client) ScanBulk(ctx context.Context, domains []string) ([]model.ScanResult, error) {
+	body, err := json.Marshal(model.BulkScanRequest{Domains: model.BulkScanDomains(domains...)})
+	if err != nil {
+		return nil, errors.Wrap(err, "encode bulk scan request")
+	}
+
+	response, err := c.do(ctx, http.MethodPost, "/scan", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var result model.BulkScanResponse
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "decode bulk scan results")
+	}
+
+	return result.Results, nil
+}
+
+// ScanStream scans multiple domains, returning a stream that yields each
+// result as soon as the server sends it. The stream must be closed by the
+// caller.
+func (c *Client) ScanStream(ctx context.Context, domains []string) (*Stream, error) {
+	body, err := json.Marshal(model.BulkScanRequest{Domains: model.BulkScanDomains(domains...)})
+	if err != nil {
+		return nil, errors.Wrap(err, "encode bulk scan request")
+	}
+
+	response, err := c.do(ctx, http.MethodPost, "/scan/stream", nil, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStream(response), nil
+}
+
+// Validate runs the offline syntax checks against the given records, without
+// the server performing any DNS lookups or network probes.
+func (c *Client) Validate(ctx context.Context, records model.LintRequest) (*advisor.Advice, error) {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode validate request")
+	}
+
+	response, err := c.do(ctx, http.MethodPost, "/validate", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var result model.LintResponse
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "decode validate response")
+	}
+
+	return result.Advice, nil
+}
+
+// Simulate evaluates a hypothetical message against the DMARC policy its From
+// domain publishes, as looked up by the server.
+func (c *Client) Simulate(ctx context.Context, message model.SimulateRequest) (*model.SimulateResponse, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode simulate request")
+	}
+
+	response, err := c.do(ctx, http.MethodPost, "/simulate", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var result model.SimulateResponse
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "decode simulate response")
+	}
+
+	return &result, nil
+}
+
+// do issues a request against the API, retrying rate limited requests as
+// directed by the server's Retry-After header. Non-successful responses are
+// returned as an *Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte) (*http.Response, error) {
+	requestURL := c.baseURL.JoinPath(c.apiPath, path)
+	requestURL.RawQuery = query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bodyReader)
+		if err != nil {
+			return nil, errors.Wrap(err, "create request")
+		}
+
+		req.Header.Set("Accept", "application/json, application/x-ndjson, text/event-stream")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		if c.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+
+		response, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if response.StatusCode == http.StatusTooManyRequests && attempt < c.maxRetries {
+			wait := retryAfter(response.Header.Get("Retry-After"))
+			_ = response.Body.Close()
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+
+			continue
+		}
+
+		if response.StatusCode >= http.StatusBadRequest {
+			defer response.Body.Close()
+			return nil, newError(response)
+		}
+
+		return response, nil
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Detail)
+	}
+
+	return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Title)
+}
+
+// newError reads a problem details body from the response, falling back to the
+// status text if the body can't be parsed.
+func newError(response *http.Response) *Error {
+	apiError := &Error{}
+
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(apiError); err != nil {
+		apiError.Title = http.StatusText(response.StatusCode)
+	}
+
+	apiError.StatusCode = response.StatusCode
+
+	return apiError
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds
+// or an HTTP date.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return defaultRetryWait
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+
+		return 0
+	}
+
+	return defaultRetryWait
+}
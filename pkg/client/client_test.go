@@ -0,0 +1,241 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	serverHTTP "github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/http"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+var testRecords = []string{
+	"example.com. 300 IN NS ns1.example.com.",
+	"example.com. 300 IN MX 10 mx1.example.com.",
+	"example.com. 300 IN MX 20 mx2.example.com.",
+	`example.com. 300 IN TXT "v=spf1 -all"`,
+	`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject; rua=mailto:dmarc@example.com;"`,
+}
+
+// startDNSServer serves testRecords from a local UDP DNS server, returning its address.
+func startDNSServer(t *testing.T) string {
+	t.Helper()
+
+	records := make(map[string][]dns.RR)
+	for _, record := range testRecords {
+		rr, err := dns.NewRR(record)
+		require.NoError(t, err)
+
+		key := rr.Header().Name + dns.TypeToString[rr.Header().Rrtype]
+		records[key] = append(records[key], rr)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+
+		question := req.Question[0]
+		msg.Answer = records[question.Name+dns.TypeToString[question.Qtype]]
+
+		_ = w.WriteMsg(msg)
+	})}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return conn.LocalAddr().String()
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	logger := zerolog.Nop()
+
+	sc, err := scanner.New(logger, time.Second, scanner.WithNameservers([]string{startDNSServer(t)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := serverHTTP.NewServer(logger, time.Second, "test")
+	server.Advisor = advisor.NewAdvisor(time.Second, time.Minute, false)
+	server.Scanner = sc
+
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+
+	return httpServer
+}
+
+func TestClient_Integration(t *testing.T) {
+	httpServer := newTestServer(t)
+
+	client, err := New(httpServer.URL)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	t.Run("Scan", func(t *testing.T) {
+		result, err := client.Scan(ctx, "example.com", &ScanOptions{Detailed: true})
+		require.NoError(t, err)
+		require.Equal(t, "example.com", result.ScanResult.Domain)
+		require.Equal(t, "v=spf1 -all", result.ScanResult.SPF)
+		require.Equal(t, []string{"mx1.example.com.", "mx2.example.com."}, result.ScanResult.MX)
+		require.NotNil(t, result.Advice)
+		require.Len(t, result.Advice.SPF, 1)
+		require.Contains(t, result.Advice.SPF[0], "Your SPF record ends in -all, which is safe")
+		require.Contains(t, result.Timings, "dmarc_lookup")
+		require.Nil(t, result.Explanations)
+	})
+
+	t.Run("ScanExplain", func(t *testing.T) {
+		result, err := client.Scan(ctx, "example.com", &ScanOptions{Explain: true})
+		require.NoError(t, err)
+		require.Len(t, result.Explanations, len(result.Advice.Findings()))
+		require.Equal(t, []model.ExplainedAnswer{{Name: "example.com", Type: "TXT", Records: []string{"v=spf1 -all"}}}, result.Explanations[len(result.Explanations)-1].Answers)
+	})
+
+	t.Run("ScanSelectors", func(t *testing.T) {
+		result, err := client.Scan(ctx, "example.com", &ScanOptions{Selectors: []string{"mail2023", "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, []scanner.DKIMSelectorCheck{{Selector: "mail2023", Found: false}, {Selector: "s1", Found: false}}, result.ScanResult.DKIMSelectorChecks)
+		require.Len(t, result.Advice.DKIM, 2)
+		require.Contains(t, result.Advice.DKIM[0], "The selector mail2023 has no TXT record at mail2023._domainkey.example.com")
+	})
+
+	t.Run("ScanBulk", func(t *testing.T) {
+		results, err := client.ScanBulk(ctx, []string{"example.com", "EXAMPLE.com"})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Equal(t, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com;", results[0].ScanResult.DMARC)
+		require.False(t, results[0].Deduplicated)
+		require.True(t, results[1].Deduplicated)
+		require.Equal(t, results[0].Advice, results[1].Advice)
+	})
+
+	t.Run("ScanStream", func(t *testing.T) {
+		stream, err := client.ScanStream(ctx, []string{"example.com"})
+		require.NoError(t, err)
+		defer stream.Close()
+
+		var domains []string
+		for stream.Next() {
+			domains = append(domains, stream.Result().ScanResult.Domain)
+		}
+
+		require.NoError(t, stream.Err())
+		require.Equal(t, []string{"example.com"}, domains)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		advice, err := client.Validate(ctx, model.LintRequest{SPF: "v=spf1 -all"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"SPF seems to be setup correctly! No further action needed."}, advice.SPF)
+		require.Nil(t, advice.DMARC)
+	})
+
+	t.Run("Simulate", func(t *testing.T) {
+		result, err := client.Simulate(ctx, model.SimulateRequest{Domain: "example.com", EnvelopeFrom: "esp.example.net", SPF: "pass"})
+		require.NoError(t, err)
+		require.Equal(t, "fail", result.Result)
+		require.Equal(t, "reject", result.Policy)
+		require.Equal(t, model.SimulatedDisposition{Reject: 100}, result.Disposition)
+	})
+
+	t.Run("InvalidDomain", func(t *testing.T) {
+		_, err := client.Scan(ctx, "invalid.example", nil)
+
+		var apiError *Error
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, http.StatusBadRequest, apiError.StatusCode)
+	})
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+	var requests atomic.Int32
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[{"scanResult":{"domain":"example.com"}}]}`))
+	}))
+	defer httpServer.Close()
+
+	t.Run("Retried", func(t *testing.T) {
+		client, err := New(httpServer.URL)
+		require.NoError(t, err)
+
+		results, err := client.ScanBulk(context.Background(), []string{"example.com"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("RetriesExhausted", func(t *testing.T) {
+		requests.Store(0)
+
+		client, err := New(httpServer.URL, WithMaxRetries(0))
+		require.NoError(t, err)
+
+		_, err = client.ScanBulk(context.Background(), []string{"example.com"})
+
+		var apiError *Error
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, http.StatusTooManyRequests, apiError.StatusCode)
+	})
+}
+
+func TestClient_APIKey(t *testing.T) {
+	server := serverHTTP.NewServer(zerolog.Nop(), time.Second, "test")
+	server.Advisor = advisor.NewAdvisor(time.Second, time.Minute, false)
+	server.APIKeys = []serverHTTP.APIKey{{Key: "acme-key", Tenant: "acme"}}
+
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	t.Run("Missing", func(t *testing.T) {
+		client, err := New(httpServer.URL)
+		require.NoError(t, err)
+
+		_, err = client.Validate(context.Background(), model.LintRequest{SPF: "v=spf1 -all"})
+
+		var apiError *Error
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, http.StatusUnauthorized, apiError.StatusCode)
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		client, err := New(httpServer.URL, WithAPIKey("acme-key"))
+		require.NoError(t, err)
+
+		_, err = client.Validate(context.Background(), model.LintRequest{SPF: "v=spf1 -all"})
+		require.NoError(t, err)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	require.Equal(t, 5*time.Second, retryAfter("5"))
+	require.Equal(t, defaultRetryWait, retryAfter(""))
+	require.Equal(t, defaultRetryWait, retryAfter("soon"))
+	require.Equal(t, time.Duration(0), retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/http"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// maxLineSize is the largest single result the stream will accept.
+const maxLineSize = 4 << 20
+
+// Stream iterates over scan results sent as newline-delimited JSON or as
+// server-sent events.
+//
+//	for stream.Next() {
+//		result := stream.Result()
+//	}
+//	if err := stream.Err(); err != nil {}
+type Stream struct {
+	response *http.Response
+	scanner  *bufio.Scanner
+	sse      bool
+	current  *model.ScanResult
+	err      error
+}
+
+func newStream(response *http.Response) *Stream {
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+
+	return &Stream{
+		response: response,
+		scanner:  scanner,
+		sse:      mediaType == "text/event-stream",
+	}
+}
+
+// Next advances the stream to the next result, returning false once the
+// stream is exhausted or an error occurs.
+func (s *Stream) Next() bool {
+	if s.err != nil {
+		return false
+	}
+
+	for s.scanner.Scan() {
+		line := bytes.TrimSpace(s.scanner.Bytes())
+
+		if s.sse {
+			// only data fields carry results; comments, event names and ids are skipped
+			if !bytes.HasPrefix(line, []byte("data:")) {
+				continue
+			}
+
+			line = bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+
+		var result model.ScanResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			s.err = errors.Wrap(err, "decode streamed scan result")
+			return false
+		}
+
+		s.current = &result
+
+		return true
+	}
+
+	s.err = s.scanner.Err()
+
+	return false
+}
+
+// Result returns the current result.
+func (s *Stream) Result() *model.ScanResult {
+	return s.current
+}
+
+// Err returns the first error encountered while reading the stream.
+func (s *Stream) Err() error {
+	return s.err
+}
+
+// Close closes the underlying response body.
+func (s *Stream) Close() error {
+	return s.response.Body.Close()
+}
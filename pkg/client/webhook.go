@@ -0,0 +1,74 @@
+package client
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/pkg/errors"
+)
+
+// DefaultWebhookTolerance is how far a webhook delivery's timestamp may be
+// from the receiver's clock, either way, before it's rejected as a replay.
+const DefaultWebhookTolerance = 5 * time.Minute
+
+var (
+	// ErrWebhookUnsigned is returned for a webhook delivery without a
+	// timestamp, nonce or signature.
+	ErrWebhookUnsigned = errors.New("webhook delivery isn't signed")
+
+	// ErrWebhookSignature is returned for a webhook delivery whose signature
+	// doesn't match its timestamp, nonce and body.
+	ErrWebhookSignature = errors.New("webhook signature doesn't match")
+
+	// ErrWebhookExpired is returned for a webhook delivery whose timestamp is
+	// further from the receiver's clock than the tolerance allows.
+	ErrWebhookExpired = errors.New("webhook timestamp is outside the tolerance")
+)
+
+// VerifyWebhook reads the body of a webhook delivery, and verifies it was
+// signed with the tenant's secret within DefaultWebhookTolerance of now. It
+// returns the body, which is only safe to use if the error is nil.
+func VerifyWebhook(r *http.Request, secret string) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read webhook body")
+	}
+
+	return body, VerifyWebhookSignature(secret, r.Header, body, time.Now(), DefaultWebhookTolerance)
+}
+
+// VerifyWebhookSignature verifies that a webhook delivery's headers hold a
+// signature of its body made with the tenant's secret, and a timestamp within
+// the tolerance of now, either way (allowing for clock skew between the
+// server and the receiver). Its nonce is signed too, so receivers that
+// remember the nonces they've seen within the tolerance can also reject a
+// delivery replayed within it.
+func VerifyWebhookSignature(secret string, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+	timestamp, nonce := header.Get(schedule.TimestampHeader), header.Get(schedule.NonceHeader)
+
+	signature, ok := strings.CutPrefix(header.Get(schedule.SignatureHeader), schedule.SignaturePrefix)
+	if !ok || timestamp == "" || nonce == "" {
+		return ErrWebhookUnsigned
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(schedule.Signature(secret, timestamp, nonce, body))) {
+		return ErrWebhookSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook timestamp %q: %w", timestamp, err)
+	}
+
+	if skew := now.Sub(time.Unix(seconds, 0)).Abs(); skew > tolerance {
+		return fmt.Errorf("%w: its timestamp is %s off the receiver's clock", ErrWebhookExpired, skew.Round(time.Second))
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	type verified struct {
+		body []byte
+		err  error
+	}
+
+	results := make(chan verified, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := VerifyWebhook(r, "acme-secret")
+		results <- verified{body, err}
+	}))
+	defer receiver.Close()
+
+	webhook := schedule.NewWebhook(receiver.URL, time.Second, schedule.WithSigningSecrets(map[string]string{"acme": "acme-secret", "globex": "globex-secret"}))
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		require.NoError(t, webhook.Notify(context.Background(), schedule.Change{Tenant: "acme", ScheduleID: "s1", Domain: "example.com"}))
+
+		result := <-results
+		require.NoError(t, result.err)
+		require.Contains(t, string(result.body), `"domain":"example.com"`)
+	})
+
+	t.Run("OtherTenantsSecret", func(t *testing.T) {
+		require.NoError(t, webhook.Notify(context.Background(), schedule.Change{Tenant: "globex", Domain: "example.com"}))
+		require.ErrorIs(t, (<-results).err, ErrWebhookSignature)
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		require.NoError(t, webhook.Notify(context.Background(), schedule.Change{Tenant: "initech", Domain: "example.com"}))
+		require.ErrorIs(t, (<-results).err, ErrWebhookUnsigned)
+	})
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"domain":"example.com"}`)
+
+	sign := func(at time.Time, body []byte) http.Header {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+
+		header := http.Header{}
+		header.Set(schedule.TimestampHeader, timestamp)
+		header.Set(schedule.NonceHeader, "0123456789abcdef")
+		header.Set(schedule.SignatureHeader, schedule.SignaturePrefix+schedule.Signature("secret", timestamp, "0123456789abcdef", body))
+
+		return header
+	}
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		body     []byte
+		expected error
+	}{
+		{"Valid", sign(now, body), body, nil},
+		{"ClockBehind", sign(now.Add(4*time.Minute), body), body, nil},
+		{"ClockAhead", sign(now.Add(-4*time.Minute), body), body, nil},
+		{"AtTolerance", sign(now.Add(-DefaultWebhookTolerance), body), body, nil},
+		{"Stale", sign(now.Add(-6*time.Minute), body), body, ErrWebhookExpired},
+		{"Future", sign(now.Add(6*time.Minute), body), body, ErrWebhookExpired},
+		{"TamperedBody", sign(now, body), []byte(`{"domain":"example.org"}`), ErrWebhookSignature},
+		{"Unsigned", http.Header{}, body, ErrWebhookUnsigned},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyWebhookSignature("secret", test.header, test.body, now, DefaultWebhookTolerance)
+			if test.expected == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, test.expected)
+			}
+		})
+	}
+
+	t.Run("ReplayedTimestamp", func(t *testing.T) {
+		// the timestamp is signed, so it can't be moved forward to get a stale delivery past the tolerance
+		header := sign(now.Add(-time.Hour), body)
+		header.Set(schedule.TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+		require.ErrorIs(t, VerifyWebhookSignature("secret", header, body, now, DefaultWebhookTolerance), ErrWebhookSignature)
+	})
+}
@@ -0,0 +1,186 @@
+// Package dss is a library facade over the scanner and the advisor, for
+// embedding domain scans in other services. Nothing is started until the
+// first scan: no caches, worker pools or connections are created by New, and
+// no environment variables are read. Every external dependency (the DNS
+// resolver, the host resolver, the HTTP client and the dialer) is injectable,
+// so tests can scan against fakes, such as a ZoneResolver, without any
+// network access.
+package dss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/rs/zerolog"
+)
+
+// DefaultTimeout is the timeout of each DNS query and connection, unless
+// WithTimeout is given.
+const DefaultTimeout = 15 * time.Second
+
+type (
+	// ScanResult is the result of scanning a domain, with its advice.
+	ScanResult = model.ScanResult
+
+	// Option defines a functional configuration type for a *Scanner.
+	Option func(*Scanner) error
+
+	// Scanner scans domains and advises on their records. It's safe for
+	// concurrent use, and must be closed once it's no longer needed.
+	Scanner struct {
+		advisorOptions []advisor.Option
+		cacheLifetime  time.Duration
+		checkTLS       bool
+		detailed       bool
+		dialer         advisor.Dialer
+		hostResolver   advisor.HostResolver
+		httpClient     *http.Client
+		logger         zerolog.Logger
+		offline        bool
+		proxy          advisor.ProxyConfig
+		resolver       scanner.Resolver
+		scannerOptions []scanner.Option
+		timeout        time.Duration
+
+		// the scanner and advisor are only built by the first scan, guarded by mutex
+		mutex   sync.Mutex
+		advisor *advisor.Advisor
+		scanner *scanner.Scanner
+		closed  bool
+	}
+)
+
+// New returns a Scanner configured by the given options. Unless they're
+// injected, DNS queries are sent to the scanner's default nameservers, and
+// hosts are resolved by net.DefaultResolver, but only once a domain is
+// scanned. TLS checks are disabled, nothing is cached, the logger discards
+// everything, and no proxy is used (rather than one configured by the
+// environment).
+func New(opts ...Option) (*Scanner, error) {
+	s := &Scanner{
+		logger:  zerolog.Nop(),
+		timeout: DefaultTimeout,
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, fmt.Errorf("apply option: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// Scan scans a domain and returns its result, with the advisor's advice. The
+// context bounds the advisor's checks, while each DNS query is bounded by the
+// timeout. A domain that's invalid (or doesn't exist) isn't advised, and is
+// returned with the result's error set to scanner.ErrInvalidDomain.
+func (s *Scanner) Scan(ctx context.Context, domain string) (*ScanResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	domainScanner, domainAdvisor, err := s.init()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := domainScanner.Scan(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) != 1 {
+		return nil, fmt.Errorf("expected 1 result, got %d", len(results))
+	}
+
+	var advice *advisor.Advice
+	if results[0].Error != scanner.ErrInvalidDomain {
+		advice = model.Advise(ctx, domainAdvisor, results[0], false)
+	}
+
+	result := model.NewScanResult(results[0], advice, s.detailed)
+	result.Scanner = model.NewProvenance(domainScanner, domainAdvisor)
+
+	return &result, nil
+}
+
+// Close stops the scanner's worker pool and cache cleanup, and closes the
+// advisor's idle connections. A scanner that never scanned has nothing to
+// close, and a closed scanner can't scan again.
+func (s *Scanner) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.closed = true
+
+	if s.scanner != nil {
+		s.scanner.Close()
+	}
+
+	if s.advisor != nil {
+		s.advisor.Close()
+	}
+}
+
+// init builds the scanner and advisor the first time it's called, returning
+// the same ones after.
+func (s *Scanner) init() (*scanner.Scanner, *advisor.Advisor, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil, nil, errors.New("scanner is closed")
+	}
+
+	if s.scanner != nil {
+		return s.scanner, s.advisor, nil
+	}
+
+	scannerOptions := []scanner.Option{scanner.WithCacheDuration(s.cacheLifetime)}
+	if s.resolver != nil {
+		resolver := s.resolver
+		scannerOptions = append(scannerOptions, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver {
+			return resolver
+		}))
+	}
+
+	domainScanner, err := scanner.New(s.logger, s.timeout, append(scannerOptions, s.scannerOptions...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	advisorOptions := []advisor.Option{advisor.WithDetailed(s.detailed), advisor.WithOffline(s.offline), advisor.WithProxy(s.proxy)}
+	if s.dialer != nil {
+		advisorOptions = append(advisorOptions, advisor.WithDialer(s.dialer))
+	}
+
+	hostResolver := s.hostResolver
+	if resolver, ok := s.resolver.(advisor.HostResolver); ok && hostResolver == nil {
+		hostResolver = resolver
+	}
+
+	if hostResolver != nil {
+		advisorOptions = append(advisorOptions, advisor.WithHostResolver(hostResolver))
+	}
+
+	if s.httpClient != nil {
+		advisorOptions = append(advisorOptions, advisor.WithHTTPClient(s.httpClient))
+	}
+
+	s.scanner = domainScanner
+	s.advisor = advisor.NewAdvisor(s.timeout, s.cacheLifetime, s.checkTLS, append(advisorOptions, s.advisorOptions...)...)
+
+	return s.scanner, s.advisor, nil
+}
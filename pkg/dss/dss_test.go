@@ -0,0 +1,194 @@
+package dss
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+const testZone = `
+example.com.        300 IN NS    ns1.example.com.
+example.com.        300 IN MX    10 mx1.example.com.
+example.com.        300 IN TXT   "v=spf1 mx -all"
+_dmarc.example.com. 300 IN TXT   "v=DMARC1; p=reject; rua=mailto:dmarc@reports.example.net"
+mx1.example.com.    300 IN A     192.0.2.1
+www.example.com.    300 IN CNAME edge.example.net.
+edge.example.net.   300 IN A     192.0.2.10
+edge.example.net.   300 IN AAAA  2001:db8::10
+reports.example.net. 300 IN MX   0 .
+`
+
+func TestNew(t *testing.T) {
+	_, err := New(WithResolver(nil))
+	require.Error(t, err)
+
+	_, err = New(WithTimeout(0))
+	require.Error(t, err)
+
+	_, err = New(WithCacheLifetime(-time.Second))
+	require.Error(t, err)
+
+	_, err = New(WithProxy(advisor.ProxyConfig{HTTPProxy: "ftp://proxy.example.com"}))
+	require.Error(t, err)
+}
+
+func TestScanner_Scan(t *testing.T) {
+	resolver, err := NewZoneResolver(testZone)
+	require.NoError(t, err)
+
+	before := runtime.NumGoroutine()
+
+	domainScanner, err := New(WithResolver(resolver), WithTimeout(time.Second))
+	require.NoError(t, err)
+
+	// nothing is started until the first scan
+	require.Equal(t, before, runtime.NumGoroutine())
+
+	result, err := domainScanner.Scan(context.Background(), "Example.com.")
+	require.NoError(t, err)
+	require.Equal(t, "example.com", result.Domain)
+	require.Empty(t, result.ScanResult.Error)
+	require.Equal(t, "v=spf1 mx -all", result.ScanResult.SPF)
+	require.Nil(t, result.Timings)
+
+	// the report destination is checked against the zone, as the resolver also resolves hosts
+	require.Contains(t, result.Advice.DMARC, "Your DMARC report destination dmarc@reports.example.net can't receive reports, as reports.example.net publishes a null MX record, so it doesn't accept mail. Use an address at a domain that accepts mail.")
+
+	invalid, err := domainScanner.Scan(context.Background(), "missing.example.org")
+	require.NoError(t, err)
+	require.Equal(t, scanner.ErrInvalidDomain, invalid.ScanResult.Error)
+	require.Nil(t, invalid.Advice)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = domainScanner.Scan(canceled, "example.com")
+	require.ErrorIs(t, err, context.Canceled)
+
+	domainScanner.Close()
+	domainScanner.Close()
+
+	_, err = domainScanner.Scan(context.Background(), "example.com")
+	require.Error(t, err)
+
+	// the worker pool and cache cleanup are stopped once closed (polled here, as require.Eventually runs its
+	// condition in a goroutine of its own)
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestScanner_ScanNetwork(t *testing.T) {
+	network := testnet.New(t)
+	network.Resolver.
+		MX("example.com", "mx1.example.com", "mx2.example.com").
+		TXT("example.com", "v=spf1 mx -all").
+		TXT("_dmarc.example.com", "v=DMARC1; p=reject").
+		Host("mx1.example.com", "192.0.2.1").
+		Host("mx2.example.com", "192.0.2.2")
+
+	network.SMTP("mx1.example.com", &testnet.SMTPServer{MaxVersion: tls.VersionTLS12})
+	network.SMTP("mx2.example.com", &testnet.SMTPServer{Banner: "554 5.7.1 Service unavailable"})
+
+	domainScanner, err := New(
+		WithResolver(network.Resolver),
+		WithDialer(network),
+		WithHTTPClient(network.HTTPClient()),
+		WithTimeout(time.Second),
+		WithTLSChecks(true),
+		WithAdvisorOptions(advisor.WithRootCAs(network.CA.Pool())),
+	)
+	require.NoError(t, err)
+	t.Cleanup(domainScanner.Close)
+
+	result, err := domainScanner.Scan(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, "v=spf1 mx -all", result.ScanResult.SPF)
+	require.Contains(t, result.Advice.MX, "mx1.example.com: Your domain is using TLS version 1.2, and should be upgraded to TLS 1.3.")
+	require.Contains(t, result.Advice.MX, "mx2.example.com: Failed to reach domain, as the server rejected the session in its greeting (554 5.7.1 Service unavailable), so it doesn't accept mail, unless it only rejects this scanner's address.")
+}
+
+func TestScanner_CloseWithoutScan(t *testing.T) {
+	domainScanner, err := New()
+	require.NoError(t, err)
+	domainScanner.Close()
+
+	_, err = domainScanner.Scan(context.Background(), "example.com")
+	require.Error(t, err)
+}
+
+func TestZoneResolver(t *testing.T) {
+	resolver, err := NewZoneResolver(testZone)
+	require.NoError(t, err)
+
+	exchange := func(name string, recordType uint16) *dns.Msg {
+		t.Helper()
+
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, recordType)
+
+		reply, _, err := resolver.Exchange(msg, "")
+		require.NoError(t, err)
+
+		return reply
+	}
+
+	t.Run("Records", func(t *testing.T) {
+		reply := exchange("EXAMPLE.com.", dns.TypeTXT)
+		require.Equal(t, dns.RcodeSuccess, reply.Rcode)
+		require.Len(t, reply.Answer, 1)
+		require.Equal(t, []string{"v=spf1 mx -all"}, reply.Answer[0].(*dns.TXT).Txt)
+	})
+
+	t.Run("NoRecordsOfType", func(t *testing.T) {
+		reply := exchange("example.com.", dns.TypeAAAA)
+		require.Equal(t, dns.RcodeSuccess, reply.Rcode)
+		require.Empty(t, reply.Answer)
+	})
+
+	t.Run("NXDOMAIN", func(t *testing.T) {
+		require.Equal(t, dns.RcodeNameError, exchange("missing.example.com.", dns.TypeA).Rcode)
+	})
+
+	t.Run("CNAME", func(t *testing.T) {
+		reply := exchange("www.example.com.", dns.TypeA)
+		require.Len(t, reply.Answer, 2)
+		require.Equal(t, "edge.example.net.", reply.Answer[0].(*dns.CNAME).Target)
+		require.Equal(t, "192.0.2.10", reply.Answer[1].(*dns.A).A.String())
+
+		// the CNAME itself is the answer to a CNAME query
+		require.Len(t, exchange("www.example.com.", dns.TypeCNAME).Answer, 1)
+	})
+
+	t.Run("LookupHost", func(t *testing.T) {
+		addresses, err := resolver.LookupHost(context.Background(), "www.example.com")
+		require.NoError(t, err)
+		require.Equal(t, []string{"192.0.2.10", "2001:db8::10"}, addresses)
+
+		_, err = resolver.LookupHost(context.Background(), "missing.example.com")
+		var dnsErr *net.DNSError
+		require.ErrorAs(t, err, &dnsErr)
+		require.True(t, dnsErr.IsNotFound)
+	})
+
+	t.Run("LookupMX", func(t *testing.T) {
+		records, err := resolver.LookupMX(context.Background(), "example.com")
+		require.NoError(t, err)
+		require.Equal(t, []*net.MX{{Host: "mx1.example.com.", Pref: 10}}, records)
+	})
+
+	t.Run("InvalidZone", func(t *testing.T) {
+		_, err := NewZoneResolver("example.com. 300 IN MX mx1.example.com.")
+		require.Error(t, err)
+	})
+}
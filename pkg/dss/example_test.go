@@ -0,0 +1,107 @@
+package dss_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/dss"
+)
+
+// Scans a domain whose records are served by a fake resolver, with the checks
+// that need internet access skipped, so nothing leaves the process.
+func Example() {
+	resolver, err := dss.NewZoneResolver(`
+example.com.        300 IN NS  ns1.example.com.
+example.com.        300 IN MX  10 mx1.example.com.
+example.com.        300 IN MX  20 mx2.example.com.
+example.com.        300 IN TXT "v=spf1 mx -all"
+_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject; rua=mailto:dmarc@example.com"
+mx1.example.com.    300 IN A   192.0.2.1
+mx2.example.com.    300 IN A   192.0.2.2
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scanner, err := dss.New(dss.WithResolver(resolver), dss.WithOffline(true))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer scanner.Close()
+
+	result, err := scanner.Scan(context.Background(), "example.com")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(result.ScanResult.MX)
+	fmt.Println(result.ScanResult.SPF)
+	fmt.Println(result.ScanResult.DMARC)
+
+	fmt.Println(result.Advice.MX)
+	fmt.Println(result.Advice.SPF)
+
+	// Output:
+	// [mx1.example.com. mx2.example.com.]
+	// v=spf1 mx -all
+	// v=DMARC1; p=reject; rua=mailto:dmarc@example.com
+	// [You have multiple mail servers setup, which is recommended.]
+	// [Your SPF record ends in -all, which is safe as your DMARC policy is p=reject and you receive aggregate reports to catch any legitimate mail that fails. No further action needed.]
+}
+
+// selfHostedCheck is a private check, reporting whether a domain's mail
+// servers are hosted under the domain itself.
+type selfHostedCheck struct{}
+
+func (selfHostedCheck) Name() string {
+	return "selfhosted"
+}
+
+func (selfHostedCheck) Run(_ context.Context, input *advisor.ScanInput) ([]advisor.AdviceItem, error) {
+	for _, host := range input.MX {
+		if !strings.HasSuffix(strings.TrimSuffix(host, "."), "."+input.Domain) {
+			return []advisor.AdviceItem{host + " is hosted outside of " + input.Domain + "."}, nil
+		}
+	}
+
+	return []advisor.AdviceItem{"Every mail server of " + input.Domain + " is hosted under it."}, nil
+}
+
+// Checks are registered once, typically by the init function of the package
+// defining them, and are then run by every scan alongside the built-in ones.
+func init() {
+	advisor.Register(selfHostedCheck{})
+}
+
+// Scans a domain with a private check registered, whose advice is listed in
+// the advice's extensions under its name.
+func Example_registeredCheck() {
+	resolver, err := dss.NewZoneResolver(`
+example.com.        300 IN NS  ns1.example.com.
+example.com.        300 IN MX  10 mx1.example.com.
+example.com.        300 IN TXT "v=spf1 mx -all"
+mx1.example.com.    300 IN A   192.0.2.1
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scanner, err := dss.New(dss.WithResolver(resolver), dss.WithOffline(true))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer scanner.Close()
+
+	result, err := scanner.Scan(context.Background(), "example.com")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(result.Advice.Extensions["selfhosted"])
+
+	// Output:
+	// [Every mail server of example.com is hosted under it.]
+}
@@ -0,0 +1,168 @@
+package dss
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/rs/zerolog"
+)
+
+// WithAdvisorOptions applies the given options to the advisor, after the
+// facade's own, for settings the facade doesn't cover (such as
+// advisor.WithCertificateTransparency).
+func WithAdvisorOptions(opts ...advisor.Option) Option {
+	return func(s *Scanner) error {
+		s.advisorOptions = append(s.advisorOptions, opts...)
+		return nil
+	}
+}
+
+// WithCacheLifetime sets how long the results of lookups and checks are
+// cached for. The default is 0, which disables caching.
+func WithCacheLifetime(lifetime time.Duration) Option {
+	return func(s *Scanner) error {
+		if lifetime < 0 {
+			return errors.New("cache lifetime can't be negative")
+		}
+
+		s.cacheLifetime = lifetime
+
+		return nil
+	}
+}
+
+// WithDetailed includes detailed output in each result (see
+// model.NewScanResult), and keeps the advisor's per-host advice lines.
+func WithDetailed(detailed bool) Option {
+	return func(s *Scanner) error {
+		s.detailed = detailed
+		return nil
+	}
+}
+
+// WithDialer sets the dialer used to open the advisor's outbound connections,
+// for its TLS checks and remote asset fetches.
+func WithDialer(dialer advisor.Dialer) Option {
+	return func(s *Scanner) error {
+		if dialer == nil {
+			return errors.New("invalid dialer")
+		}
+
+		s.dialer = dialer
+
+		return nil
+	}
+}
+
+// WithHostResolver sets the resolver the advisor looks up the addresses and
+// MX records of hosts with, such as DMARC report destinations.
+func WithHostResolver(resolver advisor.HostResolver) Option {
+	return func(s *Scanner) error {
+		if resolver == nil {
+			return errors.New("invalid host resolver")
+		}
+
+		s.hostResolver = resolver
+
+		return nil
+	}
+}
+
+// WithHTTPClient sets the HTTP client the advisor fetches remote assets with,
+// such as BIMI logos and VMC certificates.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Scanner) error {
+		if client == nil {
+			return errors.New("invalid HTTP client")
+		}
+
+		s.httpClient = client
+
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the scanner, which discards everything by
+// default.
+func WithLogger(logger zerolog.Logger) Option {
+	return func(s *Scanner) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// WithOffline skips every advisor check that needs internet access, such as
+// TLS probes and BIMI asset downloads.
+func WithOffline(offline bool) Option {
+	return func(s *Scanner) error {
+		s.offline = offline
+		return nil
+	}
+}
+
+// WithProxy routes the advisor's outbound connections through the given
+// proxies. No proxy is used by default, even if one is configured by the
+// environment (see advisor.ProxyConfigFromEnvironment).
+func WithProxy(config advisor.ProxyConfig) Option {
+	return func(s *Scanner) error {
+		if err := config.Validate(); err != nil {
+			return err
+		}
+
+		s.proxy = config
+
+		return nil
+	}
+}
+
+// WithResolver sets the resolver every DNS query of the scanner is sent to,
+// such as a ZoneResolver in tests. If it's also an advisor.HostResolver (as a
+// ZoneResolver is), it's the advisor's host resolver too, unless
+// WithHostResolver is given.
+func WithResolver(resolver scanner.Resolver) Option {
+	return func(s *Scanner) error {
+		if resolver == nil {
+			return errors.New("invalid resolver")
+		}
+
+		s.resolver = resolver
+
+		return nil
+	}
+}
+
+// WithScannerOptions applies the given options to the scanner, after the
+// facade's own, for settings the facade doesn't cover (such as
+// scanner.WithDKIMSelectors).
+func WithScannerOptions(opts ...scanner.Option) Option {
+	return func(s *Scanner) error {
+		s.scannerOptions = append(s.scannerOptions, opts...)
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of each DNS query and connection. The default
+// is DefaultTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Scanner) error {
+		if timeout <= 0 {
+			return errors.New("timeout must be greater than 0")
+		}
+
+		s.timeout = timeout
+
+		return nil
+	}
+}
+
+// WithTLSChecks enables the advisor's TLS checks of the domain's web server
+// and mail servers, which connect to them. They're disabled by default.
+func WithTLSChecks(checkTLS bool) Option {
+	return func(s *Scanner) error {
+		s.checkTLS = checkTLS
+		return nil
+	}
+}
@@ -0,0 +1,135 @@
+package dss
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain is the longest CNAME chain a ZoneResolver follows.
+const maxCNAMEChain = 8
+
+// ZoneResolver answers DNS queries from the records of a zone file, as a
+// recursive resolver would, so domains can be scanned without any network
+// access (see WithResolver). A name with a CNAME record is answered with the
+// CNAME, followed by its target's records if they're in the zone, and a name
+// without any records is answered with NXDOMAIN. It also resolves hosts for
+// the advisor, as an advisor.HostResolver. Wildcard records aren't expanded.
+type ZoneResolver struct {
+	records map[string][]dns.RR
+}
+
+// NewZoneResolver returns a resolver answering from the given zone file,
+// whose names must be fully qualified.
+func NewZoneResolver(zone string) (*ZoneResolver, error) {
+	resolver := &ZoneResolver{records: make(map[string][]dns.RR)}
+
+	parser := dns.NewZoneParser(strings.NewReader(zone), "", "")
+	for record, ok := parser.Next(); ok; record, ok = parser.Next() {
+		name := strings.ToLower(record.Header().Name)
+		resolver.records[name] = append(resolver.records[name], record)
+	}
+
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse zone: %w", err)
+	}
+
+	return resolver, nil
+}
+
+// Exchange answers the message's question from the zone.
+func (r *ZoneResolver) Exchange(msg *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	reply := new(dns.Msg)
+	reply.SetReply(msg)
+
+	if len(msg.Question) == 0 {
+		reply.Rcode = dns.RcodeFormatError
+		return reply, 0, nil
+	}
+
+	question := msg.Question[0]
+	if _, ok := r.records[strings.ToLower(question.Name)]; !ok {
+		reply.Rcode = dns.RcodeNameError
+		return reply, 0, nil
+	}
+
+	reply.Answer = r.answer(question.Name, question.Qtype)
+
+	return reply, 0, nil
+}
+
+// LookupHost returns the addresses of the host's A and AAAA records.
+func (r *ZoneResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	var addresses []string
+
+	for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		for _, answer := range r.answer(host, recordType) {
+			switch record := answer.(type) {
+			case *dns.A:
+				addresses = append(addresses, record.A.String())
+			case *dns.AAAA:
+				addresses = append(addresses, record.AAAA.String())
+			}
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addresses, nil
+}
+
+// LookupMX returns the host's MX records.
+func (r *ZoneResolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	var records []*net.MX
+
+	for _, answer := range r.answer(name, dns.TypeMX) {
+		if record, ok := answer.(*dns.MX); ok {
+			records = append(records, &net.MX{Host: record.Mx, Pref: record.Preference})
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	return records, nil
+}
+
+// answer returns copies of the name's records of the given type, following
+// any CNAME chain.
+func (r *ZoneResolver) answer(name string, recordType uint16) []dns.RR {
+	var answers []dns.RR
+
+	name = strings.ToLower(dns.Fqdn(name))
+
+	for range maxCNAMEChain {
+		var target string
+
+		for _, record := range r.records[name] {
+			if cname, ok := record.(*dns.CNAME); ok && recordType != dns.TypeCNAME {
+				answers = append(answers, dns.Copy(cname))
+				target = strings.ToLower(dns.Fqdn(cname.Target))
+
+				break
+			}
+
+			if record.Header().Rrtype == recordType {
+				answers = append(answers, dns.Copy(record))
+			}
+		}
+
+		if target == "" {
+			break
+		}
+
+		name = target
+	}
+
+	return answers
+}
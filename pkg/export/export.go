@@ -0,0 +1,278 @@
+// Package export writes scan results as CSV or NDJSON as they're produced, so
+// result sets of any size can be exported without holding them in memory.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	// FormatCSV writes each result as a CSV row, as dss scan prints with
+	// --format csv.
+	FormatCSV = "csv"
+
+	// FormatNDJSON writes each result as a line of JSON.
+	FormatNDJSON = "ndjson"
+
+	// DefaultBufferSize is the most bytes a writer buffers before writing
+	// them out, by default. Writes block once the buffer is full until the
+	// destination accepts more, so a slow reader holds up whatever produces
+	// the results, rather than them piling up in memory.
+	DefaultBufferSize = 64 << 10
+
+	// DefaultFlushInterval is how long a result is buffered for at most
+	// before it's flushed, by default.
+	DefaultFlushInterval = time.Second
+)
+
+var (
+	// ErrClosed is returned when writing to a writer that has been closed.
+	ErrClosed = errors.New("export writer is closed")
+
+	// ErrUnknownFormat is returned for a format other than FormatCSV or
+	// FormatNDJSON.
+	ErrUnknownFormat = errors.New("unknown export format")
+)
+
+type (
+	// Option configures a Writer.
+	Option func(*Writer)
+
+	// Row is a result that can be written as a CSV row, such as a
+	// *model.ScanResult.
+	Row interface {
+		CSV() []string
+	}
+
+	// Writer writes results to a destination as they're produced, buffering
+	// at most its buffer size and flushing whatever is buffered at its flush
+	// interval, so a slow trickle of results still reaches the destination
+	// promptly. If the destination implements Flush (as an http.Flusher
+	// does), it's flushed too. It's safe for concurrent use.
+	Writer struct {
+		format   string
+		header   []string
+		interval time.Duration
+		size     int
+
+		flusher interface{ Flush() }
+
+		// mutex guards everything below, and serializes writes to the
+		// destination (including those of timed flushes).
+		mutex   sync.Mutex
+		buffer  *bufio.Writer
+		csv     *csv.Writer
+		timer   *time.Timer
+		started bool
+		closed  bool
+		err     error
+	}
+)
+
+// WithBufferSize sets the most bytes buffered before they're written to the
+// destination. The default is DefaultBufferSize.
+func WithBufferSize(size int) Option {
+	return func(w *Writer) {
+		if size > 0 {
+			w.size = size
+		}
+	}
+}
+
+// WithFlushInterval sets how long a result is buffered for at most before
+// it's flushed. The default is DefaultFlushInterval, and 0 flushes each
+// result as soon as it's written.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(w *Writer) {
+		if interval >= 0 {
+			w.interval = interval
+		}
+	}
+}
+
+// WithHeader writes the columns as a CSV row before the first result, and
+// pads the rows of results with fewer columns (such as those without the
+// scanner column), so every row has as many. It's ignored for NDJSON.
+func WithHeader(columns []string) Option {
+	return func(w *Writer) {
+		w.header = columns
+	}
+}
+
+// NewWriter returns a writer of results to the destination, in the format
+// (FormatCSV or FormatNDJSON).
+func NewWriter(destination io.Writer, format string, opts ...Option) (*Writer, error) {
+	if format != FormatCSV && format != FormatNDJSON {
+		return nil, fmt.Errorf("%w: %q, expected %s or %s", ErrUnknownFormat, format, FormatCSV, FormatNDJSON)
+	}
+
+	w := &Writer{format: format, interval: DefaultFlushInterval, size: DefaultBufferSize}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	w.buffer = bufio.NewWriterSize(destination, w.size)
+	w.csv = csv.NewWriter(w.buffer)
+	w.flusher, _ = destination.(interface{ Flush() })
+
+	return w, nil
+}
+
+// ContentType returns the media type of the writer's format, for HTTP
+// responses.
+func (w *Writer) ContentType() string {
+	if w.format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+
+	return "application/x-ndjson"
+}
+
+// Write writes a result, which must be a Row for FormatCSV. NDJSON results
+// are marshaled as JSON (so a json.RawMessage is written as it is). Once
+// writing to the destination fails, every later write returns the same
+// error, so the caller can stop producing results.
+func (w *Writer) Write(result any) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	} else if w.err != nil {
+		return w.err
+	}
+
+	if !w.started && w.format == FormatCSV && len(w.header) > 0 {
+		if w.err = w.writeRow(w.header); w.err != nil {
+			return w.err
+		}
+	}
+
+	w.started = true
+
+	switch w.format {
+	case FormatCSV:
+		row, ok := result.(Row)
+		if !ok {
+			return fmt.Errorf("%T can't be written as CSV", result)
+		}
+
+		record := row.CSV()
+		if len(record) < len(w.header) {
+			record = append(record, make([]string, len(w.header)-len(record))...)
+		}
+
+		w.err = w.writeRow(record)
+	default:
+		line, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to marshal result: %w", err)
+		}
+
+		if _, w.err = w.buffer.Write(append(line, '\n')); w.err != nil {
+			w.err = fmt.Errorf("failed to write result: %w", w.err)
+		}
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.interval == 0 {
+		return w.flush()
+	}
+
+	// whatever is left in the buffer is flushed once the interval passes, unless it fills up first
+	if w.buffer.Buffered() > 0 && w.timer == nil {
+		w.timer = time.AfterFunc(w.interval, w.flushBuffered)
+	}
+
+	return nil
+}
+
+// Flush writes whatever is buffered to the destination.
+func (w *Writer) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+
+	return w.flush()
+}
+
+// Close flushes whatever is buffered, and stops the writer's timed flushes.
+// It doesn't close the destination, and returns the first error writing to
+// it.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return w.err
+	}
+
+	err := w.flush()
+	w.closed = true
+
+	return err
+}
+
+// flushBuffered flushes the writer once its flush interval has passed since a
+// result was buffered.
+func (w *Writer) flushBuffered() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// the writer may have been closed while the timer fired
+	if !w.closed {
+		_ = w.flush()
+	}
+}
+
+// writeRow writes a CSV row to the buffer. The caller must hold the mutex.
+func (w *Writer) writeRow(row []string) error {
+	_ = w.csv.Write(row)
+
+	// the CSV writer has a buffer of its own, which is emptied into the writer's after every row
+	w.csv.Flush()
+
+	if err := w.csv.Error(); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+
+	return nil
+}
+
+// flush writes the buffer to the destination, and flushes the destination
+// too if it can be. The caller must hold the mutex.
+func (w *Writer) flush() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := w.buffer.Flush(); err != nil {
+		w.err = fmt.Errorf("failed to write result: %w", err)
+		return w.err
+	}
+
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+// countingWriter discards what's written to it, counting the bytes and
+// flushes.
+type countingWriter struct {
+	mutex   sync.Mutex
+	bytes   int
+	flushes int
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.bytes += len(data)
+
+	return len(data), nil
+}
+
+func (w *countingWriter) Flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.flushes++
+}
+
+// failingWriter fails every write, as a disconnected client's response does.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func syntheticResult(index int) *model.ScanResult {
+	domain := fmt.Sprintf("domain-%d.example", index)
+
+	return &model.ScanResult{
+		Domain: domain,
+		ScanResult: &scanner.Result{
+			Domain: domain,
+			DMARC:  "v=DMARC1; p=reject; rua=mailto:dmarc@" + domain,
+			MX:     []string{"mx1." + domain, "mx2." + domain},
+			SPF:    "v=spf1 include:_spf." + domain + " -all",
+		},
+		Advice: &advisor.Advice{
+			DMARC: []string{"DMARC seems to be setup correctly! No further action needed."},
+			SPF:   []string{"SPF seems to be setup correctly! No further action needed."},
+		},
+	}
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("NDJSON", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		writer, err := NewWriter(&buffer, FormatNDJSON)
+		require.NoError(t, err)
+		require.Equal(t, "application/x-ndjson", writer.ContentType())
+
+		require.NoError(t, writer.Write(syntheticResult(1)))
+		require.NoError(t, writer.Write(json.RawMessage(`{"domain": "domain-2.example"}`)))
+
+		// nothing is written until the buffer fills or the writer is flushed
+		require.Zero(t, buffer.Len())
+		require.NoError(t, writer.Close())
+
+		lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+		require.Len(t, lines, 2)
+
+		var result model.ScanResult
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &result))
+		require.Equal(t, "domain-1.example", result.Domain)
+		require.Equal(t, `{"domain":"domain-2.example"}`, lines[1])
+
+		require.ErrorIs(t, writer.Write(syntheticResult(3)), ErrClosed)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		writer, err := NewWriter(&buffer, FormatCSV, WithHeader(model.CSVHeader()))
+		require.NoError(t, err)
+		require.Equal(t, "text/csv; charset=utf-8", writer.ContentType())
+
+		require.NoError(t, writer.Write(syntheticResult(1)))
+		require.NoError(t, writer.Write(syntheticResult(2)))
+		require.ErrorContains(t, writer.Write(json.RawMessage(`{}`)), "can't be written as CSV")
+		require.NoError(t, writer.Close())
+
+		rows, err := csv.NewReader(&buffer).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 3)
+		require.Equal(t, model.CSVHeader(), rows[0])
+		require.Empty(t, rows[2][8])
+		require.Equal(t, "domain-2.example", rows[2][0])
+		require.Equal(t, "mx1.domain-2.example; mx2.domain-2.example", rows[2][4])
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		_, err := NewWriter(&bytes.Buffer{}, "yaml")
+		require.ErrorIs(t, err, ErrUnknownFormat)
+	})
+
+	t.Run("FlushInterval", func(t *testing.T) {
+		destination := &countingWriter{}
+
+		writer, err := NewWriter(destination, FormatNDJSON, WithFlushInterval(20*time.Millisecond))
+		require.NoError(t, err)
+		defer writer.Close()
+
+		// a single result is flushed once the interval passes, without waiting for more
+		require.NoError(t, writer.Write(syntheticResult(1)))
+		require.Eventually(t, func() bool {
+			destination.mutex.Lock()
+			defer destination.mutex.Unlock()
+
+			return destination.bytes > 0 && destination.flushes == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("BufferSize", func(t *testing.T) {
+		destination := &countingWriter{}
+
+		writer, err := NewWriter(destination, FormatNDJSON, WithBufferSize(1024), WithFlushInterval(time.Hour))
+		require.NoError(t, err)
+		defer writer.Close()
+
+		for index := range 100 {
+			require.NoError(t, writer.Write(syntheticResult(index)))
+		}
+
+		// the results are written out as the buffer fills, rather than waiting for the flush
+		destination.mutex.Lock()
+		defer destination.mutex.Unlock()
+
+		require.Greater(t, destination.bytes, 100*200)
+		require.Zero(t, destination.flushes)
+	})
+
+	t.Run("Disconnected", func(t *testing.T) {
+		writer, err := NewWriter(failingWriter{}, FormatNDJSON, WithFlushInterval(0))
+		require.NoError(t, err)
+
+		require.ErrorContains(t, writer.Write(syntheticResult(1)), "connection reset by peer")
+
+		// the error sticks, so the results' producer can stop
+		require.ErrorContains(t, writer.Write(syntheticResult(2)), "connection reset by peer")
+		require.ErrorContains(t, writer.Close(), "connection reset by peer")
+	})
+}
+
+func TestWriter_Memory(t *testing.T) {
+	const (
+		results = 100_000
+
+		// the writer holds its buffer and a single result at a time, so the heap mustn't grow with the results
+		ceiling = 4 << 20
+	)
+
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			destination := &countingWriter{}
+
+			writer, err := NewWriter(destination, format, WithHeader(model.CSVHeader()))
+			require.NoError(t, err)
+
+			var stats runtime.MemStats
+
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			baseline := stats.HeapAlloc
+
+			var peak uint64
+
+			for index := range results {
+				require.NoError(t, writer.Write(syntheticResult(index)))
+
+				if index%10_000 == 0 {
+					runtime.GC()
+					runtime.ReadMemStats(&stats)
+					peak = max(peak, stats.HeapAlloc)
+				}
+			}
+
+			require.NoError(t, writer.Close())
+
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapAlloc)
+
+			require.Greater(t, destination.bytes, results*100, "every result must be written")
+			require.Less(t, int64(peak)-int64(baseline), int64(ceiling), "the heap grew by %d bytes exporting %d results", int64(peak)-int64(baseline), results)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+// Package generate turns a scan result into DNS record definitions that can be
+// published as-is, such as Terraform resources or a zone file.
+package generate
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+const (
+	// defaultTTL is the TTL used for every generated record.
+	defaultTTL = 3600
+
+	// maxStringLength is the maximum length of a single TXT character string.
+	maxStringLength = 255
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// providers holds a template for each supported output format, keyed by the
+// template's file name (without its extension). Adding a provider only
+// requires adding its template.
+var providers = template.Must(template.New("").Funcs(template.FuncMap{
+	"hcl":      hclQuote,
+	"relative": relativeName,
+	"route53":  route53Quote,
+	"zone":     zoneQuote,
+}).ParseFS(templateFS, "templates/*.tmpl"))
+
+type (
+	// Options configures the generated records.
+	Options struct {
+		// ReportMailbox receives DMARC aggregate reports and TLS-RPT reports.
+		// It defaults to dmarc@ the scanned domain.
+		ReportMailbox string
+
+		// DMARCPolicy is the DMARC policy stage to publish: none, quarantine or
+		// reject. It defaults to none.
+		DMARCPolicy string
+
+		// MTASTSMode is the MTA-STS policy mode: testing or enforce. It defaults
+		// to testing.
+		MTASTSMode string
+
+		// MTASTSID is the MTA-STS policy ID, which must change whenever the
+		// policy does. It defaults to the current UTC time.
+		MTASTSID string
+	}
+
+	// Record is a single DNS record to publish.
+	Record struct {
+		// Key uniquely identifies the record, for use as a resource name.
+		Key string
+
+		// Name is the record's fully qualified name, without a trailing dot.
+		Name  string
+		Type  string
+		TTL   int
+		Value string
+
+		// Comment lines explain any further action needed for the record.
+		Comment []string
+	}
+
+	// Records holds everything passed to a provider's template.
+	Records struct {
+		Domain  string
+		Records []Record
+
+		// Placeholders are records that can't be generated (such as DKIM keys,
+		// which only the sending service can issue). They're rendered
+		// commented out, so they're never published by accident.
+		Placeholders []Record
+	}
+)
+
+// Providers returns the names of the supported output formats.
+func Providers() []string {
+	var names []string
+
+	for _, tmpl := range providers.Templates() {
+		if name := strings.TrimSuffix(tmpl.Name(), path.Ext(tmpl.Name())); name != tmpl.Name() {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Generate builds the DMARC, SPF, MTA-STS and TLS-RPT records to publish for
+// the scanned domain. An existing SPF record is kept if it already ends with
+// a restrictive all mechanism, otherwise a skeleton based on the domain's MX
+// records is used instead.
+func Generate(result *scanner.Result, opts Options) (*Records, error) {
+	if result == nil || result.Domain == "" {
+		return nil, errors.New("no scan result to generate records from")
+	}
+
+	domain := strings.ToLower(strings.TrimSuffix(result.Domain, "."))
+
+	if opts.ReportMailbox == "" {
+		opts.ReportMailbox = "dmarc@" + domain
+	}
+
+	if _, err := mail.ParseAddress(opts.ReportMailbox); err != nil || strings.ContainsAny(opts.ReportMailbox, "<> ") {
+		return nil, fmt.Errorf("invalid report mailbox %q", opts.ReportMailbox)
+	}
+
+	if opts.DMARCPolicy == "" {
+		opts.DMARCPolicy = "none"
+	}
+
+	switch opts.DMARCPolicy {
+	case "none", "quarantine", "reject":
+	default:
+		return nil, fmt.Errorf("invalid DMARC policy %q, it must be none, quarantine or reject", opts.DMARCPolicy)
+	}
+
+	if opts.MTASTSMode == "" {
+		opts.MTASTSMode = "testing"
+	}
+
+	if opts.MTASTSMode != "testing" && opts.MTASTSMode != "enforce" {
+		return nil, fmt.Errorf("invalid MTA-STS mode %q, it must be testing or enforce", opts.MTASTSMode)
+	}
+
+	if opts.MTASTSID == "" {
+		opts.MTASTSID = time.Now().UTC().Format("20060102150405")
+	}
+
+	records := &Records{Domain: domain}
+
+	dmarcRecord := Record{
+		Key:   "dmarc",
+		Name:  "_dmarc." + domain,
+		Type:  "TXT",
+		TTL:   defaultTTL,
+		Value: "v=DMARC1; p=" + opts.DMARCPolicy + "; sp=" + opts.DMARCPolicy + "; rua=mailto:" + opts.ReportMailbox + "; fo=1",
+	}
+
+	// reports sent to another domain must be authorized by that domain (RFC 7489, section 7.1)
+	if mailboxDomain := strings.ToLower(opts.ReportMailbox[strings.LastIndex(opts.ReportMailbox, "@")+1:]); mailboxDomain != domain && !strings.HasSuffix(mailboxDomain, "."+domain) {
+		dmarcRecord.Comment = []string{mailboxDomain + " must publish a TXT record of \"v=DMARC1\" at " + domain + "._report._dmarc." + mailboxDomain + " to accept these reports."}
+	}
+
+	records.Records = append(records.Records, dmarcRecord)
+
+	records.Records = append(records.Records, spfRecord(domain, result))
+
+	var mxHosts []string
+	for _, mx := range result.MX {
+		if host := strings.TrimSuffix(strings.TrimSpace(mx), "."); host != "" {
+			mxHosts = append(mxHosts, host)
+		}
+	}
+
+	// MTA-STS and TLS-RPT only apply to domains that receive mail
+	if len(mxHosts) > 0 {
+		comment := []string{
+			"Publish the following policy at https://mta-sts." + domain + "/.well-known/mta-sts.txt:",
+			"  version: STSv1",
+			"  mode: " + opts.MTASTSMode,
+		}
+
+		for _, host := range mxHosts {
+			comment = append(comment, "  mx: "+host)
+		}
+
+		comment = append(comment, "  max_age: 604800")
+
+		records.Records = append(records.Records, Record{
+			Key:     "mta_sts",
+			Name:    "_mta-sts." + domain,
+			Type:    "TXT",
+			TTL:     defaultTTL,
+			Value:   "v=STSv1; id=" + opts.MTASTSID,
+			Comment: comment,
+		}, Record{
+			Key:   "tls_rpt",
+			Name:  "_smtp._tls." + domain,
+			Type:  "TXT",
+			TTL:   defaultTTL,
+			Value: "v=TLSRPTv1; rua=mailto:" + opts.ReportMailbox,
+		})
+	}
+
+	if result.DKIM == "" {
+		records.Placeholders = append(records.Placeholders, Record{
+			Key:     "dkim",
+			Name:    "SELECTOR._domainkey." + domain,
+			Type:    "TXT",
+			TTL:     defaultTTL,
+			Value:   "v=DKIM1; k=rsa; p=PUBLIC_KEY",
+			Comment: []string{"Replace SELECTOR and PUBLIC_KEY with the values issued by your mail provider."},
+		})
+	}
+
+	return records, nil
+}
+
+// Render writes the records in the given provider's format.
+func Render(w io.Writer, provider string, records *Records) error {
+	tmpl := providers.Lookup(provider + ".tmpl")
+	if tmpl == nil {
+		return fmt.Errorf("unsupported provider %q, it must be one of: %s", provider, strings.Join(Providers(), ", "))
+	}
+
+	return tmpl.Execute(w, records)
+}
+
+// spfRecord returns the domain's existing SPF record if it's already
+// restrictive, otherwise a skeleton authorizing only its mail servers.
+func spfRecord(domain string, result *scanner.Result) Record {
+	record := Record{
+		Key:  "spf",
+		Name: domain,
+		Type: "TXT",
+		TTL:  defaultTTL,
+	}
+
+	if spf := strings.TrimSpace(result.SPF); strings.HasSuffix(spf, "-all") || strings.HasSuffix(spf, "~all") {
+		record.Value = spf
+		record.Comment = []string{"Your existing SPF record is kept as-is."}
+		return record
+	}
+
+	if len(result.MX) > 0 {
+		record.Value = "v=spf1 mx -all"
+	} else {
+		record.Value = "v=spf1 -all"
+	}
+
+	record.Comment = []string{"Add an include: mechanism for each service that sends mail on your behalf, before the -all."}
+
+	return record
+}
+
+// hclQuote returns s as a quoted HCL string, escaping template sequences.
+func hclQuote(s string) string {
+	quoted := strconv.Quote(s)
+	quoted = strings.ReplaceAll(quoted, "${", "$${")
+	quoted = strings.ReplaceAll(quoted, "%{", "%%{")
+
+	return quoted
+}
+
+// relativeName returns a record's name relative to the domain, using @ for
+// the domain itself.
+func relativeName(name, domain string) string {
+	if name == domain {
+		return "@"
+	}
+
+	return strings.TrimSuffix(name, "."+domain)
+}
+
+// route53Quote returns s as a quoted HCL string for a Route 53 TXT record,
+// which splits values longer than 255 characters into multiple strings.
+func route53Quote(s string) string {
+	return hclQuote(strings.Join(splitString(s), `""`))
+}
+
+// splitString splits s into TXT character strings of at most 255 characters.
+func splitString(s string) []string {
+	var parts []string
+
+	for len(s) > maxStringLength {
+		parts = append(parts, s[:maxStringLength])
+		s = s[maxStringLength:]
+	}
+
+	return append(parts, s)
+}
+
+// zoneQuote returns s as one or more quoted zone file character strings.
+func zoneQuote(s string) string {
+	parts := splitString(s)
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	for index, part := range parts {
+		parts[index] = `"` + escaper.Replace(part) + `"`
+	}
+
+	return strings.Join(parts, " ")
+}
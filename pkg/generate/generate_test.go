@@ -0,0 +1,97 @@
+package generate
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestRender_Golden(t *testing.T) {
+	fixtures := map[string]*scanner.Result{
+		// no DKIM record or restrictive SPF record, so a placeholder and skeleton are generated
+		"missing": {Domain: "Example.com.", MX: []string{"mx1.example.com.", "mx2.example.com."}, SPF: "v=spf1 include:_spf.example.net ?all"},
+		// existing DKIM and SPF records, but no mail servers
+		"existing": {Domain: "example.org", DKIM: "v=DKIM1; k=rsa; p=KEY", SPF: "v=spf1 include:_spf.example.net -all"},
+	}
+
+	options := Options{DMARCPolicy: "quarantine", MTASTSMode: "enforce", MTASTSID: "20240101000000", ReportMailbox: "reports@example.com"}
+
+	for _, provider := range Providers() {
+		for name, result := range fixtures {
+			t.Run(provider+"/"+name, func(t *testing.T) {
+				records, err := Generate(result, options)
+				require.NoError(t, err)
+
+				var output bytes.Buffer
+				require.NoError(t, Render(&output, provider, records))
+
+				golden := filepath.Join("testdata", provider+"."+name+".golden")
+				if *update {
+					require.NoError(t, os.WriteFile(golden, output.Bytes(), 0o644))
+				}
+
+				expected, err := os.ReadFile(golden)
+				require.NoError(t, err)
+				require.Equal(t, string(expected), output.String())
+			})
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		records, err := Generate(&scanner.Result{Domain: "example.com", MX: []string{"mx.example.com."}}, Options{})
+		require.NoError(t, err)
+		require.Equal(t, "v=DMARC1; p=none; sp=none; rua=mailto:dmarc@example.com; fo=1", records.Records[0].Value)
+		require.Equal(t, "v=spf1 mx -all", records.Records[1].Value)
+		require.Contains(t, records.Records[2].Comment, "  mode: testing")
+		require.Len(t, records.Records[2].Value, len("v=STSv1; id=20240101000000"))
+	})
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		result := &scanner.Result{Domain: "example.com"}
+
+		for _, opts := range []Options{{DMARCPolicy: "strict"}, {MTASTSMode: "none"}, {ReportMailbox: "not an address"}} {
+			_, err := Generate(result, opts)
+			require.Error(t, err)
+		}
+	})
+
+	t.Run("NoPlaceholderValues", func(t *testing.T) {
+		// DKIM keys are never generated, only referenced by placeholders
+		records, err := Generate(&scanner.Result{Domain: "example.com"}, Options{})
+		require.NoError(t, err)
+
+		for _, record := range records.Records {
+			require.NotContains(t, record.Value, "DKIM1")
+		}
+
+		require.Len(t, records.Placeholders, 1)
+		require.Equal(t, "v=DKIM1; k=rsa; p=PUBLIC_KEY", records.Placeholders[0].Value)
+	})
+
+	t.Run("UnsupportedProvider", func(t *testing.T) {
+		records, err := Generate(&scanner.Result{Domain: "example.com"}, Options{})
+		require.NoError(t, err)
+
+		err = Render(&bytes.Buffer{}, "bind", records)
+		require.ErrorContains(t, err, "terraform-cloudflare, terraform-route53, zonefile")
+	})
+}
+
+func TestQuote(t *testing.T) {
+	long := "v=spf1 " + strings.Repeat("include:_spf.example.com ", 12) + "-all"
+
+	require.Equal(t, `"a \"b\" \\c"`, zoneQuote(`a "b" \c`))
+	require.Equal(t, `"`+long[:255]+`" "`+long[255:]+`"`, zoneQuote(long))
+	require.Equal(t, `"`+long[:255]+`\"\"`+long[255:]+`"`, route53Quote(long))
+	require.Equal(t, `"$${var} %%{if}"`, hclQuote("${var} %{if}"))
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+func (s *Server) registerAdminRoutes() {
+	type ReloadDataResponse struct {
+		Body struct {
+			ConsumerDomains int    `json:"consumerDomains" doc:"The number of consumer mailbox domains, built-in and from the consumer domains file." example:"120"`
+			Providers       int    `json:"providers" doc:"The number of mail providers and managed services, built-in and from the providers file." example:"24"`
+			CatalogEntries  int    `json:"catalogEntries" doc:"The number of severity rules in the advice catalog, built-in and from the advice catalog file." example:"180"`
+			AdviceCatalog   string `json:"adviceCatalog" doc:"The revision of the advice catalog now in use, as reported by each result's provenance." example:"3f2a9c1b7d4e"`
+		}
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "reload-data",
+		Summary:     "Reload the data files",
+		Description: "Re-reads the consumer domains, providers and advice catalog files the server was started with, so new scans use their contents, while scans already running keep the data they started with. If any file fails to be read, the data in use is kept, and the error is returned. Requires an admin API key.",
+		Method:      http.MethodPost,
+		Path:        s.apiPath + "/admin/reload",
+		Tags:        []string{"Admin"},
+	}, func(ctx context.Context, input *struct{}) (*ReloadDataResponse, error) {
+		if !callerFromContext(ctx).admin {
+			return nil, huma.Error403Forbidden("an admin API key is required")
+		}
+
+		summary, err := advisor.LoadData(s.DataFiles)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("failed to reload the data files, keeping the data in use")
+			return nil, huma.Error422UnprocessableEntity(err.Error() + ", so the data in use was kept")
+		}
+
+		s.logger.Info().Int("consumerDomains", summary.ConsumerDomains).Int("providers", summary.Providers).Int("catalogEntries", summary.CatalogEntries).Str("adviceCatalog", summary.CatalogVersion).Msg("reloaded the data files")
+
+		resp := ReloadDataResponse{}
+		resp.Body.ConsumerDomains = summary.ConsumerDomains
+		resp.Body.Providers = summary.Providers
+		resp.Body.CatalogEntries = summary.CatalogEntries
+		resp.Body.AdviceCatalog = summary.CatalogVersion
+
+		return &resp, nil
+	})
+}
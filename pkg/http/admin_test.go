@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin_Reload(t *testing.T) {
+	t.Cleanup(func() {
+		_, err := advisor.LoadData(advisor.DataFiles{})
+		require.NoError(t, err)
+	})
+
+	builtIn := advisor.CurrentData()
+	path := filepath.Join(t.TempDir(), "consumer.txt")
+	require.NoError(t, os.WriteFile(path, []byte("mail.example\nwebmail.example.net\n"), 0o644))
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.APIKeys = []APIKey{
+		{Key: "acme-key", Tenant: "acme"},
+		{Key: "ops-key", Tenant: "ops", Admin: true},
+	}
+	server.DataFiles = advisor.DataFiles{ConsumerDomains: path}
+
+	reload := func(key string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/reload", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		server.Handler().ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	require.Equal(t, http.StatusForbidden, reload("acme-key").Code)
+	require.Equal(t, builtIn, advisor.CurrentData())
+
+	recorder := reload("ops-key")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var resp struct {
+		ConsumerDomains int    `json:"consumerDomains"`
+		Providers       int    `json:"providers"`
+		CatalogEntries  int    `json:"catalogEntries"`
+		AdviceCatalog   string `json:"adviceCatalog"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.Equal(t, builtIn.ConsumerDomains+2, resp.ConsumerDomains)
+	require.Equal(t, builtIn.Providers, resp.Providers)
+	require.Equal(t, builtIn.CatalogVersion, resp.AdviceCatalog)
+
+	// a file that fails to be read leaves the data in use in place
+	loaded := advisor.CurrentData()
+	require.NoError(t, os.WriteFile(path, []byte("mail.example\nnot a domain\n"), 0o644))
+
+	recorder = reload("ops-key")
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `line 2: \"not a domain\" isn't a domain, so the data in use was kept`)
+	require.Equal(t, loaded, advisor.CurrentData())
+}
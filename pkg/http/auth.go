@@ -0,0 +1,157 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/goccy/go-json"
+)
+
+type (
+	// APIKey grants a tenant access to the API. Everything stored via the API
+	// (such as schedules and their results) is owned by the caller's tenant,
+	// and is only visible to keys of the same tenant. Admin keys may also list
+	// every tenant's usage.
+	APIKey struct {
+		Key    string `json:"key" yaml:"key"`
+		Tenant string `json:"tenant" yaml:"tenant"`
+		Admin  bool   `json:"admin,omitempty" yaml:"admin,omitempty"`
+	}
+
+	// caller is the tenant (and privileges) a request was authenticated as.
+	caller struct {
+		tenant string
+		admin  bool
+	}
+
+	callerContextKey struct{}
+)
+
+// handleAuth authenticates each API request by the bearer token in its
+// Authorization header, attaching the key's tenant to the request's context.
+// Health probes, docs, the version and the schema don't require a key. If no
+// keys are configured, every request is an admin of the default tenant.
+func (s *Server) handleAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.APIKeys) == 0 {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerContextKey{}, caller{tenant: schedule.DefaultTenant, admin: true})))
+			return
+		}
+
+		if s.isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeUnauthorized(w, "an API key is required")
+			return
+		}
+
+		var authenticated *APIKey
+		for index := range s.APIKeys {
+			// compare every key in constant time, so the response time doesn't reveal how much of a key matched
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.APIKeys[index].Key)) == 1 {
+				authenticated = &s.APIKeys[index]
+			}
+		}
+
+		if authenticated == nil {
+			writeUnauthorized(w, "invalid API key")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerContextKey{}, caller{tenant: authenticated.Tenant, admin: authenticated.Admin})))
+	})
+}
+
+// isPublicPath reports whether the path is served without an API key.
+func (s *Server) isPublicPath(path string) bool {
+	switch {
+	case !strings.HasPrefix(path, s.apiPath+"/"):
+		// such as /metrics, and the redirect to the docs
+		return true
+	case strings.HasPrefix(path, s.apiPath+"/health/"), strings.HasPrefix(path, s.apiPath+"/docs"):
+		return true
+	}
+
+	return path == s.apiPath+"/version" || path == s.apiPath+"/schema"
+}
+
+// callerFromContext returns the caller attached to the context by handleAuth.
+func callerFromContext(ctx context.Context) caller {
+	if value, ok := ctx.Value(callerContextKey{}).(caller); ok {
+		return value
+	}
+
+	return caller{}
+}
+
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	response, err := json.Marshal(huma.Error401Unauthorized(message))
+	if err != nil {
+		http.Error(w, "an error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	_, _ = w.Write(response)
+}
+
+func (s *Server) registerTenantRoutes() {
+	type TenantUsage struct {
+		Tenant string `json:"tenant" doc:"The tenant's name." example:"default"`
+		schedule.Usage
+	}
+
+	type ListTenantsResponse struct {
+		Body struct {
+			Tenants []TenantUsage `json:"tenants" doc:"Every tenant with an API key or a schedule, sorted by name."`
+		}
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "list-tenants",
+		Summary:     "List tenants and their usage",
+		Description: "Requires an admin API key.",
+		Method:      http.MethodGet,
+		Path:        s.apiPath + "/tenants",
+		Tags:        []string{"Tenants"},
+	}, func(ctx context.Context, input *struct{}) (*ListTenantsResponse, error) {
+		if !callerFromContext(ctx).admin {
+			return nil, huma.Error403Forbidden("an admin API key is required")
+		}
+
+		usage := make(map[string]schedule.Usage)
+		for _, key := range s.APIKeys {
+			usage[key.Tenant] = schedule.Usage{}
+		}
+
+		if s.Scheduler != nil {
+			for tenant, tenantUsage := range s.Scheduler.Usage() {
+				usage[tenant] = tenantUsage
+			}
+		}
+
+		resp := ListTenantsResponse{}
+		resp.Body.Tenants = make([]TenantUsage, 0, len(usage))
+
+		for tenant, tenantUsage := range usage {
+			resp.Body.Tenants = append(resp.Body.Tenants, TenantUsage{Tenant: tenant, Usage: tenantUsage})
+		}
+
+		sort.Slice(resp.Body.Tenants, func(i, j int) bool {
+			return resp.Body.Tenants[i].Tenant < resp.Body.Tenants[j].Tenant
+		})
+
+		return &resp, nil
+	})
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth_Tenants(t *testing.T) {
+	store, err := schedule.OpenStore("")
+	require.NoError(t, err)
+
+	// the scheduler isn't run, so nothing is scanned
+	scheduler := schedule.New(zerolog.Nop(), store, func(context.Context, string) (*model.ScanResult, error) {
+		return nil, nil
+	})
+
+	// each subtest uses its own server, to stay within the rate limit
+	newServer := func() *Server {
+		server := NewServer(zerolog.Nop(), time.Second, "test")
+		server.APIKeys = []APIKey{
+			{Key: "acme-key", Tenant: "acme"},
+			{Key: "globex-key", Tenant: "globex"},
+			{Key: "ops-key", Tenant: "ops", Admin: true},
+		}
+		server.Scheduler = scheduler
+
+		return server
+	}
+
+	request := func(server *Server, method, path, key, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		server.Handler().ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		server := newServer()
+
+		recorder := request(server, http.MethodGet, "/api/v1/schedules", "", "")
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		require.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+
+		recorder = request(server, http.MethodGet, "/api/v1/schedules", "wrong-key", "")
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		require.Contains(t, recorder.Body.String(), "invalid API key")
+
+		// probes don't need a key
+		recorder = request(server, http.MethodGet, "/api/v1/health/live", "", "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	var created schedule.Schedule
+
+	t.Run("CrossTenant", func(t *testing.T) {
+		server := newServer()
+
+		recorder := request(server, http.MethodPost, "/api/v1/schedules", "acme-key", `{"domains":["example.com"],"interval":"6h"}`)
+		require.Equal(t, http.StatusCreated, recorder.Code)
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+		require.Equal(t, "acme", created.Tenant)
+
+		recorder = request(server, http.MethodGet, "/api/v1/schedules/"+created.ID, "globex-key", "")
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+
+		recorder = request(server, http.MethodDelete, "/api/v1/schedules/"+created.ID, "globex-key", "")
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+
+		recorder = request(server, http.MethodGet, "/api/v1/schedules", "globex-key", "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var listed struct{ Schedules []schedule.Schedule }
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listed))
+		require.Empty(t, listed.Schedules)
+
+		recorder = request(server, http.MethodGet, "/api/v1/schedules/"+created.ID, "acme-key", "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("Admin", func(t *testing.T) {
+		server := newServer()
+
+		recorder := request(server, http.MethodGet, "/api/v1/tenants", "acme-key", "")
+		require.Equal(t, http.StatusForbidden, recorder.Code)
+
+		recorder = request(server, http.MethodGet, "/api/v1/tenants", "ops-key", "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var listed struct {
+			Tenants []struct {
+				Tenant string
+				schedule.Usage
+			}
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listed))
+		require.Len(t, listed.Tenants, 3)
+		require.Equal(t, "acme", listed.Tenants[0].Tenant)
+		require.Equal(t, schedule.Usage{Schedules: 1, Domains: 1}, listed.Tenants[0].Usage)
+		require.Equal(t, "globex", listed.Tenants[1].Tenant)
+		require.Zero(t, listed.Tenants[1].Usage)
+		require.Equal(t, "ops", listed.Tenants[2].Tenant)
+	})
+}
@@ -0,0 +1,308 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// maxBulkWorkers is the most domains of a bulk request that are scanned at
+// once. Each domain holds its worker for at most its own timeout, so a slow
+// domain only holds up the domains queued behind its worker.
+const maxBulkWorkers = 20
+
+// maxBulkPending is the most results of a bulk request that are scanned ahead
+// of the one being emitted. Scanning waits for results to be emitted beyond
+// it, so a client reading a stream slowly holds up the scans, rather than
+// their results piling up in memory.
+const maxBulkPending = 5 * maxBulkWorkers
+
+// errBulkItemTimeout is the error of a bulk request's domain whose timeout
+// ran out before its records were looked up.
+const errBulkItemTimeout = "the domain's timeout ran out before its records were looked up"
+
+// bulkItem is a domain of a bulk request, with the request's options applied
+// to those it doesn't set.
+type bulkItem struct {
+	domain  string
+	options model.ScanOptions
+	timeout time.Duration
+
+	// name is the normalized domain, as it's scanned
+	name string
+
+	// key identifies the domain and its options, so repeats share a result
+	key string
+}
+
+// resolveBulkItems validates each domain of a bulk request and its options,
+// applying the request's options (and the selectors of its query) to those
+// that aren't set. It returns a single 400 error with a detail for every
+// invalid domain and option.
+func resolveBulkItems(request model.BulkScanRequest, selectors []string) ([]bulkItem, error) {
+	var (
+		details, optionDetails []error
+		items                  []bulkItem
+	)
+
+	checks := request.Checks
+	optionDetails = append(optionDetails, checkErrorDetails("body.checks", checks)...)
+
+	timeout, detail := timeoutErrorDetail("body.timeout", request.Timeout)
+	if detail != nil {
+		optionDetails = append(optionDetails, detail)
+	}
+
+	for index, entry := range request.Domains {
+		location := fmt.Sprintf("body.domains[%d]", index)
+
+		if detail := domainErrorDetail(location, entry.Domain); detail != nil {
+			details = append(details, detail)
+		}
+
+		item := bulkItem{domain: entry.Domain, options: model.ScanOptions{Selectors: selectors, Checks: checks, Timeout: request.Timeout}, timeout: timeout}
+
+		if len(entry.Selectors) > 0 {
+			item.options.Selectors = entry.Selectors
+			optionDetails = append(optionDetails, selectorErrorDetails(location+".selectors", entry.Selectors)...)
+		}
+
+		if len(entry.Checks) > 0 {
+			item.options.Checks = entry.Checks
+			optionDetails = append(optionDetails, checkErrorDetails(location+".checks", entry.Checks)...)
+		}
+
+		if entry.Timeout != "" {
+			item.options.Timeout = entry.Timeout
+
+			if item.timeout, detail = timeoutErrorDetail(location+".timeout", entry.Timeout); detail != nil {
+				optionDetails = append(optionDetails, detail)
+			}
+		}
+
+		item.name = scanner.NormalizeDomain(item.domain)
+		item.key = strings.Join([]string{
+			item.name,
+			strings.Join(item.options.Selectors, ","),
+			strings.Join(item.options.Checks, ","),
+			item.timeout.String(),
+		}, "|")
+
+		items = append(items, item)
+	}
+
+	if len(optionDetails) > 0 {
+		return nil, huma.Error400BadRequest("invalid scan options", append(details, optionDetails...)...)
+	}
+
+	if len(details) > 0 {
+		return nil, huma.Error400BadRequest(scanner.ErrInvalidDomain, details...)
+	}
+
+	return items, nil
+}
+
+// selectorErrorDetails validates a domain's DKIM selectors, returning an
+// error detail for each invalid selector, or for there being too many.
+func selectorErrorDetails(location string, selectors []string) []error {
+	if len(selectors) > maxDKIMSelectors {
+		return []error{&huma.ErrorDetail{Location: location, Message: fmt.Sprintf("expected at most %d selectors", maxDKIMSelectors), Value: selectors}}
+	}
+
+	var details []error
+
+	for index, selector := range selectors {
+		if err := scanner.ValidateDKIMSelector(selector); err != nil {
+			details = append(details, &huma.ErrorDetail{Location: fmt.Sprintf("%s[%d]", location, index), Message: err.Error(), Value: selector})
+		}
+	}
+
+	return details
+}
+
+// checkErrorDetails returns an error detail for each check that isn't one of
+// advisor.Checks.
+func checkErrorDetails(location string, checks []string) []error {
+	var details []error
+
+	for index, check := range checks {
+		if err := advisor.ValidateCheck(check); err != nil {
+			details = append(details, &huma.ErrorDetail{Location: fmt.Sprintf("%s[%d]", location, index), Message: err.Error(), Value: check})
+		}
+	}
+
+	return details
+}
+
+// timeoutErrorDetail parses a timeout, returning an error detail if it isn't
+// a positive duration. An empty timeout is 0, leaving the checks bounded by
+// the advisor's own timeout.
+func timeoutErrorDetail(location, value string) (time.Duration, *huma.ErrorDetail) {
+	if value == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, &huma.ErrorDetail{Location: location, Message: "expected a positive duration, formatted as in 30s or 2m", Value: value}
+	}
+
+	return timeout, nil
+}
+
+// scanBulk scans and advises on each domain of a bulk request with its own
+// options, calling emit with each result in the request's order, as soon as
+// it and every result before it are ready, until emit returns false. Up to
+// maxBulkWorkers domains are scanned at once, and each domain's lookups and
+// checks are bounded by its timeout, and stop once the request's context is
+// done. Repeated domains with the same options share a single result,
+// and their repeats are marked as deduplicated. Domains are scanned at most
+// maxBulkPending ahead of the one being emitted, and each result is dropped
+// once it (and its last repeat) has been emitted.
+func (s *Server) scanBulk(ctx context.Context, items []bulkItem, detailed, assumeParked bool, schemaVersion int, emit func(result model.ScanResult) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	// the index of each item's first occurrence, whose result its repeats share, and of its last
+	first := make([]int, len(items))
+	last := make([]int, len(items))
+	firstByKey := make(map[string]int, len(items))
+
+	var unique []int
+
+	for index, item := range items {
+		if previous, ok := firstByKey[item.key]; ok {
+			first[index] = previous
+			last[previous] = index
+
+			continue
+		}
+
+		firstByKey[item.key] = index
+		first[index] = index
+		last[index] = index
+		unique = append(unique, index)
+	}
+
+	var (
+		results = make([]model.ScanResult, len(items))
+		errs    = make([]error, len(items))
+		done    = make([]chan struct{}, len(items))
+		jobs    = make(chan int)
+		pending = make(chan struct{}, maxBulkPending)
+		wg      sync.WaitGroup
+	)
+
+	for _, index := range unique {
+		done[index] = make(chan struct{})
+	}
+
+	for range min(maxBulkWorkers, len(unique)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for index := range jobs {
+				results[index], errs[index] = s.scanBulkItem(ctx, items[index], detailed, assumeParked, schemaVersion)
+				close(done[index])
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+
+		for _, index := range unique {
+			// unique domains are emitted in the order they're scanned, so the slot is freed by the first one's emission
+			select {
+			case pending <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case jobs <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// the remaining domains are abandoned once a result can't be emitted, but the workers are still waited for, so
+	// none outlives the request
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for index := range items {
+		select {
+		case <-done[first[index]]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := errs[first[index]]; err != nil {
+			return err
+		}
+
+		result := results[first[index]]
+		result.Deduplicated = index != first[index]
+
+		if index == first[index] {
+			<-pending
+		}
+
+		if index == last[first[index]] {
+			results[first[index]] = model.ScanResult{}
+		}
+
+		if !emit(result) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// scanBulkItem scans and advises on a single domain of a bulk request,
+// echoing its options in the result. A domain whose timeout runs out before
+// its records are looked up has a result with only its error.
+func (s *Server) scanBulkItem(ctx context.Context, item bulkItem, detailed, assumeParked bool, schemaVersion int) (model.ScanResult, error) {
+	requestCtx := ctx
+	ctx = advisor.ContextWithChecks(ctx, item.options.Checks...)
+
+	if item.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, item.timeout)
+		defer cancel()
+	}
+
+	var res model.ScanResult
+
+	results, err := s.scan(ctx, item.options.Selectors, item.domain)
+	switch {
+	case err != nil && requestCtx.Err() == nil && errors.Is(err, context.DeadlineExceeded):
+		res = model.NewScanResult(&scanner.Result{Domain: item.name, Error: errBulkItemTimeout}, nil, detailed)
+	case err != nil:
+		return model.ScanResult{}, err
+	case len(results) != 1:
+		return model.ScanResult{}, fmt.Errorf("expected 1 result, got %d", len(results))
+	default:
+		res = s.adviseResult(ctx, results[0], detailed, assumeParked)
+	}
+
+	options := item.options
+	res.Options = &options
+	res, _ = res.Versioned(schemaVersion)
+
+	return res, nil
+}
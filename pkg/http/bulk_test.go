@@ -0,0 +1,280 @@
+package http
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/dss"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// hangingDialer never connects, returning once the context is done.
+type hangingDialer struct{}
+
+func (hangingDialer) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestScan_MixedBulkRequest(t *testing.T) {
+	// every domain receives mail, so none is assumed to be parked
+	var zone strings.Builder
+	for _, domain := range []string{"example.com", "example.org", "example.net", "example.info"} {
+		zone.WriteString(domain + ". 300 IN MX 10 mx." + domain + ".\n")
+		zone.WriteString(domain + ". 300 IN TXT \"v=spf1 mx -all\"\n")
+		zone.WriteString("mx." + domain + ". 300 IN A 192.0.2.25\n")
+	}
+
+	resolver, err := dss.NewZoneResolver(zone.String())
+	require.NoError(t, err)
+
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver { return resolver }))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	// the TLS checks are off by default, and would hang for the advisor's 10s timeout if a domain's own didn't end them
+	server.Advisor = advisor.NewAdvisor(10*time.Second, 0, false, advisor.WithDialer(hangingDialer{}), advisor.WithHostResolver(resolver), advisor.WithProxy(advisor.ProxyConfig{}))
+	t.Cleanup(server.Advisor.Close)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		server.Handler().ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	body := `{"domains":[
+		"example.com",
+		{"domain":"example.org","selectors":["mail2023"]},
+		{"domain":"example.net","checks":["tls"],"timeout":"200ms"},
+		{"domain":"example.info","checks":["tls","offline"]},
+		"Example.com."
+	],"timeout":"5s"}`
+
+	start := time.Now()
+	recorder := post("/api/v1/scan?selector=s1", body)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Less(t, time.Since(start), 5*time.Second, "the hanging TLS check must be ended by its domain's timeout")
+
+	var response model.BulkScanResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Len(t, response.Results, 5)
+
+	// the request's selectors and timeout apply to the domains that don't set their own
+	require.Equal(t, &model.ScanOptions{Selectors: []string{"s1"}, Timeout: "5s"}, response.Results[0].Options)
+	require.Equal(t, []scanner.DKIMSelectorCheck{{Selector: "s1", Found: false}}, response.Results[0].ScanResult.DKIMSelectorChecks)
+
+	require.Equal(t, &model.ScanOptions{Selectors: []string{"mail2023"}, Timeout: "5s"}, response.Results[1].Options)
+	require.Equal(t, []scanner.DKIMSelectorCheck{{Selector: "mail2023", Found: false}}, response.Results[1].ScanResult.DKIMSelectorChecks)
+
+	require.Equal(t, &model.ScanOptions{Selectors: []string{"s1"}, Checks: []string{"tls"}, Timeout: "200ms"}, response.Results[2].Options)
+	require.Equal(t, advisor.ErrorKindTimeout, response.Results[2].Errors["domain_check"].Kind)
+	require.Equal(t, advisor.ErrorKindTimeout, response.Results[2].Errors["mx_check"].Kind)
+
+	require.Equal(t, []string{"The TLS check of your domain was skipped: offline mode."}, response.Results[3].Advice.Domain)
+	require.Empty(t, response.Results[3].Errors)
+
+	require.False(t, response.Results[0].Deduplicated)
+	require.True(t, response.Results[4].Deduplicated)
+	require.Equal(t, "example.com", response.Results[4].Domain)
+
+	t.Run("Stream", func(t *testing.T) {
+		recorder := post("/api/v1/scan/stream", `{"domains":["example.com",{"domain":"example.org","checks":["offline"]}]}`)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		require.Len(t, lines, 2)
+
+		var result model.ScanResult
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &result))
+		require.Equal(t, "example.org", result.Domain)
+		require.Equal(t, &model.ScanOptions{Checks: []string{"offline"}}, result.Options)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		recorder := post("/api/v1/scan", `{"domains":[
+			"example.com",
+			{"domain":"http//example","selectors":["mail@2023"]},
+			{"domain":"example.net","checks":["dmarc"],"timeout":"-1s"},
+			{"domain":"example.info","selectors":["a","b","c","d","e","f"]}
+		],"timeout":"soon"}`)
+		require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+
+		var problem huma.ErrorModel
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+
+		locations := make([]string, 0, len(problem.Errors))
+		for _, detail := range problem.Errors {
+			locations = append(locations, detail.Location)
+		}
+
+		require.Equal(t, []string{"body.domains[1]", "body.timeout", "body.domains[1].selectors[0]", "body.domains[2].checks[0]", "body.domains[2].timeout", "body.domains[3].selectors"}, locations)
+		require.Equal(t, `unknown check "dmarc", expected one of [offline tls]`, problem.Errors[3].Message)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		require.Equal(t, http.StatusUnprocessableEntity, post("/api/v1/scan", `{"domains":[42]}`).Code)
+		require.Equal(t, http.StatusUnprocessableEntity, post("/api/v1/scan", `{"domains":[{"selectors":["s1"]}]}`).Code)
+	})
+}
+
+func TestScan_StreamCSV(t *testing.T) {
+	resolver, err := dss.NewZoneResolver("example.com. 300 IN TXT \"v=spf1 -all\"\nexample.org. 300 IN TXT \"v=spf1 mx -all\"\n")
+	require.NoError(t, err)
+
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver { return resolver }))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/scan/stream?format=csv", strings.NewReader(`{"domains":["example.com","example.org"],"checks":["offline"]}`))
+	request.Header.Set("Content-Type", "application/json")
+	server.Handler().ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, model.CSVHeader(), rows[0])
+	require.Equal(t, []string{"example.com", "v=spf1 -all"}, []string{rows[1][0], rows[1][5]})
+	require.Equal(t, []string{"example.org", "v=spf1 mx -all"}, []string{rows[2][0], rows[2][5]})
+}
+
+func TestScanBulk_Backpressure(t *testing.T) {
+	network := testnet.New(t)
+
+	// scanned counts the domains whose NS records were looked up, which every scan starts with
+	scanned := func() int {
+		return network.Resolver.ExchangesWhere(func(_ string, recordType uint16) bool { return recordType == dns.TypeNS })
+	}
+
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver { return network.Resolver }))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	request := model.BulkScanRequest{Checks: []string{"offline"}}
+	for index := range 10 * maxBulkPending {
+		request.Domains = append(request.Domains, model.BulkScanDomain{Domain: fmt.Sprintf("domain-%d.example.com", index)})
+	}
+
+	items, err := resolveBulkItems(request, nil)
+	require.NoError(t, err)
+
+	// the client stops reading after the first result, until it's released
+	release := make(chan struct{})
+	emitted := 0
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.scanBulk(context.Background(), items, false, false, 0, func(model.ScanResult) bool {
+			if emitted++; emitted == 1 {
+				<-release
+			}
+
+			return true
+		})
+	}()
+
+	require.Eventually(t, func() bool { return scanned() >= maxBulkPending }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	// the scans stop once they're maxBulkPending ahead of the blocked result, rather than running through every domain
+	require.LessOrEqual(t, scanned(), maxBulkPending+maxBulkWorkers)
+
+	close(release)
+	require.NoError(t, <-done)
+	require.Equal(t, len(items), emitted)
+	require.Equal(t, len(items), scanned())
+}
+
+func TestScanBulk_Cancelled(t *testing.T) {
+	// each domain's NS lookup, which every scan starts with, answers after the request is cancelled
+	network := testnet.New(t)
+
+	request := model.BulkScanRequest{Checks: []string{"offline"}}
+	for index := range 2 * maxBulkWorkers {
+		domain := fmt.Sprintf("domain-%d.example.com", index)
+		network.Resolver.Answer(domain, dns.TypeNS, testnet.Answer{Records: []string{domain + ". 300 IN NS ns1.example.com."}, Delay: 100 * time.Millisecond})
+		request.Domains = append(request.Domains, model.BulkScanDomain{Domain: domain})
+	}
+
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver { return network.Resolver }))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	items, err := resolveBulkItems(request, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	err = server.scanBulk(ctx, items, false, false, 0, func(model.ScanResult) bool { return true })
+	require.ErrorIs(t, err, context.Canceled)
+
+	// the scans that had started stopped at their NS lookups, and the rest never started
+	require.Zero(t, network.Resolver.ExchangesWhere(func(_ string, recordType uint16) bool { return recordType != dns.TypeNS }))
+	require.LessOrEqual(t, network.Resolver.ExchangesWhere(func(string, uint16) bool { return true }), maxBulkWorkers)
+}
+
+func TestScanBulk_ItemTimeout(t *testing.T) {
+	network := testnet.New(t)
+	network.Resolver.
+		Answer("slow.example.com", dns.TypeNS, testnet.Answer{Records: []string{"slow.example.com. 300 IN NS ns1.example.com."}, Delay: 100 * time.Millisecond}).
+		Records("example.com. 300 IN NS ns1.example.com.")
+
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver { return network.Resolver }))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	items, err := resolveBulkItems(model.BulkScanRequest{Checks: []string{"offline"}, Domains: []model.BulkScanDomain{
+		{Domain: "Slow.example.com.", ScanOptions: model.ScanOptions{Timeout: "20ms"}},
+		{Domain: "example.com"},
+	}}, nil)
+	require.NoError(t, err)
+
+	var results []model.ScanResult
+	require.NoError(t, server.scanBulk(context.Background(), items, false, false, 0, func(result model.ScanResult) bool {
+		results = append(results, result)
+		return true
+	}))
+
+	// the slow domain's timeout ran out during its lookups, which only fails its own result
+	require.Len(t, results, 2)
+	require.Equal(t, "slow.example.com", results[0].ScanResult.Domain)
+	require.Equal(t, errBulkItemTimeout, results[0].ScanResult.Error)
+	require.Equal(t, "20ms", results[0].Options.Timeout)
+	require.Empty(t, results[1].ScanResult.Error)
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+func (s *Server) registerCacheRoutes() {
+	type FlushCacheRequest struct {
+		Namespace string `path:"namespace" maxLength:"64" example:"mail_tls" doc:"The cache namespace to flush: host_tls, mail_tls, mail_certificates, mail_domains, certificates, registrations or security_contacts."`
+	}
+
+	type InvalidateCacheRequest struct {
+		Domain string `query:"domain" required:"true" maxLength:"255" example:"example.com" doc:"The domain or host whose cache entries are removed."`
+	}
+
+	type InvalidateCacheResponse struct {
+		Body struct {
+			Domain  string         `json:"domain" doc:"The domain or host whose cache entries were removed." example:"example.com"`
+			Removed map[string]int `json:"removed" doc:"The number of entries removed from each cache that had any: the scan results, and each of the advisor's namespaces."`
+		}
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "invalidate-cache",
+		Summary:     "Invalidate a domain's cache entries",
+		Description: "Removes every cache entry related to the domain or host, so its next scan looks up its records and probes its servers afresh: its scan results, the TLS advice for its web and mail servers, and the advice for its DMARC report destinations. A mail server shared with other domains is probed afresh for them too. Requires an admin API key.",
+		Method:      http.MethodDelete,
+		Path:        s.apiPath + "/cache",
+		Tags:        []string{"Cache"},
+	}, func(ctx context.Context, input *InvalidateCacheRequest) (*InvalidateCacheResponse, error) {
+		if !callerFromContext(ctx).admin {
+			return nil, huma.Error403Forbidden("an admin API key is required")
+		}
+
+		resp := InvalidateCacheResponse{}
+		resp.Body.Domain = input.Domain
+		resp.Body.Removed = make(map[string]int)
+
+		if s.Advisor != nil {
+			resp.Body.Removed = s.Advisor.InvalidateDomain(input.Domain)
+		}
+
+		if s.Scanner != nil {
+			if removed := s.Scanner.InvalidateDomain(input.Domain); removed > 0 {
+				resp.Body.Removed["results"] = removed
+			}
+		}
+
+		return &resp, nil
+	})
+
+	huma.Register(s.router, huma.Operation{
+		OperationID:   "flush-cache",
+		Summary:       "Flush a cache namespace",
+		Description:   "Removes every entry of the advisor's cache namespace, so the next scans check afresh, such as once a server's certificate has been replaced. Requires an admin API key.",
+		Method:        http.MethodDelete,
+		Path:          s.apiPath + "/cache/{namespace}",
+		DefaultStatus: http.StatusNoContent,
+		Tags:          []string{"Cache"},
+	}, func(ctx context.Context, input *FlushCacheRequest) (*struct{}, error) {
+		if !callerFromContext(ctx).admin {
+			return nil, huma.Error403Forbidden("an admin API key is required")
+		}
+
+		if s.Advisor == nil {
+			return nil, huma.Error404NotFound("the advisor is not enabled")
+		}
+
+		if err := s.Advisor.FlushCache(input.Namespace); err != nil {
+			return nil, huma.Error404NotFound(err.Error())
+		}
+
+		return nil, nil
+	})
+}
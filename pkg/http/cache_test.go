@@ -0,0 +1,113 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_Flush(t *testing.T) {
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.APIKeys = []APIKey{
+		{Key: "acme-key", Tenant: "acme"},
+		{Key: "ops-key", Tenant: "ops", Admin: true},
+	}
+
+	request := func(path, key string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		server.Handler().ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := request("/api/v1/cache/mail_tls", "ops-key")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "the advisor is not enabled")
+
+	server.Advisor = advisor.NewAdvisor(time.Second, time.Minute, false)
+	t.Cleanup(server.Advisor.Close)
+
+	recorder = request("/api/v1/cache/mail_tls", "acme-key")
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = request("/api/v1/cache/mail_tls", "ops-key")
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	// the certificates are only cached if the check is enabled
+	recorder = request("/api/v1/cache/certificates", "ops-key")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `unknown cache namespace \"certificates\"`)
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithNameservers([]string{startSlowDNSServer(t, 0, nil)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	// the requests stay within the rate limit
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	request := func(method, target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+
+		return recorder
+	}
+
+	// the plain scan and the scan at a selector are cached separately
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "/api/v1/scan/example.com").Code)
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "/api/v1/scan/example.com?selector=mail2023").Code)
+
+	invalidate := func(domain string) map[string]int {
+		recorder := request(http.MethodDelete, "/api/v1/cache?domain="+domain)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var resp struct {
+			Domain  string         `json:"domain"`
+			Removed map[string]int `json:"removed"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		require.Equal(t, domain, resp.Domain)
+
+		return resp.Removed
+	}
+
+	require.Equal(t, map[string]int{"results": 2}, invalidate("example.com"))
+	require.Empty(t, invalidate("example.com"))
+
+	require.Equal(t, http.StatusUnprocessableEntity, request(http.MethodDelete, "/api/v1/cache").Code)
+}
+
+func TestCache_InvalidateAdmin(t *testing.T) {
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.APIKeys = []APIKey{
+		{Key: "acme-key", Tenant: "acme"},
+		{Key: "ops-key", Tenant: "ops", Admin: true},
+	}
+
+	request := func(key string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/cache?domain=example.com", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		server.Handler().ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	// the cache is shared by every tenant, so only admin keys may invalidate its entries
+	recorder := request("acme-key")
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "an admin API key is required")
+
+	require.Equal(t, http.StatusOK, request("ops-key").Code)
+}
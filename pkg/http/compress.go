@@ -0,0 +1,228 @@
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultCompressMinSize is the smallest response compressed by default, in
+// bytes. Smaller responses would barely shrink, and may even grow.
+const DefaultCompressMinSize = 1024
+
+// compressWriter compresses a response with the negotiated encoding, once it
+// reaches the minimum size. Until then, the response is buffered, so a small
+// response is sent as it is.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	buffer  []byte
+	status  int
+	decided bool
+	writer  io.WriteCloser
+}
+
+// handleCompression compresses responses with gzip or deflate, as negotiated
+// with the request's Accept-Encoding header, unless they're smaller than the
+// server's CompressMinSize (or it's negative, which disables compression).
+func (s *Server) handleCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.CompressMinSize < 0 || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: s.CompressMinSize}
+		defer writer.Close()
+
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// negotiateEncoding returns the encoding (gzip or deflate) to compress the
+// response with, as preferred by the Accept-Encoding header, or an empty
+// string if the client accepts neither. Ties are broken in favor of gzip.
+func negotiateEncoding(header string) string {
+	var (
+		best    string
+		quality float64
+	)
+
+	for _, value := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(value), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+
+			q = parsed
+		}
+
+		if coding == "*" {
+			coding = "gzip"
+		}
+
+		if (coding != "gzip" && coding != "deflate") || q <= 0 {
+			continue
+		}
+
+		if q > quality || (q == quality && coding == "gzip") {
+			best, quality = coding, q
+		}
+	}
+
+	return best
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	// informational responses precede the real one
+	if w.decided || status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if w.status != 0 {
+		return
+	}
+
+	w.status = status
+
+	// responses without a body can't be compressed
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		_ = w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buffer = append(w.buffer, data...)
+		if len(w.buffer) < w.minSize {
+			return len(data), nil
+		}
+
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+
+		return len(data), nil
+	}
+
+	if w.writer != nil {
+		return w.writer.Write(data)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush sends what's been written so far, compressing it, as a response
+// that's flushed before it reaches the minimum size (such as a stream) is
+// likely to grow.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(len(w.buffer) > 0)
+	}
+
+	if flusher, ok := w.writer.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close sends a response that never reached the minimum size as it is, and
+// completes a compressed one.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		return w.decide(false)
+	}
+
+	if w.writer != nil {
+		return w.writer.Close()
+	}
+
+	return nil
+}
+
+// Hijack allows the connection to be taken over, if it hasn't been written
+// to yet.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok || w.decided || len(w.buffer) > 0 {
+		return nil, nil, errors.New("the response can't be hijacked")
+	}
+
+	w.decided = true
+
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the response's header, compressing the rest of the response
+// if compress is set (and it isn't already encoded), then writes what's been
+// buffered.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		compress = false
+	}
+
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+
+		// the deflate content coding is the zlib format (RFC 9110 section 8.4.1.2)
+		if w.encoding == "gzip" {
+			w.writer = gzip.NewWriter(w.ResponseWriter)
+		} else {
+			w.writer = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+
+	buffer := w.buffer
+	w.buffer = nil
+
+	if len(buffer) == 0 {
+		return nil
+	}
+
+	if w.writer != nil {
+		_, err := w.writer.Write(buffer)
+		return err
+	}
+
+	_, err := w.ResponseWriter.Write(buffer)
+
+	return err
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                             "",
+		"identity":                     "",
+		"gzip":                         "gzip",
+		"deflate":                      "deflate",
+		"deflate, gzip":                "gzip",
+		"gzip;q=0.5, deflate":          "deflate",
+		"GZIP;q=0, deflate;q=0.1":      "deflate",
+		"br, *;q=0.8":                  "gzip",
+		"gzip;q=0, deflate;q=0, br":    "",
+		"gzip;q=invalid, deflate;q=.2": "deflate",
+	}
+
+	for header, expected := range tests {
+		require.Equal(t, expected, negotiateEncoding(header), header)
+	}
+}
+
+func TestServer_Compression(t *testing.T) {
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	uncompressed := get("/api/v1/schema", "")
+	require.Equal(t, http.StatusOK, uncompressed.Code)
+	require.Empty(t, uncompressed.Header().Get("Content-Encoding"))
+	require.Greater(t, uncompressed.Body.Len(), DefaultCompressMinSize)
+
+	for encoding, reader := range map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+	} {
+		t.Run(encoding, func(t *testing.T) {
+			recorder := get("/api/v1/schema", encoding)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			require.Equal(t, encoding, recorder.Header().Get("Content-Encoding"))
+			require.Contains(t, recorder.Header().Values("Vary"), "Accept-Encoding")
+			require.Less(t, recorder.Body.Len(), uncompressed.Body.Len())
+
+			decompressed, err := reader(recorder.Body)
+			require.NoError(t, err)
+
+			body, err := io.ReadAll(decompressed)
+			require.NoError(t, err)
+			require.Equal(t, uncompressed.Body.String(), string(body))
+		})
+	}
+
+	t.Run("Small", func(t *testing.T) {
+		// the health check is far smaller than the minimum, so it's sent as it is
+		recorder := get("/api/v1/health/live", "gzip")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Empty(t, recorder.Header().Get("Content-Encoding"))
+		require.Contains(t, recorder.Body.String(), `"status":"ok"`)
+	})
+}
+
+func TestServer_CompressedStream(t *testing.T) {
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithNameservers([]string{startSlowDNSServer(t, 0, nil)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	// the transport asks for gzip and decompresses the response itself, as the Go client does
+	response, err := http.Post(httpServer.URL+"/api/v1/scan/stream", "application/json", strings.NewReader(`{"domains":["example.com","example.org"]}`))
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.True(t, response.Uncompressed, "want the stream to be compressed")
+
+	var domains []string
+
+	lines := bufio.NewScanner(response.Body)
+	for lines.Scan() {
+		var result model.ScanResult
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &result))
+		domains = append(domains, result.Domain)
+	}
+
+	require.NoError(t, lines.Err())
+	require.Equal(t, []string{"example.com", "example.org"}, domains)
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/goccy/go-json"
+)
+
+const (
+	// DefaultMaxBodySize is the largest request body accepted by default, in
+	// bytes.
+	DefaultMaxBodySize = 1 << 20
+
+	// DefaultMaxDomains is the most domains a bulk scan may request by
+	// default.
+	DefaultMaxDomains = 20
+)
+
+// handleBodyLimit rejects requests whose body is larger than the server's
+// MaxBodySize with a 413, before the body is decoded. Bodies of unknown
+// length are read up to the limit, so they're never read in full.
+func (s *Server) handleBodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.MaxBodySize <= 0 || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > s.MaxBodySize {
+			writeBodyTooLarge(w, s.MaxBodySize)
+			return
+		}
+
+		if r.ContentLength < 0 {
+			body, err := io.ReadAll(io.LimitReader(r.Body, s.MaxBodySize+1))
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+
+			if int64(len(body)) > s.MaxBodySize {
+				writeBodyTooLarge(w, s.MaxBodySize)
+				return
+			}
+
+			r.Body, r.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeBodyTooLarge writes the 413 response of a request whose body is larger
+// than the limit, as problem+json like the API's other errors.
+func writeBodyTooLarge(w http.ResponseWriter, limit int64) {
+	response, err := json.Marshal(huma.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is too large, the limit is %d bytes", limit)))
+	if err != nil {
+		http.Error(w, "an error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	_, _ = w.Write(response)
+}
+
+// validateDomainCount returns a 422 error if a bulk request has more domains
+// than the server's MaxDomains, regardless of how few bytes they take.
+func (s *Server) validateDomainCount(count int) error {
+	if s.MaxDomains <= 0 || count <= s.MaxDomains {
+		return nil
+	}
+
+	message := fmt.Sprintf("expected at most %d domains, got %d", s.MaxDomains, count)
+
+	return huma.Error422UnprocessableEntity("too many domains", &huma.ErrorDetail{Location: "body.domains", Message: message, Value: count})
+}
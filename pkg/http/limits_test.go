@@ -0,0 +1,113 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkBody returns a bulk scan request body of count invalid domains, so
+// requests within the limits are rejected by domain validation instead.
+func bulkBody(count int) string {
+	domains := make([]string, count)
+	for index := range domains {
+		domains[index] = fmt.Sprintf(`"-%d.example.com"`, index)
+	}
+
+	return `{"domains":[` + strings.Join(domains, ",") + `]}`
+}
+
+func TestServer_BodyLimit(t *testing.T) {
+	post := func(server *Server, body io.Reader, contentLength int64) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		request.Header.Set("Content-Type", "application/json")
+		request.ContentLength = contentLength
+
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.MaxBodySize, server.MaxDomains = 1024, 0
+
+	t.Run("Within", func(t *testing.T) {
+		body := bulkBody(50)
+		require.Less(t, len(body), 1024)
+		require.Equal(t, http.StatusBadRequest, post(server, strings.NewReader(body), int64(len(body))).Code)
+	})
+
+	for name, chunked := range map[string]bool{"ContentLength": false, "Chunked": true} {
+		t.Run(name, func(t *testing.T) {
+			body := bulkBody(100)
+
+			// a body of unknown length is read up to the limit instead
+			contentLength := int64(len(body))
+			if chunked {
+				contentLength = -1
+			}
+
+			recorder := post(server, strings.NewReader(body), contentLength)
+			require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+			require.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+
+			var problem huma.ErrorModel
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			require.Equal(t, http.StatusRequestEntityTooLarge, problem.Status)
+			require.Equal(t, "request body is too large, the limit is 1024 bytes", problem.Detail)
+		})
+	}
+
+	t.Run("AboveDefault", func(t *testing.T) {
+		// the limit replaces the framework's own, so larger bodies can be allowed
+		large := NewServer(zerolog.Nop(), time.Second, "test")
+		large.MaxBodySize, large.MaxDomains = 4<<20, 0
+
+		body := bulkBody(80000)
+		require.Greater(t, len(body), DefaultMaxBodySize)
+		require.Equal(t, http.StatusBadRequest, post(large, strings.NewReader(body), int64(len(body))).Code)
+	})
+}
+
+func TestServer_DomainLimit(t *testing.T) {
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	for _, path := range []string{"/api/v1/scan", "/api/v1/scan/stream"} {
+		t.Run("TooMany"+path, func(t *testing.T) {
+			// the body is far below the byte limit, but has too many domains
+			recorder := post(path, bulkBody(DefaultMaxDomains+1))
+			require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+			var problem huma.ErrorModel
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			require.Len(t, problem.Errors, 1)
+			require.Equal(t, "body.domains", problem.Errors[0].Location)
+			require.Equal(t, "expected at most 20 domains, got 21", problem.Errors[0].Message)
+		})
+	}
+
+	t.Run("Raised", func(t *testing.T) {
+		server.MaxDomains = 50
+		require.Equal(t, http.StatusBadRequest, post("/api/v1/scan", bulkBody(21)).Code)
+	})
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+func (s *Server) registerReportRoutes() {
+	type SummaryRequest struct {
+		Job       string `query:"job" required:"true" maxLength:"64" example:"5f2b6c2d9a1e4f07" doc:"The ID of the schedule whose latest results are summarized, as schedules are the server's asynchronous scans."`
+		Offenders int    `query:"offenders" minimum:"1" maximum:"100" default:"10" doc:"The number of worst offenders to rank by score."`
+	}
+
+	type SummaryResponse struct {
+		Body *model.Summary
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "get-summary-report",
+		Summary:     "Summarize the latest results of a scheduled scan",
+		Description: "Rolls up the latest result of each of the schedule's domains into the number of domains at each DMARC policy level, without SPF, and at each lowest TLS version, along with the worst offenders by score, as dss summarize does for a bulk scan's results.",
+		Method:      http.MethodGet,
+		Path:        s.apiPath + "/reports/summary",
+		Tags:        []string{"Reports"},
+	}, func(ctx context.Context, input *SummaryRequest) (*SummaryResponse, error) {
+		if s.Scheduler == nil {
+			return nil, huma.Error404NotFound("scheduling is not enabled")
+		}
+
+		_, results, ok := s.Scheduler.Get(callerFromContext(ctx).tenant, input.Job)
+		if !ok {
+			return nil, huma.Error404NotFound("schedule not found")
+		}
+
+		summary := model.NewSummary(input.Offenders)
+		for _, result := range results {
+			summary.Add(result)
+		}
+
+		return &SummaryResponse{Body: summary}, nil
+	})
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReports_Summary(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		server := NewServer(zerolog.Nop(), time.Second, "test")
+
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/reports/summary?job=5f2b6c2d9a1e4f07", nil))
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+		require.Contains(t, recorder.Body.String(), "scheduling is not enabled")
+	})
+
+	store, err := schedule.OpenStore("")
+	require.NoError(t, err)
+
+	// the scheduler isn't run, so the results are stored as if it had
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scheduler = schedule.New(zerolog.Nop(), store, func(context.Context, string) (*model.ScanResult, error) {
+		return nil, nil
+	})
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		server.Handler().ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := request(http.MethodPost, "/api/v1/schedules", `{"domains":["example.com","example.org"],"interval":"6h"}`)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var created schedule.Schedule
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	require.NoError(t, store.PutResults(created.Tenant, created.ID, map[string]*model.ScanResult{
+		"example.com": {Domain: "example.com", ScanResult: &scanner.Result{Domain: "example.com", DMARC: "v=DMARC1; p=reject", SPF: "v=spf1 -all"}, Advice: &advisor.Advice{}},
+		"example.org": {Domain: "example.org", ScanResult: &scanner.Result{Domain: "example.org"}, Advice: &advisor.Advice{DMARC: []string{"You do not have DMARC setup!"}}},
+	}))
+
+	recorder = request(http.MethodGet, "/api/v1/reports/summary?job="+created.ID+"&offenders=1", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var summary model.Summary
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &summary))
+	require.Equal(t, 2, summary.Domains)
+	require.Equal(t, 1, summary.MissingSPF)
+	require.Equal(t, map[string]int{"reject": 1, "quarantine": 0, "none": 0, "missing": 1}, summary.DMARCPolicies)
+	require.Equal(t, []model.SummaryDomain{{Domain: "example.org", Score: 75, Findings: map[string]int{"critical": 1}}}, summary.WorstOffenders)
+
+	recorder = request(http.MethodGet, "/api/v1/reports/summary?job=missing", "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "schedule not found")
+
+	recorder = request(http.MethodGet, "/api/v1/reports/summary", "")
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+}
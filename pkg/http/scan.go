@@ -2,22 +2,79 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/export"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
 	"github.com/danielgtaylor/huma/v2"
 )
 
+// maxDKIMSelectors is the most selectors a single scan request may supply.
+const maxDKIMSelectors = 5
+
+const (
+	// maxStreamBuffer is the most bytes of a streamed response buffered for
+	// each connection. Scanning is held up once it's full, until the client
+	// reads more.
+	maxStreamBuffer = 64 << 10
+
+	// streamFlushInterval is how long a streamed result is buffered for at
+	// most before it's sent to the client.
+	streamFlushInterval = 250 * time.Millisecond
+)
+
+// DKIMSelectorQuery is the selector query parameter of the scan routes, which
+// may be repeated (or comma-separated) to supply the only DKIM selectors to
+// look up.
+type DKIMSelectorQuery struct {
+	Selectors []string `query:"selector" maxItems:"5" example:"mail2023" doc:"Only look up DKIM keys at these selectors (skipping the common selectors), reporting whether a key was found at each. May be repeated."`
+}
+
+// Resolve collects every value of the repeated selector parameter, as only
+// the first is parsed otherwise, and validates each selector.
+func (q *DKIMSelectorQuery) Resolve(ctx huma.Context) []error {
+	requestURL := ctx.URL()
+
+	q.Selectors = nil
+	for _, value := range requestURL.Query()["selector"] {
+		q.Selectors = append(q.Selectors, strings.Split(value, ",")...)
+	}
+
+	if len(q.Selectors) > maxDKIMSelectors {
+		return []error{&huma.ErrorDetail{Location: "query.selector", Message: fmt.Sprintf("expected at most %d selectors", maxDKIMSelectors), Value: q.Selectors}}
+	}
+
+	var errs []error
+
+	for index, selector := range q.Selectors {
+		if err := scanner.ValidateDKIMSelector(selector); err != nil {
+			errs = append(errs, &huma.ErrorDetail{Location: fmt.Sprintf("query.selector[%d]", index), Message: err.Error(), Value: selector})
+		}
+	}
+
+	return errs
+}
+
 func (s *Server) registerScanRoutes() {
 	type ScanSingleDomainRequest struct {
+		DKIMSelectorQuery
 		DKIMSelectors []string `query:"dkimSelectors" maxItems:"5" example:"selector1,selector2" doc:"Specify custom DKIM selectors"`
+		AssumeParked  bool     `query:"assumeParked" doc:"Treat the domain as parked, and only check for the records that lock it down"`
+		Detailed      bool     `query:"detailed" doc:"Include detailed output, such as lookup and check timings"`
+		Explain       bool     `query:"explain" doc:"Explain each line of advice with the evidence behind it: the rule that classified it, the record fragments and DNS answers it's about, and the limits compared against"`
+		SchemaVersion int      `query:"schemaVersion" minimum:"1" example:"1" doc:"Reshape the result to an earlier schema version, for clients that haven't been updated (defaults to the current version)"`
 		Domain        string   `path:"domain" maxLength:"255" example:"example.com" doc:"Domain to scan"`
 	}
 
 	type ScanSingleDomainResponse struct {
-		Body struct{ model.ScanResultWithAdvice }
+		Body struct{ model.ScanResult }
 	}
 
 	huma.Register(s.router, huma.Operation{
@@ -29,13 +86,21 @@ func (s *Server) registerScanRoutes() {
 	}, func(ctx context.Context, input *ScanSingleDomainRequest) (*ScanSingleDomainResponse, error) {
 		resp := ScanSingleDomainResponse{}
 
-		if len(input.DKIMSelectors) > 0 {
+		if detail := domainErrorDetail("path.domain", input.Domain); detail != nil {
+			return nil, huma.Error400BadRequest(scanner.ErrInvalidDomain, detail)
+		}
+
+		if err := validateSchemaVersion(input.SchemaVersion); err != nil {
+			return nil, err
+		}
+
+		if len(input.DKIMSelectors) > 0 && len(input.Selectors) == 0 {
 			if err := s.Scanner.OverwriteOption(scanner.WithDKIMSelectors(input.DKIMSelectors...)); err != nil {
 				return nil, huma.Error500InternalServerError(err.Error())
 			}
 		}
 
-		results, err := s.Scanner.Scan(input.Domain)
+		results, err := s.scan(ctx, input.Selectors, input.Domain)
 		if err != nil {
 			return nil, huma.Error500InternalServerError(err.Error())
 		}
@@ -48,30 +113,42 @@ func (s *Server) registerScanRoutes() {
 			return nil, huma.Error400BadRequest(scanner.ErrInvalidDomain)
 		}
 
-		result := model.ScanResultWithAdvice{
-			ScanResult: results[0],
+		// a scan the resolver couldn't answer at all has no result to return, while partial results list their errors
+		if results[0].Error == scanner.ErrLookupFailed {
+			return nil, huma.Error502BadGateway("failed to look up the records of " + results[0].Domain + ": " + results[0].Errors["ns"].Error())
 		}
 
-		if s.Advisor != nil {
-			result.Advice = s.Advisor.CheckAll(result.ScanResult.Domain, result.ScanResult.BIMI, result.ScanResult.DKIM, result.ScanResult.DMARC, result.ScanResult.MX, result.ScanResult.SPF)
+		res := s.adviseResult(ctx, results[0], input.Detailed, input.AssumeParked)
+		if input.Explain {
+			res.Explain(model.ExplainThresholds(s.Scanner, s.Advisor))
 		}
 
-		resp.Body.ScanResultWithAdvice = result
+		resp.Body.ScanResult, _ = res.Versioned(input.SchemaVersion)
 
 		return &resp, nil
 	})
 
 	type ScanBulkDomainsRequest struct {
+		DKIMSelectorQuery
 		DKIMSelectors []string `query:"dkimSelectors" maxItems:"5" example:"selector1,selector2" doc:"Specify custom DKIM selectors"`
-		Body          struct {
-			Domains []string `json:"domains" maxItems:"20" doc:"Domains to scan. Max 20 domains at a time." example:"example.com"`
-		}
+		AssumeParked  bool     `query:"assumeParked" doc:"Treat every domain as parked, and only check for the records that lock it down"`
+		Detailed      bool     `query:"detailed" doc:"Include detailed output, such as lookup and check timings"`
+		SchemaVersion int      `query:"schemaVersion" minimum:"1" example:"1" doc:"Reshape the results to an earlier schema version, for clients that haven't been updated (defaults to the current version)"`
+		Body          model.BulkScanRequest
+	}
+
+	type ScanBulkDomainsStreamRequest struct {
+		DKIMSelectorQuery
+		DKIMSelectors []string `query:"dkimSelectors" maxItems:"5" example:"selector1,selector2" doc:"Specify custom DKIM selectors"`
+		AssumeParked  bool     `query:"assumeParked" doc:"Treat every domain as parked, and only check for the records that lock it down"`
+		Detailed      bool     `query:"detailed" doc:"Include detailed output, such as lookup and check timings"`
+		Format        string   `query:"format" enum:"ndjson,csv" default:"ndjson" doc:"Stream the results as newline-delimited JSON, or as CSV rows after a header row"`
+		SchemaVersion int      `query:"schemaVersion" minimum:"1" example:"1" doc:"Reshape the results to an earlier schema version, for clients that haven't been updated (defaults to the current version)"`
+		Body          model.BulkScanRequest
 	}
 
 	type ScanBulkDomainResponse struct {
-		Body struct {
-			Results []model.ScanResultWithAdvice `json:"results" doc:"The results of scanning the domains."`
-		}
+		Body model.BulkScanResponse
 	}
 
 	huma.Register(s.router, huma.Operation{
@@ -83,27 +160,204 @@ func (s *Server) registerScanRoutes() {
 	}, func(ctx context.Context, input *ScanBulkDomainsRequest) (*ScanBulkDomainResponse, error) {
 		resp := ScanBulkDomainResponse{}
 
-		results, err := s.Scanner.Scan(input.Body.Domains...)
+		items, overrides, err := s.validateBulkRequest(input.Body, input.Selectors, input.SchemaVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.scanBulk(advisor.ContextWithResolveOverrides(ctx, overrides...), items, input.Detailed, input.AssumeParked, input.SchemaVersion, func(result model.ScanResult) bool {
+			resp.Body.Results = append(resp.Body.Results, result)
+			return true
+		})
 		if err != nil {
 			return nil, huma.Error500InternalServerError(err.Error())
 		}
 
-		if len(results) == 0 {
+		if len(resp.Body.Results) == 0 {
 			return nil, huma.Error500InternalServerError("no results found")
 		}
 
-		for _, result := range results {
-			res := model.ScanResultWithAdvice{
-				ScanResult: result,
-			}
-
-			if s.Advisor != nil && result.Error != scanner.ErrInvalidDomain {
-				res.Advice = s.Advisor.CheckAll(result.Domain, result.BIMI, result.DKIM, result.DMARC, result.MX, result.SPF)
-			}
+		return &resp, nil
+	})
 
-			resp.Body.Results = append(resp.Body.Results, res)
+	huma.Register(s.router, huma.Operation{
+		OperationID: "scan-domains-stream",
+		Summary:     "Scan multiple domains, streaming each result as newline-delimited JSON or CSV",
+		Method:      http.MethodPost,
+		Path:        s.apiPath + "/scan/stream",
+		Tags:        []string{"Scan Domains"},
+	}, func(ctx context.Context, input *ScanBulkDomainsStreamRequest) (*huma.StreamResponse, error) {
+		items, overrides, err := s.validateBulkRequest(input.Body, input.Selectors, input.SchemaVersion)
+		if err != nil {
+			return nil, err
 		}
 
-		return &resp, nil
+		return &huma.StreamResponse{
+			Body: func(humaCtx huma.Context) {
+				writer, err := export.NewWriter(humaCtx.BodyWriter(), input.Format, export.WithHeader(model.CSVHeader()), export.WithBufferSize(maxStreamBuffer), export.WithFlushInterval(streamFlushInterval))
+				if err != nil {
+					s.logger.Error().Err(err).Msg("failed to stream scan results")
+					return
+				}
+
+				humaCtx.SetHeader("Content-Type", writer.ContentType())
+
+				// a client that disconnects cancels the request's context, which abandons the remaining domains
+				err = s.scanBulk(advisor.ContextWithResolveOverrides(humaCtx.Context(), overrides...), items, input.Detailed, input.AssumeParked, input.SchemaVersion, func(result model.ScanResult) bool {
+					s.extendWriteDeadline(humaCtx.BodyWriter())
+
+					if err := writer.Write(&result); err != nil {
+						s.logger.Debug().Err(err).Msg("stopped streaming scan results")
+						return false
+					}
+
+					return true
+				})
+				if err != nil && !errors.Is(err, context.Canceled) {
+					s.logger.Error().Err(err).Msg("failed to stream scan results")
+				}
+
+				s.extendWriteDeadline(humaCtx.BodyWriter())
+				_ = writer.Close()
+			},
+		}, nil
 	})
 }
+
+// validateBulkRequest validates a bulk request's domains, options, schema
+// version and resolve overrides, returning its domains with the request's
+// options applied, and its overrides.
+func (s *Server) validateBulkRequest(request model.BulkScanRequest, selectors []string, schemaVersion int) ([]bulkItem, []advisor.ResolveOverride, error) {
+	if err := s.validateDomainCount(len(request.Domains)); err != nil {
+		return nil, nil, err
+	}
+
+	items, err := resolveBulkItems(request, selectors)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = validateSchemaVersion(schemaVersion); err != nil {
+		return nil, nil, err
+	}
+
+	overrides, err := parseResolveOverrides(request.Resolve)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return items, overrides, nil
+}
+
+// scan scans the domains until the context is done, only looking up DKIM keys
+// at the selectors if any were supplied.
+func (s *Server) scan(ctx context.Context, selectors []string, domains ...string) ([]*scanner.Result, error) {
+	if len(selectors) > 0 {
+		return s.Scanner.ScanWithDKIMSelectorsContext(ctx, selectors, domains...)
+	}
+
+	return s.Scanner.ScanContext(ctx, domains...)
+}
+
+// domainErrorDetail validates a domain, returning the reason it was rejected
+// as an error detail (or nil if it's valid).
+func domainErrorDetail(location, domain string) *huma.ErrorDetail {
+	var domainErr *scanner.DomainError
+	if err := scanner.ValidateDomain(domain); errors.As(err, &domainErr) {
+		return &huma.ErrorDetail{Location: location, Message: domainErr.Reason, Value: domain}
+	}
+
+	return nil
+}
+
+// validateBulkDomains validates each domain of a bulk request, returning a
+// single 400 error with a detail for every rejected domain.
+func validateBulkDomains(domains []string) error {
+	var details []error
+
+	for index, domain := range domains {
+		if detail := domainErrorDetail(fmt.Sprintf("body.domains[%d]", index), domain); detail != nil {
+			details = append(details, detail)
+		}
+	}
+
+	if len(details) > 0 {
+		return huma.Error400BadRequest(scanner.ErrInvalidDomain, details...)
+	}
+
+	return nil
+}
+
+// parseResolveOverrides parses the resolve overrides of a bulk request,
+// returning a single 400 error with a detail for every invalid override.
+func parseResolveOverrides(values []string) ([]advisor.ResolveOverride, error) {
+	var (
+		overrides []advisor.ResolveOverride
+		details   []error
+	)
+
+	for index, value := range values {
+		override, err := advisor.ParseResolveOverride(value)
+		if err != nil {
+			details = append(details, &huma.ErrorDetail{Location: fmt.Sprintf("body.resolve[%d]", index), Message: err.Error(), Value: value})
+			continue
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	if len(details) > 0 {
+		return nil, huma.Error400BadRequest("invalid resolve override", details...)
+	}
+
+	return overrides, nil
+}
+
+// validateSchemaVersion returns a 400 error if the requested schema version
+// isn't supported. A version of 0 selects the current schema.
+func validateSchemaVersion(version int) error {
+	if version == 0 {
+		return nil
+	}
+
+	if _, err := model.Schema(version); err != nil {
+		return huma.Error400BadRequest(err.Error())
+	}
+
+	return nil
+}
+
+// adviseResult wraps a scan result with the advisor's advice (if an advisor
+// is configured and the domain is valid), noting which findings are new since
+// the caller's previous scan of the domain.
+func (s *Server) adviseResult(ctx context.Context, result *scanner.Result, detailed, assumeParked bool) model.ScanResult {
+	var advice *advisor.Advice
+
+	if s.Advisor != nil && result.Error != scanner.ErrInvalidDomain {
+		advice = model.Advise(ctx, s.Advisor, result, assumeParked)
+	}
+
+	if s.Metrics != nil {
+		s.Metrics.Observe(result, advice)
+	}
+
+	res := model.NewScanResult(result, advice, detailed)
+	res.Scanner = model.NewProvenance(s.Scanner, s.Advisor)
+
+	// findings are compared with the caller's latest scheduled scan of the domain, if there is one
+	if s.Scheduler != nil {
+		res.Annotate(s.Scheduler.Latest(callerFromContext(ctx).tenant, result.Domain))
+	}
+
+	return res
+}
+
+// extendWriteDeadline pushes the response's write deadline back by the
+// server's write timeout. The deadline otherwise bounds the whole response,
+// which a stream of results can outlast, so it's extended with each result
+// instead. Writers that don't support deadlines are left as they are.
+func (s *Server) extendWriteDeadline(w io.Writer) {
+	if responseWriter, ok := w.(http.ResponseWriter); ok {
+		_ = http.NewResponseController(responseWriter).SetWriteDeadline(time.Now().Add(s.writeTimeout()))
+	}
+}
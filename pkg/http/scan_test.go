@@ -0,0 +1,205 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan_InvalidDomains(t *testing.T) {
+	// domains are validated before the scanner is used, so none is configured
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+
+	t.Run("Single", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/scan/exa%20mple.com", nil))
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		var problem huma.ErrorModel
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+		require.Len(t, problem.Errors, 1)
+		require.Equal(t, "path.domain", problem.Errors[0].Location)
+		require.Equal(t, "invalid character ' ' at position 4", problem.Errors[0].Message)
+	})
+
+	for _, path := range []string{"/api/v1/scan", "/api/v1/scan/stream"} {
+		t.Run("Bulk"+path, func(t *testing.T) {
+			body := `{"domains":["example.com","http//example","example.com","-a.com"]}`
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			server.Handler().ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+			var problem huma.ErrorModel
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			require.Len(t, problem.Errors, 2)
+			require.Equal(t, "body.domains[1]", problem.Errors[0].Location)
+			require.Equal(t, "invalid character '/' at position 5", problem.Errors[0].Message)
+			require.Equal(t, "http//example", problem.Errors[0].Value)
+			require.Equal(t, "body.domains[3]", problem.Errors[1].Location)
+			require.Equal(t, `label "-a" begins with a hyphen`, problem.Errors[1].Message)
+		})
+	}
+}
+
+func TestScan_InvalidResolveOverrides(t *testing.T) {
+	// overrides are validated before the scanner is used, so none is configured
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+
+	for _, path := range []string{"/api/v1/scan", "/api/v1/scan/stream"} {
+		t.Run(path, func(t *testing.T) {
+			body := `{"domains":["example.com"],"resolve":["mail.example.com:25:203.0.113.10","www.example.com:443:new.example.net"]}`
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			server.Handler().ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+			var problem huma.ErrorModel
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			require.Len(t, problem.Errors, 1)
+			require.Equal(t, "body.resolve[1]", problem.Errors[0].Location)
+			require.Contains(t, problem.Errors[0].Message, "its address must be an IP address")
+		})
+	}
+}
+
+func TestScan_DKIMSelectors(t *testing.T) {
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithNameservers([]string{startSlowDNSServer(t, 0, nil)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	get := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+		return recorder
+	}
+
+	t.Run("Repeated", func(t *testing.T) {
+		recorder := get("/api/v1/scan/example.com?selector=mail2023&selector=ed")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var result model.ScanResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		require.Equal(t, []scanner.DKIMSelectorCheck{{Selector: "mail2023", Found: false}, {Selector: "ed", Found: false}}, result.ScanResult.DKIMSelectorChecks)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		recorder := get("/api/v1/scan/example.com?selector=mail2023&selector=mail%402023")
+		require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+		var problem huma.ErrorModel
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+		require.Len(t, problem.Errors, 1)
+		require.Equal(t, "query.selector[1]", problem.Errors[0].Location)
+		require.Equal(t, "DKIM selector has invalid character '@' at offset 4", problem.Errors[0].Message)
+	})
+
+	t.Run("TooMany", func(t *testing.T) {
+		require.Equal(t, http.StatusUnprocessableEntity, get("/api/v1/scan/example.com?selector=a,b,c&selector=d,e,f").Code)
+	})
+}
+
+func TestScan_Annotations(t *testing.T) {
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithNameservers([]string{startSlowDNSServer(t, 0, nil)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	store, err := schedule.OpenStore("")
+	require.NoError(t, err)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+	server.Advisor = advisor.NewAdvisor(time.Second, time.Second, false, advisor.WithOffline(true))
+	t.Cleanup(server.Advisor.Close)
+
+	// the scheduler isn't run, so nothing is scanned
+	server.Scheduler = schedule.New(zerolog.Nop(), store, func(context.Context, string) (*model.ScanResult, error) {
+		return nil, nil
+	})
+
+	scan := func() model.ScanResult {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/scan/example.com", nil))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var result model.ScanResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+
+		return result
+	}
+
+	// without a previous scan, nothing is annotated
+	result := scan()
+	require.Nil(t, result.Findings)
+	require.Nil(t, result.Resolved)
+
+	created, err := server.Scheduler.Add(schedule.DefaultTenant, []string{"Example.com"}, "6h", "")
+	require.NoError(t, err)
+
+	previous := &model.ScanResult{Domain: "example.com", ScanResult: &scanner.Result{Domain: "example.com"}, Advice: &advisor.Advice{DMARC: []string{"You do not have DMARC setup!"}}}
+	require.NoError(t, store.PutResults(schedule.DefaultTenant, created.ID, map[string]*model.ScanResult{"Example.com": previous}))
+
+	result = scan()
+	require.NotEmpty(t, result.Findings)
+	require.Equal(t, model.FindingNew, result.Findings[0].Status)
+
+	resolved := previous.Advice.Findings()[0]
+	require.Equal(t, []model.Finding{{Check: "dmarc", Message: "You do not have DMARC setup!", Severity: resolved.Severity.String(), Reference: resolved.Reference, Remediation: resolved.Remediation, Status: model.FindingResolved}}, result.Resolved)
+}
+
+func TestScan_Explain(t *testing.T) {
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithNameservers([]string{startSlowDNSServer(t, 0, nil)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+	server.Advisor = advisor.NewAdvisor(time.Second, time.Second, false, advisor.WithOffline(true))
+	t.Cleanup(server.Advisor.Close)
+
+	scan := func(target string) model.ScanResult {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var result model.ScanResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+
+		return result
+	}
+
+	require.Nil(t, scan("/api/v1/scan/example.com").Explanations)
+
+	result := scan("/api/v1/scan/example.com?explain=true")
+	require.Len(t, result.Explanations, len(result.Advice.Findings()))
+
+	// the missing DMARC record is explained by the lookup that didn't find it
+	for _, explanation := range result.Explanations {
+		if explanation.Check == "dmarc" {
+			require.Equal(t, []model.ExplainedAnswer{{Name: "_dmarc.example.com", Type: "TXT", Rcode: "NOERROR"}}, explanation.Answers)
+			return
+		}
+	}
+
+	t.Fatalf("found %+v, want the missing DMARC record explained", result.Explanations)
+}
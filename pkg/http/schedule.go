@@ -0,0 +1,131 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+func (s *Server) registerScheduleRoutes() {
+	type CreateScheduleRequest struct {
+		Body struct {
+			Domains  []string `json:"domains" minItems:"1" maxItems:"20" doc:"Domains to scan on each run. Max 20 domains per schedule." example:"example.com"`
+			Interval string   `json:"interval,omitempty" doc:"Run every interval, as a duration of at least a minute (such as 6h). Specify either an interval or a cron expression." example:"6h"`
+			Cron     string   `json:"cron,omitempty" doc:"Run at the times matching a five field cron expression, in UTC. Specify either an interval or a cron expression." example:"0 6 * * mon"`
+		}
+	}
+
+	type ScheduleResponse struct {
+		Body schedule.Schedule
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID:   "create-schedule",
+		Summary:       "Schedule recurring scans of domains",
+		Description:   "Each run starts after a small random delay, so schedules with the same cadence don't all run at once. Subscribed webhooks are notified whenever a run finds a domain's records have changed.",
+		Method:        http.MethodPost,
+		Path:          s.apiPath + "/schedules",
+		DefaultStatus: http.StatusCreated,
+		Tags:          []string{"Schedules"},
+	}, func(ctx context.Context, input *CreateScheduleRequest) (*ScheduleResponse, error) {
+		if s.Scheduler == nil {
+			return nil, huma.Error404NotFound("scheduling is not enabled")
+		}
+
+		if err := validateBulkDomains(input.Body.Domains); err != nil {
+			return nil, err
+		}
+
+		created, err := s.Scheduler.Add(callerFromContext(ctx).tenant, input.Body.Domains, input.Body.Interval, input.Body.Cron)
+		if errors.Is(err, schedule.ErrInvalidCadence) {
+			return nil, huma.Error400BadRequest(err.Error())
+		} else if err != nil {
+			return nil, huma.Error500InternalServerError(err.Error())
+		}
+
+		return &ScheduleResponse{Body: created}, nil
+	})
+
+	type ListSchedulesResponse struct {
+		Body struct {
+			Schedules []schedule.Schedule `json:"schedules" doc:"Every schedule of the caller's tenant, oldest first."`
+		}
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "list-schedules",
+		Summary:     "List scheduled scans",
+		Method:      http.MethodGet,
+		Path:        s.apiPath + "/schedules",
+		Tags:        []string{"Schedules"},
+	}, func(ctx context.Context, input *struct{}) (*ListSchedulesResponse, error) {
+		if s.Scheduler == nil {
+			return nil, huma.Error404NotFound("scheduling is not enabled")
+		}
+
+		resp := ListSchedulesResponse{}
+		resp.Body.Schedules = s.Scheduler.List(callerFromContext(ctx).tenant)
+
+		return &resp, nil
+	})
+
+	type ScheduleIDRequest struct {
+		ID string `path:"id" maxLength:"64" example:"5f2b6c2d9a1e4f07" doc:"The schedule's ID"`
+	}
+
+	type GetScheduleResponse struct {
+		Body struct {
+			schedule.Schedule
+			Results map[string]*model.ScanResult `json:"results" doc:"The latest result of each domain, keyed by domain. Domains appear once they've been scanned successfully."`
+		}
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "get-schedule",
+		Summary:     "Get a scheduled scan, with the latest result of each of its domains",
+		Method:      http.MethodGet,
+		Path:        s.apiPath + "/schedules/{id}",
+		Tags:        []string{"Schedules"},
+	}, func(ctx context.Context, input *ScheduleIDRequest) (*GetScheduleResponse, error) {
+		if s.Scheduler == nil {
+			return nil, huma.Error404NotFound("scheduling is not enabled")
+		}
+
+		found, results, ok := s.Scheduler.Get(callerFromContext(ctx).tenant, input.ID)
+		if !ok {
+			return nil, huma.Error404NotFound("schedule not found")
+		}
+
+		resp := GetScheduleResponse{}
+		resp.Body.Schedule = found
+		resp.Body.Results = results
+
+		return &resp, nil
+	})
+
+	huma.Register(s.router, huma.Operation{
+		OperationID:   "delete-schedule",
+		Summary:       "Delete a scheduled scan, along with its results",
+		Method:        http.MethodDelete,
+		Path:          s.apiPath + "/schedules/{id}",
+		DefaultStatus: http.StatusNoContent,
+		Tags:          []string{"Schedules"},
+	}, func(ctx context.Context, input *ScheduleIDRequest) (*struct{}, error) {
+		if s.Scheduler == nil {
+			return nil, huma.Error404NotFound("scheduling is not enabled")
+		}
+
+		removed, err := s.Scheduler.Remove(callerFromContext(ctx).tenant, input.ID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError(err.Error())
+		} else if !removed {
+			return nil, huma.Error404NotFound("schedule not found")
+		}
+
+		return nil, nil
+	})
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule_Routes(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		server := NewServer(zerolog.Nop(), time.Second, "test")
+
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/schedules", nil))
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+		require.Contains(t, recorder.Body.String(), "scheduling is not enabled")
+	})
+
+	store, err := schedule.OpenStore("")
+	require.NoError(t, err)
+
+	// the scheduler isn't run, so nothing is scanned
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scheduler = schedule.New(zerolog.Nop(), store, func(context.Context, string) (*model.ScanResult, error) {
+		return nil, nil
+	})
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		server.Handler().ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := request(http.MethodPost, "/api/v1/schedules", `{"domains":["example.com"],"cron":"0 6 * * 8"}`)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "invalid day of week")
+
+	recorder = request(http.MethodPost, "/api/v1/schedules", `{"domains":["example.com","example.org"],"interval":"6h"}`)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var created schedule.Schedule
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	require.NotEmpty(t, created.ID)
+	require.Equal(t, []string{"example.com", "example.org"}, created.Domains)
+
+	recorder = request(http.MethodGet, "/api/v1/schedules/"+created.ID, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"interval":"6h"`)
+	require.Contains(t, recorder.Body.String(), `"results":{}`)
+
+	recorder = request(http.MethodDelete, "/api/v1/schedules/"+created.ID, "")
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = request(http.MethodGet, "/api/v1/schedules/"+created.ID, "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
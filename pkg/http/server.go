@@ -2,12 +2,18 @@ package http
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/metrics"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
 	"github.com/go-chi/chi/v5"
@@ -23,23 +29,61 @@ import (
 type Server struct {
 	apiPath string
 	logger  zerolog.Logger
+	ready   atomic.Bool
 	router  huma.API
 	timeout time.Duration
 
 	Addr     string
 	CheckTLS bool
 
+	// UI serves a web page at / for scanning a domain and viewing its advice,
+	// rather than redirecting to the API docs.
+	UI bool
+
+	// APIKeys are the keys accepted by the API, each tied to a tenant. If
+	// empty, the API doesn't require a key, and everything is owned by the
+	// default tenant.
+	APIKeys []APIKey
+
+	// DrainTimeout is how long in-flight requests are given to complete once
+	// the server begins shutting down, before their contexts are cancelled.
+	DrainTimeout time.Duration
+
+	// MaxBodySize is the largest request body accepted, in bytes, beyond
+	// which requests are rejected with a 413 (0 or less is unlimited).
+	MaxBodySize int64
+
+	// MaxDomains is the most domains a bulk scan may request, however small
+	// they are (0 or less is unlimited).
+	MaxDomains int
+
+	// CompressMinSize is the smallest response compressed with gzip or
+	// deflate, for clients that accept either, in bytes. A negative size
+	// disables compression.
+	CompressMinSize int
+
+	// DataFiles are the data files reloaded by POST /admin/reload.
+	DataFiles advisor.DataFiles
+
 	// Services used by the various HTTP routes
-	Advisor *advisor.Advisor
-	Scanner *scanner.Scanner
+	Advisor    *advisor.Advisor
+	Deliveries *schedule.DeliveryLog
+	Metrics    *metrics.Registry
+	Scanner    *scanner.Scanner
+	Scheduler  *schedule.Scheduler
 }
 
 // NewServer returns a new instance of Server.
 func NewServer(logger zerolog.Logger, timeout time.Duration, version string) *Server {
 	server := Server{
-		apiPath: "/api/v1",
-		logger:  logger,
-		timeout: timeout,
+		apiPath:         "/api/v1",
+		logger:          logger,
+		timeout:         timeout,
+		DrainTimeout:    30 * time.Second,
+		MaxBodySize:     DefaultMaxBodySize,
+		MaxDomains:      DefaultMaxDomains,
+		CompressMinSize: DefaultCompressMinSize,
+		Metrics:         metrics.New(),
 	}
 
 	config := huma.DefaultConfig("Domain Security Scanner", version)
@@ -47,12 +91,17 @@ func NewServer(logger zerolog.Logger, timeout time.Duration, version string) *Se
 	config.DocsPath = "" // disable Huma's Stoplight handler
 	config.OpenAPIPath = "/api/v1/docs"
 
+	// bodies are limited by handleBodyLimit instead, as MaxBodySize is set once the routes are registered
+	config.OpenAPI.OnAddOperation = append(config.OpenAPI.OnAddOperation, func(_ *huma.OpenAPI, op *huma.Operation) {
+		op.MaxBodyBytes = -1
+	})
+
 	mux := chi.NewMux()
 	mux.Use(middleware.RedirectSlashes, middleware.RealIP, handleLogging(&logger), middleware.Recoverer)
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST"},
-		AllowedHeaders:   []string{"Accept", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
@@ -72,10 +121,12 @@ func NewServer(logger zerolog.Logger, timeout time.Duration, version string) *Se
 			}
 		}),
 	))
+	mux.Use(server.handleAuth, server.handleBodyLimit, server.handleCompression)
 	mux.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		// redirect to the API docs
 		http.Redirect(w, r, server.apiPath+"/docs", http.StatusFound)
 	})
+	mux.Get("/", server.handleUI)
 	mux.Handle("/api/v1/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		if _, err := w.Write([]byte(`{"version":"` + version + `"}`)); err != nil {
@@ -83,6 +134,38 @@ func NewServer(logger zerolog.Logger, timeout time.Duration, version string) *Se
 		}
 	}))
 
+	// the committed JSON Schema of the scan results, for clients to validate against (or generate types from)
+	mux.Handle(server.apiPath+"/schema", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := model.SchemaVersion
+
+		if value := r.URL.Query().Get("schemaVersion"); value != "" {
+			version = cast.ToInt(value)
+		}
+
+		schema, err := model.Schema(version)
+		if err != nil {
+			response, _ := json.Marshal(huma.Error400BadRequest(err.Error()))
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(response)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/schema+json")
+		_, _ = w.Write(schema)
+	}))
+
+	mux.Handle("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.Metrics == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		server.Metrics.ServeHTTP(w, r)
+	}))
+
 	server.router = humachi.New(mux, config)
 	server.router.Adapter().Handle(&huma.Operation{
 		Method: http.MethodGet,
@@ -93,44 +176,178 @@ func NewServer(logger zerolog.Logger, timeout time.Duration, version string) *Se
 			server.logger.Error().Err(err).Msg("an error occurred while serving the API documentation")
 		}
 	})
+	server.registerAdminRoutes()
+	server.registerCacheRoutes()
+	server.registerHealthRoutes()
 	server.registerVersionRoute(version)
+	server.registerReportRoutes()
 	server.registerScanRoutes()
+	server.registerScheduleRoutes()
+	server.registerSimulateRoutes()
+	server.registerTenantRoutes()
+	server.registerValidateRoutes()
+	server.registerWebhookRoutes()
 
 	return &server
 }
 
-func (s *Server) Serve(port int) {
+// Handler returns the server's HTTP handler, for use with a custom listener
+// (or httptest).
+func (s *Server) Handler() http.Handler {
+	return s.router.Adapter()
+}
+
+// Serve hosts the API on the given port until ctx is done, then shuts down
+// gracefully (see serve).
+func (s *Server) Serve(ctx context.Context, port int) error {
 	if port == 0 {
 		port = 8080
 	}
 
 	portString := cast.ToString(port)
-	httpServer := &http.Server{
-		Addr:         "0.0.0.0:" + portString,
-		Handler:      s.router.Adapter(),
-		WriteTimeout: 4 * s.timeout, // timeout is used by the scanner per request, so multiply it by 4 to allow for bulk requests
+
+	listener, err := net.Listen("tcp", "0.0.0.0:"+portString)
+	if err != nil {
+		return err
 	}
 
 	s.logger.Info().Msg("Starting api server on port " + portString)
-	s.logger.Fatal().Err(httpServer.ListenAndServe()).Msg("an error occurred while hosting the api server")
+
+	return s.serve(ctx, listener)
+}
+
+// writeTimeout is how long a response may take to write. The timeout is used
+// by the scanner per request, so it's multiplied by 4 to allow for bulk
+// requests. Streamed responses extend it with each result.
+func (s *Server) writeTimeout() time.Duration {
+	return 4 * s.timeout
+}
+
+// serve hosts the API on the given listener until ctx is done. The server is
+// then marked as not ready, stops accepting new connections, and gives
+// in-flight requests up to DrainTimeout to complete before cancelling their
+// contexts. Finally, the advisor is closed.
+func (s *Server) serve(ctx context.Context, listener net.Listener) error {
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	httpServer := &http.Server{
+		Handler:      s.Handler(),
+		WriteTimeout: s.writeTimeout(),
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	// the port 25 self-test runs at startup, so the health endpoint reports it before the first scan
+	if s.Advisor != nil {
+		go func() {
+			if status, ok := s.Advisor.CheckPort25(requestCtx); ok && status.Blocked {
+				s.logger.Warn().Str("reference", status.Reference).Str("error", status.Error).Msg("outbound port 25 appears blocked, so SMTP TLS checks will be skipped")
+			}
+		}()
+	}
+
+	s.ready.Store(true)
+
+	select {
+	case err := <-serveErr:
+		s.ready.Store(false)
+		return err
+	case <-ctx.Done():
+	}
+
+	s.ready.Store(false)
+	s.logger.Info().Dur("drainTimeout", s.DrainTimeout).Msg("shutting down api server")
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), s.DrainTimeout)
+	defer cancelDrain()
+
+	err := httpServer.Shutdown(drainCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		s.logger.Warn().Msg("in-flight requests did not complete in time, cancelling them")
+		cancelRequests()
+		err = httpServer.Close()
+	}
+
+	if s.Advisor != nil {
+		s.Advisor.Close()
+	}
+
+	return err
+}
+
+func (s *Server) registerHealthRoutes() {
+	type HealthResponse struct {
+		Body struct {
+			Status string `json:"status" doc:"The status of the API." example:"ok"`
+
+			// Port25 is only set if the advisor runs the port 25 self-test.
+			Port25 *advisor.Port25Status `json:"port25,omitempty" doc:"Whether outbound port 25 appears blocked from the server, which skips the SMTP TLS checks."`
+		}
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "health-live",
+		Summary:     "Check whether the API is running",
+		Method:      http.MethodGet,
+		Path:        s.apiPath + "/health/live",
+		Tags:        []string{"Health"},
+	}, func(ctx context.Context, input *struct{}) (*HealthResponse, error) {
+		resp := HealthResponse{}
+		resp.Body.Status = "ok"
+
+		if s.Advisor != nil {
+			if status, ok := s.Advisor.Port25(); ok {
+				resp.Body.Port25 = &status
+			}
+		}
+
+		return &resp, nil
+	})
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "health-ready",
+		Summary:     "Check whether the API is ready to accept requests",
+		Description: "Returns a 503 once the server begins shutting down, so load balancers stop sending it traffic.",
+		Method:      http.MethodGet,
+		Path:        s.apiPath + "/health/ready",
+		Tags:        []string{"Health"},
+	}, func(ctx context.Context, input *struct{}) (*HealthResponse, error) {
+		if !s.ready.Load() {
+			return nil, huma.Error503ServiceUnavailable("server is not ready")
+		}
+
+		resp := HealthResponse{}
+		resp.Body.Status = "ok"
+		return &resp, nil
+	})
 }
 
 func (s *Server) registerVersionRoute(version string) {
 	type VersionResponse struct {
 		Body struct {
-			Version string `json:"version" doc:"The version of the API." example:"3.0.0"`
+			Version string            `json:"version" doc:"The version of the API." example:"3.0.0"`
+			Scanner *model.Provenance `json:"scanner" doc:"What produces the server's results, as included in each of them: the scanner's build, a hash of its effective configuration, and the advice catalog's revision."`
 		}
 	}
 
 	huma.Register(s.router, huma.Operation{
 		OperationID: "version",
 		Summary:     "Get the version of the API",
+		Description: "Returns the version of the API, along with the provenance included in each of the server's results, so a stored result can be matched to the build and configuration that produced it.",
 		Method:      http.MethodGet,
 		Path:        s.apiPath + "/version",
 		Tags:        []string{"Version"},
 	}, func(ctx context.Context, input *struct{}) (*VersionResponse, error) {
 		resp := VersionResponse{}
 		resp.Body.Version = version
+		resp.Body.Scanner = model.NewProvenance(s.Scanner, s.Advisor)
 		return &resp, nil
 	})
 }
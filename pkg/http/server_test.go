@@ -0,0 +1,357 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// startSlowDNSServer answers NS queries (so domains are valid) and serves
+// empty answers otherwise, after the given delay. It signals on received
+// whenever a query arrives.
+func startSlowDNSServer(t *testing.T, delay time.Duration, received chan<- struct{}) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+
+		time.Sleep(delay)
+
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+
+		if question := req.Question[0]; question.Qtype == dns.TypeNS {
+			msg.Answer = append(msg.Answer, &dns.NS{
+				Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+				Ns:  "ns1." + question.Name,
+			})
+		}
+
+		_ = w.WriteMsg(msg)
+	})}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return conn.LocalAddr().String()
+}
+
+func TestServer_GracefulShutdown(t *testing.T) {
+	received := make(chan struct{}, 1)
+
+	sc, err := scanner.New(zerolog.Nop(), 2*time.Second, scanner.WithNameservers([]string{startSlowDNSServer(t, 500*time.Millisecond, received)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), 2*time.Second, "test")
+	server.Scanner = sc
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	baseURL := "http://" + listener.Addr().String() + "/api/v1"
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.serve(ctx, listener)
+	}()
+
+	require.Eventually(t, server.ready.Load, time.Second, 10*time.Millisecond)
+
+	response, err := http.Get(baseURL + "/health/ready")
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	type scanResponse struct {
+		statusCode int
+		body       string
+		err        error
+	}
+
+	scanned := make(chan scanResponse, 1)
+	go func() {
+		response, err := http.Get(baseURL + "/scan/example.com")
+		if err != nil {
+			scanned <- scanResponse{err: err}
+			return
+		}
+		defer response.Body.Close()
+
+		body, err := io.ReadAll(response.Body)
+		scanned <- scanResponse{statusCode: response.StatusCode, body: string(body), err: err}
+	}()
+
+	// wait for the scan to be in flight before signalling
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan never reached the DNS server")
+	}
+
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, process.Signal(syscall.SIGTERM))
+
+	require.Eventually(t, func() bool { return !server.ready.Load() }, time.Second, time.Millisecond)
+
+	result := <-scanned
+	require.NoError(t, result.err)
+	require.Equal(t, http.StatusOK, result.statusCode)
+	require.Contains(t, result.body, `"domain":"example.com"`)
+
+	require.NoError(t, <-served)
+
+	_, err = http.Get(baseURL + "/health/live")
+	require.Error(t, err, "server should no longer accept connections")
+}
+
+func TestServer_DrainTimeout(t *testing.T) {
+	received := make(chan struct{}, 1)
+
+	sc, err := scanner.New(zerolog.Nop(), 5*time.Second, scanner.WithNameservers([]string{startSlowDNSServer(t, 2*time.Second, received)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), 5*time.Second, "test")
+	server.DrainTimeout = 100 * time.Millisecond
+	server.Scanner = sc
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.serve(ctx, listener)
+	}()
+
+	go func() {
+		if response, err := http.Get("http://" + listener.Addr().String() + "/api/v1/scan/example.com"); err == nil {
+			_ = response.Body.Close()
+		}
+	}()
+
+	<-received
+	startTime := time.Now()
+	cancel()
+
+	require.NoError(t, <-served)
+	require.Less(t, time.Since(startTime), time.Second, "shutdown should not wait for the in-flight scan")
+}
+
+func TestServer_Metrics(t *testing.T) {
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithNameservers([]string{startSlowDNSServer(t, 0, nil)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/scan/example.com", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `dss_scans_total{result="success"} 1`)
+	require.Contains(t, recorder.Body.String(), `dss_lookup_duration_seconds_count{lookup="dmarc"} 1`)
+}
+
+func TestServer_StreamWriteTimeout(t *testing.T) {
+	// the domains' records take 100ms each, so the stream outlasts the server's 400ms write timeout
+	network := testnet.New(t)
+
+	var domains []string
+	for index := range 8 {
+		domain := fmt.Sprintf("example-%d.com", index)
+		network.Resolver.Answer(domain, dns.TypeNS, testnet.Answer{Records: []string{domain + ". 300 IN NS ns1.example.com."}, Delay: 100 * time.Millisecond})
+		domains = append(domains, strconv.Quote(domain))
+	}
+
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver { return network.Resolver }))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), 100*time.Millisecond, "test")
+	server.Scanner = sc
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = server.serve(ctx, listener) }()
+
+	response, err := http.Post("http://"+listener.Addr().String()+"/api/v1/scan/stream", "application/json", strings.NewReader(`{"domains":[`+strings.Join(domains, ",")+`],"checks":["offline"]}`))
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err, "the stream was cut off by the write timeout")
+	require.Len(t, strings.Split(strings.TrimSpace(string(body)), "\n"), len(domains))
+}
+
+// refusingDialer refuses every connection.
+type refusingDialer struct{}
+
+func (refusingDialer) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+}
+
+func TestServer_HealthPort25(t *testing.T) {
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+
+	live := func() map[string]any {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/health/live", nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+
+		return body
+	}
+
+	// the self-test is only reported if the advisor runs it
+	require.NotContains(t, live(), "port25")
+
+	server.Advisor = advisor.NewAdvisor(time.Second, 0, true, advisor.WithDialer(refusingDialer{}), advisor.WithProxy(advisor.ProxyConfig{}), advisor.WithPort25SelfTest("mx.reference.example"))
+	t.Cleanup(server.Advisor.Close)
+
+	require.Equal(t, map[string]any{"reference": "mx.reference.example", "checked": false, "blocked": false}, live()["port25"])
+
+	server.Advisor.CheckPort25(context.Background())
+
+	port25 := live()["port25"].(map[string]any)
+	require.Equal(t, true, port25["checked"])
+	require.Equal(t, true, port25["blocked"])
+	require.Contains(t, port25["error"], "connection refused")
+}
+
+func TestServer_SchemaVersion(t *testing.T) {
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithNameservers([]string{startSlowDNSServer(t, 0, nil)}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	get := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+		return recorder
+	}
+
+	t.Run("Current", func(t *testing.T) {
+		recorder := get("/api/v1/scan/example.com")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		require.Contains(t, recorder.Body.String(), fmt.Sprintf(`"schemaVersion":%d`, model.SchemaVersion))
+	})
+
+	t.Run("V1", func(t *testing.T) {
+		recorder := get("/api/v1/scan/example.com?schemaVersion=1")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		require.NotContains(t, recorder.Body.String(), `"schemaVersion"`)
+		require.Contains(t, recorder.Body.String(), `"scanResult":{"domain":"example.com"`)
+	})
+
+	t.Run("Schema", func(t *testing.T) {
+		recorder := get("/api/v1/schema")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "application/schema+json", recorder.Header().Get("Content-Type"))
+		require.Contains(t, recorder.Body.String(), fmt.Sprintf(`"x-schema-version": %d`, model.SchemaVersion))
+
+		recorder = get("/api/v1/schema?schemaVersion=1")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Contains(t, recorder.Body.String(), `"x-schema-version": 1`)
+
+		recorder = get(fmt.Sprintf("/api/v1/schema?schemaVersion=%d", model.SchemaVersion+1))
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		require.Contains(t, recorder.Body.String(), fmt.Sprintf("unsupported schema version %d", model.SchemaVersion+1))
+	})
+}
+
+func TestServer_Provenance(t *testing.T) {
+	nameserver, secondary := startSlowDNSServer(t, 0, nil), startSlowDNSServer(t, 0, nil)
+
+	newServer := func(opts ...scanner.Option) *Server {
+		sc, err := scanner.New(zerolog.Nop(), time.Second, opts...)
+		require.NoError(t, err)
+		t.Cleanup(sc.Close)
+
+		server := NewServer(zerolog.Nop(), time.Second, "test")
+		server.Scanner = sc
+		server.Advisor = advisor.NewAdvisor(time.Second, time.Minute, false, advisor.WithOffline(true))
+		t.Cleanup(server.Advisor.Close)
+
+		return server
+	}
+
+	provenance := func(server *Server, target string) model.Provenance {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var resp struct {
+			Scanner *model.Provenance `json:"scanner"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Scanner, recorder.Body.String())
+
+		return *resp.Scanner
+	}
+
+	// the servers are started with equivalent configs, which list the same nameservers differently
+	server := newServer(scanner.WithNameservers([]string{nameserver, secondary}))
+	equivalent := newServer(scanner.WithNameservers([]string{secondary, nameserver}), scanner.WithConcurrentScans(1))
+
+	expected := provenance(server, "/api/v1/version")
+	require.Equal(t, model.Version, expected.Version)
+	require.Equal(t, advisor.CatalogVersion(), expected.AdviceCatalog)
+	require.Regexp(t, "^sha256:[0-9a-f]{64}$", expected.ConfigHash)
+	require.Equal(t, expected, provenance(equivalent, "/api/v1/version"))
+
+	// every result carries the provenance of the server that produced it
+	require.Equal(t, expected, provenance(server, "/api/v1/scan/example.com"))
+
+	changed := provenance(newServer(scanner.WithNameservers([]string{nameserver})), "/api/v1/version")
+	require.NotEqual(t, expected.ConfigHash, changed.ConfigHash, "changing a resolver must change the config hash")
+}
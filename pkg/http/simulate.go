@@ -0,0 +1,90 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+func (s *Server) registerSimulateRoutes() {
+	type SimulateMessageRequest struct {
+		Body model.SimulateRequest
+	}
+
+	type SimulateMessageResponse struct {
+		Body model.SimulateResponse
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "simulate-message",
+		Summary:     "Simulate DMARC for a message",
+		Description: "Evaluates a hypothetical message against the From domain's live DMARC record (or its organizational domain's, if it has none), returning whether it passes, which identifier aligned, and the disposition receivers apply.",
+		Method:      http.MethodPost,
+		Path:        s.apiPath + "/simulate",
+		Tags:        []string{"Simulate DMARC"},
+	}, func(ctx context.Context, input *SimulateMessageRequest) (*SimulateMessageResponse, error) {
+		if detail := domainErrorDetail("body.domain", input.Body.Domain); detail != nil {
+			return nil, huma.Error400BadRequest(scanner.ErrInvalidDomain, detail)
+		}
+
+		result, err := s.lookupDMARC(ctx, input.Body.Domain)
+		if err != nil {
+			return nil, err
+		}
+
+		// a subdomain without a record of its own is covered by its organizational domain's
+		policyDomain, record := result.Domain, result.DMARC
+		if organizational := advisor.OrganizationalDomain(result.Domain); result.DMARC == "" && organizational != result.Domain {
+			organizationalResult, err := s.lookupDMARC(ctx, organizational)
+			if err != nil {
+				return nil, err
+			}
+
+			policyDomain, record = organizational, organizationalResult.DMARC
+		}
+
+		request := input.Body
+		request.Domain = result.Domain
+
+		resp := SimulateMessageResponse{}
+		resp.Body = model.NewSimulateResponse(&request, policyDomain, record, advisor.EvaluateDMARC(record, policyDomain, request.Message()))
+
+		return &resp, nil
+	})
+}
+
+// lookupDMARC scans the domain for its DMARC record, returning an error if
+// the domain is invalid or the record couldn't be looked up, as evaluating
+// the message without it would wrongly report that no policy applies. A
+// record that only came from a wildcard TXT record is ignored.
+func (s *Server) lookupDMARC(ctx context.Context, domain string) (*scanner.Result, error) {
+	results, err := s.Scanner.ScanContext(ctx, domain)
+	if err != nil {
+		return nil, huma.Error500InternalServerError(err.Error())
+	}
+
+	if len(results) != 1 {
+		return nil, huma.Error500InternalServerError(fmt.Errorf("expected 1 result, got %d", len(results)).Error())
+	}
+
+	result := results[0]
+
+	if result.Error == scanner.ErrInvalidDomain {
+		return nil, huma.Error400BadRequest(scanner.ErrInvalidDomain)
+	}
+
+	if result.Error == scanner.ErrLookupFailed {
+		return nil, huma.Error502BadGateway("failed to look up the DMARC record of " + domain + ": " + result.Errors["ns"].Error())
+	}
+
+	if err := result.Errors["dmarc"]; err != nil {
+		return nil, huma.Error502BadGateway("failed to look up the DMARC record of " + domain + ": " + err.Error())
+	}
+
+	return result, nil
+}
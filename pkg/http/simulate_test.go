@@ -0,0 +1,140 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// zoneFileResolver answers from a fixture zone, and fails the queries of the
+// names in failing.
+type zoneFileResolver struct {
+	records map[string][]dns.RR
+	failing map[string]struct{}
+}
+
+func newZoneFileResolver(t *testing.T, zone string, failing ...string) *zoneFileResolver {
+	t.Helper()
+
+	resolver := &zoneFileResolver{records: make(map[string][]dns.RR), failing: make(map[string]struct{})}
+	for _, name := range failing {
+		resolver.failing[name] = struct{}{}
+	}
+
+	parser := dns.NewZoneParser(strings.NewReader(zone), "", "")
+	for record, ok := parser.Next(); ok; record, ok = parser.Next() {
+		resolver.records[record.Header().Name] = append(resolver.records[record.Header().Name], record)
+	}
+	require.NoError(t, parser.Err())
+
+	return resolver
+}
+
+func (r *zoneFileResolver) Exchange(msg *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	question := msg.Question[0]
+
+	reply := new(dns.Msg)
+	reply.SetReply(msg)
+
+	if _, ok := r.failing[question.Name]; ok {
+		reply.Rcode = dns.RcodeServerFailure
+		return reply, 0, nil
+	}
+
+	for _, record := range r.records[question.Name] {
+		if record.Header().Rrtype == question.Qtype {
+			reply.Answer = append(reply.Answer, dns.Copy(record))
+		}
+	}
+
+	return reply, 0, nil
+}
+
+func TestSimulate(t *testing.T) {
+	// the API is rate limited to 5 requests every 3 seconds, which limits the number of cases
+	zone := `
+example.com. 300 IN NS ns1.example.com.
+_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject; sp=quarantine; adkim=s; rua=mailto:dmarc@example.com"
+news.example.com. 300 IN TXT "v=spf1 include:esp.example.net -all"
+example.org. 300 IN NS ns1.example.org.
+broken.example.net. 300 IN NS ns1.broken.example.net.
+`
+
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver {
+		return newZoneFileResolver(t, zone, "_dmarc.broken.example.net.")
+	}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+
+	simulate := func(t *testing.T, body string) (int, model.SimulateResponse) {
+		t.Helper()
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/simulate", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		server.Handler().ServeHTTP(recorder, request)
+
+		var response model.SimulateResponse
+		if recorder.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		}
+
+		return recorder.Code, response
+	}
+
+	t.Run("Pass", func(t *testing.T) {
+		code, response := simulate(t, `{"domain":"Example.com","envelopeFrom":"bounce.esp.example.net","spf":"pass","dkimDomain":"example.com","dkim":"pass","source":"192.0.2.1"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "example.com", response.Domain)
+		require.Equal(t, "example.com", response.PolicyDomain)
+		require.Equal(t, "pass", response.Result)
+		require.Equal(t, model.SimulatedIdentifier{Domain: "bounce.esp.example.net", Result: "pass", Mode: "relaxed"}, response.SPF)
+		require.Equal(t, model.SimulatedIdentifier{Domain: "example.com", Result: "pass", Mode: "strict", Aligned: true}, response.DKIM)
+		require.Equal(t, model.SimulatedDisposition{Deliver: 100}, response.Disposition)
+		require.Equal(t, "192.0.2.1", response.Source)
+		require.NotEmpty(t, response.Explanation)
+	})
+
+	t.Run("SubdomainPolicy", func(t *testing.T) {
+		// news.example.com has no record of its own, so example.com's sp applies
+		code, response := simulate(t, `{"domain":"news.example.com","envelopeFrom":"esp.example.net","spf":"pass","dkimDomain":"example.com","dkim":"pass"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "example.com", response.PolicyDomain)
+		require.Equal(t, "fail", response.Result)
+		require.False(t, response.DKIM.Aligned)
+		require.Equal(t, "sp", response.PolicyTag)
+		require.Equal(t, "quarantine", response.Policy)
+		require.Equal(t, model.SimulatedDisposition{Quarantine: 100}, response.Disposition)
+	})
+
+	t.Run("NoRecord", func(t *testing.T) {
+		code, response := simulate(t, `{"domain":"example.org","spf":"fail"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "none", response.Result)
+		require.Empty(t, response.PolicyDomain)
+		require.Empty(t, response.Record)
+		require.Equal(t, model.SimulatedDisposition{Deliver: 100}, response.Disposition)
+	})
+
+	t.Run("LookupFailed", func(t *testing.T) {
+		code, _ := simulate(t, `{"domain":"broken.example.net","spf":"pass","envelopeFrom":"broken.example.net"}`)
+		require.Equal(t, http.StatusBadGateway, code)
+	})
+
+	t.Run("InvalidDomain", func(t *testing.T) {
+		code, _ := simulate(t, `{"domain":"not a domain"}`)
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -0,0 +1,26 @@
+package http
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// uiPage is the web page served at / with UI set. It's self-contained, and
+// only calls the API's own endpoints.
+//
+//go:embed ui/index.html
+var uiPage []byte
+
+// handleUI serves the web page if UI is set, and otherwise redirects to the
+// API docs.
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	if !s.UI {
+		http.Redirect(w, r, s.apiPath+"/docs", http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(uiPage); err != nil {
+		s.logger.Error().Err(err).Msg("an error occurred while serving the web page")
+	}
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_UI(t *testing.T) {
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.UI = true
+
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+
+	response, err := http.Get(httpServer.URL + "/")
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "text/html; charset=utf-8", response.Header.Get("Content-Type"))
+
+	page, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	// the page mustn't load any external assets
+	require.NotRegexp(t, `(src|href)="(https?:)?//`, string(page))
+
+	// every endpoint the page calls must be one of the API's operations
+	endpoints := regexp.MustCompile(`"(/api/v1/[^"]+)"`).FindAllStringSubmatch(string(page), -1)
+	require.NotEmpty(t, endpoints)
+
+	for _, endpoint := range endpoints {
+		require.Contains(t, server.router.OpenAPI().Paths, endpoint[1])
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		server := NewServer(zerolog.Nop(), time.Second, "test")
+
+		httpServer := httptest.NewServer(server.Handler())
+		t.Cleanup(httpServer.Close)
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+		response, err := client.Get(httpServer.URL + "/")
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		require.Equal(t, http.StatusFound, response.StatusCode)
+		require.Equal(t, "/api/v1/docs", response.Header.Get("Location"))
+	})
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+func (s *Server) registerValidateRoutes() {
+	type ValidateRecordsRequest struct {
+		Body model.LintRequest
+	}
+
+	type ValidateRecordsResponse struct {
+		Body model.LintResponse
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "validate-records",
+		Summary:     "Validate records before publishing them",
+		Description: "Runs only the offline syntax checks against the provided records, without any DNS lookups or network probes.",
+		Method:      http.MethodPost,
+		Path:        s.apiPath + "/validate",
+		Tags:        []string{"Validate Records"},
+	}, func(ctx context.Context, input *ValidateRecordsRequest) (*ValidateRecordsResponse, error) {
+		if input.Body.Empty() {
+			return nil, huma.Error400BadRequest("at least one record must be provided")
+		}
+
+		if s.Advisor == nil {
+			return nil, huma.Error500InternalServerError("no advisor is configured")
+		}
+
+		resp := ValidateRecordsResponse{}
+		resp.Body.Advice = s.Advisor.Lint(input.Body.BIMI, input.Body.DKIM, input.Body.DMARC, input.Body.MX, input.Body.SPF)
+
+		return &resp, nil
+	})
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// panickingDialer and panickingResolver fail the request on any network
+	// call, which the server's recovery middleware reports as a 500.
+	panickingDialer   struct{}
+	panickingResolver struct{}
+)
+
+func (panickingDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	panic("unexpected connection to " + address)
+}
+
+func (panickingResolver) Exchange(msg *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	panic("unexpected query for " + msg.Question[0].Name)
+}
+
+func TestValidate(t *testing.T) {
+	sc, err := scanner.New(zerolog.Nop(), time.Second, scanner.WithResolverMiddleware(func(scanner.Resolver) scanner.Resolver {
+		return panickingResolver{}
+	}))
+	require.NoError(t, err)
+	t.Cleanup(sc.Close)
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.Scanner = sc
+	server.Advisor = advisor.NewAdvisor(time.Second, time.Second, true, advisor.WithDialer(panickingDialer{}))
+	t.Cleanup(server.Advisor.Close)
+
+	validate := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/validate", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		server.Handler().ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	t.Run("Records", func(t *testing.T) {
+		recorder := validate(`{"bimi":"v=BIMI1; l=https://bimi.example.com/logo.svg;","dmarc":"v=DMARC1; p=reject; rua=mailto:dmarc@example.com","mx":["mx.example.com"],"spf":"v=spf1 +all"}`)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var response model.LintResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		require.Equal(t, []string{"Your BIMI record has some issues:", "Your BIMI record is missing the VMC cert URL."}, response.Advice.BIMI)
+		require.Equal(t, server.Advisor.CheckDMARC("v=DMARC1; p=reject; rua=mailto:dmarc@example.com"), response.Advice.DMARC)
+		require.Equal(t, []string{"You have a single mail server setup, but it's recommended that you have at least two setup in case the first one fails."}, response.Advice.MX)
+		require.Equal(t, server.Advisor.CheckSPF("v=spf1 +all"), response.Advice.SPF)
+		require.Nil(t, response.Advice.DKIM)
+		require.Nil(t, response.Advice.Domain)
+	})
+
+	t.Run("NoRecords", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, validate(`{}`).Code)
+	})
+}
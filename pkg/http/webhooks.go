@@ -0,0 +1,63 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+func (s *Server) registerWebhookRoutes() {
+	type ListDeliveriesResponse struct {
+		Body struct {
+			Deliveries []schedule.Delivery `json:"deliveries" doc:"The latest webhook deliveries of the caller's tenant, newest first."`
+		}
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "list-webhook-deliveries",
+		Summary:     "List webhook deliveries, with the response code of each attempt",
+		Description: "Only the latest deliveries of each tenant are kept, and they don't survive a restart.",
+		Method:      http.MethodGet,
+		Path:        s.apiPath + "/webhooks/deliveries",
+		Tags:        []string{"Webhooks"},
+	}, func(ctx context.Context, input *struct{}) (*ListDeliveriesResponse, error) {
+		if s.Deliveries == nil {
+			return nil, huma.Error404NotFound("webhooks are not enabled")
+		}
+
+		resp := ListDeliveriesResponse{}
+		resp.Body.Deliveries = s.Deliveries.List(callerFromContext(ctx).tenant)
+
+		return &resp, nil
+	})
+
+	type RetryDeliveryRequest struct {
+		ID string `path:"id" maxLength:"64" example:"9c4e1f0a7b3d2e58" doc:"The delivery's ID"`
+	}
+
+	type DeliveryResponse struct {
+		Body schedule.Delivery
+	}
+
+	huma.Register(s.router, huma.Operation{
+		OperationID: "retry-webhook-delivery",
+		Summary:     "Redeliver a webhook delivery",
+		Description: "The delivery is sent again with the same ID, but a new timestamp, nonce and signature. Whether or not the webhook accepts it, the delivery is returned with the new attempt.",
+		Method:      http.MethodPost,
+		Path:        s.apiPath + "/webhooks/deliveries/{id}/retry",
+		Tags:        []string{"Webhooks"},
+	}, func(ctx context.Context, input *RetryDeliveryRequest) (*DeliveryResponse, error) {
+		if s.Deliveries == nil {
+			return nil, huma.Error404NotFound("webhooks are not enabled")
+		}
+
+		delivery, ok := s.Deliveries.Redeliver(ctx, callerFromContext(ctx).tenant, input.ID)
+		if !ok {
+			return nil, huma.Error404NotFound("delivery not found")
+		}
+
+		return &DeliveryResponse{Body: delivery}, nil
+	})
+}
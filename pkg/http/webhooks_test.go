@@ -0,0 +1,76 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/schedule"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook_Routes(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		server := NewServer(zerolog.Nop(), time.Second, "test")
+
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/webhooks/deliveries", nil))
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+		require.Contains(t, recorder.Body.String(), "webhooks are not enabled")
+	})
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	deliveries := schedule.NewDeliveryLog(0)
+	webhook := schedule.NewWebhook(receiver.URL, time.Second, schedule.WithDeliveryLog(deliveries))
+	require.NoError(t, webhook.Notify(context.Background(), schedule.Change{Tenant: "acme", ScheduleID: "s1", Domain: "example.com"}))
+
+	server := NewServer(zerolog.Nop(), time.Second, "test")
+	server.APIKeys = []APIKey{{Key: "acme-key", Tenant: "acme"}, {Key: "globex-key", Tenant: "globex"}}
+	server.Deliveries = deliveries
+
+	request := func(method, path, key string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		server.Handler().ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := request(http.MethodGet, "/api/v1/webhooks/deliveries", "acme-key")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var listed struct{ Deliveries []schedule.Delivery }
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listed))
+	require.Len(t, listed.Deliveries, 1)
+	require.Equal(t, "example.com", listed.Deliveries[0].Domain)
+	require.Equal(t, http.StatusAccepted, listed.Deliveries[0].Attempts[0].StatusCode)
+
+	id := listed.Deliveries[0].ID
+
+	recorder = request(http.MethodGet, "/api/v1/webhooks/deliveries", "globex-key")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listed))
+	require.Empty(t, listed.Deliveries)
+
+	recorder = request(http.MethodPost, "/api/v1/webhooks/deliveries/"+id+"/retry", "globex-key")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "delivery not found")
+
+	recorder = request(http.MethodPost, "/api/v1/webhooks/deliveries/"+id+"/retry", "acme-key")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var redelivered schedule.Delivery
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &redelivered))
+	require.Equal(t, id, redelivered.ID)
+	require.Len(t, redelivered.Attempts, 2)
+	require.Equal(t, http.StatusAccepted, redelivered.Attempts[1].StatusCode)
+}
@@ -0,0 +1,230 @@
+// Package iprange implements set arithmetic on ranges of IP addresses, such as
+// the networks authorized by the ip4 and ip6 mechanisms of SPF records. IPv4
+// and IPv6 addresses never overlap, so a set may hold ranges of both.
+package iprange
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type (
+	// Range is every address from From to To, inclusive. Both are of the same
+	// family (IPv4 or IPv6), and From isn't after To.
+	Range struct {
+		From netip.Addr
+		To   netip.Addr
+	}
+
+	// Set is a set of addresses, kept as sorted ranges that neither overlap
+	// nor touch, so each address is in at most one of them. The zero value is
+	// an empty set.
+	Set struct {
+		ranges []Range
+	}
+)
+
+// FromPrefix returns the range of every address of the network, including its
+// network and broadcast addresses. Any bits of the prefix's address outside its
+// mask are ignored, so 203.0.113.5/24 is 203.0.113.0/24.
+func FromPrefix(prefix netip.Prefix) Range {
+	prefix = prefix.Masked()
+
+	return Range{From: prefix.Addr(), To: lastAddr(prefix)}
+}
+
+// FromAddr returns the range of the single address.
+func FromAddr(addr netip.Addr) Range {
+	addr = addr.WithZone("")
+
+	return Range{From: addr, To: addr}
+}
+
+// Parse parses an address (such as 203.0.113.5) or a network in CIDR notation
+// (such as 203.0.113.0/24, or 2001:db8::/32), as the ip4 and ip6 mechanisms of
+// SPF records hold.
+func Parse(value string) (Range, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return Range{}, err
+		}
+
+		return FromPrefix(prefix), nil
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return Range{}, err
+	}
+
+	return FromAddr(addr), nil
+}
+
+// IsValid reports whether the range holds any addresses, which the zero Range
+// doesn't.
+func (r Range) IsValid() bool {
+	return r.From.IsValid() && r.To.IsValid() && r.From.Is4() == r.To.Is4() && r.From.Compare(r.To) <= 0
+}
+
+// Contains reports whether every address of other is in the range.
+func (r Range) Contains(other Range) bool {
+	// IPv4 addresses sort before IPv6 ones, so ranges of different families never contain one another
+	return r.From.Compare(other.From) <= 0 && other.To.Compare(r.To) <= 0
+}
+
+// Overlaps reports whether any address is in both ranges.
+func (r Range) Overlaps(other Range) bool {
+	return r.From.Compare(other.To) <= 0 && other.From.Compare(r.To) <= 0
+}
+
+// Prefixes returns the fewest networks the range is made up of, in order.
+func (r Range) Prefixes() []netip.Prefix {
+	if !r.IsValid() {
+		return nil
+	}
+
+	var prefixes []netip.Prefix
+
+	for from := r.From; from.IsValid() && from.Compare(r.To) <= 0; {
+		// the largest network starting at from that doesn't pass the end of the range
+		bits := from.BitLen()
+		for bits > 0 {
+			wider := netip.PrefixFrom(from, bits-1)
+			if wider.Masked().Addr() != from || lastAddr(wider).Compare(r.To) > 0 {
+				break
+			}
+
+			bits--
+		}
+
+		prefix := netip.PrefixFrom(from, bits)
+		prefixes = append(prefixes, prefix)
+
+		// the next address of the family's last is invalid, which ends the loop
+		from = lastAddr(prefix).Next()
+	}
+
+	return prefixes
+}
+
+// String returns the range as an address if it's a single one, a network in
+// CIDR notation if it's a single network, or its first and last addresses
+// joined by a hyphen otherwise.
+func (r Range) String() string {
+	if !r.IsValid() {
+		return "invalid range"
+	}
+
+	if r.From == r.To {
+		return r.From.String()
+	}
+
+	if prefixes := r.Prefixes(); len(prefixes) == 1 {
+		return prefixes[0].String()
+	}
+
+	return fmt.Sprintf("%s-%s", r.From, r.To)
+}
+
+// Add adds every address of the range to the set. Invalid ranges are ignored.
+func (s *Set) Add(r Range) {
+	if !r.IsValid() {
+		return
+	}
+
+	// the ranges from start to end overlap or touch r, so they're merged with it
+	start := sort.Search(len(s.ranges), func(index int) bool { return !before(s.ranges[index], r) })
+	end := start + sort.Search(len(s.ranges)-start, func(index int) bool { return before(r, s.ranges[start+index]) })
+
+	if start < end {
+		if s.ranges[start].From.Compare(r.From) < 0 {
+			r.From = s.ranges[start].From
+		}
+
+		if s.ranges[end-1].To.Compare(r.To) > 0 {
+			r.To = s.ranges[end-1].To
+		}
+	}
+
+	s.ranges = slices.Replace(s.ranges, start, end, r)
+}
+
+// AddSet adds every address of the other set to the set.
+func (s *Set) AddSet(other *Set) {
+	for _, r := range other.ranges {
+		s.Add(r)
+	}
+}
+
+// Covers reports whether every address of the range is in the set. The range
+// may span several of the ranges that were added to the set.
+func (s *Set) Covers(r Range) bool {
+	if !r.IsValid() {
+		return false
+	}
+
+	// ranges that touch are merged, so only a single one of the set's ranges can cover r
+	index := s.search(r.From)
+
+	return index < len(s.ranges) && s.ranges[index].Contains(r)
+}
+
+// Overlaps reports whether any address of the range is in the set.
+func (s *Set) Overlaps(r Range) bool {
+	if !r.IsValid() {
+		return false
+	}
+
+	index := s.search(r.From)
+
+	return index < len(s.ranges) && s.ranges[index].Overlaps(r)
+}
+
+// IsEmpty reports whether the set has no addresses.
+func (s *Set) IsEmpty() bool {
+	return len(s.ranges) == 0
+}
+
+// Ranges returns the set's addresses as the fewest ranges, in order.
+func (s *Set) Ranges() []Range {
+	return slices.Clone(s.ranges)
+}
+
+// Prefixes returns the set's addresses as the fewest networks, in order.
+func (s *Set) Prefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, r := range s.ranges {
+		prefixes = append(prefixes, r.Prefixes()...)
+	}
+
+	return prefixes
+}
+
+// search returns the index of the first of the set's ranges that doesn't end
+// before the address, or the number of ranges if they all do.
+func (s *Set) search(addr netip.Addr) int {
+	return sort.Search(len(s.ranges), func(index int) bool { return s.ranges[index].To.Compare(addr) >= 0 })
+}
+
+// before reports whether every address of a is before b, without a touching b
+// (as its last address is the one before b's first).
+func before(a, b Range) bool {
+	return a.To.Compare(b.From) < 0 && a.To.Next() != b.From
+}
+
+// lastAddr returns the last address of the network, with every bit outside
+// its mask set.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for bit := max(prefix.Bits(), 0); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+
+	addr, _ := netip.AddrFromSlice(bytes)
+
+	return addr
+}
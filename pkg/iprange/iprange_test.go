@@ -0,0 +1,262 @@
+package iprange
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mustParse parses each value as a range, failing the test if any is invalid.
+func mustParse(t *testing.T, values ...string) []Range {
+	t.Helper()
+
+	ranges := make([]Range, 0, len(values))
+
+	for _, value := range values {
+		r, err := Parse(value)
+		require.NoError(t, err, value)
+
+		ranges = append(ranges, r)
+	}
+
+	return ranges
+}
+
+// newSet returns a set of the parsed values.
+func newSet(t *testing.T, values ...string) *Set {
+	t.Helper()
+
+	var set Set
+	for _, r := range mustParse(t, values...) {
+		set.Add(r)
+	}
+
+	return &set
+}
+
+// rangeStrings returns the set's ranges as strings.
+func rangeStrings(set *Set) []string {
+	var values []string
+	for _, r := range set.Ranges() {
+		values = append(values, r.String())
+	}
+
+	return values
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		from, to string
+	}{
+		{"203.0.113.5", "203.0.113.5", "203.0.113.5"},
+		{"203.0.113.0/24", "203.0.113.0", "203.0.113.255"},
+		{"203.0.113.5/24", "203.0.113.0", "203.0.113.255"},
+		{"203.0.113.5/32", "203.0.113.5", "203.0.113.5"},
+		{"0.0.0.0/0", "0.0.0.0", "255.255.255.255"},
+		{"198.51.100.128/25", "198.51.100.128", "198.51.100.255"},
+		{"2001:db8::1", "2001:db8::1", "2001:db8::1"},
+		{"2001:db8::/32", "2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{"2001:db8:1234::/48", "2001:db8:1234::", "2001:db8:1234:ffff:ffff:ffff:ffff:ffff"},
+		{"2001:db8::/127", "2001:db8::", "2001:db8::1"},
+		{"::/0", "::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			r, err := Parse(test.value)
+			require.NoError(t, err)
+			require.Equal(t, netip.MustParseAddr(test.from), r.From)
+			require.Equal(t, netip.MustParseAddr(test.to), r.To)
+			require.True(t, r.IsValid())
+		})
+	}
+
+	for _, value := range []string{"", "203.0.113", "203.0.113.0/33", "2001:db8::/129", "example.com", "203.0.113.0/"} {
+		_, err := Parse(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestRange_String(t *testing.T) {
+	tests := []struct {
+		r        Range
+		expected string
+	}{
+		{mustParse(t, "203.0.113.5")[0], "203.0.113.5"},
+		{mustParse(t, "203.0.113.5/24")[0], "203.0.113.0/24"},
+		{mustParse(t, "2001:db8::/32")[0], "2001:db8::/32"},
+		{Range{From: netip.MustParseAddr("203.0.113.1"), To: netip.MustParseAddr("203.0.113.6")}, "203.0.113.1-203.0.113.6"},
+		{Range{From: netip.MustParseAddr("2001:db8::1"), To: netip.MustParseAddr("2001:db8::2")}, "2001:db8::1-2001:db8::2"},
+		{Range{}, "invalid range"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, test.r.String())
+	}
+}
+
+func TestRange_IsValid(t *testing.T) {
+	require.False(t, Range{}.IsValid())
+	require.False(t, Range{From: netip.MustParseAddr("203.0.113.6"), To: netip.MustParseAddr("203.0.113.1")}.IsValid())
+	require.False(t, Range{From: netip.MustParseAddr("203.0.113.1"), To: netip.MustParseAddr("2001:db8::1")}.IsValid())
+	require.True(t, Range{From: netip.MustParseAddr("203.0.113.1"), To: netip.MustParseAddr("203.0.113.1")}.IsValid())
+}
+
+func TestRange_Contains(t *testing.T) {
+	tests := []struct {
+		name     string
+		r, other string
+		contains bool
+		overlaps bool
+	}{
+		{"Equal", "203.0.113.0/24", "203.0.113.0/24", true, true},
+		{"Address", "203.0.113.0/24", "203.0.113.5", true, true},
+		{"FirstAddress", "203.0.113.0/24", "203.0.113.0", true, true},
+		{"LastAddress", "203.0.113.0/24", "203.0.113.255", true, true},
+		{"Subnet", "203.0.113.0/24", "203.0.113.128/25", true, true},
+		{"Supernet", "203.0.113.0/25", "203.0.113.0/24", false, true},
+		{"Adjacent", "203.0.113.0/25", "203.0.113.128/25", false, false},
+		{"Disjoint", "203.0.113.0/24", "198.51.100.0/24", false, false},
+		{"Everything", "0.0.0.0/0", "198.51.100.7", true, true},
+		{"IPv6Subnet", "2001:db8::/32", "2001:db8:1234::/48", true, true},
+		{"IPv6Address", "2001:db8::/32", "2001:db8::25", true, true},
+		{"IPv6Supernet", "2001:db8:1234::/48", "2001:db8::/32", false, true},
+		{"IPv6Disjoint", "2001:db8::/32", "2001:db9::/32", false, false},
+		{"IPv6Everything", "::/0", "2001:db8::1", true, true},
+		{"MixedFamilies", "0.0.0.0/0", "::/0", false, false},
+		{"IPv6ContainsNoIPv4", "::/0", "203.0.113.5", false, false},
+		{"IPv4InIPv6", "::ffff:0:0/96", "203.0.113.5", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ranges := mustParse(t, test.r, test.other)
+			require.Equal(t, test.contains, ranges[0].Contains(ranges[1]))
+			require.Equal(t, test.overlaps, ranges[0].Overlaps(ranges[1]))
+			require.Equal(t, test.overlaps, ranges[1].Overlaps(ranges[0]))
+		})
+	}
+}
+
+func TestRange_Prefixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		expected []string
+	}{
+		{"Address", "203.0.113.5", "203.0.113.5", []string{"203.0.113.5/32"}},
+		{"Network", "203.0.113.0", "203.0.113.255", []string{"203.0.113.0/24"}},
+		{"Unaligned", "203.0.113.1", "203.0.113.6", []string{"203.0.113.1/32", "203.0.113.2/31", "203.0.113.4/31", "203.0.113.6/32"}},
+		{"TwoNetworks", "198.51.100.0", "198.51.101.127", []string{"198.51.100.0/24", "198.51.101.0/25"}},
+		{"Everything", "0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"EndOfFamily", "255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}},
+		{"IPv6Network", "2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", []string{"2001:db8::/32"}},
+		{"IPv6Unaligned", "2001:db8::1", "2001:db8::4", []string{"2001:db8::1/128", "2001:db8::2/127", "2001:db8::4/128"}},
+		{"IPv6Everything", "::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"::/0"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := Range{From: netip.MustParseAddr(test.from), To: netip.MustParseAddr(test.to)}
+
+			var prefixes []string
+			for _, prefix := range r.Prefixes() {
+				prefixes = append(prefixes, prefix.String())
+			}
+
+			require.Equal(t, test.expected, prefixes)
+		})
+	}
+
+	require.Nil(t, Range{}.Prefixes())
+}
+
+func TestSet_Add(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		expected []string
+	}{
+		{"Empty", nil, nil},
+		{"Single", []string{"203.0.113.0/24"}, []string{"203.0.113.0/24"}},
+		{"Duplicate", []string{"203.0.113.0/24", "203.0.113.0/24"}, []string{"203.0.113.0/24"}},
+		{"Contained", []string{"203.0.113.0/24", "203.0.113.5"}, []string{"203.0.113.0/24"}},
+		{"Containing", []string{"203.0.113.5", "203.0.113.0/24"}, []string{"203.0.113.0/24"}},
+		{"Adjacent", []string{"203.0.113.0/25", "203.0.113.128/25"}, []string{"203.0.113.0/24"}},
+		{"AdjacentAddresses", []string{"203.0.113.2", "203.0.113.1", "203.0.113.3"}, []string{"203.0.113.1-203.0.113.3"}},
+		{"Overlapping", []string{"203.0.113.0/25", "203.0.113.64/26", "203.0.113.96/27", "203.0.113.112/28"}, []string{"203.0.113.0/25"}},
+		{"Sorted", []string{"203.0.113.0/24", "192.0.2.0/24", "198.51.100.0/24"}, []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24"}},
+		{"Bridging", []string{"203.0.113.0/26", "203.0.113.128/26", "203.0.113.64/26"}, []string{"203.0.113.0-203.0.113.191"}},
+		{"SpanningSeveral", []string{"192.0.2.1", "192.0.2.10", "192.0.2.20", "192.0.2.0/24"}, []string{"192.0.2.0/24"}},
+		{"EndOfFamily", []string{"255.255.255.255", "255.255.255.254"}, []string{"255.255.255.254/31"}},
+		{"IPv6", []string{"2001:db8::/33", "2001:db8:8000::/33"}, []string{"2001:db8::/32"}},
+		{"IPv6Contained", []string{"2001:db8:1234::/48", "2001:db8::/32", "2001:db8::1"}, []string{"2001:db8::/32"}},
+		{"MixedFamilies", []string{"2001:db8::/32", "255.255.255.255", "::"}, []string{"255.255.255.255", "::", "2001:db8::/32"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, rangeStrings(newSet(t, test.values...)))
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		var set Set
+		set.Add(Range{})
+		set.Add(Range{From: netip.MustParseAddr("203.0.113.6"), To: netip.MustParseAddr("203.0.113.1")})
+		require.True(t, set.IsEmpty())
+	})
+}
+
+func TestSet_Covers(t *testing.T) {
+	set := newSet(t, "203.0.113.0/25", "203.0.113.128/25", "198.51.100.0/24", "198.51.101.0/24", "192.0.2.10", "2001:db8::/32")
+
+	tests := []struct {
+		value    string
+		covers   bool
+		overlaps bool
+	}{
+		{"203.0.113.5", true, true},
+		{"203.0.113.0/24", true, true},
+		{"198.51.100.0/23", true, true},
+		{"198.51.100.0/22", false, true},
+		{"192.0.2.10", true, true},
+		{"192.0.2.0/24", false, true},
+		{"192.0.2.11", false, false},
+		{"10.0.0.0/8", false, false},
+		{"0.0.0.0/0", false, true},
+		{"2001:db8:1234::/48", true, true},
+		{"2001:db8::/31", false, true},
+		{"2001:db9::1", false, false},
+		{"::ffff:203.0.113.5", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			r := mustParse(t, test.value)[0]
+			require.Equal(t, test.covers, set.Covers(r))
+			require.Equal(t, test.overlaps, set.Overlaps(r))
+		})
+	}
+
+	var empty Set
+	require.False(t, empty.Covers(mustParse(t, "203.0.113.5")[0]))
+	require.False(t, empty.Overlaps(mustParse(t, "0.0.0.0/0")[0]))
+	require.False(t, set.Covers(Range{}))
+}
+
+func TestSet_AddSet(t *testing.T) {
+	set := newSet(t, "203.0.113.0/25", "2001:db8::/33")
+	set.AddSet(newSet(t, "203.0.113.128/25", "2001:db8:8000::/33", "192.0.2.1"))
+
+	require.Equal(t, []string{"192.0.2.1", "203.0.113.0/24", "2001:db8::/32"}, rangeStrings(set))
+
+	var prefixes []string
+	for _, prefix := range newSet(t, "203.0.113.1", "203.0.113.2/31").Prefixes() {
+		prefixes = append(prefixes, prefix.String())
+	}
+
+	require.Equal(t, []string{"203.0.113.1/32", "203.0.113.2/31"}, prefixes)
+}
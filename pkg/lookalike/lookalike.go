@@ -0,0 +1,168 @@
+// Package lookalike recognizes records that are near misses of a BIMI, DKIM,
+// DMARC or SPF record, such as "v=DMARC 1" or "v=spf1" wrapped in smart quotes,
+// which receivers ignore. It's deliberately more tolerant than the advisor's
+// checks, so that it can point out the exact typo and how to correct it.
+package lookalike
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type (
+	// Kind is a type of record that can be recognized.
+	Kind struct {
+		// Name is the name of the record type, such as "DMARC".
+		Name string
+
+		// version is the record's exact version tag, such as "v=DMARC1".
+		version string
+
+		// versionPattern matches the version tag and its near misses.
+		versionPattern *regexp.Regexp
+
+		// tagged is true for records made up of semicolon-separated tags, and
+		// false for SPF's space-separated terms.
+		tagged bool
+	}
+
+	// Record is a record that looks like a Kind, along with any typos found.
+	Record struct {
+		// Fixes lists each typo found, in the order they appear.
+		Fixes []Fix
+
+		// Corrected is the record with every typo fixed.
+		Corrected string
+	}
+
+	// Fix is a single typo and its correction.
+	Fix struct {
+		// Fragment is the part of the record containing the typo.
+		Fragment string
+
+		// Correction replaces the fragment. It's empty if the fragment should
+		// be removed.
+		Correction string
+	}
+)
+
+var (
+	BIMI  = newKind("BIMI", "v=BIMI1", "bimi", true)
+	DKIM  = newKind("DKIM", "v=DKIM1", "dkim", true)
+	DMARC = newKind("DMARC", "v=DMARC1", "dmarc", true)
+	SPF   = newKind("SPF", "v=spf1", "spf", false)
+
+	// quotes are the characters that end up in records pasted from documents
+	// or copied along with their zone file quoting.
+	quotes = []string{"“", "”", "„", "‘", "’", `"`}
+
+	// spacedEquals matches a tag's equals sign surrounded by whitespace.
+	spacedEquals = regexp.MustCompile(`\s*=\s*`)
+
+	// spacedTag matches the start of a tag following whitespace, which means
+	// the semicolon before it is missing.
+	spacedTag = regexp.MustCompile(`\s+[A-Za-z]+=`)
+
+	// spacedTerm matches an SPF mechanism or modifier with whitespace around
+	// its separator, such as "include: _spf.google.com".
+	spacedTerm = regexp.MustCompile(`(?i)\b(include|exists|ip4|ip6|a|mx|ptr|redirect|exp)(\s+[:=]\s*|[:=]\s+)(\S+)`)
+)
+
+func newKind(name, version, pattern string, tagged bool) Kind {
+	return Kind{
+		Name:           name,
+		version:        version,
+		versionPattern: regexp.MustCompile(`(?i)^\s*v\s*=\s*` + pattern + `(?:[\s_-]*1|\b)`),
+		tagged:         tagged,
+	}
+}
+
+// Detect returns the record's typos if it looks like the given kind of record,
+// or nil if it doesn't. A valid record returns no fixes.
+func Detect(kind Kind, record string) *Record {
+	result := &Record{}
+	unquoted := record
+
+	for _, quote := range quotes {
+		if strings.Contains(unquoted, quote) {
+			result.Fixes = append(result.Fixes, Fix{Fragment: quote})
+			unquoted = strings.ReplaceAll(unquoted, quote, "")
+		}
+	}
+
+	version := kind.versionPattern.FindString(unquoted)
+	if version == "" {
+		return nil
+	}
+
+	rest := unquoted[len(version):]
+	version = strings.TrimSpace(version)
+
+	if kind.tagged {
+		result.Corrected = result.detectTags(kind, version, rest)
+	} else {
+		result.Corrected = result.detectTerms(kind, version, rest)
+	}
+
+	return result
+}
+
+// detectTags finds the typos in the tags of a semicolon-separated record,
+// returning the corrected record.
+func (r *Record) detectTags(kind Kind, version, rest string) string {
+	segments := strings.Split(rest, ";")
+	head := kind.version + segments[0]
+
+	// anything between the version and the first semicolon is a tag missing its semicolon
+	if first := strings.TrimSpace(segments[0]); first != "" {
+		head = kind.version + "; " + fixTag(first)
+		r.Fixes = append(r.Fixes, Fix{Fragment: strings.TrimRightFunc(version+segments[0], unicode.IsSpace), Correction: head})
+	} else if version != kind.version {
+		r.Fixes = append(r.Fixes, Fix{Fragment: version, Correction: kind.version})
+	}
+
+	for index, segment := range segments[1:] {
+		tag := strings.TrimSpace(segment)
+
+		if fixed := fixTag(tag); fixed != tag {
+			r.Fixes = append(r.Fixes, Fix{Fragment: tag, Correction: fixed})
+			segments[index+1] = strings.Replace(segment, tag, fixed, 1)
+		}
+	}
+
+	return strings.Join(append([]string{head}, segments[1:]...), ";")
+}
+
+// detectTerms finds the typos in the terms of an SPF record, returning the
+// corrected record.
+func (r *Record) detectTerms(kind Kind, version, rest string) string {
+	if rest != "" && !strings.HasPrefix(rest, " ") {
+		term := strings.Fields(rest)[0]
+		r.Fixes = append(r.Fixes, Fix{Fragment: version + term, Correction: kind.version + " " + term})
+		rest = " " + rest
+	} else if version != kind.version {
+		r.Fixes = append(r.Fixes, Fix{Fragment: version, Correction: kind.version})
+	}
+
+	rest = spacedTerm.ReplaceAllStringFunc(rest, func(term string) string {
+		parts := spacedTerm.FindStringSubmatch(term)
+		fixed := parts[1] + strings.TrimSpace(parts[2]) + parts[3]
+
+		r.Fixes = append(r.Fixes, Fix{Fragment: term, Correction: fixed})
+
+		return fixed
+	})
+
+	return kind.version + rest
+}
+
+// fixTag removes the whitespace around a tag's equals sign, and separates any
+// tags missing the semicolon between them.
+func fixTag(tag string) string {
+	tag = spacedEquals.ReplaceAllString(tag, "=")
+
+	return spacedTag.ReplaceAllStringFunc(tag, func(next string) string {
+		return "; " + strings.TrimSpace(next)
+	})
+}
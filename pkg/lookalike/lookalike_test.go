@@ -0,0 +1,78 @@
+package lookalike
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	kinds := map[string]Kind{"BIMI": BIMI, "DKIM": DKIM, "DMARC": DMARC, "SPF": SPF}
+
+	file, err := os.Open("testdata/records.tsv")
+	require.NoError(t, err)
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		require.Len(t, fields, 3, "malformed fixture %q", line)
+
+		kind, ok := kinds[fields[0]]
+		require.True(t, ok, "unknown kind in fixture %q", line)
+
+		t.Run(fields[0]+"/"+fields[1], func(t *testing.T) {
+			record := Detect(kind, fields[1])
+
+			switch fields[2] {
+			case "none":
+				require.Nil(t, record)
+			case "valid":
+				require.NotNil(t, record)
+				require.Empty(t, record.Fixes)
+			default:
+				require.NotNil(t, record)
+				require.NotEmpty(t, record.Fixes)
+				require.Equal(t, fields[2], record.Corrected)
+
+				// the corrected record must itself be valid
+				corrected := Detect(kind, record.Corrected)
+				require.NotNil(t, corrected)
+				require.Empty(t, corrected.Fixes)
+			}
+		})
+	}
+
+	require.NoError(t, scanner.Err())
+}
+
+func TestDetect_Fragments(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   Kind
+		record string
+		fixes  []Fix
+	}{
+		{name: "Version", kind: DMARC, record: "v=DMARC 1; p=none", fixes: []Fix{{Fragment: "v=DMARC 1", Correction: "v=DMARC1"}}},
+		{name: "MissingSemicolon", kind: DMARC, record: "v=dmarc1 p=none", fixes: []Fix{{Fragment: "v=dmarc1 p=none", Correction: "v=DMARC1; p=none"}}},
+		{name: "SpacedEquals", kind: DMARC, record: "v=DMARC1; p = none", fixes: []Fix{{Fragment: "p = none", Correction: "p=none"}}},
+		{name: "SmartQuotes", kind: SPF, record: "“v=spf1 -all”", fixes: []Fix{{Fragment: "“"}, {Fragment: "”"}}},
+		{name: "SpacedTerm", kind: SPF, record: "v=spf 1 include: _spf.google.com ~all", fixes: []Fix{{Fragment: "v=spf 1", Correction: "v=spf1"}, {Fragment: "include: _spf.google.com", Correction: "include:_spf.google.com"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			record := Detect(test.kind, test.record)
+			require.NotNil(t, record)
+			require.Equal(t, test.fixes, record.Fixes)
+		})
+	}
+}
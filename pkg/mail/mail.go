@@ -157,7 +157,7 @@ func (s *Server) Login() (*imapClient.Client, error) {
 
 // SendMail takes a hermes.Email object, converts it into both html and plaintext,
 // and then send the email to the provided mailbox.
-func (s *Server) SendMail(mailbox string, result model.ScanResultWithAdvice) error {
+func (s *Server) SendMail(mailbox string, result model.ScanResult) error {
 	html, plaintext, err := s.getMailContents(result)
 	if err != nil {
 		return err
@@ -1,6 +1,7 @@
 package mail
 
 import (
+	"context"
 	"fmt"
 	htmlTmpl "html/template"
 	textTmpl "text/template"
@@ -109,15 +110,15 @@ func (s *Server) handler() error {
 			for _, result := range results {
 				sender := addresses[result.Domain].Address
 
-				resultWithAdvice := model.ScanResultWithAdvice{
-					ScanResult: result,
+				var advice *domainAdvisor.Advice
+				if s.advisor != nil && result.Error != scanner.ErrInvalidDomain {
+					advice = model.Advise(context.Background(), s.advisor, result, false)
 				}
 
-				if s.advisor != nil || result.Error != scanner.ErrInvalidDomain {
-					resultWithAdvice.Advice = s.advisor.CheckAll(result.Domain, result.BIMI, result.DKIM, result.DMARC, result.MX, result.SPF)
-				}
+				res := model.NewScanResult(result, advice, false)
+				res.Scanner = model.NewProvenance(s.Scanner, s.advisor)
 
-				if err = s.SendMail(sender, resultWithAdvice); err != nil {
+				if err = s.SendMail(sender, res); err != nil {
 					s.logger.Error().Err(err).Msg("An error occurred while sending scan results to " + sender)
 					continue
 				}
@@ -46,7 +46,7 @@ func (s *Server) initializeTemplates() error {
 	return nil
 }
 
-func (s *Server) getMailContents(result model.ScanResultWithAdvice) (string, string, error) {
+func (s *Server) getMailContents(result model.ScanResult) (string, string, error) {
 	var htmlBytes, textBytes bytes.Buffer
 
 	if result.Advice == nil {
@@ -56,6 +56,7 @@ func (s *Server) getMailContents(result model.ScanResultWithAdvice) (string, str
 	mailData := struct {
 		AdviceDomain, AdviceBIMI, AdviceDKIM, AdviceDMARC, AdviceMX, AdviceSPF string
 		ResultDomain, ResultBIMI, ResultDKIM, ResultDMARC, ResultMX, ResultSPF string
+		Scanner                                                                string
 	}{
 		AdviceDomain: stringify(result.Advice.Domain),
 		AdviceBIMI:   stringify(result.Advice.BIMI),
@@ -71,6 +72,10 @@ func (s *Server) getMailContents(result model.ScanResultWithAdvice) (string, str
 		ResultSPF:    result.ScanResult.SPF,
 	}
 
+	if result.Scanner != nil {
+		mailData.Scanner = result.Scanner.String()
+	}
+
 	// prevent template errors
 	if result.Advice == nil {
 		result.Advice = &advisor.Advice{}
@@ -0,0 +1,258 @@
+// Package metrics records the performance of scans as Prometheus metrics. The
+// same registry is served by the API server and by the CLI's bulk modes, so
+// both can be observed by the same scrapers.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/miekg/dns"
+)
+
+// buckets are the upper bounds of each histogram bucket, in seconds. They
+// extend Prometheus' defaults to cover slow TLS and SMTP probes.
+var buckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type (
+	// Registry holds the metrics recorded for every scanned domain, along with
+	// the DNS queries and SMTP probes counted by its Resolver and Dialer. It's
+	// safe for concurrent use, and serves the metrics in Prometheus' text
+	// format.
+	Registry struct {
+		checks     map[string]*histogram
+		dnsQueries atomic.Uint64
+		lookups    map[string]*histogram
+		mutex      sync.Mutex
+		results    map[string]uint64
+		scans      *histogram
+		smtpProbes atomic.Uint64
+	}
+
+	// resolver counts the queries sent to the resolver it wraps.
+	resolver struct {
+		next    scanner.Resolver
+		queries *atomic.Uint64
+	}
+
+	// dialer counts the SMTP connections opened through the dialer it wraps.
+	dialer struct {
+		next   advisor.Dialer
+		probes *atomic.Uint64
+	}
+
+	// histogram counts observations into cumulative buckets.
+	histogram struct {
+		counts []uint64
+		count  uint64
+		sum    float64
+	}
+)
+
+// New returns an empty Registry.
+func New() *Registry {
+	return &Registry{
+		checks:  make(map[string]*histogram),
+		lookups: make(map[string]*histogram),
+		results: make(map[string]uint64),
+		scans:   newHistogram(),
+	}
+}
+
+// Observe records a domain's scan, along with its advice (which may be nil if
+// the domain wasn't advised on). Cached results are recorded with the
+// durations of their original scan.
+func (r *Registry) Observe(result *scanner.Result, advice *advisor.Advice) {
+	if result == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch result.Error {
+	case "":
+		r.results["success"]++
+	case scanner.ErrInvalidDomain:
+		r.results["invalid"]++
+		return
+	default:
+		r.results["error"]++
+	}
+
+	r.scans.observe(result.Duration)
+	observeTimings(r.lookups, result.Timings, "_lookup")
+
+	if advice != nil {
+		observeTimings(r.checks, advice.Timings, "_check")
+	}
+}
+
+// Resolver wraps a scanner's resolver, counting every query sent to it. It's
+// intended for use with scanner.WithResolverMiddleware.
+func (r *Registry) Resolver(next scanner.Resolver) scanner.Resolver {
+	return &resolver{next: next, queries: &r.dnsQueries}
+}
+
+// Dialer wraps an advisor's dialer, counting the connections it opens to port
+// 25 as SMTP probes. It's intended for use with advisor.WithDialerMiddleware.
+// Probes made through a SOCKS5 proxy connect to the proxy instead, so they
+// aren't counted.
+func (r *Registry) Dialer(next advisor.Dialer) advisor.Dialer {
+	return &dialer{next: next, probes: &r.smtpProbes}
+}
+
+// DNSQueries returns the number of queries sent through the Resolver.
+func (r *Registry) DNSQueries() uint64 {
+	return r.dnsQueries.Load()
+}
+
+// SMTPProbes returns the number of connections to port 25 attempted through
+// the Dialer.
+func (r *Registry) SMTPProbes() uint64 {
+	return r.smtpProbes.Load()
+}
+
+// ServeHTTP writes the metrics in Prometheus' text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.Write(w)
+}
+
+// Write writes the metrics in Prometheus' text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var builder strings.Builder
+
+	builder.WriteString("# HELP dss_scans_total The number of domains scanned, by result.\n")
+	builder.WriteString("# TYPE dss_scans_total counter\n")
+
+	for _, result := range sortedKeys(r.results) {
+		builder.WriteString(fmt.Sprintf("dss_scans_total{result=%q} %d\n", result, r.results[result]))
+	}
+
+	builder.WriteString("# HELP dss_dns_queries_total The number of DNS queries sent.\n")
+	builder.WriteString("# TYPE dss_dns_queries_total counter\n")
+	builder.WriteString(fmt.Sprintf("dss_dns_queries_total %d\n", r.dnsQueries.Load()))
+
+	builder.WriteString("# HELP dss_smtp_probes_total The number of connections opened to mail servers' port 25.\n")
+	builder.WriteString("# TYPE dss_smtp_probes_total counter\n")
+	builder.WriteString(fmt.Sprintf("dss_smtp_probes_total %d\n", r.smtpProbes.Load()))
+
+	writeHistogram(&builder, "dss_scan_duration_seconds", "The duration of each domain's scan.", "", map[string]*histogram{"": r.scans})
+	writeHistogram(&builder, "dss_lookup_duration_seconds", "The duration of each DNS lookup, by record.", "lookup", r.lookups)
+	writeHistogram(&builder, "dss_check_duration_seconds", "The duration of each advisor check, by check.", "check", r.checks)
+
+	_, err := io.WriteString(w, builder.String())
+
+	return err
+}
+
+// Exchange counts the query, then sends it to the wrapped resolver.
+func (r *resolver) Exchange(msg *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	r.queries.Add(1)
+	return r.next.Exchange(msg, address)
+}
+
+// DialContext counts the connection if it's to port 25, then opens it with
+// the wrapped dialer.
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if _, port, err := net.SplitHostPort(address); err == nil && port == "25" {
+		d.probes.Add(1)
+	}
+
+	return d.next.DialContext(ctx, network, address)
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(duration time.Duration) {
+	seconds := duration.Seconds()
+
+	for index, bound := range buckets {
+		if seconds <= bound {
+			h.counts[index]++
+		}
+	}
+
+	h.count++
+	h.sum += seconds
+}
+
+// observeTimings records each timing with the given suffix (such as
+// "dmarc_lookup"), keyed by its name without the suffix.
+func observeTimings(histograms map[string]*histogram, timings map[string]string, suffix string) {
+	for name, value := range timings {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			continue
+		}
+
+		name = strings.TrimSuffix(name, suffix)
+		if histograms[name] == nil {
+			histograms[name] = newHistogram()
+		}
+
+		histograms[name].observe(duration)
+	}
+}
+
+// writeHistogram writes a histogram for each label value. An empty label
+// writes the histogram without any labels.
+func writeHistogram(builder *strings.Builder, name, help, label string, histograms map[string]*histogram) {
+	builder.WriteString("# HELP " + name + " " + help + "\n")
+	builder.WriteString("# TYPE " + name + " histogram\n")
+
+	for _, value := range sortedKeys(histograms) {
+		h := histograms[value]
+
+		labels := ""
+		if label != "" {
+			labels = fmt.Sprintf("%s=%q,", label, value)
+		}
+
+		for index, bound := range buckets {
+			builder.WriteString(fmt.Sprintf("%s_bucket{%sle=%q} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[index]))
+		}
+
+		builder.WriteString(fmt.Sprintf("%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count))
+
+		labels = strings.TrimSuffix(labels, ",")
+		if labels != "" {
+			labels = "{" + labels + "}"
+		}
+
+		builder.WriteString(fmt.Sprintf("%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64)))
+		builder.WriteString(fmt.Sprintf("%s_count%s %d\n", name, labels, h.count))
+	}
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
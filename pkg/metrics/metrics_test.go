@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// answeringResolver answers every query with an empty response.
+	answeringResolver struct{}
+
+	// refusingDialer refuses every connection, recording its address.
+	refusingDialer struct {
+		addresses []string
+	}
+)
+
+func (answeringResolver) Exchange(msg *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	return new(dns.Msg).SetReply(msg), 0, nil
+}
+
+func (d *refusingDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	d.addresses = append(d.addresses, address)
+	return nil, errors.New("connection refused")
+}
+
+func TestRegistry(t *testing.T) {
+	registry := New()
+
+	registry.Observe(&scanner.Result{Domain: "example.com", Duration: 30 * time.Millisecond, Timings: map[string]string{"dmarc_lookup": "20ms", "ns_lookup": "3ms"}}, &advisor.Advice{Timings: map[string]string{"mx_check": "8.4s"}})
+	registry.Observe(&scanner.Result{Domain: "example.org", Duration: 2 * time.Second, Error: "dmarc:timeout", Timings: map[string]string{"dmarc_lookup": "2s"}}, nil)
+	registry.Observe(&scanner.Result{Domain: "-example.net", Error: scanner.ErrInvalidDomain}, nil)
+	registry.Observe(nil, nil)
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+
+	output := recorder.Body.String()
+
+	for _, line := range []string{
+		"# TYPE dss_scans_total counter",
+		`dss_scans_total{result="error"} 1`,
+		`dss_scans_total{result="invalid"} 1`,
+		`dss_scans_total{result="success"} 1`,
+		"# TYPE dss_scan_duration_seconds histogram",
+		`dss_scan_duration_seconds_bucket{le="0.025"} 0`,
+		`dss_scan_duration_seconds_bucket{le="0.05"} 1`,
+		`dss_scan_duration_seconds_bucket{le="+Inf"} 2`,
+		"dss_scan_duration_seconds_sum 2.03",
+		"dss_scan_duration_seconds_count 2",
+		`dss_lookup_duration_seconds_bucket{lookup="dmarc",le="0.025"} 1`,
+		`dss_lookup_duration_seconds_bucket{lookup="dmarc",le="2.5"} 2`,
+		`dss_lookup_duration_seconds_count{lookup="dmarc"} 2`,
+		`dss_lookup_duration_seconds_count{lookup="ns"} 1`,
+		`dss_check_duration_seconds_bucket{check="mx",le="5"} 0`,
+		`dss_check_duration_seconds_bucket{check="mx",le="10"} 1`,
+		`dss_check_duration_seconds_sum{check="mx"} 8.4`,
+	} {
+		require.Contains(t, strings.Split(output, "\n"), line)
+	}
+}
+
+func TestRegistry_Concurrent(t *testing.T) {
+	registry := New()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			registry.Observe(&scanner.Result{Domain: "example.com", Timings: map[string]string{"spf_lookup": "1ms"}}, nil)
+
+			var builder strings.Builder
+			require.NoError(t, registry.Write(&builder))
+		}()
+	}
+
+	wg.Wait()
+
+	var builder strings.Builder
+	require.NoError(t, registry.Write(&builder))
+	require.Contains(t, builder.String(), `dss_lookup_duration_seconds_count{lookup="spf"} 50`)
+}
+
+func TestRegistry_Instrumentation(t *testing.T) {
+	registry := New()
+
+	resolver := registry.Resolver(answeringResolver{})
+	for _, name := range []string{"example.com.", "_dmarc.example.com."} {
+		response, _, err := resolver.Exchange(new(dns.Msg).SetQuestion(name, dns.TypeTXT), "192.0.2.53:53")
+		require.NoError(t, err)
+		require.Equal(t, name, response.Question[0].Name)
+	}
+
+	next := &refusingDialer{}
+	dialer := registry.Dialer(next)
+
+	for _, address := range []string{"192.0.2.25:25", "[2001:db8::25]:25", "192.0.2.1:443", "mx.example.com:587"} {
+		_, err := dialer.DialContext(context.Background(), "tcp", address)
+		require.Error(t, err)
+	}
+
+	// every connection is still opened by the wrapped dialer
+	require.Len(t, next.addresses, 4)
+	require.Equal(t, uint64(2), registry.DNSQueries())
+	require.Equal(t, uint64(2), registry.SMTPProbes())
+
+	var builder strings.Builder
+	require.NoError(t, registry.Write(&builder))
+
+	lines := strings.Split(builder.String(), "\n")
+	require.Contains(t, lines, "dss_dns_queries_total 2")
+	require.Contains(t, lines, "dss_smtp_probes_total 2")
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/goccy/go-json"
+)
+
+type (
+	// BulkScanRequest is the request body used to scan multiple domains.
+	BulkScanRequest struct {
+		Domains []BulkScanDomain `json:"domains" doc:"Domains to scan, each either the bare domain or an object overriding the request's options for it. Max 20 domains at a time, unless the server allows more."`
+		Checks  []string         `json:"checks,omitempty" doc:"The optional checks each domain is scanned with, unless it sets its own: tls probes its web and mail servers' TLS (even if the server doesn't by default), and offline skips every check that needs internet access (including tls)." example:"tls"`
+		Timeout string           `json:"timeout,omitempty" doc:"How long each domain's lookups and checks may take, unless it sets its own, formatted as in 30s or 2m. It can only shorten the server's own check timeout." example:"30s"`
+		Resolve []string         `json:"resolve,omitempty" maxItems:"20" doc:"Force the TLS checks' connections to a host and port to an address, formatted as host:port:address (like curl's --resolve), such as to check a new server before a DNS cutover. The host is still used for SNI and certificate verification, and the advice for each overridden connection is labeled with its address." example:"mail.example.com:25:203.0.113.10"`
+	}
+
+	// BulkScanResponse is the response body returned when scanning multiple domains.
+	BulkScanResponse struct {
+		Results []ScanResult `json:"results" doc:"The results of scanning the domains."`
+	}
+
+	// BulkScanDomain is a domain of a bulk scan request, along with any
+	// options overriding the request's for it. It's given as the bare domain
+	// if it has no options of its own, or as an object otherwise.
+	BulkScanDomain struct {
+		Domain string `json:"domain" doc:"Domain to scan." example:"example.com"`
+		ScanOptions
+	}
+
+	// ScanOptions are the options a domain of a bulk request is scanned with.
+	// Unset options fall back to the request's.
+	ScanOptions struct {
+		Selectors []string `json:"selectors,omitempty" yaml:"selectors,omitempty" doc:"Only look up DKIM keys at these selectors (skipping the common selectors), reporting whether a key was found at each. Max 5 selectors." example:"mail2023"`
+		Checks    []string `json:"checks,omitempty" yaml:"checks,omitempty" doc:"The optional checks to scan the domain with: tls probes its web and mail servers' TLS (even if the server doesn't by default), and offline skips every check that needs internet access (including tls)." example:"tls"`
+		Timeout   string   `json:"timeout,omitempty" yaml:"timeout,omitempty" doc:"How long the domain's lookups and checks may take, formatted as in 30s or 2m. It can only shorten the server's own check timeout." example:"30s"`
+	}
+
+	// bulkScanDomainObject is a BulkScanDomain given as an object, without
+	// its methods, so it's marshaled and described as a plain struct.
+	bulkScanDomainObject BulkScanDomain
+)
+
+// BulkScanDomains returns the domains as entries of a bulk scan request
+// without options of their own.
+func BulkScanDomains(domains ...string) []BulkScanDomain {
+	entries := make([]BulkScanDomain, 0, len(domains))
+	for _, domain := range domains {
+		entries = append(entries, BulkScanDomain{Domain: domain})
+	}
+
+	return entries
+}
+
+// MarshalJSON marshals the entry as the bare domain if it has no options of
+// its own, or as an object otherwise.
+func (d BulkScanDomain) MarshalJSON() ([]byte, error) {
+	if d.ScanOptions.empty() {
+		return json.Marshal(d.Domain)
+	}
+
+	return json.Marshal(bulkScanDomainObject(d))
+}
+
+// UnmarshalJSON unmarshals the entry from either the bare domain or an
+// object.
+func (d *BulkScanDomain) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '"' {
+		*d = BulkScanDomain{}
+		return json.Unmarshal(trimmed, &d.Domain)
+	}
+
+	var object bulkScanDomainObject
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+
+	*d = BulkScanDomain(object)
+
+	return nil
+}
+
+// Schema describes the entry as either the bare domain or an object. The
+// domain and options are only validated by type, so the API can explain
+// each invalid value on its own, rather than as a mismatch of both schemas.
+func (BulkScanDomain) Schema(registry huma.Registry) *huma.Schema {
+	return &huma.Schema{
+		OneOf: []*huma.Schema{
+			{Type: huma.TypeString, Description: "The domain to scan, with the request's options.", Examples: []any{"example.com"}},
+			registry.Schema(reflect.TypeOf(bulkScanDomainObject{}), true, "BulkScanDomainObject"),
+		},
+	}
+}
+
+// empty reports whether none of the options are set.
+func (o ScanOptions) empty() bool {
+	return len(o.Selectors) == 0 && len(o.Checks) == 0 && o.Timeout == ""
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkScanDomain_JSON(t *testing.T) {
+	var request BulkScanRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"domains":["example.com",{"domain":"example.org","selectors":["mail2023"],"checks":["tls"],"timeout":"30s"},{"domain":"example.net"}]}`), &request))
+
+	require.Equal(t, []BulkScanDomain{
+		{Domain: "example.com"},
+		{Domain: "example.org", ScanOptions: ScanOptions{Selectors: []string{"mail2023"}, Checks: []string{"tls"}, Timeout: "30s"}},
+		{Domain: "example.net"},
+	}, request.Domains)
+
+	// entries without options of their own are marshaled as bare domains, as clients from before options sent them
+	data, err := json.Marshal(request)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"domains":["example.com",{"domain":"example.org","selectors":["mail2023"],"checks":["tls"],"timeout":"30s"},"example.net"]}`, string(data))
+
+	require.Equal(t, []BulkScanDomain{{Domain: "example.com"}, {Domain: "example.org"}}, BulkScanDomains("example.com", "example.org"))
+}
+
+func TestBulkScanDomain_Schema(t *testing.T) {
+	registry := huma.NewMapRegistry("#/components/schemas/", huma.DefaultSchemaNamer)
+	schema := registry.Schema(reflect.TypeOf(BulkScanRequest{}), true, "")
+
+	tests := []struct {
+		name  string
+		body  string
+		valid bool
+	}{
+		{"Bare", `{"domains":["example.com"]}`, true},
+		{"Object", `{"domains":[{"domain":"example.com","selectors":["mail2023"],"checks":["offline"],"timeout":"5s"}]}`, true},
+		{"Mixed", `{"domains":["example.com",{"domain":"example.org"}],"checks":["tls"],"timeout":"1m"}`, true},
+		{"Number", `{"domains":[42]}`, false},
+		{"MissingDomain", `{"domains":[{"selectors":["mail2023"]}]}`, false},
+		{"UnknownOption", `{"domains":[{"domain":"example.com","selector":"mail2023"}]}`, false},
+		{"SelectorsNotArray", `{"domains":[{"domain":"example.com","selectors":"mail2023"}]}`, false},
+		// the values are only validated by the API, which explains each invalid one
+		{"UnknownCheck", `{"domains":[{"domain":"example.com","checks":["dmarc"]}]}`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body any
+			require.NoError(t, json.Unmarshal([]byte(test.body), &body))
+
+			result := &huma.ValidateResult{}
+			huma.Validate(registry, schema, huma.NewPathBuffer([]byte{}, 0), huma.ModeWriteToServer, body, result)
+			require.Equal(t, test.valid, len(result.Errors) == 0, result.Errors)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+)
+
+const (
+	// FindingNew, FindingPersisting and FindingResolved are the statuses of a
+	// finding compared with the domain's previous scan.
+	FindingNew        = "new"
+	FindingPersisting = "persisting"
+	FindingResolved   = "resolved"
+)
+
+// Annotate compares the result's advice with the domain's previous scan,
+// setting the status of each of its findings (which are added if the result
+// isn't detailed), and listing the previous scan's findings that are no longer
+// reported under Resolved. Nothing is annotated if there's no previous scan,
+// or if either scan failed, as a partial scan would report findings as
+// resolved (or new) that haven't changed.
+//
+// Advice lines have no codes, so findings are matched by their check and
+// their normalized message (see findingKey), which doesn't depend on the order
+// of the advice or the case of any hostnames in it.
+func (s *ScanResult) Annotate(previous *ScanResult) {
+	if previous == nil || previous.Advice == nil || s.Advice == nil || failed(previous) || failed(s) {
+		return
+	}
+
+	reported := make(map[string]struct{})
+	for _, finding := range previous.Advice.Findings() {
+		reported[findingKey(finding.Check, finding.Message)] = struct{}{}
+	}
+
+	current := make(map[string]struct{})
+	s.Findings, s.Resolved = nil, nil
+
+	for _, finding := range s.Advice.Findings() {
+		key := findingKey(finding.Check, finding.Message)
+		current[key] = struct{}{}
+
+		status := FindingNew
+		if _, ok := reported[key]; ok {
+			status = FindingPersisting
+		}
+
+		s.Findings = append(s.Findings, newFinding(finding, status))
+	}
+
+	for _, finding := range previous.Advice.Findings() {
+		key := findingKey(finding.Check, finding.Message)
+		if _, ok := current[key]; ok {
+			continue
+		}
+
+		// repeated lines are only resolved once
+		current[key] = struct{}{}
+		s.Resolved = append(s.Resolved, newFinding(finding, FindingResolved))
+	}
+}
+
+// newFinding returns the advisor's finding with the given status (empty if
+// it isn't annotated).
+func newFinding(finding advisor.Finding, status string) Finding {
+	return Finding{
+		Check:       finding.Check,
+		Message:     finding.Message,
+		Severity:    finding.Severity.String(),
+		Status:      status,
+		Reference:   finding.Reference,
+		Remediation: finding.Remediation,
+	}
+}
+
+// failed reports whether the result's scan failed, either entirely or in part,
+// including any of its checks.
+func failed(result *ScanResult) bool {
+	return len(result.Errors) > 0 || result.ScanResult != nil && result.ScanResult.Error != ""
+}
+
+// findingKey identifies a finding across scans by its check and its message,
+// lowercased with its whitespace collapsed, and with any trailing punctuation
+// stripped from each word (so "mx.example.com." matches "mx.example.com").
+func findingKey(check, message string) string {
+	words := strings.Fields(strings.ToLower(message))
+	for index, word := range words {
+		words[index] = strings.TrimRight(word, ".,;:")
+	}
+
+	return check + ":" + strings.Join(words, " ")
+}
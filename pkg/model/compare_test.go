@@ -0,0 +1,64 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanResult_Annotate(t *testing.T) {
+	previous := &ScanResult{
+		ScanResult: &scanner.Result{Domain: "example.com"},
+		Advice: &advisor.Advice{
+			MX:  []string{"Mail server MX1.example.com. doesn't support STARTTLS.", "Mail server mx2.example.com doesn't support STARTTLS."},
+			SPF: []string{"Your SPF record ends in +all, which allows anyone to send mail as your domain."},
+		},
+	}
+
+	current := func() *ScanResult {
+		return &ScanResult{
+			ScanResult: &scanner.Result{Domain: "example.com"},
+			Advice: &advisor.Advice{
+				// reordered, with the hostnames normalized differently
+				MX:    []string{"Mail server mx2.example.com. doesn't support STARTTLS.", "Mail server mx1.example.com doesn't support STARTTLS."},
+				DMARC: []string{"You do not have DMARC setup!"},
+				SPF:   []string{"SPF seems to be setup correctly! No further action needed."},
+			},
+		}
+	}
+
+	result := current()
+	result.Annotate(previous)
+
+	require.Equal(t, []Finding{
+		{
+			Check: "dmarc", Message: "You do not have DMARC setup!", Severity: advisor.Classify("You do not have DMARC setup!").String(), Status: FindingNew,
+			Reference: "https://www.rfc-editor.org/rfc/rfc7489#section-6.1", Remediation: "Publish a DMARC record at _dmarc.<domain>, starting at p=none with a rua tag.",
+		},
+		{Check: "mx", Message: "Mail server mx2.example.com. doesn't support STARTTLS.", Severity: "info", Status: FindingPersisting},
+		{Check: "mx", Message: "Mail server mx1.example.com doesn't support STARTTLS.", Severity: "info", Status: FindingPersisting},
+		{Check: "spf", Message: "SPF seems to be setup correctly! No further action needed.", Severity: "info", Status: FindingNew},
+	}, result.Findings)
+
+	require.Equal(t, []Finding{
+		{Check: "spf", Message: "Your SPF record ends in +all, which allows anyone to send mail as your domain.", Severity: advisor.Classify("Your SPF record ends in +all, which allows anyone to send mail as your domain.").String(), Status: FindingResolved},
+	}, result.Resolved)
+
+	t.Run("NoPreviousScan", func(t *testing.T) {
+		result := current()
+		result.Annotate(nil)
+		require.Nil(t, result.Findings)
+		require.Nil(t, result.Resolved)
+	})
+
+	t.Run("FailedScan", func(t *testing.T) {
+		// a partial scan would resolve every finding of the lookups that failed
+		result := current()
+		result.ScanResult.Error = "spf:timeout"
+		result.Annotate(previous)
+		require.Nil(t, result.Findings)
+		require.Nil(t, result.Resolved)
+	})
+}
@@ -0,0 +1,332 @@
+package model
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+// the caps on the size of a result's explanations, which would otherwise grow
+// with every TXT record and MX host the domain publishes
+const (
+	maxExplanations     = 100
+	maxExplainedRecords = 10
+	maxExplainedLength  = 255
+)
+
+// spfLookupLimit is the number of DNS lookups SPF allows (RFC 7208, section 4.6.4).
+const spfLookupLimit = 10
+
+type (
+	// Explanation is the evidence behind a line of advice: the rule that
+	// classified it, the parts of the record it's about, the DNS answers its
+	// check consulted, and the limits the check compared them against.
+	Explanation struct {
+		Check      string            `json:"check" yaml:"check" doc:"The check the advice is from." example:"dmarc"`
+		Message    string            `json:"message" yaml:"message" doc:"The advice." example:"You are currently at the lowest level and receiving reports, which is a great starting point."`
+		Severity   string            `json:"severity" yaml:"severity" enum:"critical,high,medium,low,info" doc:"How urgently the advice should be acted on." example:"medium"`
+		Rule       string            `json:"rule,omitempty" yaml:"rule,omitempty" doc:"The phrase of the advice catalog entry that classified the advice, which is empty for advice outside the catalog, such as that of a check that passed." example:"You are currently at the lowest level"`
+		Fragments  []string          `json:"fragments,omitempty" yaml:"fragments,omitempty" doc:"The tags or terms of the check's record that the advice is about, in the record's order." example:"p=none"`
+		Answers    []ExplainedAnswer `json:"answers,omitempty" yaml:"answers,omitempty" doc:"The DNS answers behind the check's records."`
+		Thresholds map[string]string `json:"thresholds,omitempty" yaml:"thresholds,omitempty" doc:"The limits the check compares the records against, as configured for the scan." example:"{\"spfFanoutLimit\":\"20\",\"spfLookupLimit\":\"10\"}"`
+		Truncated  bool              `json:"truncated,omitempty" yaml:"truncated,omitempty" doc:"Whether the explanation's fragments or answers were cut short, as they exceeded the caps on an explanation's size."`
+	}
+
+	// ExplainedAnswer is a DNS answer behind a check's records.
+	ExplainedAnswer struct {
+		Name    string   `json:"name" yaml:"name" doc:"The name that was looked up." example:"_dmarc.example.com"`
+		Type    string   `json:"type" yaml:"type" doc:"The type of record that was looked up." example:"TXT"`
+		Rcode   string   `json:"rcode,omitempty" yaml:"rcode,omitempty" doc:"The response code explaining why no record was found, if none was." example:"NXDOMAIN"`
+		Records []string `json:"records,omitempty" yaml:"records,omitempty" doc:"The records the check used from the answer." example:"v=DMARC1; p=none; rua=mailto:dmarc@example.com"`
+	}
+)
+
+// ExplainThresholds returns the limits each check compares records against,
+// by check, as configured for the scanner and advisor (which may be nil), for
+// use with Explain.
+func ExplainThresholds(sc *scanner.Scanner, domainAdvisor *advisor.Advisor) map[string]map[string]string {
+	thresholds := map[string]map[string]string{
+		"spf": {"spfLookupLimit": strconv.Itoa(spfLookupLimit)},
+	}
+
+	if sc != nil {
+		config := sc.Config()
+		thresholds["spf"]["spfFanoutLimit"] = strconv.Itoa(config.SPFFanoutLimit)
+		thresholds["txt"] = map[string]string{
+			"answerSizeLimit": strconv.Itoa(config.AnswerSizeLimit),
+			"txtRecordLimit":  strconv.Itoa(config.TXTRecordLimit),
+		}
+	}
+
+	if domainAdvisor != nil {
+		config := domainAdvisor.Config()
+		thresholds["dkim"] = map[string]string{"dkimRotationMonths": strconv.Itoa(config.DKIMRotationMonths)}
+
+		if config.RDAP != "" {
+			thresholds["domain"] = map[string]string{"rdapExpiryWindow": config.RDAPExpiryWindow.String()}
+		}
+	}
+
+	return thresholds
+}
+
+// Explain attaches an explanation of each line of the result's advice (see
+// ExplainThresholds). The explanations are built from the result alone, so
+// the same result is always explained the same way. They're kept apart from
+// the findings, so they never count towards a domain's score, and are capped
+// in size.
+func (s *ScanResult) Explain(thresholds map[string]map[string]string) {
+	s.Explanations = nil
+
+	if s.Advice == nil || s.ScanResult == nil {
+		return
+	}
+
+	for _, finding := range s.Advice.Findings() {
+		if len(s.Explanations) == maxExplanations {
+			break
+		}
+
+		explanation := Explanation{
+			Check:      finding.Check,
+			Message:    finding.Message,
+			Severity:   finding.Severity.String(),
+			Rule:       finding.Rule,
+			Thresholds: thresholds[finding.Check],
+		}
+
+		var truncated bool
+
+		explanation.Fragments, truncated = capRecords(matchFragments(finding.Check, finding.Message, recordTerms(s.ScanResult, finding.Check)))
+		explanation.Answers = explainedAnswers(s.ScanResult, finding.Check)
+
+		for index := range explanation.Answers {
+			var answerTruncated bool
+			explanation.Answers[index].Records, answerTruncated = capRecords(explanation.Answers[index].Records)
+			truncated = truncated || answerTruncated
+		}
+
+		explanation.Truncated = truncated
+		s.Explanations = append(s.Explanations, explanation)
+	}
+}
+
+// recordTerms returns the tags (or, for SPF, the terms) of the record the
+// check evaluates, in the record's order.
+func recordTerms(result *scanner.Result, check string) []string {
+	var record string
+
+	switch check {
+	case "arc":
+		record = result.ARC
+	case "bimi":
+		record = result.BIMI
+	case "dkim":
+		record = result.DKIM
+	case "dmarc":
+		record = result.DMARC
+		if record == "" && result.Organizational != nil {
+			record = result.Organizational.DMARC
+		}
+	case "spf":
+		return strings.Fields(result.SPF)
+	}
+
+	var terms []string
+
+	for _, tag := range strings.Split(record, ";") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			terms = append(terms, tag)
+		}
+	}
+
+	return terms
+}
+
+// matchFragments returns the terms the advice is about: those it quotes, and
+// the tags it names (such as "the ‘rua’ tag" or "p=reject"). DMARC's policy
+// levels are the p tag's.
+func matchFragments(check, message string, terms []string) []string {
+	var fragments []string
+
+	lower := strings.ToLower(message)
+	for _, term := range terms {
+		lowerTerm := strings.ToLower(term)
+
+		name, _, isTag := strings.Cut(lowerTerm, "=")
+		if !isTag {
+			// SPF mechanisms, such as include:_spf.example.net or -all
+			name = strings.TrimLeft(strings.SplitN(lowerTerm, ":", 2)[0], "+-~?")
+		}
+
+		switch {
+		case strings.Contains(lower, lowerTerm),
+			isTag && mentionsTag(lower, name),
+			!isTag && strings.Contains(lower, " "+name+" tag"),
+			check == "dmarc" && name == "p" && strings.Contains(lower, " level"):
+			fragments = append(fragments, term)
+		}
+	}
+
+	return fragments
+}
+
+// mentionsTag reports whether the lowercase advice names the tag, as
+// "name=", "‘name’" or "the name tag".
+func mentionsTag(message, name string) bool {
+	if strings.Contains(message, "‘"+name+"’") || strings.Contains(message, "'"+name+"'") || strings.Contains(message, " "+name+" tag") {
+		return true
+	}
+
+	// "p=" mustn't match "sp="
+	for offset := 0; ; {
+		index := strings.Index(message[offset:], name+"=")
+		if index < 0 {
+			return false
+		}
+
+		index += offset
+		if before, _ := utf8.DecodeLastRuneInString(message[:index]); index == 0 || !unicode.IsLetter(before) {
+			return true
+		}
+
+		offset = index + len(name)
+	}
+}
+
+// explainedAnswers returns the DNS answers behind the check's records, as
+// recorded in the scan result.
+func explainedAnswers(result *scanner.Result, check string) []ExplainedAnswer {
+	domain := result.Domain
+
+	switch check {
+	case "domain":
+		var answers []ExplainedAnswer
+		if len(result.NS) > 0 {
+			answers = append(answers, ExplainedAnswer{Name: domain, Type: "NS", Records: result.NS})
+		}
+
+		var ipv4, ipv6 []string
+		for _, address := range result.Addresses {
+			if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+				ipv6 = append(ipv6, address)
+			} else {
+				ipv4 = append(ipv4, address)
+			}
+		}
+
+		if len(ipv4) > 0 {
+			answers = append(answers, ExplainedAnswer{Name: domain, Type: "A", Records: ipv4})
+		}
+
+		if len(ipv6) > 0 {
+			answers = append(answers, ExplainedAnswer{Name: domain, Type: "AAAA", Records: ipv6})
+		}
+
+		return answers
+	case "arc":
+		if result.ARC == "" {
+			return nil
+		}
+
+		return []ExplainedAnswer{{Name: result.ARCSelector + "._domainkey." + domain, Type: "TXT", Records: []string{result.ARC}}}
+	case "bimi":
+		return []ExplainedAnswer{txtAnswer("default._bimi."+domain, result.BIMI, result.Rcodes["bimi"])}
+	case "dkim":
+		return dkimAnswers(result)
+	case "dmarc":
+		answers := []ExplainedAnswer{txtAnswer("_dmarc."+domain, result.DMARC, result.Rcodes["dmarc"])}
+
+		// a subdomain without a DMARC record of its own inherits its organizational domain's
+		if result.DMARC == "" && result.Organizational != nil && result.Organizational.DMARC != "" {
+			answers = append(answers, txtAnswer("_dmarc."+result.Organizational.Domain, result.Organizational.DMARC, ""))
+		}
+
+		return answers
+	case "mtasts":
+		if len(result.MTASTS) == 0 {
+			return nil
+		}
+
+		return []ExplainedAnswer{{Name: "_mta-sts." + domain, Type: "TXT", Records: result.MTASTS}}
+	case "mx":
+		return []ExplainedAnswer{{Name: domain, Type: "MX", Records: result.MX}}
+	case "soa":
+		if result.SOA == nil {
+			return nil
+		}
+
+		soa := result.SOA
+		record := strings.Join([]string{soa.MName, soa.RName, strconv.FormatUint(uint64(soa.Serial), 10), strconv.FormatUint(uint64(soa.Refresh), 10), strconv.FormatUint(uint64(soa.Retry), 10), strconv.FormatUint(uint64(soa.Expire), 10), strconv.FormatUint(uint64(soa.Minimum), 10)}, " ")
+
+		return []ExplainedAnswer{{Name: domain, Type: "SOA", Records: []string{record}}}
+	case "spf":
+		answers := []ExplainedAnswer{txtAnswer(domain, result.SPF, "")}
+		for _, redirect := range result.SPFRedirects {
+			answers = append(answers, txtAnswer(redirect.Domain, redirect.Record, ""))
+		}
+
+		return answers
+	case "txt":
+		return []ExplainedAnswer{{Name: domain, Type: "TXT", Records: result.TXT}}
+	}
+
+	return nil
+}
+
+// dkimAnswers returns the answers behind the DKIM keys: every key found, or
+// the one the result has, or else each supplied selector that was looked up.
+func dkimAnswers(result *scanner.Result) []ExplainedAnswer {
+	var answers []ExplainedAnswer
+
+	switch {
+	case len(result.DKIMKeys) > 0:
+		for _, key := range result.DKIMKeys {
+			answers = append(answers, txtAnswer(key.Selector+"._domainkey."+result.Domain, key.Record, ""))
+		}
+	case result.DKIMSelector != "":
+		answers = append(answers, txtAnswer(result.DKIMSelector+"._domainkey."+result.Domain, result.DKIM, ""))
+	default:
+		for _, check := range result.DKIMSelectorChecks {
+			answers = append(answers, txtAnswer(check.Selector+"._domainkey."+result.Domain, "", result.Rcodes["dkim"]))
+		}
+	}
+
+	return answers
+}
+
+// txtAnswer returns the answer of a TXT lookup of the name, which found the
+// record if it's set, or else the response code explaining why not.
+func txtAnswer(name, record, rcode string) ExplainedAnswer {
+	if record != "" {
+		return ExplainedAnswer{Name: name, Type: "TXT", Records: []string{record}}
+	}
+
+	return ExplainedAnswer{Name: name, Type: "TXT", Rcode: rcode}
+}
+
+// capRecords caps the number and length of the records, reporting whether
+// any were cut short.
+func capRecords(records []string) ([]string, bool) {
+	if records == nil {
+		return nil, false
+	}
+
+	truncated := len(records) > maxExplainedRecords
+
+	capped := make([]string, 0, min(len(records), maxExplainedRecords))
+	for _, record := range records[:min(len(records), maxExplainedRecords)] {
+		if utf8.RuneCountInString(record) > maxExplainedLength {
+			record, truncated = string([]rune(record)[:maxExplainedLength-1])+"…", true
+		}
+
+		capped = append(capped, record)
+	}
+
+	return capped, truncated
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanResult_Explain(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false)
+	t.Cleanup(domainAdvisor.Close)
+
+	result := &scanner.Result{
+		Domain:       "example.com",
+		Addresses:    []string{"192.0.2.10", "2001:db8::10"},
+		NS:           []string{"ns1.example.net.", "ns2.example.net."},
+		DKIM:         "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC",
+		DKIMSelector: "google",
+		DMARC:        "v=DMARC1; p=none; rua=mailto:dmarc@example.com",
+		MX:           []string{"aspmx.l.google.com."},
+		SPF:          "v=spf1 include:_spf.google.com +all",
+		Rcodes:       map[string]string{"bimi": "NXDOMAIN"},
+	}
+
+	advice := domainAdvisor.Lint("", result.DKIM, result.DMARC, result.MX, result.SPF)
+
+	res := NewScanResult(result, advice, false)
+	res.Explain(ExplainThresholds(nil, domainAdvisor))
+
+	t.Run("Golden", func(t *testing.T) {
+		output, err := json.MarshalIndent(res.Explanations, "", "  ")
+		require.NoError(t, err)
+
+		golden := filepath.Join("testdata", "explain.golden.json")
+		if *update {
+			require.NoError(t, os.MkdirAll("testdata", 0o755))
+			require.NoError(t, os.WriteFile(golden, append(output, '\n'), 0o644))
+		}
+
+		expected, err := os.ReadFile(golden)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(output)+"\n")
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		again := NewScanResult(result, advice, false)
+		again.Explain(ExplainThresholds(nil, domainAdvisor))
+		require.Equal(t, res.Explanations, again.Explanations)
+	})
+
+	t.Run("Scoring", func(t *testing.T) {
+		// the explanations don't change the findings a domain is scored by
+		explained, summary := NewSummary(1), NewSummary(1)
+		explained.Add(&res)
+
+		plain := NewScanResult(result, advice, false)
+		summary.Add(&plain)
+
+		require.Equal(t, summary.WorstOffenders, explained.WorstOffenders)
+	})
+
+	t.Run("Unadvised", func(t *testing.T) {
+		unadvised := NewScanResult(result, nil, false)
+		unadvised.Explain(nil)
+		require.Nil(t, unadvised.Explanations)
+	})
+}
+
+func TestMatchFragments(t *testing.T) {
+	dmarc := []string{"v=DMARC1", "p=none", "sp=reject", "rua=mailto:dmarc@example.com"}
+
+	tests := []struct {
+		check    string
+		message  string
+		terms    []string
+		expected []string
+	}{
+		{"dmarc", "You are currently at the lowest level, which is a great starting point. Please add the ‘rua’ tag to your DMARC policy.", dmarc, []string{"p=none", "rua=mailto:dmarc@example.com"}},
+		{"dmarc", "Consider specifying a sp= tag", dmarc, []string{"sp=reject"}},
+		{"dmarc", "The beginning of your DMARC record should be v=DMARC1", dmarc, []string{"v=DMARC1"}},
+		{"spf", "Your SPF record contains the +all tag", []string{"v=spf1", "include:_spf.example.net", "+all"}, []string{"+all"}},
+		{"dkim", "Your DKIM key is at the highest level of security", []string{"v=DKIM1", "p=KEY"}, nil},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, matchFragments(test.check, test.message, test.terms), test.message)
+	}
+}
+
+func TestCapRecords(t *testing.T) {
+	records := make([]string, maxExplainedRecords+1)
+	for index := range records {
+		records[index] = "record"
+	}
+
+	capped, truncated := capRecords(records)
+	require.Len(t, capped, maxExplainedRecords)
+	require.True(t, truncated)
+
+	capped, truncated = capRecords([]string{strings.Repeat("a", maxExplainedLength+1)})
+	require.Equal(t, []string{strings.Repeat("a", maxExplainedLength-1) + "…"}, capped)
+	require.True(t, truncated)
+
+	capped, truncated = capRecords([]string{"v=spf1 -all"})
+	require.Equal(t, []string{"v=spf1 -all"}, capped)
+	require.False(t, truncated)
+}
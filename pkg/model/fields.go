@@ -0,0 +1,318 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+type (
+	// FieldSelection is a pruned copy of a result, containing only the
+	// requested dot-separated field paths (such as "scanResult.dmarc").
+	FieldSelection struct {
+		Fields []string
+		Values map[string]any
+
+		// source holds the unpruned values, as pruning re-indexes selected slice elements.
+		source map[string]any
+	}
+
+	// fieldNode is a trie of requested path segments.
+	fieldNode struct {
+		children map[string]*fieldNode
+		leaf     bool
+	}
+)
+
+// SelectFields prunes data down to the given dot-separated field paths, using
+// the JSON names of each field. Fields are validated against data's type, so
+// a field that's valid but empty for this particular result is omitted rather
+// than rejected.
+func SelectFields(data any, fields []string) (*FieldSelection, error) {
+	if err := ValidateFields(reflect.TypeOf(data), fields); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var values map[string]any
+	if err = decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	root := &fieldNode{}
+	for _, field := range fields {
+		root.add(strings.Split(field, "."))
+	}
+
+	pruned, _ := prune(values, root).(map[string]any)
+
+	return &FieldSelection{Fields: fields, Values: pruned, source: values}, nil
+}
+
+// ValidateFields checks that every field path exists within the given type,
+// returning an error listing the available paths if one doesn't.
+func ValidateFields(t reflect.Type, fields []string) error {
+	paths, mapPaths := fieldPaths(t)
+
+	for _, field := range fields {
+		if !validField(paths, mapPaths, field) {
+			return fmt.Errorf("unknown field %q, available fields: %s", field, strings.Join(paths, ", "))
+		}
+	}
+
+	return nil
+}
+
+// FieldPaths returns every dot-separated field path available within the
+// given type. Slices are traversed transparently, so a slice of structs
+// exposes its element's fields beneath the slice's own path.
+func FieldPaths(t reflect.Type) []string {
+	paths, _ := fieldPaths(t)
+	return paths
+}
+
+// MarshalJSON encodes the selection as its pruned values.
+func (f *FieldSelection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Values)
+}
+
+// MarshalYAML encodes the selection as its pruned values.
+func (f *FieldSelection) MarshalYAML() (any, error) {
+	return f.Values, nil
+}
+
+// CSV returns one column per selected field, in the order they were requested.
+// Multiple values (such as slices) are joined with "; ".
+func (f *FieldSelection) CSV() []string {
+	columns := make([]string, 0, len(f.Fields))
+
+	for _, field := range f.Fields {
+		columns = append(columns, csvValue(extract(f.source, strings.Split(field, "."))))
+	}
+
+	return columns
+}
+
+func (n *fieldNode) add(segments []string) {
+	if len(segments) == 0 {
+		n.leaf = true
+		return
+	}
+
+	if n.children == nil {
+		n.children = make(map[string]*fieldNode)
+	}
+
+	child, ok := n.children[segments[0]]
+	if !ok {
+		child = &fieldNode{}
+		n.children[segments[0]] = child
+	}
+
+	child.add(segments[1:])
+}
+
+// fieldPaths returns every field path within the given type, along with the
+// subset of those paths that are maps (and so accept arbitrary keys).
+func fieldPaths(t reflect.Type) ([]string, map[string]struct{}) {
+	var paths []string
+	mapPaths := make(map[string]struct{})
+
+	collectPaths(t, "", &paths, mapPaths, 0)
+	sort.Strings(paths)
+
+	return paths, mapPaths
+}
+
+func collectPaths(t reflect.Type, prefix string, paths *[]string, mapPaths map[string]struct{}, depth int) {
+	// guard against recursive types
+	if depth > 8 {
+		return
+	}
+
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+
+	if t.Kind() == reflect.Map {
+		mapPaths[prefix] = struct{}{}
+		return
+	}
+
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		// embedded structs without a name are flattened into their parent
+		if field.Anonymous && name == "" {
+			collectPaths(field.Type, prefix, paths, mapPaths, depth+1)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		*paths = append(*paths, path)
+		collectPaths(field.Type, path, paths, mapPaths, depth+1)
+	}
+}
+
+func validField(paths []string, mapPaths map[string]struct{}, field string) bool {
+	// numeric segments index into slices, so they aren't part of the type's paths
+	var segments []string
+	for _, segment := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(segment); err != nil {
+			segments = append(segments, segment)
+		}
+	}
+
+	normalized := strings.Join(segments, ".")
+
+	for _, path := range paths {
+		if path == normalized {
+			return true
+		}
+	}
+
+	// map fields (such as timings) accept arbitrary keys beneath them
+	for index := len(segments) - 1; index > 0; index-- {
+		if _, ok := mapPaths[strings.Join(segments[:index], ".")]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func prune(value any, node *fieldNode) any {
+	if node.leaf {
+		return value
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		pruned := make(map[string]any)
+
+		for key, child := range node.children {
+			if childValue, ok := typed[key]; ok {
+				pruned[key] = prune(childValue, child)
+			}
+		}
+
+		return pruned
+	case []any:
+		var indexes []int
+		for key := range node.children {
+			if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < len(typed) {
+				indexes = append(indexes, index)
+			}
+		}
+
+		// numeric segments select individual elements, otherwise the selection applies to every element
+		if len(indexes) > 0 {
+			sort.Ints(indexes)
+
+			pruned := make([]any, 0, len(indexes))
+			for _, index := range indexes {
+				pruned = append(pruned, prune(typed[index], node.children[strconv.Itoa(index)]))
+			}
+
+			return pruned
+		}
+
+		pruned := make([]any, 0, len(typed))
+		for _, element := range typed {
+			pruned = append(pruned, prune(element, node))
+		}
+
+		return pruned
+	}
+
+	return nil
+}
+
+func extract(value any, segments []string) any {
+	if len(segments) == 0 {
+		return value
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		return extract(typed[segments[0]], segments[1:])
+	case []any:
+		if index, err := strconv.Atoi(segments[0]); err == nil {
+			if index < 0 || index >= len(typed) {
+				return nil
+			}
+
+			return extract(typed[index], segments[1:])
+		}
+
+		var extracted []any
+		for _, element := range typed {
+			if elementValue := extract(element, segments); elementValue != nil {
+				extracted = append(extracted, elementValue)
+			}
+		}
+
+		return extracted
+	}
+
+	return nil
+}
+
+func csvValue(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case json.Number:
+		return typed.String()
+	case bool:
+		return strconv.FormatBool(typed)
+	case []any:
+		values := make([]string, 0, len(typed))
+		for _, element := range typed {
+			values = append(values, csvValue(element))
+		}
+
+		return strings.Join(values, "; ")
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	return string(encoded)
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+func testResult(domain string) ScanResult {
+	return ScanResult{
+		ScanResult: &scanner.Result{
+			Domain: domain,
+			DMARC:  "v=DMARC1; p=reject;",
+			MX:     []string{"mx1." + domain + ".", "mx2." + domain + "."},
+			SPF:    "v=spf1 -all",
+		},
+		Advice: &advisor.Advice{
+			DMARC: []string{"You are at the highest level!"},
+		},
+		Timings: map[string]string{"dmarc_lookup": "12ms"},
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	t.Run("Nested", func(t *testing.T) {
+		selection, err := SelectFields(testResult("example.com"), []string{"scanResult.dmarc", "advice.dmarc"})
+		require.NoError(t, err)
+
+		encoded, err := json.Marshal(selection)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"scanResult":{"dmarc":"v=DMARC1; p=reject;"},"advice":{"dmarc":["You are at the highest level!"]}}`, string(encoded))
+		require.Equal(t, []string{"v=DMARC1; p=reject;", "You are at the highest level!"}, selection.CSV())
+	})
+
+	t.Run("SliceField", func(t *testing.T) {
+		selection, err := SelectFields(testResult("example.com"), []string{"scanResult.mx"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"mx1.example.com.; mx2.example.com."}, selection.CSV())
+	})
+
+	t.Run("SliceIndex", func(t *testing.T) {
+		selection, err := SelectFields(testResult("example.com"), []string{"scanResult.mx.1"})
+		require.NoError(t, err)
+
+		encoded, err := json.Marshal(selection)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"scanResult":{"mx":["mx2.example.com."]}}`, string(encoded))
+		require.Equal(t, []string{"mx2.example.com."}, selection.CSV())
+	})
+
+	t.Run("SliceOfStructs", func(t *testing.T) {
+		response := BulkScanResponse{Results: []ScanResult{testResult("example.com"), testResult("example.org")}}
+
+		selection, err := SelectFields(response, []string{"results.scanResult.domain", "results.scanResult.spf"})
+		require.NoError(t, err)
+
+		encoded, err := json.Marshal(selection)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"results":[{"scanResult":{"domain":"example.com","spf":"v=spf1 -all"}},{"scanResult":{"domain":"example.org","spf":"v=spf1 -all"}}]}`, string(encoded))
+		require.Equal(t, []string{"example.com; example.org", "v=spf1 -all; v=spf1 -all"}, selection.CSV())
+	})
+
+	t.Run("MapKey", func(t *testing.T) {
+		selection, err := SelectFields(testResult("example.com"), []string{"timings.dmarc_lookup"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"12ms"}, selection.CSV())
+	})
+
+	t.Run("EmptyField", func(t *testing.T) {
+		selection, err := SelectFields(testResult("example.com"), []string{"scanResult.bimi"})
+		require.NoError(t, err)
+		require.Equal(t, []string{""}, selection.CSV())
+	})
+
+	t.Run("UnknownField", func(t *testing.T) {
+		_, err := SelectFields(testResult("example.com"), []string{"scanResult.dmarc.policy"})
+		require.ErrorContains(t, err, `unknown field "scanResult.dmarc.policy"`)
+		require.ErrorContains(t, err, "scanResult.dmarc")
+
+		_, err = SelectFields(testResult("example.com"), []string{"dmarc"})
+		require.ErrorContains(t, err, "available fields: advice, advice.arc, advice.bimi")
+	})
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+)
+
+type (
+	// LintRequest is the request body used to validate records before they're
+	// published. Only the records that are provided are checked.
+	LintRequest struct {
+		BIMI  string   `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"The BIMI record to validate." example:"v=BIMI1; l=https://example.com/logo.svg; a=https://example.com/cert.pem"`
+		DKIM  string   `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"The DKIM record to validate." example:"v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`
+		DMARC string   `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The DMARC record to validate." example:"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"`
+		MX    []string `json:"mx,omitempty" yaml:"mx,omitempty" maxItems:"20" doc:"The mail server hostnames to validate." example:"mx1.example.com"`
+		SPF   string   `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The SPF record to validate." example:"v=spf1 include:_spf.example.com -all"`
+	}
+
+	// LintResponse is the response body returned when validating records.
+	LintResponse struct {
+		Advice *advisor.Advice `json:"advice" yaml:"advice" doc:"The advice for the provided records."`
+	}
+)
+
+// Empty reports whether no records were provided.
+func (l *LintRequest) Empty() bool {
+	return l.BIMI == "" && l.DKIM == "" && l.DMARC == "" && len(l.MX) == 0 && l.SPF == ""
+}
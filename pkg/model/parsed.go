@@ -0,0 +1,64 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+// ParsedRecords holds a domain's records parsed into their parts, so clients
+// don't each need to parse the raw records in ScanResult.
+type ParsedRecords struct {
+	BIMI  map[string]string `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"The tags of the BIMI record." example:"{\"v\":\"BIMI1\",\"l\":\"https://example.com/logo.svg\"}"`
+	DKIM  map[string]string `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"The tags of the DKIM record." example:"{\"v\":\"DKIM1\",\"k\":\"rsa\"}"`
+	DMARC map[string]string `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The tags of the DMARC record." example:"{\"v\":\"DMARC1\",\"p\":\"reject\"}"`
+	SPF   []string          `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The mechanisms and modifiers of the SPF record, in order." example:"include:_spf.google.com"`
+}
+
+// ParseRecords returns the scan result's records parsed into their parts, or
+// nil if it has none.
+func ParseRecords(result *scanner.Result) *ParsedRecords {
+	parsed := &ParsedRecords{
+		BIMI:  parseTags(result.BIMI),
+		DKIM:  parseTags(result.DKIM),
+		DMARC: parseTags(result.DMARC),
+	}
+
+	// the SPF version is implied by the record being an SPF record
+	if terms := strings.Fields(result.SPF); len(terms) > 1 {
+		parsed.SPF = terms[1:]
+	}
+
+	if parsed.BIMI == nil && parsed.DKIM == nil && parsed.DMARC == nil && parsed.SPF == nil {
+		return nil
+	}
+
+	return parsed
+}
+
+// parseTags parses a tag-value list (such as a DMARC record) into its tags,
+// keyed by their lowercase names. Tags without a value are skipped, and the
+// last of any repeated tag wins.
+func parseTags(record string) map[string]string {
+	var tags map[string]string
+
+	for _, tag := range strings.Split(record, ";") {
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+
+		tags[name] = strings.TrimSpace(value)
+	}
+
+	return tags
+}
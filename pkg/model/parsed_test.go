@@ -0,0 +1,24 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRecords(t *testing.T) {
+	require.Nil(t, ParseRecords(&scanner.Result{Domain: "example.com"}))
+
+	parsed := ParseRecords(&scanner.Result{
+		DKIM:  "v=DKIM1; k=rsa; p=MIIBIjANBg==",
+		DMARC: "v=DMARC1;P=reject; rua=mailto:dmarc@example.com;; pct=50; pct=100; fo",
+		SPF:   "v=spf1 include:_spf.google.com  ~all",
+	})
+
+	require.Equal(t, &ParsedRecords{
+		DKIM:  map[string]string{"v": "DKIM1", "k": "rsa", "p": "MIIBIjANBg=="},
+		DMARC: map[string]string{"v": "DMARC1", "p": "reject", "rua": "mailto:dmarc@example.com", "pct": "100"},
+		SPF:   []string{"include:_spf.google.com", "~all"},
+	}, parsed)
+}
@@ -0,0 +1,442 @@
+package model
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+)
+
+const (
+	// planPassThreshold is the share of the messages in a domain's aggregate
+	// reports that must pass DMARC before its policy is enforced.
+	planPassThreshold = 0.98
+
+	// planMonitoringWeeks is how many weeks of aggregate reports are reviewed
+	// after they're first requested, before the policy is enforced.
+	planMonitoringWeeks = 3
+
+	// planStageWeeks is how many weeks each enforcement stage runs for before
+	// the next, so its reports can be reviewed.
+	planStageWeeks = 2
+)
+
+// planStages are the DMARC policy stages a rollout moves through, from
+// monitoring to rejecting all mail failing DMARC.
+var planStages = []planStage{
+	{policy: "quarantine", percentage: 25},
+	{policy: "quarantine", percentage: 50},
+	{policy: "quarantine", percentage: 100},
+	{policy: "reject", percentage: 100},
+}
+
+// dmarcTagOrder is the order the tags of a planned DMARC record are written
+// in. Any other tags follow, sorted.
+var dmarcTagOrder = []string{"v", "p", "sp", "pct", "rua", "ruf", "adkim", "aspf", "fo", "rf", "ri"}
+
+type (
+	// Plan is an ordered plan for rolling out DMARC enforcement for a domain,
+	// from the records it publishes now, with the exact records to publish at
+	// each step. Steps that are already done are left out, and the blockers to
+	// enforcing the policy come first.
+	Plan struct {
+		Domain   string     `json:"domain" yaml:"domain" doc:"The domain the plan is for." example:"example.com"`
+		Policy   string     `json:"policy" yaml:"policy" doc:"The domain's DMARC policy now, none if it has no valid DMARC record." example:"p=none"`
+		Complete bool       `json:"complete" yaml:"complete" doc:"Whether the domain already rejects all mail failing DMARC, so there are no steps left." example:"false"`
+		Steps    []PlanStep `json:"steps,omitempty" yaml:"steps,omitempty" doc:"The steps left, in order."`
+	}
+
+	// PlanStep is a single step of a DMARC rollout plan.
+	PlanStep struct {
+		Week    int    `json:"week" yaml:"week" doc:"The week of the rollout the step is due in, counting from 1 for the week the plan is followed from." example:"4"`
+		Action  string `json:"action" yaml:"action" doc:"What to do." example:"Move your DMARC policy to p=quarantine with pct=25, so receivers quarantine 25% of mail failing DMARC, and deliver the other 75%."`
+		Name    string `json:"name,omitempty" yaml:"name,omitempty" doc:"The name of the record to publish, if the step publishes one." example:"_dmarc.example.com"`
+		Record  string `json:"record,omitempty" yaml:"record,omitempty" doc:"The exact record to publish, if the step publishes one that can be generated." example:"v=DMARC1; p=quarantine; pct=25; rua=mailto:dmarc@example.com"`
+		Blocker bool   `json:"blocker,omitempty" yaml:"blocker,omitempty" doc:"Whether the step must be done before the policy is enforced." example:"false"`
+	}
+
+	// PlanInput is what a DMARC rollout plan is built from.
+	PlanInput struct {
+		Domain string
+
+		// Records are the domain's records, as parsed by ParseRecords, or nil
+		// if it has none.
+		Records *ParsedRecords
+
+		// MX is whether the domain has mail servers, which a generated SPF
+		// record authorizes.
+		MX bool
+
+		// ReportMailbox receives the aggregate reports, if the domain doesn't
+		// request them yet. It defaults to dmarc@ the domain.
+		ReportMailbox string
+
+		// Reports summarizes the domain's aggregate reports, if they're
+		// available, so the policy is only enforced once they show its mail
+		// passes.
+		Reports *ReportSummary
+	}
+
+	// ReportSummary summarizes DMARC aggregate reports (RFC 7489, appendix
+	// C), as parsed by ParseAggregateReport.
+	ReportSummary struct {
+		// Domain is the domain the reports are for.
+		Domain string
+
+		// Messages is the number of messages reported, and Passing the number
+		// of them that passed DMARC (with an aligned SPF or DKIM pass).
+		Messages int
+		Passing  int
+
+		// Failing is the number of messages failing DMARC from each source
+		// IP address.
+		Failing map[string]int
+
+		// Forwarded is the number of the messages failing DMARC that look
+		// forwarded, by the domain that signed them: their SPF didn't pass
+		// for any domain, while a DKIM signature of a domain that isn't
+		// aligned with their From domain passed, as a forwarder or mailing
+		// list re-signing them. A sender whose SPF passes for a domain of its
+		// own (such as an ESP's bounce domain) isn't counted, as it needs
+		// alignment set up instead.
+		Forwarded map[string]int
+	}
+
+	planStage struct {
+		policy     string
+		percentage int
+	}
+
+	// aggregateReport is the part of an aggregate report that's summarized.
+	aggregateReport struct {
+		Domain  string `xml:"policy_published>domain"`
+		Records []struct {
+			Source     string       `xml:"row>source_ip"`
+			Count      int          `xml:"row>count"`
+			DKIM       string       `xml:"row>policy_evaluated>dkim"`
+			SPF        string       `xml:"row>policy_evaluated>spf"`
+			HeaderFrom string       `xml:"identifiers>header_from"`
+			Signatures []authResult `xml:"auth_results>dkim"`
+			SPFResults []authResult `xml:"auth_results>spf"`
+		} `xml:"record"`
+	}
+
+	// authResult is a DKIM or SPF result of an aggregate report's record,
+	// before DMARC's alignment is applied.
+	authResult struct {
+		Domain string `xml:"domain"`
+		Result string `xml:"result"`
+	}
+)
+
+// NewPlan returns the plan for rolling out DMARC enforcement from the
+// domain's records. Domains that don't send mail (whose SPF record only has
+// -all, and that have no DKIM key) go straight to p=reject, while the others
+// request aggregate reports, then move from p=quarantine at pct=25 to
+// p=reject over the following weeks. Missing SPF records and DKIM keys, and
+// reports showing that less than 98% of the domain's mail passes DMARC, are
+// blockers that hold back the enforcement steps.
+func NewPlan(input PlanInput) *Plan {
+	domain := strings.ToLower(strings.TrimSuffix(input.Domain, "."))
+
+	records := input.Records
+	if records == nil {
+		records = &ParsedRecords{}
+	}
+
+	mailbox := input.ReportMailbox
+	if mailbox == "" {
+		mailbox = "dmarc@" + domain
+	}
+
+	tags := make(map[string]string)
+	if strings.EqualFold(records.DMARC["v"], "DMARC1") {
+		for name, value := range records.DMARC {
+			tags[name] = value
+		}
+	}
+
+	policy, percentage := strings.ToLower(tags["p"]), 100
+	if value, err := strconv.Atoi(tags["pct"]); err == nil {
+		percentage = min(max(value, 0), 100)
+	}
+
+	if policy != "quarantine" && policy != "reject" {
+		policy = "none"
+	}
+
+	plan := &Plan{Domain: domain, Policy: "p=" + policy}
+	if policy != "none" && percentage < 100 {
+		plan.Policy += "; pct=" + strconv.Itoa(percentage)
+	}
+
+	name := "_dmarc." + domain
+	nonSending := len(records.SPF) == 1 && records.SPF[0] == "-all" && records.DKIM == nil
+
+	// a domain that doesn't send mail has no mail to break, so it's rejected outright
+	if nonSending {
+		if policy != "reject" || percentage < 100 || (tags["sp"] != "" && !strings.EqualFold(tags["sp"], "reject")) {
+			tags["v"], tags["p"] = "DMARC1", "reject"
+			delete(tags, "pct")
+			delete(tags, "sp")
+
+			if tags["rua"] == "" {
+				tags["rua"] = "mailto:" + mailbox
+			}
+
+			plan.Steps = append(plan.Steps, PlanStep{Week: 1, Action: "Move your DMARC policy to p=reject, as your domain doesn't send mail, so receivers reject all mail claiming to be from it and its subdomains.", Name: name, Record: dmarcRecord(tags)})
+		}
+
+		plan.Complete = len(plan.Steps) == 0
+
+		return plan
+	}
+
+	// the blockers are fixed while the reports are reviewed, and hold back enforcing the policy
+	start := 1
+
+	if records.SPF == nil {
+		spf := "v=spf1 ~all"
+		if input.MX {
+			spf = "v=spf1 mx ~all"
+		}
+
+		plan.Steps = append(plan.Steps, PlanStep{Week: 1, Action: "Publish an SPF record, with an include: mechanism for each service that sends mail as your domain before the ~all, as DMARC relies on SPF or DKIM passing for your mail.", Name: domain, Record: spf, Blocker: true})
+		start = 1 + planStageWeeks
+	}
+
+	if records.DKIM == nil {
+		plan.Steps = append(plan.Steps, PlanStep{Week: 1, Action: "Enable DKIM signing with each service that sends mail as your domain, and publish the keys they issue, as mail that's forwarded only passes DMARC with DKIM.", Name: "<selector>._domainkey." + domain, Blocker: true})
+		start = 1 + planStageWeeks
+	}
+
+	if reports := input.Reports; reports != nil && reports.Messages > 0 && float64(reports.Passing)/float64(reports.Messages) < planPassThreshold {
+		plan.Steps = append(plan.Steps, PlanStep{Week: 1, Action: fmt.Sprintf("Only %.1f%% of the %d messages in your aggregate reports pass DMARC. Authorize the sources failing it (%s) with SPF or DKIM, or stop them sending as your domain, until at least %.0f%% pass.", float64(reports.Passing)*100/float64(reports.Messages), reports.Messages, topCounts(reports.Failing, 3), planPassThreshold*100), Blocker: true})
+		start = 1 + planStageWeeks
+	}
+
+	// forwarded mail can't be authorized by the domain, so it's only advised on
+	if reports := input.Reports; reports != nil && len(reports.Forwarded) > 0 {
+		var forwarded int
+		for _, count := range reports.Forwarded {
+			forwarded += count
+		}
+
+		plan.Steps = append(plan.Steps, PlanStep{Week: 1, Action: fmt.Sprintf("%d of the messages failing DMARC in your aggregate reports look forwarded, as their SPF failed while a DKIM signature of another domain passed (%s). Ask those forwarders and mailing lists to seal the mail they forward with ARC, so receivers can trust its original authentication, or leave them out when reviewing your reports, as they're not sources to authorize.", forwarded, topCounts(reports.Forwarded, 3))})
+	}
+
+	// the reports show what enforcing the policy would break, so they're requested first
+	if tags["rua"] == "" {
+		action := "Add a rua tag to your DMARC record, to receive aggregate reports on the mail sent as your domain, and whether it passes DMARC."
+		if len(tags) == 0 {
+			tags["v"], tags["p"] = "DMARC1", "none"
+			action = "Publish a DMARC record at p=none with a rua tag, to receive aggregate reports on the mail sent as your domain, and whether it passes DMARC."
+		}
+
+		tags["rua"] = "mailto:" + mailbox
+
+		plan.Steps = append(plan.Steps, PlanStep{Week: 1, Action: action, Name: name, Record: dmarcRecord(tags)})
+		start = max(start, 1+planMonitoringWeeks)
+	}
+
+	week := start
+	current := stageValue(policy, percentage)
+
+	for _, stage := range planStages {
+		if stageValue(stage.policy, stage.percentage) <= current {
+			continue
+		}
+
+		tags["p"] = stage.policy
+		if stage.percentage < 100 {
+			tags["pct"] = strconv.Itoa(stage.percentage)
+		} else {
+			delete(tags, "pct")
+		}
+
+		action := fmt.Sprintf("Move your DMARC policy to p=%s, so receivers %s.", stage.policy, advisor.EffectiveDMARCPolicy(stage.policy, stage.percentage))
+		if stage.percentage < 100 {
+			action = fmt.Sprintf("Move your DMARC policy to p=%s with pct=%d, so receivers %s.", stage.policy, stage.percentage, advisor.EffectiveDMARCPolicy(stage.policy, stage.percentage))
+		}
+
+		plan.Steps = append(plan.Steps, PlanStep{Week: week, Action: action + " Review your aggregate reports first, and hold back if your legitimate mail doesn't pass.", Name: name, Record: dmarcRecord(tags)})
+		week += planStageWeeks
+	}
+
+	// an sp tag weaker than p leaves the subdomains unprotected once the domain is
+	if sp := strings.ToLower(tags["sp"]); sp != "" && sp != "reject" {
+		tags["p"] = "reject"
+		delete(tags, "pct")
+		delete(tags, "sp")
+
+		plan.Steps = append(plan.Steps, PlanStep{Week: week, Action: fmt.Sprintf("Remove the sp=%s tag from your DMARC record, so your subdomains get p=reject too, once your aggregate reports show their mail passes.", sp), Name: name, Record: dmarcRecord(tags)})
+	}
+
+	plan.Complete = len(plan.Steps) == 0
+
+	return plan
+}
+
+// stageValue orders the DMARC policy stages, from 0 for p=none to 3 for
+// p=reject at 100%.
+func stageValue(policy string, percentage int) float64 {
+	switch policy {
+	case "quarantine":
+		return 1 + float64(percentage)/100
+	case "reject":
+		return 2 + float64(percentage)/100
+	}
+
+	return 0
+}
+
+// dmarcRecord writes the DMARC record with the tags, in dmarcTagOrder.
+func dmarcRecord(tags map[string]string) string {
+	var names []string
+	for name := range tags {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		indexI, indexJ := tagIndex(names[i]), tagIndex(names[j])
+		if indexI != indexJ {
+			return indexI < indexJ
+		}
+
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+tags[name])
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// tagIndex returns the position of the tag in dmarcTagOrder, or its length if
+// it's not listed.
+func tagIndex(name string) int {
+	for index, ordered := range dmarcTagOrder {
+		if ordered == name {
+			return index
+		}
+	}
+
+	return len(dmarcTagOrder)
+}
+
+// ParseAggregateReport parses a DMARC aggregate report (RFC 7489, appendix C),
+// which may be gzipped, into its summary.
+func ParseAggregateReport(r io.Reader) (*ReportSummary, error) {
+	buffered := bufio.NewReader(r)
+
+	// gzipped reports start with the gzip magic number
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress report: %w", err)
+		}
+		defer decompressed.Close()
+
+		r = decompressed
+	} else {
+		r = buffered
+	}
+
+	var report aggregateReport
+	if err := xml.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to parse report: %w", err)
+	}
+
+	summary := &ReportSummary{Domain: strings.ToLower(strings.TrimSpace(report.Domain)), Failing: make(map[string]int), Forwarded: make(map[string]int)}
+
+	for _, record := range report.Records {
+		summary.Messages += record.Count
+
+		// the evaluated results are only pass if the identifier also aligns
+		if strings.EqualFold(record.DKIM, "pass") || strings.EqualFold(record.SPF, "pass") {
+			summary.Passing += record.Count
+			continue
+		}
+
+		summary.Failing[strings.TrimSpace(record.Source)] += record.Count
+
+		from := strings.TrimSpace(record.HeaderFrom)
+		if from == "" {
+			from = summary.Domain
+		}
+
+		// mail relayed by a forwarder fails SPF, while a sender of its own passes it for its domain
+		if slices.ContainsFunc(record.SPFResults, func(result authResult) bool { return strings.EqualFold(result.Result, "pass") }) {
+			continue
+		}
+
+		// a passing signature that doesn't align (in relaxed mode) is a forwarder's, rather than the sender's
+		for _, signature := range record.Signatures {
+			if strings.EqualFold(signature.Result, "pass") && advisor.OrganizationalDomain(signature.Domain) != advisor.OrganizationalDomain(from) {
+				summary.Forwarded[strings.ToLower(strings.TrimSpace(signature.Domain))] += record.Count
+				break
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+// Add adds another summary's counts to the summary.
+func (s *ReportSummary) Add(other *ReportSummary) {
+	s.Messages += other.Messages
+	s.Passing += other.Passing
+
+	if s.Failing == nil {
+		s.Failing = make(map[string]int)
+	}
+
+	for source, count := range other.Failing {
+		s.Failing[source] += count
+	}
+
+	if s.Forwarded == nil {
+		s.Forwarded = make(map[string]int)
+	}
+
+	for domain, count := range other.Forwarded {
+		s.Forwarded[domain] += count
+	}
+}
+
+// topCounts lists the keys with the highest counts, such as the sources with
+// the most messages failing DMARC, at most limit of them, with their counts.
+func topCounts(counts map[string]int, limit int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	listed := make([]string, 0, limit)
+	for _, key := range keys[:min(len(keys), limit)] {
+		listed = append(listed, fmt.Sprintf("%s with %d", key, counts[key]))
+	}
+
+	if len(keys) > limit {
+		listed = append(listed, fmt.Sprintf("%d others", len(keys)-limit))
+	}
+
+	return strings.Join(listed, ", ")
+}
@@ -0,0 +1,250 @@
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPlan(t *testing.T) {
+	const (
+		spf  = "v=spf1 include:_spf.google.com ~all"
+		dkim = "v=DKIM1; k=rsa; p=KEY"
+	)
+
+	// step is a step's week and record, or its action's start if it publishes no record
+	type step struct {
+		week    int
+		record  string
+		blocker bool
+	}
+
+	tests := []struct {
+		name     string
+		result   *scanner.Result
+		reports  *ReportSummary
+		policy   string
+		expected []step
+	}{
+		{
+			name:   "NoRecords",
+			result: &scanner.Result{Domain: "example.com", MX: []string{"mx.example.com."}},
+			policy: "p=none",
+			expected: []step{
+				{1, "v=spf1 mx ~all", true},
+				{1, "Enable DKIM signing", true},
+				{1, "v=DMARC1; p=none; rua=mailto:dmarc@example.com", false},
+				{4, "v=DMARC1; p=quarantine; pct=25; rua=mailto:dmarc@example.com", false},
+				{6, "v=DMARC1; p=quarantine; pct=50; rua=mailto:dmarc@example.com", false},
+				{8, "v=DMARC1; p=quarantine; rua=mailto:dmarc@example.com", false},
+				{10, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", false},
+			},
+		},
+		{
+			name:   "NoReports",
+			result: &scanner.Result{Domain: "example.com", DKIM: dkim, DMARC: "v=DMARC1; p=none; fo=1", SPF: spf},
+			policy: "p=none",
+			expected: []step{
+				{1, "v=DMARC1; p=none; rua=mailto:dmarc@example.com; fo=1", false},
+				{4, "v=DMARC1; p=quarantine; pct=25; rua=mailto:dmarc@example.com; fo=1", false},
+				{6, "v=DMARC1; p=quarantine; pct=50; rua=mailto:dmarc@example.com; fo=1", false},
+				{8, "v=DMARC1; p=quarantine; rua=mailto:dmarc@example.com; fo=1", false},
+				{10, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com; fo=1", false},
+			},
+		},
+		{
+			name:   "Monitoring",
+			result: &scanner.Result{Domain: "example.com", DKIM: dkim, DMARC: "v=DMARC1; p=none; rua=mailto:reports@example.net", SPF: spf},
+			policy: "p=none",
+			expected: []step{
+				{1, "v=DMARC1; p=quarantine; pct=25; rua=mailto:reports@example.net", false},
+				{3, "v=DMARC1; p=quarantine; pct=50; rua=mailto:reports@example.net", false},
+				{5, "v=DMARC1; p=quarantine; rua=mailto:reports@example.net", false},
+				{7, "v=DMARC1; p=reject; rua=mailto:reports@example.net", false},
+			},
+		},
+		{
+			name:   "MissingDKIM",
+			result: &scanner.Result{Domain: "example.com", DMARC: "v=DMARC1; p=none; rua=mailto:dmarc@example.com", SPF: spf},
+			policy: "p=none",
+			expected: []step{
+				{1, "Enable DKIM signing", true},
+				{3, "v=DMARC1; p=quarantine; pct=25; rua=mailto:dmarc@example.com", false},
+				{5, "v=DMARC1; p=quarantine; pct=50; rua=mailto:dmarc@example.com", false},
+				{7, "v=DMARC1; p=quarantine; rua=mailto:dmarc@example.com", false},
+				{9, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", false},
+			},
+		},
+		{
+			name:    "FailingReports",
+			result:  &scanner.Result{Domain: "example.com", DKIM: dkim, DMARC: "v=DMARC1; p=quarantine; pct=100; rua=mailto:dmarc@example.com", SPF: spf},
+			reports: &ReportSummary{Messages: 1000, Passing: 900, Failing: map[string]int{"192.0.2.1": 80, "192.0.2.2": 15, "192.0.2.3": 3, "192.0.2.4": 2}},
+			policy:  "p=quarantine",
+			expected: []step{
+				{1, "Only 90.0% of the 1000 messages in your aggregate reports pass DMARC. Authorize the sources failing it (192.0.2.1 with 80, 192.0.2.2 with 15, 192.0.2.3 with 3, 1 others)", true},
+				{3, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", false},
+			},
+		},
+		{
+			name:    "ForwardedReports",
+			result:  &scanner.Result{Domain: "example.com", DKIM: dkim, DMARC: "v=DMARC1; p=quarantine; rua=mailto:dmarc@example.com", SPF: spf},
+			reports: &ReportSummary{Messages: 1000, Passing: 990, Failing: map[string]int{"198.51.100.7": 10}, Forwarded: map[string]int{"lists.example.org": 8, "forward.example.net": 2}},
+			policy:  "p=quarantine",
+			expected: []step{
+				{1, "10 of the messages failing DMARC in your aggregate reports look forwarded, as their SPF failed while a DKIM signature of another domain passed (lists.example.org with 8, forward.example.net with 2). Ask those forwarders", false},
+				{1, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", false},
+			},
+		},
+		{
+			name:    "PassingReports",
+			result:  &scanner.Result{Domain: "example.com", DKIM: dkim, DMARC: "v=DMARC1; p=quarantine; pct=50; rua=mailto:dmarc@example.com", SPF: spf},
+			reports: &ReportSummary{Messages: 1000, Passing: 995},
+			policy:  "p=quarantine; pct=50",
+			expected: []step{
+				{1, "v=DMARC1; p=quarantine; rua=mailto:dmarc@example.com", false},
+				{3, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", false},
+			},
+		},
+		{
+			name:   "PartialReject",
+			result: &scanner.Result{Domain: "example.com", DKIM: dkim, DMARC: "v=DMARC1; p=reject; pct=10; rua=mailto:dmarc@example.com", SPF: spf},
+			policy: "p=reject; pct=10",
+			expected: []step{
+				{1, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", false},
+			},
+		},
+		{
+			name:   "WeakSubdomainPolicy",
+			result: &scanner.Result{Domain: "example.com", DKIM: dkim, DMARC: "v=DMARC1; p=reject; sp=none; rua=mailto:dmarc@example.com", SPF: spf},
+			policy: "p=reject",
+			expected: []step{
+				{1, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", false},
+			},
+		},
+		{
+			name:     "Complete",
+			result:   &scanner.Result{Domain: "example.com", DKIM: dkim, DMARC: "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", SPF: spf},
+			policy:   "p=reject",
+			expected: nil,
+		},
+		{
+			name:   "NonSending",
+			result: &scanner.Result{Domain: "example.com", DMARC: "v=DMARC1; p=none", SPF: "v=spf1 -all"},
+			policy: "p=none",
+			expected: []step{
+				{1, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", false},
+			},
+		},
+		{
+			name:     "NonSendingComplete",
+			result:   &scanner.Result{Domain: "example.com", DMARC: "v=DMARC1; p=reject", SPF: "v=spf1 -all"},
+			policy:   "p=reject",
+			expected: nil,
+		},
+		{
+			name:   "InvalidRecord",
+			result: &scanner.Result{Domain: "example.com", DKIM: dkim, DMARC: "v=DMARC2; p=reject", SPF: spf},
+			policy: "p=none",
+			expected: []step{
+				{1, "v=DMARC1; p=none; rua=mailto:dmarc@example.com", false},
+				{4, "v=DMARC1; p=quarantine; pct=25; rua=mailto:dmarc@example.com", false},
+				{6, "v=DMARC1; p=quarantine; pct=50; rua=mailto:dmarc@example.com", false},
+				{8, "v=DMARC1; p=quarantine; rua=mailto:dmarc@example.com", false},
+				{10, "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan := NewPlan(PlanInput{Domain: test.result.Domain, Records: ParseRecords(test.result), MX: len(test.result.MX) > 0, Reports: test.reports})
+
+			require.Equal(t, "example.com", plan.Domain)
+			require.Equal(t, test.policy, plan.Policy)
+			require.Equal(t, len(test.expected) == 0, plan.Complete)
+			require.Len(t, plan.Steps, len(test.expected))
+
+			for index, expected := range test.expected {
+				actual := plan.Steps[index]
+				require.Equal(t, expected.week, actual.Week, "step %d", index)
+				require.Equal(t, expected.blocker, actual.Blocker, "step %d", index)
+
+				if strings.HasPrefix(expected.record, "v=") {
+					require.Equal(t, expected.record, actual.Record, "step %d", index)
+				} else {
+					require.True(t, strings.HasPrefix(actual.Action, expected.record), "found %q, want it to start with %q", actual.Action, expected.record)
+				}
+			}
+		})
+	}
+
+	t.Run("ReportMailbox", func(t *testing.T) {
+		plan := NewPlan(PlanInput{Domain: "Example.com.", Records: &ParsedRecords{SPF: []string{"-all"}}, ReportMailbox: "reports@example.net"})
+		require.Equal(t, "v=DMARC1; p=reject; rua=mailto:reports@example.net", plan.Steps[0].Record)
+		require.Equal(t, "_dmarc.example.com", plan.Steps[0].Name)
+	})
+
+	t.Run("Steps", func(t *testing.T) {
+		plan := NewPlan(PlanInput{Domain: "example.com", Records: ParseRecords(&scanner.Result{DKIM: dkim, DMARC: "v=DMARC1; p=none; rua=mailto:dmarc@example.com", SPF: spf})})
+		require.Equal(t, "Move your DMARC policy to p=quarantine with pct=25, so receivers quarantine 25% of mail failing DMARC, and deliver the other 75%. Review your aggregate reports first, and hold back if your legitimate mail doesn't pass.", plan.Steps[0].Action)
+		require.Equal(t, "Move your DMARC policy to p=reject, so receivers reject all mail failing DMARC. Review your aggregate reports first, and hold back if your legitimate mail doesn't pass.", plan.Steps[3].Action)
+	})
+}
+
+func TestParseAggregateReport(t *testing.T) {
+	report := `<?xml version="1.0" encoding="UTF-8" ?>
+<feedback>
+  <report_metadata><org_name>google.com</org_name><report_id>1</report_id></report_metadata>
+  <policy_published><domain>Example.com</domain><p>none</p></policy_published>
+  <record>
+    <row><source_ip>192.0.2.1</source_ip><count>40</count><policy_evaluated><disposition>none</disposition><dkim>pass</dkim><spf>fail</spf></policy_evaluated></row>
+    <identifiers><header_from>example.com</header_from></identifiers>
+  </record>
+  <record>
+    <row><source_ip>192.0.2.2</source_ip><count>6</count><policy_evaluated><disposition>none</disposition><dkim>fail</dkim><spf>fail</spf></policy_evaluated></row>
+    <identifiers><header_from>example.com</header_from></identifiers>
+  </record>
+  <record>
+    <row><source_ip>198.51.100.7</source_ip><count>5</count><policy_evaluated><disposition>none</disposition><dkim>fail</dkim><spf>fail</spf></policy_evaluated></row>
+    <identifiers><header_from>example.com</header_from></identifiers>
+    <auth_results><dkim><domain>example.com</domain><result>fail</result></dkim><dkim><domain>Lists.Example.org</domain><result>pass</result></dkim><spf><domain>example.com</domain><result>fail</result></spf></auth_results>
+  </record>
+  <record>
+    <row><source_ip>198.51.100.20</source_ip><count>4</count><policy_evaluated><disposition>none</disposition><dkim>fail</dkim><spf>fail</spf></policy_evaluated></row>
+    <identifiers><header_from>example.com</header_from></identifiers>
+    <auth_results><dkim><domain>sendgrid.net</domain><result>pass</result></dkim><spf><domain>em1234.sendgrid.net</domain><result>pass</result></spf></auth_results>
+  </record>
+  <record>
+    <row><source_ip>192.0.2.3</source_ip><count>2</count><policy_evaluated><disposition>none</disposition><dkim>fail</dkim><spf>fail</spf></policy_evaluated></row>
+    <identifiers><header_from>example.com</header_from></identifiers>
+    <auth_results><dkim><domain>mail.example.com</domain><result>pass</result></dkim><spf><domain>example.com</domain><result>fail</result></spf></auth_results>
+  </record>
+</feedback>`
+
+	// only lists.example.org's mail is forwarded: mail.example.com's signature aligns in relaxed mode, and the ESP
+	// sending as sendgrid.net passes SPF for its own domain, so it needs alignment set up instead
+	expected := &ReportSummary{Domain: "example.com", Messages: 57, Passing: 40, Failing: map[string]int{"192.0.2.2": 6, "198.51.100.7": 5, "192.0.2.3": 2, "198.51.100.20": 4}, Forwarded: map[string]int{"lists.example.org": 5}}
+
+	summary, err := ParseAggregateReport(strings.NewReader(report))
+	require.NoError(t, err)
+	require.Equal(t, expected, summary)
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, _ = writer.Write([]byte(report))
+	require.NoError(t, writer.Close())
+
+	summary, err = ParseAggregateReport(&compressed)
+	require.NoError(t, err)
+	require.Equal(t, expected, summary)
+
+	summary.Add(&ReportSummary{Messages: 4, Passing: 1, Failing: map[string]int{"192.0.2.2": 3}, Forwarded: map[string]int{"lists.example.org": 1}})
+	require.Equal(t, &ReportSummary{Domain: "example.com", Messages: 61, Passing: 41, Failing: map[string]int{"192.0.2.2": 9, "198.51.100.7": 5, "192.0.2.3": 2, "198.51.100.20": 4}, Forwarded: map[string]int{"lists.example.org": 6}}, summary)
+
+	_, err = ParseAggregateReport(strings.NewReader("not a report"))
+	require.Error(t, err)
+}
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+)
+
+// Version, Commit and BuildDate identify the build of the scanner, and are
+// set when it's built, such as with:
+//
+//	-ldflags "-X github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model.Commit=$(git rev-parse HEAD)"
+//
+// Unless they're set, the commit and build date are taken from the version
+// control information Go embeds in the binary, if any.
+var (
+	Version   = "3.0.14"
+	Commit    string
+	BuildDate string
+)
+
+// Provenance identifies what produced a result: the build of the scanner, its
+// effective configuration, and the advice catalog that classified its
+// findings.
+type Provenance struct {
+	Version       string `json:"version" yaml:"version" doc:"The version of the scanner that produced the result." example:"3.0.14"`
+	Commit        string `json:"commit,omitempty" yaml:"commit,omitempty" doc:"The git commit the scanner was built from, if known." example:"5c217c3f4bd61e0a8f0e4a2b9d7c1e6f3a8b2d40"`
+	BuildDate     string `json:"buildDate,omitempty" yaml:"buildDate,omitempty" doc:"When the scanner was built (or its commit was made, if the build date wasn't set), if known." example:"2026-10-14T08:05:19Z"`
+	ConfigHash    string `json:"configHash" yaml:"configHash" doc:"A SHA-256 hash of the scanner's and advisor's effective configuration (its resolvers, timeouts and enabled checks), normalized so equivalent configurations have the same hash." example:"sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	AdviceCatalog string `json:"adviceCatalog" yaml:"adviceCatalog" doc:"The revision of the advice catalog that assigned the findings their severities, references and remediations, which changes whenever an entry does." example:"3f2a9c1b7d4e"`
+}
+
+// NewProvenance returns the provenance of the results produced by the scanner
+// and the advisor, which may be nil if results aren't advised.
+func NewProvenance(sc *scanner.Scanner, domainAdvisor *advisor.Advisor) *Provenance {
+	commit, buildDate := buildInfo()
+
+	return &Provenance{
+		Version:       Version,
+		Commit:        commit,
+		BuildDate:     buildDate,
+		ConfigHash:    ConfigHash(sc, domainAdvisor),
+		AdviceCatalog: advisor.CatalogVersion(),
+	}
+}
+
+// String formats the provenance on a single line, such as for the CSV output:
+// "3.0.14 (5c217c3f4bd6, built 2026-10-14T08:05:19Z), config sha256:9f86...,
+// catalog 3f2a9c1b7d4e".
+func (p *Provenance) String() string {
+	var build []string
+	if p.Commit != "" {
+		build = append(build, shortCommit(p.Commit))
+	}
+
+	if p.BuildDate != "" {
+		build = append(build, "built "+p.BuildDate)
+	}
+
+	version := p.Version
+	if len(build) > 0 {
+		version += " (" + strings.Join(build, ", ") + ")"
+	}
+
+	return version + ", config " + p.ConfigHash + ", catalog " + p.AdviceCatalog
+}
+
+// ConfigHash returns a SHA-256 hash of the effective configuration of the
+// scanner and the advisor (which may be nil), formatted as "sha256:" followed
+// by its hex digest. Equivalent configurations have the same hash.
+func ConfigHash(sc *scanner.Scanner, domainAdvisor *advisor.Advisor) string {
+	config := struct {
+		Scanner *scanner.Config `json:"scanner,omitempty"`
+		Advisor *advisor.Config `json:"advisor,omitempty"`
+	}{}
+
+	if sc != nil {
+		scannerConfig := sc.Config()
+		config.Scanner = &scannerConfig
+	}
+
+	if domainAdvisor != nil {
+		advisorConfig := domainAdvisor.Config()
+		config.Advisor = &advisorConfig
+	}
+
+	// the configs have no maps, so their encoding is deterministic
+	data, _ := json.Marshal(config)
+	sum := sha256.Sum256(data)
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// buildInfo returns the commit and build date of the scanner, falling back to
+// the version control information embedded in the binary.
+func buildInfo() (string, string) {
+	commit, buildDate := Commit, BuildDate
+	if commit != "" && buildDate != "" {
+		return commit, buildDate
+	}
+
+	vcsCommit, vcsTime := embeddedVCS()
+	if commit == "" {
+		commit = vcsCommit
+	}
+
+	if buildDate == "" {
+		buildDate = vcsTime
+	}
+
+	return commit, buildDate
+}
+
+// shortCommit abbreviates a commit hash to 12 characters, keeping any
+// "-dirty" suffix.
+func shortCommit(commit string) string {
+	hash, suffix, _ := strings.Cut(commit, "-")
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+
+	if suffix != "" {
+		return hash + "-" + suffix
+	}
+
+	return hash
+}
+
+// embeddedVCS returns the revision and commit time Go embedded in the binary,
+// if it was built from a repository. A revision with uncommitted changes is
+// suffixed with "-dirty".
+var embeddedVCS = sync.OnceValues(func() (string, string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", ""
+	}
+
+	var revision, commitTime string
+	var modified bool
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.time":
+			commitTime = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+
+	return revision, commitTime
+})
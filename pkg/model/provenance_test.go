@@ -0,0 +1,55 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigHash(t *testing.T) {
+	newScanner := func(opts ...scanner.Option) *scanner.Scanner {
+		sc, err := scanner.New(zerolog.Nop(), time.Second, opts...)
+		require.NoError(t, err)
+		t.Cleanup(sc.Close)
+
+		return sc
+	}
+
+	domainAdvisor := advisor.NewAdvisor(time.Second, time.Minute, true)
+	t.Cleanup(domainAdvisor.Close)
+
+	hash := ConfigHash(newScanner(scanner.WithNameservers([]string{"1.1.1.1", "8.8.8.8:53"}), scanner.WithBlocklists(4, "zen.spamhaus.org", "bl.example.net")), domainAdvisor)
+	require.Regexp(t, "^sha256:[0-9a-f]{64}$", hash)
+
+	// the nameservers and blocklists are normalized, and the concurrency and cache duration don't affect the results
+	equivalent := newScanner(scanner.WithNameservers([]string{"8.8.8.8", "1.1.1.1:53"}), scanner.WithBlocklists(4, "bl.example.net", "zen.spamhaus.org"), scanner.WithConcurrentScans(2), scanner.WithCacheDuration(time.Hour))
+	require.Equal(t, hash, ConfigHash(equivalent, domainAdvisor))
+
+	require.NotEqual(t, hash, ConfigHash(newScanner(scanner.WithNameservers([]string{"1.1.1.1", "9.9.9.9"}), scanner.WithBlocklists(4, "zen.spamhaus.org", "bl.example.net")), domainAdvisor))
+	require.NotEqual(t, hash, ConfigHash(equivalent, nil))
+
+	otherAdvisor := advisor.NewAdvisor(time.Second, time.Minute, false)
+	t.Cleanup(otherAdvisor.Close)
+	require.NotEqual(t, hash, ConfigHash(equivalent, otherAdvisor))
+}
+
+func TestProvenance_String(t *testing.T) {
+	provenance := &Provenance{Version: "3.0.14", Commit: "5c217c3f4bd61e0a8f0e4a2b9d7c1e6f3a8b2d40-dirty", BuildDate: "2026-10-14T08:05:19Z", ConfigHash: "sha256:9f86", AdviceCatalog: "3f2a9c1b7d4e"}
+	require.Equal(t, "3.0.14 (5c217c3f4bd6-dirty, built 2026-10-14T08:05:19Z), config sha256:9f86, catalog 3f2a9c1b7d4e", provenance.String())
+
+	provenance.Commit, provenance.BuildDate = "", ""
+	require.Equal(t, "3.0.14, config sha256:9f86, catalog 3f2a9c1b7d4e", provenance.String())
+}
+
+func TestNewProvenance(t *testing.T) {
+	Commit, BuildDate = "5c217c3", "2026-10-14"
+	t.Cleanup(func() { Commit, BuildDate = "", "" })
+
+	provenance := NewProvenance(nil, nil)
+	require.Equal(t, &Provenance{Version: Version, Commit: "5c217c3", BuildDate: "2026-10-14", ConfigHash: ConfigHash(nil, nil), AdviceCatalog: advisor.CatalogVersion()}, provenance)
+	require.Len(t, provenance.AdviceCatalog, 12)
+}
@@ -1,43 +1,634 @@
 package model
 
 import (
+	"context"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
 )
 
-type ScanResultWithAdvice struct {
-	ScanResult *scanner.Result `json:"scanResult" yaml:"scanResult" doc:"The results of scanning a domain's DNS records."`
-	Advice     *advisor.Advice `json:"advice,omitempty" yaml:"advice,omitempty" doc:"The advice for the domain's DNS records."`
+type (
+	// ScanResult is the result of scanning a domain, as returned by the API and
+	// the CLI, stored by schedules, and sent in webhooks and mail. It's built by
+	// NewScanResult, so every output has the same fields.
+	ScanResult struct {
+		SchemaVersion    int                        `json:"schemaVersion,omitempty" yaml:"schemaVersion,omitempty" doc:"The version of the result's schema, which is bumped whenever a field changes." example:"2"`
+		Domain           string                     `json:"domain,omitempty" yaml:"domain,omitempty" doc:"The normalized domain name that was scanned." example:"example.com"`
+		ScannedAt        *time.Time                 `json:"scannedAt,omitempty" yaml:"scannedAt,omitempty" doc:"When the result was produced."`
+		Scanner          *Provenance                `json:"scanner,omitempty" yaml:"scanner,omitempty" doc:"What produced the result: the scanner's build, a hash of its effective configuration, and the advice catalog's revision."`
+		ScanResult       *scanner.Result            `json:"scanResult" yaml:"scanResult" doc:"The results of scanning a domain's DNS records."`
+		Parsed           *ParsedRecords             `json:"parsed,omitempty" yaml:"parsed,omitempty" doc:"The domain's records parsed into their tags and terms, only included in detailed output."`
+		Advice           *advisor.Advice            `json:"advice,omitempty" yaml:"advice,omitempty" doc:"The advice for the domain's DNS records."`
+		Findings         []Finding                  `json:"findings,omitempty" yaml:"findings,omitempty" doc:"Each line of advice with its severity, only included in detailed output, or if the domain has a previous scan to compare with."`
+		Resolved         []Finding                  `json:"resolved,omitempty" yaml:"resolved,omitempty" doc:"The findings of the domain's previous scan that are no longer reported, only included if the domain has a previous scan to compare with."`
+		Explanations     []Explanation              `json:"explanations,omitempty" yaml:"explanations,omitempty" doc:"The evidence behind each line of advice, only included if explanations were requested. They don't count towards the domain's score."`
+		Certificates     *advisor.CertificateReport `json:"certificates,omitempty" yaml:"certificates,omitempty" doc:"The certificates found in certificate transparency logs for the domain, only included in detailed output."`
+		Registration     *advisor.Registration      `json:"registration,omitempty" yaml:"registration,omitempty" doc:"The domain's registration, as looked up over RDAP, behind the registration advice, only included in detailed output."`
+		Plan             *Plan                      `json:"plan,omitempty" yaml:"plan,omitempty" doc:"The steps left to roll out DMARC enforcement for the domain, with the records to publish at each, only included in detailed output."`
+		SecurityContacts *advisor.SecurityContacts  `json:"securityContacts,omitempty" yaml:"securityContacts,omitempty" doc:"The domain's security contacts, from its security.txt file and the SOA and DMARC report mailboxes that serve as fallbacks, behind the security contact advice, only included in detailed output."`
+		Deduplicated     bool                       `json:"deduplicated,omitempty" yaml:"deduplicated,omitempty" doc:"Whether the domain was repeated earlier in the request, and so shares that entry's result."`
+		Options          *ScanOptions               `json:"options,omitempty" yaml:"options,omitempty" doc:"The options the domain was scanned with, after the request's defaults were applied, only included in bulk scan results."`
+		Parked           *scanner.ParkedAssessment  `json:"parked,omitempty" yaml:"parked,omitempty" doc:"Whether the domain is likely to be parked, and the signals used, only included in detailed output."`
+		SOA              *scanner.SOA               `json:"soa,omitempty" yaml:"soa,omitempty" doc:"The domain's SOA record, behind the SOA advice, only included in detailed output."`
+		CNAME            []string                   `json:"cname,omitempty" yaml:"cname,omitempty" doc:"The chain of targets the domain's CNAME record resolves through, behind the CNAME advice, only included in detailed output." example:"example.herokudns.com"`
+		Timings          map[string]string          `json:"timings,omitempty" yaml:"timings,omitempty" doc:"The duration of each lookup and check, only included in detailed output." example:"{\"dmarc_lookup\":\"12ms\",\"mx_check\":\"8.4s\"}"`
+		Errors           map[string]CheckError      `json:"errors,omitempty" yaml:"errors,omitempty" doc:"The lookups and checks that couldn't be completed because of a failure on the scanner's side (such as its resolver being down, its outbound connections being blocked, or the scan being cancelled), keyed like timings. Their records or advice are missing or partial, as the failure says nothing about the domain."`
+	}
+
+	// ScanResultWithAdvice is the previous name of ScanResult.
+	//
+	// Deprecated: use ScanResult.
+	ScanResultWithAdvice = ScanResult
+
+	// Finding is a single line of advice with its severity.
+	Finding struct {
+		Check    string `json:"check" yaml:"check" doc:"The check the advice is from." example:"dmarc"`
+		Message  string `json:"message" yaml:"message" doc:"The advice." example:"You are currently at the lowest level and receiving reports, which is a great starting point."`
+		Severity string `json:"severity" yaml:"severity" enum:"critical,high,medium,low,info" doc:"How urgently the advice should be acted on." example:"low"`
+		Status   string `json:"status,omitempty" yaml:"status,omitempty" enum:"new,persisting,resolved" doc:"Whether the finding is new, persisting or resolved since the domain's previous scan, only included if it has one."`
+
+		// Reference and Remediation are only set for advice in the advisor's catalog, rather than positive advice.
+		Reference   string `json:"reference,omitempty" yaml:"reference,omitempty" doc:"A URL explaining the advice, either our docs or the relevant RFC section." example:"https://www.rfc-editor.org/rfc/rfc7489#section-6.3"`
+		Remediation string `json:"remediation,omitempty" yaml:"remediation,omitempty" doc:"How to fix what the advice reports." example:"Review the aggregate reports, then move the DMARC policy to p=quarantine or p=reject."`
+	}
+
+	// CheckError is the failure on the scanner's side that kept a lookup or
+	// check from completing.
+	CheckError struct {
+		Kind    string `json:"kind" yaml:"kind" enum:"resolver,egress,timeout,canceled,unknown" doc:"What failed: the scanner's resolver, an outbound connection (or the proxy it goes through), the check's timeout, the scan being cancelled, or something else." example:"resolver"`
+		Message string `json:"message" yaml:"message" doc:"The error the lookup or check failed with." example:"read udp 10.0.0.2:52711->10.0.0.1:53: i/o timeout"`
+	}
+)
+
+// NewScanResult returns the result of scanning a domain, along with its advice
+// if advice isn't nil, and the errors of any lookups and checks that failed.
+// Detailed results also include the parsed records, the findings,
+// certificates, registration, security contacts, DMARC rollout plan, parked
+// assessment, SOA record, CNAME chain and timings.
+func NewScanResult(result *scanner.Result, advice *advisor.Advice, detailed bool) ScanResult {
+	scannedAt := time.Now().UTC()
+
+	res := ScanResult{
+		SchemaVersion: SchemaVersion,
+		Domain:        result.Domain,
+		ScannedAt:     &scannedAt,
+		ScanResult:    result,
+		Advice:        advice,
+		Errors:        newCheckErrors(result, advice),
+	}
+
+	if detailed {
+		res.AttachTimings()
+		res.Parked = result.Parked
+		res.Parsed = ParseRecords(result)
+		res.SOA = result.SOA
+		res.CNAME = result.CNAME
+
+		if advice != nil {
+			res.Certificates = advice.CertificateReport
+			res.Registration = advice.Registration
+			res.SecurityContacts = advice.SecurityContacts
+			res.Plan = NewPlan(PlanInput{Domain: result.Domain, Records: res.Parsed, MX: len(result.MX) > 0})
+
+			for _, finding := range advice.Findings() {
+				res.Findings = append(res.Findings, newFinding(finding, ""))
+			}
+		}
+	}
+
+	return res
 }
 
-func (s *ScanResultWithAdvice) CSV() []string {
+// Advise returns the advisor's advice for a scan result. Domains that are
+// likely to be parked (or assumed to be) only receive the parked domain advice,
+// and scans whose lookups couldn't be answered at all receive none, as their
+// records are unknown rather than missing.
+func Advise(ctx context.Context, domainAdvisor *advisor.Advisor, result *scanner.Result, assumeParked bool) *advisor.Advice {
+	if result.Error == scanner.ErrLookupFailed {
+		return nil
+	}
+
+	// every check of the result uses the same data, even if it's reloaded meanwhile
+	domainAdvisor = domainAdvisor.Pinned()
+
+	if assumeParked || (result.Parked != nil && result.Parked.Likely) {
+		return domainAdvisor.CheckParked(result.DMARC, result.MX, result.SPF)
+	}
+
+	input := advisor.ScanInput{
+		Domain: result.Domain,
+		BIMI:   result.BIMI,
+		DKIM:   result.DKIM,
+		DMARC:  result.DMARC,
+		MX:     result.MX,
+		SPF:    result.SPF,
+	}
+
+	if result.Organizational != nil {
+		input.OrganizationalDMARC = result.Organizational.DMARC
+		input.OrganizationalSPF = result.Organizational.SPF
+	}
+
+	advice := domainAdvisor.CheckAllInput(ctx, input)
+
+	if result.DKIMWildcard {
+		advice.DKIM = domainAdvisor.CheckWildcard(lookalike.DKIM, result.Domain)
+	} else if result.DKIMSelectorChecks != nil {
+		// the checks are only set if explicit selectors were supplied, so
+		// there's no need to hedge about only looking up known selectors
+		checks := make([]advisor.DKIMSelectorCheck, 0, len(result.DKIMSelectorChecks))
+		for _, check := range result.DKIMSelectorChecks {
+			checks = append(checks, advisor.DKIMSelectorCheck{Selector: check.Selector, Found: check.Found})
+		}
+
+		if result.DKIM == "" {
+			advice.DKIM = nil
+		}
+
+		advice.DKIM = append(advice.DKIM, domainAdvisor.CheckDKIMSelectors(result.Domain, checks)...)
+	}
+
+	if result.DMARCWildcard {
+		advice.DMARC = domainAdvisor.CheckWildcard(lookalike.DMARC, result.Domain)
+	} else {
+		advice.DMARC = append(advice.DMARC, domainAdvisor.CheckReportDestinations(ctx, result.DMARC)...)
+	}
+
+	// the response codes are only set for the lookups that found no record,
+	// and the selector checks already explain each supplied selector's. A
+	// subdomain's BIMI check is skipped unless it publishes a record (or the
+	// check is run for subdomains), so its record isn't missing.
+	if advice.BIMI != nil || !domainAdvisor.SubdomainAdvice(result.Domain) {
+		advice.BIMI = domainAdvisor.CheckMissingRecord(lookalike.BIMI, result.Domain, result.Rcodes["bimi"], advice.BIMI)
+	}
+
+	// DKIM keys that weren't, or couldn't be, looked up aren't missing, as whether they're published is unknown
+	switch {
+	case result.DKIMDiscovery == scanner.DKIMDiscoverySkipped:
+		advice.DKIM = domainAdvisor.CheckDKIMSkipped(result.Domain)
+	case result.DKIMDiscovery == scanner.DKIMDiscoveryFailed:
+		advice.DKIM = domainAdvisor.CheckDKIMLookupFailed(result.Domain, result.Rcodes["dkim"], result.Errors["dkim"])
+	case result.DKIMSelectorChecks == nil:
+		advice.DKIM = domainAdvisor.CheckMissingRecord(lookalike.DKIM, result.Domain, result.Rcodes["dkim"], advice.DKIM)
+	}
+
+	advice.DMARC = domainAdvisor.CheckMissingRecord(lookalike.DMARC, result.Domain, result.Rcodes["dmarc"], advice.DMARC)
+
+	// a subdomain without a DMARC record of its own is covered by its
+	// organizational domain's, which is only set if that's the case
+	if result.Organizational != nil && result.Organizational.DMARC != "" && result.DMARC == "" && !result.DMARCWildcard {
+		advice.DMARC = domainAdvisor.CheckInheritedDMARC(result.Domain, result.Organizational.Domain, result.Organizational.DMARC)
+	}
+
+	// the chains are only set if the DMARC or SPF record was looked up through a
+	// CNAME, and a managed service hosting either is listed with the providers
+	managedDMARC, dmarcService := domainAdvisor.CheckManagedRecord(lookalike.DMARC, result.Domain, result.DMARCCNAME, result.DMARC)
+	advice.DMARC = append(advice.DMARC, managedDMARC...)
+
+	managedSPF, spfService := domainAdvisor.CheckManagedRecord(lookalike.SPF, result.Domain, result.SPFCNAME, result.SPF)
+	advice.SPF = append(advice.SPF, managedSPF...)
+
+	for _, service := range []string{dmarcService, spfService} {
+		if service != "" && !slices.Contains(advice.Providers, service) {
+			advice.Providers = append(advice.Providers, service)
+		}
+	}
+
+	advice.ARC = domainAdvisor.CheckARC(result.ARC, result.ARCSelector, result.MX, result.SPF)
+
+	advice.Certificates, advice.CertificateReport = domainAdvisor.CheckCertificates(ctx, result.Domain, result.CAA)
+
+	// the SOA is only set if the domain is the apex of a zone
+	if result.SOA != nil {
+		advice.SOA = domainAdvisor.CheckSOA(ctx, &advisor.SOA{
+			MName:   result.SOA.MName,
+			RName:   result.SOA.RName,
+			Serial:  result.SOA.Serial,
+			Refresh: result.SOA.Refresh,
+			Retry:   result.SOA.Retry,
+			Expire:  result.SOA.Expire,
+			Minimum: result.SOA.Minimum,
+			TTL:     result.SOA.TTL,
+		})
+	}
+
+	// a CNAME at the apex breaks the zone, so the domain no longer looks good
+	if cnameAdvice := domainAdvisor.CheckApexCNAME(result.Domain, result.CNAME); len(cnameAdvice) > 0 {
+		if len(advice.Domain) == 1 && advice.Domain[0] == "Your domain looks good! No further action needed." {
+			advice.Domain = nil
+		}
+
+		advice.Domain = append(advice.Domain, cnameAdvice...)
+	}
+
+	// the registration is only checked if RDAP lookups are enabled, and only
+	// its findings mean the domain no longer looks good
+	registrationAdvice, registration := domainAdvisor.CheckRegistration(ctx, result.Domain)
+	if len(registrationAdvice) > 0 {
+		isFinding := func(line string) bool { return advisor.Classify(line) > advisor.SeverityInfo }
+		if slices.ContainsFunc(registrationAdvice, isFinding) && len(advice.Domain) == 1 && advice.Domain[0] == "Your domain looks good! No further action needed." {
+			advice.Domain = nil
+		}
+
+		advice.Domain = append(advice.Domain, registrationAdvice...)
+		advice.Registration = registration
+	}
+
+	// the security contacts are only checked if security.txt fetches are
+	// enabled, falling back to the organizational domain's DMARC record if the
+	// domain has none of its own
+	rname, dmarc := "", result.DMARC
+	if result.SOA != nil {
+		rname = result.SOA.RName
+	}
+
+	if dmarc == "" && result.Organizational != nil {
+		dmarc = result.Organizational.DMARC
+	}
+
+	securityAdvice, securityContacts := domainAdvisor.CheckSecurityContacts(ctx, result.Domain, rname, dmarc)
+	if len(securityAdvice) > 0 {
+		isFinding := func(line string) bool { return advisor.Classify(line) > advisor.SeverityInfo }
+		if slices.ContainsFunc(securityAdvice, isFinding) && len(advice.Domain) == 1 && advice.Domain[0] == "Your domain looks good! No further action needed." {
+			advice.Domain = nil
+		}
+
+		advice.Domain = append(advice.Domain, securityAdvice...)
+		advice.SecurityContacts = securityContacts
+	}
+
+	// the redirects are only set if the SPF record hands its policy over to another domain
+	if len(result.SPFRedirects) > 0 {
+		redirects := make([]advisor.SPFRedirect, 0, len(result.SPFRedirects))
+		for _, redirect := range result.SPFRedirects {
+			redirects = append(redirects, advisor.SPFRedirect{Domain: redirect.Domain, Record: redirect.Record})
+		}
+
+		advice.SPF = append(advice.SPF, domainAdvisor.CheckSPFRedirects(result.Domain, redirects, result.DMARC)...)
+	}
+
+	// the includes are only set if they were resolved, so otherwise only the
+	// record's own ip4 and ip6 mechanisms are compared
+	includes := make([]advisor.SPFInclude, 0, len(result.SPFIncludes))
+	for _, include := range result.SPFIncludes {
+		includes = append(includes, advisor.SPFInclude{Domain: include.Domain, Record: include.Record})
+	}
+
+	if overlaps := domainAdvisor.CheckSPFOverlaps(result.EffectiveSPF(), includes); len(overlaps) > 0 {
+		advice.SPF = slices.DeleteFunc(advice.SPF, func(line string) bool { return line == "SPF seems to be setup correctly! No further action needed." })
+
+		// the record that applies is the redirect target's, whose advice is prefixed with its domain
+		for _, line := range overlaps {
+			if len(result.SPFRedirects) > 0 {
+				line = result.SPFRedirects[len(result.SPFRedirects)-1].Domain + ": " + line
+			}
+
+			advice.SPF = append(advice.SPF, line)
+		}
+	}
+
+	// the subdomains are only set if they were checked
+	if result.SendingSubdomains != nil {
+		subdomains := make([]advisor.SendingSubdomain, 0, len(result.SendingSubdomains))
+		for _, subdomain := range result.SendingSubdomains {
+			subdomains = append(subdomains, advisor.SendingSubdomain{Name: subdomain.Name, SPF: subdomain.SPF, DKIM: subdomain.DKIM, DMARC: subdomain.DMARC})
+		}
+
+		advice.Subdomains = domainAdvisor.CheckSendingSubdomains(result.Domain, result.DMARC, subdomains)
+
+		// a sending subdomain's SPF record or DKIM key may align with the domain where its own records don't
+		if unaligned := domainAdvisor.CheckAlignment(result.Domain, result.DKIM, result.DMARC, result.SPF, nil); len(unaligned) > 0 {
+			aligned := slices.DeleteFunc(advice.DMARC, func(line string) bool { return slices.Contains(unaligned, line) })
+			advice.DMARC = append(domainAdvisor.CheckAlignment(result.Domain, result.DKIM, result.DMARC, result.SPF, subdomains), aligned...)
+		}
+	}
+
+	// the lookalikes are only set if they were checked
+	if result.Lookalikes != nil {
+		lookalikes := make([]advisor.Lookalike, 0, len(result.Lookalikes))
+		for _, lookalike := range result.Lookalikes {
+			lookalikes = append(lookalikes, advisor.Lookalike{Name: lookalike.Name, Unicode: lookalike.Unicode, Technique: lookalike.Technique, MX: lookalike.MX, SPF: lookalike.SPF})
+		}
+
+		advice.Lookalikes = domainAdvisor.CheckLookalikes(lookalikes)
+	}
+
+	// the MTA-STS records are only set if they were looked up
+	mtaSTSAdvice, err := domainAdvisor.CheckMTASTS(ctx, result.Domain, result.MTASTS, result.MX)
+	if err != nil {
+		advice.Errors["mtasts"] = err
+	}
+
+	advice.MTASTS = mtaSTSAdvice
+
+	// the TXT records are only set if the domain publishes any
+	advice.TXT = domainAdvisor.CheckTXT(result.TXT, result.TXTSize)
+
+	// the authoritative answers are only set if the authoritative nameservers
+	// were queried, and a mismatch is noted with the lookup it's for
+	for _, answer := range result.Authoritative {
+		note := domainAdvisor.CheckAuthoritativeAnswer(advisor.AuthoritativeAnswer{Name: answer.Name, Type: answer.Type, Server: answer.Server, TTL: answer.TTL, Mismatch: answer.Mismatch})
+
+		switch answer.Lookup {
+		case "dkim":
+			advice.DKIM = append(advice.DKIM, note...)
+		case "dmarc":
+			advice.DMARC = append(advice.DMARC, note...)
+		case "mx":
+			advice.MX = append(advice.MX, note...)
+		case "txt":
+			advice.TXT = append(advice.TXT, note...)
+		}
+	}
+
+	// the listings are only set if the blocklists were checked
+	if result.Blocklistings != nil {
+		listings := make([]advisor.Blocklisting, 0, len(result.Blocklistings))
+		for _, listing := range result.Blocklistings {
+			listings = append(listings, advisor.Blocklisting{Address: listing.Address, Source: listing.Source, Zone: listing.Zone, Codes: listing.Codes})
+		}
+
+		advice.Blocklists = domainAdvisor.CheckBlocklists(listings)
+	}
+
+	if result.DKIM != "" {
+		// the keys are only listed if there's more than one
+		keys := []advisor.DKIMKey{{Selector: result.DKIMSelector, Record: result.DKIM, Segments: result.DKIMSegments}}
+		if len(result.DKIMKeys) > 0 {
+			keys = keys[:0]
+			for _, key := range result.DKIMKeys {
+				keys = append(keys, advisor.DKIMKey{Selector: key.Selector, Record: key.Record, Segments: key.Segments})
+			}
+		}
+
+		advice.DKIM = append(advice.DKIM, domainAdvisor.CheckDKIMKeys(keys)...)
+
+		var selectors []string
+		for _, key := range keys {
+			if key.Selector != "" {
+				selectors = append(selectors, key.Selector)
+			}
+		}
+
+		advice.DKIM = append(advice.DKIM, domainAdvisor.CheckDKIMRotation(selectors...)...)
+	}
+
+	for _, lookup := range result.TCPFallback {
+		switch {
+		case lookup == "bimi" && result.BIMI != "":
+			advice.BIMI = append(advice.BIMI, domainAdvisor.CheckTCPFallback(lookalike.BIMI)...)
+		case lookup == "dkim" && result.DKIM != "":
+			advice.DKIM = append(advice.DKIM, domainAdvisor.CheckTCPFallback(lookalike.DKIM)...)
+		case lookup == "dmarc" && result.DMARC != "":
+			advice.DMARC = append(advice.DMARC, domainAdvisor.CheckTCPFallback(lookalike.DMARC)...)
+		case lookup == "spf" && result.SPF != "":
+			advice.SPF = append(advice.SPF, domainAdvisor.CheckTCPFallback(lookalike.SPF)...)
+		}
+	}
+
+	// the oversized lookups' records weren't evaluated, so their advice is replaced
+	lookups := make([]string, 0, len(result.Oversized))
+	for lookup := range result.Oversized {
+		lookups = append(lookups, lookup)
+	}
+
+	sort.Strings(lookups)
+
+	for _, lookup := range lookups {
+		oversized := domainAdvisor.CheckOversized(lookup, result.Oversized[lookup])
+
+		switch lookup {
+		case "arc":
+			advice.ARC = oversized
+		case "bimi":
+			advice.BIMI = oversized
+		case "blocklists":
+			advice.Blocklists = oversized
+		case "dkim":
+			advice.DKIM = oversized
+		case "dmarc":
+			advice.DMARC = oversized
+		case "mx":
+			advice.MX = oversized
+		case "spf":
+			advice.SPF = oversized
+		case "subdomains":
+			advice.Subdomains = oversized
+		case "txt":
+			advice.TXT = oversized
+		default:
+			if len(advice.Domain) == 1 && advice.Domain[0] == "Your domain looks good! No further action needed." {
+				advice.Domain = nil
+			}
+
+			advice.Domain = append(advice.Domain, oversized...)
+		}
+	}
+
+	return advice
+}
+
+// newCheckErrors returns the errors of the scan's failed lookups and the
+// advice's failed checks, keyed like their timings. Every lookup goes through
+// the resolver, so its errors are the resolver's unless the scan was
+// cancelled.
+func newCheckErrors(result *scanner.Result, advice *advisor.Advice) map[string]CheckError {
+	var errs map[string]CheckError
+
+	add := func(key, kind string, err error) {
+		if errs == nil {
+			errs = make(map[string]CheckError)
+		}
+
+		errs[key] = CheckError{Kind: kind, Message: err.Error()}
+	}
+
+	for name, err := range result.Errors {
+		kind := advisor.ErrorKind(err)
+		if kind != advisor.ErrorKindCanceled {
+			kind = advisor.ErrorKindResolver
+		}
+
+		add(name+"_lookup", kind, err)
+	}
+
+	if advice != nil {
+		for name, err := range advice.Errors {
+			add(name+"_check", advisor.ErrorKind(err), err)
+		}
+	}
+
+	return errs
+}
+
+// AttachTimings merges the scanner's lookup timings and the advisor's check
+// timings into the result's Timings map.
+func (s *ScanResult) AttachTimings() {
+	s.Timings = make(map[string]string)
+
+	if s.ScanResult != nil {
+		for name, duration := range s.ScanResult.Timings {
+			s.Timings[name] = duration
+		}
+	}
+
+	if s.Advice != nil {
+		for name, duration := range s.Advice.Timings {
+			s.Timings[name] = duration
+		}
+	}
+}
+
+// Canonical returns a copy of the result in a canonical form, so identical
+// results encode to identical bytes: the NS, CAA and TXT records (whose order
+// is up to the nameserver) and each check's advice and findings are sorted, and
+// the scan time and timings are dropped. The scanner already sorts addresses,
+// and MX hosts by preference.
+func (s *ScanResult) Canonical() ScanResult {
+	canonical := *s
+	canonical.ScannedAt, canonical.Timings = nil, nil
+
+	if s.ScanResult != nil {
+		result := *s.ScanResult
+		result.CAA = sortedStrings(result.CAA)
+		result.NS = sortedStrings(result.NS)
+		result.TXT = sortedStrings(result.TXT)
+		result.Duration, result.Timings = 0, nil
+		canonical.ScanResult = &result
+	}
+
+	if s.Advice != nil {
+		canonical.Advice = s.Advice.Sorted()
+	}
+
+	if s.Findings != nil {
+		canonical.Findings = sortedFindings(s.Findings)
+	}
+
+	if s.Resolved != nil {
+		canonical.Resolved = sortedFindings(s.Resolved)
+	}
+
+	return canonical
+}
+
+// sortedFindings returns a copy of the findings, sorted by check then message.
+func sortedFindings(findings []Finding) []Finding {
+	sorted := append([]Finding(nil), findings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Check != sorted[j].Check {
+			return sorted[i].Check < sorted[j].Check
+		}
+
+		return sorted[i].Message < sorted[j].Message
+	})
+
+	return sorted
+}
+
+// sortedStrings returns a sorted copy of the values.
+func sortedStrings(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// CSVHeader returns the columns of the rows CSV returns. The scanner column is
+// only filled in for results with provenance.
+func CSVHeader() []string {
+	return []string{"domain", "BIMI", "DKIM", "DMARC", "MX", "SPF", "error", "advice", "scanner"}
+}
+
+func (s *ScanResult) CSV() []string {
 	var advice string
 
-	for _, value := range s.Advice.Domain {
+	// a result that wasn't advised on has no advice to list
+	lines := s.Advice
+	if lines == nil {
+		lines = &advisor.Advice{}
+	}
+
+	for _, value := range lines.Domain {
 		advice += "Domain: " + value + "; "
 	}
 
-	for _, value := range s.Advice.BIMI {
+	for _, value := range lines.ARC {
+		advice += "ARC: " + value + "; "
+	}
+
+	for _, value := range lines.BIMI {
 		advice += "BIMI: " + value + "; "
 	}
 
-	for _, value := range s.Advice.DKIM {
+	for _, value := range lines.Blocklists {
+		advice += "Blocklists: " + value + "; "
+	}
+
+	for _, value := range lines.Certificates {
+		advice += "Certificates: " + value + "; "
+	}
+
+	for _, value := range lines.DKIM {
 		advice += "DKIM: " + value + "; "
 	}
 
-	for _, value := range s.Advice.DMARC {
+	for _, value := range lines.DMARC {
 		advice += "DMARC: " + value + "; "
 	}
 
-	for _, value := range s.Advice.MX {
+	for _, value := range lines.Lookalikes {
+		advice += "Lookalikes: " + value + "; "
+	}
+
+	for _, value := range lines.MTASTS {
+		advice += "MTA-STS: " + value + "; "
+	}
+
+	for _, value := range lines.MX {
 		advice += "MX: " + value + "; "
 	}
 
-	for _, value := range s.Advice.SPF {
+	for _, value := range lines.SOA {
+		advice += "SOA: " + value + "; "
+	}
+
+	for _, value := range lines.SPF {
 		advice += "SPF: " + value + "; "
 	}
 
-	return []string{s.ScanResult.Domain, s.ScanResult.BIMI, s.ScanResult.DKIM, s.ScanResult.DMARC, strings.Join(s.ScanResult.MX, "; "), s.ScanResult.SPF, s.ScanResult.Error, advice}
+	for _, value := range lines.Subdomains {
+		advice += "Subdomains: " + value + "; "
+	}
+
+	for _, value := range lines.TXT {
+		advice += "TXT: " + value + "; "
+	}
+
+	// the extensions are listed under their check names, in the order of their names
+	extensions := make([]string, 0, len(lines.Extensions))
+	for name := range lines.Extensions {
+		extensions = append(extensions, name)
+	}
+
+	sort.Strings(extensions)
+
+	for _, name := range extensions {
+		for _, value := range lines.Extensions[name] {
+			advice += name + ": " + value + "; "
+		}
+	}
+
+	record := []string{s.ScanResult.Domain, s.ScanResult.BIMI, s.ScanResult.DKIM, s.ScanResult.DMARC, strings.Join(s.ScanResult.MX, "; "), s.ScanResult.SPF, s.ScanResult.Error, advice}
+
+	if s.Scanner != nil {
+		record = append(record, s.Scanner.String())
+	}
+
+	return record
 }
@@ -0,0 +1,563 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAdvise(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false)
+	parked := domainAdvisor.CheckParked("", nil, "").Domain
+
+	result := &scanner.Result{Domain: "example.com", MX: []string{"mx1.example.com."}}
+	require.NotEqual(t, parked, Advise(context.Background(), domainAdvisor, result, false).Domain)
+	require.Equal(t, parked, Advise(context.Background(), domainAdvisor, result, true).Domain)
+
+	result.Parked = &scanner.ParkedAssessment{Likely: true}
+	require.Equal(t, parked, Advise(context.Background(), domainAdvisor, result, false).Domain)
+}
+
+func TestAdvise_TCPFallback(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false)
+
+	result := &scanner.Result{Domain: "example.com", SPF: "v=spf1 -all", TCPFallback: []string{"dmarc", "spf"}}
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+
+	require.Len(t, advice.SPF, 2)
+	require.Equal(t, domainAdvisor.CheckTCPFallback(lookalike.SPF), advice.SPF[1:])
+
+	// there's no DMARC record, so there's nothing the note could apply to
+	require.Equal(t, domainAdvisor.CheckDMARC(""), advice.DMARC)
+}
+
+func TestNewScanResult(t *testing.T) {
+	result := &scanner.Result{
+		Domain: "example.com", DMARC: "v=DMARC1; p=none", SPF: "v=spf1 -all",
+		Parked: &scanner.ParkedAssessment{}, SOA: &scanner.SOA{Serial: 2024060101}, CNAME: []string{"example.herokudns.com"}, Timings: map[string]string{"dmarc_lookup": "1ms"},
+	}
+	advice := &advisor.Advice{DMARC: []string{"You are currently at the lowest level and receiving reports"}, CertificateReport: &advisor.CertificateReport{}}
+
+	t.Run("Summary", func(t *testing.T) {
+		res := NewScanResult(result, advice, false)
+
+		require.Equal(t, SchemaVersion, res.SchemaVersion)
+		require.Equal(t, "example.com", res.Domain)
+		require.NotNil(t, res.ScannedAt)
+		require.Same(t, advice, res.Advice)
+		require.Nil(t, res.Parsed)
+		require.Nil(t, res.Findings)
+		require.Nil(t, res.Certificates)
+		require.Nil(t, res.Parked)
+		require.Nil(t, res.SOA)
+		require.Nil(t, res.CNAME)
+		require.Nil(t, res.Timings)
+	})
+
+	t.Run("Detailed", func(t *testing.T) {
+		res := NewScanResult(result, advice, true)
+
+		require.Equal(t, &ParsedRecords{DMARC: map[string]string{"v": "DMARC1", "p": "none"}, SPF: []string{"-all"}}, res.Parsed)
+		require.Equal(t, []Finding{{
+			Check: "dmarc", Message: advice.DMARC[0], Severity: advisor.Classify(advice.DMARC[0]).String(),
+			Reference: "https://www.rfc-editor.org/rfc/rfc7489#section-6.3", Remediation: "Review the aggregate reports, then move the DMARC policy to p=quarantine or p=reject.",
+		}}, res.Findings)
+		require.Same(t, advice.CertificateReport, res.Certificates)
+		require.Same(t, result.Parked, res.Parked)
+		require.Same(t, result.SOA, res.SOA)
+		require.Equal(t, result.CNAME, res.CNAME)
+		require.Equal(t, result.Timings, res.Timings)
+	})
+
+	t.Run("NoAdvice", func(t *testing.T) {
+		res := NewScanResult(result, nil, true)
+
+		require.Nil(t, res.Advice)
+		require.Nil(t, res.Findings)
+		require.NotNil(t, res.Parsed)
+	})
+}
+
+func TestScanResult_RoundTrip(t *testing.T) {
+	scannedAt := time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	result := ScanResult{
+		SchemaVersion: SchemaVersion,
+		Domain:        "example.com",
+		ScannedAt:     &scannedAt,
+		ScanResult: &scanner.Result{
+			Domain: "example.com", BIMI: "v=BIMI1; l=https://example.com/logo.svg", DMARC: "v=DMARC1; p=reject", MX: []string{"mx.example.com."},
+			SPF: "v=spf1 mx -all", TCPFallback: []string{"spf"}, SendingSubdomains: []scanner.SendingSubdomain{{Name: "em.example.com", SPF: "v=spf1 -all"}},
+		},
+		Parsed:   &ParsedRecords{BIMI: map[string]string{"v": "BIMI1", "l": "https://example.com/logo.svg"}, DMARC: map[string]string{"v": "DMARC1", "p": "reject"}, SPF: []string{"mx", "-all"}},
+		Advice:   &advisor.Advice{DMARC: []string{"dmarc"}, SPF: []string{"spf"}, Providers: []string{"Google Workspace"}},
+		Findings: []Finding{{Check: "dmarc", Message: "dmarc", Severity: "info"}},
+		Parked:   &scanner.ParkedAssessment{Signals: []string{"no MX records"}},
+		Timings:  map[string]string{"dmarc_lookup": "1ms"},
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+
+		var decoded ScanResult
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		require.Equal(t, result, decoded)
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		data, err := yaml.Marshal(result)
+		require.NoError(t, err)
+
+		var decoded ScanResult
+		require.NoError(t, yaml.Unmarshal(data, &decoded))
+		require.Equal(t, result, decoded)
+	})
+
+	t.Run("PreviousVersion", func(t *testing.T) {
+		// results stored (or served) before the result was unified still decode
+		versioned, err := result.Versioned(1)
+		require.NoError(t, err)
+
+		data, err := json.Marshal(versioned)
+		require.NoError(t, err)
+
+		var decoded ScanResult
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		require.Zero(t, decoded.SchemaVersion)
+		require.Equal(t, versioned.ScanResult, decoded.ScanResult)
+		require.Equal(t, versioned.Advice, decoded.Advice)
+		require.Equal(t, "example.com", decoded.ScanResult.Domain)
+		require.Empty(t, decoded.Domain)
+		require.Nil(t, decoded.Findings)
+	})
+}
+
+func TestAdvise_DKIMKeys(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false)
+
+	result := &scanner.Result{
+		Domain: "example.com", DKIM: "v=DKIM1; k=rsa; p=KEY", DKIMSelector: "s1",
+		DKIMKeys: []scanner.DKIMKey{
+			{Selector: "s1", Record: "v=DKIM1; k=rsa; p=KEY"},
+			{Selector: "ed", Record: "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="},
+		},
+	}
+
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+	require.Contains(t, advice.DKIM, domainAdvisor.CheckDKIMKeys([]advisor.DKIMKey{{Selector: "s1", Record: result.DKIMKeys[0].Record}, {Selector: "ed", Record: result.DKIMKeys[1].Record}})[0])
+
+	// without other keys, only the result's own key is checked
+	result.DKIMKeys = nil
+	advice = Advise(context.Background(), domainAdvisor, result, false)
+	require.Contains(t, advice.DKIM, domainAdvisor.CheckDKIMKeys([]advisor.DKIMKey{{Selector: "s1", Record: result.DKIM}})[0])
+}
+
+func TestAdvise_DKIMSelectors(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false)
+
+	result := &scanner.Result{
+		Domain:             "example.com",
+		DKIMSelectorChecks: []scanner.DKIMSelectorCheck{{Selector: "mail2023", Found: false}},
+	}
+
+	// a missing supplied selector replaces the hedge about only looking up known selectors
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, domainAdvisor.CheckDKIMSelectors("example.com", []advisor.DKIMSelectorCheck{{Selector: "mail2023", Found: false}}), advice.DKIM)
+
+	result.DKIM, result.DKIMSelector = "v=DKIM1; k=rsa; p=KEY", "s1"
+	result.DKIMSelectorChecks = append(result.DKIMSelectorChecks, scanner.DKIMSelectorCheck{Selector: "s1", Found: true})
+
+	advice = Advise(context.Background(), domainAdvisor, result, false)
+	require.Contains(t, advice.DKIM, domainAdvisor.CheckDKIM(result.DKIM)[0])
+	require.Contains(t, advice.DKIM, "The selector s1 publishes a DKIM key at s1._domainkey.example.com.")
+}
+
+func TestAdvise_DKIMDiscovery(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false)
+
+	// keys that weren't looked up aren't missing
+	result := &scanner.Result{Domain: "example.com", DKIMDiscovery: scanner.DKIMDiscoverySkipped}
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, domainAdvisor.CheckDKIMSkipped("example.com"), advice.DKIM)
+
+	// nor are keys whose lookup failed, and the failure is quoted
+	result = &scanner.Result{Domain: "example.com", DKIMDiscovery: scanner.DKIMDiscoveryFailed, Errors: map[string]error{"dkim": errors.New("i/o timeout")}}
+	advice = Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, domainAdvisor.CheckDKIMLookupFailed("example.com", "", result.Errors["dkim"]), advice.DKIM)
+	require.Contains(t, advice.DKIM[0], "(i/o timeout)")
+
+	result = &scanner.Result{Domain: "example.com", DKIMDiscovery: scanner.DKIMDiscoveryAbsent}
+	advice = Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, domainAdvisor.CheckDKIM(""), advice.DKIM)
+}
+
+func TestAdvise_Blocklists(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false)
+
+	result := &scanner.Result{Domain: "example.com"}
+
+	// without the check, there's no blocklist advice
+	require.Nil(t, Advise(context.Background(), domainAdvisor, result, false).Blocklists)
+
+	result.Blocklistings = []scanner.Blocklisting{}
+	require.Equal(t, domainAdvisor.CheckBlocklists(nil), Advise(context.Background(), domainAdvisor, result, false).Blocklists)
+
+	result.Blocklistings = []scanner.Blocklisting{{Address: "192.0.2.1", Source: "spf", Zone: "zen.spamhaus.org", Codes: []string{"127.0.0.2"}}}
+	require.Equal(t, domainAdvisor.CheckBlocklists([]advisor.Blocklisting{{Address: "192.0.2.1", Source: "spf", Zone: "zen.spamhaus.org", Codes: []string{"127.0.0.2"}}}), Advise(context.Background(), domainAdvisor, result, false).Blocklists)
+}
+
+func TestAdvise_Lookalikes(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false)
+
+	result := &scanner.Result{Domain: "example.com"}
+
+	// without the check, there's no lookalike advice
+	require.Nil(t, Advise(context.Background(), domainAdvisor, result, false).Lookalikes)
+
+	result.Lookalikes = []scanner.Lookalike{}
+	require.Equal(t, domainAdvisor.CheckLookalikes(nil), Advise(context.Background(), domainAdvisor, result, false).Lookalikes)
+
+	result.Lookalikes = []scanner.Lookalike{{Name: "examp1e.com", Technique: scanner.LookalikeConfusable, Addresses: []string{"192.0.2.1"}, MX: []string{"mx.examp1e.com."}, SPF: "v=spf1 +all"}}
+	require.Equal(t, domainAdvisor.CheckLookalikes([]advisor.Lookalike{{Name: "examp1e.com", Technique: "confusable", MX: []string{"mx.examp1e.com."}, SPF: "v=spf1 +all"}}), Advise(context.Background(), domainAdvisor, result, false).Lookalikes)
+}
+
+func TestAdvise_MTASTS(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{Domain: "example.com", MX: []string{"mx1.example.com."}}
+
+	// without the lookup, there's no MTA-STS advice
+	require.Nil(t, Advise(context.Background(), domainAdvisor, result, false).MTASTS)
+
+	for _, records := range [][]string{{}, {"v=STSv1; id=20240101"}} {
+		result.MTASTS = records
+
+		expected, err := domainAdvisor.CheckMTASTS(context.Background(), "example.com", records, result.MX)
+		require.NoError(t, err)
+		require.Equal(t, expected, Advise(context.Background(), domainAdvisor, result, false).MTASTS)
+	}
+}
+
+func TestNewScanResult_Errors(t *testing.T) {
+	result := &scanner.Result{
+		Domain: "example.com",
+		Error:  "dmarc:read udp 10.0.0.2:52711->10.0.0.1:53: i/o timeout",
+		Errors: map[string]error{"dmarc": &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}},
+	}
+
+	advice := &advisor.Advice{Errors: map[string]error{
+		"mx":     fmt.Errorf("mx.example.com: %w", &advisor.ProxyError{Proxy: "proxy.internal:1080", Err: errors.New("connection refused")}),
+		"domain": fmt.Errorf("check abandoned after 5s: %w", context.DeadlineExceeded),
+	}}
+
+	// the errors are included in every output, as the advice they're missing from would otherwise go unnoticed
+	res := NewScanResult(result, advice, false)
+	require.Equal(t, map[string]CheckError{
+		"dmarc_lookup": {Kind: "resolver", Message: "read: i/o timeout"},
+		"domain_check": {Kind: "timeout", Message: "check abandoned after 5s: context deadline exceeded"},
+		"mx_check":     {Kind: "egress", Message: "mx.example.com: failed to reach proxy proxy.internal:1080: connection refused"},
+	}, res.Errors)
+
+	require.Nil(t, NewScanResult(&scanner.Result{Domain: "example.com"}, &advisor.Advice{}, true).Errors)
+}
+
+func TestAdvise_LookupFailed(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	// the records are unknown rather than missing, so there's no advice that they're missing
+	result := &scanner.Result{Domain: "example.com", Error: scanner.ErrLookupFailed, Errors: map[string]error{"ns": errors.New("i/o timeout")}}
+	require.Nil(t, Advise(context.Background(), domainAdvisor, result, false))
+}
+
+func TestAdvise_Authoritative(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{Domain: "example.com", DMARC: "v=DMARC1; p=none"}
+	expected := Advise(context.Background(), domainAdvisor, result, false)
+
+	// matching answers add nothing, and a mismatch is noted with its lookup's advice
+	result.Authoritative = []scanner.AuthoritativeAnswer{
+		{Lookup: "txt", Name: "example.com", Type: "TXT", Server: "ns1.example.com", TTL: 300},
+		{Lookup: "dmarc", Name: "_dmarc.example.com", Type: "TXT", Server: "ns1.example.com", TTL: 120, Records: []string{"v=DMARC1; p=reject"}, Recursive: []string{"v=DMARC1; p=none"}, Mismatch: true},
+	}
+
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, expected.TXT, advice.TXT)
+	require.Equal(t, append(expected.DMARC, domainAdvisor.CheckAuthoritativeAnswer(advisor.AuthoritativeAnswer{Name: "_dmarc.example.com", Type: "TXT", Server: "ns1.example.com", TTL: 120, Mismatch: true})...), advice.DMARC)
+}
+
+func TestAdvise_Oversized(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{
+		Domain:    "example.com",
+		DMARC:     "v=DMARC1; p=reject",
+		Oversized: map[string]string{"spf": "the answer for example.com has more than 100 TXT records", "caa": "the answers for example.com exceed 32768 bytes"},
+	}
+
+	// the oversized records weren't evaluated, so they aren't reported as missing
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, domainAdvisor.CheckOversized("spf", "the answer for example.com has more than 100 TXT records"), advice.SPF)
+	require.Equal(t, domainAdvisor.CheckOversized("caa", "the answers for example.com exceed 32768 bytes"), advice.Domain)
+}
+
+func TestAdvise_SOA(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{Domain: "example.com"}
+
+	// subdomains that aren't the apex of a zone have no SOA advice
+	require.Nil(t, Advise(context.Background(), domainAdvisor, result, false).SOA)
+
+	result.SOA = &scanner.SOA{MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 2024060101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 3600, TTL: 3600}
+	require.Equal(t, domainAdvisor.CheckSOA(context.Background(), &advisor.SOA{MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 2024060101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 3600, TTL: 3600}), Advise(context.Background(), domainAdvisor, result, false).SOA)
+}
+
+func TestScanResult_Canonical(t *testing.T) {
+	scannedAt := time.Now()
+
+	result := ScanResult{
+		ScannedAt:  &scannedAt,
+		ScanResult: &scanner.Result{Domain: "example.com", NS: []string{"ns2.example.com.", "ns1.example.com."}, CAA: []string{`0 issue "pki.goog"`, `0 issue "letsencrypt.org"`}},
+		Advice:     &advisor.Advice{DMARC: []string{"b", "a"}},
+		Findings:   []Finding{{Check: "dmarc", Message: "b"}, {Check: "arc", Message: "c"}, {Check: "dmarc", Message: "a"}},
+		Timings:    map[string]string{"dmarc_lookup": "1ms"},
+	}
+
+	canonical := result.Canonical()
+	require.Nil(t, canonical.ScannedAt)
+	require.Nil(t, canonical.Timings)
+	require.Equal(t, []string{"ns1.example.com.", "ns2.example.com."}, canonical.ScanResult.NS)
+	require.Equal(t, []string{`0 issue "letsencrypt.org"`, `0 issue "pki.goog"`}, canonical.ScanResult.CAA)
+	require.Equal(t, []string{"a", "b"}, canonical.Advice.DMARC)
+	require.Equal(t, []Finding{{Check: "arc", Message: "c"}, {Check: "dmarc", Message: "a"}, {Check: "dmarc", Message: "b"}}, canonical.Findings)
+
+	// the result itself isn't modified
+	require.Equal(t, []string{"ns2.example.com.", "ns1.example.com."}, result.ScanResult.NS)
+	require.Equal(t, []string{"b", "a"}, result.Advice.DMARC)
+}
+
+func TestAdvise_CNAME(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{Domain: "example.com"}
+	require.Equal(t, []string{"Your domain looks good! No further action needed."}, Advise(context.Background(), domainAdvisor, result, false).Domain)
+
+	// the apex CNAME replaces the all-clear
+	result.CNAME = []string{"example.herokudns.com"}
+	require.Equal(t, domainAdvisor.CheckApexCNAME("example.com", result.CNAME), Advise(context.Background(), domainAdvisor, result, false).Domain)
+
+	// CNAMEs below the apex are allowed, and a subdomain's domain check is skipped
+	result.Domain = "www.example.com"
+	require.Empty(t, Advise(context.Background(), domainAdvisor, result, false).Domain)
+}
+
+func TestAdvise_Registration(t *testing.T) {
+	expires := map[string]time.Time{"example.com": time.Now().AddDate(1, 0, 0), "example.net": time.Now().AddDate(0, 0, 10)}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns.json" {
+			_, _ = fmt.Fprintf(w, `{"services":[[["com","net"],[%q]]]}`, server.URL+"/")
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, `{"status":["client transfer prohibited"],"events":[{"eventAction":"expiration","eventDate":%q}]}`, expires[r.URL.Path[len("/domain/"):]].Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithRDAP(server.URL+"/dns.json", 0))
+	defer domainAdvisor.Close()
+
+	// a registration that looks good is noted alongside the all-clear
+	advice := Advise(context.Background(), domainAdvisor, &scanner.Result{Domain: "example.com"}, false)
+	require.Len(t, advice.Domain, 2)
+	require.Equal(t, "Your domain looks good! No further action needed.", advice.Domain[0])
+	require.Equal(t, "example.com", advice.Registration.Domain)
+
+	// while an expiring one replaces it
+	advice = Advise(context.Background(), domainAdvisor, &scanner.Result{Domain: "example.net"}, false)
+	require.Len(t, advice.Domain, 1)
+	require.Contains(t, advice.Domain[0], "Your domain's registration expires on")
+
+	require.Same(t, advice.Registration, NewScanResult(&scanner.Result{Domain: "example.net"}, advice, true).Registration)
+	require.Nil(t, NewScanResult(&scanner.Result{Domain: "example.net"}, advice, false).Registration)
+}
+
+func TestAdvise_SecurityContacts(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "example.com" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = fmt.Fprintf(w, "Contact: mailto:security@example.com\nExpires: %s\n", time.Now().AddDate(0, 6, 0).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	// both domains are served by the test server, whose certificate is for example.com
+	client := server.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.ServerName = "example.com"
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithHTTPClient(client), advisor.WithSecurityTxt(true))
+	defer domainAdvisor.Close()
+
+	// a security.txt file that looks good is noted alongside the all-clear
+	advice := Advise(context.Background(), domainAdvisor, &scanner.Result{Domain: "example.com"}, false)
+	require.Len(t, advice.Domain, 2)
+	require.Equal(t, "Your domain looks good! No further action needed.", advice.Domain[0])
+	require.Equal(t, []string{"mailto:security@example.com"}, advice.SecurityContacts.Contacts)
+
+	// while a domain without any reachable contact replaces it
+	advice = Advise(context.Background(), domainAdvisor, &scanner.Result{Domain: "example.net"}, false)
+	require.Len(t, advice.Domain, 1)
+	require.Contains(t, advice.Domain[0], "so there's no reachable contact for reporting security issues")
+	require.False(t, advice.SecurityContacts.Reachable)
+
+	require.Same(t, advice.SecurityContacts, NewScanResult(&scanner.Result{Domain: "example.net"}, advice, true).SecurityContacts)
+	require.Nil(t, NewScanResult(&scanner.Result{Domain: "example.net"}, advice, false).SecurityContacts)
+}
+
+func TestAdvise_SPFRedirects(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{
+		Domain:       "example.com",
+		SPF:          "v=spf1 redirect=_spf.example.net",
+		SPFRedirects: []scanner.SPFRedirect{{Domain: "_spf.example.net", Record: "v=spf1 ip4:192.0.2.0/24 ~all"}},
+	}
+
+	// the redirect replaces the advice to add an all tag with the advice for the record it leads to
+	advice := Advise(context.Background(), domainAdvisor, result, false).SPF
+	require.Len(t, advice, 2)
+	require.Contains(t, advice[0], "hands its policy over to _spf.example.net")
+	require.Equal(t, domainAdvisor.CheckSPFRedirects("example.com", []advisor.SPFRedirect{{Domain: "_spf.example.net", Record: "v=spf1 ip4:192.0.2.0/24 ~all"}}, ""), advice[1:])
+}
+
+func TestAdvise_ManagedRecords(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{
+		Domain: "example.com",
+		DMARC:  "v=DMARC1; p=reject; rua=mailto:rua@easydmarc.example",
+		MX:     []string{"aspmx.l.google.com."},
+		SPF:    "v=spf1 include:_spf.google.com -all",
+	}
+
+	unmanaged := Advise(context.Background(), domainAdvisor, result, false)
+
+	// the records are checked as usual, noting the services hosting them
+	result.DMARCCNAME = []string{"example.com._d.easydmarc.pro"}
+	result.SPFCNAME = []string{"example.com._spf.smart.ondmarc.com"}
+
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, []string{"Google Workspace", "EasyDMARC", "Red Sift OnDMARC"}, advice.Providers)
+	require.Len(t, advice.DMARC, len(unmanaged.DMARC)+1)
+	require.Subset(t, advice.DMARC, unmanaged.DMARC)
+
+	managedDMARC, _ := domainAdvisor.CheckManagedRecord(lookalike.DMARC, "example.com", result.DMARCCNAME, result.DMARC)
+	require.Subset(t, advice.DMARC, managedDMARC)
+
+	managedSPF, _ := domainAdvisor.CheckManagedRecord(lookalike.SPF, "example.com", result.SPFCNAME, result.SPF)
+	require.Subset(t, advice.SPF, append(managedSPF, unmanaged.SPF...))
+
+	// targets that aren't a known service are only followed
+	result.DMARCCNAME, result.SPFCNAME = []string{"_dmarc.example.net"}, nil
+	advice = Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, unmanaged.Providers, advice.Providers)
+	require.Equal(t, unmanaged.DMARC, advice.DMARC)
+}
+
+func TestAdvise_SPFOverlaps(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{
+		Domain: "example.com",
+		DMARC:  "v=DMARC1; p=reject; rua=mailto:rua@example.com",
+		MX:     []string{"mx.example.com."},
+		SPF:    "v=spf1 ip4:203.0.113.0/24 ip4:198.51.100.7 include:_spf.example.net -all",
+	}
+
+	// without the includes, only the record's own mechanisms are compared
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+	for _, line := range advice.SPF {
+		require.NotContains(t, line, "can be removed")
+	}
+
+	result.SPF = "v=spf1 ip4:203.0.113.0/24 ip4:203.0.113.5 ip4:198.51.100.7 include:_spf.example.net -all"
+	result.SPFIncludes = []scanner.SPFInclude{{Domain: "_spf.example.net", Record: "v=spf1 ip4:198.51.100.0/24 ~all"}}
+
+	advice = Advise(context.Background(), domainAdvisor, result, false)
+	require.Contains(t, advice.SPF, "ip4:203.0.113.5 is already covered by ip4:203.0.113.0/24, so it can be removed to shorten your SPF record.")
+	require.Contains(t, advice.SPF, "ip4:198.51.100.7 is already authorized by include:_spf.example.net (through ip4:198.51.100.0/24), so it can be removed to shorten your SPF record, as long as the included records keep authorizing those addresses.")
+	require.NotContains(t, advice.SPF, "SPF seems to be setup correctly! No further action needed.")
+
+	// the record that applies is the redirect target's
+	result.SPF = "v=spf1 redirect=_spf.example.org"
+	result.SPFRedirects = []scanner.SPFRedirect{{Domain: "_spf.example.org", Record: "v=spf1 ip4:192.0.2.0/24 ip4:192.0.2.1 -all"}}
+	result.SPFIncludes = nil
+
+	advice = Advise(context.Background(), domainAdvisor, result, false)
+	require.Contains(t, advice.SPF, "_spf.example.org: ip4:192.0.2.1 is already covered by ip4:192.0.2.0/24, so it can be removed to shorten your SPF record.")
+}
+
+func TestAdvise_Organizational(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{
+		Domain: "mail.example.com",
+		MX:     []string{"mx.example.com."},
+		SPF:    "v=spf1 mx -all",
+		Organizational: &scanner.Organizational{
+			Domain:       "example.com",
+			PublicSuffix: "com",
+			Relationship: scanner.RelationshipSubdomain,
+		},
+	}
+
+	// without the organizational domain's record, the subdomain has no DMARC
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+	require.Contains(t, advice.DMARC, "You do not have DMARC setup!")
+
+	result.Organizational.DMARC = "v=DMARC1; p=reject"
+	advice = Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, domainAdvisor.CheckInheritedDMARC("mail.example.com", "example.com", "v=DMARC1; p=reject"), advice.DMARC)
+}
+
+func TestAdvise_Alignment(t *testing.T) {
+	domainAdvisor := advisor.NewAdvisor(time.Second, 0, false, advisor.WithOffline(true))
+
+	result := &scanner.Result{
+		Domain: "example.com",
+		DMARC:  "v=DMARC1; p=reject",
+		SPF:    "v=spf1 include:sendgrid.net -all",
+	}
+
+	advice := Advise(context.Background(), domainAdvisor, result, false)
+	require.Contains(t, advice.DMARC, domainAdvisor.CheckAlignment("example.com", "", "v=DMARC1; p=reject", result.SPF, nil)[0])
+
+	// the custom return path of a sending subdomain aligns under relaxed alignment
+	result.SendingSubdomains = []scanner.SendingSubdomain{{Name: "em.example.com", SPF: "v=spf1 include:sendgrid.net -all"}}
+	advice = Advise(context.Background(), domainAdvisor, result, false)
+	require.Equal(t, domainAdvisor.CheckDMARC("v=DMARC1; p=reject"), advice.DMARC)
+}
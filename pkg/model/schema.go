@@ -0,0 +1,169 @@
+package model
+
+import (
+	"embed"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/goccy/go-json"
+)
+
+// SchemaVersion is the version of ScanResult's JSON schema. It must be bumped
+// once for each release in which a field of the result (or of any type it
+// contains) is added, removed or changed, with the new schema committed under
+// schema/ (see TestSchema) and a shim added to Versioned for the previous
+// version. Changes made before the release go into its unreleased version
+// instead, by deleting that version's schema and running -update again.
+const SchemaVersion = 2
+
+//go:embed schema/*.json
+var schemaFiles embed.FS
+
+type (
+	// scanResultWithAdviceV1 is the shape of ScanResult in schema version 1,
+	// before the schema was versioned.
+	scanResultWithAdviceV1 struct {
+		ScanResult *scanResultV1 `json:"scanResult" yaml:"scanResult" doc:"The results of scanning a domain's DNS records."`
+		Advice     *adviceV1     `json:"advice,omitempty" yaml:"advice,omitempty" doc:"The advice for the domain's DNS records."`
+	}
+
+	// scanResultV1 is the shape of scanner.Result in schema version 1.
+	scanResultV1 struct {
+		Domain string   `json:"domain" yaml:"domain,omitempty" doc:"The domain name being scanned." example:"example.com"`
+		Error  string   `json:"error,omitempty" yaml:"error,omitempty" doc:"An error message if the scan failed." example:"invalid domain name"`
+		BIMI   string   `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"The BIMI record for the domain." example:"https://example.com/bimi.svg"`
+		DKIM   string   `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"The DKIM record for the domain." example:"v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`
+		DMARC  string   `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The DMARC record for the domain." example:"v=DMARC1; p=none"`
+		MX     []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"The MX records for the domain." example:"aspmx.l.google.com"`
+		NS     []string `json:"ns,omitempty" yaml:"ns,omitempty" doc:"The NS records for the domain." example:"ns1.example.com"`
+		SPF    string   `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The SPF record for the domain." example:"v=spf1 include:_spf.google.com ~all"`
+	}
+
+	// adviceV1 is the shape of advisor.Advice in schema version 1.
+	adviceV1 struct {
+		Domain []string `json:"domain,omitempty" yaml:"domain,omitempty" doc:"Domain advice." example:"Your domain looks good! No further action needed."`
+		BIMI   []string `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"BIMI advice." example:"Your BIMI record looks good! No further action needed."`
+		DKIM   []string `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"DKIM advice." example:"DKIM is setup for this email server. However, if you have other 3rd party systems, please send a test email to confirm DKIM is setup properly."`
+		DMARC  []string `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"DMARC advice." example:"You are currently at the lowest level and receiving reports, which is a great starting point. Please make sure to review the reports, make the appropriate adjustments, and move to either quarantine or reject soon."`
+		MX     []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"MX advice." example:"You have a multiple mail servers setup! No further action needed."`
+		SPF    []string `json:"spf,omitempty" yaml:"spf,omitempty" doc:"SPF advice." example:"SPF seems to be setup correctly! No further action needed."`
+	}
+)
+
+// Schema returns the committed JSON Schema of the given version of the
+// result, or an error if there's no such version.
+func Schema(version int) ([]byte, error) {
+	if version < 1 || version > SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d, it must be between 1 and %d", version, SchemaVersion)
+	}
+
+	return schemaFiles.ReadFile(fmt.Sprintf("schema/v%d.json", version))
+}
+
+// Versioned returns a copy of the result reshaped to the given schema version,
+// for clients that haven't been updated since. Fields that didn't exist in
+// that version are dropped. A version of 0 returns the current schema.
+func (s *ScanResult) Versioned(version int) (ScanResult, error) {
+	switch version {
+	case 0, SchemaVersion:
+		current := *s
+		current.SchemaVersion = SchemaVersion
+
+		return current, nil
+	case 1:
+		v1 := ScanResult{}
+		legacyAdvice := withIncompleteAdvice(s.Advice, s.Errors)
+
+		if s.ScanResult != nil {
+			v1.ScanResult = &scanner.Result{
+				Domain: s.ScanResult.Domain,
+				Error:  s.ScanResult.Error,
+				BIMI:   s.ScanResult.BIMI,
+				DKIM:   s.ScanResult.DKIM,
+				DMARC:  s.ScanResult.DMARC,
+				MX:     s.ScanResult.MX,
+				NS:     s.ScanResult.NS,
+				SPF:    s.ScanResult.EffectiveSPF(),
+			}
+		}
+
+		if legacyAdvice != nil {
+			v1.Advice = &advisor.Advice{
+				Domain: legacyAdvice.Domain,
+				BIMI:   legacyAdvice.BIMI,
+				DKIM:   legacyAdvice.DKIM,
+				DMARC:  legacyAdvice.DMARC,
+				MX:     legacyAdvice.MX,
+				SPF:    legacyAdvice.SPF,
+			}
+		}
+
+		return v1, nil
+	}
+
+	return *s, fmt.Errorf("unsupported schema version %d, it must be between 1 and %d", version, SchemaVersion)
+}
+
+// withIncompleteAdvice returns a copy of the advice with a line standing in for
+// each of its checks' errors (see advisor.IncompleteAdvice), as the checks
+// reported their errors as advice in version 1.
+func withIncompleteAdvice(advice *advisor.Advice, errs map[string]CheckError) *advisor.Advice {
+	if advice == nil {
+		return nil
+	}
+
+	legacy := *advice
+
+	sections := map[string]*[]string{
+		"bimi_check":   &legacy.BIMI,
+		"dkim_check":   &legacy.DKIM,
+		"dmarc_check":  &legacy.DMARC,
+		"domain_check": &legacy.Domain,
+		"mtasts_check": &legacy.MTASTS,
+		"mx_check":     &legacy.MX,
+		"spf_check":    &legacy.SPF,
+	}
+
+	for name, checkErr := range errs {
+		if section, ok := sections[name]; ok {
+			*section = append(slices.Clip(*section), advisor.IncompleteAdvice(checkErr.Kind))
+		}
+	}
+
+	return &legacy
+}
+
+// generateSchema generates the JSON Schema of the given version of the result
+// from its Go types.
+func generateSchema(version int) ([]byte, error) {
+	var root reflect.Type
+
+	switch version {
+	case 1:
+		root = reflect.TypeOf(scanResultWithAdviceV1{})
+	case SchemaVersion:
+		root = reflect.TypeOf(ScanResult{})
+	default:
+		return nil, fmt.Errorf("unsupported schema version %d, it must be between 1 and %d", version, SchemaVersion)
+	}
+
+	registry := huma.NewMapRegistry("#/$defs/", huma.DefaultSchemaNamer)
+	schema := registry.Schema(root, true, "")
+
+	data, err := json.MarshalIndent(map[string]any{
+		"$schema":          "https://json-schema.org/draft/2020-12/schema",
+		"$ref":             schema.Ref,
+		"$defs":            registry.Map(),
+		"title":            "Domain Security Scanner result",
+		"x-schema-version": version,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+
+	return append(data, '\n'), nil
+}
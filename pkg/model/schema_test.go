@@ -0,0 +1,159 @@
+package model
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "commit the schema of any version that doesn't exist yet, and update the golden files")
+
+// TestSchema fails if the result's Go types have drifted from the committed
+// schema of any version. As -update never overwrites an existing schema, any
+// change to the current types also requires SchemaVersion to be bumped.
+func TestSchema(t *testing.T) {
+	for version := 1; version <= SchemaVersion; version++ {
+		generated, err := generateSchema(version)
+		require.NoError(t, err)
+
+		path := filepath.Join("schema", fmt.Sprintf("v%d.json", version))
+
+		committed, err := os.ReadFile(path)
+		if os.IsNotExist(err) && *update {
+			require.NoError(t, os.WriteFile(path, generated, 0o644))
+			continue
+		}
+
+		require.NoError(t, err, "run go test ./pkg/model -run TestSchema -update to commit the schema of version %d", version)
+		require.JSONEq(t, string(committed), string(generated), "the result types have drifted from %s, so bump SchemaVersion and run go test ./pkg/model -run TestSchema -update", path)
+	}
+
+	_, err := Schema(SchemaVersion + 1)
+	require.Error(t, err)
+}
+
+func TestScanResult_Versioned(t *testing.T) {
+	scannedAt := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	result := ScanResult{
+		Domain:    "example.com",
+		ScannedAt: &scannedAt,
+		Scanner:   &Provenance{Version: "3.0.14", Commit: "5c217c3", ConfigHash: "sha256:0", AdviceCatalog: "3f2a9c1b7d4e"},
+		Parsed:    &ParsedRecords{DMARC: map[string]string{"v": "DMARC1", "p": "none"}, SPF: []string{"-all"}},
+		ScanResult: &scanner.Result{
+			Domain: "example.com", Error: "dmarc:timeout", Addresses: []string{"192.0.2.1"}, ARC: "v=DKIM1; p=KEY", ARCSelector: "arc",
+			BIMI: "v=BIMI1;", DKIM: "v=DKIM1; p=KEY", DKIMSelector: "s1", DKIMSegments: []int{8, 6}, DMARC: "v=DMARC1; p=none", MX: []string{"mx.example.com."},
+			NS: []string{"ns.example.com."}, SPF: "v=spf1 redirect=_spf.example.net", DKIMWildcard: true, DMARCWildcard: true, TCPFallback: []string{"spf"},
+			CAA: []string{`0 issue "letsencrypt.org"`}, DKIMKeys: []scanner.DKIMKey{{Selector: "s1", Record: "v=DKIM1; p=KEY", Segments: []int{8, 6}}}, SendingSubdomains: []scanner.SendingSubdomain{{Name: "em.example.com", SPF: "v=spf1 -all"}},
+			Blocklistings:      []scanner.Blocklisting{{Address: "192.0.2.1", Source: "spf", Zone: "zen.spamhaus.org", Codes: []string{"127.0.0.2"}}},
+			DKIMSelectorChecks: []scanner.DKIMSelectorCheck{{Selector: "s1", Found: true}}, DKIMDiscovery: scanner.DKIMDiscoveryFound,
+			SPFRedirects:   []scanner.SPFRedirect{{Domain: "_spf.example.net", Record: "v=spf1 ip4:192.0.2.0/24 -all"}},
+			SPFIncludes:    []scanner.SPFInclude{{Domain: "_spf.example.org", Record: "v=spf1 ip4:198.51.100.0/24 -all"}},
+			Organizational: &scanner.Organizational{Domain: "example.com", PublicSuffix: "com", Relationship: scanner.RelationshipOrganizational, Published: []string{"dmarc", "spf"}},
+			TXT:            []string{"v=spf1 redirect=_spf.example.net"}, TXTSize: 96,
+			Rcodes:        map[string]string{"bimi": "NXDOMAIN"},
+			Oversized:     map[string]string{"txt": "the answer for example.com has more than 100 TXT records"},
+			Lookalikes:    []scanner.Lookalike{{Name: "examp1e.com", Technique: "confusable", MX: []string{"mx.example.net."}, SPF: "v=spf1 +all"}},
+			MTASTS:        []string{"v=STSv1; id=20240101"},
+			DMARCCNAME:    []string{"example.com._d.easydmarc.pro"},
+			SPFCNAME:      []string{"example.com.spf.example.net"},
+			Authoritative: []scanner.AuthoritativeAnswer{{Lookup: "dmarc", Name: "_dmarc.example.com", Type: "TXT", Server: "ns.example.com", TTL: 300, Records: []string{"v=DMARC1; p=none"}}},
+		},
+		Advice: &advisor.Advice{
+			Domain: []string{"domain"}, ARC: []string{"arc"}, BIMI: []string{"bimi"}, DKIM: []string{"dkim"}, DMARC: []string{"dmarc"},
+			MX: []string{"mx"}, SOA: []string{"soa"}, SPF: []string{"spf"}, Providers: []string{"Google Workspace"},
+			Blocklists: []string{"blocklists"}, Certificates: []string{"certificates"}, Subdomains: []string{"subdomains"},
+			TXT: []string{"txt"}, Lookalikes: []string{"lookalikes"}, MTASTS: []string{"mtasts"},
+			Extensions: map[string][]string{"dane": {"dane"}},
+		},
+		Findings:         []Finding{{Check: "dmarc", Message: "dmarc", Severity: "info", Status: FindingNew, Reference: "https://www.rfc-editor.org/rfc/rfc7489#section-6.3", Remediation: "remediation"}},
+		Resolved:         []Finding{{Check: "spf", Message: "spf", Severity: "high", Status: FindingResolved}},
+		Explanations:     []Explanation{{Check: "dmarc", Message: "dmarc", Severity: "info", Fragments: []string{"p=none"}, Answers: []ExplainedAnswer{{Name: "_dmarc.example.com", Type: "TXT", Records: []string{"v=DMARC1; p=none"}}}, Thresholds: map[string]string{"spfLookupLimit": "10"}}},
+		Certificates:     &advisor.CertificateReport{Total: 1},
+		Registration:     &advisor.Registration{Domain: "example.com", TransferLocked: true, Server: "https://rdap.example/domain/example.com"},
+		Plan:             &Plan{Domain: "example.com", Policy: "p=none", Steps: []PlanStep{{Week: 1, Action: "action", Name: "_dmarc.example.com", Record: "v=DMARC1; p=none; rua=mailto:dmarc@example.com"}}},
+		SecurityContacts: &advisor.SecurityContacts{SecurityTxt: "https://example.com/.well-known/security.txt", Contacts: []string{"mailto:security@example.com"}, Reachable: true},
+		Deduplicated:     true,
+		Options:          &ScanOptions{Selectors: []string{"mail2023"}, Checks: []string{"tls"}, Timeout: "30s"},
+		Parked:           &scanner.ParkedAssessment{Likely: true},
+		SOA:              &scanner.SOA{MName: "ns.example.com", RName: "hostmaster.example.com", Serial: 2024060101},
+		CNAME:            []string{"example.herokudns.com"},
+		Timings:          map[string]string{"dmarc_lookup": "1ms"},
+		Errors:           map[string]CheckError{"mx_check": {Kind: advisor.ErrorKindEgress, Message: "mx.example.com: failed to reach proxy proxy.internal:1080: connection refused"}},
+	}
+
+	t.Run("Current", func(t *testing.T) {
+		versioned, err := result.Versioned(0)
+		require.NoError(t, err)
+		require.Equal(t, SchemaVersion, versioned.SchemaVersion)
+		require.Equal(t, result.ScanResult, versioned.ScanResult)
+	})
+
+	t.Run("V1", func(t *testing.T) {
+		versioned, err := result.Versioned(1)
+		require.NoError(t, err)
+
+		data, err := json.Marshal(versioned)
+		require.NoError(t, err)
+
+		// every field of the shim's output must be in the v1 schema, and vice versa
+		var output map[string]map[string]any
+		require.NoError(t, json.Unmarshal(data, &output))
+
+		schema, err := Schema(1)
+		require.NoError(t, err)
+
+		var document struct {
+			Defs map[string]struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"$defs"`
+		}
+		require.NoError(t, json.Unmarshal(schema, &document))
+
+		require.Equal(t, keys(document.Defs["ScanResultWithAdviceV1"].Properties), keys(output))
+		require.Equal(t, keys(document.Defs["ScanResultV1"].Properties), keys(output["scanResult"]))
+		require.Equal(t, keys(document.Defs["AdviceV1"].Properties), keys(output["advice"]))
+	})
+
+	t.Run("EffectiveSPF", func(t *testing.T) {
+		// the SPF record was the one its redirects led to in version 1
+		versioned, err := result.Versioned(1)
+		require.NoError(t, err)
+		require.Equal(t, "v=spf1 ip4:192.0.2.0/24 -all", versioned.ScanResult.SPF)
+		require.Equal(t, "v=spf1 redirect=_spf.example.net", result.ScanResult.SPF)
+	})
+
+	t.Run("IncompleteAdvice", func(t *testing.T) {
+		// the checks reported their errors as advice in version 1
+		versioned, err := result.Versioned(1)
+		require.NoError(t, err)
+		require.Nil(t, versioned.Errors)
+		require.Equal(t, []string{"mx", advisor.IncompleteAdvice(advisor.ErrorKindEgress)}, versioned.Advice.MX)
+		require.Equal(t, []string{"mx"}, result.Advice.MX)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := result.Versioned(SchemaVersion + 1)
+		require.Error(t, err)
+	})
+}
+
+func keys[T any](values map[string]T) []string {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+)
+
+type (
+	// SimulateRequest is the request body used to evaluate a hypothetical
+	// message against a domain's published DMARC policy.
+	SimulateRequest struct {
+		Domain       string `json:"domain" maxLength:"255" doc:"The domain of the message's From header, whose DMARC policy applies." example:"example.com"`
+		EnvelopeFrom string `json:"envelopeFrom,omitempty" maxLength:"255" doc:"The domain SPF authenticated, from the message's envelope sender (Return-Path)." example:"bounce.esp.example.net"`
+		SPF          string `json:"spf,omitempty" enum:"pass,fail,softfail,neutral,none,temperror,permerror" doc:"The result of the SPF check." example:"pass"`
+		DKIMDomain   string `json:"dkimDomain,omitempty" maxLength:"255" doc:"The d= domain of the message's DKIM signature." example:"example.com"`
+		DKIM         string `json:"dkim,omitempty" enum:"pass,fail,neutral,none,temperror,permerror" doc:"The result of verifying the DKIM signature." example:"pass"`
+		Source       string `json:"source,omitempty" maxLength:"45" doc:"The IP address the message was sent from. It's only echoed back, as the SPF result is given." example:"192.0.2.1"`
+	}
+
+	// SimulateResponse is the response body returned when evaluating a message
+	// against a domain's DMARC policy.
+	SimulateResponse struct {
+		Domain       string               `json:"domain" yaml:"domain" doc:"The normalized From domain." example:"example.com"`
+		PolicyDomain string               `json:"policyDomain,omitempty" yaml:"policyDomain,omitempty" doc:"The domain whose DMARC record applies, which is the From domain's organizational domain if it has no record of its own." example:"example.com"`
+		Record       string               `json:"record,omitempty" yaml:"record,omitempty" doc:"The DMARC record that applies." example:"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"`
+		Result       string               `json:"result" yaml:"result" enum:"pass,fail,none" doc:"Whether the message passes DMARC, or none if no policy applies." example:"pass"`
+		SPF          SimulatedIdentifier  `json:"spf" yaml:"spf" doc:"The SPF identifier's result and alignment."`
+		DKIM         SimulatedIdentifier  `json:"dkim" yaml:"dkim" doc:"The DKIM identifier's result and alignment."`
+		PolicyTag    string               `json:"policyTag,omitempty" yaml:"policyTag,omitempty" enum:"p,sp" doc:"The tag of the policy that applies, sp for a subdomain covered by its organizational domain's record." example:"p"`
+		Policy       string               `json:"policy,omitempty" yaml:"policy,omitempty" enum:"none,quarantine,reject" doc:"The policy that applies." example:"reject"`
+		Disposition  SimulatedDisposition `json:"disposition" yaml:"disposition" doc:"The percentage of such messages receivers reject, quarantine and deliver, which only differ from delivering them all if DMARC fails."`
+		Explanation  string               `json:"explanation" yaml:"explanation" doc:"Why the message passes or fails, and what receivers do with it." example:"The message passes DMARC, as DKIM passed for example.com, which aligns with the From domain (relaxed), so receivers deliver it as normal."`
+		Source       string               `json:"source,omitempty" yaml:"source,omitempty" doc:"The IP address the message was sent from, as given." example:"192.0.2.1"`
+	}
+
+	// SimulatedIdentifier is whether an authenticated identifier passed, and
+	// whether it aligns with the From domain.
+	SimulatedIdentifier struct {
+		Domain  string `json:"domain,omitempty" yaml:"domain,omitempty" doc:"The authenticated domain." example:"example.com"`
+		Result  string `json:"result,omitempty" yaml:"result,omitempty" doc:"The authentication result." example:"pass"`
+		Mode    string `json:"mode" yaml:"mode" enum:"relaxed,strict" doc:"The alignment mode, from the record's aspf or adkim tag." example:"relaxed"`
+		Aligned bool   `json:"aligned" yaml:"aligned" doc:"Whether the identifier passed, and aligns with the From domain."`
+	}
+
+	// SimulatedDisposition is how receivers treat a message, as percentages.
+	SimulatedDisposition struct {
+		Reject     int `json:"reject" yaml:"reject" doc:"The percentage of such messages rejected." example:"0"`
+		Quarantine int `json:"quarantine" yaml:"quarantine" doc:"The percentage of such messages quarantined." example:"0"`
+		Deliver    int `json:"deliver" yaml:"deliver" doc:"The percentage of such messages delivered as normal." example:"100"`
+	}
+)
+
+// Message returns the message facts of the request, for advisor.EvaluateDMARC.
+func (r *SimulateRequest) Message() advisor.DMARCMessage {
+	return advisor.DMARCMessage{FromDomain: r.Domain, EnvelopeFrom: r.EnvelopeFrom, SPFResult: r.SPF, DKIMDomain: r.DKIMDomain, DKIMResult: r.DKIM}
+}
+
+// NewSimulateResponse returns the response for the evaluation of a message
+// against the record published for policyDomain.
+func NewSimulateResponse(request *SimulateRequest, policyDomain, record string, evaluation advisor.DMARCEvaluation) SimulateResponse {
+	response := SimulateResponse{
+		Domain:      request.Domain,
+		Result:      evaluation.Result,
+		SPF:         SimulatedIdentifier(evaluation.SPF),
+		DKIM:        SimulatedIdentifier(evaluation.DKIM),
+		PolicyTag:   evaluation.PolicyTag,
+		Policy:      evaluation.Policy,
+		Disposition: SimulatedDisposition(evaluation.Disposition),
+		Explanation: evaluation.String(),
+		Source:      request.Source,
+	}
+
+	if record != "" {
+		response.PolicyDomain, response.Record = policyDomain, record
+	}
+
+	return response
+}
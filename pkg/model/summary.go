@@ -0,0 +1,288 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+)
+
+// DefaultSummaryOffenders is the number of worst offenders a summary ranks.
+const DefaultSummaryOffenders = 10
+
+var (
+	// summaryPolicies are the DMARC policy levels a summary counts domains
+	// by, strongest first. Domains without a valid policy are missing one.
+	summaryPolicies = []string{"reject", "quarantine", "none", "missing"}
+
+	// summaryTLSVersions are the TLS versions a summary counts domains by,
+	// oldest first, each with the advice that reports it.
+	summaryTLSVersions = []struct{ version, phrase string }{
+		{"1.0", "TLS version 1.0"},
+		{"1.1", "TLS version 1.1"},
+		{"1.2", "TLS version 1.2"},
+		{"1.3", "using TLS 1.3"},
+	}
+
+	// summaryPenalties are the points a finding of each severity costs a
+	// domain's score.
+	summaryPenalties = map[advisor.Severity]int{
+		advisor.SeverityCritical: 25,
+		advisor.SeverityHigh:     10,
+		advisor.SeverityMedium:   5,
+		advisor.SeverityLow:      1,
+	}
+)
+
+type (
+	// Summary rolls up the results of scanning a portfolio of domains, such as
+	// a bulk scan's, into counts of the domains at each DMARC policy level,
+	// without SPF, and at each lowest TLS version, along with the domains with
+	// the worst scores. Results are added one at a time, so a summary of any
+	// number of results only holds its counts and worst offenders.
+	Summary struct {
+		Domains        int             `json:"domains" yaml:"domains" doc:"The number of results summarized, excluding invalid domains." example:"1250"`
+		Invalid        int             `json:"invalid" yaml:"invalid" doc:"The number of results for invalid domains, which aren't counted otherwise." example:"3"`
+		Errors         int             `json:"errors" yaml:"errors" doc:"The number of domains whose scan had a lookup or check fail, which are still counted by their records that were found." example:"12"`
+		DMARCPolicies  map[string]int  `json:"dmarcPolicies" yaml:"dmarcPolicies" doc:"The number of domains at each DMARC policy level: reject, quarantine, none, or missing (including records without a valid policy)." example:"{\"reject\":410,\"quarantine\":220,\"none\":380,\"missing\":240}"`
+		MissingSPF     int             `json:"missingSpf" yaml:"missingSpf" doc:"The number of domains without an SPF record." example:"120"`
+		LowestTLS      map[string]int  `json:"lowestTls" yaml:"lowestTls" doc:"The number of domains by the lowest TLS version negotiated by their web and mail servers: 1.0, 1.1, 1.2, 1.3, or unchecked if TLS wasn't checked (or no server was reached)." example:"{\"1.0\":4,\"1.1\":9,\"1.2\":310,\"1.3\":700,\"unchecked\":227}"`
+		WorstOffenders []SummaryDomain `json:"worstOffenders" yaml:"worstOffenders" doc:"The domains with the lowest scores, worst first (ties are ordered by domain). Domains that weren't advised aren't scored."`
+
+		// Scanners is only set if the results say what produced them (results reshaped to schema version 1 don't).
+		Scanners []Provenance `json:"scanners,omitempty" yaml:"scanners,omitempty" doc:"Each distinct build and configuration of the scanner that produced the results summarized, in the order they were first seen, so a summary mixing them says so."`
+
+		// offenders is the number of worst offenders ranked.
+		offenders int
+	}
+
+	// SummaryDomain is a domain ranked by a summary, with its score.
+	SummaryDomain struct {
+		Domain   string         `json:"domain" yaml:"domain" doc:"The domain." example:"example.com"`
+		Score    int            `json:"score" yaml:"score" doc:"The domain's score out of 100, which loses 25 points for each critical finding, 10 for each high, 5 for each medium and 1 for each low, down to 0." example:"35"`
+		Findings map[string]int `json:"findings" yaml:"findings" doc:"The number of the domain's findings of each severity, excluding info." example:"{\"critical\":2,\"high\":1}"`
+	}
+)
+
+// NewSummary returns an empty summary, which ranks the given number of worst
+// offenders (or DefaultSummaryOffenders, if it isn't positive).
+func NewSummary(offenders int) *Summary {
+	if offenders <= 0 {
+		offenders = DefaultSummaryOffenders
+	}
+
+	summary := &Summary{
+		DMARCPolicies:  make(map[string]int, len(summaryPolicies)),
+		LowestTLS:      make(map[string]int, len(summaryTLSVersions)+1),
+		WorstOffenders: []SummaryDomain{},
+		offenders:      offenders,
+	}
+
+	// every level is listed, even if no domain is at it
+	for _, policy := range summaryPolicies {
+		summary.DMARCPolicies[policy] = 0
+	}
+
+	for _, version := range summaryTLSVersions {
+		summary.LowestTLS[version.version] = 0
+	}
+
+	summary.LowestTLS["unchecked"] = 0
+
+	return summary
+}
+
+// Summarize reads results as printed by dss scan in a JSON format (including
+// NDJSON, as streamed with -), returning their summary. Results are decoded
+// one at a time, so the input never has to fit in memory.
+func Summarize(r io.Reader, offenders int) (*Summary, error) {
+	summary := NewSummary(offenders)
+	decoder := json.NewDecoder(r)
+
+	for count := 1; ; count++ {
+		var result ScanResult
+		if err := decoder.Decode(&result); errors.Is(err, io.EOF) {
+			return summary, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse result %d: %w", count, err)
+		}
+
+		summary.Add(&result)
+	}
+}
+
+// Add counts a result in the summary. Results marked as deduplicated repeat an
+// earlier result of the same request, so they aren't counted again.
+func (s *Summary) Add(result *ScanResult) {
+	if result == nil || result.ScanResult == nil || result.Deduplicated {
+		return
+	}
+
+	if result.ScanResult.Error == scanner.ErrInvalidDomain {
+		s.Invalid++
+		return
+	}
+
+	s.Domains++
+
+	if result.Scanner != nil && !slices.Contains(s.Scanners, *result.Scanner) {
+		s.Scanners = append(s.Scanners, *result.Scanner)
+	}
+
+	if result.ScanResult.Error != "" || len(result.Errors) > 0 {
+		s.Errors++
+	}
+
+	s.DMARCPolicies[dmarcPolicy(result.ScanResult.DMARC)]++
+
+	if result.ScanResult.SPF == "" {
+		s.MissingSPF++
+	}
+
+	s.LowestTLS[lowestTLSVersion(result.Advice)]++
+
+	if result.Advice != nil {
+		s.rank(summaryDomain(result))
+	}
+}
+
+// Table returns the summary formatted as aligned tables.
+func (s *Summary) Table() string {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(writer, "Domains\t%d\n", s.Domains)
+	fmt.Fprintf(writer, "Invalid\t%d\n", s.Invalid)
+	fmt.Fprintf(writer, "With errors\t%d\n", s.Errors)
+	fmt.Fprintf(writer, "Missing SPF\t%d\n", s.MissingSPF)
+
+	fmt.Fprintf(writer, "\nDMARC policy\tDomains\n")
+	for _, policy := range summaryPolicies {
+		fmt.Fprintf(writer, "%s\t%d\n", policy, s.DMARCPolicies[policy])
+	}
+
+	fmt.Fprintf(writer, "\nLowest TLS\tDomains\n")
+	for _, version := range summaryTLSVersions {
+		fmt.Fprintf(writer, "%s\t%d\n", version.version, s.LowestTLS[version.version])
+	}
+	fmt.Fprintf(writer, "unchecked\t%d\n", s.LowestTLS["unchecked"])
+
+	if len(s.WorstOffenders) > 0 {
+		fmt.Fprintf(writer, "\nWorst offenders\tScore\tFindings\n")
+		for _, offender := range s.WorstOffenders {
+			fmt.Fprintf(writer, "%s\t%d\t%s\n", offender.Domain, offender.Score, findingCounts(offender.Findings))
+		}
+	}
+
+	if len(s.Scanners) > 0 {
+		fmt.Fprintf(writer, "\nScanner\n")
+		for _, provenance := range s.Scanners {
+			fmt.Fprintf(writer, "%s\n", provenance.String())
+		}
+	}
+
+	_ = writer.Flush()
+
+	return buffer.String()
+}
+
+// rank adds the domain to the worst offenders if it's among the lowest scores.
+func (s *Summary) rank(domain SummaryDomain) {
+	index := sort.Search(len(s.WorstOffenders), func(i int) bool {
+		offender := s.WorstOffenders[i]
+		return offender.Score > domain.Score || (offender.Score == domain.Score && offender.Domain > domain.Domain)
+	})
+
+	if index >= s.offenders {
+		return
+	}
+
+	s.WorstOffenders = append(s.WorstOffenders, SummaryDomain{})
+	copy(s.WorstOffenders[index+1:], s.WorstOffenders[index:])
+	s.WorstOffenders[index] = domain
+
+	if len(s.WorstOffenders) > s.offenders {
+		s.WorstOffenders = s.WorstOffenders[:s.offenders]
+	}
+}
+
+// summaryDomain scores an advised result by its findings.
+func summaryDomain(result *ScanResult) SummaryDomain {
+	domain := SummaryDomain{Domain: result.Domain, Score: 100, Findings: make(map[string]int)}
+	if domain.Domain == "" {
+		// results reshaped to schema version 1 only have the scanner's domain
+		domain.Domain = result.ScanResult.Domain
+	}
+
+	for _, finding := range result.Advice.Findings() {
+		if penalty, ok := summaryPenalties[finding.Severity]; ok {
+			domain.Score -= penalty
+			domain.Findings[finding.Severity.String()]++
+		}
+	}
+
+	domain.Score = max(domain.Score, 0)
+
+	return domain
+}
+
+// dmarcPolicy returns the policy level of a DMARC record, or "missing" if it
+// has no valid policy.
+func dmarcPolicy(record string) string {
+	policy := strings.ToLower(parseTags(record)["p"])
+
+	for _, level := range summaryPolicies {
+		if policy == level {
+			return policy
+		}
+	}
+
+	return "missing"
+}
+
+// lowestTLSVersion returns the oldest TLS version the domain's web or mail
+// servers negotiated, or "unchecked" if the advice reports none.
+func lowestTLSVersion(advice *advisor.Advice) string {
+	if advice == nil {
+		return "unchecked"
+	}
+
+	// the web server's advice is in the domain's, and the mail servers' in the MX advice
+	lines := append(append([]string(nil), advice.Domain...), advice.MX...)
+
+	for _, version := range summaryTLSVersions {
+		for _, line := range lines {
+			if strings.Contains(line, version.phrase) {
+				return version.version
+			}
+		}
+	}
+
+	return "unchecked"
+}
+
+// findingCounts formats the number of findings of each severity, most severe
+// first, such as "2 critical, 1 high".
+func findingCounts(counts map[string]int) string {
+	var parts []string
+
+	for _, severity := range []advisor.Severity{advisor.SeverityCritical, advisor.SeverityHigh, advisor.SeverityMedium, advisor.SeverityLow} {
+		if count := counts[severity.String()]; count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count, severity))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "none"
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary_Add(t *testing.T) {
+	summary := NewSummary(2)
+	provenance := Provenance{Version: "3.0.14", ConfigHash: "sha256:1", AdviceCatalog: "3f2a9c1b7d4e"}
+	reconfigured := Provenance{Version: "3.0.14", ConfigHash: "sha256:2", AdviceCatalog: "3f2a9c1b7d4e"}
+
+	summary.Add(&ScanResult{
+		Domain:     "secure.example",
+		Scanner:    &provenance,
+		ScanResult: &scanner.Result{Domain: "secure.example", DMARC: "v=DMARC1; p=reject", SPF: "v=spf1 -all"},
+		Advice:     &advisor.Advice{Domain: []string{"Your domain is using TLS 1.3, no further action needed!"}, MX: []string{"All of your mail servers are using TLS 1.3, no further action needed!"}},
+	})
+	summary.Add(&ScanResult{
+		Domain:     "legacy.example",
+		Scanner:    &provenance,
+		ScanResult: &scanner.Result{Domain: "legacy.example", DMARC: "v=DMARC1; P=Quarantine", SPF: "v=spf1 +all"},
+		Advice: &advisor.Advice{
+			MX:  []string{"mx1.legacy.example: Your domain is using TLS version 1.2, and should be upgraded to TLS 1.3.", "mx2.legacy.example: Your domain is using TLS version 1.0 which is outdated, and should be upgraded to TLS 1.3."},
+			SPF: []string{"Your SPF record contains the +all tag. It is strongly recommended that this be changed to either -all or ~all."},
+		},
+	})
+	summary.Add(&ScanResult{
+		Domain:     "open.example",
+		Scanner:    &reconfigured,
+		ScanResult: &scanner.Result{Domain: "open.example", Error: "spf:timeout"},
+		Advice:     &advisor.Advice{DMARC: []string{"You do not have DMARC setup!"}},
+	})
+
+	// not advised, so counted but not scored
+	summary.Add(&ScanResult{ScanResult: &scanner.Result{Domain: "plain.example", DMARC: "v=DMARC1; p=bogus", SPF: "v=spf1 -all"}})
+
+	// neither invalid domains nor repeats of an earlier result are counted
+	summary.Add(&ScanResult{ScanResult: &scanner.Result{Domain: "invalid", Error: scanner.ErrInvalidDomain}})
+	summary.Add(&ScanResult{Domain: "secure.example", ScanResult: &scanner.Result{Domain: "secure.example"}, Deduplicated: true})
+	summary.Add(nil)
+
+	require.Equal(t, 4, summary.Domains)
+	require.Equal(t, 1, summary.Invalid)
+	require.Equal(t, 1, summary.Errors)
+	require.Equal(t, 1, summary.MissingSPF)
+	require.Equal(t, map[string]int{"reject": 1, "quarantine": 1, "none": 0, "missing": 2}, summary.DMARCPolicies)
+	require.Equal(t, map[string]int{"1.0": 1, "1.1": 0, "1.2": 0, "1.3": 1, "unchecked": 2}, summary.LowestTLS)
+
+	// the +all tag and TLS 1.0 cost legacy.example more than open.example's missing DMARC record
+	require.Equal(t, []SummaryDomain{
+		{Domain: "legacy.example", Score: 64, Findings: map[string]int{"critical": 1, "high": 1, "low": 1}},
+		{Domain: "open.example", Score: 75, Findings: map[string]int{"critical": 1}},
+	}, summary.WorstOffenders)
+
+	// the results were produced by two configurations
+	require.Equal(t, []Provenance{provenance, reconfigured}, summary.Scanners)
+
+	table := summary.Table()
+	require.Contains(t, table, "Domains      4\n")
+	require.Contains(t, table, "missing       2\n")
+	require.Contains(t, table, "legacy.example   64     1 critical, 1 high, 1 low\n")
+	require.Contains(t, table, "\nScanner\n3.0.14, config sha256:1, catalog 3f2a9c1b7d4e\n3.0.14, config sha256:2, catalog 3f2a9c1b7d4e\n")
+}
+
+func TestSummarize(t *testing.T) {
+	const domains = 20000
+
+	reader, writer := io.Pipe()
+
+	// the counts are tallied as the results are generated, to check the summary's
+	var (
+		expectedPolicies = map[string]int{"reject": 0, "quarantine": 0, "none": 0, "missing": 0}
+		expectedTLS      = map[string]int{"1.0": 0, "1.1": 0, "1.2": 0, "1.3": 0, "unchecked": 0}
+		missingSPF       int
+	)
+
+	policies := []string{"v=DMARC1; p=reject", "v=DMARC1; p=quarantine", "v=DMARC1; p=none", ""}
+	tlsAdvice := []string{"Your domain is using TLS 1.3, no further action needed!", "Your domain is using TLS version 1.2, and should be upgraded to TLS 1.3.", ""}
+
+	// the results are streamed as NDJSON as they're summarized, as a bulk scan's would be
+	go func() {
+		encoder := json.NewEncoder(writer)
+
+		for i := 0; i < domains; i++ {
+			result := ScanResult{
+				SchemaVersion: SchemaVersion,
+				Domain:        fmt.Sprintf("domain%05d.example", i),
+				ScanResult:    &scanner.Result{Domain: fmt.Sprintf("domain%05d.example", i), DMARC: policies[i%len(policies)]},
+				Advice:        &advisor.Advice{},
+			}
+
+			if i%5 != 0 {
+				result.ScanResult.SPF = "v=spf1 -all"
+			}
+
+			if advice := tlsAdvice[i%len(tlsAdvice)]; advice != "" {
+				result.Advice.Domain = []string{advice}
+			}
+
+			if result.ScanResult.DMARC == "" {
+				result.Advice.DMARC = []string{"You do not have DMARC setup!"}
+			}
+
+			if i%1000 == 999 {
+				result.ScanResult.Error = scanner.ErrInvalidDomain
+			}
+
+			if result.ScanResult.Error == "" {
+				expectedPolicies[[]string{"reject", "quarantine", "none", "missing"}[i%len(policies)]]++
+				expectedTLS[[]string{"1.3", "1.2", "unchecked"}[i%len(tlsAdvice)]]++
+
+				if result.ScanResult.SPF == "" {
+					missingSPF++
+				}
+			}
+
+			if err := encoder.Encode(result); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+
+		writer.Close()
+	}()
+
+	summary, err := Summarize(reader, 3)
+	require.NoError(t, err)
+
+	require.Equal(t, domains-domains/1000, summary.Domains)
+	require.Equal(t, domains/1000, summary.Invalid)
+	require.Zero(t, summary.Errors)
+	require.Equal(t, missingSPF, summary.MissingSPF)
+	require.Equal(t, expectedPolicies, summary.DMARCPolicies)
+	require.Equal(t, expectedTLS, summary.LowestTLS)
+
+	// the domains without DMARC that use TLS 1.2 score worst, ranked by domain
+	require.Equal(t, []SummaryDomain{
+		{Domain: "domain00007.example", Score: 74, Findings: map[string]int{"critical": 1, "low": 1}},
+		{Domain: "domain00019.example", Score: 74, Findings: map[string]int{"critical": 1, "low": 1}},
+		{Domain: "domain00031.example", Score: 74, Findings: map[string]int{"critical": 1, "low": 1}},
+	}, summary.WorstOffenders)
+
+	_, err = Summarize(strings.NewReader(`{"domain":"example.com"}`+"\n"+`{"domain":`), 0)
+	require.ErrorContains(t, err, "failed to parse result 2")
+}
@@ -0,0 +1,49 @@
+//go:build integration
+
+package objectstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestIntegration uploads to the buckets named by DSS_TEST_S3_URL and
+// DSS_TEST_GCS_URL, such as LocalStack's (with AWS_ENDPOINT_URL set to
+// http://localhost:4566) and fake-gcs-server's (with STORAGE_EMULATOR_HOST set
+// to localhost:4443). Run it with:
+//
+//	go test -tags integration ./pkg/objectstore
+func TestIntegration(t *testing.T) {
+	for _, variable := range []string{"DSS_TEST_S3_URL", "DSS_TEST_GCS_URL"} {
+		t.Run(variable, func(t *testing.T) {
+			url := os.Getenv(variable)
+			if url == "" {
+				t.Skip(variable + " isn't set")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			bucket, prefix, err := Open(ctx, url, Encryption{Mode: os.Getenv("DSS_TEST_ENCRYPTION")})
+			require.NoError(t, err)
+
+			prefix += strconv.FormatInt(time.Now().UnixNano(), 10) + "/"
+			writer := NewWriter(bucket, prefix, WithPartSize(1), WithRetries(2, 0), WithFallback(filepath.Join(t.TempDir(), "results.ndjson")))
+
+			for index := range 3 {
+				require.NoError(t, writer.Write(ctx, record(index), false))
+			}
+
+			manifest, err := writer.Close(ctx)
+			require.NoError(t, err)
+			require.Empty(t, writer.Fallback(), "the uploads failed, and fell back to the local file")
+			require.Len(t, manifest.Parts, 3)
+		})
+	}
+}
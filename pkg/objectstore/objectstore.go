@@ -0,0 +1,154 @@
+// Package objectstore writes scan results to S3 or GCS buckets as NDJSON
+// parts, with a manifest of the parts once they're all written, so bulk runs
+// in short-lived containers don't lose their results with the container.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The server-side encryption modes of S3 buckets (see Encryption). GCS
+// buckets are always encrypted at rest, and only take a KMS key.
+const (
+	EncryptionAES256 = "AES256"
+	EncryptionKMS    = "aws:kms"
+)
+
+var (
+	// ErrUnsupportedURL is returned for a URL that isn't an s3:// or gs://
+	// URL with a bucket.
+	ErrUnsupportedURL = errors.New("unsupported object storage URL")
+
+	// ErrUnknownEncryption is returned for an S3 encryption mode other than
+	// EncryptionAES256 or EncryptionKMS.
+	ErrUnknownEncryption = errors.New("unknown server-side encryption mode")
+)
+
+type (
+	// Bucket stores objects by key. Put replaces any object already stored
+	// at the key.
+	Bucket interface {
+		Put(ctx context.Context, key string, data []byte, contentType string) error
+	}
+
+	// Encryption is the server-side encryption objects are stored with.
+	// S3 objects are encrypted in Mode (EncryptionAES256 or EncryptionKMS),
+	// with KMSKey as the key's ID or ARN under EncryptionKMS (the bucket's
+	// default key if it's empty). GCS objects are encrypted with KMSKey as
+	// the Cloud KMS key's resource name, or the bucket's default encryption
+	// if it's empty, and Mode is ignored.
+	Encryption struct {
+		Mode   string
+		KMSKey string
+	}
+
+	// Memory is a bucket held in memory, for tests and for callers that
+	// collect the objects themselves. It's safe for concurrent use.
+	Memory struct {
+		mutex   sync.Mutex
+		objects map[string][]byte
+	}
+)
+
+// IsURL returns true if the destination is an object storage URL, rather
+// than a local path.
+func IsURL(destination string) bool {
+	return strings.HasPrefix(destination, "s3://") || strings.HasPrefix(destination, "gs://")
+}
+
+// ParseURL returns the scheme (s3 or gs), bucket and key prefix of an object
+// storage URL such as s3://bucket/prefix/. The prefix always ends with a
+// slash, unless it's empty, so each run's objects are kept under it.
+func ParseURL(rawURL string) (scheme, bucket, prefix string, err error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", "", fmt.Errorf("%w: %w", ErrUnsupportedURL, err)
+	}
+
+	if (parsed.Scheme != "s3" && parsed.Scheme != "gs") || parsed.Host == "" {
+		return "", "", "", fmt.Errorf("%w: %q, expected s3://bucket/prefix/ or gs://bucket/prefix/", ErrUnsupportedURL, rawURL)
+	}
+
+	prefix = strings.TrimPrefix(parsed.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return parsed.Scheme, parsed.Host, prefix, nil
+}
+
+// Open returns the bucket of an object storage URL, and its key prefix.
+// Credentials are found by each provider's standard chain: the AWS SDK's
+// (environment, shared config and credentials files, then the container or
+// instance role) for S3, and Application Default Credentials for GCS.
+func Open(ctx context.Context, rawURL string, encryption Encryption) (Bucket, string, error) {
+	scheme, bucket, prefix, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var store Bucket
+
+	switch scheme {
+	case "s3":
+		store, err = NewS3(ctx, bucket, encryption)
+	case "gs":
+		store, err = NewGCS(ctx, bucket, encryption)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return store, prefix, nil
+}
+
+// NewMemory returns an empty in-memory bucket.
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string][]byte)}
+}
+
+// Put stores a copy of the data at the key.
+func (m *Memory) Put(ctx context.Context, key string, data []byte, _ string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.objects[key] = append([]byte(nil), data...)
+
+	return nil
+}
+
+// Get returns the object stored at the key, if there is one.
+func (m *Memory) Get(key string) ([]byte, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, ok := m.objects[key]
+
+	return data, ok
+}
+
+// Keys returns the keys of the stored objects, in order.
+func (m *Memory) Keys() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
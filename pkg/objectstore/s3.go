@@ -0,0 +1,77 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 is an S3 bucket, or a bucket of an S3-compatible service.
+type S3 struct {
+	bucket     string
+	client     *s3.Client
+	encryption Encryption
+}
+
+// NewS3 returns the S3 bucket, with its region and credentials loaded by the
+// AWS SDK's default chain. If AWS_ENDPOINT_URL is set, the bucket is
+// addressed by path at that endpoint instead, as S3-compatible services (such
+// as LocalStack or MinIO) expect.
+func NewS3(ctx context.Context, bucket string, encryption Encryption) (*S3, error) {
+	if encryption.Mode == "" && encryption.KMSKey != "" {
+		encryption.Mode = EncryptionKMS
+	}
+
+	if encryption.Mode != "" && encryption.Mode != EncryptionAES256 && encryption.Mode != EncryptionKMS {
+		return nil, fmt.Errorf("%w: %q, expected %s or %s", ErrUnknownEncryption, encryption.Mode, EncryptionAES256, EncryptionKMS)
+	}
+
+	if encryption.Mode == EncryptionAES256 && encryption.KMSKey != "" {
+		return nil, fmt.Errorf("a KMS key requires the %s encryption mode", EncryptionKMS)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(options *s3.Options) {
+		if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+			options.BaseEndpoint = aws.String(endpoint)
+			options.UsePathStyle = true
+		}
+	})
+
+	return &S3{bucket: bucket, client: client, encryption: encryption}, nil
+}
+
+// Put uploads the object, with its SHA-256 checksum verified by S3.
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		Body:              bytes.NewReader(data),
+		ContentType:       aws.String(contentType),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+	}
+
+	if s.encryption.Mode != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(s.encryption.Mode)
+	}
+
+	if s.encryption.KMSKey != "" {
+		input.SSEKMSKeyId = aws.String(s.encryption.KMSKey)
+	}
+
+	if _, err := s.client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("uploading s3://%s/%s: %w", s.bucket, key, err)
+	}
+
+	return nil
+}
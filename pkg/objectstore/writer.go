@@ -0,0 +1,389 @@
+package objectstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	// DefaultPartSize is how many bytes of results a part holds before it's
+	// uploaded, by default.
+	DefaultPartSize = 8 << 20
+
+	// DefaultPartInterval is how long a part is held for at most before it's
+	// uploaded, by default, so a slow run's results reach the bucket even if
+	// its parts are rarely filled.
+	DefaultPartInterval = time.Minute
+
+	// DefaultAttempts is how many times each upload is attempted, by default.
+	DefaultAttempts = 3
+
+	// DefaultBackoff is how long the first retry of an upload waits, by
+	// default. Each later retry waits twice as long as the one before.
+	DefaultBackoff = time.Second
+
+	// DefaultUploadTimeout is how long each upload attempt is allowed, by
+	// default.
+	DefaultUploadTimeout = time.Minute
+
+	// ManifestName is the name of the manifest under the writer's prefix.
+	ManifestName = "manifest.json"
+
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeJSON   = "application/json"
+)
+
+// ErrClosed is returned when writing to a writer that has been closed.
+var ErrClosed = errors.New("object storage writer is closed")
+
+type (
+	// WriterOption configures a Writer.
+	WriterOption func(*Writer)
+
+	// Part is a part of the results, with the SHA-256 checksum of its
+	// content. Its key is the object's, or the local file's path for a
+	// manifest's Fallback.
+	Part struct {
+		Key     string `json:"key"`
+		Records int    `json:"records"`
+		Bytes   int64  `json:"bytes"`
+		SHA256  string `json:"sha256"`
+	}
+
+	// Manifest lists the parts of a run's results, and counts them. It's
+	// written once every part has been, so its presence marks the run as
+	// complete. Fallback is the local file holding every result after the
+	// uploaded parts, if an upload failed.
+	Manifest struct {
+		StartedAt   time.Time `json:"startedAt"`
+		CompletedAt time.Time `json:"completedAt"`
+		Records     int       `json:"records"`
+		Failed      int       `json:"failed"`
+		Bytes       int64     `json:"bytes"`
+		Parts       []Part    `json:"parts"`
+		Fallback    *Part     `json:"fallback,omitempty"`
+	}
+
+	// Writer writes results to a bucket as NDJSON parts under its prefix,
+	// uploading each once it's full (or has been held for the part
+	// interval), and the manifest once it's closed. A failed upload is
+	// retried, and once it's failed every attempt, that part and every later
+	// result is written to a local fallback file instead, so the results
+	// aren't lost. It isn't safe for concurrent use.
+	Writer struct {
+		bucket       Bucket
+		prefix       string
+		attempts     int
+		backoff      time.Duration
+		fallbackPath string
+		partInterval time.Duration
+		partSize     int
+		timeout      time.Duration
+
+		buffer      bytes.Buffer
+		partRecords int
+		partStarted time.Time
+		manifest    Manifest
+		closed      bool
+
+		// the fallback file, once an upload has failed
+		fallback     *os.File
+		fallbackBuf  *bufio.Writer
+		fallbackHash hash.Hash
+	}
+)
+
+// WithFallback sets the path of the local file results are written to once an
+// upload fails. It defaults to the current unix timestamp with an .ndjson
+// extension, in the working directory. The manifest is written alongside it,
+// with a .manifest.json extension in place of .ndjson.
+func WithFallback(path string) WriterOption {
+	return func(w *Writer) {
+		if path != "" {
+			w.fallbackPath = path
+		}
+	}
+}
+
+// WithPartSize sets how many bytes of results a part holds before it's
+// uploaded. The default is DefaultPartSize.
+func WithPartSize(size int) WriterOption {
+	return func(w *Writer) {
+		if size > 0 {
+			w.partSize = size
+		}
+	}
+}
+
+// WithPartInterval sets how long a part is held for at most before it's
+// uploaded. The default is DefaultPartInterval, and 0 only uploads parts once
+// they're full.
+func WithPartInterval(interval time.Duration) WriterOption {
+	return func(w *Writer) {
+		if interval >= 0 {
+			w.partInterval = interval
+		}
+	}
+}
+
+// WithRetries sets how many times each upload is attempted, and how long the
+// first retry waits. The defaults are DefaultAttempts and DefaultBackoff.
+func WithRetries(attempts int, backoff time.Duration) WriterOption {
+	return func(w *Writer) {
+		if attempts > 0 {
+			w.attempts = attempts
+		}
+
+		if backoff >= 0 {
+			w.backoff = backoff
+		}
+	}
+}
+
+// WithUploadTimeout sets how long each upload attempt is allowed. The default
+// is DefaultUploadTimeout.
+func WithUploadTimeout(timeout time.Duration) WriterOption {
+	return func(w *Writer) {
+		if timeout > 0 {
+			w.timeout = timeout
+		}
+	}
+}
+
+// NewWriter returns a writer of results to the bucket, under the prefix.
+func NewWriter(bucket Bucket, prefix string, opts ...WriterOption) *Writer {
+	w := &Writer{
+		bucket:       bucket,
+		prefix:       prefix,
+		attempts:     DefaultAttempts,
+		backoff:      DefaultBackoff,
+		fallbackPath: strconv.FormatInt(time.Now().Unix(), 10) + ".ndjson",
+		partInterval: DefaultPartInterval,
+		partSize:     DefaultPartSize,
+		timeout:      DefaultUploadTimeout,
+		manifest:     Manifest{StartedAt: time.Now(), Parts: []Part{}},
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Write writes a result, as a line of JSON, noting whether its scan failed
+// for the manifest. It only returns an error if the result couldn't be
+// written to the bucket or the fallback file.
+func (w *Writer) Write(ctx context.Context, record []byte, failed bool) error {
+	if w.closed {
+		return ErrClosed
+	}
+
+	line := record
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(append(make([]byte, 0, len(record)+1), record...), '\n')
+	}
+
+	w.manifest.Records++
+	w.manifest.Bytes += int64(len(line))
+
+	if failed {
+		w.manifest.Failed++
+	}
+
+	if w.fallback != nil {
+		return w.writeFallback(line, 1)
+	}
+
+	now := time.Now()
+	if w.partRecords == 0 {
+		w.partStarted = now
+	}
+
+	w.buffer.Write(line)
+	w.partRecords++
+
+	if w.buffer.Len() >= w.partSize || (w.partInterval > 0 && now.Sub(w.partStarted) >= w.partInterval) {
+		return w.flushPart(ctx)
+	}
+
+	return nil
+}
+
+// Close uploads the last part and the manifest, or writes them to the
+// fallback file if an upload failed. It returns the manifest.
+func (w *Writer) Close(ctx context.Context) (Manifest, error) {
+	if w.closed {
+		return w.manifest, ErrClosed
+	}
+
+	if err := w.flushPart(ctx); err != nil {
+		return w.manifest, err
+	}
+
+	w.closed = true
+	w.manifest.CompletedAt = time.Now()
+
+	if w.fallback == nil {
+		manifest, err := json.MarshalIndent(w.manifest, "", "  ")
+		if err != nil {
+			return w.manifest, err
+		}
+
+		if err = w.upload(ctx, w.prefix+ManifestName, manifest, contentTypeJSON); err == nil {
+			return w.manifest, nil
+		}
+
+		// the parts are all uploaded, so only the manifest has to fall back
+		if err = w.openFallback(); err != nil {
+			return w.manifest, err
+		}
+	}
+
+	return w.manifest, w.closeFallback()
+}
+
+// Fallback returns the path of the local file results were written to, or an
+// empty string if every upload succeeded.
+func (w *Writer) Fallback() string {
+	if w.fallback == nil {
+		return ""
+	}
+
+	return w.fallbackPath
+}
+
+// flushPart uploads the buffered results as the next part, falling back to
+// the local file if the upload fails.
+func (w *Writer) flushPart(ctx context.Context) error {
+	if w.partRecords == 0 {
+		return nil
+	}
+
+	data := w.buffer.Bytes()
+	records := w.partRecords
+
+	defer func() {
+		w.buffer.Reset()
+		w.partRecords = 0
+	}()
+
+	if w.fallback != nil {
+		return w.writeFallback(data, records)
+	}
+
+	checksum := sha256.Sum256(data)
+	key := fmt.Sprintf("%spart-%05d.ndjson", w.prefix, len(w.manifest.Parts)+1)
+
+	if err := w.upload(ctx, key, data, contentTypeNDJSON); err != nil {
+		if err = w.openFallback(); err != nil {
+			return err
+		}
+
+		return w.writeFallback(data, records)
+	}
+
+	w.manifest.Parts = append(w.manifest.Parts, Part{Key: key, Records: records, Bytes: int64(len(data)), SHA256: hex.EncodeToString(checksum[:])})
+
+	return nil
+}
+
+// upload puts the object, retrying with a backoff that doubles after each
+// attempt until it succeeds or every attempt has failed.
+func (w *Writer) upload(ctx context.Context, key string, data []byte, contentType string) error {
+	backoff := w.backoff
+
+	var err error
+
+	for attempt := 1; attempt <= w.attempts; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, w.timeout)
+		err = w.bucket.Put(attemptCtx, key, data, contentType)
+		cancel()
+
+		if err == nil || ctx.Err() != nil || attempt == w.attempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+
+		backoff *= 2
+	}
+
+	return err
+}
+
+func (w *Writer) openFallback() error {
+	file, err := os.OpenFile(w.fallbackPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening fallback file: %w", err)
+	}
+
+	w.fallback, w.fallbackBuf, w.fallbackHash = file, bufio.NewWriter(file), sha256.New()
+	w.manifest.Fallback = &Part{Key: w.fallbackPath}
+
+	return nil
+}
+
+func (w *Writer) writeFallback(data []byte, records int) error {
+	if _, err := w.fallbackBuf.Write(data); err != nil {
+		return fmt.Errorf("writing fallback file: %w", err)
+	}
+
+	// flush each write, so the results survive the process
+	if err := w.fallbackBuf.Flush(); err != nil {
+		return fmt.Errorf("writing fallback file: %w", err)
+	}
+
+	w.fallbackHash.Write(data)
+	w.manifest.Fallback.Records += records
+	w.manifest.Fallback.Bytes += int64(len(data))
+
+	return nil
+}
+
+// closeFallback closes the fallback file, and writes the manifest alongside
+// it.
+func (w *Writer) closeFallback() error {
+	w.manifest.Fallback.SHA256 = hex.EncodeToString(w.fallbackHash.Sum(nil))
+
+	if err := w.fallback.Close(); err != nil {
+		return fmt.Errorf("closing fallback file: %w", err)
+	}
+
+	manifest, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(manifestPath(w.fallbackPath), manifest, 0o644); err != nil {
+		return fmt.Errorf("writing fallback manifest: %w", err)
+	}
+
+	return nil
+}
+
+// manifestPath returns the path of the manifest written alongside the
+// fallback file.
+func manifestPath(fallbackPath string) string {
+	if base, ok := strings.CutSuffix(fallbackPath, ".ndjson"); ok {
+		return base + ".manifest.json"
+	}
+
+	return fallbackPath + ".manifest.json"
+}
@@ -0,0 +1,216 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyBucket fails the uploads it's told to, before passing the rest on to
+// its bucket.
+type flakyBucket struct {
+	*Memory
+
+	mutex    sync.Mutex
+	attempts map[string]int
+	failures func(key string, attempt int) bool
+}
+
+func (b *flakyBucket) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	b.mutex.Lock()
+	b.attempts[key]++
+	attempt := b.attempts[key]
+	b.mutex.Unlock()
+
+	if b.failures(key, attempt) {
+		return errors.New("503 Slow Down")
+	}
+
+	return b.Memory.Put(ctx, key, data, contentType)
+}
+
+func newFlakyBucket(failures func(key string, attempt int) bool) *flakyBucket {
+	return &flakyBucket{Memory: NewMemory(), attempts: make(map[string]int), failures: failures}
+}
+
+func record(index int) []byte {
+	return []byte(fmt.Sprintf(`{"domain":"domain-%d.example"}`, index))
+}
+
+func readManifest(t *testing.T, data []byte) Manifest {
+	t.Helper()
+
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+
+	return manifest
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		scheme string
+		bucket string
+		prefix string
+	}{
+		{"s3://results/runs/nightly/", "s3", "results", "runs/nightly/"},
+		{"s3://results/runs/nightly", "s3", "results", "runs/nightly/"},
+		{"gs://results", "gs", "results", ""},
+		{"gs://results/", "gs", "results", ""},
+	}
+
+	for _, test := range tests {
+		scheme, bucket, prefix, err := ParseURL(test.url)
+		require.NoError(t, err, test.url)
+		require.Equal(t, []string{test.scheme, test.bucket, test.prefix}, []string{scheme, bucket, prefix}, test.url)
+	}
+
+	for _, url := range []string{"results.ndjson", "https://example.com/results", "s3:///prefix/"} {
+		_, _, _, err := ParseURL(url)
+		require.ErrorIs(t, err, ErrUnsupportedURL, url)
+	}
+
+	require.True(t, IsURL("gs://results/"))
+	require.False(t, IsURL("results"))
+}
+
+func TestNewS3_Encryption(t *testing.T) {
+	_, err := NewS3(context.Background(), "results", Encryption{Mode: "aws:kms:dsse"})
+	require.ErrorIs(t, err, ErrUnknownEncryption)
+
+	_, err = NewS3(context.Background(), "results", Encryption{Mode: EncryptionAES256, KMSKey: "alias/results"})
+	require.Error(t, err)
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("Parts", func(t *testing.T) {
+		bucket := NewMemory()
+		writer := NewWriter(bucket, "runs/nightly/", WithPartSize(100), WithPartInterval(0))
+
+		for index := range 10 {
+			require.NoError(t, writer.Write(context.Background(), record(index), index == 3))
+		}
+
+		manifest, err := writer.Close(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, writer.Fallback())
+
+		// each part is uploaded once it holds 100 bytes (4 results), and the last once the writer is closed
+		require.Equal(t, []string{
+			"runs/nightly/manifest.json",
+			"runs/nightly/part-00001.ndjson",
+			"runs/nightly/part-00002.ndjson",
+			"runs/nightly/part-00003.ndjson",
+		}, bucket.Keys())
+		require.Equal(t, 2, manifest.Parts[2].Records)
+
+		var results bytes.Buffer
+
+		for _, part := range manifest.Parts {
+			data, ok := bucket.Get(part.Key)
+			require.True(t, ok)
+
+			checksum := sha256.Sum256(data)
+			require.Equal(t, hex.EncodeToString(checksum[:]), part.SHA256)
+			require.EqualValues(t, len(data), part.Bytes)
+			require.Equal(t, part.Records, bytes.Count(data, []byte("\n")))
+
+			results.Write(data)
+		}
+
+		require.Equal(t, 10, manifest.Records)
+		require.Equal(t, 1, manifest.Failed)
+		require.EqualValues(t, results.Len(), manifest.Bytes)
+		require.Contains(t, results.String(), string(record(9))+"\n")
+
+		uploaded, ok := bucket.Get("runs/nightly/manifest.json")
+		require.True(t, ok)
+		require.Equal(t, manifest.Parts, readManifest(t, uploaded).Parts)
+
+		require.ErrorIs(t, writer.Write(context.Background(), record(10), false), ErrClosed)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		bucket := NewMemory()
+
+		manifest, err := NewWriter(bucket, "").Close(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, manifest.Parts)
+		require.Equal(t, []string{"manifest.json"}, bucket.Keys())
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		// every upload fails twice, then succeeds on its last attempt
+		bucket := newFlakyBucket(func(_ string, attempt int) bool { return attempt < DefaultAttempts })
+		writer := NewWriter(bucket, "runs/", WithRetries(DefaultAttempts, 0), WithFallback(filepath.Join(t.TempDir(), "results.ndjson")))
+
+		require.NoError(t, writer.Write(context.Background(), record(0), false))
+
+		manifest, err := writer.Close(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, writer.Fallback())
+		require.Len(t, manifest.Parts, 1)
+		require.Equal(t, DefaultAttempts, bucket.attempts["runs/part-00001.ndjson"])
+		require.Equal(t, DefaultAttempts, bucket.attempts["runs/manifest.json"])
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		// the first part is uploaded, then the bucket becomes unavailable
+		bucket := newFlakyBucket(func(key string, _ int) bool { return key != "runs/part-00001.ndjson" })
+		fallback := filepath.Join(t.TempDir(), "results.ndjson")
+		writer := NewWriter(bucket, "runs/", WithPartSize(1), WithRetries(2, 0), WithFallback(fallback))
+
+		for index := range 4 {
+			require.NoError(t, writer.Write(context.Background(), record(index), false))
+		}
+
+		require.Equal(t, fallback, writer.Fallback())
+
+		manifest, err := writer.Close(context.Background())
+		require.NoError(t, err)
+		require.Len(t, manifest.Parts, 1)
+		require.Equal(t, 2, bucket.attempts["runs/part-00002.ndjson"])
+
+		// later results aren't uploaded once the writer has fallen back
+		require.Zero(t, bucket.attempts["runs/part-00003.ndjson"])
+		require.Zero(t, bucket.attempts["runs/manifest.json"])
+
+		data, err := os.ReadFile(fallback)
+		require.NoError(t, err)
+		require.Equal(t, string(record(1))+"\n"+string(record(2))+"\n"+string(record(3))+"\n", string(data))
+
+		checksum := sha256.Sum256(data)
+		require.Equal(t, &Part{Key: fallback, Records: 3, Bytes: int64(len(data)), SHA256: hex.EncodeToString(checksum[:])}, manifest.Fallback)
+
+		local, err := os.ReadFile(filepath.Join(filepath.Dir(fallback), "results.manifest.json"))
+		require.NoError(t, err)
+		require.Equal(t, manifest.Fallback, readManifest(t, local).Fallback)
+	})
+
+	t.Run("ManifestFallback", func(t *testing.T) {
+		bucket := newFlakyBucket(func(key string, _ int) bool { return key == "manifest.json" })
+		fallback := filepath.Join(t.TempDir(), "results.ndjson")
+		writer := NewWriter(bucket, "", WithRetries(1, 0), WithFallback(fallback))
+
+		require.NoError(t, writer.Write(context.Background(), record(0), false))
+
+		manifest, err := writer.Close(context.Background())
+		require.NoError(t, err)
+		require.Len(t, manifest.Parts, 1)
+		require.Zero(t, manifest.Fallback.Records)
+
+		local, err := os.ReadFile(filepath.Join(filepath.Dir(fallback), "results.manifest.json"))
+		require.NoError(t, err)
+		require.Equal(t, manifest.Parts, readManifest(t, local).Parts)
+	})
+}
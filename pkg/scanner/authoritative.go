@@ -0,0 +1,228 @@
+package scanner
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+type (
+	// AuthoritativeAnswer is the answer to one of a domain's lookups from one
+	// of its zone's authoritative nameservers, bypassing any recursive
+	// resolver's cache, compared with the recursive resolver's answer.
+	AuthoritativeAnswer struct {
+		Lookup    string   `json:"lookup" yaml:"lookup" doc:"The lookup the name was queried for." example:"dmarc"`
+		Name      string   `json:"name" yaml:"name" doc:"The name that was queried." example:"_dmarc.example.com"`
+		Type      string   `json:"type" yaml:"type" doc:"The record type that was queried." example:"TXT"`
+		Server    string   `json:"server" yaml:"server" doc:"The authoritative nameserver that answered." example:"ns1.example.com"`
+		TTL       uint32   `json:"ttl" yaml:"ttl" doc:"How long resolvers may cache the authoritative answer, in seconds: its records' TTL, or the negative caching TTL if it has none." example:"3600"`
+		Records   []string `json:"records,omitempty" yaml:"records,omitempty" doc:"The authoritative answer's records at the name, sorted." example:"v=DMARC1; p=reject"`
+		Recursive []string `json:"recursive,omitempty" yaml:"recursive,omitempty" doc:"The recursive resolver's records at the name, sorted, only if they differ from the authoritative answer's." example:"v=DMARC1; p=none"`
+		Mismatch  bool     `json:"mismatch,omitempty" yaml:"mismatch,omitempty" doc:"Whether the recursive resolver's answer differs from the authoritative answer, as when a change is still propagating, or with split-horizon DNS."`
+	}
+
+	// authoritativeQuestion is a lookup's question asked of an authoritative nameserver.
+	authoritativeQuestion struct {
+		lookup, name string
+		recordType   uint16
+	}
+)
+
+// WithAuthoritative enables querying one of each domain's authoritative
+// nameservers directly for its TXT, MX, DMARC and DKIM records, recording
+// which server answered and its TTL, and whether the recursive resolver's
+// answer differs. It's disabled by default, as it doubles the queries for
+// those records, and needs the nameservers to be reachable.
+func WithAuthoritative() Option {
+	return func(s *Scanner) error {
+		s.authoritative = true
+		return nil
+	}
+}
+
+// getAuthoritativeAnswers queries the domain's TXT and MX records, its DMARC
+// record, and the DKIM key at its selector (if one was found) from the zone's
+// authoritative nameservers, comparing each with the recursive resolver's
+// answer. Each question is answered by the first nameserver (by name) that
+// gives an authoritative answer.
+func (s *Scanner) getAuthoritativeAnswers(trace *lookupTrace, domain, dkimSelector string) ([]AuthoritativeAnswer, error) {
+	servers, err := s.getZoneNameservers(trace, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	questions := []authoritativeQuestion{
+		{"txt", domain, dns.TypeTXT},
+		{"mx", domain, dns.TypeMX},
+		{"dmarc", "_dmarc." + domain, dns.TypeTXT},
+	}
+
+	if dkimSelector != "" {
+		questions = append(questions, authoritativeQuestion{"dkim", dkimSelector + "._domainkey." + domain, dns.TypeTXT})
+	}
+
+	addresses := make(map[string]string, len(servers))
+	answers := make([]AuthoritativeAnswer, 0, len(questions))
+
+	for _, question := range questions {
+		recursive, err := s.getDNSAnswers(trace, question.name, question.recordType)
+		if err != nil {
+			return nil, err
+		}
+
+		answer, err := s.getAuthoritativeAnswer(trace, servers, addresses, question.name, question.recordType)
+		if err != nil {
+			return nil, err
+		}
+
+		answer.Lookup = question.lookup
+
+		if values, _ := answerValues(recursive, question.name); !slices.Equal(values, answer.Records) {
+			answer.Recursive, answer.Mismatch = values, true
+		}
+
+		answers = append(answers, answer)
+	}
+
+	return answers, nil
+}
+
+// getAuthoritativeAnswer asks each of the nameservers in turn for the records
+// at the name, until one answers authoritatively. The nameservers' addresses
+// are resolved once, as they're needed.
+func (s *Scanner) getAuthoritativeAnswer(trace *lookupTrace, servers []string, addresses map[string]string, name string, recordType uint16) (AuthoritativeAnswer, error) {
+	var lastErr error
+
+	for _, server := range servers {
+		address, ok := addresses[server]
+		if !ok {
+			address, lastErr = s.getNameserverAddress(trace, server)
+			if lastErr != nil {
+				continue
+			}
+
+			addresses[server] = address
+		}
+
+		in, err := s.query(trace, address, name, recordType, false)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to query %v: %w", server, err)
+			continue
+		}
+
+		// lame delegations, and servers that answer from a cache, aren't authoritative
+		if !in.Authoritative || (in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError) {
+			lastErr = fmt.Errorf("%v didn't answer authoritatively for %v (rcode %v)", server, name, in.Rcode)
+			continue
+		}
+
+		if err = s.checkAnswerLimits(trace, name, in.Answer); err != nil {
+			return AuthoritativeAnswer{}, err
+		}
+
+		answer := AuthoritativeAnswer{Name: name, Type: dns.TypeToString[recordType], Server: server}
+		answer.Records, answer.TTL = answerValues(in.Answer, name)
+
+		if len(answer.Records) == 0 {
+			answer.TTL = negativeTTL(in.Ns)
+		}
+
+		return answer, nil
+	}
+
+	return AuthoritativeAnswer{}, fmt.Errorf("no authoritative answer for %v: %w", name, lastErr)
+}
+
+// getZoneNameservers returns the hostnames of the nameservers of the zone the
+// domain is in, sorted, from the domain's own NS records or those of its
+// closest parent (excluding the TLD).
+func (s *Scanner) getZoneNameservers(trace *lookupTrace, domain string) ([]string, error) {
+	for name := strings.TrimSuffix(domain, "."); strings.Contains(name, "."); _, name, _ = strings.Cut(name, ".") {
+		records, err := s.getDNSRecords(trace, name, dns.TypeNS)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(records) > 0 {
+			servers := make([]string, 0, len(records))
+			for _, record := range records {
+				servers = append(servers, strings.ToLower(strings.TrimSuffix(record, ".")))
+			}
+
+			sort.Strings(servers)
+
+			return slices.Compact(servers), nil
+		}
+	}
+
+	return nil, fmt.Errorf("no nameservers found for %v", domain)
+}
+
+// getNameserverAddress resolves a nameserver's address to query on port 53,
+// preferring IPv4.
+func (s *Scanner) getNameserverAddress(trace *lookupTrace, server string) (string, error) {
+	for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		addresses, err := s.getDNSRecords(trace, server, recordType)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve nameserver %v: %w", server, err)
+		}
+
+		if len(addresses) > 0 {
+			return net.JoinHostPort(addresses[0], "53"), nil
+		}
+	}
+
+	return "", fmt.Errorf("nameserver %v has no address", server)
+}
+
+// answerValues returns the values of the answer's records owned by the name,
+// sorted, so answers can be compared regardless of order, along with their
+// lowest TTL. A CNAME record is its own value, as an authoritative server
+// doesn't follow it out of its zone as a recursive resolver does.
+func answerValues(answers []dns.RR, name string) ([]string, uint32) {
+	var (
+		values []string
+		ttl    uint32
+	)
+
+	for _, answer := range answers {
+		if !strings.EqualFold(dns.Fqdn(answer.Header().Name), dns.Fqdn(name)) {
+			continue
+		}
+
+		switch record := answer.(type) {
+		case *dns.CNAME:
+			values = append(values, "CNAME "+strings.ToLower(record.Target))
+		case *dns.MX:
+			values = append(values, fmt.Sprintf("%d %s", record.Preference, strings.ToLower(record.Mx)))
+		case *dns.TXT:
+			values = append(values, strings.Join(record.Txt, ""))
+		default:
+			continue
+		}
+
+		if len(values) == 1 || answer.Header().Ttl < ttl {
+			ttl = answer.Header().Ttl
+		}
+	}
+
+	sort.Strings(values)
+
+	return values, ttl
+}
+
+// negativeTTL returns how long resolvers may cache an answer without records:
+// the lower of its SOA record's TTL and minimum (RFC 2308, section 5).
+func negativeTTL(authority []dns.RR) uint32 {
+	for _, record := range authority {
+		if soa, ok := record.(*dns.SOA); ok {
+			return min(soa.Hdr.Ttl, soa.Minttl)
+		}
+	}
+
+	return 0
+}
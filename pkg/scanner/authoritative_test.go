@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// authoritativeResolver answers queries sent to the addresses of servers as
+// that authoritative nameserver, with the AA bit set unless the nameserver is
+// lame, and the SOA record in the authority section of answers without
+// records. Queries sent to any other address are answered by the recursive
+// resolver.
+type authoritativeResolver struct {
+	recursive Resolver
+	servers   map[string]Resolver
+	lame      map[string]bool
+}
+
+func (r *authoritativeResolver) Exchange(msg *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	server, ok := r.servers[address]
+	if !ok {
+		return r.recursive.Exchange(msg, address)
+	}
+
+	reply, rtt, err := server.Exchange(msg, address)
+	if err != nil {
+		return nil, rtt, err
+	}
+
+	reply.Authoritative = !r.lame[address]
+	if len(reply.Answer) == 0 {
+		reply.Ns = append(reply.Ns, &dns.SOA{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600}, Ns: "ns1.example.com.", Mbox: "hostmaster.example.com.", Minttl: 900})
+	}
+
+	return reply, rtt, nil
+}
+
+func TestScanner_Authoritative(t *testing.T) {
+	a := func(name string, address byte) dns.RR {
+		return &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: []byte{192, 0, 2, address}}
+	}
+
+	recursive := &zoneResolver{
+		records: map[string]map[uint16][]dns.RR{
+			"example.com.": {
+				dns.TypeNS: {
+					&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."},
+					&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "NS0.example.com."},
+				},
+				dns.TypeTXT: {txt("example.com.", "v=spf1 -all")},
+			},
+			"ns0.example.com.":               {dns.TypeA: {a("ns0.example.com.", 10)}},
+			"ns1.example.com.":               {dns.TypeA: {a("ns1.example.com.", 11)}},
+			"google._domainkey.example.com.": {dns.TypeTXT: {txt("google._domainkey.example.com.", "v=DKIM1; k=rsa; p=KEY")}},
+
+			// the resolver still has the record from before the policy was raised
+			"_dmarc.example.com.": {dns.TypeTXT: {txt("_dmarc.example.com.", "v=DMARC1; p=none")}},
+		},
+		nxdomain: true,
+	}
+
+	authoritative := &zoneResolver{
+		records: map[string]map[uint16][]dns.RR{
+			"example.com.":                   {dns.TypeTXT: {txt("example.com.", "v=spf1 -all")}},
+			"google._domainkey.example.com.": {dns.TypeTXT: {txt("google._domainkey.example.com.", "v=DKIM1; k=rsa; p=KEY")}},
+			"_dmarc.example.com.": {dns.TypeTXT: {&dns.TXT{
+				Hdr: dns.RR_Header{Name: "_dmarc.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120},
+				Txt: []string{"v=DMARC1; p=reject; ", "rua=mailto:dmarc@example.com"},
+			}}},
+		},
+		nxdomain: true,
+	}
+
+	scan := func(t *testing.T, lame map[string]bool, opts ...Option) *Result {
+		t.Helper()
+
+		resolver := &authoritativeResolver{
+			recursive: recursive,
+			servers:   map[string]Resolver{"192.0.2.10:53": authoritative, "192.0.2.11:53": authoritative},
+			lame:      lame,
+		}
+
+		scanner, err := New(zerolog.Nop(), time.Second, append(opts, WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+
+		return results[0]
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		result := scan(t, nil)
+		require.Empty(t, result.Error)
+		require.Nil(t, result.Authoritative)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		// ns0 sorts first, but is lame, so ns1 answers
+		result := scan(t, map[string]bool{"192.0.2.10:53": true}, WithAuthoritative())
+		require.Empty(t, result.Error)
+		require.Equal(t, []AuthoritativeAnswer{
+			{Lookup: "txt", Name: "example.com", Type: "TXT", Server: "ns1.example.com", TTL: 300, Records: []string{"v=spf1 -all"}},
+			{Lookup: "mx", Name: "example.com", Type: "MX", Server: "ns1.example.com", TTL: 900},
+			{
+				Lookup: "dmarc", Name: "_dmarc.example.com", Type: "TXT", Server: "ns1.example.com", TTL: 120,
+				Records: []string{"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"}, Recursive: []string{"v=DMARC1; p=none"}, Mismatch: true,
+			},
+			{Lookup: "dkim", Name: "google._domainkey.example.com", Type: "TXT", Server: "ns1.example.com", TTL: 300, Records: []string{"v=DKIM1; k=rsa; p=KEY"}},
+		}, result.Authoritative)
+		require.Contains(t, result.Timings, "authoritative_lookup")
+	})
+
+	t.Run("Lame", func(t *testing.T) {
+		result := scan(t, map[string]bool{"192.0.2.10:53": true, "192.0.2.11:53": true}, WithAuthoritative())
+		require.Contains(t, result.Error, "authoritative:no authoritative answer for example.com: ns1.example.com didn't answer authoritatively")
+		require.Nil(t, result.Authoritative)
+	})
+}
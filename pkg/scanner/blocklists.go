@@ -0,0 +1,414 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultBlocklistSample is the default number of addresses of each domain
+	// checked by WithBlocklists.
+	DefaultBlocklistSample = 8
+
+	// blocklistCacheDuration is how long each address's listing is cached for,
+	// regardless of the scanner's cache duration, as DNSBL operators rate
+	// limit their queries and many domains share the same sending addresses.
+	blocklistCacheDuration = time.Hour
+
+	// maxBlocklistLookups bounds the number of DNSBL queries of a domain that
+	// are made at once.
+	maxBlocklistLookups = 4
+
+	// maxSPFLookups is the number of DNS lookups an SPF record may need to be
+	// evaluated (RFC 7208, section 4.6.4), which bounds resolving its networks.
+	maxSPFLookups = 10
+)
+
+// DefaultBlocklists are the DNSBL zones checked by WithBlocklists if no zones
+// are given.
+var DefaultBlocklists = []string{"zen.spamhaus.org", "dnsbl.sorbs.net"}
+
+// Blocklisting is an address authorized to send a domain's mail (by its SPF
+// record) or to receive it (as one of its MX hosts) that's listed by a DNSBL.
+type Blocklisting struct {
+	Address string   `json:"address" yaml:"address" doc:"The listed address." example:"192.0.2.1"`
+	Source  string   `json:"source" yaml:"source" doc:"Where the address came from: spf if it's authorized by the SPF record, or the MX host it belongs to." example:"spf"`
+	Zone    string   `json:"zone" yaml:"zone" doc:"The DNSBL zone that lists the address." example:"zen.spamhaus.org"`
+	Codes   []string `json:"codes" yaml:"codes" doc:"The DNSBL's return codes for the address, which identify why (or by which of its lists) it's listed." example:"127.0.0.2"`
+}
+
+// sampledAddress is an address checked against the blocklists, along with
+// where it came from.
+type sampledAddress struct {
+	address netip.Addr
+	source  string
+}
+
+// WithBlocklists enables checking up to sample (DefaultBlocklistSample if 0
+// or less) of each domain's SPF authorized and MX host addresses against the
+// given DNSBL zones (DefaultBlocklists if none are given). It's disabled by
+// default, as DNSBL operators rate limit their queries, and many of them
+// (such as Spamhaus) refuse queries made through public resolvers.
+func WithBlocklists(sample int, zones ...string) Option {
+	return func(s *Scanner) error {
+		if len(zones) == 0 {
+			zones = DefaultBlocklists
+		}
+
+		if sample <= 0 {
+			sample = DefaultBlocklistSample
+		}
+
+		normalized := make([]string, 0, len(zones))
+
+		for _, zone := range zones {
+			zone = NormalizeDomain(zone)
+
+			if zone == "" || ValidateDomain(zone) != nil {
+				return fmt.Errorf("invalid blocklist zone: %q", zone)
+			}
+
+			normalized = append(normalized, zone)
+		}
+
+		s.blocklists = normalized
+		s.blocklistSample = sample
+
+		return nil
+	}
+}
+
+// getBlocklistings checks a sample of the domain's SPF authorized and MX host
+// addresses against each of the blocklists, returning the listings in the
+// order the addresses were sampled.
+func (s *Scanner) getBlocklistings(trace *lookupTrace, domain, spf string, mx []string) ([]Blocklisting, error) {
+	spfAddresses, err := s.getSPFAddresses(trace, domain, spf)
+	if err != nil {
+		return nil, fmt.Errorf("spf: %w", err)
+	}
+
+	var mxAddresses []sampledAddress
+
+	for _, host := range mx {
+		// null MX records (RFC 7505) have no host
+		if host == "." {
+			continue
+		}
+
+		for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			addresses, err := s.getDNSRecords(trace, host, recordType)
+			if err != nil {
+				return nil, fmt.Errorf("mx %s: %w", host, err)
+			}
+
+			for _, address := range addresses {
+				if parsed, err := netip.ParseAddr(address); err == nil {
+					mxAddresses = append(mxAddresses, sampledAddress{address: parsed, source: host})
+				}
+			}
+		}
+	}
+
+	sample := sampleAddresses(s.blocklistSample, spfAddresses, mxAddresses)
+
+	var (
+		errs  []error
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+
+	// each address's listings are kept in the order of the zones
+	found := make([]*Blocklisting, len(sample)*len(s.blocklists))
+	slots := make(chan struct{}, maxBlocklistLookups)
+
+	for addressIndex, sampled := range sample {
+		for zoneIndex, zone := range s.blocklists {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				slots <- struct{}{}
+				defer func() { <-slots }()
+
+				// the blocklists' answers are shared across scans, so the trace's context only stops them being queried
+				err := trace.err()
+
+				var codes []string
+				if err == nil {
+					codes, err = s.queryBlocklist(sampled.address, zone)
+				}
+
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", zone, err))
+					return
+				}
+
+				if len(codes) > 0 {
+					found[addressIndex*len(s.blocklists)+zoneIndex] = &Blocklisting{Address: sampled.address.String(), Source: sampled.source, Zone: zone, Codes: codes}
+				}
+			}()
+		}
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	// the check ran, so an empty (rather than nil) slice reports that nothing is listed
+	listings := make([]Blocklisting, 0)
+	for _, listing := range found {
+		if listing != nil {
+			listings = append(listings, *listing)
+		}
+	}
+
+	return listings, nil
+}
+
+// getSPFAddresses returns an address from each network authorized by the SPF
+// record (following include, a and mx mechanisms), in the order they're
+// authorized, up to the SPF lookup limit. Only mechanisms that pass (rather
+// than fail, softfail or are neutral) authorize a network.
+func (s *Scanner) getSPFAddresses(trace *lookupTrace, domain, spf string) ([]sampledAddress, error) {
+	var addresses []sampledAddress
+
+	lookups := 0
+	seen := make(map[string]struct{})
+
+	var resolve func(domain, record string) error
+	resolve = func(domain, record string) error {
+		if !strings.HasPrefix(record, SPFPrefix) {
+			return nil
+		}
+
+		for _, term := range strings.Fields(record)[1:] {
+			if strings.ContainsRune(term, '%') {
+				// macros depend on the message, so they can't be resolved ahead of time
+				continue
+			}
+
+			if strings.HasPrefix(term, "+") {
+				term = term[1:]
+			} else if strings.HasPrefix(term, "-") || strings.HasPrefix(term, "~") || strings.HasPrefix(term, "?") {
+				continue
+			}
+
+			name, argument, _ := strings.Cut(term, ":")
+			name = strings.ToLower(name)
+
+			// the a and mx mechanisms may have a CIDR length, which is irrelevant to the addresses sampled
+			if slash := strings.IndexByte(name, '/'); slash >= 0 {
+				name = name[:slash]
+			}
+
+			value, _, _ := strings.Cut(argument, "/")
+			if value == "" {
+				value = domain
+			}
+
+			switch name {
+			case "ip4", "ip6":
+				if prefix, err := parsePrefix(argument); err == nil {
+					addresses = append(addresses, sampledAddress{address: firstHost(prefix), source: "spf"})
+				}
+			case "include":
+				if lookups++; lookups > maxSPFLookups {
+					return nil
+				}
+
+				if _, ok := seen[value]; ok {
+					continue
+				}
+				seen[value] = struct{}{}
+
+				included, err := s.getTypeSPF(trace, value)
+				if err != nil {
+					return fmt.Errorf("include %s: %w", value, err)
+				}
+
+				if err = resolve(value, included); err != nil {
+					return err
+				}
+			case "a", "mx":
+				if lookups++; lookups > maxSPFLookups {
+					return nil
+				}
+
+				hosts := []string{value}
+				if name == "mx" {
+					var err error
+					if hosts, err = s.getDNSRecords(trace, value, dns.TypeMX); err != nil {
+						return fmt.Errorf("mx %s: %w", value, err)
+					}
+				}
+
+				for _, host := range hosts {
+					for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+						records, err := s.getDNSRecords(trace, host, recordType)
+						if err != nil {
+							return fmt.Errorf("%s %s: %w", name, host, err)
+						}
+
+						for _, record := range records {
+							if address, err := netip.ParseAddr(record); err == nil {
+								addresses = append(addresses, sampledAddress{address: address, source: "spf"})
+							}
+						}
+					}
+				}
+			}
+		}
+
+		return nil
+	}
+
+	if err := resolve(domain, spf); err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+// queryBlocklist returns the return codes of the DNSBL zone for the address,
+// or none if it isn't listed. Answers are cached for blocklistCacheDuration,
+// and concurrent queries of the same address share a single lookup.
+func (s *Scanner) queryBlocklist(address netip.Addr, zone string) ([]string, error) {
+	name := blocklistQuery(address, zone)
+
+	if codes := s.blocklistCache.Get(name); codes != nil {
+		return *codes, nil
+	}
+
+	value, err, _ := s.inflight.Do("dnsbl:"+name, func() (any, error) {
+		records, err := s.getDNSRecords(nil, name, dns.TypeA)
+		if err != nil {
+			return nil, err
+		}
+
+		codes, err := parseBlocklistCodes(records)
+		if err != nil {
+			return nil, err
+		}
+
+		s.blocklistCache.Set(name, &codes)
+
+		return codes, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]string), nil
+}
+
+// blocklistQuery returns the name queried to check the address against the
+// DNSBL zone (RFC 5782, section 2): the address's octets (or, for IPv6, its
+// nibbles) in reverse order, under the zone.
+func blocklistQuery(address netip.Addr, zone string) string {
+	var labels []string
+
+	if address.Is4() || address.Is4In6() {
+		octets := address.Unmap().As4()
+		for i := len(octets) - 1; i >= 0; i-- {
+			labels = append(labels, fmt.Sprint(octets[i]))
+		}
+	} else {
+		octets := address.As16()
+		for i := len(octets) - 1; i >= 0; i-- {
+			labels = append(labels, fmt.Sprintf("%x", octets[i]&0xf), fmt.Sprintf("%x", octets[i]>>4))
+		}
+	}
+
+	return strings.Join(labels, ".") + "." + zone
+}
+
+// parseBlocklistCodes returns the listing codes of a DNSBL's answer, which
+// are addresses in 127.0.0.0/8 (RFC 5782, section 2.1). Other answers (such as
+// from resolvers that redirect NXDOMAIN answers) aren't listings. Answers in
+// 127.255.255.0/24 are the errors DNSBLs such as Spamhaus return when they
+// refuse a query, such as from a public resolver or over their rate limit.
+func parseBlocklistCodes(records []string) ([]string, error) {
+	var codes []string
+
+	for _, record := range records {
+		address, err := netip.ParseAddr(record)
+		if err != nil || !address.Is4() || address.As4()[0] != 127 {
+			continue
+		}
+
+		if octets := address.As4(); octets[1] == 255 && octets[2] == 255 {
+			return nil, fmt.Errorf("query refused by the blocklist (%s), it may need to be queried via your own resolver", record)
+		}
+
+		codes = append(codes, record)
+	}
+
+	if codes == nil {
+		// cached as an empty (rather than nil) slice, so the lack of a listing is cached too
+		codes = []string{}
+	}
+
+	return codes, nil
+}
+
+// sampleAddresses returns up to size distinct addresses, drawn alternately
+// from the SPF and MX addresses, so that neither crowds out the other.
+func sampleAddresses(size int, spf, mx []sampledAddress) []sampledAddress {
+	var sample []sampledAddress
+	seen := make(map[netip.Addr]struct{})
+
+	for index := 0; index < max(len(spf), len(mx)) && len(sample) < size; index++ {
+		for _, addresses := range [][]sampledAddress{spf, mx} {
+			if index >= len(addresses) || len(sample) >= size {
+				continue
+			}
+
+			if _, ok := seen[addresses[index].address]; ok {
+				continue
+			}
+
+			seen[addresses[index].address] = struct{}{}
+			sample = append(sample, addresses[index])
+		}
+	}
+
+	return sample
+}
+
+// parsePrefix parses an ip4 or ip6 mechanism's value, which is an address or
+// a network in CIDR notation.
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		return netip.ParsePrefix(value)
+	}
+
+	address, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(address, address.BitLen()), nil
+}
+
+// firstHost returns the first host address of the network, skipping its
+// network address unless it's a single address or a point-to-point link.
+func firstHost(prefix netip.Prefix) netip.Addr {
+	address := prefix.Masked().Addr()
+	if prefix.Bits() < address.BitLen()-1 {
+		address = address.Next()
+	}
+
+	return address
+}
@@ -0,0 +1,161 @@
+package scanner
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocklistQuery(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{"192.0.2.1", "1.2.0.192.zen.spamhaus.org"},
+		{"::ffff:192.0.2.1", "1.2.0.192.zen.spamhaus.org"},
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.zen.spamhaus.org"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, blocklistQuery(netip.MustParseAddr(test.address), "zen.spamhaus.org"))
+	}
+}
+
+func TestParseBlocklistCodes(t *testing.T) {
+	codes, err := parseBlocklistCodes([]string{"127.0.0.2", "127.0.0.10"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.2", "127.0.0.10"}, codes)
+
+	// answers outside 127.0.0.0/8 (such as redirected NXDOMAIN answers) aren't listings
+	codes, err = parseBlocklistCodes([]string{"192.0.2.80"})
+	require.NoError(t, err)
+	require.Equal(t, []string{}, codes)
+
+	// refused queries are errors, rather than an address not being listed
+	_, err = parseBlocklistCodes([]string{"127.255.255.254"})
+	require.ErrorContains(t, err, "query refused by the blocklist (127.255.255.254)")
+}
+
+func TestSampleAddresses(t *testing.T) {
+	sampled := func(source string, addresses ...string) []sampledAddress {
+		var sample []sampledAddress
+		for _, address := range addresses {
+			sample = append(sample, sampledAddress{address: netip.MustParseAddr(address), source: source})
+		}
+
+		return sample
+	}
+
+	spf := sampled("spf", "192.0.2.1", "192.0.2.2", "192.0.2.3", "198.51.100.1")
+	mx := sampled("mx.example.com.", "198.51.100.1", "198.51.100.2")
+
+	// the sources alternate, and addresses in both are only sampled once
+	require.Equal(t, append(append(sampled("spf", "192.0.2.1"), sampled("mx.example.com.", "198.51.100.1")...), append(sampled("spf", "192.0.2.2"), sampled("mx.example.com.", "198.51.100.2")...)...), sampleAddresses(4, spf, mx))
+	require.Equal(t, append(sampled("spf", "192.0.2.1"), sampled("mx.example.com.", "198.51.100.1")...), sampleAddresses(2, spf, mx))
+	require.Len(t, sampleAddresses(10, spf, mx), 5)
+}
+
+func TestFirstHost(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.0/24":   "192.0.2.1",
+		"192.0.2.77/24":  "192.0.2.1",
+		"192.0.2.8/31":   "192.0.2.8",
+		"192.0.2.9/32":   "192.0.2.9",
+		"2001:db8::/32":  "2001:db8::1",
+		"2001:db8::/128": "2001:db8::",
+	}
+
+	for prefix, expected := range tests {
+		require.Equal(t, expected, firstHost(netip.MustParsePrefix(prefix)).String(), prefix)
+	}
+}
+
+func TestScanner_Blocklists(t *testing.T) {
+	resolver := testnet.NewResolver(t).
+		Records(
+			"example.com. 300 IN NS ns1.example.com.",
+			"example.com. 300 IN MX 10 mx.example.com.",
+			`example.com. 300 IN TXT "v=spf1 ip4:192.0.2.0/24 -ip4:203.0.113.1 include:_spf.example.net a:relay.example.com ~all"`,
+			`_spf.example.net. 300 IN TXT "v=spf1 ip6:2001:db8::/32 ?ip4:203.0.113.2 -all"`,
+			"relay.example.com. 300 IN A 198.51.100.7",
+			"mx.example.com. 300 IN A 198.51.100.25",
+			"1.2.0.192.zen.spamhaus.org. 300 IN A 127.0.0.2",
+			"1.2.0.192.zen.spamhaus.org. 300 IN A 127.0.0.10",
+			"25.100.51.198.dnsbl.sorbs.net. 300 IN A 127.0.0.6",
+		)
+
+	// queries counts the queries of names under zen.spamhaus.org
+	queries := func() int {
+		return resolver.ExchangesWhere(func(name string, _ uint16) bool { return strings.HasSuffix(name, ".zen.spamhaus.org.") })
+	}
+
+	newScanner := func(t *testing.T, opts ...Option) *Scanner {
+		t.Helper()
+
+		scanner, err := New(zerolog.Nop(), time.Second, append(opts, WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		return scanner
+	}
+
+	scan := func(t *testing.T, scanner *Scanner) *Result {
+		t.Helper()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+
+		return results[0]
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		require.Nil(t, scan(t, newScanner(t)).Blocklistings)
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		before := queries()
+
+		scanner := newScanner(t, WithBlocklists(0))
+		require.Equal(t, []Blocklisting{
+			{Address: "192.0.2.1", Source: "spf", Zone: "zen.spamhaus.org", Codes: []string{"127.0.0.2", "127.0.0.10"}},
+			{Address: "198.51.100.25", Source: "mx.example.com.", Zone: "dnsbl.sorbs.net", Codes: []string{"127.0.0.6"}},
+		}, scan(t, scanner).Blocklistings)
+
+		// the SPF authorized networks (less those that don't pass) and the MX host are each checked once
+		require.Equal(t, 4, queries()-before)
+
+		// the answers are cached, even though the scan results aren't
+		scanner.cache.Flush()
+		scan(t, scanner)
+		require.Equal(t, 4, queries()-before)
+	})
+
+	t.Run("Sample", func(t *testing.T) {
+		before := queries()
+
+		result := scan(t, newScanner(t, WithBlocklists(1, "zen.spamhaus.org")))
+		require.Len(t, result.Blocklistings, 1)
+		require.Equal(t, 1, queries()-before)
+	})
+
+	t.Run("NotListed", func(t *testing.T) {
+		// the check ran, so an empty slice is returned
+		result := scan(t, newScanner(t, WithBlocklists(0, "bl.example.org")))
+		require.NotNil(t, result.Blocklistings)
+		require.Empty(t, result.Blocklistings)
+	})
+
+	t.Run("InvalidZone", func(t *testing.T) {
+		_, err := New(zerolog.Nop(), time.Second, WithBlocklists(0, "not a zone"))
+		require.ErrorContains(t, err, `invalid blocklist zone: "not a zone"`)
+	})
+}
@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain is the longest CNAME chain followed, which stops a loop (or a
+// misconfigured chain) from being followed forever.
+const maxCNAMEChain = 8
+
+// getCNAMEChain queries the DNS server for the CNAME record of a domain, and
+// follows it to the end of its chain. It returns the target of each CNAME in
+// the chain, or nil if the domain has no CNAME record.
+func (s *Scanner) getCNAMEChain(trace *lookupTrace, domain string) ([]string, error) {
+	var chain []string
+
+	seen := map[string]struct{}{NormalizeDomain(domain): {}}
+	name := domain
+
+	for len(chain) < maxCNAMEChain {
+		answers, err := s.getDNSAnswers(trace, name, dns.TypeCNAME)
+		if err != nil {
+			return nil, err
+		}
+
+		target := cnameTarget(answers, name)
+		if target == "" {
+			break
+		}
+
+		chain = append(chain, target)
+
+		if _, ok := seen[target]; ok {
+			// the chain loops back on itself
+			break
+		}
+
+		seen[target] = struct{}{}
+		name = target
+	}
+
+	return chain, nil
+}
+
+// cnameTarget returns the normalized target of the CNAME answer owned by the
+// given name, or an empty string if there isn't one.
+func cnameTarget(answers []dns.RR, name string) string {
+	for _, answer := range answers {
+		if record, ok := answer.(*dns.CNAME); ok && strings.EqualFold(dns.Fqdn(record.Hdr.Name), dns.Fqdn(name)) {
+			return NormalizeDomain(record.Target)
+		}
+	}
+
+	return ""
+}
+
+// aliased records the target of each CNAME answer, keyed by its owner in
+// lowercase, so a lookup can report the chain a name was followed through
+// (see chain).
+func (t *lookupTrace) aliased(answers []dns.RR) {
+	if t == nil {
+		return
+	}
+
+	for _, answer := range answers {
+		if record, ok := answer.(*dns.CNAME); ok {
+			if t.aliases == nil {
+				t.aliases = make(map[string]string)
+			}
+
+			t.aliases[strings.ToLower(dns.Fqdn(record.Hdr.Name))] = NormalizeDomain(record.Target)
+		}
+	}
+}
+
+// chain returns the normalized target of each CNAME the name was followed
+// through by the lookup's queries, or nil if it isn't an alias. The chain is
+// the same whether the resolver followed it, answering with every CNAME in
+// it, or only answered with the first, so the scanner queried its target.
+func (t *lookupTrace) chain(name string) []string {
+	var chain []string
+
+	seen := map[string]struct{}{NormalizeDomain(name): {}}
+
+	for len(chain) < maxCNAMEChain {
+		target, ok := t.aliases[strings.ToLower(dns.Fqdn(name))]
+		if !ok {
+			break
+		}
+
+		chain = append(chain, target)
+
+		if _, ok = seen[target]; ok {
+			// the chain loops back on itself
+			break
+		}
+
+		seen[target] = struct{}{}
+		name = target
+	}
+
+	return chain
+}
+
+// chainRcode returns the name of the response code of the last name in the
+// name's CNAME chain (see chain), as a resolver that follows the chain
+// answers with, or that of the name itself if it isn't an alias.
+func (t *lookupTrace) chainRcode(name string) string {
+	if chain := t.chain(name); len(chain) > 0 {
+		if rcode := t.rcode(chain[len(chain)-1]); rcode != "" {
+			return rcode
+		}
+	}
+
+	return t.rcode(name)
+}
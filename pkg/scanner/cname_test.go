@@ -0,0 +1,188 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_CNAME(t *testing.T) {
+	cname := func(name, target string) dns.RR {
+		return &dns.CNAME{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300}, Target: target}
+	}
+
+	soa := func(name string) dns.RR {
+		return &dns.SOA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600}, Ns: "ns1." + name, Mbox: "hostmaster." + name, Serial: 2024061501}
+	}
+
+	resolver := &zoneResolver{
+		records: map[string]map[uint16][]dns.RR{
+			// a provider flattening the CNAME serves its target's records at the apex itself
+			"example.com.": {
+				dns.TypeNS:  {&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}},
+				dns.TypeSOA: {soa("example.com.")},
+				dns.TypeTXT: {txt("example.com.", "v=spf1 include:_spf.example.net -all")},
+			},
+
+			// a resolver that doesn't follow the CNAME only answers with it
+			"example.org.": {
+				dns.TypeCNAME: {cname("example.org.", "www.example.org.")},
+				dns.TypeNS:    {cname("example.org.", "www.example.org.")},
+				dns.TypeSOA:   {cname("example.org.", "www.example.org.")},
+				dns.TypeTXT:   {cname("example.org.", "www.example.org.")},
+			},
+			"www.example.org.": {
+				dns.TypeCNAME: {cname("www.example.org.", "edge.example.net.")},
+				dns.TypeTXT:   {cname("www.example.org.", "edge.example.net.")},
+			},
+			"edge.example.net.": {
+				dns.TypeTXT: {txt("edge.example.net.", "v=spf1 include:_spf.example.net -all")},
+			},
+
+			// a resolver that follows the CNAME answers with its target's records too
+			"example.info.": {
+				dns.TypeCNAME: {cname("example.info.", "edge.example.net.")},
+				dns.TypeNS:    {cname("example.info.", "edge.example.net.")},
+				dns.TypeSOA:   {cname("example.info.", "edge.example.net."), soa("example.net.")},
+				dns.TypeTXT:   {cname("example.info.", "edge.example.net."), txt("edge.example.net.", "v=spf1 include:_spf.example.net -all")},
+			},
+		},
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	results, err := scanner.Scan("example.com", "example.org", "example.info")
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	for _, result := range results {
+		require.Empty(t, result.Error)
+		require.Equal(t, "v=spf1 include:_spf.example.net -all", result.SPF)
+	}
+
+	// flattened
+	require.Nil(t, results[0].CNAME)
+	require.NotNil(t, results[0].SOA)
+
+	// not followed by the resolver, so the scanner follows it
+	require.Equal(t, []string{"www.example.org", "edge.example.net"}, results[1].CNAME)
+	require.Nil(t, results[1].SOA)
+
+	// followed by the resolver, whose SOA is the target's rather than the domain's
+	require.Equal(t, []string{"edge.example.net"}, results[2].CNAME)
+	require.Nil(t, results[2].SOA)
+}
+
+func TestGetDNSRecords_FollowedCNAME(t *testing.T) {
+	// the target's records are only returned once, as the resolver already followed the CNAME
+	resolver := &zoneResolver{
+		records: map[string]map[uint16][]dns.RR{
+			"example.info.": {
+				dns.TypeTXT: {
+					&dns.CNAME{Hdr: dns.RR_Header{Name: "example.info.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300}, Target: "edge.example.net."},
+					txt("edge.example.net.", "v=spf1 -all"),
+				},
+			},
+			"edge.example.net.": {
+				dns.TypeTXT: {txt("edge.example.net.", "v=spf1 -all")},
+			},
+		},
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	records, err := scanner.getDNSRecords(nil, "example.info", dns.TypeTXT)
+	require.NoError(t, err)
+	require.Equal(t, []string{"v=spf1 -all"}, records)
+}
+
+func TestScanner_ManagedCNAME(t *testing.T) {
+	cname := func(name, target string) dns.RR {
+		return &dns.CNAME{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300}, Target: target}
+	}
+
+	ns := func(name string) dns.RR {
+		return &dns.NS{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1." + name}
+	}
+
+	resolver := &zoneResolver{
+		records: map[string]map[uint16][]dns.RR{
+			// a resolver that doesn't follow the CNAME only answers with it
+			"example.com.": {dns.TypeNS: {ns("example.com.")}},
+			"_dmarc.example.com.": {
+				dns.TypeTXT: {cname("_dmarc.example.com.", "example.com._d.easydmarc.pro.")},
+			},
+			"example.com._d.easydmarc.pro.": {
+				dns.TypeTXT: {txt("example.com._d.easydmarc.pro.", "v=DMARC1; p=reject; rua=mailto:rua@easydmarc.example")},
+			},
+
+			// a resolver that follows the CNAME answers with every CNAME in the chain, and the target's records
+			"example.org.": {dns.TypeNS: {ns("example.org.")}},
+			"_dmarc.example.org.": {
+				dns.TypeTXT: {
+					cname("_dmarc.example.org.", "_dmarc.example.org.managed.example.net."),
+					cname("_dmarc.example.org.managed.example.net.", "example.org.dmarc.valimail.com."),
+					txt("example.org.dmarc.valimail.com.", "v=DMARC1; p=quarantine"),
+				},
+			},
+
+			// the service doesn't publish a record for the domain
+			"example.net.": {dns.TypeNS: {ns("example.net.")}},
+			"_dmarc.example.net.": {
+				dns.TypeTXT: {cname("_dmarc.example.net.", "example.net._d.powerdmarc.com.")},
+			},
+
+			// the SPF record is looked up through the domain's own CNAME
+			"mail.example.info.": {
+				dns.TypeTXT: {
+					cname("mail.example.info.", "mail.example.info._spf.smart.ondmarc.com."),
+					txt("mail.example.info._spf.smart.ondmarc.com.", "v=spf1 include:_spf.google.com -all"),
+				},
+			},
+		},
+		rcodes: map[string]int{"example.net._d.powerdmarc.com.": dns.RcodeNameError},
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	results, err := scanner.Scan("example.com", "example.org", "example.net", "mail.example.info")
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	for _, result := range results {
+		require.Empty(t, result.Error)
+	}
+
+	// not followed by the resolver, so the scanner follows it
+	require.Equal(t, "v=DMARC1; p=reject; rua=mailto:rua@easydmarc.example", results[0].DMARC)
+	require.Equal(t, []string{"example.com._d.easydmarc.pro"}, results[0].DMARCCNAME)
+	require.Nil(t, results[0].SPFCNAME)
+
+	// followed by the resolver, through every link of the chain
+	require.Equal(t, "v=DMARC1; p=quarantine", results[1].DMARC)
+	require.Equal(t, []string{"_dmarc.example.org.managed.example.net", "example.org.dmarc.valimail.com"}, results[1].DMARCCNAME)
+
+	// missing at the target, which is what the response code explains
+	require.Empty(t, results[2].DMARC)
+	require.Equal(t, []string{"example.net._d.powerdmarc.com"}, results[2].DMARCCNAME)
+	require.Equal(t, "NXDOMAIN", results[2].Rcodes["dmarc"])
+
+	require.Equal(t, "v=spf1 include:_spf.google.com -all", results[3].SPF)
+	require.Equal(t, []string{"mail.example.info._spf.smart.ondmarc.com"}, results[3].SPFCNAME)
+	require.Nil(t, results[3].DMARCCNAME)
+}
@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"sort"
+	"time"
+)
+
+// Config is the scanner's effective configuration, as far as it affects the
+// results it produces: the resolvers it queries and how, the lookups it
+// makes, and the limits it evaluates their answers within. Settings that
+// only affect how fast results are produced (such as the number of
+// concurrent scans or the cache duration) are left out. It's normalized, so
+// scanners configured equivalently (such as with the same nameservers in a
+// different order) have equal configs.
+type Config struct {
+	Nameservers       []string      `json:"nameservers"`
+	Protocol          string        `json:"protocol"`
+	Timeout           time.Duration `json:"timeout"`
+	DNSBuffer         uint16        `json:"dnsBuffer"`
+	DKIMSelectors     []string      `json:"dkimSelectors,omitempty"`
+	OnlyDKIMSelectors []string      `json:"onlyDKIMSelectors,omitempty"`
+	SkipDKIMDiscovery bool          `json:"skipDKIMDiscovery,omitempty"`
+	SendingSubdomains []string      `json:"sendingSubdomains,omitempty"`
+	Blocklists        []string      `json:"blocklists,omitempty"`
+	BlocklistSample   int           `json:"blocklistSample,omitempty"`
+	Authoritative     bool          `json:"authoritative,omitempty"`
+	Lookalikes        int           `json:"lookalikes,omitempty"`
+	MTASTS            bool          `json:"mtaSts,omitempty"`
+	SPFIncludes       bool          `json:"spfIncludes,omitempty"`
+	TXTRecordLimit    int           `json:"txtRecordLimit"`
+	AnswerSizeLimit   int           `json:"answerSizeLimit"`
+	SPFFanoutLimit    int           `json:"spfFanoutLimit"`
+}
+
+// Config returns the scanner's effective configuration.
+func (s *Scanner) Config() Config {
+	config := Config{
+		Nameservers: sortedCopy(s.nameservers),
+		Protocol:    s.dnsClient.Net,
+		Timeout:     s.dnsClient.Timeout,
+		DNSBuffer:   s.dnsBuffer,
+
+		// the selectors are looked up in order, so the first with a key is the result's
+		DKIMSelectors:     append([]string(nil), s.dkimSelectors...),
+		OnlyDKIMSelectors: append([]string(nil), s.onlyDKIMSelectors...),
+		SkipDKIMDiscovery: s.skipDKIMDiscovery,
+
+		SendingSubdomains: sortedCopy(s.sendingSubdomains),
+		Authoritative:     s.authoritative,
+		Lookalikes:        s.lookalikeLimit,
+		MTASTS:            s.mtaSTS,
+		SPFIncludes:       s.spfIncludes,
+		TXTRecordLimit:    s.txtRecordLimit,
+		AnswerSizeLimit:   s.answerSizeLimit,
+		SPFFanoutLimit:    s.spfFanoutLimit,
+	}
+
+	// the sample is only used if blocklists are checked
+	if len(s.blocklists) > 0 {
+		config.Blocklists, config.BlocklistSample = sortedCopy(s.blocklists), s.blocklistSample
+	}
+
+	return config
+}
+
+// sortedCopy returns a sorted copy of the values, or nil if there are none.
+func sortedCopy(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+
+	return sorted
+}
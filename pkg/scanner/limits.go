@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultTXTRecordLimit is the default number of TXT records a single
+	// answer may have (see WithAnswerLimits). Even domains with years of
+	// verification tokens publish far fewer.
+	DefaultTXTRecordLimit = 100
+
+	// DefaultAnswerSizeLimit is the default number of bytes of records a
+	// single lookup may be answered with, across every query it makes (see
+	// WithAnswerLimits). It's 8 times the 4096 byte buffer beyond which answers
+	// can only be resolved over TCP.
+	DefaultAnswerSizeLimit = 32768
+
+	// DefaultSPFFanoutLimit is the default number of DNS lookup terms
+	// (include, a, mx, ptr, exists and redirect) a single SPF record may have
+	// (see WithAnswerLimits). Records with more than the 10 lookups SPF allows
+	// already fail at receivers, unless they match before reaching the rest.
+	DefaultSPFFanoutLimit = 20
+)
+
+// ErrRecordTooLarge is wrapped by the error of a lookup whose answers exceed
+// the scanner's limits (see WithAnswerLimits), in which case the records
+// aren't evaluated, and the lookup is reported in the result's Oversized.
+var ErrRecordTooLarge = errors.New("record too large to evaluate")
+
+// WithAnswerLimits bounds the answers each lookup evaluates, so a domain can't
+// make the scanner hold and parse a pathological number of huge records:
+//   - txtRecords, the TXT records of a single answer (DefaultTXTRecordLimit);
+//   - answerSize, the bytes of records across every answer of a lookup (DefaultAnswerSizeLimit);
+//   - spfFanout, the DNS lookup terms of a single SPF record (DefaultSPFFanoutLimit).
+//
+// A limit of 0 or less is its default. Answers are checked as they're
+// received, before their records are read.
+func WithAnswerLimits(txtRecords, answerSize, spfFanout int) Option {
+	return func(s *Scanner) error {
+		if txtRecords <= 0 {
+			txtRecords = DefaultTXTRecordLimit
+		}
+
+		if answerSize <= 0 {
+			answerSize = DefaultAnswerSizeLimit
+		}
+
+		if spfFanout <= 0 {
+			spfFanout = DefaultSPFFanoutLimit
+		}
+
+		s.txtRecordLimit, s.answerSizeLimit, s.spfFanoutLimit = txtRecords, answerSize, spfFanout
+
+		return nil
+	}
+}
+
+// checkAnswerLimits returns an error wrapping ErrRecordTooLarge if the answer
+// to a query of the name has more TXT records than the scanner allows, or
+// takes its lookup's answers past the size allowed, which is accumulated in
+// the trace (if any). Each record's size is computed from its fields, so it
+// stops at the record that exceeds a limit without copying any of them.
+func (s *Scanner) checkAnswerLimits(trace *lookupTrace, name string, answers []dns.RR) error {
+	size, txtRecords := 0, 0
+	if trace != nil {
+		size = trace.answerSize
+	}
+
+	for _, answer := range answers {
+		if answer.Header().Rrtype == dns.TypeTXT {
+			if txtRecords++; txtRecords > s.txtRecordLimit {
+				return fmt.Errorf("%w: the answer for %v has more than %d TXT records", ErrRecordTooLarge, name, s.txtRecordLimit)
+			}
+		}
+
+		if size += dns.Len(answer); size > s.answerSizeLimit {
+			return fmt.Errorf("%w: the answers for %v exceed %d bytes", ErrRecordTooLarge, name, s.answerSizeLimit)
+		}
+	}
+
+	if trace != nil {
+		trace.answerSize = size
+	}
+
+	return nil
+}
+
+// checkSPFFanout returns an error wrapping ErrRecordTooLarge if the SPF
+// record of the domain has more DNS lookup terms than the scanner allows.
+func (s *Scanner) checkSPFFanout(domain, record string) error {
+	terms := 0
+
+	for _, term := range strings.Fields(strings.ToLower(record)) {
+		name, _, _ := strings.Cut(strings.TrimLeft(term, "+-~?"), ":")
+		name, _, _ = strings.Cut(name, "/")
+		name, _, _ = strings.Cut(name, "=")
+
+		switch name {
+		case "include", "a", "mx", "ptr", "exists", "redirect":
+			if terms++; terms > s.spfFanoutLimit {
+				return fmt.Errorf("%w: the SPF record of %v has more than %d DNS lookup terms", ErrRecordTooLarge, domain, s.spfFanoutLimit)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package scanner
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// floodResolver answers TXT queries of a name with the same prebuilt answer,
+// so serving it allocates next to nothing, and any other query with the zone
+// resolver.
+type floodResolver struct {
+	zoneResolver
+	name   string
+	answer []dns.RR
+}
+
+func (r *floodResolver) Exchange(msg *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	if question := msg.Question[0]; question.Qtype != dns.TypeTXT || !strings.EqualFold(question.Name, r.name) {
+		return r.zoneResolver.Exchange(msg, address)
+	}
+
+	reply := new(dns.Msg)
+	reply.SetReply(msg)
+	reply.Answer = r.answer
+
+	return reply, 0, nil
+}
+
+// flood returns an answer of count TXT records at the name after its SPF
+// record, each split across segments strings of 255 bytes, which every
+// record shares.
+func flood(name, spf string, count, segments int) []dns.RR {
+	segment := make([]string, segments)
+	for i := range segment {
+		segment[i] = strings.Repeat("a", 255)
+	}
+
+	answer := []dns.RR{txt(name, spf)}
+	for i := 0; i < count; i++ {
+		answer = append(answer, &dns.TXT{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: segment})
+	}
+
+	return answer
+}
+
+func TestScanner_AnswerLimits(t *testing.T) {
+	ns := map[uint16][]dns.RR{dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}}}
+
+	newScanner := func(t *testing.T, resolver Resolver, opts ...Option) *Scanner {
+		t.Helper()
+
+		scanner, err := New(zerolog.Nop(), time.Second, append(opts, WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		return scanner
+	}
+
+	t.Run("Oversized", func(t *testing.T) {
+		// about 1 MB of TXT records at the apex, each small enough that the
+		// first 100 fit the size limit
+		resolver := &floodResolver{
+			zoneResolver: zoneResolver{records: map[string]map[uint16][]dns.RR{"example.com.": ns}, nxdomain: true},
+			name:         "example.com.",
+			answer:       flood("example.com.", "v=spf1 -all", 4000, 1),
+		}
+
+		results, err := newScanner(t, resolver).Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+
+		// the lookups of the apex's TXT records (including the DMARC and BIMI
+		// fallbacks) are findings rather than errors
+		require.Empty(t, results[0].Error)
+		require.Equal(t, map[string]string{
+			"bimi":  "the answer for example.com has more than 100 TXT records",
+			"dmarc": "the answer for example.com has more than 100 TXT records",
+			"spf":   "the answer for example.com has more than 100 TXT records",
+			"txt":   "the answer for example.com has more than 100 TXT records",
+		}, results[0].Oversized)
+		require.Empty(t, results[0].SPF)
+		require.Nil(t, results[0].TXT)
+
+		// within the record limit, the answer is still too large
+		results, err = newScanner(t, resolver, WithAnswerLimits(10000, 0, 0)).Scan("example.com")
+		require.NoError(t, err)
+		require.Equal(t, "the answers for example.com exceed 32768 bytes", results[0].Oversized["txt"])
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		resolver := &floodResolver{
+			zoneResolver: zoneResolver{records: map[string]map[uint16][]dns.RR{"example.com.": ns}, nxdomain: true},
+			name:         "example.com.",
+			answer:       flood("example.com.", "v=spf1 -all", 1000, 4),
+		}
+
+		// allocated returns the bytes allocated reading the apex's TXT records
+		allocated := func(scanner *Scanner) uint64 {
+			var before, after runtime.MemStats
+
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			for i := 0; i < 10; i++ {
+				_, _, _ = scanner.getTXTRecords(&lookupTrace{}, "example.com")
+			}
+
+			runtime.ReadMemStats(&after)
+
+			return (after.TotalAlloc - before.TotalAlloc) / 10
+		}
+
+		// the megabyte answer is rejected before any of its records are copied
+		_, _, err := newScanner(t, resolver).getTXTRecords(&lookupTrace{}, "example.com")
+		require.ErrorIs(t, err, ErrRecordTooLarge)
+		require.Less(t, allocated(newScanner(t, resolver)), uint64(16<<10))
+
+		// without the limits, every record is joined and measured
+		unlimited := newScanner(t, resolver, WithAnswerLimits(1<<20, 1<<30, 0))
+		records, _, err := unlimited.getTXTRecords(&lookupTrace{}, "example.com")
+		require.NoError(t, err)
+		require.Len(t, records, 1001)
+		require.Greater(t, allocated(unlimited), uint64(1<<20))
+	})
+
+	t.Run("SPFFanout", func(t *testing.T) {
+		spf := "v=spf1" + strings.Repeat(" include:_spf.example.net", 30) + " -all"
+
+		resolver := &zoneResolver{
+			records: map[string]map[uint16][]dns.RR{
+				"example.com.": {dns.TypeNS: ns[dns.TypeNS], dns.TypeTXT: {txt("example.com.", spf)}},
+			},
+			nxdomain: true,
+		}
+
+		results, err := newScanner(t, resolver).Scan("example.com")
+		require.NoError(t, err)
+		require.Empty(t, results[0].Error)
+		require.Equal(t, "the SPF record of example.com has more than 20 DNS lookup terms", results[0].Oversized["spf"])
+
+		// the record's other TXT lookups aren't affected
+		require.NotContains(t, results[0].Oversized, "txt")
+
+		results, err = newScanner(t, resolver, WithAnswerLimits(0, 0, 30)).Scan("example.com")
+		require.NoError(t, err)
+		require.Nil(t, results[0].Oversized)
+		require.Equal(t, spf, results[0].SPF)
+	})
+}
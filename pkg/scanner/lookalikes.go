@@ -0,0 +1,321 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// DefaultLookalikeLimit is the default number of lookalikes of each domain
+	// checked by WithLookalikes.
+	DefaultLookalikeLimit = 40
+
+	// maxLookalikeLimit bounds the number of lookalikes of each domain that
+	// can be checked, as each takes up to five queries.
+	maxLookalikeLimit = 200
+
+	// maxLookalikeLookups bounds the number of lookalikes of a domain that are
+	// looked up at once.
+	maxLookalikeLookups = 4
+)
+
+// The techniques lookalikes are generated with.
+const (
+	LookalikeConfusable  = "confusable"
+	LookalikeHomograph   = "homograph"
+	LookalikeHyphenation = "hyphenation"
+	LookalikeSwap        = "swap"
+)
+
+var (
+	// confusables are the character sequences that are easily mistaken for
+	// each other in most fonts, in the order they're substituted.
+	confusables = [][2]string{
+		{"rn", "m"}, {"m", "rn"}, {"vv", "w"}, {"w", "vv"}, {"cl", "d"}, {"d", "cl"},
+		{"l", "1"}, {"1", "l"}, {"i", "1"}, {"l", "i"}, {"i", "l"}, {"o", "0"}, {"0", "o"},
+		{"s", "5"}, {"5", "s"}, {"g", "q"}, {"q", "g"}, {"u", "v"}, {"v", "u"},
+	}
+
+	// homoglyphs are the Cyrillic letters that are rendered identically to
+	// Latin ones, which an internationalized domain name can use in place of
+	// them.
+	homoglyphs = map[byte]rune{
+		'a': 'а', 'c': 'с', 'e': 'е', 'i': 'і', 'j': 'ј', 'o': 'о', 'p': 'р', 's': 'ѕ', 'x': 'х', 'y': 'у',
+	}
+)
+
+// Lookalike is a domain that resolves, and that's easily mistaken for the
+// scanned domain, with the records that show whether it's set up for mail.
+type Lookalike struct {
+	Name      string   `json:"name" yaml:"name" doc:"The lookalike domain, in its ASCII form." example:"examp1e.com"`
+	Unicode   string   `json:"unicode,omitempty" yaml:"unicode,omitempty" doc:"The lookalike domain as it's displayed, if it's an internationalized domain name." example:"exаmple.com"`
+	Technique string   `json:"technique" yaml:"technique" doc:"How the lookalike was generated from the domain: swap (two adjacent characters swapped), confusable (characters replaced with ones easily mistaken for them, such as rn for m), homograph (a letter replaced with an identical looking Cyrillic one) or hyphenation (a hyphen added or removed)." example:"confusable"`
+	Addresses []string `json:"addresses,omitempty" yaml:"addresses,omitempty" doc:"The A and AAAA records for the lookalike." example:"192.0.2.1"`
+	MX        []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"The MX records for the lookalike." example:"mx.example.net"`
+	SPF       string   `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The SPF record for the lookalike." example:"v=spf1 +all"`
+}
+
+// lookalikeVariant is a generated lookalike of a domain, which may not exist.
+type lookalikeVariant struct {
+	name, technique string
+}
+
+// WithLookalikes enables checking up to limit (DefaultLookalikeLimit if 0 or
+// less) lookalikes of each domain's registered domain, generated by swapping
+// adjacent characters, replacing characters with confusable or homograph ones,
+// and adding or removing hyphens, for whether they resolve and are set up for
+// mail. It's disabled by default, as it adds up to five queries per
+// lookalike to every scan, and the lookalikes found may well be registered
+// legitimately, so they're only informational.
+func WithLookalikes(limit int) Option {
+	return func(s *Scanner) error {
+		if limit <= 0 {
+			limit = DefaultLookalikeLimit
+		}
+
+		if limit > maxLookalikeLimit {
+			return fmt.Errorf("lookalike limit must be at most %d, got %d", maxLookalikeLimit, limit)
+		}
+
+		s.lookalikeLimit = limit
+
+		return nil
+	}
+}
+
+// getLookalikes looks up the lookalikes of a domain, returning those that
+// resolve in the order they were generated. As the lookalikes are someone
+// else's domains (if anyone's), one that fails to resolve is skipped rather
+// than failing the scan.
+func (s *Scanner) getLookalikes(trace *lookupTrace, domain string) []Lookalike {
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+
+	variants := lookalikeVariants(domain, s.lookalikeLimit)
+	found := make([]*Lookalike, len(variants))
+	slots := make(chan struct{}, maxLookalikeLookups)
+
+	for index, variant := range variants {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			// each lookalike has its own trace, as traces aren't safe for concurrent use
+			lookalikeTrace := &lookupTrace{ctx: trace.ctx}
+			result := s.getLookalike(lookalikeTrace, variant)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			trace.tcp = trace.tcp || lookalikeTrace.tcp
+			found[index] = result
+		}()
+	}
+
+	wg.Wait()
+
+	// the check ran, so an empty (rather than nil) slice reports that no lookalikes resolve
+	lookalikes := make([]Lookalike, 0)
+	for _, lookalike := range found {
+		if lookalike != nil {
+			lookalikes = append(lookalikes, *lookalike)
+		}
+	}
+
+	return lookalikes
+}
+
+// getLookalike returns the records of a lookalike, or nil if it doesn't
+// resolve (as it has neither address nor MX records) or its lookups failed.
+// Names that don't exist aren't queried any further.
+func (s *Scanner) getLookalike(trace *lookupTrace, variant lookalikeVariant) *Lookalike {
+	lookalike := &Lookalike{Name: variant.name, Technique: variant.technique}
+
+	if variant.technique == LookalikeHomograph {
+		lookalike.Unicode, _ = idna.Display.ToUnicode(variant.name)
+	}
+
+	for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		addresses, err := s.getDNSRecords(trace, variant.name, recordType)
+		if err != nil || trace.rcode(variant.name) == dns.RcodeToString[dns.RcodeNameError] {
+			return nil
+		}
+
+		lookalike.Addresses = append(lookalike.Addresses, addresses...)
+	}
+
+	var err error
+	if lookalike.MX, err = s.getDNSRecords(trace, variant.name, dns.TypeMX); err != nil {
+		return nil
+	}
+
+	if len(lookalike.Addresses) == 0 && len(lookalike.MX) == 0 {
+		return nil
+	}
+
+	// an SPF record too large to evaluate still shows the lookalike is set up to send mail
+	records, err := s.getDNSRecords(trace, variant.name, dns.TypeTXT)
+	if err != nil {
+		return lookalike
+	}
+
+	for _, record := range records {
+		if strings.HasPrefix(record, SPFPrefix) {
+			lookalike.SPF = record
+			break
+		}
+	}
+
+	return lookalike
+}
+
+// lookalikeVariants returns up to limit lookalikes of the domain's registered
+// domain, which differ from it in its label below the public suffix, taking
+// a lookalike of each technique in turn so that every technique is covered at
+// any limit. The lookalikes are valid domains, other than the domain itself.
+// Internationalized domains have none, as their lookalikes depend on the
+// script they're in.
+func lookalikeVariants(domain string, limit int) []lookalikeVariant {
+	registered, err := publicsuffix.EffectiveTLDPlusOne(NormalizeDomain(domain))
+	if err != nil {
+		return nil
+	}
+
+	label, suffix, _ := strings.Cut(registered, ".")
+	if strings.HasPrefix(label, "xn--") {
+		return nil
+	}
+
+	techniques := []struct {
+		name   string
+		labels []string
+	}{
+		{LookalikeSwap, swappedLabels(label)},
+		{LookalikeConfusable, confusableLabels(label)},
+		{LookalikeHomograph, homographLabels(label)},
+		{LookalikeHyphenation, hyphenatedLabels(label)},
+	}
+
+	seen := map[string]struct{}{registered: {}}
+
+	var variants []lookalikeVariant
+
+	for index := 0; len(variants) < limit; index++ {
+		remaining := false
+
+		for _, technique := range techniques {
+			if index >= len(technique.labels) || len(variants) >= limit {
+				continue
+			}
+
+			remaining = true
+			name := technique.labels[index] + "." + suffix
+
+			if _, ok := seen[name]; ok || ValidateDomain(name) != nil {
+				continue
+			}
+
+			seen[name] = struct{}{}
+			variants = append(variants, lookalikeVariant{name: name, technique: technique.name})
+		}
+
+		if !remaining {
+			break
+		}
+	}
+
+	return variants
+}
+
+// swappedLabels returns the label with each pair of adjacent characters that
+// differ swapped.
+func swappedLabels(label string) []string {
+	var labels []string
+
+	for index := 0; index+1 < len(label); index++ {
+		if label[index] == label[index+1] {
+			continue
+		}
+
+		swapped := []byte(label)
+		swapped[index], swapped[index+1] = swapped[index+1], swapped[index]
+		labels = append(labels, string(swapped))
+	}
+
+	return labels
+}
+
+// confusableLabels returns the label with each occurrence of each confusable
+// sequence replaced, one at a time.
+func confusableLabels(label string) []string {
+	var labels []string
+
+	for _, confusable := range confusables {
+		for offset := 0; ; {
+			index := strings.Index(label[offset:], confusable[0])
+			if index < 0 {
+				break
+			}
+
+			index += offset
+			labels = append(labels, label[:index]+confusable[1]+label[index+len(confusable[0]):])
+			offset = index + 1
+		}
+	}
+
+	return labels
+}
+
+// homographLabels returns the label with each letter that has a Cyrillic
+// homoglyph replaced with it, one at a time, in its ASCII (punycode) form.
+func homographLabels(label string) []string {
+	var labels []string
+
+	for index := 0; index < len(label); index++ {
+		homoglyph, ok := homoglyphs[label[index]]
+		if !ok {
+			continue
+		}
+
+		encoded, err := idna.Lookup.ToASCII(label[:index] + string(homoglyph) + label[index+1:])
+		if err != nil {
+			continue
+		}
+
+		labels = append(labels, encoded)
+	}
+
+	return labels
+}
+
+// hyphenatedLabels returns the label with each of its hyphens removed, then
+// with a hyphen added between each pair of adjacent characters that aren't
+// hyphens, one at a time.
+func hyphenatedLabels(label string) []string {
+	var labels []string
+
+	for index := 0; index < len(label); index++ {
+		if label[index] == '-' {
+			labels = append(labels, label[:index]+label[index+1:])
+		}
+	}
+
+	for index := 1; index < len(label); index++ {
+		if label[index-1] != '-' && label[index] != '-' {
+			labels = append(labels, label[:index]+"-"+label[index:])
+		}
+	}
+
+	return labels
+}
@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookalikeVariants(t *testing.T) {
+	t.Run("Techniques", func(t *testing.T) {
+		variants := lookalikeVariants("example.com", 8)
+		require.Equal(t, []lookalikeVariant{
+			{name: "xeample.com", technique: LookalikeSwap},
+			{name: "exarnple.com", technique: LookalikeConfusable},
+			{name: "xn--xample-2of.com", technique: LookalikeHomograph},
+			{name: "e-xample.com", technique: LookalikeHyphenation},
+			{name: "eaxmple.com", technique: LookalikeSwap},
+			{name: "examp1e.com", technique: LookalikeConfusable},
+			{name: "xn--eample-bsf.com", technique: LookalikeHomograph},
+			{name: "ex-ample.com", technique: LookalikeHyphenation},
+		}, variants)
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		variants := lookalikeVariants("example.com", 1000)
+		require.Less(t, len(variants), 1000)
+
+		seen := make(map[string]struct{})
+		for _, variant := range variants {
+			require.NotEqual(t, "example.com", variant.name)
+			require.NoError(t, ValidateDomain(variant.name), variant.name)
+
+			_, ok := seen[variant.name]
+			require.False(t, ok, "%s is repeated", variant.name)
+			seen[variant.name] = struct{}{}
+		}
+
+		require.Len(t, lookalikeVariants("example.com", 5), 5)
+	})
+
+	t.Run("RegisteredDomain", func(t *testing.T) {
+		// a subdomain's lookalikes are those of its registered domain, under its public suffix
+		for _, variant := range lookalikeVariants("Mail.My-Shop.co.uk.", 50) {
+			require.True(t, strings.HasSuffix(variant.name, ".co.uk"), variant.name)
+			require.NotContains(t, variant.name, "mail")
+		}
+
+		require.Contains(t, lookalikeVariants("my-shop.co.uk", 50), lookalikeVariant{name: "myshop.co.uk", technique: LookalikeHyphenation})
+	})
+
+	t.Run("None", func(t *testing.T) {
+		require.Empty(t, lookalikeVariants("xn--mnchen-3ya.de", 10))
+		require.Empty(t, lookalikeVariants("com", 10))
+	})
+}
+
+func TestScanner_Lookalikes(t *testing.T) {
+	record := func(rr string) dns.RR {
+		parsed, err := dns.NewRR(rr)
+		require.NoError(t, err)
+
+		return parsed
+	}
+
+	resolver := &zoneResolver{
+		records: map[string]map[uint16][]dns.RR{
+			"example.com.": {
+				dns.TypeNS: {record("example.com. 300 IN NS ns1.example.com.")},
+			},
+			"examp1e.com.": {
+				dns.TypeA:   {record("examp1e.com. 300 IN A 192.0.2.1")},
+				dns.TypeMX:  {record("examp1e.com. 300 IN MX 10 mx.examp1e.com.")},
+				dns.TypeTXT: {txt("examp1e.com.", "v=spf1 +all")},
+			},
+			"exarnple.com.": {
+				dns.TypeA: {record("exarnple.com. 300 IN A 192.0.2.2")},
+			},
+			"xn--xample-2of.com.": {
+				dns.TypeMX: {record("xn--xample-2of.com. 300 IN MX 10 mx.example.net.")},
+			},
+			// the name exists, but has no records
+			"e-xample.com.": {},
+		},
+		rcodes:   map[string]int{"xeample.com.": dns.RcodeServerFailure},
+		nxdomain: true,
+	}
+
+	scan := func(t *testing.T, opts ...Option) *Result {
+		t.Helper()
+
+		scanner, err := New(zerolog.Nop(), time.Second, append(opts, WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+
+		return results[0]
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		require.Nil(t, scan(t).Lookalikes)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		// lookalikes that fail to resolve are skipped, rather than failing the scan
+		result := scan(t, WithLookalikes(0))
+		require.Equal(t, []Lookalike{
+			{Name: "exarnple.com", Technique: LookalikeConfusable, Addresses: []string{"192.0.2.2"}},
+			{Name: "xn--xample-2of.com", Unicode: "еxample.com", Technique: LookalikeHomograph, MX: []string{"mx.example.net."}},
+			{Name: "examp1e.com", Technique: LookalikeConfusable, Addresses: []string{"192.0.2.1"}, MX: []string{"mx.examp1e.com."}, SPF: "v=spf1 +all"},
+		}, result.Lookalikes)
+		require.Contains(t, result.Timings, "lookalikes_lookup")
+	})
+
+	t.Run("NoneResolve", func(t *testing.T) {
+		// the lookup ran, but only checked lookalikes that don't resolve
+		result := scan(t, WithLookalikes(1))
+		require.NotNil(t, result.Lookalikes)
+		require.Empty(t, result.Lookalikes)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := New(zerolog.Nop(), time.Second, WithLookalikes(maxLookalikeLimit+1))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,48 @@
+package scanner
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// MTASTSPrefix starts every MTA-STS record (RFC 8461, section 3.1).
+const MTASTSPrefix = "v=STSv1"
+
+// WithMTASTS enables looking up each domain's MTA-STS record, at
+// _mta-sts.<domain>, so its MTA-STS policy can be evaluated against its MX
+// records. It's disabled by default, as the policy is then fetched from the
+// domain's web server, and its mail servers are probed with STARTTLS.
+func WithMTASTS() Option {
+	return func(s *Scanner) error {
+		s.mtaSTS = true
+		return nil
+	}
+}
+
+// getTypeMTASTS returns the MTA-STS records published for a domain. It
+// returns an empty, non-nil slice if there are none, so the result shows the
+// lookup ran. Every record is returned, as senders ignore them all if there's
+// more than one.
+func (s *Scanner) getTypeMTASTS(trace *lookupTrace, domain string) ([]string, error) {
+	answers, err := s.getDNSAnswers(trace, "_mta-sts."+domain, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]string, 0, 1)
+
+	for _, answer := range answers {
+		txt, ok := answer.(*dns.TXT)
+		if !ok {
+			continue
+		}
+
+		// TXT records can be split across multiple strings, so they're joined
+		if record := strings.Join(txt.Txt, ""); strings.HasPrefix(record, MTASTSPrefix) {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
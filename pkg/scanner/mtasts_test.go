@@ -0,0 +1,57 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_MTASTS(t *testing.T) {
+	scan := func(t *testing.T, records map[string]map[uint16][]dns.RR, opts ...Option) *Result {
+		t.Helper()
+
+		records["example.com."] = map[uint16][]dns.RR{dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}}}
+		resolver := &zoneResolver{records: records, nxdomain: true}
+
+		scanner, err := New(zerolog.Nop(), time.Second, append(opts, WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+
+		return results[0]
+	}
+
+	published := map[string]map[uint16][]dns.RR{
+		"_mta-sts.example.com.": {dns.TypeTXT: {
+			&dns.TXT{Hdr: dns.RR_Header{Name: "_mta-sts.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{"v=STSv1; ", "id=20240101"}},
+			txt("_mta-sts.example.com.", "google-site-verification=token"),
+		}},
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		require.Nil(t, scan(t, published).MTASTS)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		// the record's strings are joined, and other TXT records at the name are ignored
+		result := scan(t, published, WithMTASTS())
+		require.Equal(t, []string{"v=STSv1; id=20240101"}, result.MTASTS)
+		require.Contains(t, result.Timings, "mtasts_lookup")
+	})
+
+	t.Run("None", func(t *testing.T) {
+		// the lookup ran, but found no record
+		result := scan(t, map[string]map[uint16][]dns.RR{}, WithMTASTS())
+		require.NotNil(t, result.MTASTS)
+		require.Empty(t, result.MTASTS)
+	})
+}
@@ -57,7 +57,7 @@ func WithDKIMSelectors(selectors ...string) Option {
 
 		// validate DKIM selectors
 		for _, selector := range selectors {
-			if err := validateDKIMSelector(selector); err != nil {
+			if err := ValidateDKIMSelector(selector); err != nil {
 				return fmt.Errorf("invalid DKIM selector: %w", err)
 			}
 		}
@@ -68,7 +68,41 @@ func WithDKIMSelectors(selectors ...string) Option {
 	}
 }
 
-// WithDNSBuffer increases the allocated buffer for DNS responses.
+// WithOnlyDKIMSelectors allows the caller to specify the only DKIM selectors
+// to scan for, skipping the default selectors, in which case each result
+// reports whether a DKIM key was found at each of them. Use
+// ScanWithDKIMSelectors to do so for a single scan instead.
+func WithOnlyDKIMSelectors(selectors ...string) Option {
+	return func(s *Scanner) error {
+		if len(selectors) == 0 {
+			return errors.New("no DKIM selectors provided")
+		}
+
+		for _, selector := range selectors {
+			if err := ValidateDKIMSelector(selector); err != nil {
+				return fmt.Errorf("invalid DKIM selector: %w", err)
+			}
+		}
+
+		s.onlyDKIMSelectors = selectors
+
+		return nil
+	}
+}
+
+// WithoutDKIMDiscovery skips looking up DKIM keys at the known selectors
+// (and any given with WithDKIMSelectors), so each result reports its DKIM keys
+// as not checked, rather than as missing. Keys are still looked up at the
+// selectors given with WithOnlyDKIMSelectors or ScanWithDKIMSelectors.
+func WithoutDKIMDiscovery() Option {
+	return func(s *Scanner) error {
+		s.skipDKIMDiscovery = true
+		return nil
+	}
+}
+
+// WithDNSBuffer sets the EDNS0 buffer size advertised for UDP answers, which
+// defaults to DefaultDNSBuffer. Answers that exceed it are retried over TCP.
 func WithDNSBuffer(bufferSize uint16) Option {
 	return func(s *Scanner) error {
 		if bufferSize <= 0 {
@@ -97,6 +131,27 @@ func WithDNSProtocol(protocol string) Option {
 	}
 }
 
+// WithSourceAddress sends every DNS query from the given local address, such
+// as on a multi-homed host whose queries must come from a designated address.
+// It returns an error unless the address is assigned to the host (see
+// ParseSourceAddress). An empty address leaves the choice to the OS.
+func WithSourceAddress(address string) Option {
+	return func(s *Scanner) error {
+		if address == "" {
+			return nil
+		}
+
+		ip, err := ParseSourceAddress(address)
+		if err != nil {
+			return err
+		}
+
+		s.sourceAddress = ip
+
+		return nil
+	}
+}
+
 // WithNameservers allows the caller to provide a custom set of nameservers for
 // a *Scanner to use. If ns is nil, or zero-length, the *Scanner will use
 // the nameservers specified in /etc/resolv.conf.
@@ -158,7 +213,30 @@ func WithNameservers(nameservers []string) Option {
 	}
 }
 
-func validateDKIMSelector(selector string) error {
+// WithResolverMiddleware wraps the resolver used for every DNS query, such as
+// to record or instrument queries. The DNS client's protocol and buffer
+// options still apply to the wrapped resolver, regardless of option order.
+// The TCP resolver that truncated UDP answers are retried with is wrapped too.
+func WithResolverMiddleware(wrap func(next Resolver) Resolver) Option {
+	return func(s *Scanner) error {
+		if wrap == nil {
+			return errors.New("invalid resolver middleware")
+		}
+
+		resolver, tcpResolver := wrap(s.resolver), wrap(s.tcpResolver)
+		if resolver == nil || tcpResolver == nil {
+			return errors.New("resolver middleware returned a nil resolver")
+		}
+
+		s.resolver, s.tcpResolver = resolver, tcpResolver
+
+		return nil
+	}
+}
+
+// ValidateDKIMSelector checks that a DKIM selector is made of valid DNS
+// labels, without making any network requests.
+func ValidateDKIMSelector(selector string) error {
 	switch {
 	case len(selector) == 0:
 		return errors.New("DKIM selector is empty")
@@ -168,6 +246,8 @@ func validateDKIMSelector(selector string) error {
 		return fmt.Errorf("DKIM selector should not start with '%c'", selector[0])
 	case selector[len(selector)-1] == '.' || selector[len(selector)-1] == '_':
 		return fmt.Errorf("DKIM selector should not end with '%c'", selector[len(selector)-1])
+	case strings.Contains(selector, ".."):
+		return errors.New("DKIM selector has an empty label")
 	}
 
 	for i, char := range selector {
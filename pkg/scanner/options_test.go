@@ -94,6 +94,11 @@ func TestOptionWithDKIMSelectors(t *testing.T) {
 		require.ErrorContains(t, err, "can't exceed 63")
 	})
 
+	t.Run("InvalidDKIMSelectorEmptyLabel", func(t *testing.T) {
+		_, err := New(logger, timeout, WithDKIMSelectors("selector1.._google"))
+		require.ErrorContains(t, err, "DKIM selector has an empty label")
+	})
+
 	t.Run("EmptyDKIMSelector", func(t *testing.T) {
 		_, err := New(logger, timeout, WithDKIMSelectors(""))
 		require.ErrorContains(t, err, "DKIM selector is empty")
@@ -105,6 +110,32 @@ func TestOptionWithDKIMSelectors(t *testing.T) {
 	})
 }
 
+func TestOptionWithOnlyDKIMSelectors(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	scanner, err := New(logger, timeout, WithOnlyDKIMSelectors("mail2023"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"mail2023"}, scanner.onlyDKIMSelectors)
+	require.Nil(t, scanner.dkimSelectors)
+
+	_, err = New(logger, timeout, WithOnlyDKIMSelectors("mail 2023"))
+	require.ErrorContains(t, err, "DKIM selector has invalid character ' '")
+
+	_, err = New(logger, timeout, WithOnlyDKIMSelectors())
+	require.ErrorContains(t, err, "no DKIM selectors provided")
+}
+
+func TestOptionWithoutDKIMDiscovery(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	scanner, err := New(logger, timeout, WithoutDKIMDiscovery())
+	require.NoError(t, err)
+	require.True(t, scanner.skipDKIMDiscovery)
+	require.True(t, scanner.Config().SkipDKIMDiscovery)
+}
+
 func TestOptionWithDNSBuffer(t *testing.T) {
 	logger := zerolog.Nop()
 	timeout := time.Second * 5
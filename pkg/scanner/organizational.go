@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// RelationshipOrganizational is a domain that is its own organizational
+	// domain, registered directly below a public suffix (such as
+	// example.co.uk).
+	RelationshipOrganizational = "organizational"
+
+	// RelationshipSubdomain is a domain below its organizational domain (such
+	// as mail.eu.example.co.uk).
+	RelationshipSubdomain = "subdomain"
+
+	// RelationshipPublicSuffix is a domain that is itself a private entry of
+	// the public suffix list (such as github.io), operated by a company that
+	// lets others register names below it. Public suffixes operated by
+	// registries (such as co.uk) are rejected by ValidateDomain instead.
+	RelationshipPublicSuffix = "publicSuffix"
+)
+
+// Organizational relates a scanned domain to its organizational domain, as
+// DMARC defines it: the registered domain below its public suffix, whose
+// DMARC record covers its subdomains that don't publish their own.
+type Organizational struct {
+	Domain        string   `json:"domain" yaml:"domain" doc:"The domain's organizational domain, the registered domain below its public suffix (or the domain itself, if it's a public suffix)." example:"example.co.uk"`
+	PublicSuffix  string   `json:"publicSuffix" yaml:"publicSuffix" doc:"The public suffix the organizational domain is registered under, as listed by the public suffix list." example:"co.uk"`
+	PrivateSuffix bool     `json:"privateSuffix,omitempty" yaml:"privateSuffix,omitempty" doc:"Whether the public suffix is a private entry of the list (such as github.io), operated by a company rather than a registry."`
+	Relationship  string   `json:"relationship" yaml:"relationship" enum:"organizational,subdomain,publicSuffix" doc:"Whether the domain is its own organizational domain, a subdomain of it, or a private public suffix." example:"subdomain"`
+	DMARC         string   `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The organizational domain's DMARC record, only looked up for a subdomain without a DMARC record of its own, as its sp policy then applies to the subdomain." example:"v=DMARC1; p=reject; sp=quarantine"`
+	SPF           string   `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The organizational domain's SPF record, only looked up for a subdomain without an SPF record of its own, to tell whether it names the subdomain, which then appears to send mail." example:"v=spf1 include:marketing.example.co.uk -all"`
+	Published     []string `json:"published,omitempty" yaml:"published,omitempty" enum:"bimi,caa,dkim,dmarc,mx,spf" doc:"The records the domain publishes itself." example:"mx,spf"`
+	Inherited     []string `json:"inherited,omitempty" yaml:"inherited,omitempty" enum:"caa,dmarc" doc:"The records that apply to the domain without it publishing them: its organizational domain's DMARC record, and the CAA records of its closest parent that has any." example:"dmarc"`
+}
+
+// newOrganizational returns the organizational domain of a domain, using the
+// public suffix list, without its records.
+func newOrganizational(domain string) *Organizational {
+	domain = strings.TrimSuffix(domain, ".")
+
+	suffix, icann := publicsuffix.PublicSuffix(domain)
+	organizational := &Organizational{Domain: domain, PublicSuffix: suffix, PrivateSuffix: !icann}
+
+	switch registered, err := publicsuffix.EffectiveTLDPlusOne(domain); {
+	case err != nil:
+		organizational.Relationship = RelationshipPublicSuffix
+	case registered == domain:
+		organizational.Relationship = RelationshipOrganizational
+	default:
+		organizational.Domain = registered
+		organizational.Relationship = RelationshipSubdomain
+	}
+
+	return organizational
+}
+
+// isPublicSuffix reports whether the domain is a public suffix operated by a
+// registry (such as com or co.uk), including those matched by a wildcard entry
+// of the list (such as each name below kawasaki.jp).
+func isPublicSuffix(domain string) bool {
+	suffix, icann := publicsuffix.PublicSuffix(domain)
+
+	return icann && suffix == domain
+}
+
+// addRecords lists which of the result's records the domain publishes itself,
+// and which it inherits, where caaDomain is the domain its CAA records were
+// found at.
+func (o *Organizational) addRecords(result *Result, caaDomain string) {
+	published := []struct {
+		name  string
+		found bool
+	}{
+		{"bimi", result.BIMI != ""},
+		{"caa", len(result.CAA) > 0 && caaDomain == result.Domain},
+		{"dkim", result.DKIM != ""},
+		{"dmarc", result.DMARC != ""},
+		{"mx", len(result.MX) > 0},
+		{"spf", result.SPF != ""},
+	}
+
+	for _, record := range published {
+		if record.found {
+			o.Published = append(o.Published, record.name)
+		}
+	}
+
+	if len(result.CAA) > 0 && caaDomain != result.Domain {
+		o.Inherited = append(o.Inherited, "caa")
+	}
+
+	if result.DMARC == "" && o.DMARC != "" {
+		o.Inherited = append(o.Inherited, "dmarc")
+	}
+}
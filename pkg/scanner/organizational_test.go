@@ -0,0 +1,146 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOrganizational(t *testing.T) {
+	tests := []struct {
+		domain   string
+		expected Organizational
+	}{
+		{"example.co.uk", Organizational{Domain: "example.co.uk", PublicSuffix: "co.uk", Relationship: RelationshipOrganizational}},
+		{"mail.eu.example.co.uk", Organizational{Domain: "example.co.uk", PublicSuffix: "co.uk", Relationship: RelationshipSubdomain}},
+		{"example.com.", Organizational{Domain: "example.com", PublicSuffix: "com", Relationship: RelationshipOrganizational}},
+
+		// private entries of the list are operated by companies, which may send mail from them
+		{"github.io", Organizational{Domain: "github.io", PublicSuffix: "github.io", PrivateSuffix: true, Relationship: RelationshipPublicSuffix}},
+		{"user.github.io", Organizational{Domain: "user.github.io", PublicSuffix: "github.io", PrivateSuffix: true, Relationship: RelationshipOrganizational}},
+		{"www.user.github.io", Organizational{Domain: "user.github.io", PublicSuffix: "github.io", PrivateSuffix: true, Relationship: RelationshipSubdomain}},
+
+		// *.compute.amazonaws.com makes each region a public suffix, but not compute.amazonaws.com itself
+		{"compute.amazonaws.com", Organizational{Domain: "amazonaws.com", PublicSuffix: "com", Relationship: RelationshipSubdomain}},
+		{"eu-west-1.compute.amazonaws.com", Organizational{Domain: "eu-west-1.compute.amazonaws.com", PublicSuffix: "eu-west-1.compute.amazonaws.com", PrivateSuffix: true, Relationship: RelationshipPublicSuffix}},
+		{"ec2-192-0-2-1.eu-west-1.compute.amazonaws.com", Organizational{Domain: "ec2-192-0-2-1.eu-west-1.compute.amazonaws.com", PublicSuffix: "eu-west-1.compute.amazonaws.com", PrivateSuffix: true, Relationship: RelationshipOrganizational}},
+
+		// *.kawasaki.jp makes each name below it a public suffix, except for the !city.kawasaki.jp exception
+		{"city.kawasaki.jp", Organizational{Domain: "city.kawasaki.jp", PublicSuffix: "kawasaki.jp", Relationship: RelationshipOrganizational}},
+		{"example.nakahara.kawasaki.jp", Organizational{Domain: "example.nakahara.kawasaki.jp", PublicSuffix: "nakahara.kawasaki.jp", Relationship: RelationshipOrganizational}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.domain, func(t *testing.T) {
+			require.Equal(t, &test.expected, newOrganizational(test.domain))
+		})
+	}
+}
+
+func TestScanner_Organizational(t *testing.T) {
+	ns := func(name string) dns.RR {
+		return &dns.NS{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.co.uk."}
+	}
+
+	caa := &dns.CAA{Hdr: dns.RR_Header{Name: "example.co.uk.", Rrtype: dns.TypeCAA, Class: dns.ClassINET, Ttl: 300}, Tag: "issue", Value: "letsencrypt.org"}
+
+	resolver := &zoneResolver{
+		zone: "example.co.uk.",
+		records: map[string]map[uint16][]dns.RR{
+			"example.co.uk.": {
+				dns.TypeNS:  {ns("example.co.uk.")},
+				dns.TypeCAA: {caa},
+				dns.TypeTXT: {txt("example.co.uk.", "v=spf1 -all")},
+			},
+			"_dmarc.example.co.uk.": {
+				dns.TypeTXT: {txt("_dmarc.example.co.uk.", "v=DMARC1; p=reject; sp=quarantine")},
+			},
+			"mail.eu.example.co.uk.": {
+				dns.TypeMX:  {&dns.MX{Hdr: dns.RR_Header{Name: "mail.eu.example.co.uk.", Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 300}, Preference: 10, Mx: "mx.example.co.uk."}},
+				dns.TypeTXT: {txt("mail.eu.example.co.uk.", "v=spf1 mx -all")},
+			},
+			"bounce.example.co.uk.": {
+				dns.TypeMX:  {&dns.MX{Hdr: dns.RR_Header{Name: "bounce.example.co.uk.", Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 300}, Preference: 10, Mx: "mx.example.co.uk."}},
+				dns.TypeTXT: {txt("bounce.example.co.uk.", "google-site-verification=6m9HCXTu8nL2")},
+			},
+			"news.example.co.uk.": {
+				dns.TypeTXT: {txt("news.example.co.uk.", "v=spf1 -all")},
+			},
+			"_dmarc.news.example.co.uk.": {
+				dns.TypeTXT: {txt("_dmarc.news.example.co.uk.", "v=DMARC1; p=none")},
+			},
+		},
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver { return resolver }))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	scan := func(t *testing.T, domain string) *Result {
+		t.Helper()
+
+		results, err := scanner.Scan(domain)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+
+		return results[0]
+	}
+
+	t.Run("Organizational", func(t *testing.T) {
+		result := scan(t, "example.co.uk")
+		require.Equal(t, &Organizational{
+			Domain:       "example.co.uk",
+			PublicSuffix: "co.uk",
+			Relationship: RelationshipOrganizational,
+			Published:    []string{"caa", "dmarc", "spf"},
+		}, result.Organizational)
+		require.NotContains(t, result.Timings, "organizational_dmarc_lookup")
+	})
+
+	t.Run("Inherited", func(t *testing.T) {
+		result := scan(t, "mail.eu.example.co.uk")
+		require.Empty(t, result.DMARC)
+		require.Equal(t, &Organizational{
+			Domain:       "example.co.uk",
+			PublicSuffix: "co.uk",
+			Relationship: RelationshipSubdomain,
+			DMARC:        "v=DMARC1; p=reject; sp=quarantine",
+			Published:    []string{"mx", "spf"},
+			Inherited:    []string{"caa", "dmarc"},
+		}, result.Organizational)
+		require.Contains(t, result.Timings, "organizational_dmarc_lookup")
+		require.NotContains(t, result.Timings, "organizational_spf_lookup")
+	})
+
+	t.Run("InheritedSPF", func(t *testing.T) {
+		// the organizational domain's SPF record is looked up for a subdomain without its own
+		result := scan(t, "bounce.example.co.uk")
+		require.Empty(t, result.SPF)
+		require.Equal(t, "v=spf1 -all", result.Organizational.SPF)
+		require.Equal(t, []string{"mx"}, result.Organizational.Published)
+		require.Contains(t, result.Timings, "organizational_spf_lookup")
+	})
+
+	t.Run("OwnDMARC", func(t *testing.T) {
+		// the organizational domain's DMARC record isn't looked up for a subdomain with its own
+		result := scan(t, "news.example.co.uk")
+		require.Equal(t, &Organizational{
+			Domain:       "example.co.uk",
+			PublicSuffix: "co.uk",
+			Relationship: RelationshipSubdomain,
+			Published:    []string{"dmarc", "spf"},
+			Inherited:    []string{"caa"},
+		}, result.Organizational)
+	})
+
+	t.Run("PublicSuffix", func(t *testing.T) {
+		results, err := scanner.Scan("co.uk")
+		require.NoError(t, err)
+		require.Equal(t, ErrInvalidDomain, results[0].Error)
+		require.Nil(t, results[0].Organizational)
+	})
+}
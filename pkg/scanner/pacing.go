@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+type (
+	// zonePacer paces the queries for the names of each zone, so a scan of
+	// many names under one zone (such as its sending subdomains, or several of
+	// its subdomains in a bulk scan) doesn't burst against the zone's
+	// authoritative servers, which some providers throttle by answering
+	// SERVFAIL.
+	zonePacer struct {
+		// interval is the minimum time between the start of two queries for the same zone, if any.
+		interval time.Duration
+
+		// inFlight is the maximum number of queries in flight for the same zone at once, if any.
+		inFlight int
+
+		// mutex guards zones.
+		mutex sync.Mutex
+
+		// zones holds the pacing of each zone queried recently, keyed by zone.
+		zones map[string]*zonePacing
+	}
+
+	// zonePacing is the pacing of a single zone's queries.
+	zonePacing struct {
+		// slots holds a token for each query in flight, if in-flight queries are capped.
+		slots chan struct{}
+
+		// next is when the zone's next query may start.
+		next time.Time
+
+		// queries is the number of queries waiting or in flight, so idle zones can be dropped.
+		queries int
+	}
+)
+
+// WithZonePacing paces the queries for the names under each zone, grouped
+// by organizational domain (such as example.com for em.example.com and
+// selector1._domainkey.example.com), so at most qps of them start each
+// second, and at most inFlight are in flight at once. A qps or inFlight of 0
+// leaves that unbounded. Queries wait their turn rather than failing, and
+// the time each lookup waited is included in the result's timings, as
+// "<lookup>_throttle". It's disabled by default.
+func WithZonePacing(qps float64, inFlight int) Option {
+	return func(s *Scanner) error {
+		if qps < 0 || inFlight < 0 {
+			return errors.New("zone pacing must not be negative")
+		}
+
+		if qps == 0 && inFlight == 0 {
+			s.pacer = nil
+			return nil
+		}
+
+		s.pacer = &zonePacer{inFlight: inFlight, zones: make(map[string]*zonePacing)}
+		if qps > 0 {
+			s.pacer.interval = time.Duration(float64(time.Second) / qps)
+		}
+
+		return nil
+	}
+}
+
+// wait blocks until a query for the name may start, returning how long it
+// waited, and the function to call once the query has been answered.
+func (p *zonePacer) wait(name string) (time.Duration, func()) {
+	start := time.Now()
+	zone := pacingZone(name)
+
+	p.mutex.Lock()
+	pacing, ok := p.zones[zone]
+	if !ok {
+		// the idle zones whose turn has passed would pace their next query as a new zone does, so they're dropped
+		for name, idle := range p.zones {
+			if idle.queries == 0 && !start.Before(idle.next) {
+				delete(p.zones, name)
+			}
+		}
+
+		pacing = &zonePacing{}
+		if p.inFlight > 0 {
+			pacing.slots = make(chan struct{}, p.inFlight)
+		}
+
+		p.zones[zone] = pacing
+	}
+
+	pacing.queries++
+	p.mutex.Unlock()
+
+	if pacing.slots != nil {
+		pacing.slots <- struct{}{}
+	}
+
+	// the query is scheduled once it has a slot, so queries waiting for one don't claim its turn
+	if p.interval > 0 {
+		p.mutex.Lock()
+		at := time.Now()
+		if at.Before(pacing.next) {
+			at = pacing.next
+		}
+
+		pacing.next = at.Add(p.interval)
+		p.mutex.Unlock()
+
+		time.Sleep(time.Until(at))
+	}
+
+	release := func() {
+		if pacing.slots != nil {
+			<-pacing.slots
+		}
+
+		p.mutex.Lock()
+		pacing.queries--
+		p.mutex.Unlock()
+	}
+
+	return time.Since(start), release
+}
+
+// pacingZone returns the zone a name's queries are paced by: its
+// organizational domain, or the name itself if it has none (such as a public
+// suffix).
+func pacingZone(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if zone, err := publicsuffix.EffectiveTLDPlusOne(name); err == nil {
+		return zone
+	}
+
+	return name
+}
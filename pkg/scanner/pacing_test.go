@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// throttlingResolver answers SERVFAIL to any query for a zone that has already had limit queries within the window,
+// as some providers' authoritative servers do.
+type throttlingResolver struct {
+	next   Resolver
+	window time.Duration
+	limit  int
+
+	mutex   sync.Mutex
+	queries map[string][]time.Time
+}
+
+func (r *throttlingResolver) Exchange(msg *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	zone := pacingZone(msg.Question[0].Name)
+	now := time.Now()
+
+	r.mutex.Lock()
+	recent := r.queries[zone][:0]
+	for _, at := range r.queries[zone] {
+		if now.Sub(at) < r.window {
+			recent = append(recent, at)
+		}
+	}
+
+	r.queries[zone] = append(recent, now)
+	throttled := len(recent) >= r.limit
+	r.mutex.Unlock()
+
+	if throttled {
+		reply := new(dns.Msg)
+		reply.SetRcode(msg, dns.RcodeServerFailure)
+
+		return reply, 0, nil
+	}
+
+	return r.next.Exchange(msg, address)
+}
+
+func TestScanner_ZonePacing(t *testing.T) {
+	domains := []string{"a.example.com", "b.example.com", "c.example.com"}
+
+	records := make(map[string]map[uint16][]dns.RR, len(domains))
+	for _, domain := range domains {
+		records[domain+"."] = map[uint16][]dns.RR{
+			dns.TypeNS:  {&dns.NS{Hdr: dns.RR_Header{Name: domain + ".", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}},
+			dns.TypeTXT: {txt(domain+".", "v=spf1 -all")},
+		}
+	}
+
+	scan := func(t *testing.T, opts ...Option) []*Result {
+		t.Helper()
+
+		resolver := &throttlingResolver{
+			next:    &zoneResolver{zone: "example.com.", records: records},
+			window:  50 * time.Millisecond,
+			limit:   8,
+			queries: make(map[string][]time.Time),
+		}
+
+		opts = append(opts, WithConcurrentScans(3), WithResolverMiddleware(func(Resolver) Resolver { return resolver }))
+
+		scanner, err := New(zerolog.Nop(), time.Second, opts...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.Scan(domains...)
+		require.NoError(t, err)
+		require.Len(t, results, len(domains))
+
+		return results
+	}
+
+	t.Run("Unpaced", func(t *testing.T) {
+		// the throttled lookups fail, or the domain looks invalid if its NS lookup was throttled
+		throttled := false
+		for _, result := range scan(t) {
+			throttled = throttled || len(result.Errors) > 0 || result.Error != ""
+		}
+
+		require.True(t, throttled, "expected the burst of queries to be throttled")
+	})
+
+	t.Run("Paced", func(t *testing.T) {
+		waited := false
+		for _, result := range scan(t, WithZonePacing(100, 4)) {
+			require.Empty(t, result.Errors)
+			require.Empty(t, result.Error)
+
+			for name := range result.Timings {
+				waited = waited || strings.HasSuffix(name, "_throttle")
+			}
+		}
+
+		require.True(t, waited, "expected the paced lookups' waits in their timings")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := New(zerolog.Nop(), time.Second, WithZonePacing(-1, 0))
+		require.Error(t, err)
+	})
+}
+
+func TestPacingZone(t *testing.T) {
+	for name, expected := range map[string]string{
+		"selector1._domainkey.Example.com.": "example.com",
+		"em.example.co.uk":                  "example.co.uk",
+		"2.0.0.127.zen.spamhaus.org":        "spamhaus.org",
+		"com":                               "com",
+	} {
+		require.Equal(t, expected, pacingZone(name), name)
+	}
+}
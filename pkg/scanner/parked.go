@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"math"
+	"strings"
+)
+
+// parkingNameservers are the nameserver domains of common domain parking
+// services.
+var parkingNameservers = []string{
+	"above.com",
+	"afternic.com",
+	"bodis.com",
+	"dan.com",
+	"parkingcrew.net",
+	"parklogic.com",
+	"sedoparking.com",
+}
+
+// ParkedAssessment is the outcome of checking whether a domain is likely to be
+// parked (registered, but not used to send or receive mail).
+type ParkedAssessment struct {
+	Likely     bool     `json:"likely" yaml:"likely" doc:"Whether the domain is likely to be parked."`
+	Confidence float64  `json:"confidence" yaml:"confidence" doc:"How confident the assessment is, between 0 and 1." example:"0.9"`
+	Signals    []string `json:"signals,omitempty" yaml:"signals,omitempty" doc:"The signals that indicate the domain is parked." example:"null MX record"`
+}
+
+// assessParked checks a scan result for the signs of a parked domain. A domain
+// is likely to be parked if all of the following are true:
+//
+//   - it has no MX records, or only a null MX record (RFC 7505)
+//   - it has no A or AAAA records, or its nameservers belong to a parking service
+//   - it has no SPF record, or one that only contains -all
+//
+// Each signal adds to the confidence, with explicit lockdown records (a null
+// MX or v=spf1 -all) counting for more than missing records.
+func assessParked(result *Result) *ParkedAssessment {
+	assessment := &ParkedAssessment{}
+
+	var confidence float64
+	var mailSignal, webSignal, spfSignal bool
+
+	switch {
+	case len(result.MX) == 0:
+		mailSignal = true
+		confidence += 0.3
+		assessment.Signals = append(assessment.Signals, "no MX records")
+	case len(result.MX) == 1 && strings.TrimSpace(result.MX[0]) == ".":
+		mailSignal = true
+		confidence += 0.4
+		assessment.Signals = append(assessment.Signals, "null MX record")
+	}
+
+	if len(result.Addresses) == 0 {
+		webSignal = true
+		confidence += 0.25
+		assessment.Signals = append(assessment.Signals, "no A or AAAA records")
+	}
+
+	if provider := parkingProvider(result.NS); provider != "" {
+		webSignal = true
+		confidence += 0.3
+		assessment.Signals = append(assessment.Signals, "nameservers belong to the parking service "+provider)
+	}
+
+	switch strings.Join(strings.Fields(result.SPF), " ") {
+	case "":
+		spfSignal = true
+		confidence += 0.15
+		assessment.Signals = append(assessment.Signals, "no SPF record")
+	case "v=spf1 -all":
+		spfSignal = true
+		confidence += 0.3
+		assessment.Signals = append(assessment.Signals, "SPF record only contains -all")
+	}
+
+	assessment.Likely = mailSignal && webSignal && spfSignal
+	assessment.Confidence = math.Min(1, math.Round(confidence*100)/100)
+
+	return assessment
+}
+
+// parkingProvider returns the parking service hosting any of the given
+// nameservers, if any.
+func parkingProvider(nameservers []string) string {
+	for _, nameserver := range nameservers {
+		nameserver = strings.ToLower(strings.TrimSuffix(nameserver, "."))
+
+		for _, provider := range parkingNameservers {
+			if nameserver == provider || strings.HasSuffix(nameserver, "."+provider) {
+				return provider
+			}
+		}
+	}
+
+	return ""
+}
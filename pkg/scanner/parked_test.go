@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssessParked(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     Result
+		likely     bool
+		confidence float64
+		signals    []string
+	}{
+		{
+			name:       "LockedDown",
+			result:     Result{MX: []string{"."}, SPF: "v=spf1  -all"},
+			likely:     true,
+			confidence: 0.95,
+			signals:    []string{"null MX record", "no A or AAAA records", "SPF record only contains -all"},
+		},
+		{
+			name:       "ParkingService",
+			result:     Result{Addresses: []string{"192.0.2.1"}, NS: []string{"ns1.sedoparking.com."}},
+			likely:     true,
+			confidence: 0.75,
+			signals:    []string{"no MX records", "nameservers belong to the parking service sedoparking.com", "no SPF record"},
+		},
+		{
+			name:       "Website",
+			result:     Result{Addresses: []string{"192.0.2.1"}, NS: []string{"ns1.example.com."}, SPF: "v=spf1 -all"},
+			confidence: 0.6,
+			signals:    []string{"no MX records", "SPF record only contains -all"},
+		},
+		{
+			name:       "SendsMail",
+			result:     Result{MX: []string{"mx1.example.com."}, SPF: "v=spf1 include:_spf.example.net -all"},
+			confidence: 0.25,
+			signals:    []string{"no A or AAAA records"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assessment := assessParked(&test.result)
+			require.Equal(t, test.likely, assessment.Likely)
+			require.Equal(t, test.confidence, assessment.Confidence)
+			require.Equal(t, test.signals, assessment.Signals)
+		})
+	}
+}
+
+func TestParkingProvider(t *testing.T) {
+	require.Equal(t, "bodis.com", parkingProvider([]string{"ns1.example.com.", "NS2.BODIS.COM."}))
+	require.Empty(t, parkingProvider([]string{"ns1.notbodis.com."}))
+}
@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// answered records the response code the name was answered with, keyed by
+// the name in lowercase, as DNS names are case-insensitive.
+func (t *lookupTrace) answered(name string, rcode int) {
+	if t == nil {
+		return
+	}
+
+	if t.rcodes == nil {
+		t.rcodes = make(map[string]int)
+	}
+
+	t.rcodes[strings.ToLower(dns.Fqdn(name))] = rcode
+}
+
+// rcode returns the name of the response code the name was answered with, or
+// "" if it wasn't queried.
+func (t *lookupTrace) rcode(name string) string {
+	rcode, ok := t.rcodes[strings.ToLower(dns.Fqdn(name))]
+	if !ok {
+		return ""
+	}
+
+	return dns.RcodeToString[rcode]
+}
+
+// rcodeUnder returns the name of the response code that best explains why
+// none of the names queried under the parent held a record: a failure if any
+// failed (as their records may exist), NOERROR if any exist without one, and
+// otherwise NXDOMAIN. It returns "" if none were queried.
+func (t *lookupTrace) rcodeUnder(parent string) string {
+	suffix := "." + strings.ToLower(dns.Fqdn(parent))
+	best := -1
+
+	for name, rcode := range t.rcodes {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		switch {
+		case rcode != dns.RcodeSuccess && rcode != dns.RcodeNameError:
+			return dns.RcodeToString[rcode]
+		case rcode == dns.RcodeSuccess || best == -1:
+			best = rcode
+		}
+	}
+
+	if best == -1 {
+		return ""
+	}
+
+	return dns.RcodeToString[best]
+}
@@ -0,0 +1,59 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_Rcodes(t *testing.T) {
+	ns := func(name string) map[uint16][]dns.RR {
+		return map[uint16][]dns.RR{dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1." + name}}}
+	}
+
+	resolver := &zoneResolver{
+		records: map[string]map[uint16][]dns.RR{
+			"example.com.": ns("example.com."),
+			"example.org.": ns("example.org."),
+			"example.net.": ns("example.net."),
+
+			// exists, but only with records of other types
+			"default._bimi.example.com.":     {dns.TypeCNAME: {&dns.CNAME{Hdr: dns.RR_Header{Name: "default._bimi.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300}, Target: "bimi.example.net."}}},
+			"google._domainkey.example.org.": {dns.TypeCNAME: {&dns.CNAME{Hdr: dns.RR_Header{Name: "google._domainkey.example.org.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300}, Target: "dkim.example.net."}}},
+
+			"_dmarc.example.net.":            {dns.TypeTXT: {txt("_dmarc.example.net.", "v=DMARC1; p=reject")}},
+			"google._domainkey.example.net.": {dns.TypeTXT: {txt("google._domainkey.example.net.", "v=DKIM1; k=rsa; p=KEY")}},
+			"default._bimi.example.net.":     {dns.TypeTXT: {txt("default._bimi.example.net.", "v=BIMI1; l=https://example.net/logo.svg")}},
+		},
+		rcodes: map[string]int{
+			// as a resolver answers when the zone's DNSSEC signatures don't validate
+			"_dmarc.example.com.":               dns.RcodeServerFailure,
+			"selector1._domainkey.example.org.": dns.RcodeServerFailure,
+		},
+		nxdomain: true,
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	results, err := scanner.Scan("example.com", "example.org", "example.net")
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	require.Equal(t, map[string]string{"bimi": "NOERROR", "dkim": "NXDOMAIN", "dmarc": "SERVFAIL"}, results[0].Rcodes)
+	require.Contains(t, results[0].Error, "dmarc:DNS query failed with rcode 2")
+
+	// a failing selector takes precedence over one that exists without a key,
+	// as its key may well be published
+	require.Equal(t, map[string]string{"bimi": "NXDOMAIN", "dkim": "SERVFAIL", "dmarc": "NXDOMAIN"}, results[1].Rcodes)
+
+	// the lookups that found a record have no response code to explain
+	require.Empty(t, results[2].Error)
+	require.Nil(t, results[2].Rcodes)
+}
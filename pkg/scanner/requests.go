@@ -1,9 +1,13 @@
 package scanner
 
 import (
+	"bytes"
 	"fmt"
+	"math/rand/v2"
+	"sort"
 	"strings"
 
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
 	"github.com/miekg/dns"
 )
 
@@ -35,20 +39,47 @@ var (
 		"dkim",          // Hetzner
 		"mxvault",       // MxVault
 	}
+
+	// knownArcSelectors is a list of known ARC sealing key selectors. ARC
+	// sealing keys are published as DKIM key records.
+	knownArcSelectors = []string{
+		"arc",              // Generic, such as OpenARC
+		"arc-20160816",     // Google
+		"arc-20240605",     // Google
+		"arcselector9901",  // Microsoft
+		"arcselector10001", // Microsoft
+	}
 )
 
 // getDNSRecords queries the DNS server for records of a specific type for a domain.
 // It returns a slice of strings (the records) and an error if any occurred.
-func (s *Scanner) getDNSRecords(domain string, recordType uint16) (records []string, err error) {
-	answers, err := s.getDNSAnswers(domain, recordType)
+// CNAME answers are followed to their target's records, if the resolver
+// didn't already include them.
+// Addresses and MX records are sorted (see sortAnswers), so the records are
+// in the same order for every query.
+func (s *Scanner) getDNSRecords(trace *lookupTrace, domain string, recordType uint16) (records []string, err error) {
+	answers, err := s.getDNSAnswers(trace, domain, recordType)
 	if err != nil {
 		return nil, err
 	}
 
+	sortAnswers(answers)
+
+	// resolvers that follow a CNAME answer with its target's records too, in
+	// which case the target isn't looked up again (which would repeat them)
+	answered := make(map[string]struct{}, len(answers))
+	for _, answer := range answers {
+		answered[strings.ToLower(dns.Fqdn(answer.Header().Name))] = struct{}{}
+	}
+
 	for _, answer := range answers {
 		if answer.Header().Rrtype == dns.TypeCNAME {
 			if t, ok := answer.(*dns.CNAME); ok {
-				recursiveLookupTxt, err := s.getDNSRecords(t.Target, recordType)
+				if _, ok = answered[strings.ToLower(dns.Fqdn(t.Target))]; ok {
+					continue
+				}
+
+				recursiveLookupTxt, err := s.getDNSRecords(trace, t.Target, recordType)
 				if err != nil {
 					return nil, fmt.Errorf("failed to recursively lookup txt record for %v: %w", t.Target, err)
 				}
@@ -66,6 +97,8 @@ func (s *Scanner) getDNSRecords(domain string, recordType uint16) (records []str
 			records = append(records, dnsRec.A.String())
 		case *dns.AAAA:
 			records = append(records, dnsRec.AAAA.String())
+		case *dns.CAA:
+			records = append(records, fmt.Sprintf("%d %s %q", dnsRec.Flag, dnsRec.Tag, dnsRec.Value))
 		case *dns.MX:
 			records = append(records, dnsRec.Mx)
 		case *dns.NS:
@@ -78,20 +111,54 @@ func (s *Scanner) getDNSRecords(domain string, recordType uint16) (records []str
 	return records, nil
 }
 
+// sortAnswers sorts A and AAAA answers by address, and MX answers by
+// preference, then host, as nameservers may return them in any order (such as
+// round robin). Any other answers, such as CNAME records, are kept first.
+func sortAnswers(answers []dns.RR) {
+	sort.SliceStable(answers, func(i, j int) bool {
+		switch left := answers[i].(type) {
+		case *dns.A:
+			right, ok := answers[j].(*dns.A)
+			return ok && bytes.Compare(left.A.To16(), right.A.To16()) < 0
+		case *dns.AAAA:
+			right, ok := answers[j].(*dns.AAAA)
+			return ok && bytes.Compare(left.AAAA.To16(), right.AAAA.To16()) < 0
+		case *dns.MX:
+			right, ok := answers[j].(*dns.MX)
+			if !ok {
+				return false
+			}
+
+			if left.Preference != right.Preference {
+				return left.Preference < right.Preference
+			}
+
+			return strings.ToLower(left.Mx) < strings.ToLower(right.Mx)
+		}
+
+		switch answers[j].(type) {
+		case *dns.A, *dns.AAAA, *dns.MX:
+			return true
+		}
+
+		return false
+	})
+}
+
 // getDNSAnswers queries the DNS server for answers to a specific question.
 // It returns a slice of dns.RR (DNS resource records) and an error if any occurred.
-func (s *Scanner) getDNSAnswers(domain string, recordType uint16) ([]dns.RR, error) {
-	req := &dns.Msg{}
-	req.Id = dns.Id()
-	req.RecursionDesired = true
-	req.SetEdns0(s.dnsBuffer, true) // increases the response buffer size
-	req.SetQuestion(dns.Fqdn(domain), recordType)
-
-	in, _, err := s.dnsClient.Exchange(req, s.getNS())
+// A truncated UDP answer is retried over TCP, which is recorded in the trace
+// (if any), as a truncated answer is only part of the records. Answers that
+// exceed the scanner's limits return an error (see checkAnswerLimits).
+func (s *Scanner) getDNSAnswers(trace *lookupTrace, domain string, recordType uint16) ([]dns.RR, error) {
+	in, err := s.query(trace, s.getNS(), domain, recordType, true)
 	if err != nil {
 		return nil, err
 	}
 
+	trace.answered(domain, in.Rcode)
+	trace.aliased(in.Answer)
+
 	if in.Rcode != dns.RcodeSuccess {
 		// disregard NXDOMAIN errors
 		if in.Rcode == dns.RcodeNameError {
@@ -101,109 +168,417 @@ func (s *Scanner) getDNSAnswers(domain string, recordType uint16) ([]dns.RR, err
 		return nil, fmt.Errorf("DNS query failed with rcode %v", in.Rcode)
 	}
 
-	if in.MsgHdr.Truncated && s.dnsBuffer < 4096 {
-		s.logger.Warn().Msg(fmt.Sprintf("DNS buffer %v was too small for %v, retrying with larger buffer (4096)", s.dnsBuffer, domain))
+	if in.Truncated {
+		return nil, fmt.Errorf("DNS answer for %v was truncated", domain)
+	}
 
-		req.SetEdns0(4096, true)
+	if err = s.checkAnswerLimits(trace, domain, in.Answer); err != nil {
+		return nil, err
+	}
 
-		in, _, err = s.dnsClient.Exchange(req, s.getNS())
-		if err != nil {
-			return nil, err
+	return in.Answer, nil
+}
+
+// query sends a single question to the DNS server at the address, asking it
+// to recurse if recursive is set, once its zone's pacing allows (see
+// WithZonePacing). A truncated UDP answer is retried over TCP to the same
+// server, which is recorded in the trace (if any). It isn't sent once the
+// trace's context is done, failing with its error instead.
+func (s *Scanner) query(trace *lookupTrace, address, domain string, recordType uint16, recursive bool) (*dns.Msg, error) {
+	if err := trace.err(); err != nil {
+		return nil, err
+	}
+
+	req := &dns.Msg{}
+	req.Id = dns.Id()
+	req.RecursionDesired = recursive
+	req.SetEdns0(s.dnsBuffer, true) // advertises the response buffer size
+	req.SetQuestion(dns.Fqdn(domain), recordType)
+
+	if s.pacer != nil {
+		waited, release := s.pacer.wait(domain)
+		defer release()
+
+		if trace != nil {
+			trace.throttled += waited
 		}
 	}
 
-	return in.Answer, nil
+	// the pacing may have waited past the end of the context
+	if err := trace.err(); err != nil {
+		return nil, err
+	}
+
+	in, _, err := s.resolver.Exchange(req, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Truncated && s.dnsClient.Net == "udp" {
+		s.logger.Debug().Msg(fmt.Sprintf("DNS answer for %v didn't fit the %v byte buffer, retrying over TCP", domain, s.dnsBuffer))
+
+		if in, _, err = s.tcpResolver.Exchange(req, address); err != nil {
+			return nil, fmt.Errorf("failed to retry truncated answer over TCP: %w", err)
+		}
+
+		if trace != nil {
+			trace.tcp = true
+		}
+	}
+
+	return in, nil
 }
 
-func (s *Scanner) getTypeBIMI(domain string) (string, error) {
+func (s *Scanner) getTypeBIMI(trace *lookupTrace, domain string) (string, error) {
 	for _, dname := range []string{
 		"default._bimi." + domain,
 		domain,
 	} {
-		records, err := s.getDNSRecords(dname, dns.TypeTXT)
+		records, err := s.getDNSRecords(trace, dname, dns.TypeTXT)
 		if err != nil {
 			return "", err
 		}
 
-		for index, record := range records {
-			if strings.HasPrefix(record, BIMIPrefix) {
-				// TXT records can be split across multiple strings, so we need to join them
-				return strings.Join(records[index:], ""), nil
-			}
+		if record := findRecord(records, BIMIPrefix, lookalike.BIMI); record != "" {
+			return record, nil
 		}
 	}
 
 	return "", nil
 }
 
+// getTypeCAA returns the CAA records that apply to a domain, formatted as
+// "<flags> <tag> <value>", along with the domain they were found at. As CAs
+// do before issuing (RFC 8659), a domain without CAA records inherits those
+// of its closest parent, up to but excluding the TLD.
+func (s *Scanner) getTypeCAA(trace *lookupTrace, domain string) ([]string, string, error) {
+	for name := strings.TrimSuffix(domain, "."); strings.Contains(name, "."); _, name, _ = strings.Cut(name, ".") {
+		records, err := s.getDNSRecords(trace, name, dns.TypeCAA)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if len(records) > 0 {
+			return records, name, nil
+		}
+	}
+
+	return nil, "", nil
+}
+
 // getTypeDKIM queries the DNS server for DKIM records of a domain.
-// It returns a string (DKIM record) and an error if any occurred.
-func (s *Scanner) getTypeDKIM(domain string) (string, error) {
-	selectors := append(s.dkimSelectors, knownDkimSelectors...)
+// It returns the selector the record was found at, a string (DKIM record),
+// whether the only answers came from a wildcard TXT record and an error if
+// any occurred.
+func (s *Scanner) getTypeDKIM(trace *lookupTrace, domain string) (string, string, bool, error) {
+	return s.findDomainKey(trace, domain, append(s.dkimSelectors, knownDkimSelectors...))
+}
+
+// getDKIMKeys queries the DNS server for the DKIM records of a domain at every
+// selector, as a domain may publish keys of different algorithms (such as RSA
+// and Ed25519) at different selectors. It returns the keys in the order of the
+// selectors, and whether the only answers came from a wildcard TXT record.
+func (s *Scanner) getDKIMKeys(trace *lookupTrace, domain string) ([]DKIMKey, bool, error) {
+	return s.findDomainKeys(trace, domain, append(s.dkimSelectors, knownDkimSelectors...), true)
+}
+
+// getDKIMSelectorKeys queries the DNS server for the DKIM records of a domain
+// at only the given selectors, as getDKIMKeys does, also returning whether a
+// key was found at each of them, unless a lookup failed.
+func (s *Scanner) getDKIMSelectorKeys(trace *lookupTrace, domain string, selectors []string) ([]DKIMKey, bool, []DKIMSelectorCheck, error) {
+	keys, wildcard, err := s.findDomainKeys(trace, domain, selectors, true)
+	if err != nil {
+		return keys, false, nil, err
+	}
+
+	found := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		found[key.Selector] = struct{}{}
+	}
+
+	checks := make([]DKIMSelectorCheck, 0, len(selectors))
+	seen := make(map[string]struct{}, len(selectors))
 
 	for _, selector := range selectors {
-		records, err := s.getDNSRecords(selector+"._domainkey."+domain, dns.TypeTXT)
+		if _, ok := seen[selector]; ok {
+			continue
+		}
+
+		seen[selector] = struct{}{}
+
+		_, ok := found[selector]
+		checks = append(checks, DKIMSelectorCheck{Selector: selector, Found: ok})
+	}
+
+	return keys, wildcard, checks, nil
+}
+
+// getTypeARC queries the DNS server for ARC sealing keys of a domain.
+// It returns the selector the key was found at, a string (the key record) and
+// an error if any occurred.
+func (s *Scanner) getTypeARC(trace *lookupTrace, domain string) (string, string, error) {
+	selector, record, _, err := s.findDomainKey(trace, domain, knownArcSelectors)
+	return selector, record, err
+}
+
+// findDomainKey returns the first of the selectors with a DKIM key record for
+// the domain. A record that only looks like a key is skipped if it's the
+// domain's wildcard answer, in which case wildcard is true if no other
+// selector has a key.
+func (s *Scanner) findDomainKey(trace *lookupTrace, domain string, selectors []string) (string, string, bool, error) {
+	keys, wildcard, err := s.findDomainKeys(trace, domain, selectors, false)
+	if err != nil || len(keys) == 0 {
+		return "", "", wildcard, err
+	}
+
+	return keys[0].Selector, keys[0].Record, false, nil
+}
+
+// findDomainKeys returns the DKIM key records of the domain at the selectors,
+// stopping at the first unless all is true. Wildcard answers are handled as
+// in findDomainKey. If a lookup fails, the keys found before it are returned
+// with its error, as the remaining selectors are likely to fail the same way.
+func (s *Scanner) findDomainKeys(trace *lookupTrace, domain string, selectors []string, all bool) ([]DKIMKey, bool, error) {
+	var (
+		answer   []string
+		keys     []DKIMKey
+		probed   bool
+		wildcard bool
+	)
+
+	seen := make(map[string]struct{}, len(selectors))
+
+	for _, selector := range selectors {
+		// custom selectors may repeat known ones
+		if _, ok := seen[selector]; ok {
+			continue
+		}
+
+		seen[selector] = struct{}{}
+
+		records, err := s.getDNSRecords(trace, selector+"._domainkey."+domain, dns.TypeTXT)
 		if err != nil {
-			return "", err
+			return keys, false, err
+		}
+
+		segments := findRecordSegments(records, DKIMPrefix, lookalike.DKIM)
+		if len(segments) == 0 {
+			continue
 		}
 
-		for index, record := range records {
-			if strings.HasPrefix(record, DKIMPrefix) {
-				// TXT records can be split across multiple strings, so we need to join them
-				return strings.Join(records[index:], ""), nil
+		record := strings.Join(segments, "")
+
+		if !strings.HasPrefix(record, DKIMPrefix) {
+			// every selector shares the same wildcard, so it's only probed once
+			if !probed {
+				if answer, err = s.getWildcardRecords("_domainkey." + domain); err != nil {
+					return keys, false, err
+				}
+
+				probed = true
+			}
+
+			if isWildcardAnswer(answer, records) {
+				wildcard = true
+				continue
 			}
 		}
+
+		keys = append(keys, DKIMKey{Selector: selector, Record: record, Segments: segmentLengths(segments)})
+
+		if !all {
+			break
+		}
 	}
 
-	return "", nil
+	return keys, wildcard && len(keys) == 0, nil
 }
 
 // getTypeDMARC queries the DNS server for DMARC records of a domain.
-// It returns a string (DMARC record) and an error if any occurred.
-func (s *Scanner) getTypeDMARC(domain string) (string, error) {
+// It returns a string (DMARC record), whether the only answer came from a
+// wildcard TXT record and an error if any occurred.
+func (s *Scanner) getTypeDMARC(trace *lookupTrace, domain string) (string, bool, error) {
+	var wildcard bool
+
 	for _, dname := range []string{
 		"_dmarc." + domain,
 		domain,
 	} {
-		records, err := s.getDNSRecords(dname, dns.TypeTXT)
+		records, err := s.getDNSRecords(trace, dname, dns.TypeTXT)
 		if err != nil {
-			return "", err
+			return "", false, err
 		}
 
-		for index, record := range records {
-			if strings.HasPrefix(record, DMARCPrefix) {
-				// TXT records can be split across multiple strings, so we need to join them
-				return strings.Join(records[index:], ""), nil
+		record := findRecord(records, DMARCPrefix, lookalike.DMARC)
+		if record == "" {
+			continue
+		}
+
+		// the domain's own records can't be synthesized from its wildcard
+		if dname != domain && !strings.HasPrefix(record, DMARCPrefix) {
+			answer, err := s.getWildcardRecords(domain)
+			if err != nil {
+				return "", false, err
+			}
+
+			if isWildcardAnswer(answer, records) {
+				wildcard = true
+				continue
 			}
 		}
+
+		return record, false, nil
 	}
 
-	return "", nil
+	return "", wildcard, nil
+}
+
+// isWildcardAnswer reports whether the TXT records answering a name are the
+// zone's wildcard answer (as returned by getWildcardRecords), so weren't
+// published at that name. It's only used for records that aren't valid, as
+// receivers are served a valid wildcard answer just the same.
+func isWildcardAnswer(answer, records []string) bool {
+	if len(answer) == 0 || len(answer) != len(records) {
+		return false
+	}
+
+	sorted := append([]string(nil), records...)
+	sort.Strings(sorted)
+
+	for index := range sorted {
+		if sorted[index] != answer[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getWildcardRecords returns the zone's sorted wildcard TXT answer, or nil if
+// it has none, by querying a random name under the zone that can't exist.
+// Answers are cached, and concurrent probes of the same zone (such as from the
+// DKIM and ARC lookups) share a single query.
+func (s *Scanner) getWildcardRecords(zone string) ([]string, error) {
+	zone = strings.ToLower(zone)
+
+	if records := s.wildcards.Get(zone); records != nil {
+		return *records, nil
+	}
+
+	value, err, _ := s.inflight.Do("wildcard:"+zone, func() (any, error) {
+		// the probe is shared by every lookup of the zone, so it isn't traced
+		records, err := s.getDNSRecords(nil, fmt.Sprintf("dss-%016x.%s", rand.Uint64(), zone), dns.TypeTXT)
+		if err != nil {
+			return nil, fmt.Errorf("failed to probe %v for a wildcard: %w", zone, err)
+		}
+
+		sort.Strings(records)
+		s.wildcards.Set(zone, &records)
+
+		return records, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]string), nil
 }
 
 // getTypeSPF queries the DNS server for SPF records of a domain.
-// It returns a string (SPF record) and an error if any occurred.
-func (s *Scanner) getTypeSPF(domain string) (string, error) {
-	records, err := s.getDNSRecords(domain, dns.TypeTXT)
+// It returns a string (SPF record) and an error if any occurred. If the record
+// is replaced by a redirect= modifier, it returns the record that applies (see
+// effectiveSPF).
+func (s *Scanner) getTypeSPF(trace *lookupTrace, domain string) (string, error) {
+	record, err := s.getSPFRecord(trace, domain)
+	if err != nil {
+		return "", err
+	}
+
+	redirects, err := s.getSPFRedirects(trace, domain, record)
+	if err != nil {
+		return "", err
+	}
+
+	return effectiveSPF(record, redirects), nil
+}
+
+// getSPFRecord queries the DNS server for the SPF record published at a
+// domain, without following its redirect= modifier. A record with more DNS
+// lookup terms than the scanner allows returns an error (see checkSPFFanout).
+func (s *Scanner) getSPFRecord(trace *lookupTrace, domain string) (string, error) {
+	records, err := s.getDNSRecords(trace, domain, dns.TypeTXT)
 	if err != nil {
 		return "", err
 	}
 
 	for _, record := range records {
 		if strings.HasPrefix(record, SPFPrefix) {
-			if !strings.Contains(record, "redirect=") {
-				return record, nil
+			if err = s.checkSPFFanout(domain, record); err != nil {
+				return "", err
 			}
 
-			parts := strings.Fields(record)
-			for _, part := range parts {
-				if strings.Contains(part, "redirect=") {
-					redirectDomain := strings.TrimPrefix(part, "redirect=")
-					return s.getTypeSPF(redirectDomain)
-				}
-			}
+			return record, nil
+		}
+	}
+
+	// fall back to a record with a typo, so that the advisor can explain how to fix it
+	for _, record := range records {
+		if lookalike.Detect(lookalike.SPF, record) != nil {
+			return record, nil
 		}
 	}
 
 	return "", nil
 }
+
+// findRecord returns the record starting with the given prefix, joining any
+// strings it's split across. If there isn't one, it returns the first record
+// that looks like the given kind but contains a typo, so that the advisor can
+// explain how to fix it.
+func findRecord(records []string, prefix string, kind lookalike.Kind) string {
+	// TXT records can be split across multiple strings, so we need to join them
+	return strings.Join(findRecordSegments(records, prefix, kind), "")
+}
+
+// findRecordSegments returns the strings of the record found by findRecord,
+// before they're joined.
+func findRecordSegments(records []string, prefix string, kind lookalike.Kind) []string {
+	for index, record := range records {
+		if strings.HasPrefix(record, prefix) {
+			return records[index:]
+		}
+	}
+
+	for index, record := range records {
+		if lookalike.Detect(kind, record) != nil {
+			return records[index:]
+		}
+	}
+
+	return nil
+}
+
+// segmentLengths returns the length of each of a record's strings, or nil if
+// it isn't split, so that truncated keys can be explained.
+func segmentLengths(segments []string) []int {
+	if len(segments) < 2 {
+		return nil
+	}
+
+	lengths := make([]int, 0, len(segments))
+	for _, segment := range segments {
+		lengths = append(lengths, len(segment))
+	}
+
+	return lengths
+}
+
+// err returns the error of the trace's context once it's done, so no further
+// queries are issued, or nil for a trace without a context (or no trace).
+func (t *lookupTrace) err() error {
+	if t == nil || t.ctx == nil {
+		return nil
+	}
+
+	return t.ctx.Err()
+}
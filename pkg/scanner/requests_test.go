@@ -0,0 +1,494 @@
+package scanner
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/lookalike"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// wildcardResolver serves a zone with a wildcard TXT record, answering any
+// name under the zone that isn't published with the wildcard's records.
+type wildcardResolver struct {
+	zone      string
+	wildcard  []string
+	published map[string][]string
+
+	mutex  sync.Mutex
+	probes int
+}
+
+func (r *wildcardResolver) Exchange(msg *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	question := msg.Question[0]
+	name := strings.ToLower(question.Name)
+
+	reply := new(dns.Msg)
+	reply.SetReply(msg)
+
+	answer := func(records ...string) {
+		for _, record := range records {
+			reply.Answer = append(reply.Answer, &dns.TXT{Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{record}})
+		}
+	}
+
+	switch {
+	case question.Qtype == dns.TypeNS && name == r.zone:
+		reply.Answer = append(reply.Answer, &dns.NS{Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1." + r.zone})
+	case question.Qtype != dns.TypeTXT:
+	case r.published[name] != nil:
+		answer(r.published[name]...)
+	case strings.HasSuffix(name, "."+r.zone):
+		if strings.HasPrefix(name, "dss-") {
+			r.mutex.Lock()
+			r.probes++
+			r.mutex.Unlock()
+		}
+
+		answer(r.wildcard...)
+	}
+
+	return reply, 0, nil
+}
+
+func TestFindRecord(t *testing.T) {
+	t.Run("PrefersValidRecord", func(t *testing.T) {
+		records := []string{"v=DMARC 1; p=none", "v=DMARC1; p=reject"}
+		require.Equal(t, "v=DMARC1; p=reject", findRecord(records, DMARCPrefix, lookalike.DMARC))
+	})
+
+	t.Run("FallsBackToLookalike", func(t *testing.T) {
+		records := []string{"google-site-verification=abc123", "v=dmarc1; p=none"}
+		require.Equal(t, "v=dmarc1; p=none", findRecord(records, DMARCPrefix, lookalike.DMARC))
+	})
+
+	t.Run("JoinsSplitRecord", func(t *testing.T) {
+		records := []string{"v=DKIM1; k=rsa; ", "p=KEY"}
+		require.Equal(t, "v=DKIM1; k=rsa; p=KEY", findRecord(records, DKIMPrefix, lookalike.DKIM))
+	})
+
+	t.Run("NoRecord", func(t *testing.T) {
+		require.Empty(t, findRecord([]string{"v=spf1 -all"}, DMARCPrefix, lookalike.DMARC))
+	})
+}
+
+func TestSegmentLengths(t *testing.T) {
+	require.Equal(t, []int{16, 5}, segmentLengths(findRecordSegments([]string{"google-site-verification=abc123", "v=DKIM1; k=rsa; ", "p=KEY"}, DKIMPrefix, lookalike.DKIM)))
+	require.Nil(t, segmentLengths([]string{"v=DKIM1; k=rsa; p=KEY"}))
+	require.Nil(t, segmentLengths(nil))
+}
+
+func TestScanner_Wildcard(t *testing.T) {
+	scan := func(t *testing.T, resolver *wildcardResolver) *Result {
+		t.Helper()
+
+		scanner, err := New(zerolog.Nop(), time.Second, WithCacheDuration(time.Minute), WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+
+		return results[0]
+	}
+
+	t.Run("Shadowed", func(t *testing.T) {
+		resolver := &wildcardResolver{
+			zone:     "example.com.",
+			wildcard: []string{"v=DMARC1 p=none", "v=DKIM1 p=KEY"},
+		}
+
+		result := scan(t, resolver)
+		require.Empty(t, result.DMARC)
+		require.True(t, result.DMARCWildcard)
+		require.Empty(t, result.DKIM)
+		require.Empty(t, result.DKIMSelector)
+		require.True(t, result.DKIMWildcard)
+		require.Empty(t, result.ARC)
+
+		// the zone and its _domainkey subzone are each probed once, and shared by the DKIM and ARC lookups
+		require.Equal(t, 2, resolver.probes)
+	})
+
+	t.Run("Published", func(t *testing.T) {
+		resolver := &wildcardResolver{
+			zone:     "example.com.",
+			wildcard: []string{"v=DMARC1 p=none", "v=DKIM1 p=KEY"},
+			published: map[string][]string{
+				"_dmarc.example.com.":        {"v=DMARC1 p=reject"},
+				"s1._domainkey.example.com.": {"v=DKIM1; k=rsa; p=KEY"},
+			},
+		}
+
+		// a malformed record that differs from the wildcard's is still reported, so it can be fixed
+		result := scan(t, resolver)
+		require.Equal(t, "v=DMARC1 p=reject", result.DMARC)
+		require.False(t, result.DMARCWildcard)
+		require.Equal(t, "v=DKIM1; k=rsa; p=KEY", result.DKIM)
+		require.Equal(t, "s1", result.DKIMSelector)
+		require.False(t, result.DKIMWildcard)
+	})
+
+	t.Run("ValidWildcard", func(t *testing.T) {
+		resolver := &wildcardResolver{
+			zone:     "example.com.",
+			wildcard: []string{"v=DMARC1; p=reject"},
+		}
+
+		// receivers are served a valid wildcard answer just the same, so it isn't probed
+		result := scan(t, resolver)
+		require.Equal(t, "v=DMARC1; p=reject", result.DMARC)
+		require.False(t, result.DMARCWildcard)
+		require.Equal(t, 0, resolver.probes)
+	})
+}
+
+// startTruncatingDNSServer serves a domain with TXT records too large for a
+// typical UDP buffer, over UDP (truncating any answer larger than the query's
+// EDNS0 buffer) and, unless udpOnly, over TCP on the same port.
+func startTruncatingDNSServer(t *testing.T, records []string, udpOnly bool) string {
+	t.Helper()
+
+	handler := func(udp bool) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, req *dns.Msg) {
+			msg := new(dns.Msg)
+			msg.SetReply(req)
+
+			switch question := req.Question[0]; {
+			case question.Qtype == dns.TypeNS && question.Name == "example.com.":
+				msg.Answer = append(msg.Answer, &dns.NS{Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."})
+			case question.Qtype == dns.TypeTXT && question.Name == "example.com.":
+				for _, record := range records {
+					msg.Answer = append(msg.Answer, &dns.TXT{Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{record}})
+				}
+			}
+
+			if udp {
+				size := dns.MinMsgSize
+				if opt := req.IsEdns0(); opt != nil {
+					size = int(opt.UDPSize())
+				}
+
+				msg.Truncate(size)
+			}
+
+			_ = w.WriteMsg(msg)
+		}
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	servers := []*dns.Server{{PacketConn: conn, Handler: handler(true)}}
+
+	if !udpOnly {
+		listener, err := net.Listen("tcp", conn.LocalAddr().String())
+		require.NoError(t, err)
+
+		servers = append(servers, &dns.Server{Listener: listener, Handler: handler(false)})
+	}
+
+	for _, server := range servers {
+		go func(server *dns.Server) {
+			_ = server.ActivateAndServe()
+		}(server)
+
+		t.Cleanup(func() {
+			_ = server.Shutdown()
+		})
+	}
+
+	return conn.LocalAddr().String()
+}
+
+func TestScanner_TCPFallback(t *testing.T) {
+	// an SPF record published alongside many verification records, which together don't fit a 1232 byte buffer
+	spf := "v=spf1 include:_spf.google.com include:spf.protection.outlook.com include:sendgrid.net -all"
+	records := []string{spf}
+	for len(records) < 30 {
+		records = append(records, "google-site-verification="+strings.Repeat(string(rune('a'+len(records)%26)), 43))
+	}
+
+	scan := func(t *testing.T, address string, opts ...Option) *Result {
+		t.Helper()
+
+		scanner, err := New(zerolog.Nop(), time.Second, append(opts, WithNameservers([]string{address}))...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+
+		return results[0]
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		result := scan(t, startTruncatingDNSServer(t, records, false))
+		require.Empty(t, result.Error)
+		require.Equal(t, spf, result.SPF)
+
+		// BIMI and DMARC fall back to the domain's own TXT records, so they're retried too, as is the TXT lookup itself
+		require.Equal(t, []string{"bimi", "dmarc", "spf", "txt"}, result.TCPFallback)
+		require.Len(t, result.TXT, len(records))
+		require.Greater(t, result.TXTSize, DefaultDNSBuffer)
+	})
+
+	t.Run("LargerBuffer", func(t *testing.T) {
+		result := scan(t, startTruncatingDNSServer(t, records, false), WithDNSBuffer(4096))
+		require.Empty(t, result.Error)
+		require.Equal(t, spf, result.SPF)
+		require.Empty(t, result.TCPFallback)
+	})
+
+	t.Run("TCPUnavailable", func(t *testing.T) {
+		// a partial record is never evaluated, so the lookup fails instead
+		result := scan(t, startTruncatingDNSServer(t, records, true))
+		require.Contains(t, result.Error, "spf:failed to retry truncated answer over TCP")
+		require.Empty(t, result.SPF)
+	})
+}
+
+// caaResolver serves the CAA records of each name, along with the NS record
+// of example.com so it can be scanned.
+type caaResolver map[string][]string
+
+func (r caaResolver) Exchange(msg *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	question := msg.Question[0]
+
+	reply := new(dns.Msg)
+	reply.SetReply(msg)
+
+	switch question.Qtype {
+	case dns.TypeNS:
+		if question.Name == "example.com." {
+			reply.Answer = append(reply.Answer, &dns.NS{Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."})
+		}
+	case dns.TypeCAA:
+		for _, value := range r[question.Name] {
+			reply.Answer = append(reply.Answer, &dns.CAA{Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeCAA, Class: dns.ClassINET, Ttl: 300}, Tag: "issue", Value: value})
+		}
+	}
+
+	return reply, 0, nil
+}
+
+func TestScanner_CAA(t *testing.T) {
+	scan := func(t *testing.T, domain string, resolver caaResolver) *Result {
+		t.Helper()
+
+		scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.Scan(domain)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+
+		return results[0]
+	}
+
+	t.Run("Published", func(t *testing.T) {
+		result := scan(t, "example.com", caaResolver{"example.com.": {"letsencrypt.org"}})
+		require.Equal(t, []string{`0 issue "letsencrypt.org"`}, result.CAA)
+	})
+
+	t.Run("Inherited", func(t *testing.T) {
+		scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+			return caaResolver{"example.com.": {"pki.goog"}}
+		}))
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		records, found, err := scanner.getTypeCAA(nil, "mail.example.com")
+		require.NoError(t, err)
+		require.Equal(t, []string{`0 issue "pki.goog"`}, records)
+		require.Equal(t, "example.com", found)
+	})
+
+	t.Run("None", func(t *testing.T) {
+		// the TLD's records never apply
+		result := scan(t, "example.com", caaResolver{"com.": {"letsencrypt.org"}})
+		require.Empty(t, result.CAA)
+	})
+}
+
+func TestScanner_DKIMKeys(t *testing.T) {
+	resolver := &zoneResolver{
+		zone: "example.com.",
+		records: map[string]map[uint16][]dns.RR{
+			"example.com.": {
+				dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}},
+			},
+			"ed._domainkey.example.com.": {
+				dns.TypeTXT: {txt("ed._domainkey.example.com.", "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=")},
+			},
+			"s1._domainkey.example.com.": {
+				dns.TypeTXT: {txt("s1._domainkey.example.com.", "v=DKIM1; k=rsa; p=KEY")},
+			},
+		},
+	}
+
+	scan := func(t *testing.T, opts ...Option) *Result {
+		t.Helper()
+
+		scanner, err := New(zerolog.Nop(), time.Second, append(opts, WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+
+		return results[0]
+	}
+
+	t.Run("Single", func(t *testing.T) {
+		result := scan(t)
+		require.Equal(t, "s1", result.DKIMSelector)
+		require.Nil(t, result.DKIMKeys)
+	})
+
+	t.Run("Multiple", func(t *testing.T) {
+		// s1 is also a known selector, but is only listed once
+		result := scan(t, WithDKIMSelectors("ed", "s1"))
+		require.Equal(t, "ed", result.DKIMSelector)
+		require.Equal(t, "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=", result.DKIM)
+		require.Equal(t, []DKIMKey{
+			{Selector: "ed", Record: "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="},
+			{Selector: "s1", Record: "v=DKIM1; k=rsa; p=KEY"},
+		}, result.DKIMKeys)
+	})
+}
+
+func TestScanner_DKIMSegments(t *testing.T) {
+	split := &dns.TXT{Hdr: dns.RR_Header{Name: "s1._domainkey.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{"v=DKIM1; k=rsa; p=MIIBIjANBgkq", "hkiG9w0BAQEFAAOCAQ8A"}}
+
+	resolver := &zoneResolver{
+		zone: "example.com.",
+		records: map[string]map[uint16][]dns.RR{
+			"example.com.": {
+				dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}},
+			},
+			"ed._domainkey.example.com.": {
+				dns.TypeTXT: {txt("ed._domainkey.example.com.", "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=")},
+			},
+			"s1._domainkey.example.com.": {
+				dns.TypeTXT: {split},
+			},
+		},
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithDKIMSelectors("s1", "ed"), WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	results, err := scanner.Scan("example.com")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	result := results[0]
+	require.Equal(t, "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A", result.DKIM)
+	require.Equal(t, []int{30, 20}, result.DKIMSegments)
+	require.Equal(t, []DKIMKey{
+		{Selector: "s1", Record: result.DKIM, Segments: []int{30, 20}},
+		{Selector: "ed", Record: "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="},
+	}, result.DKIMKeys)
+}
+
+func TestScanner_OnlyDKIMSelectors(t *testing.T) {
+	resolver := &zoneResolver{
+		zone: "example.com.",
+		records: map[string]map[uint16][]dns.RR{
+			"example.com.": {
+				dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}},
+			},
+			"ed._domainkey.example.com.": {
+				dns.TypeTXT: {txt("ed._domainkey.example.com.", "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=")},
+			},
+			"google._domainkey.example.com.": {
+				dns.TypeTXT: {txt("google._domainkey.example.com.", "v=DKIM1; k=rsa; p=KEY")},
+			},
+		},
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithOnlyDKIMSelectors("mail2023", "ed", "mail2023"), WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	results, err := scanner.Scan("example.com")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	require.Equal(t, "ed", results[0].DKIMSelector)
+	require.Equal(t, []DKIMSelectorCheck{{Selector: "mail2023", Found: false}, {Selector: "ed", Found: true}}, results[0].DKIMSelectorChecks)
+
+	// the key at the known google selector is skipped
+	require.Nil(t, results[0].DKIMKeys)
+
+	t.Run("PerScan", func(t *testing.T) {
+		scanner, err := New(zerolog.Nop(), time.Second, WithCacheDuration(time.Minute), WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.ScanWithDKIMSelectors([]string{"mail2023"}, "example.com")
+		require.NoError(t, err)
+		require.Empty(t, results[0].DKIM)
+		require.Equal(t, []DKIMSelectorCheck{{Selector: "mail2023", Found: false}}, results[0].DKIMSelectorChecks)
+
+		// the scanner's own scans still look up the known selectors, and aren't
+		// answered by the cached result of the other scan
+		results, err = scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Equal(t, "google", results[0].DKIMSelector)
+		require.Nil(t, results[0].DKIMSelectorChecks)
+
+		_, err = scanner.ScanWithDKIMSelectors([]string{"mail@2023"}, "example.com")
+		require.ErrorContains(t, err, "DKIM selector has invalid character '@'")
+	})
+}
+
+func TestScanner_MXOrder(t *testing.T) {
+	mx := func(preference uint16, host string) dns.RR {
+		return &dns.MX{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 300}, Preference: preference, Mx: host}
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return &zoneResolver{
+			zone: "example.com.",
+			records: map[string]map[uint16][]dns.RR{
+				"example.com.": {
+					dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}},
+					dns.TypeMX: {mx(20, "b.mx.example.com."), mx(10, "z.mx.example.com."), mx(20, "a.mx.example.com."), mx(10, "y.mx.example.com.")},
+				},
+			},
+		}
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	records, err := scanner.getDNSRecords(nil, "example.com", dns.TypeMX)
+	require.NoError(t, err)
+	require.Equal(t, []string{"y.mx.example.com.", "z.mx.example.com.", "a.mx.example.com.", "b.mx.example.com."}, records)
+}
@@ -1,9 +1,12 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -15,14 +18,57 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cast"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
 	ErrInvalidDomain = "invalid domain name"
+
+	// ErrLookupFailed is the error of a scan whose lookups couldn't be
+	// answered at all, such as when the resolver is down, rather than the
+	// domain being invalid. Its Errors hold the lookups' errors.
+	ErrLookupFailed = "the domain's records couldn't be looked up"
+
+	// DefaultDNSBuffer is the EDNS0 buffer size advertised for UDP answers.
+	// It's the size recommended by DNS Flag Day 2020, as larger UDP answers
+	// risk IP fragmentation, and larger answers are retried over TCP instead.
+	DefaultDNSBuffer = 1232
+
+	// DKIMDiscoveryFound is the DKIM discovery of a domain with a DKIM key at
+	// one of the selectors looked up.
+	DKIMDiscoveryFound = "found"
+
+	// DKIMDiscoveryAbsent is the DKIM discovery of a domain without a DKIM key
+	// at any of the selectors looked up.
+	DKIMDiscoveryAbsent = "absent"
+
+	// DKIMDiscoveryFailed is the DKIM discovery of a domain whose DKIM lookup
+	// failed before a key was found, so whether it has any is unknown.
+	DKIMDiscoveryFailed = "failed"
+
+	// DKIMDiscoverySkipped is the DKIM discovery of a domain whose DKIM keys
+	// weren't looked up, as no selectors were supplied and discovery is
+	// disabled (see WithoutDKIMDiscovery).
+	DKIMDiscoverySkipped = "skipped"
 )
 
 type (
 	Scanner struct {
+		// answerSizeLimit, spfFanoutLimit and txtRecordLimit bound the answers each lookup evaluates (see WithAnswerLimits).
+		answerSizeLimit, spfFanoutLimit, txtRecordLimit int
+
+		// authoritative is true if each domain's records are also queried from its authoritative nameservers (see WithAuthoritative).
+		authoritative bool
+
+		// blocklists are the DNSBL zones each domain's addresses are checked against, if any.
+		blocklists []string
+
+		// blocklistCache caches each DNSBL answer, keyed by query name, for blocklistCacheDuration.
+		blocklistCache *cache.Cache[[]string]
+
+		// blocklistSample is the number of each domain's addresses checked against the blocklists.
+		blocklistSample int
+
 		// cache is a simple in-memory cache to reduce external requests from the scanner.
 		cache *cache.Cache[Result]
 
@@ -32,9 +78,27 @@ type (
 		// dkimSelectors is used to specify where a DKIM record is hosted for a specific domain.
 		dkimSelectors []string
 
+		// onlyDKIMSelectors are the only selectors DKIM keys are looked up at, skipping the known selectors, if any.
+		onlyDKIMSelectors []string
+
+		// sourceAddress is the local address DNS queries are sent from, if any (see WithSourceAddress).
+		sourceAddress net.IP
+
+		// skipDKIMDiscovery skips looking up DKIM keys unless selectors are supplied (see WithoutDKIMDiscovery).
+		skipDKIMDiscovery bool
+
 		// DNS client shared by all goroutines the scanner spawns.
 		dnsClient *dns.Client
 
+		// resolver issues each DNS query, and is the DNS client unless wrapped via WithResolverMiddleware.
+		resolver Resolver
+
+		// tcpResolver retries truncated UDP answers over TCP, and is wrapped along with resolver.
+		tcpResolver Resolver
+
+		// inflight deduplicates concurrent scans of the same domain, and concurrent wildcard probes of the same zone.
+		inflight singleflight.Group
+
 		// dnsBuffer is used to configure the size of the buffer allocated for DNS responses.
 		dnsBuffer uint16
 
@@ -44,12 +108,30 @@ type (
 		// method.
 		lastNameserverIndex uint32
 
+		// lookalikeLimit is the number of lookalikes of each domain checked, if any (see WithLookalikes).
+		lookalikeLimit int
+
 		// logger is the logger for the scanner.
 		logger zerolog.Logger
 
+		// mtaSTS is true if each domain's MTA-STS record is looked up (see WithMTASTS).
+		mtaSTS bool
+
+		// spfIncludes is true if the include mechanisms of each domain's SPF record are resolved (see WithSPFIncludes).
+		spfIncludes bool
+
 		// nameservers is a slice of "host:port" strings of nameservers to issue queries against.
 		nameservers []string
 
+		// sendingSubdomains are the subdomains of each domain checked for their own mail authentication records, if any.
+		sendingSubdomains []string
+
+		// wildcards caches each zone's wildcard TXT answer, keyed by zone, so it's only probed once per cacheDuration.
+		wildcards *cache.Cache[[]string]
+
+		// pacer paces the queries for each zone, if any (see WithZonePacing).
+		pacer *zonePacer
+
 		// pool is the pool of workers for the scanner.
 		pool *ants.Pool
 
@@ -57,19 +139,137 @@ type (
 		poolSize uint16
 	}
 
+	// Resolver issues DNS queries against a nameserver. *dns.Client satisfies
+	// this interface.
+	Resolver interface {
+		Exchange(msg *dns.Msg, address string) (*dns.Msg, time.Duration, error)
+	}
+
+	// lookupTrace records how the queries of a single lookup were answered.
+	lookupTrace struct {
+		// ctx is the context of the scan, once done no further queries are
+		// issued (see ScanContext).
+		ctx context.Context
+
+		// tcp is true if any answer was truncated over UDP, so was retried over TCP.
+		tcp bool
+
+		// rcodes holds the response code each name was answered with.
+		rcodes map[string]int
+
+		// aliases holds the target of each CNAME answered, by its owner.
+		aliases map[string]string
+
+		// missing is the name of the response code that explains why the
+		// lookup found no record, if it's one whose advice depends on it.
+		missing string
+
+		// answerSize is the number of bytes of records the lookup was answered with so far.
+		answerSize int
+
+		// throttled is how long the lookup's queries waited for their zone's pacing (see WithZonePacing).
+		throttled time.Duration
+	}
+
 	// Option defines a functional configuration type for a *Scanner.
 	Option func(*Scanner) error
 
+	// DKIMKey is a DKIM key record published at a selector.
+	DKIMKey struct {
+		Selector string `json:"selector" yaml:"selector" doc:"The selector the key was found at." example:"ed25519"`
+		Record   string `json:"record" yaml:"record" doc:"The DKIM key record." example:"v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="`
+		Segments []int  `json:"segments,omitempty" yaml:"segments,omitempty" doc:"The length of each string the key record is split across, if it's split (as keys of 2048 bits or more must be)." example:"[255,137]"`
+	}
+
+	// DKIMSelectorCheck is whether a DKIM key was found at a selector that was
+	// explicitly supplied.
+	DKIMSelectorCheck struct {
+		Selector string `json:"selector" yaml:"selector" doc:"The supplied selector." example:"mail2023"`
+		Found    bool   `json:"found" yaml:"found" doc:"Whether a DKIM key was found at the selector."`
+	}
+
 	// Result holds the results of scanning a domain's DNS records.
 	Result struct {
-		Domain string   `json:"domain" yaml:"domain,omitempty" doc:"The domain name being scanned." example:"example.com"`
-		Error  string   `json:"error,omitempty" yaml:"error,omitempty" doc:"An error message if the scan failed." example:"invalid domain name"`
-		BIMI   string   `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"The BIMI record for the domain." example:"https://example.com/bimi.svg"`
-		DKIM   string   `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"The DKIM record for the domain." example:"v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`
-		DMARC  string   `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The DMARC record for the domain." example:"v=DMARC1; p=none"`
-		MX     []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"The MX records for the domain." example:"aspmx.l.google.com"`
-		NS     []string `json:"ns,omitempty" yaml:"ns,omitempty" doc:"The NS records for the domain." example:"ns1.example.com"`
-		SPF    string   `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The SPF record for the domain." example:"v=spf1 include:_spf.google.com ~all"`
+		Domain        string   `json:"domain" yaml:"domain,omitempty" doc:"The domain name being scanned." example:"example.com"`
+		Error         string   `json:"error,omitempty" yaml:"error,omitempty" doc:"An error message if the scan failed." example:"invalid domain name"`
+		Addresses     []string `json:"addresses,omitempty" yaml:"addresses,omitempty" doc:"The A and AAAA records for the domain." example:"93.184.216.34"`
+		ARC           string   `json:"arc,omitempty" yaml:"arc,omitempty" doc:"The ARC sealing key for the domain." example:"v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`
+		ARCSelector   string   `json:"arcSelector,omitempty" yaml:"arcSelector,omitempty" doc:"The selector the ARC sealing key was found at." example:"arc"`
+		BIMI          string   `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"The BIMI record for the domain." example:"https://example.com/bimi.svg"`
+		CAA           []string `json:"caa,omitempty" yaml:"caa,omitempty" doc:"The CAA records that apply to the domain, which may be inherited from a parent domain." example:"0 issue \"letsencrypt.org\""`
+		DKIM          string   `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"The DKIM record for the domain." example:"v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`
+		DKIMSelector  string   `json:"dkimSelector,omitempty" yaml:"dkimSelector,omitempty" doc:"The selector the DKIM record was found at." example:"google"`
+		DKIMWildcard  bool     `json:"dkimWildcard,omitempty" yaml:"dkimWildcard,omitempty" doc:"Whether the DKIM lookup was only answered by a wildcard TXT record, rather than a DKIM record."`
+		DKIMDiscovery string   `json:"dkimDiscovery,omitempty" yaml:"dkimDiscovery,omitempty" enum:"found,absent,failed,skipped" doc:"The outcome of looking up the DKIM keys: found if a key was found, absent if the selectors looked up have none, failed if a lookup failed before any key was found (the failure is under errors), or skipped if no selectors were looked up, as selector discovery was disabled." example:"found"`
+		DMARC         string   `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The DMARC record for the domain." example:"v=DMARC1; p=none"`
+		DMARCWildcard bool     `json:"dmarcWildcard,omitempty" yaml:"dmarcWildcard,omitempty" doc:"Whether the DMARC lookup was only answered by a wildcard TXT record, rather than a DMARC record."`
+		DMARCCNAME    []string `json:"dmarcCname,omitempty" yaml:"dmarcCname,omitempty" doc:"The chain of targets _dmarc.<domain> is an alias (CNAME) of, if it's one, such as of a managed DMARC service. The DMARC record is the one published at the last of them." example:"example.com._d.easydmarc.pro"`
+		MX            []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"The MX records for the domain." example:"aspmx.l.google.com"`
+		NS            []string `json:"ns,omitempty" yaml:"ns,omitempty" doc:"The NS records for the domain." example:"ns1.example.com"`
+		SPF           string   `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The SPF record published at the domain, before any redirect= modifier is followed." example:"v=spf1 include:_spf.google.com ~all"`
+		SPFCNAME      []string `json:"spfCname,omitempty" yaml:"spfCname,omitempty" doc:"The chain of targets the domain is an alias (CNAME) of, if it's one, which the SPF record was looked up through. The SPF record is the one published at the last of them." example:"example.com.spf.example.net"`
+		TCPFallback   []string `json:"tcpFallback,omitempty" yaml:"tcpFallback,omitempty" doc:"The lookups with an answer too large for UDP, which were retried over TCP." example:"spf"`
+
+		// Rcodes is only set if the DMARC, DKIM or BIMI lookup found no record.
+		Rcodes map[string]string `json:"rcodes,omitempty" yaml:"rcodes,omitempty" doc:"The DNS response code explaining each DMARC, DKIM or BIMI lookup that found no record, by lookup: NXDOMAIN if the name doesn't exist, NOERROR if it exists without the record, or the code of the failure (such as SERVFAIL, often a DNSSEC validation failure) if it couldn't be resolved."`
+
+		// Oversized is only set if a lookup's answers exceeded the scanner's limits (see WithAnswerLimits).
+		Oversized map[string]string `json:"oversized,omitempty" yaml:"oversized,omitempty" doc:"The lookups whose answers exceeded the scanner's limits on TXT records, answer size or SPF lookup terms, by lookup, with the limit that was exceeded. Their records were too large to evaluate, so they weren't."`
+
+		// TXT and TXTSize are only set if the domain publishes TXT records.
+		TXT     []string `json:"txt,omitempty" yaml:"txt,omitempty" doc:"Every TXT record published at the domain, with the strings each is split across joined." example:"google-site-verification=rXOxyZounnZasA8Z7oaD3c14JdjS9aKSWvsR1EbUSIQ"`
+		TXTSize int      `json:"txtSize,omitempty" yaml:"txtSize,omitempty" doc:"The size in bytes of the DNS answer containing the domain's TXT records." example:"702"`
+
+		// DKIMSegments is only set if the DKIM record is split across strings.
+		DKIMSegments []int `json:"dkimSegments,omitempty" yaml:"dkimSegments,omitempty" doc:"The length of each string the DKIM record is split across, if it's split (as keys of 2048 bits or more must be)." example:"[255,137]"`
+
+		// DKIMKeys is only set if DKIM keys were found at more than one selector.
+		DKIMKeys []DKIMKey `json:"dkimKeys,omitempty" yaml:"dkimKeys,omitempty" doc:"Every DKIM key found, by selector, if keys were found at more than one selector (such as an RSA and an Ed25519 key). The first is also the result's dkim."`
+
+		// DKIMSelectorChecks is only set if explicit selectors are supplied (see WithOnlyDKIMSelectors).
+		DKIMSelectorChecks []DKIMSelectorCheck `json:"dkimSelectorChecks,omitempty" yaml:"dkimSelectorChecks,omitempty" doc:"Whether a DKIM key was found at each of the supplied selectors, if DKIM keys were only looked up at explicitly supplied selectors."`
+
+		// SPFRedirects is only set if the SPF record is replaced by a redirect= modifier.
+		SPFRedirects []SPFRedirect `json:"spfRedirects,omitempty" yaml:"spfRedirects,omitempty" doc:"Each domain the SPF record's redirect= modifier leads to, in order, if it has one and no all mechanism. The last one's record is the one that applies."`
+
+		// SPFIncludes is only set if includes are resolved (see WithSPFIncludes).
+		SPFIncludes []SPFInclude `json:"spfIncludes,omitempty" yaml:"spfIncludes,omitempty" doc:"Each domain the include mechanisms of the SPF record that applies lead to, directly or through another include, in the order receivers evaluate them, if includes were resolved. At most 10 are resolved, as SPF allows no more DNS lookups."`
+
+		// Blocklistings is only set if blocklists are checked (see WithBlocklists).
+		Blocklistings []Blocklisting `json:"blocklistings,omitempty" yaml:"blocklistings,omitempty" doc:"The sampled SPF authorized and MX host addresses that are listed by a DNSBL, if blocklists were checked."`
+
+		// Authoritative is only set if authoritative nameservers are queried (see WithAuthoritative).
+		Authoritative []AuthoritativeAnswer `json:"authoritative,omitempty" yaml:"authoritative,omitempty" doc:"Which of the zone's authoritative nameservers answered each of the TXT, MX, DMARC and DKIM lookups, with the TTL of its answer, and whether the recursive resolver's answer differs, if authoritative nameservers were queried."`
+
+		// SendingSubdomains is only set if sending subdomains are checked (see WithSendingSubdomains).
+		SendingSubdomains []SendingSubdomain `json:"sendingSubdomains,omitempty" yaml:"sendingSubdomains,omitempty" doc:"The common sending subdomains that exist, with their own mail authentication records."`
+
+		// Lookalikes is only set if lookalikes are checked (see WithLookalikes).
+		Lookalikes []Lookalike `json:"lookalikes,omitempty" yaml:"lookalikes,omitempty" doc:"The lookalikes of the domain (such as typos and homographs of it) that resolve, with their MX and SPF records, if lookalikes were checked. They're informational, as lookalikes are often registered legitimately, or defensively by the domain's owner."`
+
+		// MTASTS is only set if MTA-STS records are looked up (see WithMTASTS).
+		MTASTS []string `json:"mtaSts,omitempty" yaml:"mtaSts,omitempty" doc:"The MTA-STS records published at _mta-sts.<domain>, if MTA-STS records were looked up. Senders ignore them all if there's more than one." example:"v=STSv1; id=20240101000000"`
+
+		// Organizational is only set if the domain was scanned, rather than rejected as invalid.
+		Organizational *Organizational `json:"organizational,omitempty" yaml:"organizational,omitempty" doc:"The domain's organizational domain (the registered domain below its public suffix), whether the domain is it or a subdomain of it, and which of the domain's records it publishes itself or inherits."`
+
+		// CNAME is the chain of targets the domain's CNAME record resolves through. It's nil if it has none.
+		CNAME []string `json:"-" yaml:"-"`
+
+		// SOA is the domain's SOA record. It's nil if the domain isn't the apex of a zone.
+		SOA *SOA `json:"-" yaml:"-"`
+
+		// Parked assesses whether the domain is likely to be parked. It's nil if any lookup failed.
+		Parked *ParkedAssessment `json:"-" yaml:"-"`
+
+		// Duration is the wall-clock duration of the whole scan.
+		Duration time.Duration `json:"-" yaml:"-"`
+
+		// Timings holds the wall-clock duration of each lookup, keyed by lookup name.
+		Timings map[string]string `json:"-" yaml:"-"`
+
+		// Errors holds the error of each lookup that failed, keyed by lookup name.
+		Errors map[string]error `json:"-" yaml:"-"`
 	}
 )
 
@@ -82,12 +282,22 @@ func New(logger zerolog.Logger, timeout time.Duration, opts ...Option) (*Scanner
 	dnsClient.Net = "udp"
 	dnsClient.Timeout = timeout
 
+	tcpClient := new(dns.Client)
+	tcpClient.Net = "tcp"
+	tcpClient.Timeout = timeout
+
 	scanner := &Scanner{
 		dnsClient:   dnsClient,
-		dnsBuffer:   4096,
+		dnsBuffer:   DefaultDNSBuffer,
+		resolver:    dnsClient,
+		tcpResolver: tcpClient,
 		logger:      logger,
 		nameservers: []string{"8.8.8.8:53", "8.8.4.4:53", "1.1.1.1:53"}, // Set the default nameservers to Google and Cloudflare
 		poolSize:    uint16(runtime.NumCPU()),
+
+		answerSizeLimit: DefaultAnswerSizeLimit,
+		spfFanoutLimit:  DefaultSPFFanoutLimit,
+		txtRecordLimit:  DefaultTXTRecordLimit,
 	}
 
 	for _, opt := range opts {
@@ -96,8 +306,14 @@ func New(logger zerolog.Logger, timeout time.Duration, opts ...Option) (*Scanner
 		}
 	}
 
+	if scanner.sourceAddress != nil {
+		bindSourceAddress(scanner.sourceAddress, dnsClient, tcpClient)
+	}
+
 	// Initialize cache
 	scanner.cache = cache.New[Result](scanner.cacheDuration)
+	scanner.wildcards = cache.New[[]string](scanner.cacheDuration)
+	scanner.blocklistCache = cache.New[[]string](blocklistCacheDuration)
 
 	// Create a new pool of workers for the scanner
 	pool, err := ants.NewPool(int(scanner.poolSize), ants.WithExpiryDuration(timeout), ants.WithPanicHandler(func(err interface{}) {
@@ -112,142 +328,509 @@ func New(logger zerolog.Logger, timeout time.Duration, opts ...Option) (*Scanner
 	return scanner, nil
 }
 
-// Scan scans a list of domains and returns the results.
+// Scan scans a list of domains and returns the results, in the same order as
+// the given domains. Domains are normalized (trimmed, lowercased, and stripped
+// of any trailing dot) and deduplicated, so a domain that's repeated is only
+// scanned once, and each of its positions shares the same result.
 func (s *Scanner) Scan(domains ...string) ([]*Result, error) {
+	return s.scan(context.Background(), s.onlyDKIMSelectors, domains)
+}
+
+// ScanContext scans a list of domains as Scan does, until the context is
+// done. No further queries are issued once it's done, so the lookups that
+// hadn't finished fail with its error, and the results they're part of
+// aren't cached. If it's done before every domain has been scanned, its error
+// is returned instead of the results.
+func (s *Scanner) ScanContext(ctx context.Context, domains ...string) ([]*Result, error) {
+	return s.scan(ctx, s.onlyDKIMSelectors, domains)
+}
+
+// ScanWithDKIMSelectors scans a list of domains as Scan does, but only looks
+// up DKIM keys at the given selectors (skipping the known selectors), and
+// reports whether a key was found at each of them. It's meant for scans where
+// the caller knows the domain's selectors, such as a single API request, as
+// unlike WithOnlyDKIMSelectors, it doesn't change the scanner's options.
+func (s *Scanner) ScanWithDKIMSelectors(selectors []string, domains ...string) ([]*Result, error) {
+	return s.ScanWithDKIMSelectorsContext(context.Background(), selectors, domains...)
+}
+
+// ScanWithDKIMSelectorsContext scans a list of domains as
+// ScanWithDKIMSelectors does, until the context is done (see ScanContext).
+func (s *Scanner) ScanWithDKIMSelectorsContext(ctx context.Context, selectors []string, domains ...string) ([]*Result, error) {
+	if len(selectors) == 0 {
+		return nil, errors.New("no DKIM selectors provided")
+	}
+
+	for _, selector := range selectors {
+		if err := ValidateDKIMSelector(selector); err != nil {
+			return nil, fmt.Errorf("invalid DKIM selector: %w", err)
+		}
+	}
+
+	return s.scan(ctx, selectors, domains)
+}
+
+// scan scans the domains until the context is done, only looking up DKIM keys
+// at the selectors if any are given.
+func (s *Scanner) scan(ctx context.Context, selectors []string, domains []string) ([]*Result, error) {
 	if s.pool == nil {
 		return nil, errors.New("scanner is closed")
 	}
 
-	for _, domain := range domains {
+	if len(domains) == 0 {
+		return nil, errors.New("no domains to scan")
+	}
+
+	normalized := make([]string, len(domains))
+	var unique []string
+	seen := make(map[string]struct{}, len(domains))
+
+	for index, domain := range domains {
+		domain = NormalizeDomain(domain)
 		if domain == "" {
 			return nil, errors.New("empty domain")
 		}
-	}
 
-	if len(domains) == 0 {
-		return nil, errors.New("no domains to scan")
+		normalized[index] = domain
+
+		if _, ok := seen[domain]; !ok {
+			seen[domain] = struct{}{}
+			unique = append(unique, domain)
+		}
 	}
 
 	var mutex sync.Mutex
-	var results []*Result
+	resultsByDomain := make(map[string]*Result, len(unique))
 	var wg sync.WaitGroup
 
-	for _, domainToScan := range domains {
+	for _, domainToScan := range unique {
 		wg.Add(1)
 
 		if err := s.pool.Submit(func() {
-			defer func() {
-				wg.Done()
-			}()
+			defer wg.Done()
 
-			var err error
-			result := &Result{
-				Domain: domainToScan,
+			// domains still queued once the context is done aren't scanned
+			if ctx.Err() != nil {
+				return
 			}
 
-			if s.cache != nil {
-				scanResult := s.cache.Get(domainToScan)
-				if scanResult != nil {
-					s.logger.Debug().Msg("cache hit for " + domainToScan)
-					mutex.Lock()
-					results = append(results, scanResult)
-					mutex.Unlock()
-					return
-				}
+			result := s.scanDomain(ctx, domainToScan, selectors)
+
+			mutex.Lock()
+			resultsByDomain[domainToScan] = result
+			mutex.Unlock()
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, len(domains))
+	for index, domain := range normalized {
+		results[index] = resultsByDomain[domain]
+	}
+
+	return results, nil
+}
+
+// scanDomain returns the cached result for a domain, or scans it. Concurrent
+// scans of the same domain (such as from separate API requests) share a single
+// lookup. Scans that only look up DKIM keys at the given selectors are cached
+// separately. A shared lookup cut short by its own scan's context is retried
+// for the scans whose contexts aren't done.
+func (s *Scanner) scanDomain(ctx context.Context, domain string, selectors []string) *Result {
+	key := domain
+	if len(selectors) > 0 {
+		key += "?dkimSelectors=" + strings.Join(selectors, ",")
+	}
+
+	if s.cache != nil {
+		if result := s.cache.Get(key); result != nil {
+			s.logger.Debug().Msg("cache hit for " + domain)
+			return result
+		}
+
+		s.logger.Debug().Msg("cache miss for " + domain)
+	}
 
-				s.logger.Debug().Msg("cache miss for " + domainToScan)
+	for {
+		value, err, _ := s.inflight.Do(key, func() (any, error) {
+			start := time.Now()
+			result := s.lookupDomain(ctx, domain, selectors)
+			result.Duration = time.Since(start)
 
-				defer func() {
-					s.cache.Set(domainToScan, result)
-				}()
+			// scans cut short by their context are incomplete, so are returned with its error
+			if err := ctx.Err(); err != nil {
+				return result, err
 			}
 
-			// check that the domain name is valid
-			result.NS, err = s.getDNSRecords(domainToScan, dns.TypeNS)
-			if err != nil || len(result.NS) == 0 {
-				// check if TXT records exist, as the nameserver check won't work for subdomains
-				records, err := s.getDNSAnswers(domainToScan, dns.TypeTXT)
-				if err != nil || len(records) == 0 {
-					// fill variable to satisfy deferred cache fill
-					result = &Result{
-						Domain: domainToScan,
-						Error:  ErrInvalidDomain,
-					}
-
-					mutex.Lock()
-					results = append(results, result)
-					mutex.Unlock()
-
-					return
-				}
+			// scans the resolver couldn't answer aren't cached, as its failure may be transient
+			if s.cache != nil && result.Error != ErrLookupFailed {
+				s.cache.SetTagged(key, result, domain)
 			}
 
-			var errs []string
-			scanWg := sync.WaitGroup{}
-			scanWg.Add(5)
+			return result, nil
+		})
 
-			// Get BIMI record
-			go func() {
-				defer scanWg.Done()
-				result.BIMI, err = s.getTypeBIMI(domainToScan)
-				if err != nil {
-					errs = append(errs, "bimi:"+err.Error())
-				}
-			}()
+		if err == nil || ctx.Err() != nil {
+			return value.(*Result)
+		}
+	}
+}
 
-			// Get DKIM record
-			go func() {
-				defer scanWg.Done()
-				result.DKIM, err = s.getTypeDKIM(domainToScan)
-				if err != nil {
-					errs = append(errs, "dkim:"+err.Error())
-				}
-			}()
+// lookupDomain queries each of the domain's records until the context is
+// done, only looking up DKIM keys at the selectors if any are given.
+func (s *Scanner) lookupDomain(ctx context.Context, domain string, selectors []string) *Result {
+	result := &Result{
+		Domain: domain,
+	}
 
-			// Get DMARC record
-			go func() {
-				defer scanWg.Done()
-				result.DMARC, err = s.getTypeDMARC(domainToScan)
-				if err != nil {
-					errs = append(errs, "dmarc:"+err.Error())
-				}
-			}()
+	// syntactically invalid domains are rejected without any network requests
+	if err := ValidateDomain(domain); err != nil {
+		result.Error = ErrInvalidDomain
+		return result
+	}
 
-			// Get MX records
-			go func() {
-				defer scanWg.Done()
-				result.MX, err = s.getDNSRecords(domainToScan, dns.TypeMX)
-				if err != nil {
-					errs = append(errs, "mx:"+err.Error())
-				}
-			}()
+	// timings and errs are shared by the lookup goroutines below, so they're guarded by lookupMutex
+	var errs []string
+	var lookupMutex sync.Mutex
+	result.Timings = make(map[string]string)
+
+	lookup := func(name string, fn func(trace *lookupTrace) error) {
+		start := time.Now()
+		trace := &lookupTrace{ctx: ctx}
+		err := fn(trace)
+
+		lookupMutex.Lock()
+		defer lookupMutex.Unlock()
+
+		result.Timings[name+"_lookup"] = time.Since(start).Round(time.Microsecond).String()
+		if trace.throttled > 0 {
+			result.Timings[name+"_throttle"] = trace.throttled.Round(time.Microsecond).String()
+		}
 
-			// Get SPF record
-			go func() {
-				defer scanWg.Done()
-				result.SPF, err = s.getTypeSPF(domainToScan)
+		if errors.Is(err, ErrRecordTooLarge) {
+			// the domain's records are at fault rather than the lookup, so it's a finding, not an error
+			if result.Oversized == nil {
+				result.Oversized = make(map[string]string)
+			}
+
+			_, result.Oversized[name], _ = strings.Cut(err.Error(), ErrRecordTooLarge.Error()+": ")
+		} else if err != nil {
+			errs = append(errs, name+":"+err.Error())
+
+			if result.Errors == nil {
+				result.Errors = make(map[string]error)
+			}
+
+			result.Errors[name] = err
+		}
+
+		if trace.tcp {
+			result.TCPFallback = append(result.TCPFallback, name)
+		}
+
+		if trace.missing != "" {
+			if result.Rcodes == nil {
+				result.Rcodes = make(map[string]string)
+			}
+
+			result.Rcodes[name] = trace.missing
+		}
+	}
+
+	// check that the domain name is valid
+	var nsErr error
+	lookup("ns", func(trace *lookupTrace) error {
+		result.NS, nsErr = s.getDNSRecords(trace, domain, dns.TypeNS)
+		return nil
+	})
+	if nsErr != nil || len(result.NS) == 0 {
+		// check if TXT records exist, as the nameserver check won't work for subdomains
+		records, err := s.getDNSAnswers(&lookupTrace{ctx: ctx}, domain, dns.TypeTXT)
+
+		// if neither query reached the resolver (or was issued before the context was done), the domain may well be valid
+		var nsNetErr, txtNetErr net.Error
+		if (errors.As(nsErr, &nsNetErr) && errors.As(err, &txtNetErr)) || ctx.Err() != nil {
+			return &Result{
+				Domain:  domain,
+				Error:   ErrLookupFailed,
+				Errors:  map[string]error{"ns": nsErr},
+				Timings: result.Timings,
+			}
+		}
+
+		if err != nil || len(records) == 0 {
+			return &Result{
+				Domain: domain,
+				Error:  ErrInvalidDomain,
+			}
+		}
+	}
+
+	scanWg := sync.WaitGroup{}
+	scanWg.Add(11)
+
+	// Get A and AAAA records
+	go func() {
+		defer scanWg.Done()
+		lookup("addresses", func(trace *lookupTrace) error {
+			for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				addresses, err := s.getDNSRecords(trace, domain, recordType)
 				if err != nil {
-					errs = append(errs, "spf:"+err.Error())
+					return err
 				}
-			}()
 
-			scanWg.Wait()
+				result.Addresses = append(result.Addresses, addresses...)
+			}
 
-			if len(errs) > 0 {
-				result.Error = strings.Join(errs, "; ")
+			return nil
+		})
+	}()
+
+	// Get ARC sealing key
+	go func() {
+		defer scanWg.Done()
+		lookup("arc", func(trace *lookupTrace) (err error) {
+			result.ARCSelector, result.ARC, err = s.getTypeARC(trace, domain)
+			return err
+		})
+	}()
+
+	// Get BIMI record
+	go func() {
+		defer scanWg.Done()
+		lookup("bimi", func(trace *lookupTrace) (err error) {
+			result.BIMI, err = s.getTypeBIMI(trace, domain)
+			if result.BIMI == "" {
+				trace.missing = trace.rcode("default._bimi." + domain)
 			}
 
-			mutex.Lock()
-			results = append(results, result)
-			mutex.Unlock()
-		}); err != nil {
-			return nil, err
+			return err
+		})
+	}()
+
+	// Get CAA records
+	var caaDomain string
+	go func() {
+		defer scanWg.Done()
+		lookup("caa", func(trace *lookupTrace) (err error) {
+			result.CAA, caaDomain, err = s.getTypeCAA(trace, domain)
+			return err
+		})
+	}()
+
+	// Get CNAME chain
+	go func() {
+		defer scanWg.Done()
+		lookup("cname", func(trace *lookupTrace) (err error) {
+			result.CNAME, err = s.getCNAMEChain(trace, domain)
+			return err
+		})
+	}()
+
+	// Get DKIM record
+	go func() {
+		defer scanWg.Done()
+
+		// nothing is looked up, so there's no timing or rcode to record
+		if len(selectors) == 0 && s.skipDKIMDiscovery {
+			result.DKIMDiscovery = DKIMDiscoverySkipped
+			return
 		}
+
+		lookup("dkim", func(trace *lookupTrace) (err error) {
+			var (
+				keys     []DKIMKey
+				wildcard bool
+			)
+
+			if len(selectors) > 0 {
+				keys, wildcard, result.DKIMSelectorChecks, err = s.getDKIMSelectorKeys(trace, domain, selectors)
+			} else {
+				keys, wildcard, err = s.getDKIMKeys(trace, domain)
+			}
+
+			switch {
+			case len(keys) > 0:
+				result.DKIMDiscovery = DKIMDiscoveryFound
+			case err != nil && !errors.Is(err, ErrRecordTooLarge):
+				result.DKIMDiscovery = DKIMDiscoveryFailed
+			default:
+				result.DKIMDiscovery = DKIMDiscoveryAbsent
+			}
+
+			if len(keys) == 0 && !wildcard {
+				trace.missing = trace.rcodeUnder("_domainkey." + domain)
+			}
+
+			result.DKIMWildcard = wildcard
+
+			// the keys found before a lookup failed are kept, as they're published whatever the failure
+			if len(keys) > 0 {
+				result.DKIMSelector, result.DKIM, result.DKIMSegments = keys[0].Selector, keys[0].Record, keys[0].Segments
+			}
+
+			// the keys are only listed if there's more than one
+			if len(keys) > 1 {
+				result.DKIMKeys = keys
+			}
+
+			return err
+		})
+	}()
+
+	// Get DMARC record
+	go func() {
+		defer scanWg.Done()
+		lookup("dmarc", func(trace *lookupTrace) (err error) {
+			result.DMARC, result.DMARCWildcard, err = s.getTypeDMARC(trace, domain)
+			result.DMARCCNAME = trace.chain("_dmarc." + domain)
+
+			if result.DMARC == "" && !result.DMARCWildcard {
+				trace.missing = trace.chainRcode("_dmarc." + domain)
+			}
+
+			return err
+		})
+	}()
+
+	// Get MX records
+	go func() {
+		defer scanWg.Done()
+		lookup("mx", func(trace *lookupTrace) (err error) {
+			result.MX, err = s.getDNSRecords(trace, domain, dns.TypeMX)
+			return err
+		})
+	}()
+
+	// Get SOA record
+	go func() {
+		defer scanWg.Done()
+		lookup("soa", func(trace *lookupTrace) (err error) {
+			result.SOA, err = s.getTypeSOA(trace, domain)
+			return err
+		})
+	}()
+
+	// Get SPF record
+	go func() {
+		defer scanWg.Done()
+		lookup("spf", func(trace *lookupTrace) (err error) {
+			result.SPF, err = s.getSPFRecord(trace, domain)
+			result.SPFCNAME = trace.chain(domain)
+
+			if err != nil {
+				return err
+			}
+
+			if result.SPFRedirects, err = s.getSPFRedirects(trace, domain, result.SPF); err != nil || !s.spfIncludes {
+				return err
+			}
+
+			result.SPFIncludes, err = s.getSPFIncludes(trace, domain, result.EffectiveSPF())
+			return err
+		})
+	}()
+
+	// Get TXT records
+	go func() {
+		defer scanWg.Done()
+		lookup("txt", func(trace *lookupTrace) (err error) {
+			result.TXT, result.TXTSize, err = s.getTXTRecords(trace, domain)
+			return err
+		})
+	}()
+
+	// Get sending subdomains
+	if len(s.sendingSubdomains) > 0 {
+		scanWg.Add(1)
+		go func() {
+			defer scanWg.Done()
+			lookup("subdomains", func(trace *lookupTrace) (err error) {
+				result.SendingSubdomains, err = s.getSendingSubdomains(trace, domain)
+				return err
+			})
+		}()
 	}
 
-	wg.Wait()
+	// Get lookalikes
+	if s.lookalikeLimit > 0 {
+		scanWg.Add(1)
+		go func() {
+			defer scanWg.Done()
+			lookup("lookalikes", func(trace *lookupTrace) error {
+				result.Lookalikes = s.getLookalikes(trace, domain)
+				return nil
+			})
+		}()
+	}
 
-	return results, nil
+	// Get MTA-STS records
+	if s.mtaSTS {
+		scanWg.Add(1)
+		go func() {
+			defer scanWg.Done()
+			lookup("mtasts", func(trace *lookupTrace) (err error) {
+				result.MTASTS, err = s.getTypeMTASTS(trace, domain)
+				return err
+			})
+		}()
+	}
+
+	scanWg.Wait()
+
+	// the blocklists are checked once the SPF and MX records they're sampled from are known
+	if len(s.blocklists) > 0 {
+		lookup("blocklists", func(trace *lookupTrace) (err error) {
+			result.Blocklistings, err = s.getBlocklistings(trace, domain, result.EffectiveSPF(), result.MX)
+			return err
+		})
+	}
+
+	// the authoritative nameservers are queried once the DKIM selector is known
+	if s.authoritative {
+		lookup("authoritative", func(trace *lookupTrace) (err error) {
+			result.Authoritative, err = s.getAuthoritativeAnswers(trace, domain, result.DKIMSelector)
+			return err
+		})
+	}
+
+	// a subdomain without a DMARC record of its own is covered by its organizational domain's
+	result.Organizational = newOrganizational(domain)
+	if result.Organizational.Relationship == RelationshipSubdomain && result.DMARC == "" && !result.DMARCWildcard && result.Errors["dmarc"] == nil {
+		lookup("organizational_dmarc", func(trace *lookupTrace) (err error) {
+			result.Organizational.DMARC, _, err = s.getTypeDMARC(trace, result.Organizational.Domain)
+			return err
+		})
+	}
+
+	// a subdomain without an SPF record of its own may still send mail authorized by its organizational domain's
+	if result.Organizational.Relationship == RelationshipSubdomain && result.SPF == "" && result.Errors["spf"] == nil {
+		lookup("organizational_spf", func(trace *lookupTrace) (err error) {
+			result.Organizational.SPF, err = s.getTypeSPF(trace, result.Organizational.Domain)
+			return err
+		})
+	}
+
+	result.Organizational.addRecords(result, caaDomain)
+
+	// the lookups run concurrently, so they're sorted to be in the same order for every scan
+	sort.Strings(result.TCPFallback)
+	sort.Strings(errs)
+
+	if len(errs) > 0 {
+		result.Error = strings.Join(errs, "; ")
+	} else {
+		result.Parked = assessParked(result)
+	}
+
+	return result
 }
 
 func (s *Scanner) ScanZone(zone io.Reader) ([]*Result, error) {
@@ -277,13 +860,47 @@ func (s *Scanner) ScanZone(zone io.Reader) ([]*Result, error) {
 	return s.Scan(domains...)
 }
 
+// CacheStats returns the hits and misses of the scanner's cache of results.
+func (s *Scanner) CacheStats() cache.Stats {
+	return s.cache.Stats()
+}
+
+// InvalidateDomain removes the domain's cached results (including those of
+// scans at specific DKIM selectors) and its zones' wildcard probes, so its
+// next scan looks up every record afresh, returning how many entries were
+// removed.
+func (s *Scanner) InvalidateDomain(domain string) int {
+	domain = NormalizeDomain(domain)
+	removed := s.cache.Invalidate(domain)
+
+	for _, zone := range []string{domain, "_domainkey." + domain} {
+		if s.wildcards.Delete(zone) {
+			removed++
+		}
+	}
+
+	return removed
+}
+
 // Close closes the scanner
 func (s *Scanner) Close() {
 	s.pool.Release()
 	s.cache.Flush()
+	s.cache.Close()
+	s.wildcards.Flush()
+	s.wildcards.Close()
+	s.blocklistCache.Flush()
+	s.blocklistCache.Close()
 	s.logger.Debug().Msg("scanner closed")
 }
 
+// NormalizeDomain trims whitespace and any trailing dot from a domain, and
+// lowercases it, as DNS names are case-insensitive. It's how the scanner
+// compares domains, so anything keyed by domain alongside it should use it too.
+func NormalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
 func (s *Scanner) getNS() string {
 	return s.nameservers[int(atomic.AddUint32(&s.lastNameserverIndex, 1))%len(s.nameservers)]
 }
@@ -0,0 +1,278 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/internal/testnet"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// startDNSServer answers NS queries for any name after the given delay, and
+// serves empty answers otherwise. It returns the server's address, and a
+// count of the NS queries it has received.
+func startDNSServer(t *testing.T, delay time.Duration) (string, *atomic.Int32) {
+	t.Helper()
+
+	var nsQueries atomic.Int32
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		time.Sleep(delay)
+
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+
+		if question := req.Question[0]; question.Qtype == dns.TypeNS {
+			nsQueries.Add(1)
+			msg.Answer = append(msg.Answer, &dns.NS{
+				Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+				Ns:  "ns1." + question.Name,
+			})
+		}
+
+		_ = w.WriteMsg(msg)
+	})}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return conn.LocalAddr().String(), &nsQueries
+}
+
+func TestScanner_Deduplication(t *testing.T) {
+	logger := zerolog.Nop()
+
+	t.Run("WithinRequest", func(t *testing.T) {
+		address, nsQueries := startDNSServer(t, 0)
+
+		scanner, err := New(logger, time.Second, WithCacheDuration(0), WithConcurrentScans(4), WithNameservers([]string{address}))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com", "Example.COM", "example.org", " example.com. ")
+		require.NoError(t, err)
+		require.Len(t, results, 4)
+
+		require.Equal(t, "example.com", results[0].Domain)
+		require.Equal(t, "example.org", results[2].Domain)
+		require.Same(t, results[0], results[1])
+		require.Same(t, results[0], results[3])
+		require.Equal(t, int32(2), nsQueries.Load())
+	})
+
+	t.Run("ConcurrentRequests", func(t *testing.T) {
+		address, nsQueries := startDNSServer(t, 200*time.Millisecond)
+
+		scanner, err := New(logger, time.Second, WithCacheDuration(0), WithConcurrentScans(4), WithNameservers([]string{address}))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		var wg sync.WaitGroup
+		results := make([]*Result, 4)
+
+		for index := range results {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				scanResults, err := scanner.Scan("example.com")
+				require.NoError(t, err)
+				results[index] = scanResults[0]
+			}()
+		}
+
+		wg.Wait()
+
+		for _, result := range results[1:] {
+			require.Same(t, results[0], result)
+		}
+
+		require.Equal(t, int32(1), nsQueries.Load())
+	})
+
+	t.Run("EmptyDomain", func(t *testing.T) {
+		scanner, err := New(logger, time.Second, WithNameservers([]string{"127.0.0.1:53"}))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		_, err = scanner.Scan("example.com", " . ")
+		require.EqualError(t, err, "empty domain")
+	})
+}
+
+func TestScanner_InvalidateDomain(t *testing.T) {
+	address, nsQueries := startDNSServer(t, 0)
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithCacheDuration(time.Minute), WithNameservers([]string{address}))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	scan := func(domains ...string) {
+		_, err := scanner.Scan(domains...)
+		require.NoError(t, err)
+	}
+
+	scan("example.com", "example.org")
+	scan("example.com", "example.org")
+	require.Equal(t, int32(2), nsQueries.Load())
+
+	// the rest of the cache is kept
+	require.Positive(t, scanner.InvalidateDomain("Example.COM."))
+	scan("example.com", "example.org")
+	require.Equal(t, int32(3), nsQueries.Load())
+
+	require.Zero(t, scanner.InvalidateDomain("example.net"))
+}
+
+func TestScanner_LookupErrors(t *testing.T) {
+	t.Run("ResolverDown", func(t *testing.T) {
+		// the resolver never answers, so every query times out
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		scanner, err := New(zerolog.Nop(), 100*time.Millisecond, WithCacheDuration(time.Minute), WithNameservers([]string{conn.LocalAddr().String()}))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Equal(t, ErrLookupFailed, results[0].Error)
+		require.Error(t, results[0].Errors["ns"])
+
+		// the failure may be transient, so it isn't cached
+		again, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.NotSame(t, results[0], again[0])
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			msg := new(dns.Msg)
+			msg.SetReply(req)
+
+			switch question := req.Question[0]; {
+			case question.Name == "_dmarc.example.com.":
+				msg.Rcode = dns.RcodeRefused
+			case question.Qtype == dns.TypeNS:
+				msg.Answer = append(msg.Answer, &dns.NS{Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."})
+			}
+
+			_ = w.WriteMsg(msg)
+		})}
+
+		go func() {
+			_ = server.ActivateAndServe()
+		}()
+
+		t.Cleanup(func() { _ = server.Shutdown() })
+
+		scanner, err := New(zerolog.Nop(), time.Second, WithNameservers([]string{conn.LocalAddr().String()}))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Equal(t, "dmarc:DNS query failed with rcode 5", results[0].Error)
+		require.Len(t, results[0].Errors, 1)
+		require.EqualError(t, results[0].Errors["dmarc"], "DNS query failed with rcode 5")
+	})
+}
+
+func TestScanner_DKIMDiscovery(t *testing.T) {
+	resolver := testnet.NewResolver(t).
+		TXT("example.com", "v=spf1 -all").
+		TXT("s1._domainkey.example.com", "v=DKIM1; k=rsa; p=KEY").
+		Answer("down._domainkey.example.com", dns.TypeTXT, testnet.Answer{Err: errors.New("i/o timeout")})
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		discovery string
+		dkim      string
+	}{
+		{name: "Found", opts: []Option{WithOnlyDKIMSelectors("s1")}, discovery: DKIMDiscoveryFound, dkim: "v=DKIM1; k=rsa; p=KEY"},
+		{name: "Absent", opts: []Option{WithOnlyDKIMSelectors("s2")}, discovery: DKIMDiscoveryAbsent},
+		{name: "Failed", opts: []Option{WithOnlyDKIMSelectors("down")}, discovery: DKIMDiscoveryFailed},
+		{name: "FoundBeforeFailure", opts: []Option{WithOnlyDKIMSelectors("s1", "down")}, discovery: DKIMDiscoveryFound, dkim: "v=DKIM1; k=rsa; p=KEY"},
+		{name: "Skipped", opts: []Option{WithoutDKIMDiscovery()}, discovery: DKIMDiscoverySkipped},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scanner, err := New(zerolog.Nop(), time.Second, append(test.opts, WithResolverMiddleware(func(Resolver) Resolver {
+				return resolver
+			}))...)
+			require.NoError(t, err)
+			t.Cleanup(scanner.Close)
+
+			results, err := scanner.Scan("example.com")
+			require.NoError(t, err)
+			require.Equal(t, test.discovery, results[0].DKIMDiscovery)
+			require.Equal(t, test.dkim, results[0].DKIM)
+			require.Equal(t, "v=spf1 -all", results[0].SPF)
+
+			if test.discovery == DKIMDiscoveryFailed {
+				require.ErrorContains(t, results[0].Errors["dkim"], "i/o timeout")
+			}
+		})
+	}
+
+	// selectors supplied for a scan are looked up even with discovery disabled
+	scanner, err := New(zerolog.Nop(), time.Second, WithoutDKIMDiscovery(), WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	results, err := scanner.ScanWithDKIMSelectors([]string{"s1"}, "example.com")
+	require.NoError(t, err)
+	require.Equal(t, DKIMDiscoveryFound, results[0].DKIMDiscovery)
+}
+
+func TestScanner_ScanContext(t *testing.T) {
+	// the NS lookup answers after the scan's context is done
+	resolver := testnet.NewResolver(t).
+		Answer("example.com", dns.TypeNS, testnet.Answer{Records: []string{"example.com. 300 IN NS ns1.example.com."}, Delay: 100 * time.Millisecond}).
+		TXT("example.com", "v=spf1 -all")
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = scanner.ScanContext(ctx, "example.com")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// no further queries were issued once the context was done
+	require.Equal(t, 1, resolver.ExchangesWhere(func(string, uint16) bool { return true }))
+
+	// nor was the incomplete result cached
+	results, err := scanner.Scan("example.com")
+	require.NoError(t, err)
+	require.Equal(t, "v=spf1 -all", results[0].SPF)
+	require.Equal(t, 2, resolver.Exchanges("example.com.", dns.TypeNS))
+}
@@ -0,0 +1,49 @@
+package scanner
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// SOA is the SOA record of the zone the domain is the apex of, with its timers
+// in seconds.
+type SOA struct {
+	MName   string `json:"mname" yaml:"mname" doc:"The primary nameserver of the zone." example:"ns1.example.com"`
+	RName   string `json:"rname" yaml:"rname" doc:"The mailbox of the zone's contact, in its DNS form (the first unescaped dot stands for the @)." example:"hostmaster.example.com"`
+	Serial  uint32 `json:"serial" yaml:"serial" doc:"The serial number of the zone." example:"2024061501"`
+	Refresh uint32 `json:"refresh" yaml:"refresh" doc:"How often secondary nameservers check for changes to the zone, in seconds." example:"7200"`
+	Retry   uint32 `json:"retry" yaml:"retry" doc:"How long secondary nameservers wait to retry a failed refresh, in seconds." example:"3600"`
+	Expire  uint32 `json:"expire" yaml:"expire" doc:"How long secondary nameservers keep answering for the zone without a successful refresh, in seconds." example:"1209600"`
+	Minimum uint32 `json:"minimum" yaml:"minimum" doc:"The zone's negative caching TTL, in seconds, which resolvers cap at the record's TTL (RFC 2308)." example:"3600"`
+	TTL     uint32 `json:"ttl" yaml:"ttl" doc:"The TTL of the SOA record, in seconds." example:"3600"`
+}
+
+// getTypeSOA queries the DNS server for the SOA record of a domain. It returns
+// nil if the domain isn't the apex of a zone, as a subdomain's SOA is only
+// returned in the authority section.
+func (s *Scanner) getTypeSOA(trace *lookupTrace, domain string) (*SOA, error) {
+	answers, err := s.getDNSAnswers(trace, domain, dns.TypeSOA)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, answer := range answers {
+		// a resolver following a CNAME at the domain returns its target's SOA,
+		// which isn't the domain's
+		if record, ok := answer.(*dns.SOA); ok && strings.EqualFold(dns.Fqdn(record.Hdr.Name), dns.Fqdn(domain)) {
+			return &SOA{
+				MName:   strings.TrimSuffix(record.Ns, "."),
+				RName:   strings.TrimSuffix(record.Mbox, "."),
+				Serial:  record.Serial,
+				Refresh: record.Refresh,
+				Retry:   record.Retry,
+				Expire:  record.Expire,
+				Minimum: record.Minttl,
+				TTL:     record.Hdr.Ttl,
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,45 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_SOA(t *testing.T) {
+	resolver := &zoneResolver{
+		zone: "example.com.",
+		records: map[string]map[uint16][]dns.RR{
+			"example.com.": {
+				dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}},
+				dns.TypeSOA: {&dns.SOA{
+					Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+					Ns:  "ns1.example.com.", Mbox: "hostmaster.example.com.",
+					Serial: 2024061501, Refresh: 7200, Retry: 3600, Expire: 1209600, Minttl: 300,
+				}},
+			},
+			"mail.example.com.": {
+				dns.TypeTXT: {txt("mail.example.com.", "v=spf1 -all")},
+			},
+		},
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	results, err := scanner.Scan("example.com", "mail.example.com")
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	require.Equal(t, &SOA{MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 2024061501, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300, TTL: 3600}, results[0].SOA)
+
+	// subdomains that aren't the apex of a zone have no SOA record of their own
+	require.Empty(t, results[1].Error)
+	require.Nil(t, results[1].SOA)
+}
@@ -0,0 +1,48 @@
+package scanner
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ParseSourceAddress parses the local address outbound queries and probes are
+// sent from, such as 192.0.2.10, returning an error unless it's an IP address
+// assigned to one of the host's interfaces, so a misconfigured scanner fails
+// before any query is sent from another address.
+func ParseSourceAddress(address string) (net.IP, error) {
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid source address %q: must be an IP address", address)
+	}
+
+	// binding to the address only succeeds if it's assigned to the host
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return nil, fmt.Errorf("source address %s isn't assigned to this host: %w", ip, err)
+	}
+
+	_ = conn.Close()
+
+	return ip, nil
+}
+
+// localAddr returns the local address to bind a connection over the network
+// (such as udp or tcp-tls) to.
+func localAddr(network string, ip net.IP) net.Addr {
+	if strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: ip}
+	}
+
+	return &net.TCPAddr{IP: ip}
+}
+
+// bindSourceAddress binds the DNS clients to the source address, once the
+// options have set their protocols.
+func bindSourceAddress(ip net.IP, clients ...*dns.Client) {
+	for _, client := range clients {
+		client.Dialer = &net.Dialer{Timeout: client.Timeout, LocalAddr: localAddr(client.Net, ip)}
+	}
+}
@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSourceAddress(t *testing.T) {
+	ip, err := ParseSourceAddress(" 127.0.0.1 ")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", ip.String())
+
+	_, err = ParseSourceAddress("localhost")
+	require.ErrorContains(t, err, `invalid source address "localhost": must be an IP address`)
+
+	// a documentation address is never assigned to the host
+	_, err = ParseSourceAddress("192.0.2.1")
+	require.ErrorContains(t, err, "source address 192.0.2.1 isn't assigned to this host")
+
+	_, err = New(zerolog.Nop(), time.Second, WithSourceAddress("192.0.2.1"))
+	require.Error(t, err)
+}
+
+func TestScanner_SourceAddress(t *testing.T) {
+	// only some hosts (such as Linux) route all of 127.0.0.0/8 to the loopback interface
+	if _, err := ParseSourceAddress("127.0.0.2"); err != nil {
+		t.Skipf("can't bind to 127.0.0.2: %v", err)
+	}
+
+	var mutex sync.Mutex
+	sources := make(map[string]bool)
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		host, _, _ := net.SplitHostPort(w.RemoteAddr().String())
+
+		mutex.Lock()
+		sources[w.RemoteAddr().Network()+" "+host] = true
+		mutex.Unlock()
+
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		_ = w.WriteMsg(msg)
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	for _, server := range []*dns.Server{{PacketConn: conn, Handler: handler}, {Listener: listener, Handler: handler}} {
+		go func(server *dns.Server) {
+			_ = server.ActivateAndServe()
+		}(server)
+
+		t.Cleanup(func() {
+			_ = server.Shutdown()
+		})
+	}
+
+	for _, protocol := range []string{"udp", "tcp"} {
+		scanner, err := New(zerolog.Nop(), time.Second, WithDNSProtocol(protocol), WithSourceAddress("127.0.0.2"), WithNameservers([]string{conn.LocalAddr().String()}))
+		require.NoError(t, err)
+
+		_, err = scanner.Scan("example.com")
+		require.NoError(t, err)
+		scanner.Close()
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	require.Equal(t, map[string]bool{"udp 127.0.0.2": true, "tcp 127.0.0.2": true}, sources)
+}
@@ -0,0 +1,190 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSPFRedirects is the longest chain of redirect= modifiers followed. Each
+// redirect costs one of the DNS lookups an SPF record may need to be evaluated,
+// so a longer chain fails at receivers anyway, and a loop isn't followed
+// forever.
+const maxSPFRedirects = maxSPFLookups
+
+// SPFRedirect is a domain an SPF record's redirect= modifier hands its policy
+// over to, along with that domain's own SPF record.
+type SPFRedirect struct {
+	Domain string `json:"domain" yaml:"domain" doc:"The domain redirected to." example:"_spf.example.net"`
+	Record string `json:"record,omitempty" yaml:"record,omitempty" doc:"The SPF record of the domain redirected to, if it has one." example:"v=spf1 include:_spf.google.com ~all"`
+}
+
+// SPFInclude is a domain an SPF record's include mechanism leads to, along
+// with that domain's own SPF record.
+type SPFInclude struct {
+	Domain string `json:"domain" yaml:"domain" doc:"The domain included." example:"_spf.example.net"`
+	Record string `json:"record,omitempty" yaml:"record,omitempty" doc:"The SPF record of the domain included, after following any redirect= modifier, if it has one." example:"v=spf1 ip4:198.51.100.0/24 -all"`
+}
+
+// WithSPFIncludes enables resolving the include mechanisms of each domain's
+// SPF record (and of each record they lead to), so the addresses they
+// authorize can be compared with the record's own ip4 and ip6 mechanisms.
+// It's disabled by default, as it adds a lookup per included domain to every
+// scan.
+func WithSPFIncludes() Option {
+	return func(s *Scanner) error {
+		s.spfIncludes = true
+		return nil
+	}
+}
+
+// EffectiveSPF returns the SPF record that applies to the domain's mail: the
+// record of the end of its chain of redirects, if it has any (see
+// effectiveSPF).
+func (r *Result) EffectiveSPF() string {
+	return effectiveSPF(r.SPF, r.SPFRedirects)
+}
+
+// getSPFRedirects follows the redirect= modifier of a domain's SPF record, and
+// of each record it leads to, returning every domain redirected to in order.
+// A redirect is only followed if its record has no all mechanism, as receivers
+// ignore it otherwise (RFC 7208, section 6.1). It stops at a domain that was
+// already redirected to (a loop), which is included, at a domain without an
+// SPF record, or once maxSPFRedirects are followed.
+func (s *Scanner) getSPFRedirects(trace *lookupTrace, domain, record string) ([]SPFRedirect, error) {
+	var redirects []SPFRedirect
+
+	seen := map[string]struct{}{NormalizeDomain(domain): {}}
+
+	for target := spfRedirectTarget(record); target != ""; target = spfRedirectTarget(record) {
+		if len(redirects) == maxSPFRedirects {
+			break
+		}
+
+		var err error
+		if record, err = s.getSPFRecord(trace, target); err != nil {
+			return nil, fmt.Errorf("redirect %s: %w", target, err)
+		}
+
+		redirects = append(redirects, SPFRedirect{Domain: target, Record: record})
+
+		if _, ok := seen[target]; ok {
+			// the chain loops back on itself
+			break
+		}
+
+		seen[target] = struct{}{}
+	}
+
+	return redirects, nil
+}
+
+// getSPFIncludes follows the include mechanisms of a domain's SPF record, and
+// of each record they lead to, returning every domain included in the order
+// receivers evaluate them. Each domain is only included once, so loops aren't
+// followed, and includes with macros (which depend on the message) aren't
+// followed at all. It stops once maxSPFLookups domains are included, as
+// receivers would return a permerror past that.
+func (s *Scanner) getSPFIncludes(trace *lookupTrace, domain, record string) ([]SPFInclude, error) {
+	var includes []SPFInclude
+
+	seen := map[string]struct{}{NormalizeDomain(domain): {}}
+
+	var resolve func(record string) error
+	resolve = func(record string) error {
+		for _, target := range spfIncludeTargets(record) {
+			if len(includes) == maxSPFLookups {
+				return nil
+			}
+
+			if _, ok := seen[target]; ok {
+				continue
+			}
+			seen[target] = struct{}{}
+
+			included, err := s.getTypeSPF(trace, target)
+			if err != nil {
+				return fmt.Errorf("include %s: %w", target, err)
+			}
+
+			includes = append(includes, SPFInclude{Domain: target, Record: included})
+
+			if err = resolve(included); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := resolve(record); err != nil {
+		return nil, err
+	}
+
+	return includes, nil
+}
+
+// spfIncludeTargets returns the normalized domains of the SPF record's include
+// mechanisms, in order, skipping those with macros.
+func spfIncludeTargets(record string) []string {
+	if !strings.HasPrefix(record, SPFPrefix) {
+		return nil
+	}
+
+	var targets []string
+
+	for _, term := range strings.Fields(strings.ToLower(record))[1:] {
+		value, ok := strings.CutPrefix(strings.TrimLeft(term, "+-~?"), "include:")
+		if !ok || value == "" || strings.ContainsRune(value, '%') {
+			continue
+		}
+
+		targets = append(targets, NormalizeDomain(value))
+	}
+
+	return targets
+}
+
+// effectiveSPF returns the SPF record that applies, given a domain's own
+// record and the redirects it was followed through: the last redirect's
+// record, unless that record still redirects (as it loops, or the chain is
+// too long), in which case receivers return a permerror and no record applies.
+func effectiveSPF(record string, redirects []SPFRedirect) string {
+	if len(redirects) == 0 {
+		return record
+	}
+
+	last := redirects[len(redirects)-1].Record
+	if spfRedirectTarget(last) != "" {
+		return ""
+	}
+
+	return last
+}
+
+// spfRedirectTarget returns the normalized domain of the SPF record's
+// redirect= modifier, if it's followed: the record has no all mechanism, and
+// the domain has no macros, which depend on the message. Otherwise, it returns
+// an empty string.
+func spfRedirectTarget(record string) string {
+	if !strings.HasPrefix(record, SPFPrefix) {
+		return ""
+	}
+
+	var target string
+
+	for _, term := range strings.Fields(strings.ToLower(record))[1:] {
+		if strings.TrimLeft(term, "+-~?") == "all" {
+			return ""
+		}
+
+		if value, ok := strings.CutPrefix(term, "redirect="); ok {
+			target = value
+		}
+	}
+
+	if strings.ContainsRune(target, '%') {
+		return ""
+	}
+
+	return NormalizeDomain(target)
+}
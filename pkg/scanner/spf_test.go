@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_SPFRedirects(t *testing.T) {
+	records := map[string]string{
+		"none.example.com.":    "v=spf1 include:_spf.example.net -all",
+		"dead.example.com.":    "v=spf1 redirect=_spf.example.net ~all",
+		"one.example.com.":     "v=spf1 redirect=_spf.example.net",
+		"three.example.com.":   "v=spf1 redirect=hop1.example.net",
+		"hop1.example.net.":    "v=spf1 redirect=HOP2.example.net.",
+		"hop2.example.net.":    "v=spf1 redirect=_spf.example.net",
+		"_spf.example.net.":    "v=spf1 ip4:192.0.2.0/24 -all",
+		"loop.example.com.":    "v=spf1 redirect=loop.example.net",
+		"loop.example.net.":    "v=spf1 redirect=loop.example.com",
+		"missing.example.com.": "v=spf1 redirect=missing.example.net",
+		"macro.example.com.":   "v=spf1 redirect=%{d}._spf.example.net",
+	}
+
+	resolver := &zoneResolver{records: make(map[string]map[uint16][]dns.RR)}
+	for name, record := range records {
+		resolver.records[name] = map[uint16][]dns.RR{dns.TypeTXT: {txt(name, record)}}
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	effective := "v=spf1 ip4:192.0.2.0/24 -all"
+
+	tests := []struct {
+		name      string
+		domain    string
+		redirects []SPFRedirect
+		effective string
+	}{
+		{name: "NoRedirect", domain: "none.example.com", effective: records["none.example.com."]},
+		{name: "IgnoredWithAll", domain: "dead.example.com", effective: records["dead.example.com."]},
+		{name: "OneHop", domain: "one.example.com", redirects: []SPFRedirect{{Domain: "_spf.example.net", Record: effective}}, effective: effective},
+		{name: "ThreeHops", domain: "three.example.com", redirects: []SPFRedirect{
+			{Domain: "hop1.example.net", Record: records["hop1.example.net."]},
+			{Domain: "hop2.example.net", Record: records["hop2.example.net."]},
+			{Domain: "_spf.example.net", Record: effective},
+		}, effective: effective},
+		{name: "Loop", domain: "loop.example.com", redirects: []SPFRedirect{
+			{Domain: "loop.example.net", Record: records["loop.example.net."]},
+			{Domain: "loop.example.com", Record: records["loop.example.com."]},
+		}},
+		{name: "MissingTarget", domain: "missing.example.com", redirects: []SPFRedirect{{Domain: "missing.example.net"}}},
+		{name: "Macro", domain: "macro.example.com", effective: records["macro.example.com."]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := scanner.Scan(test.domain)
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+
+			// the SPF record is the one published at the domain, whatever it redirects to
+			require.Equal(t, records[test.domain+"."], results[0].SPF)
+			require.Equal(t, test.redirects, results[0].SPFRedirects)
+			require.Equal(t, test.effective, results[0].EffectiveSPF())
+
+			record, err := scanner.getTypeSPF(nil, test.domain)
+			require.NoError(t, err)
+			require.Equal(t, test.effective, record)
+		})
+	}
+}
+
+func TestScanner_SPFRedirectsLimit(t *testing.T) {
+	resolver := &zoneResolver{records: make(map[string]map[uint16][]dns.RR)}
+
+	// every domain redirects to the next, so the chain is longer than the lookup limit
+	for hop := range maxSPFRedirects + 2 {
+		name := dns.Fqdn(spfHop(hop))
+		resolver.records[name] = map[uint16][]dns.RR{dns.TypeTXT: {txt(name, "v=spf1 redirect="+spfHop(hop+1))}}
+	}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	redirects, err := scanner.getSPFRedirects(nil, spfHop(0), "v=spf1 redirect="+spfHop(1))
+	require.NoError(t, err)
+	require.Len(t, redirects, maxSPFRedirects)
+	require.Empty(t, effectiveSPF("v=spf1 redirect="+spfHop(1), redirects))
+}
+
+func spfHop(hop int) string {
+	return "hop" + string(rune('a'+hop)) + ".example.com"
+}
+
+func TestScanner_SPFIncludes(t *testing.T) {
+	records := map[string]string{
+		"example.com.":            "v=spf1 ip4:203.0.113.5 include:_spf.example.net include:%{d}.example.org include:loop.example.com -all",
+		"_spf.example.net.":       "v=spf1 ip4:198.51.100.0/24 include:_nested.example.net ~all",
+		"_nested.example.net.":    "v=spf1 redirect=_netblocks.example.net",
+		"_netblocks.example.net.": "v=spf1 ip6:2001:db8::/32 -all",
+		"loop.example.com.":       "v=spf1 include:example.com include:_spf.example.net -all",
+		"redirected.example.com.": "v=spf1 redirect=_spf.example.net",
+		"chain.example.com.":      "v=spf1 include:c1.example.com -all",
+	}
+
+	// chain.example.com includes c1 through c11, one more than SPF allows
+	for index := 1; index <= 11; index++ {
+		records[fmt.Sprintf("c%d.example.com.", index)] = fmt.Sprintf("v=spf1 include:c%d.example.com -all", index+1)
+	}
+
+	resolver := &zoneResolver{records: make(map[string]map[uint16][]dns.RR)}
+	for name, record := range records {
+		resolver.records[name] = map[uint16][]dns.RR{dns.TypeTXT: {txt(name, record)}}
+	}
+
+	newScanner := func(t *testing.T, opts ...Option) *Scanner {
+		scanner, err := New(zerolog.Nop(), time.Second, append(opts, WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		return scanner
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		results, err := newScanner(t).Scan("example.com")
+		require.NoError(t, err)
+		require.Nil(t, results[0].SPFIncludes)
+	})
+
+	scanner := newScanner(t, WithSPFIncludes())
+	require.True(t, scanner.Config().SPFIncludes)
+
+	tests := []struct {
+		name     string
+		domain   string
+		includes []SPFInclude
+	}{
+		{name: "Nested", domain: "example.com", includes: []SPFInclude{
+			{Domain: "_spf.example.net", Record: records["_spf.example.net."]},
+			{Domain: "_nested.example.net", Record: records["_netblocks.example.net."]},
+			{Domain: "loop.example.com", Record: records["loop.example.com."]},
+		}},
+		{name: "Redirected", domain: "redirected.example.com", includes: []SPFInclude{
+			{Domain: "_nested.example.net", Record: records["_netblocks.example.net."]},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := scanner.Scan(test.domain)
+			require.NoError(t, err)
+			require.Equal(t, test.includes, results[0].SPFIncludes)
+		})
+	}
+
+	t.Run("Limit", func(t *testing.T) {
+		results, err := scanner.Scan("chain.example.com")
+		require.NoError(t, err)
+		require.Len(t, results[0].SPFIncludes, 10)
+		require.Equal(t, "c10.example.com", results[0].SPFIncludes[9].Domain)
+	})
+}
@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// maxSubdomainLookups bounds the number of sending subdomains of a domain that
+// are looked up at once.
+const maxSubdomainLookups = 4
+
+// DefaultSendingSubdomains are the subdomains commonly used to send
+// marketing and transactional mail, which are checked by
+// WithSendingSubdomains if no subdomains are given.
+var DefaultSendingSubdomains = []string{"bounce", "em", "email", "mail", "marketing", "mg", "news", "newsletter", "send"}
+
+// SendingSubdomain holds the mail authentication records of a subdomain that
+// exists (as it has address, MX or TXT records).
+type SendingSubdomain struct {
+	Name         string   `json:"name" yaml:"name" doc:"The subdomain's name." example:"em.example.com"`
+	MX           []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"The MX records for the subdomain." example:"mx.sendgrid.net"`
+	SPF          string   `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The SPF record for the subdomain." example:"v=spf1 include:sendgrid.net -all"`
+	DKIM         string   `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"The DKIM record for the subdomain." example:"v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`
+	DKIMSelector string   `json:"dkimSelector,omitempty" yaml:"dkimSelector,omitempty" doc:"The selector the DKIM record was found at." example:"s1"`
+	DMARC        string   `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The subdomain's own DMARC record. Without one, the domain's DMARC record applies to it." example:"v=DMARC1; p=reject"`
+}
+
+// WithSendingSubdomains enables checking the given subdomains of each domain
+// (DefaultSendingSubdomains if none are given) for their own SPF, DKIM and
+// DMARC records. It's disabled by default, as it multiplies the number of
+// queries per scan.
+func WithSendingSubdomains(subdomains ...string) Option {
+	return func(s *Scanner) error {
+		if len(subdomains) == 0 {
+			subdomains = DefaultSendingSubdomains
+		}
+
+		normalized := make([]string, 0, len(subdomains))
+
+		for _, subdomain := range subdomains {
+			subdomain = NormalizeDomain(subdomain)
+
+			// the subdomain's labels are validated as they would be under any domain
+			if subdomain == "" || strings.HasPrefix(subdomain, ".") || ValidateDomain(subdomain+".example.com") != nil {
+				return fmt.Errorf("invalid sending subdomain: %q", subdomain)
+			}
+
+			normalized = append(normalized, subdomain)
+		}
+
+		if len(normalized) == 0 {
+			return errors.New("no sending subdomains provided")
+		}
+
+		s.sendingSubdomains = normalized
+
+		return nil
+	}
+}
+
+// getSendingSubdomains looks up each of the sending subdomains of a domain,
+// returning those that exist in the configured order. A subdomain that's only
+// answered by the zone's wildcard TXT record doesn't count as existing.
+func (s *Scanner) getSendingSubdomains(trace *lookupTrace, domain string) ([]SendingSubdomain, error) {
+	var (
+		errs  []error
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+
+	found := make([]*SendingSubdomain, len(s.sendingSubdomains))
+	slots := make(chan struct{}, maxSubdomainLookups)
+
+	for index, subdomain := range s.sendingSubdomains {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			// each subdomain has its own trace, as traces aren't safe for concurrent use
+			subdomainTrace := &lookupTrace{ctx: trace.ctx}
+			result, err := s.getSendingSubdomain(subdomainTrace, subdomain+"."+domain, domain)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", subdomain, err))
+			}
+
+			trace.tcp = trace.tcp || subdomainTrace.tcp
+			found[index] = result
+		}()
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	// the lookup ran, so an empty (rather than nil) slice reports that no subdomains exist
+	subdomains := make([]SendingSubdomain, 0, len(found))
+	for _, subdomain := range found {
+		if subdomain != nil {
+			subdomains = append(subdomains, *subdomain)
+		}
+	}
+
+	return subdomains, nil
+}
+
+// getSendingSubdomain returns the records of a subdomain of the domain, or nil
+// if it doesn't exist.
+func (s *Scanner) getSendingSubdomain(trace *lookupTrace, name, domain string) (*SendingSubdomain, error) {
+	exists := false
+
+	for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		addresses, err := s.getDNSRecords(trace, name, recordType)
+		if err != nil {
+			return nil, err
+		}
+
+		exists = exists || len(addresses) > 0
+	}
+
+	subdomain := &SendingSubdomain{Name: name}
+
+	var err error
+	if subdomain.MX, err = s.getDNSRecords(trace, name, dns.TypeMX); err != nil {
+		return nil, err
+	}
+
+	records, err := s.getDNSRecords(trace, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) > 0 {
+		wildcard, err := s.getWildcardRecords(domain)
+		if err != nil {
+			return nil, err
+		}
+
+		exists = exists || !isWildcardAnswer(wildcard, records)
+	}
+
+	if !exists && len(subdomain.MX) == 0 {
+		return nil, nil
+	}
+
+	if subdomain.SPF, err = s.getTypeSPF(trace, name); err != nil {
+		return nil, err
+	}
+
+	if subdomain.DKIMSelector, subdomain.DKIM, _, err = s.getTypeDKIM(trace, name); err != nil {
+		return nil, err
+	}
+
+	if subdomain.DMARC, _, err = s.getTypeDMARC(trace, name); err != nil {
+		return nil, err
+	}
+
+	return subdomain, nil
+}
@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// zoneResolver serves the records of a zone, keyed by name and type, with a
+// wildcard TXT record for any other name under the zone if one is given. The
+// names in rcodes are answered with their response code instead, and any
+// other name with NXDOMAIN if nxdomain is set.
+type zoneResolver struct {
+	zone     string
+	records  map[string]map[uint16][]dns.RR
+	wildcard string
+	rcodes   map[string]int
+	nxdomain bool
+}
+
+func (r *zoneResolver) Exchange(msg *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	question := msg.Question[0]
+	name := strings.ToLower(question.Name)
+
+	reply := new(dns.Msg)
+	reply.SetReply(msg)
+
+	if rcode, ok := r.rcodes[name]; ok {
+		reply.Rcode = rcode
+	} else if records, ok := r.records[name]; ok {
+		reply.Answer = append(reply.Answer, records[question.Qtype]...)
+	} else if r.wildcard != "" && question.Qtype == dns.TypeTXT && strings.HasSuffix(name, "."+r.zone) {
+		reply.Answer = append(reply.Answer, txt(name, r.wildcard))
+	} else if r.nxdomain {
+		reply.Rcode = dns.RcodeNameError
+	}
+
+	return reply, 0, nil
+}
+
+func txt(name, record string) dns.RR {
+	return &dns.TXT{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{record}}
+}
+
+func TestScanner_SendingSubdomains(t *testing.T) {
+	resolver := &zoneResolver{
+		zone: "example.com.",
+		records: map[string]map[uint16][]dns.RR{
+			"example.com.": {
+				dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}},
+			},
+			"em.example.com.": {
+				dns.TypeMX:  {&dns.MX{Hdr: dns.RR_Header{Name: "em.example.com.", Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 300}, Preference: 10, Mx: "mx.sendgrid.net."}},
+				dns.TypeTXT: {txt("em.example.com.", "v=spf1 include:sendgrid.net -all")},
+			},
+			"s1._domainkey.em.example.com.": {
+				dns.TypeTXT: {txt("s1._domainkey.em.example.com.", "v=DKIM1; k=rsa; p=KEY")},
+			},
+			"_dmarc.em.example.com.": {
+				dns.TypeTXT: {txt("_dmarc.em.example.com.", "v=DMARC1; p=none")},
+			},
+			"news.example.com.": {
+				dns.TypeA: {&dns.A{Hdr: dns.RR_Header{Name: "news.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: []byte{192, 0, 2, 1}}},
+			},
+		},
+		wildcard: "google-site-verification=abc123",
+	}
+
+	scan := func(t *testing.T, opts ...Option) *Result {
+		t.Helper()
+
+		scanner, err := New(zerolog.Nop(), time.Second, append(opts, WithResolverMiddleware(func(Resolver) Resolver {
+			return resolver
+		}))...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+
+		return results[0]
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		require.Nil(t, scan(t).SendingSubdomains)
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		// subdomains only answered by the wildcard don't exist
+		result := scan(t, WithSendingSubdomains())
+		require.Equal(t, []SendingSubdomain{
+			{Name: "em.example.com", MX: []string{"mx.sendgrid.net."}, SPF: "v=spf1 include:sendgrid.net -all", DKIM: "v=DKIM1; k=rsa; p=KEY", DKIMSelector: "s1", DMARC: "v=DMARC1; p=none"},
+			{Name: "news.example.com"},
+		}, result.SendingSubdomains)
+		require.Contains(t, result.Timings, "subdomains_lookup")
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		result := scan(t, WithSendingSubdomains("BOUNCE", "news"))
+		require.Equal(t, []SendingSubdomain{{Name: "news.example.com"}}, result.SendingSubdomains)
+
+		// the lookup ran, but none of the subdomains exist
+		result = scan(t, WithSendingSubdomains("bounce"))
+		require.NotNil(t, result.SendingSubdomains)
+		require.Empty(t, result.SendingSubdomains)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, subdomain := range []string{"", ".em", "em..example", "em_ bad"} {
+			_, err := New(zerolog.Nop(), time.Second, WithSendingSubdomains(subdomain))
+			require.Error(t, err, subdomain)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// getTXTRecords queries the DNS server for every TXT record published at a
+// domain, joining the strings each is split across, along with the size in
+// bytes of the DNS answer containing them. The size is that of the answer as
+// a nameserver would send it (with name compression and an EDNS0 OPT record),
+// so it can be compared to the buffer sizes resolvers advertise.
+func (s *Scanner) getTXTRecords(trace *lookupTrace, domain string) ([]string, int, error) {
+	answers, err := s.getDNSAnswers(trace, domain, dns.TypeTXT)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var records []string
+	for _, answer := range answers {
+		if txt, ok := answer.(*dns.TXT); ok {
+			records = append(records, strings.Join(txt.Txt, ""))
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, 0, nil
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), dns.TypeTXT)
+	msg.Answer = answers
+	msg.Compress = true
+	msg.SetEdns0(s.dnsBuffer, true)
+
+	return records, msg.Len(), nil
+}
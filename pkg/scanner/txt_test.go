@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_TXT(t *testing.T) {
+	// an apex accumulated over the years: verification tokens, a long SPF
+	// record split across strings, and one pasted into another record
+	spf := &dns.TXT{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{
+		"v=spf1 include:_spf.google.com include:spf.protection.outlook.com ",
+		"include:sendgrid.net ~all",
+	}}
+
+	resolver := &zoneResolver{records: map[string]map[uint16][]dns.RR{
+		"example.com.": {dns.TypeTXT: {
+			txt("example.com.", "google-site-verification=rXOxyZounnZasA8Z7oaD3c14JdjS9aKSWvsR1EbUSIQ"),
+			spf,
+			txt("example.com.", "MS=ms12345678 v=spf1 include:mailgun.org ~all"),
+			txt("example.com.", "facebook-domain-verification=abcdefghijklmnopqrstuvwxyz0123"),
+		}},
+		"empty.example.com.": {dns.TypeNS: {&dns.NS{Hdr: dns.RR_Header{Name: "empty.example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns1.example.com."}}},
+	}}
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithResolverMiddleware(func(Resolver) Resolver {
+		return resolver
+	}))
+	require.NoError(t, err)
+	t.Cleanup(scanner.Close)
+
+	results, err := scanner.Scan("example.com", "empty.example.com")
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	// each record's strings are joined, without merging them with other records
+	require.Equal(t, []string{
+		"google-site-verification=rXOxyZounnZasA8Z7oaD3c14JdjS9aKSWvsR1EbUSIQ",
+		strings.Join(spf.Txt, ""),
+		"MS=ms12345678 v=spf1 include:mailgun.org ~all",
+		"facebook-domain-verification=abcdefghijklmnopqrstuvwxyz0123",
+	}, results[0].TXT)
+
+	// the size is that of the whole answer, so it's larger than the records alone
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeTXT)
+	msg.Answer = resolver.records["example.com."][dns.TypeTXT]
+	msg.Compress = true
+	msg.SetEdns0(DefaultDNSBuffer, true)
+	require.Equal(t, msg.Len(), results[0].TXTSize)
+	require.Greater(t, results[0].TXTSize, len(strings.Join(results[0].TXT, "")))
+
+	require.Nil(t, results[1].TXT)
+	require.Zero(t, results[1].TXTSize)
+}
@@ -0,0 +1,142 @@
+package scanner
+
+//go:generate curl -sSf -o tlds.txt https://data.iana.org/TLD/tlds-alpha-by-domain.txt
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxDomainLength is the longest a domain name may be, excluding the trailing dot.
+	maxDomainLength = 253
+
+	// maxLabelLength is the longest a single label of a domain name may be.
+	maxLabelLength = 63
+)
+
+var (
+	//go:embed tlds.txt
+	embeddedTLDs string
+
+	tlds      map[string]struct{}
+	tldsMutex sync.RWMutex
+)
+
+// DomainError describes why a domain name was rejected before scanning.
+type DomainError struct {
+	Domain string
+	Reason string
+}
+
+func init() {
+	if err := LoadTLDs(strings.NewReader(embeddedTLDs)); err != nil {
+		panic(err)
+	}
+}
+
+func (e *DomainError) Error() string {
+	return fmt.Sprintf("invalid domain %q: %s", e.Domain, e.Reason)
+}
+
+// LoadTLDs replaces the list of known top-level domains, using the format of
+// IANA's list (https://data.iana.org/TLD/tlds-alpha-by-domain.txt): one TLD
+// per line, with comments prefixed by "#". This allows the embedded list to be
+// refreshed without rebuilding.
+func LoadTLDs(r io.Reader) error {
+	loaded := make(map[string]struct{})
+
+	lineScanner := bufio.NewScanner(r)
+	for lineScanner.Scan() {
+		line := strings.TrimSpace(lineScanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		loaded[strings.ToLower(line)] = struct{}{}
+	}
+
+	if err := lineScanner.Err(); err != nil {
+		return fmt.Errorf("failed to read TLD list: %w", err)
+	}
+
+	if len(loaded) == 0 {
+		return errors.New("TLD list is empty")
+	}
+
+	tldsMutex.Lock()
+	tlds = loaded
+	tldsMutex.Unlock()
+
+	return nil
+}
+
+// ValidateDomain checks that a domain is syntactically valid, and that its TLD
+// exists, without making any network requests. The domain is normalized first
+// (see Scan), so positions refer to the normalized domain, counting from 1.
+// Any error returned is a *DomainError.
+func ValidateDomain(domain string) error {
+	normalized := NormalizeDomain(domain)
+
+	reject := func(format string, args ...any) error {
+		return &DomainError{Domain: domain, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if normalized == "" {
+		return reject("domain is empty")
+	}
+
+	if len(normalized) > maxDomainLength {
+		return reject("domain is %d characters long, exceeding the maximum of %d", len(normalized), maxDomainLength)
+	}
+
+	for index, char := range normalized {
+		// underscores are permitted for service labels, such as _dmarc
+		if (char < 'a' || char > 'z') && (char < '0' || char > '9') && char != '-' && char != '.' && char != '_' {
+			return reject("invalid character %q at position %d", char, index+1)
+		}
+	}
+
+	labels := strings.Split(normalized, ".")
+
+	position := 1
+	for _, label := range labels {
+		switch {
+		case label == "":
+			return reject("empty label at position %d", position)
+		case len(label) > maxLabelLength:
+			return reject("label %q is %d characters long, exceeding the maximum of %d", label, len(label), maxLabelLength)
+		case strings.HasPrefix(label, "-"):
+			return reject("label %q begins with a hyphen", label)
+		case strings.HasSuffix(label, "-"):
+			return reject("label %q ends with a hyphen", label)
+		}
+
+		position += len(label) + 1
+	}
+
+	tld := labels[len(labels)-1]
+	if strings.Trim(tld, "0123456789") == "" {
+		return reject("top-level domain %q is numeric", tld)
+	}
+
+	tldsMutex.RLock()
+	_, ok := tlds[tld]
+	tldsMutex.RUnlock()
+
+	if !ok {
+		return reject("top-level domain %q does not exist", tld)
+	}
+
+	// domains are registered below public suffixes, which publish no records of their own for mail
+	if isPublicSuffix(normalized) {
+		return reject("%s is a public suffix, under which domains are registered, rather than a registered domain", normalized)
+	}
+
+	return nil
+}
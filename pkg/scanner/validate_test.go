@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		name   string
+		domain string
+		reason string
+	}{
+		{name: "Valid", domain: "example.com"},
+		{name: "ValidSubdomain", domain: "mail.example.co.uk"},
+		{name: "ValidServiceLabel", domain: "_dmarc.example.com"},
+		{name: "ValidPunycode", domain: "xn--bcher-kva.de"},
+		{name: "ValidNormalized", domain: " Example.COM. "},
+		{name: "Empty", domain: " ", reason: "domain is empty"},
+		{name: "Space", domain: "exa mple.com", reason: "invalid character ' ' at position 4"},
+		{name: "Scheme", domain: "http//example", reason: "invalid character '/' at position 5"},
+		{name: "Unicode", domain: "bücher.de", reason: "invalid character 'ü' at position 2"},
+		{name: "EmptyLabel", domain: "example..com", reason: "empty label at position 9"},
+		{name: "LabelTooLong", domain: strings.Repeat("a", 64) + ".com", reason: "label \"" + strings.Repeat("a", 64) + "\" is 64 characters long, exceeding the maximum of 63"},
+		{name: "DomainTooLong", domain: strings.Repeat("abcdefghi.", 26) + "com", reason: "domain is 263 characters long, exceeding the maximum of 253"},
+		{name: "LeadingHyphen", domain: "-example.com", reason: `label "-example" begins with a hyphen`},
+		{name: "TrailingHyphen", domain: "example-.com", reason: `label "example-" ends with a hyphen`},
+		{name: "NumericTLD", domain: "192.168.0.1", reason: `top-level domain "1" is numeric`},
+		{name: "UnknownTLD", domain: "example.invalidtld", reason: `top-level domain "invalidtld" does not exist`},
+		{name: "PublicSuffix", domain: "co.uk", reason: "co.uk is a public suffix, under which domains are registered, rather than a registered domain"},
+		{name: "TLD", domain: "COM.", reason: "com is a public suffix, under which domains are registered, rather than a registered domain"},
+		{name: "WildcardPublicSuffix", domain: "nakahara.kawasaki.jp", reason: "nakahara.kawasaki.jp is a public suffix, under which domains are registered, rather than a registered domain"},
+		{name: "PublicSuffixException", domain: "city.kawasaki.jp"},
+		{name: "PrivatePublicSuffix", domain: "github.io"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateDomain(test.domain)
+			if test.reason == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			var domainErr *DomainError
+			require.True(t, errors.As(err, &domainErr))
+			require.Equal(t, test.domain, domainErr.Domain)
+			require.Equal(t, test.reason, domainErr.Reason)
+		})
+	}
+}
+
+func TestLoadTLDs(t *testing.T) {
+	t.Cleanup(func() {
+		require.NoError(t, LoadTLDs(strings.NewReader(embeddedTLDs)))
+	})
+
+	require.NoError(t, LoadTLDs(strings.NewReader("# Version 1\nCOM\nINTERNAL\n")))
+	require.NoError(t, ValidateDomain("host.internal"))
+	require.Error(t, ValidateDomain("example.org"))
+
+	require.EqualError(t, LoadTLDs(strings.NewReader("# only a comment\n")), "TLD list is empty")
+	require.NoError(t, ValidateDomain("host.internal"), "a failed load shouldn't replace the list")
+}
+
+func FuzzValidateDomain(f *testing.F) {
+	for _, seed := range []string{"example.com", "exa mple.com", "http//example", "-a.b-", "a..b", "1.2.3.4", "bücher.de", ".", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, domain string) {
+		err := ValidateDomain(domain)
+		if err == nil {
+			return
+		}
+
+		var domainErr *DomainError
+		if !errors.As(err, &domainErr) || domainErr.Reason == "" {
+			t.Fatalf("expected a *DomainError with a reason, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCadence is wrapped by every error returned for a schedule's
+// interval or cron expression.
+var ErrInvalidCadence = errors.New("invalid cadence")
+
+type (
+	// cadence returns the time of a schedule's next run after the given time.
+	cadence interface {
+		next(after time.Time) time.Time
+	}
+
+	// intervalCadence runs a schedule at a fixed interval since its last run.
+	intervalCadence time.Duration
+
+	// cronCadence runs a schedule at the times matching a standard five field
+	// cron expression (minute, hour, day of month, month and day of week),
+	// evaluated in UTC. Each field is a bitset of the values it matches.
+	cronCadence struct {
+		minutes, hours, days, months, weekdays uint64
+
+		// anyDay and anyWeekday are true if their field is unrestricted (starts
+		// with *). As with cron, if both day fields are restricted, a day only
+		// has to match either of them.
+		anyDay, anyWeekday bool
+	}
+
+	// cronField describes the values accepted by a field of a cron expression.
+	cronField struct {
+		name     string
+		min, max int
+		names    map[string]int
+	}
+)
+
+var (
+	cronMonths = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+
+	// cronWeekdays accepts both 0 and 7 as Sunday.
+	cronWeekdays = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	cronFields = []cronField{
+		{name: "minute", min: 0, max: 59},
+		{name: "hour", min: 0, max: 23},
+		{name: "day of month", min: 1, max: 31},
+		cronMonths,
+		cronWeekdays,
+	}
+)
+
+// parseCadence parses a schedule's cadence, which is either an interval (a Go
+// duration of at least minInterval, such as "6h") or a cron expression.
+func parseCadence(interval, cron string, minInterval time.Duration) (cadence, error) {
+	switch {
+	case interval != "" && cron != "":
+		return nil, fmt.Errorf("%w: specify either an interval or a cron expression, not both", ErrInvalidCadence)
+	case interval != "":
+		duration, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCadence, err)
+		}
+
+		if duration < minInterval {
+			return nil, fmt.Errorf("%w: the interval must be at least %v", ErrInvalidCadence, minInterval)
+		}
+
+		return intervalCadence(duration), nil
+	case cron != "":
+		return parseCron(cron)
+	}
+
+	return nil, fmt.Errorf("%w: specify an interval or a cron expression", ErrInvalidCadence)
+}
+
+func (c intervalCadence) next(after time.Time) time.Time {
+	return after.Add(time.Duration(c))
+}
+
+// parseCron parses a five field cron expression. Each field may be *, a
+// value, a range (such as 1-5) or a comma separated list of them, optionally
+// followed by a step (such as */15). Months and days of the week may also be
+// given by their three letter names.
+func parseCron(expression string) (cadence, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("%w: cron expression %q must have %d fields, found %d", ErrInvalidCadence, expression, len(cronFields), len(fields))
+	}
+
+	sets := make([]uint64, len(fields))
+
+	for index, field := range fields {
+		set, err := cronFields[index].parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCadence, err)
+		}
+
+		sets[index] = set
+	}
+
+	c := cronCadence{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     strings.HasPrefix(fields[2], "*"),
+		anyWeekday: strings.HasPrefix(fields[4], "*"),
+	}
+
+	// Sunday may be given as 7, but time.Weekday numbers it 0
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+
+	if c.next(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("%w: cron expression %q never matches", ErrInvalidCadence, expression)
+	}
+
+	return c, nil
+}
+
+// parse returns the bitset of the values matched by a single field.
+func (f cronField) parse(field string) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepText, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepText)
+			}
+		}
+
+		low, high := f.min, f.max
+
+		if valueRange != "*" {
+			lowText, highText, isRange := strings.Cut(valueRange, "-")
+
+			var err error
+			if low, err = f.value(lowText); err != nil {
+				return 0, err
+			}
+
+			high = low
+
+			if isRange {
+				if high, err = f.value(highText); err != nil {
+					return 0, err
+				}
+
+				if high < low {
+					return 0, fmt.Errorf("invalid %s range %q", f.name, valueRange)
+				}
+			} else if hasStep {
+				// a value with a step, such as 5/15, runs from the value to the field's maximum
+				high = f.max
+			}
+		}
+
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+
+	return set, nil
+}
+
+// value parses a single value of the field, by number or name.
+func (f cronField) value(text string) (int, error) {
+	if value, ok := f.names[strings.ToLower(text)]; ok {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(text)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("invalid %s %q, it must be between %d and %d", f.name, text, f.min, f.max)
+	}
+
+	return value, nil
+}
+
+// next returns the first matching minute after the given time, or the zero
+// time if there's none within the next 5 years (such as for 30 February).
+func (c cronCadence) next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hours&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (c cronCadence) dayMatches(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	}
+
+	return day || weekday
+}
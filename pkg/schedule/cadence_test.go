@@ -0,0 +1,69 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCadence(t *testing.T) {
+	after := time.Date(2024, time.March, 15, 10, 30, 45, 0, time.UTC) // a Friday
+
+	t.Run("Interval", func(t *testing.T) {
+		c, err := parseCadence("6h", "", time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, after.Add(6*time.Hour), c.next(after))
+	})
+
+	t.Run("Cron", func(t *testing.T) {
+		tests := []struct {
+			expression string
+			expected   time.Time
+		}{
+			{"* * * * *", time.Date(2024, time.March, 15, 10, 31, 0, 0, time.UTC)},
+			{"*/15 * * * *", time.Date(2024, time.March, 15, 10, 45, 0, 0, time.UTC)},
+			{"0 6 * * *", time.Date(2024, time.March, 16, 6, 0, 0, 0, time.UTC)},
+			{"0 6 * * mon", time.Date(2024, time.March, 18, 6, 0, 0, 0, time.UTC)},
+			{"0 6 * * 7", time.Date(2024, time.March, 17, 6, 0, 0, 0, time.UTC)},
+			{"0 0 1 * *", time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+			{"0 0 29 feb *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+			{"30 9-17/4 * * mon-fri", time.Date(2024, time.March, 15, 13, 30, 0, 0, time.UTC)},
+			{"0 12 1,20 jan,jun *", time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)},
+			// with both day fields restricted, either may match
+			{"0 0 20 * sat", time.Date(2024, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		}
+
+		for _, test := range tests {
+			t.Run(test.expression, func(t *testing.T) {
+				c, err := parseCadence("", test.expression, time.Minute)
+				require.NoError(t, err)
+				require.Equal(t, test.expected, c.next(after))
+			})
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name, interval, cron string
+		}{
+			{"None", "", ""},
+			{"Both", "1h", "* * * * *"},
+			{"BadInterval", "daily", ""},
+			{"ShortInterval", "30s", ""},
+			{"TooFewFields", "", "* * * *"},
+			{"OutOfRange", "", "60 * * * *"},
+			{"BadName", "", "0 0 * * funday"},
+			{"BackwardsRange", "", "0 5-1 * * *"},
+			{"BadStep", "", "*/0 * * * *"},
+			{"NeverMatches", "", "0 0 30 feb *"},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				_, err := parseCadence(test.interval, test.cron, time.Minute)
+				require.ErrorIs(t, err, ErrInvalidCadence)
+			})
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package schedule
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultDeliveryLimit is the number of each tenant's latest deliveries kept
+// by a delivery log.
+const DefaultDeliveryLimit = 100
+
+type (
+	// Delivery is a change or tamper alert sent to a webhook, with each
+	// attempt to deliver it.
+	Delivery struct {
+		ID         string            `json:"id" doc:"The delivery's ID, sent in its X-DSS-Delivery header. Redeliveries keep the same ID, so receivers can ignore a delivery they've already processed." example:"9c4e1f0a7b3d2e58"`
+		Tenant     string            `json:"tenant" doc:"The tenant that owns the schedule the delivery is from." example:"default"`
+		Event      string            `json:"event" enum:"change,tamper" doc:"The kind of event delivered, sent in its X-DSS-Event header." example:"change"`
+		ScheduleID string            `json:"scheduleId" doc:"The ID of the schedule that scanned the domain." example:"5f2b6c2d9a1e4f07"`
+		Domain     string            `json:"domain" doc:"The domain the event is about." example:"example.com"`
+		CreatedAt  time.Time         `json:"createdAt" doc:"When the event was first delivered."`
+		Attempts   []DeliveryAttempt `json:"attempts" doc:"Each attempt to deliver the event, oldest first, including redeliveries."`
+
+		body    []byte
+		webhook *Webhook
+	}
+
+	// DeliveryAttempt is a single attempt to deliver an event to a webhook.
+	DeliveryAttempt struct {
+		At         time.Time `json:"at" doc:"When the attempt was made."`
+		StatusCode int       `json:"statusCode,omitempty" doc:"The status code the webhook responded with, if it responded." example:"200"`
+		Error      string    `json:"error,omitempty" doc:"Why the attempt failed, if it did." example:"webhook responded with status 503"`
+		Duration   string    `json:"duration" doc:"How long the attempt took." example:"84ms"`
+	}
+
+	// DeliveryLog keeps the latest deliveries of each tenant's webhooks in
+	// memory, so they can be listed and redelivered. Deliveries don't survive
+	// a restart.
+	DeliveryLog struct {
+		limit int
+
+		// mutex guards tenants, and the attempts of each delivery in it.
+		mutex   sync.Mutex
+		tenants map[string][]*Delivery
+	}
+)
+
+// NewDeliveryLog returns a log keeping the latest limit deliveries of each
+// tenant, or DefaultDeliveryLimit if limit isn't positive.
+func NewDeliveryLog(limit int) *DeliveryLog {
+	if limit <= 0 {
+		limit = DefaultDeliveryLimit
+	}
+
+	return &DeliveryLog{limit: limit, tenants: make(map[string][]*Delivery)}
+}
+
+// List returns the tenant's deliveries, newest first.
+func (l *DeliveryLog) List(tenant string) []Delivery {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	logged := l.tenants[tenant]
+
+	deliveries := make([]Delivery, 0, len(logged))
+	for index := len(logged) - 1; index >= 0; index-- {
+		deliveries = append(deliveries, logged[index].snapshot())
+	}
+
+	return deliveries
+}
+
+// Redeliver sends the tenant's delivery with the given ID to its webhook
+// again, returning the delivery with the new attempt. It returns false if the
+// tenant has no such delivery (such as one of another tenant's, or one that
+// has been dropped from the log). A failed attempt is recorded in the
+// delivery, rather than returned.
+func (l *DeliveryLog) Redeliver(ctx context.Context, tenant, id string) (Delivery, bool) {
+	l.mutex.Lock()
+	index := slices.IndexFunc(l.tenants[tenant], func(delivery *Delivery) bool { return delivery.ID == id })
+
+	var delivery *Delivery
+	if index >= 0 {
+		delivery = l.tenants[tenant][index]
+	}
+	l.mutex.Unlock()
+
+	if delivery == nil {
+		return Delivery{}, false
+	}
+
+	_ = delivery.webhook.deliver(ctx, delivery)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return delivery.snapshot(), true
+}
+
+// add logs a new delivery, dropping its tenant's oldest delivery if the log is
+// full.
+func (l *DeliveryLog) add(delivery *Delivery) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	deliveries := append(l.tenants[delivery.Tenant], delivery)
+	if len(deliveries) > l.limit {
+		deliveries = slices.Delete(deliveries, 0, len(deliveries)-l.limit)
+	}
+
+	l.tenants[delivery.Tenant] = deliveries
+}
+
+// record adds an attempt to a delivery.
+func (l *DeliveryLog) record(delivery *Delivery, attempt DeliveryAttempt) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delivery.Attempts = append(delivery.Attempts, attempt)
+}
+
+// snapshot returns a copy of the delivery that's safe to use once the mutex is
+// released. The caller must hold the mutex.
+func (d *Delivery) snapshot() Delivery {
+	snapshot := *d
+	snapshot.Attempts = slices.Clone(d.Attempts)
+
+	return snapshot
+}
@@ -0,0 +1,75 @@
+package schedule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveryLog(t *testing.T) {
+	// the receiver fails the first delivery, and accepts every one after it
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if received.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	deliveries := NewDeliveryLog(2)
+	webhook := NewWebhook(receiver.URL, time.Second, WithDeliveryLog(deliveries))
+
+	require.ErrorContains(t, webhook.Notify(context.Background(), Change{Tenant: "acme", ScheduleID: "s1", Domain: "a.example"}), "status 503")
+	require.NoError(t, webhook.Notify(context.Background(), Change{Tenant: "acme", ScheduleID: "s1", Domain: "b.example"}))
+	require.NoError(t, webhook.NotifyTamper(context.Background(), Tamper{Tenant: "globex", ScheduleID: "s2", Domain: "c.example"}))
+
+	t.Run("List", func(t *testing.T) {
+		listed := deliveries.List("acme")
+		require.Len(t, listed, 2)
+		require.Equal(t, "b.example", listed[0].Domain)
+		require.Equal(t, "a.example", listed[1].Domain)
+		require.Equal(t, "change", listed[1].Event)
+		require.Len(t, listed[1].Attempts, 1)
+		require.Equal(t, http.StatusServiceUnavailable, listed[1].Attempts[0].StatusCode)
+		require.Equal(t, "webhook responded with status 503", listed[1].Attempts[0].Error)
+
+		listed = deliveries.List("globex")
+		require.Len(t, listed, 1)
+		require.Equal(t, "tamper", listed[0].Event)
+		require.Equal(t, http.StatusOK, listed[0].Attempts[0].StatusCode)
+
+		require.Empty(t, deliveries.List("initech"))
+	})
+
+	t.Run("Redeliver", func(t *testing.T) {
+		failed := deliveries.List("acme")[1]
+
+		_, ok := deliveries.Redeliver(context.Background(), "globex", failed.ID)
+		require.False(t, ok)
+
+		redelivered, ok := deliveries.Redeliver(context.Background(), "acme", failed.ID)
+		require.True(t, ok)
+		require.Equal(t, failed.ID, redelivered.ID)
+		require.Len(t, redelivered.Attempts, 2)
+		require.Equal(t, http.StatusOK, redelivered.Attempts[1].StatusCode)
+		require.Empty(t, redelivered.Attempts[1].Error)
+
+		// the earlier listing's copy isn't changed by the redelivery
+		require.Len(t, failed.Attempts, 1)
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		require.NoError(t, webhook.Notify(context.Background(), Change{Tenant: "acme", ScheduleID: "s1", Domain: "d.example"}))
+
+		listed := deliveries.List("acme")
+		require.Len(t, listed, 2)
+		require.Equal(t, "d.example", listed[0].Domain)
+		require.Equal(t, "b.example", listed[1].Domain)
+		require.Len(t, deliveries.List("globex"), 1)
+	})
+}
@@ -0,0 +1,202 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/goccy/go-json"
+)
+
+// The headers each webhook delivery is sent with. Deliveries to a tenant with
+// a signing secret are also sent with the timestamp, nonce and signature
+// headers (see WithSigningSecrets).
+const (
+	EventHeader     = "X-DSS-Event"
+	DeliveryHeader  = "X-DSS-Delivery"
+	TimestampHeader = "X-DSS-Timestamp"
+	NonceHeader     = "X-DSS-Nonce"
+	SignatureHeader = "X-DSS-Signature"
+)
+
+// SignaturePrefix names the signature's algorithm in the signature header.
+const SignaturePrefix = "sha256="
+
+type (
+	// Change is a scheduled scan whose records differ from the domain's
+	// previous scheduled scan.
+	Change struct {
+		Tenant     string            `json:"tenant" doc:"The tenant that owns the schedule."`
+		ScheduleID string            `json:"scheduleId" doc:"The ID of the schedule that scanned the domain."`
+		Domain     string            `json:"domain" doc:"The domain whose records changed."`
+		Previous   *model.ScanResult `json:"previous" doc:"The result of the domain's previous scheduled scan."`
+		Current    *model.ScanResult `json:"current" doc:"The result of the domain's latest scheduled scan."`
+	}
+
+	// Notifier is notified of each change found by a scheduled scan.
+	Notifier interface {
+		Notify(ctx context.Context, change Change) error
+	}
+
+	// ResultExporter exports the results of each completed run of a
+	// schedule, as of when it completed.
+	ResultExporter interface {
+		Export(ctx context.Context, schedule Schedule, completedAt time.Time, results []*model.ScanResult) error
+	}
+
+	// Webhook notifies a URL of each change (and tamper alert), by POSTing it
+	// as JSON.
+	Webhook struct {
+		client     *http.Client
+		deliveries *DeliveryLog
+		secrets    map[string]string
+		url        string
+	}
+
+	// WebhookOption defines a functional configuration type for a *Webhook.
+	WebhookOption func(*Webhook)
+)
+
+// NewWebhook returns a Webhook that POSTs each change to url, giving up on
+// each request after timeout.
+func NewWebhook(url string, timeout time.Duration, opts ...WebhookOption) *Webhook {
+	webhook := &Webhook{
+		client: &http.Client{Timeout: timeout},
+		url:    url,
+	}
+
+	for _, opt := range opts {
+		opt(webhook)
+	}
+
+	return webhook
+}
+
+// WithDeliveryLog records each of the webhook's deliveries, and every attempt
+// to deliver it, in the log, so that they can be listed and redelivered.
+func WithDeliveryLog(deliveries *DeliveryLog) WebhookOption {
+	return func(w *Webhook) {
+		w.deliveries = deliveries
+	}
+}
+
+// WithSigningSecrets signs the deliveries of each tenant with a secret (keyed
+// by tenant). Each delivery is sent with the Unix time it was sent at in the
+// X-DSS-Timestamp header, a random nonce in the X-DSS-Nonce header, and the
+// hex encoded HMAC-SHA256 of the timestamp, nonce and body (joined by dots)
+// in the X-DSS-Signature header, prefixed by sha256=. Deliveries of tenants
+// without a secret aren't signed.
+func WithSigningSecrets(secrets map[string]string) WebhookOption {
+	return func(w *Webhook) {
+		w.secrets = secrets
+	}
+}
+
+func (w *Webhook) Notify(ctx context.Context, change Change) error {
+	return w.post(ctx, &Delivery{Tenant: change.Tenant, Event: "change", ScheduleID: change.ScheduleID, Domain: change.Domain}, change)
+}
+
+// NotifyTamper POSTs the tamper alerts as JSON, with an X-DSS-Event header
+// of "tamper" (rather than "change"), so receivers can route them apart.
+func (w *Webhook) NotifyTamper(ctx context.Context, tamper Tamper) error {
+	return w.post(ctx, &Delivery{Tenant: tamper.Tenant, Event: "tamper", ScheduleID: tamper.ScheduleID, Domain: tamper.Domain}, tamper)
+}
+
+// post marshals the payload as the delivery's body, logs the delivery (if the
+// webhook has a log), and delivers it.
+func (w *Webhook) post(ctx context.Context, delivery *Delivery, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", delivery.Event, err)
+	}
+
+	if delivery.ID, err = randomHex(8); err != nil {
+		return fmt.Errorf("failed to generate delivery ID: %w", err)
+	}
+
+	delivery.CreatedAt = time.Now().UTC()
+	delivery.body = body
+	delivery.webhook = w
+
+	if w.deliveries != nil {
+		w.deliveries.add(delivery)
+	}
+
+	return w.deliver(ctx, delivery)
+}
+
+// deliver POSTs the delivery's body to the webhook's URL, recording the
+// attempt in the webhook's log (if it has one).
+func (w *Webhook) deliver(ctx context.Context, delivery *Delivery) error {
+	start := time.Now()
+	statusCode, err := w.send(ctx, delivery)
+
+	if w.deliveries != nil {
+		attempt := DeliveryAttempt{At: start.UTC(), StatusCode: statusCode, Duration: time.Since(start).Round(time.Millisecond).String()}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+
+		w.deliveries.record(delivery, attempt)
+	}
+
+	return err
+}
+
+// send POSTs the delivery's body as JSON, naming the kind of event in the
+// X-DSS-Event header, and signing it if its tenant has a secret. It returns
+// the response's status code, if there was a response.
+func (w *Webhook) send(ctx context.Context, delivery *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(delivery.body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+
+	// every attempt has its own timestamp and nonce, so a redelivery isn't rejected as a replay
+	if secret := w.secrets[delivery.Tenant]; secret != "" {
+		nonce, err := randomHex(16)
+		if err != nil {
+			return 0, fmt.Errorf("failed to generate webhook nonce: %w", err)
+		}
+
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(NonceHeader, nonce)
+		req.Header.Set(SignatureHeader, SignaturePrefix+Signature(secret, timestamp, nonce, delivery.body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Signature returns the hex encoded HMAC-SHA256 of a delivery's timestamp,
+// nonce and body, joined by dots, keyed by its tenant's secret. It's sent in
+// the X-DSS-Signature header, after the sha256= prefix.
+func Signature(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
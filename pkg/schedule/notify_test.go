@@ -0,0 +1,45 @@
+package schedule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook_Signing(t *testing.T) {
+	var headers atomic.Pointer[http.Header]
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Clone()
+		headers.Store(&header)
+	}))
+	defer receiver.Close()
+
+	webhook := NewWebhook(receiver.URL, time.Second, WithSigningSecrets(map[string]string{"acme": "acme-secret"}))
+
+	require.NoError(t, webhook.Notify(context.Background(), Change{Tenant: "acme", Domain: "example.com"}))
+
+	signed := *headers.Load()
+	require.Equal(t, "change", signed.Get(EventHeader))
+	require.Len(t, signed.Get(DeliveryHeader), 16)
+	require.Len(t, signed.Get(NonceHeader), 32)
+	require.NotEmpty(t, signed.Get(TimestampHeader))
+	require.Regexp(t, "^sha256=[0-9a-f]{64}$", signed.Get(SignatureHeader))
+
+	require.NoError(t, webhook.Notify(context.Background(), Change{Tenant: "globex", Domain: "example.com"}))
+
+	unsigned := *headers.Load()
+	require.NotEmpty(t, unsigned.Get(DeliveryHeader))
+	require.Empty(t, unsigned.Get(TimestampHeader))
+	require.Empty(t, unsigned.Get(NonceHeader))
+	require.Empty(t, unsigned.Get(SignatureHeader))
+}
+
+func TestSignature(t *testing.T) {
+	// HMAC-SHA256 of "1700000000.abc.{}" keyed by "secret"
+	require.Equal(t, "c298f98d541d2a5fa6efc81e6cfe35504abeb3847802a5791eeac7a19a12361b", Signature("secret", "1700000000", "abc", []byte("{}")))
+}
@@ -0,0 +1,571 @@
+// Package schedule runs recurring scans of domains, each schedule at its own
+// cadence, persisting the schedules and their latest results so they survive
+// restarts.
+package schedule
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	randv2 "math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// Clock tells the time, and waits for durations to pass. It's only
+	// replaced in tests, to drive a scheduler without waiting.
+	Clock interface {
+		Now() time.Time
+		After(d time.Duration) <-chan time.Time
+	}
+
+	// ScanFunc scans a single domain, returning its result with advice.
+	ScanFunc func(ctx context.Context, domain string) (*model.ScanResult, error)
+
+	// Schedule is a recurring scan of a set of domains.
+	Schedule struct {
+		ID        string     `json:"id" doc:"The schedule's ID." example:"5f2b6c2d9a1e4f07"`
+		Tenant    string     `json:"tenant" doc:"The tenant that owns the schedule." example:"default"`
+		Domains   []string   `json:"domains" doc:"The domains scanned by each run." example:"example.com"`
+		Interval  string     `json:"interval,omitempty" doc:"The duration between the end of a run and the start of the next." example:"6h"`
+		Cron      string     `json:"cron,omitempty" doc:"The cron expression (minute, hour, day of month, month and day of week, in UTC) runs start at." example:"0 6 * * mon"`
+		CreatedAt time.Time  `json:"createdAt" doc:"When the schedule was created."`
+		LastRun   *time.Time `json:"lastRun,omitempty" doc:"When the schedule's last run completed."`
+		NextRun   time.Time  `json:"nextRun" doc:"When the schedule's next run starts, including its jitter."`
+	}
+
+	// Scheduler runs each schedule's scans when they're due. Runs are
+	// jittered, so schedules with the same cadence don't all start at once,
+	// and share a limited number of concurrent scans, so that scheduled scans
+	// can't starve interactive requests.
+	Scheduler struct {
+		clock         Clock
+		exporter      ResultExporter
+		logger        zerolog.Logger
+		maxConcurrent int
+		maxJitter     time.Duration
+		minInterval   time.Duration
+		notifiers     []Notifier
+		scan          ScanFunc
+		store         *Store
+		tamperAlerts  bool
+
+		// mutex guards schedules, and orders writes of schedules to the store.
+		mutex     sync.Mutex
+		schedules map[string]*entry
+
+		// slots holds a token for each running scan, up to maxConcurrent.
+		slots chan struct{}
+
+		// wake interrupts the run loop's wait whenever a schedule changes.
+		wake chan struct{}
+	}
+
+	// Option defines a functional configuration type for a *Scheduler.
+	Option func(*Scheduler)
+
+	// Usage counts a tenant's schedules, and the domains they scan.
+	Usage struct {
+		Schedules int `json:"schedules" doc:"The number of schedules the tenant owns." example:"2"`
+		Domains   int `json:"domains" doc:"The number of domains scanned by the tenant's schedules, counting a domain once per schedule." example:"5"`
+	}
+
+	entry struct {
+		cadence  cadence
+		running  bool
+		schedule Schedule
+	}
+
+	systemClock struct{}
+)
+
+// New returns a scheduler of the store's schedules, which scans each domain
+// with scan. Any schedule that was due while the scheduler wasn't running is
+// rescheduled to start within the maximum jitter, so a restart doesn't start
+// every overdue schedule at once. Schedules only run once Run is called.
+func New(logger zerolog.Logger, store *Store, scan ScanFunc, opts ...Option) *Scheduler {
+	scheduler := &Scheduler{
+		clock:         systemClock{},
+		logger:        logger,
+		maxConcurrent: 2,
+		maxJitter:     5 * time.Minute,
+		minInterval:   time.Minute,
+		scan:          scan,
+		store:         store,
+		schedules:     make(map[string]*entry),
+		wake:          make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(scheduler)
+	}
+
+	scheduler.slots = make(chan struct{}, scheduler.maxConcurrent)
+
+	now := scheduler.clock.Now()
+
+	for _, schedule := range store.Schedules() {
+		cadence, err := parseCadence(schedule.Interval, schedule.Cron, scheduler.minInterval)
+		if err != nil {
+			scheduler.logger.Warn().Err(err).Str("schedule", schedule.ID).Msg("skipping stored schedule")
+			continue
+		}
+
+		if schedule.NextRun.Before(now) {
+			schedule.NextRun = now.Add(scheduler.jitter(10 * scheduler.maxJitter))
+
+			if err = store.PutSchedule(schedule); err != nil {
+				scheduler.logger.Error().Err(err).Str("schedule", schedule.ID).Msg("failed to reschedule overdue schedule")
+			}
+		}
+
+		scheduler.schedules[schedule.ID] = &entry{cadence: cadence, schedule: schedule}
+	}
+
+	return scheduler
+}
+
+// WithClock replaces the scheduler's clock.
+func WithClock(clock Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = clock
+	}
+}
+
+// WithResultExporter exports the results of each completed run, such as to
+// object storage, after they're stored.
+func WithResultExporter(exporter ResultExporter) Option {
+	return func(s *Scheduler) {
+		s.exporter = exporter
+	}
+}
+
+// WithMaxConcurrentScans limits the number of domains scanned at once across
+// every schedule. It defaults to 2.
+func WithMaxConcurrentScans(quota int) Option {
+	return func(s *Scheduler) {
+		if quota > 0 {
+			s.maxConcurrent = quota
+		}
+	}
+}
+
+// WithMaxJitter limits the random delay added to the start of each run, which
+// is otherwise a tenth of the schedule's period. It defaults to 5 minutes, and
+// 0 disables jitter.
+func WithMaxJitter(jitter time.Duration) Option {
+	return func(s *Scheduler) {
+		s.maxJitter = jitter
+	}
+}
+
+// WithNotifiers notifies each of the notifiers of every change found by a
+// scheduled scan.
+func WithNotifiers(notifiers ...Notifier) Option {
+	return func(s *Scheduler) {
+		s.notifiers = append(s.notifiers, notifiers...)
+	}
+}
+
+// Add creates a schedule owned by the tenant, scanning the domains at the given
+// cadence, which is either an interval (such as "6h") or a cron expression
+// (such as "0 6 * * mon"). Errors caused by the cadence wrap
+// ErrInvalidCadence.
+func (s *Scheduler) Add(tenant string, domains []string, interval, cron string) (Schedule, error) {
+	if len(domains) == 0 {
+		return Schedule{}, errors.New("a schedule needs at least one domain")
+	}
+
+	cadence, err := parseCadence(interval, cron, s.minInterval)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	now := s.clock.Now()
+	schedule := Schedule{
+		ID:        id,
+		Tenant:    tenant,
+		Domains:   domains,
+		Interval:  interval,
+		Cron:      cron,
+		CreatedAt: now,
+		NextRun:   s.nextRun(cadence, now),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err = s.store.PutSchedule(schedule); err != nil {
+		return Schedule{}, err
+	}
+
+	s.schedules[id] = &entry{cadence: cadence, schedule: schedule}
+	s.poke()
+
+	return schedule, nil
+}
+
+// Get returns the tenant's schedule with the given ID, along with the latest
+// result of each of its domains (keyed by domain). Another tenant's schedule
+// isn't found.
+func (s *Scheduler) Get(tenant, id string) (Schedule, map[string]*model.ScanResult, bool) {
+	s.mutex.Lock()
+	scheduled, ok := s.schedules[id]
+	s.mutex.Unlock()
+
+	if !ok || scheduled.schedule.Tenant != tenant {
+		return Schedule{}, nil, false
+	}
+
+	return scheduled.schedule, s.store.Results(tenant, id), true
+}
+
+// Latest returns the most recent result of the domain stored by any of the
+// tenant's schedules, or nil if none of them has scanned it.
+func (s *Scheduler) Latest(tenant, domain string) *model.ScanResult {
+	return s.store.LatestResult(tenant, domain)
+}
+
+// List returns every schedule of the tenant, oldest first.
+func (s *Scheduler) List(tenant string) []Schedule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	schedules := make([]Schedule, 0)
+	for _, scheduled := range s.schedules {
+		if scheduled.schedule.Tenant == tenant {
+			schedules = append(schedules, scheduled.schedule)
+		}
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].CreatedAt.Equal(schedules[j].CreatedAt) {
+			return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+		}
+
+		return schedules[i].ID < schedules[j].ID
+	})
+
+	return schedules
+}
+
+// Usage returns the usage of each tenant that owns a schedule, keyed by
+// tenant.
+func (s *Scheduler) Usage() map[string]Usage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage := make(map[string]Usage)
+	for _, scheduled := range s.schedules {
+		tenant := usage[scheduled.schedule.Tenant]
+		tenant.Schedules++
+		tenant.Domains += len(scheduled.schedule.Domains)
+		usage[scheduled.schedule.Tenant] = tenant
+	}
+
+	return usage
+}
+
+// Remove deletes the tenant's schedule with the given ID, along with its
+// results. It returns false if the tenant has no such schedule. A run in
+// progress completes, but its results are discarded.
+func (s *Scheduler) Remove(tenant, id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if scheduled, ok := s.schedules[id]; !ok || scheduled.schedule.Tenant != tenant {
+		return false, nil
+	}
+
+	if err := s.store.DeleteSchedule(tenant, id); err != nil {
+		return false, err
+	}
+
+	delete(s.schedules, id)
+	s.poke()
+
+	return true, nil
+}
+
+// Run starts each schedule's runs when they're due, until ctx is done. It then
+// waits for the runs in progress to be cancelled before returning.
+func (s *Scheduler) Run(ctx context.Context) {
+	var runs sync.WaitGroup
+	defer runs.Wait()
+
+	for {
+		now := s.clock.Now()
+
+		var (
+			due  []*entry
+			next time.Time
+		)
+
+		s.mutex.Lock()
+		for _, scheduled := range s.schedules {
+			switch {
+			case scheduled.running:
+			case !scheduled.schedule.NextRun.After(now):
+				scheduled.running = true
+				due = append(due, scheduled)
+			case next.IsZero() || scheduled.schedule.NextRun.Before(next):
+				next = scheduled.schedule.NextRun
+			}
+		}
+		s.mutex.Unlock()
+
+		for _, scheduled := range due {
+			runs.Add(1)
+
+			go func(scheduled *entry) {
+				defer runs.Done()
+				s.run(ctx, scheduled)
+			}(scheduled)
+		}
+
+		var timer <-chan time.Time
+		if !next.IsZero() {
+			timer = s.clock.After(next.Sub(now))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer:
+		case <-s.wake:
+		}
+	}
+}
+
+// run scans each of the schedule's domains, stores their results and notifies
+// of any changes, then schedules its next run. A run cancelled by ctx keeps
+// its next run, so it's retried once the scheduler restarts.
+func (s *Scheduler) run(ctx context.Context, scheduled *entry) {
+	s.mutex.Lock()
+	schedule := scheduled.schedule
+	s.mutex.Unlock()
+
+	var (
+		mutex   sync.Mutex
+		results = make(map[string]*model.ScanResult)
+		scans   sync.WaitGroup
+	)
+
+	// the previous results are only replaced once every scan completes
+	previous := s.store.Results(schedule.Tenant, schedule.ID)
+
+	for _, domain := range schedule.Domains {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		scans.Add(1)
+
+		go func(domain string) {
+			defer scans.Done()
+			defer func() { <-s.slots }()
+
+			result, err := s.scan(ctx, domain)
+			if err == nil && result != nil && result.ScanResult != nil && result.ScanResult.Error != "" {
+				err = errors.New(result.ScanResult.Error)
+			}
+
+			if err != nil {
+				// failed scans keep the domain's previous result, so a transient failure isn't reported as a change
+				s.logger.Warn().Err(err).Str("schedule", schedule.ID).Str("domain", domain).Msg("scheduled scan failed")
+				return
+			}
+
+			mutex.Lock()
+			results[domain] = result
+			mutex.Unlock()
+
+			// tamper alerts can't wait for the rest of the run
+			if s.tamperAlerts {
+				if alerts := tamperAlerts(previous[domain], result); len(alerts) > 0 {
+					s.notifyTamper(ctx, Tamper{Tenant: schedule.Tenant, ScheduleID: schedule.ID, Domain: domain, DetectedAt: s.clock.Now(), Alerts: alerts})
+				}
+			}
+		}(domain)
+	}
+
+	scans.Wait()
+
+	if ctx.Err() != nil {
+		s.mutex.Lock()
+		scheduled.running = false
+		s.mutex.Unlock()
+
+		return
+	}
+
+	// the stored results (and so any changes notified) note which findings are new since the previous run
+	for domain, result := range results {
+		result.Annotate(previous[domain])
+	}
+
+	if err := s.store.PutResults(schedule.Tenant, schedule.ID, results); err != nil {
+		s.logger.Error().Err(err).Str("schedule", schedule.ID).Msg("failed to store scheduled scan results")
+	}
+
+	if s.exporter != nil {
+		s.export(ctx, schedule, results)
+	}
+
+	for _, domain := range schedule.Domains {
+		if results[domain] != nil && previous[domain] != nil && recordsChanged(previous[domain], results[domain]) {
+			s.notify(ctx, Change{Tenant: schedule.Tenant, ScheduleID: schedule.ID, Domain: domain, Previous: previous[domain], Current: results[domain]})
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	scheduled.running = false
+
+	// the schedule may have been removed during the run
+	if _, ok := s.schedules[schedule.ID]; !ok {
+		return
+	}
+
+	now := s.clock.Now()
+	scheduled.schedule.LastRun = &now
+	scheduled.schedule.NextRun = s.nextRun(scheduled.cadence, now)
+
+	if err := s.store.PutSchedule(scheduled.schedule); err != nil {
+		s.logger.Error().Err(err).Str("schedule", schedule.ID).Msg("failed to store schedule")
+	}
+
+	s.poke()
+}
+
+// export exports the run's results in the order of the schedule's domains.
+// Domains whose scans failed aren't exported, as the run has no result for
+// them.
+func (s *Scheduler) export(ctx context.Context, schedule Schedule, results map[string]*model.ScanResult) {
+	ordered := make([]*model.ScanResult, 0, len(results))
+	for _, domain := range schedule.Domains {
+		if result := results[domain]; result != nil {
+			ordered = append(ordered, result)
+		}
+	}
+
+	if err := s.exporter.Export(ctx, schedule, s.clock.Now(), ordered); err != nil {
+		s.logger.Error().Err(err).Str("schedule", schedule.ID).Msg("failed to export scheduled scan results")
+	}
+}
+
+func (s *Scheduler) notify(ctx context.Context, change Change) {
+	s.logger.Info().Str("tenant", change.Tenant).Str("schedule", change.ScheduleID).Str("domain", change.Domain).Msg("scheduled scan found changed records")
+
+	for _, notifier := range s.notifiers {
+		if err := notifier.Notify(ctx, change); err != nil {
+			s.logger.Warn().Err(err).Str("schedule", change.ScheduleID).Str("domain", change.Domain).Msg("failed to notify of changed records")
+		}
+	}
+}
+
+func (s *Scheduler) notifyTamper(ctx context.Context, tamper Tamper) {
+	rules := make([]string, 0, len(tamper.Alerts))
+	for _, alert := range tamper.Alerts {
+		rules = append(rules, alert.Rule)
+	}
+
+	s.logger.Warn().Str("tenant", tamper.Tenant).Str("schedule", tamper.ScheduleID).Str("domain", tamper.Domain).Strs("rules", rules).Msg("scheduled scan found weakened mail authentication records")
+
+	for _, notifier := range s.notifiers {
+		tamperNotifier, ok := notifier.(TamperNotifier)
+		if !ok {
+			continue
+		}
+
+		if err := tamperNotifier.NotifyTamper(ctx, tamper); err != nil {
+			s.logger.Warn().Err(err).Str("schedule", tamper.ScheduleID).Str("domain", tamper.Domain).Msg("failed to notify of weakened records")
+		}
+	}
+}
+
+// nextRun returns the start of a schedule's next run after now, jittered by
+// up to a tenth of its period (capped at maxJitter).
+func (s *Scheduler) nextRun(cadence cadence, now time.Time) time.Time {
+	next := cadence.next(now)
+	return next.Add(s.jitter(cadence.next(next).Sub(next)))
+}
+
+// jitter returns a random delay of up to a tenth of the period, capped at
+// maxJitter.
+func (s *Scheduler) jitter(period time.Duration) time.Duration {
+	limit := period / 10
+	if limit > s.maxJitter {
+		limit = s.maxJitter
+	}
+
+	if limit <= 0 {
+		return 0
+	}
+
+	return time.Duration(randv2.Int64N(int64(limit)))
+}
+
+// poke wakes the run loop, so it picks up a changed schedule.
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// recordsChanged reports whether the scanned records differ between two
+// results. Advice isn't compared, as it can change without the records
+// changing (such as when a mail server's TLS probe times out).
+func recordsChanged(previous, current *model.ScanResult) bool {
+	previousRecords, previousErr := json.Marshal(previous.ScanResult)
+	currentRecords, currentErr := json.Marshal(current.ScanResult)
+
+	return previousErr != nil || currentErr != nil || string(previousRecords) != string(currentRecords)
+}
+
+func newID() (string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate schedule ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// randomHex returns size random bytes, hex encoded.
+func randomHex(size int) (string, error) {
+	value := make([]byte, size)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(value), nil
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
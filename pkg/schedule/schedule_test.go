@@ -0,0 +1,403 @@
+package schedule
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// fakeClock only moves when advanced, firing the timers that are then due.
+	fakeClock struct {
+		mutex  sync.Mutex
+		now    time.Time
+		timers []fakeTimer
+		waits  int
+	}
+
+	fakeTimer struct {
+		deadline time.Time
+		fire     chan time.Time
+	}
+
+	// recordingNotifier records every change it's notified of.
+	recordingNotifier struct {
+		mutex   sync.Mutex
+		changes []Change
+	}
+
+	// recordingExporter records the domains of each run it exports.
+	recordingExporter struct {
+		mutex sync.Mutex
+		runs  [][]string
+	}
+)
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, time.March, 15, 10, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timer := fakeTimer{deadline: c.now.Add(d), fire: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	c.waits++
+
+	return timer.fire
+}
+
+// Advance moves the clock forward, firing any timers that are now due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.deadline.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+
+		timer.fire <- c.now
+	}
+
+	c.timers = pending
+}
+
+// WaitForWaits blocks until After has been called at least count times, so
+// the scheduler has finished reacting to the last change before the clock is
+// advanced.
+func (c *fakeClock) WaitForWaits(t *testing.T, count int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		return c.waits >= count
+	}, 5*time.Second, time.Millisecond)
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, change Change) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.changes = append(n.changes, change)
+
+	return nil
+}
+
+func (n *recordingNotifier) Changes() []Change {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return append([]Change(nil), n.changes...)
+}
+
+func (e *recordingExporter) Export(_ context.Context, _ Schedule, _ time.Time, results []*model.ScanResult) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	domains := make([]string, 0, len(results))
+	for _, result := range results {
+		domains = append(domains, result.ScanResult.Domain)
+	}
+
+	e.runs = append(e.runs, domains)
+
+	return nil
+}
+
+func (e *recordingExporter) Runs() [][]string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return append([][]string(nil), e.runs...)
+}
+
+// startScheduler runs the scheduler until the test completes.
+func startScheduler(t *testing.T, scheduler *Scheduler) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		scheduler.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestScheduler_Run(t *testing.T) {
+	clock := newFakeClock()
+
+	store, err := OpenStore("")
+	require.NoError(t, err)
+
+	var (
+		inFlight, maxInFlight, scans atomic.Int32
+		spf                          atomic.Value
+	)
+
+	spf.Store("v=spf1 -all")
+
+	scan := func(ctx context.Context, domain string) (*model.ScanResult, error) {
+		defer scans.Add(1)
+
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			observed := maxInFlight.Load()
+			if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		record := spf.Load().(string)
+
+		return &model.ScanResult{ScanResult: &scanner.Result{Domain: domain, SPF: record}, Advice: &advisor.Advice{SPF: []string{"Your SPF record is " + record + "."}}}, nil
+	}
+
+	notifier, exporter := &recordingNotifier{}, &recordingExporter{}
+	scheduler := New(zerolog.Nop(), store, scan, WithClock(clock), WithMaxConcurrentScans(2), WithMaxJitter(0), WithNotifiers(notifier), WithResultExporter(exporter))
+
+	domains := []string{"a.example", "b.example", "c.example", "d.example", "e.example"}
+	created, err := scheduler.Add(DefaultTenant, domains, "1h", "")
+	require.NoError(t, err)
+	require.Equal(t, clock.Now().Add(time.Hour), created.NextRun)
+
+	// the loop waits once on starting, then again on picking up the schedule added before it started
+	startScheduler(t, scheduler)
+	clock.WaitForWaits(t, 2)
+	clock.Advance(59 * time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	require.Zero(t, scans.Load(), "the schedule ran early")
+
+	// the first run only records the results, as there's nothing to compare them with
+	clock.Advance(time.Minute)
+	clock.WaitForWaits(t, 3)
+	require.EqualValues(t, len(domains), scans.Load())
+	require.EqualValues(t, 2, maxInFlight.Load())
+	require.Empty(t, notifier.Changes())
+
+	// every run is exported, in the order of the schedule's domains
+	require.Equal(t, [][]string{domains}, exporter.Runs())
+
+	_, results, ok := scheduler.Get(DefaultTenant, created.ID)
+	require.True(t, ok)
+	require.Len(t, results, len(domains))
+
+	ran, _, _ := scheduler.Get(DefaultTenant, created.ID)
+	require.Equal(t, clock.Now(), *ran.LastRun)
+	require.Equal(t, clock.Now().Add(time.Hour), ran.NextRun)
+
+	// an unchanged run doesn't notify
+	clock.Advance(time.Hour)
+	clock.WaitForWaits(t, 4)
+	require.EqualValues(t, 2*len(domains), scans.Load())
+	require.Empty(t, notifier.Changes())
+
+	spf.Store("v=spf1 include:_spf.example.com -all")
+
+	clock.Advance(time.Hour)
+	clock.WaitForWaits(t, 5)
+	require.Len(t, notifier.Changes(), len(domains))
+
+	change := notifier.Changes()[0]
+	require.Equal(t, created.ID, change.ScheduleID)
+	require.Equal(t, "v=spf1 -all", change.Previous.ScanResult.SPF)
+	require.Equal(t, "v=spf1 include:_spf.example.com -all", change.Current.ScanResult.SPF)
+
+	// the findings are compared with the previous run
+	require.Equal(t, []model.Finding{{Check: "spf", Message: "Your SPF record is v=spf1 include:_spf.example.com -all.", Severity: "info", Status: model.FindingNew}}, change.Current.Findings)
+	require.Equal(t, []model.Finding{{Check: "spf", Message: "Your SPF record is v=spf1 -all.", Severity: "info", Status: model.FindingResolved}}, change.Current.Resolved)
+	require.Equal(t, change.Current, scheduler.Latest(DefaultTenant, change.Domain))
+	require.Nil(t, scheduler.Latest("other", change.Domain))
+
+	removed, err := scheduler.Remove(DefaultTenant, created.ID)
+	require.NoError(t, err)
+	require.True(t, removed)
+	require.Empty(t, scheduler.List(DefaultTenant))
+	require.Empty(t, store.Results(DefaultTenant, created.ID))
+}
+
+func TestScheduler_Jitter(t *testing.T) {
+	clock := newFakeClock()
+
+	store, err := OpenStore("")
+	require.NoError(t, err)
+
+	scheduler := New(zerolog.Nop(), store, nil, WithClock(clock), WithMaxJitter(5*time.Minute))
+
+	for range 50 {
+		created, err := scheduler.Add(DefaultTenant, []string{"example.com"}, "1h", "")
+		require.NoError(t, err)
+
+		// a tenth of the interval is 6 minutes, so the maximum jitter applies
+		jitter := created.NextRun.Sub(clock.Now().Add(time.Hour))
+		require.GreaterOrEqual(t, jitter, time.Duration(0))
+		require.Less(t, jitter, 5*time.Minute)
+	}
+
+	created, err := scheduler.Add(DefaultTenant, []string{"example.com"}, "10m", "")
+	require.NoError(t, err)
+
+	jitter := created.NextRun.Sub(clock.Now().Add(10 * time.Minute))
+	require.GreaterOrEqual(t, jitter, time.Duration(0))
+	require.Less(t, jitter, time.Minute)
+}
+
+func TestScheduler_Persistence(t *testing.T) {
+	clock := newFakeClock()
+	path := filepath.Join(t.TempDir(), "schedules.json")
+
+	store, err := OpenStore(path)
+	require.NoError(t, err)
+
+	scheduler := New(zerolog.Nop(), store, nil, WithClock(clock), WithMaxJitter(0))
+
+	created, err := scheduler.Add(DefaultTenant, []string{"example.com"}, "", "0 6 * * *")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, time.March, 16, 6, 0, 0, 0, time.UTC), created.NextRun)
+
+	require.NoError(t, store.PutResults(DefaultTenant, created.ID, map[string]*model.ScanResult{
+		"example.com": {ScanResult: &scanner.Result{Domain: "example.com", SPF: "v=spf1 -all"}},
+	}))
+
+	t.Run("Restart", func(t *testing.T) {
+		reopened, err := OpenStore(path)
+		require.NoError(t, err)
+
+		restarted := New(zerolog.Nop(), reopened, nil, WithClock(clock))
+		require.Equal(t, []Schedule{created}, restarted.List(DefaultTenant))
+
+		_, results, ok := restarted.Get(DefaultTenant, created.ID)
+		require.True(t, ok)
+		require.Equal(t, "v=spf1 -all", results["example.com"].ScanResult.SPF)
+	})
+
+	t.Run("Overdue", func(t *testing.T) {
+		clock.Advance(48 * time.Hour)
+
+		reopened, err := OpenStore(path)
+		require.NoError(t, err)
+
+		restarted := New(zerolog.Nop(), reopened, nil, WithClock(clock), WithMaxJitter(5*time.Minute))
+
+		rescheduled, _, ok := restarted.Get(DefaultTenant, created.ID)
+		require.True(t, ok)
+		require.False(t, rescheduled.NextRun.Before(clock.Now()))
+		require.True(t, rescheduled.NextRun.Before(clock.Now().Add(5*time.Minute)))
+	})
+}
+
+func TestScheduler_Tenants(t *testing.T) {
+	store, err := OpenStore("")
+	require.NoError(t, err)
+
+	scheduler := New(zerolog.Nop(), store, nil, WithClock(newFakeClock()))
+
+	acme, err := scheduler.Add("acme", []string{"acme.example", "acme.example.net"}, "1h", "")
+	require.NoError(t, err)
+	require.Equal(t, "acme", acme.Tenant)
+
+	_, err = scheduler.Add("globex", []string{"globex.example"}, "1h", "")
+	require.NoError(t, err)
+
+	require.NoError(t, store.PutResults("acme", acme.ID, map[string]*model.ScanResult{
+		"acme.example": {ScanResult: &scanner.Result{Domain: "acme.example"}},
+	}))
+
+	// another tenant can neither read, list nor remove the schedule, nor write its results
+	_, results, ok := scheduler.Get("globex", acme.ID)
+	require.False(t, ok)
+	require.Nil(t, results)
+	require.Len(t, scheduler.List("globex"), 1)
+	require.Empty(t, store.Results("globex", acme.ID))
+	require.NoError(t, store.PutResults("globex", acme.ID, map[string]*model.ScanResult{
+		"acme.example": {ScanResult: &scanner.Result{Domain: "acme.example", SPF: "v=spf1 +all"}},
+	}))
+
+	removed, err := scheduler.Remove("globex", acme.ID)
+	require.NoError(t, err)
+	require.False(t, removed)
+
+	_, results, ok = scheduler.Get("acme", acme.ID)
+	require.True(t, ok)
+	require.Empty(t, results["acme.example"].ScanResult.SPF)
+
+	require.Equal(t, map[string]Usage{
+		"acme":   {Schedules: 1, Domains: 2},
+		"globex": {Schedules: 1, Domains: 1},
+	}, scheduler.Usage())
+}
+
+func TestOpenStore_Migration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+
+	// a store written before tenants were added
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"schedules": {"5f2b6c2d9a1e4f07": {"id": "5f2b6c2d9a1e4f07", "domains": ["example.com"], "interval": "6h", "createdAt": "2024-03-15T10:00:00Z", "nextRun": "2024-03-15T16:00:00Z"}},
+		"results": {"5f2b6c2d9a1e4f07": {"example.com": {"scanResult": {"domain": "example.com", "spf": "v=spf1 -all"}}}}
+	}`), 0o600))
+
+	store, err := OpenStore(path)
+	require.NoError(t, err)
+
+	schedules := store.Schedules()
+	require.Len(t, schedules, 1)
+	require.Equal(t, DefaultTenant, schedules[0].Tenant)
+	require.Equal(t, "v=spf1 -all", store.Results(DefaultTenant, "5f2b6c2d9a1e4f07")["example.com"].ScanResult.SPF)
+
+	// the migrated store is written back in the current format
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var migrated map[string]any
+	require.NoError(t, json.Unmarshal(data, &migrated))
+	require.EqualValues(t, 1, migrated["version"])
+	require.NotContains(t, migrated, "schedules")
+	require.Contains(t, migrated["tenants"], DefaultTenant)
+
+	reopened, err := OpenStore(path)
+	require.NoError(t, err)
+	require.Equal(t, schedules, reopened.Schedules())
+
+	t.Run("NewerVersion", func(t *testing.T) {
+		newer := filepath.Join(t.TempDir(), "schedules.json")
+		require.NoError(t, os.WriteFile(newer, []byte(`{"version": 99, "tenants": {}}`), 0o600))
+
+		_, err := OpenStore(newer)
+		require.ErrorContains(t, err, "newer than this version supports")
+	})
+}
@@ -0,0 +1,286 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/goccy/go-json"
+)
+
+// DefaultTenant owns every schedule when tenants aren't configured, along with
+// the schedules of single-tenant stores written before tenants were added.
+const DefaultTenant = "default"
+
+// storeVersion is the version of the store's file format. Version 0 (which
+// has no version field) predates tenants.
+const storeVersion = 1
+
+type (
+	// Store persists schedules and the latest result of each of their domains
+	// to a JSON file, so they survive restarts. Everything is namespaced by
+	// the tenant that owns it. The whole file is rewritten (atomically, via a
+	// rename) on every change, so it's only suited to a modest number of
+	// schedules.
+	Store struct {
+		mutex sync.Mutex
+		path  string
+		state storeState
+	}
+
+	storeState struct {
+		Version int                     `json:"version"`
+		Tenants map[string]*tenantState `json:"tenants"`
+
+		// Schedules and Results are only read from version 0 stores, and are
+		// migrated to the default tenant.
+		Schedules map[string]Schedule                     `json:"schedules,omitempty"`
+		Results   map[string]map[string]*model.ScanResult `json:"results,omitempty"`
+	}
+
+	tenantState struct {
+		Schedules map[string]Schedule `json:"schedules"`
+
+		// Results holds the latest result of each domain, keyed by schedule ID
+		// then domain.
+		Results map[string]map[string]*model.ScanResult `json:"results"`
+	}
+)
+
+// OpenStore opens (or creates) the store at path, migrating it to the current
+// file format if it was written by an earlier version. An empty path keeps
+// the store in memory, so nothing survives a restart.
+func OpenStore(path string) (*Store, error) {
+	store := &Store{
+		path: path,
+		state: storeState{
+			Version: storeVersion,
+			Tenants: make(map[string]*tenantState),
+		},
+	}
+
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read schedule store: %w", err)
+	}
+
+	// files without a version field predate versioning, so start from version 0
+	store.state = storeState{}
+
+	if err = json.Unmarshal(data, &store.state); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule store %s: %w", path, err)
+	}
+
+	if store.state.Version > storeVersion {
+		return nil, fmt.Errorf("schedule store %s has version %d, which is newer than this version supports (%d)", path, store.state.Version, storeVersion)
+	}
+
+	if store.state.Tenants == nil {
+		store.state.Tenants = make(map[string]*tenantState)
+	}
+
+	if store.state.Version < storeVersion {
+		store.migrate()
+
+		if err = store.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+// migrate upgrades a version 0 store, moving its schedules and results to the
+// default tenant.
+func (s *Store) migrate() {
+	if len(s.state.Schedules) > 0 {
+		tenant := s.tenant(DefaultTenant)
+
+		for id, schedule := range s.state.Schedules {
+			schedule.Tenant = DefaultTenant
+			tenant.Schedules[id] = schedule
+
+			if results := s.state.Results[id]; results != nil {
+				tenant.Results[id] = results
+			}
+		}
+	}
+
+	s.state.Version = storeVersion
+	s.state.Schedules, s.state.Results = nil, nil
+}
+
+// tenant returns the tenant's state, creating it if needed. The caller must
+// hold the mutex.
+func (s *Store) tenant(name string) *tenantState {
+	tenant, ok := s.state.Tenants[name]
+	if !ok {
+		tenant = &tenantState{
+			Schedules: make(map[string]Schedule),
+			Results:   make(map[string]map[string]*model.ScanResult),
+		}
+		s.state.Tenants[name] = tenant
+	}
+
+	return tenant
+}
+
+// Schedules returns every stored schedule, of every tenant.
+func (s *Store) Schedules() []Schedule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var schedules []Schedule
+	for _, tenant := range s.state.Tenants {
+		for _, schedule := range tenant.Schedules {
+			schedules = append(schedules, schedule)
+		}
+	}
+
+	return schedules
+}
+
+// PutSchedule adds (or replaces) a schedule of its tenant.
+func (s *Store) PutSchedule(schedule Schedule) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tenant(schedule.Tenant).Schedules[schedule.ID] = schedule
+
+	return s.save()
+}
+
+// DeleteSchedule removes a tenant's schedule, along with its results.
+func (s *Store) DeleteSchedule(tenant, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if state, ok := s.state.Tenants[tenant]; ok {
+		delete(state.Schedules, id)
+		delete(state.Results, id)
+	}
+
+	return s.save()
+}
+
+// Results returns the latest result of each of a tenant's schedule's domains,
+// keyed by domain.
+func (s *Store) Results(tenant, id string) map[string]*model.ScanResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var stored map[string]*model.ScanResult
+	if state, ok := s.state.Tenants[tenant]; ok {
+		stored = state.Results[id]
+	}
+
+	results := make(map[string]*model.ScanResult, len(stored))
+	for domain, result := range stored {
+		results[domain] = result
+	}
+
+	return results
+}
+
+// LatestResult returns the most recent result of the (normalized) domain
+// stored by any of a tenant's schedules, or nil if none of them has scanned
+// it.
+func (s *Store) LatestResult(tenant, domain string) *model.ScanResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.state.Tenants[tenant]
+	if !ok {
+		return nil
+	}
+
+	var latest *model.ScanResult
+	for _, results := range state.Results {
+		for scheduled, result := range results {
+			// schedules keep their domains as given, but each result has the normalized domain
+			if result == nil || (scheduled != domain && result.Domain != domain) {
+				continue
+			}
+
+			if latest == nil || (result.ScannedAt != nil && (latest.ScannedAt == nil || result.ScannedAt.After(*latest.ScannedAt))) {
+				latest = result
+			}
+		}
+	}
+
+	return latest
+}
+
+// PutResults replaces the latest result of each of the given domains of a
+// tenant's schedule. Results of a schedule that no longer exists are
+// discarded.
+func (s *Store) PutResults(tenant, id string, results map[string]*model.ScanResult) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.state.Tenants[tenant]
+	if !ok {
+		return nil
+	}
+
+	if _, ok = state.Schedules[id]; !ok {
+		return nil
+	}
+
+	if state.Results[id] == nil {
+		state.Results[id] = make(map[string]*model.ScanResult)
+	}
+
+	for domain, result := range results {
+		state.Results[id][domain] = result
+	}
+
+	return s.save()
+}
+
+// save writes the store to its file, if it has one. The caller must hold the
+// mutex.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule store: %w", err)
+	}
+
+	// write to a temporary file in the same directory first, so an interrupted write can't corrupt the store
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write schedule store: %w", err)
+	}
+
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), s.path)
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return fmt.Errorf("failed to write schedule store: %w", err)
+	}
+
+	return nil
+}
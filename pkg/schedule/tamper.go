@@ -0,0 +1,309 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+type (
+	// Tamper is a scheduled scan whose DMARC, SPF or DKIM records changed in a
+	// way that weakens the domain's mail authentication, which can be an early
+	// sign of its DNS being hijacked.
+	Tamper struct {
+		Tenant     string        `json:"tenant" doc:"The tenant that owns the schedule."`
+		ScheduleID string        `json:"scheduleId" doc:"The ID of the schedule that scanned the domain."`
+		Domain     string        `json:"domain" doc:"The domain whose records were weakened."`
+		DetectedAt time.Time     `json:"detectedAt" doc:"When the scan that found the weakened records completed."`
+		Alerts     []TamperAlert `json:"alerts" doc:"Each way the domain's records were weakened since its previous scheduled scan."`
+	}
+
+	// TamperAlert is a change to a record that matched one of the tamper
+	// rules, with the record's text before and after the change.
+	TamperAlert struct {
+		Rule     string `json:"rule" doc:"The tamper rule the change matched." example:"dmarc-policy-weakened"`
+		Record   string `json:"record" doc:"The record that changed: dmarc, spf or dkim." example:"dmarc"`
+		Selector string `json:"selector,omitempty" doc:"The selector of the DKIM key that changed, if the record is dkim." example:"s1"`
+		Severity string `json:"severity" doc:"The alert's severity, which is always critical." example:"critical"`
+		Message  string `json:"message" doc:"How the record was weakened." example:"The DMARC policy was weakened from p=reject to p=none."`
+		Before   string `json:"before" doc:"The record's text before the change." example:"v=DMARC1; p=reject"`
+		After    string `json:"after" doc:"The record's text after the change, or empty if it was removed." example:"v=DMARC1; p=none"`
+	}
+
+	// TamperNotifier is notified of each tamper alert found by a scheduled
+	// scan, as soon as the scan completes. Notifiers that implement it are
+	// sent any tamper alerts separately from (and before) the changes they're
+	// part of (see WithTamperAlerts).
+	TamperNotifier interface {
+		NotifyTamper(ctx context.Context, tamper Tamper) error
+	}
+
+	// tamperRule matches a change to a record that weakens it. Changes that no
+	// rule matches are routine, and only notified as changes.
+	tamperRule struct {
+		name   string
+		record string
+
+		// check returns the alert's message if the change from before to
+		// after matches the rule, or an empty string if it doesn't.
+		check func(before, after string) string
+	}
+)
+
+// tamperSeverity is the severity of every tamper alert.
+const tamperSeverity = "critical"
+
+// dmarcPolicyStrength ranks DMARC policies by how much of a domain's
+// unauthenticated mail they stop. Missing or unknown policies rank as none.
+var dmarcPolicyStrength = map[string]int{"none": 0, "quarantine": 1, "reject": 2}
+
+// spfAllPermissiveness ranks the qualifiers of SPF's all mechanism by how
+// much mail from unauthorized servers they let through. A record without one
+// is neutral about them, as ?all is.
+var spfAllPermissiveness = map[string]int{"-": 0, "~": 1, "": 2, "?": 2, "+": 3}
+
+// tamperRules are the changes to a domain's records that weaken its mail
+// authentication. They're checked in order, and a change may match several.
+var tamperRules = []tamperRule{
+	{"dmarc-removed", "dmarc", func(before, after string) string {
+		if before != "" && after == "" {
+			return "The DMARC record was removed."
+		}
+
+		return ""
+	}},
+	{"dmarc-policy-weakened", "dmarc", func(before, after string) string {
+		from, to := dmarcPolicy(before, "p", ""), dmarcPolicy(after, "p", "")
+		if after != "" && dmarcPolicyStrength[to] < dmarcPolicyStrength[from] {
+			return fmt.Sprintf("The DMARC policy was weakened from p=%s to p=%s.", from, to)
+		}
+
+		return ""
+	}},
+	{"dmarc-subdomain-policy-weakened", "dmarc", func(before, after string) string {
+		// the subdomain policy falls back to the domain's policy
+		from, to := dmarcPolicy(before, "sp", dmarcPolicy(before, "p", "")), dmarcPolicy(after, "sp", dmarcPolicy(after, "p", ""))
+		if after != "" && dmarcPolicyStrength[to] < dmarcPolicyStrength[from] {
+			return fmt.Sprintf("The DMARC subdomain policy was weakened from sp=%s to sp=%s.", from, to)
+		}
+
+		return ""
+	}},
+	{"dmarc-percentage-lowered", "dmarc", func(before, after string) string {
+		// the percentage only matters to policies that are enforced
+		from, to := dmarcPercentage(before), dmarcPercentage(after)
+		if dmarcPolicyStrength[dmarcPolicy(before, "p", "")] > 0 && dmarcPolicyStrength[dmarcPolicy(after, "p", "")] > 0 && to < from {
+			return fmt.Sprintf("The share of failing mail the DMARC policy applies to was lowered from pct=%d to pct=%d.", from, to)
+		}
+
+		return ""
+	}},
+	{"spf-removed", "spf", func(before, after string) string {
+		if before != "" && after == "" {
+			return "The SPF record was removed."
+		}
+
+		return ""
+	}},
+	{"spf-all-permissive", "spf", func(before, after string) string {
+		if qualifier := spfAll(after); (qualifier == "+" || qualifier == "?") && spfAllPermissiveness[qualifier] > spfAllPermissiveness[spfAll(before)] {
+			return fmt.Sprintf("The SPF record's all mechanism became %sall, so any server may send the domain's mail.", qualifier)
+		}
+
+		return ""
+	}},
+	{"spf-include-added", "spf", func(before, after string) string {
+		if before == "" {
+			return ""
+		}
+
+		previous := make(map[string]struct{})
+		for _, term := range spfDelegations(before) {
+			previous[term] = struct{}{}
+		}
+
+		var added []string
+		for _, term := range spfDelegations(after) {
+			if _, ok := previous[term]; !ok {
+				added = append(added, term)
+			}
+		}
+
+		if len(added) > 0 {
+			return fmt.Sprintf("The SPF record gained %s, authorizing another domain's senders to send the domain's mail.", strings.Join(added, ", "))
+		}
+
+		return ""
+	}},
+	{"dkim-key-replaced", "dkim", func(before, after string) string {
+		if dkimPublicKey(before) != dkimPublicKey(after) {
+			return "The DKIM key was replaced with a different key, so mail signed by its previous holder no longer verifies, and mail signed by the new key's holder does."
+		}
+
+		return ""
+	}},
+}
+
+// WithTamperAlerts enables tamper alerts: each scheduled scan whose DMARC,
+// SPF or DKIM records were weakened since the domain's previous scan is sent
+// to the notifiers that implement TamperNotifier as soon as it completes,
+// rather than once the run does, separately from the change it's part of.
+func WithTamperAlerts() Option {
+	return func(s *Scheduler) {
+		s.tamperAlerts = true
+	}
+}
+
+// tamperAlerts returns an alert for each tamper rule the changes between the
+// previous and current results match, in rule order. DKIM keys are only
+// compared at selectors found by both scans, as a key that's no longer found
+// may just have been rotated to another selector.
+func tamperAlerts(previous, current *model.ScanResult) []TamperAlert {
+	if previous == nil || current == nil || previous.ScanResult == nil || current.ScanResult == nil {
+		return nil
+	}
+
+	before, after := previous.ScanResult, current.ScanResult
+
+	previousKeys, currentKeys := dkimKeys(before), dkimKeys(after)
+
+	selectors := make([]string, 0, len(currentKeys))
+	for selector := range currentKeys {
+		if _, ok := previousKeys[selector]; ok {
+			selectors = append(selectors, selector)
+		}
+	}
+
+	sort.Strings(selectors)
+
+	var alerts []TamperAlert
+
+	for _, rule := range tamperRules {
+		switch rule.record {
+		case "dmarc":
+			alerts = appendTamperAlert(alerts, rule, "", before.DMARC, after.DMARC)
+		case "spf":
+			alerts = appendTamperAlert(alerts, rule, "", before.SPF, after.SPF)
+		case "dkim":
+			for _, selector := range selectors {
+				alerts = appendTamperAlert(alerts, rule, selector, previousKeys[selector], currentKeys[selector])
+			}
+		}
+	}
+
+	return alerts
+}
+
+// appendTamperAlert appends an alert to alerts if the rule matches the change
+// from before to after.
+func appendTamperAlert(alerts []TamperAlert, rule tamperRule, selector, before, after string) []TamperAlert {
+	if before == after {
+		return alerts
+	}
+
+	message := rule.check(before, after)
+	if message == "" {
+		return alerts
+	}
+
+	return append(alerts, TamperAlert{Rule: rule.name, Record: rule.record, Selector: selector, Severity: tamperSeverity, Message: message, Before: before, After: after})
+}
+
+// dmarcPolicy returns the (lowercase) value of a DMARC record's policy tag,
+// or fallback if the record doesn't have it.
+func dmarcPolicy(record, tag, fallback string) string {
+	if value, ok := dmarcTags(record)[tag]; ok {
+		return strings.ToLower(value)
+	}
+
+	return fallback
+}
+
+// dmarcPercentage returns a DMARC record's pct tag, which defaults to 100.
+func dmarcPercentage(record string) int {
+	percentage, err := strconv.Atoi(dmarcTags(record)["pct"])
+	if err != nil {
+		return 100
+	}
+
+	return percentage
+}
+
+// dmarcTags returns the tags of a DMARC record, keyed by their lowercase
+// names.
+func dmarcTags(record string) map[string]string {
+	tags := make(map[string]string)
+
+	for _, tag := range strings.Split(record, ";") {
+		if name, value, ok := strings.Cut(tag, "="); ok {
+			tags[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+
+	return tags
+}
+
+// spfAll returns the qualifier of an SPF record's all mechanism (such as "-"
+// or "+"), or an empty string if it has none.
+func spfAll(record string) string {
+	for _, term := range strings.Fields(strings.ToLower(record)) {
+		switch term {
+		case "all", "+all":
+			return "+"
+		case "-all", "~all", "?all":
+			return term[:1]
+		}
+	}
+
+	return ""
+}
+
+// spfDelegations returns the include mechanisms and redirect modifier of an
+// SPF record, which authorize another domain's senders, in lowercase.
+func spfDelegations(record string) []string {
+	var terms []string
+
+	for _, term := range strings.Fields(strings.ToLower(record)) {
+		term = strings.TrimPrefix(term, "+")
+
+		if strings.HasPrefix(term, "include:") || strings.HasPrefix(term, "redirect=") {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// dkimKeys returns the DKIM keys found by a scan, keyed by selector.
+func dkimKeys(result *scanner.Result) map[string]string {
+	keys := make(map[string]string)
+
+	if result.DKIM != "" && result.DKIMSelector != "" {
+		keys[result.DKIMSelector] = result.DKIM
+	}
+
+	for _, key := range result.DKIMKeys {
+		keys[key.Selector] = key.Record
+	}
+
+	return keys
+}
+
+// dkimPublicKey returns the public key data (the p= tag) of a DKIM key
+// record, with any whitespace removed, as the rest of the record can change
+// without the key changing.
+func dkimPublicKey(record string) string {
+	for _, tag := range strings.Split(record, ";") {
+		if name, value, ok := strings.Cut(tag, "="); ok && strings.TrimSpace(name) == "p" {
+			return strings.Join(strings.Fields(value), "")
+		}
+	}
+
+	return ""
+}
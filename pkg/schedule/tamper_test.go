@@ -0,0 +1,254 @@
+package schedule
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingTamperNotifier records every change and tamper alert it's
+// notified of.
+type recordingTamperNotifier struct {
+	recordingNotifier
+	tampers []Tamper
+}
+
+func (n *recordingTamperNotifier) NotifyTamper(_ context.Context, tamper Tamper) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.tampers = append(n.tampers, tamper)
+
+	return nil
+}
+
+func (n *recordingTamperNotifier) Tampers() []Tamper {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return append([]Tamper(nil), n.tampers...)
+}
+
+func TestTamperAlerts(t *testing.T) {
+	const (
+		key    = "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"
+		newKey = "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEB"
+	)
+
+	tests := []struct {
+		name            string
+		before, after   scanner.Result
+		rules, messages []string
+	}{
+		{
+			name:   "DMARCWeakened",
+			before: scanner.Result{DMARC: "v=DMARC1; p=reject"},
+			after:  scanner.Result{DMARC: "v=DMARC1; p=none"},
+			rules:  []string{"dmarc-policy-weakened", "dmarc-subdomain-policy-weakened"},
+			messages: []string{
+				"The DMARC policy was weakened from p=reject to p=none.",
+				"The DMARC subdomain policy was weakened from sp=reject to sp=none.",
+			},
+		},
+		{
+			name:   "DMARCQuarantined",
+			before: scanner.Result{DMARC: "v=DMARC1; p=reject; sp=none"},
+			after:  scanner.Result{DMARC: "v=DMARC1; p=QUARANTINE; sp=none"},
+			rules:  []string{"dmarc-policy-weakened"},
+		},
+		{
+			name:   "DMARCSubdomainPolicy",
+			before: scanner.Result{DMARC: "v=DMARC1; p=reject"},
+			after:  scanner.Result{DMARC: "v=DMARC1; p=reject; sp=none"},
+			rules:  []string{"dmarc-subdomain-policy-weakened"},
+		},
+		{
+			name:     "DMARCPercentage",
+			before:   scanner.Result{DMARC: "v=DMARC1; p=reject"},
+			after:    scanner.Result{DMARC: "v=DMARC1; p=reject; pct=10"},
+			rules:    []string{"dmarc-percentage-lowered"},
+			messages: []string{"The share of failing mail the DMARC policy applies to was lowered from pct=100 to pct=10."},
+		},
+		{
+			name:   "DMARCRemoved",
+			before: scanner.Result{DMARC: "v=DMARC1; p=reject"},
+			rules:  []string{"dmarc-removed"},
+		},
+		{
+			name:   "DMARCStrengthened",
+			before: scanner.Result{DMARC: "v=DMARC1; p=none; pct=100"},
+			after:  scanner.Result{DMARC: "v=DMARC1; p=reject; pct=50; rua=mailto:dmarc@example.com"},
+		},
+		{
+			name:  "DMARCAdded",
+			after: scanner.Result{DMARC: "v=DMARC1; p=none"},
+		},
+		{
+			name:     "SPFPermissive",
+			before:   scanner.Result{SPF: "v=spf1 include:_spf.google.com -all"},
+			after:    scanner.Result{SPF: "v=spf1 include:_spf.google.com +all"},
+			rules:    []string{"spf-all-permissive"},
+			messages: []string{"The SPF record's all mechanism became +all, so any server may send the domain's mail."},
+		},
+		{
+			name:   "SPFNeutral",
+			before: scanner.Result{SPF: "v=spf1 mx ~all"},
+			after:  scanner.Result{SPF: "v=spf1 mx ?all"},
+			rules:  []string{"spf-all-permissive"},
+		},
+		{
+			name:   "SPFSoftfail",
+			before: scanner.Result{SPF: "v=spf1 mx -all"},
+			after:  scanner.Result{SPF: "v=spf1 mx ~all"},
+		},
+		{
+			name:     "SPFInclude",
+			before:   scanner.Result{SPF: "v=spf1 include:_spf.google.com -all"},
+			after:    scanner.Result{SPF: "v=spf1 include:_spf.google.com include:mail.attacker.example +include:spf.other.example -all"},
+			rules:    []string{"spf-include-added"},
+			messages: []string{"The SPF record gained include:mail.attacker.example, include:spf.other.example, authorizing another domain's senders to send the domain's mail."},
+		},
+		{
+			name:   "SPFRedirect",
+			before: scanner.Result{SPF: "v=spf1 redirect=_spf.example.com"},
+			after:  scanner.Result{SPF: "v=spf1 redirect=_spf.attacker.example"},
+			rules:  []string{"spf-include-added"},
+		},
+		{
+			name:   "SPFRoutine",
+			before: scanner.Result{SPF: "v=spf1 include:_spf.google.com include:sendgrid.net -all"},
+			after:  scanner.Result{SPF: "v=spf1 ip4:192.0.2.0/24 INCLUDE:_spf.google.com -all"},
+		},
+		{
+			name:   "SPFRemoved",
+			before: scanner.Result{SPF: "v=spf1 -all"},
+			rules:  []string{"spf-removed"},
+		},
+		{
+			name:   "DKIMReplaced",
+			before: scanner.Result{DKIM: key, DKIMSelector: "s1"},
+			after:  scanner.Result{DKIM: newKey, DKIMSelector: "s1"},
+			rules:  []string{"dkim-key-replaced"},
+		},
+		{
+			name:   "DKIMReformatted",
+			before: scanner.Result{DKIM: key, DKIMSelector: "s1"},
+			after:  scanner.Result{DKIM: "v=DKIM1; p=MIIBIjANBgkqhkiG9w0BAQEFAAOC AQ8AMIIBCgKCAQEA; k=rsa", DKIMSelector: "s1"},
+		},
+		{
+			name:   "DKIMRotated",
+			before: scanner.Result{DKIM: key, DKIMSelector: "s1"},
+			after:  scanner.Result{DKIM: newKey, DKIMSelector: "s2"},
+		},
+		{
+			name:   "DKIMKeys",
+			before: scanner.Result{DKIM: key, DKIMSelector: "rsa", DKIMKeys: []scanner.DKIMKey{{Selector: "rsa", Record: key}, {Selector: "ed25519", Record: "v=DKIM1; k=ed25519; p=A"}}},
+			after:  scanner.Result{DKIM: key, DKIMSelector: "rsa", DKIMKeys: []scanner.DKIMKey{{Selector: "rsa", Record: key}, {Selector: "ed25519", Record: "v=DKIM1; k=ed25519; p=B"}}},
+			rules:  []string{"dkim-key-replaced"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alerts := tamperAlerts(&model.ScanResult{ScanResult: &test.before}, &model.ScanResult{ScanResult: &test.after})
+
+			var rules, messages []string
+			for _, alert := range alerts {
+				rules, messages = append(rules, alert.Rule), append(messages, alert.Message)
+				require.Equal(t, "critical", alert.Severity)
+				require.NotEqual(t, alert.Before, alert.After)
+			}
+
+			require.Equal(t, test.rules, rules)
+
+			if test.messages != nil {
+				require.Equal(t, test.messages, messages)
+			}
+		})
+	}
+
+	t.Run("BeforeAndAfter", func(t *testing.T) {
+		alerts := tamperAlerts(
+			&model.ScanResult{ScanResult: &scanner.Result{DKIM: key, DKIMSelector: "s1", SPF: "v=spf1 -all"}},
+			&model.ScanResult{ScanResult: &scanner.Result{DKIM: newKey, DKIMSelector: "s1", SPF: "v=spf1 +all"}},
+		)
+
+		require.Equal(t, []TamperAlert{
+			{Rule: "spf-all-permissive", Record: "spf", Severity: "critical", Message: "The SPF record's all mechanism became +all, so any server may send the domain's mail.", Before: "v=spf1 -all", After: "v=spf1 +all"},
+			{Rule: "dkim-key-replaced", Record: "dkim", Selector: "s1", Severity: "critical", Message: "The DKIM key was replaced with a different key, so mail signed by its previous holder no longer verifies, and mail signed by the new key's holder does.", Before: key, After: newKey},
+		}, alerts)
+	})
+
+	t.Run("NoPrevious", func(t *testing.T) {
+		require.Nil(t, tamperAlerts(nil, &model.ScanResult{ScanResult: &scanner.Result{SPF: "v=spf1 +all"}}))
+	})
+}
+
+func TestScheduler_TamperAlerts(t *testing.T) {
+	clock := newFakeClock()
+
+	store, err := OpenStore("")
+	require.NoError(t, err)
+
+	var (
+		dmarc   atomic.Value
+		scans   atomic.Int32
+		release = make(chan struct{})
+	)
+
+	dmarc.Store("v=DMARC1; p=reject")
+
+	scan := func(ctx context.Context, domain string) (*model.ScanResult, error) {
+		defer scans.Add(1)
+
+		// the other domain's scan is held up, so the alert can't wait for the run to complete
+		if domain == "slow.example" && scans.Load() >= 2 {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+		}
+
+		return &model.ScanResult{ScanResult: &scanner.Result{Domain: domain, DMARC: dmarc.Load().(string)}}, nil
+	}
+
+	notifier := &recordingTamperNotifier{}
+	plain := &recordingNotifier{}
+	scheduler := New(zerolog.Nop(), store, scan, WithClock(clock), WithMaxJitter(0), WithNotifiers(notifier, plain), WithTamperAlerts())
+
+	_, err = scheduler.Add(DefaultTenant, []string{"example.com", "slow.example"}, "1h", "")
+	require.NoError(t, err)
+
+	startScheduler(t, scheduler)
+	clock.WaitForWaits(t, 2)
+	clock.Advance(time.Hour)
+	clock.WaitForWaits(t, 3)
+	require.Empty(t, notifier.Tampers())
+
+	dmarc.Store("v=DMARC1; p=none")
+	clock.Advance(time.Hour)
+
+	require.Eventually(t, func() bool { return len(notifier.Tampers()) == 1 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, "example.com", notifier.Tampers()[0].Domain)
+	require.Empty(t, notifier.Changes(), "the changes are only notified once the run completes")
+
+	close(release)
+	clock.WaitForWaits(t, 4)
+	require.Len(t, notifier.Tampers(), 2)
+
+	tamper := notifier.Tampers()[0]
+	require.Equal(t, clock.Now(), tamper.DetectedAt)
+	require.Equal(t, "dmarc-policy-weakened", tamper.Alerts[0].Rule)
+	require.Equal(t, "v=DMARC1; p=reject", tamper.Alerts[0].Before)
+	require.Equal(t, "v=DMARC1; p=none", tamper.Alerts[0].After)
+
+	// the routine changes are still notified, to every notifier
+	require.Len(t, notifier.Changes(), 2)
+	require.Len(t, plain.Changes(), 2)
+}